@@ -23,6 +23,22 @@ const (
 
 	// DataSecretAvailableCondition reports whether the bootstrap data secret is available
 	DataSecretAvailableCondition = "DataSecretAvailable"
+
+	// KubernetesVersionMatchedCondition reports whether the Node backing the
+	// owning Machine runs the Kubernetes version requested by
+	// spec.kubernetesVersion. It is informational: it never gates bootstrap
+	// data generation.
+	KubernetesVersionMatchedCondition = "KubernetesVersionMatched"
+
+	// ServerAddressMatchedCondition reports whether spec.serverAddress points
+	// at the Cluster's controlPlaneEndpoint. It is informational: it never
+	// gates bootstrap data generation.
+	ServerAddressMatchedCondition = "ServerAddressMatched"
+
+	// AirgapImagesReadyCondition reports the result of the spec.airgapImages
+	// preload, as pushed by control-plane nodes over the node-push channel. It
+	// is informational: it never gates bootstrap data generation.
+	AirgapImagesReadyCondition = "AirgapImagesReady"
 )
 
 // Condition reasons
@@ -44,4 +60,24 @@ const (
 
 	// BootstrapFailedReason indicates that bootstrap failed
 	BootstrapFailedReason = "BootstrapFailed"
+
+	// WaitingForNodeInfoReason indicates that the owning Machine has no Node
+	// info yet, so the running Kubernetes version cannot be compared.
+	WaitingForNodeInfoReason = "WaitingForNodeInfo"
+
+	// KubernetesVersionMismatchReason indicates that the Node reports a kubelet
+	// version different from spec.kubernetesVersion.
+	KubernetesVersionMismatchReason = "KubernetesVersionMismatch"
+
+	// ServerAddressMismatchReason indicates that spec.serverAddress names a
+	// different host or port than the Cluster's controlPlaneEndpoint.
+	ServerAddressMismatchReason = "ServerAddressMismatch"
+
+	// WaitingForAirgapImagesReason indicates that the node has not reported
+	// its airgap preload result yet.
+	WaitingForAirgapImagesReason = "WaitingForAirgapImages"
+
+	// AirgapImagesMissingReason indicates that the node could not place a
+	// spec.airgapImages bundle, so the distribution service does not start.
+	AirgapImagesMissingReason = "AirgapImagesMissing"
 )
@@ -18,6 +18,7 @@ package v1beta2
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
@@ -27,6 +28,12 @@ const (
 	// removing it from the API server.
 	KairosConfigFinalizer = "kairosconfig.bootstrap.cluster.x-k8s.io"
 
+	// SecretTypeLabel is the label key under which every per-cluster Secret
+	// the controllers create records its type, so Secret-watch predicates
+	// match by label (KD-15), never by name suffix. The *SecretTypeValue
+	// constants below are its values.
+	SecretTypeLabel = "controlplane.cluster.x-k8s.io/secret-type"
+
 	// ControlPlaneJoinTokenSecretSuffix is appended to the cluster name to form
 	// the per-cluster HA control-plane join-token Secret name (ADR 0005 Phase 3).
 	// Shared here so the controlplane controller (which creates + owns it) and
@@ -37,12 +44,32 @@ const (
 	// ControlPlaneJoinTokenSecretTypeLabel + Value mark the join-token Secret so
 	// controllers' Secret-watch predicates match it by label (KD-15), never by
 	// name suffix.
-	ControlPlaneJoinTokenSecretTypeLabel = "controlplane.cluster.x-k8s.io/secret-type"
+	ControlPlaneJoinTokenSecretTypeLabel = SecretTypeLabel
 	ControlPlaneJoinTokenSecretTypeValue = "control-plane-join-token"
 
 	// ControlPlaneJoinTokenSecretDataKey is the data key holding the join token.
 	ControlPlaneJoinTokenSecretDataKey = "token"
 
+	// WorkerTokenSecretSuffix is appended to the cluster name to form the
+	// per-cluster worker join-token Secret name. The KairosControlPlane
+	// controller creates and owns it; k0s and k3s workers without a token of
+	// their own resolve it automatically, others reference it through
+	// WorkerTokenSecretRef. It is marked with the secret-type label below and
+	// stores the token under ControlPlaneJoinTokenSecretDataKey.
+	WorkerTokenSecretSuffix = "worker-token"
+
+	// WorkerTokenSecretTypeValue is the secret-type label value of the worker
+	// join-token Secret.
+	WorkerTokenSecretTypeValue = "worker-token"
+
+	// WorkerTokenIssuedAtAnnotation and WorkerTokenExpiresAtAnnotation record,
+	// in RFC 3339, when the token in the worker join-token Secret was issued
+	// and when it expires. The KairosControlPlane controller sets them and
+	// schedules rotation from them; a node publishing a new token clears them
+	// so the controller stamps the new one.
+	WorkerTokenIssuedAtAnnotation  = "controlplane.cluster.x-k8s.io/worker-token-issued-at"
+	WorkerTokenExpiresAtAnnotation = "controlplane.cluster.x-k8s.io/worker-token-expires-at"
+
 	// EtcdStatusSecretSuffix is appended to the cluster name to form the
 	// per-cluster HA etcd-health Secret name (ADR 0005 §E.1). Every control-plane
 	// node PATCHes its own member key over the node-push channel; the controlplane
@@ -53,8 +80,21 @@ const (
 
 	// EtcdStatusSecretTypeLabel + Value mark the etcd-status Secret so controllers'
 	// Secret-watch predicates match it by label (KD-15), never by name suffix.
-	EtcdStatusSecretTypeLabel = "controlplane.cluster.x-k8s.io/secret-type"
+	EtcdStatusSecretTypeLabel = SecretTypeLabel
 	EtcdStatusSecretTypeValue = "etcd-status"
+
+	// AirgapStatusSecretSuffix is appended to the cluster name to form the
+	// per-cluster airgap preload report Secret name. A control-plane node with
+	// spec.airgapImages PATCHes the preload result under its KairosConfig name
+	// over the node-push channel; the bootstrap controller pre-creates the
+	// (empty) Secret, Cluster-owned like the etcd-status Secret, and reads it
+	// into AirgapImagesReadyCondition.
+	AirgapStatusSecretSuffix = "airgap-status"
+
+	// AirgapStatusSecretTypeValue marks the airgap-status Secret under
+	// SecretTypeLabel, so the bootstrap controller's watch matches it by label
+	// (KD-15).
+	AirgapStatusSecretTypeValue = "airgap-status"
 )
 
 // ControlPlaneJoinTokenSecretName returns the per-cluster HA join-token Secret
@@ -63,12 +103,24 @@ func ControlPlaneJoinTokenSecretName(clusterName string) string {
 	return clusterName + "-" + ControlPlaneJoinTokenSecretSuffix
 }
 
+// WorkerTokenSecretName returns the per-cluster worker join-token Secret name
+// for the given cluster.
+func WorkerTokenSecretName(clusterName string) string {
+	return clusterName + "-" + WorkerTokenSecretSuffix
+}
+
 // EtcdStatusSecretName returns the per-cluster HA etcd-status Secret name for the
 // given cluster.
 func EtcdStatusSecretName(clusterName string) string {
 	return clusterName + "-" + EtcdStatusSecretSuffix
 }
 
+// AirgapStatusSecretName returns the per-cluster airgap preload report Secret
+// name for the given cluster.
+func AirgapStatusSecretName(clusterName string) string {
+	return clusterName + "-" + AirgapStatusSecretSuffix
+}
+
 // ControlPlaneRole is the per-machine role discriminator for control-plane
 // nodes. It is assigned by the KairosControlPlane controller and must not be
 // set by end users directly; the value drives which cloud-config shape the
@@ -80,20 +132,22 @@ type ControlPlaneRole string
 const (
 	// ControlPlaneRoleSingle is the role for a single-node control plane.
 	// The bootstrap provider renders the distribution's single-node mode
-	// (k0s --single / k3s single-server). Assigned when spec.replicas == 1
-	// on the owning KairosControlPlane.
+	// (k0s --single / k3s single-server), which cannot accept joiners. The
+	// KairosControlPlane controller no longer assigns it: a one-replica
+	// control plane gets an init node so it can be scaled out. It remains
+	// valid on existing machines.
 	ControlPlaneRoleSingle ControlPlaneRole = "single"
 
 	// ControlPlaneRoleInit is the role for the first (initialising) node of
 	// an HA control plane. The bootstrap provider renders the distribution's
 	// cluster-init path (k0s managed-etcd init / k3s --cluster-init).
-	// Assigned to the oldest CP machine when spec.replicas > 1.
+	// Assigned to the first CP machine at any spec.replicas.
 	ControlPlaneRoleInit ControlPlaneRole = "init"
 
 	// ControlPlaneRoleJoin is the role for subsequent nodes of an HA control
 	// plane. The bootstrap provider renders the distribution's join path
-	// (k0s controller-join / k3s --server). Assigned to all CP machines
-	// other than the init node when spec.replicas > 1.
+	// (k0s controller-join / k3s --server). Assigned to every CP machine
+	// created while an etcd member already exists.
 	ControlPlaneRoleJoin ControlPlaneRole = "join"
 )
 
@@ -105,14 +159,29 @@ type KairosConfigSpec struct {
 	Role string `json:"role,omitempty"`
 
 	// Distribution specifies the Kubernetes distribution to install
-	// +kubebuilder:validation:Enum=k0s;k3s
+	// +kubebuilder:validation:Enum=k0s;k3s;rke2
 	// +kubebuilder:default=k0s
 	Distribution string `json:"distribution,omitempty"`
 
-	// KubernetesVersion specifies the Kubernetes version to install
+	// KubernetesVersion specifies the Kubernetes version to install, as the
+	// distribution release tag (e.g. "v1.34.1+k0s.1" or "v1.33.5+k3s1"). A bare
+	// "vX.Y.Z" matches any distribution release of that Kubernetes version.
+	// Every rendered node verifies the k0s/k3s release it is about to start
+	// against this value before the distribution service starts; see
+	// DistributionRelease for where a matching release is installed from and
+	// what happens on a mismatch.
 	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^v?[0-9]+\.[0-9]+\.[0-9]+([-+][0-9A-Za-z.+-]+)?$`
 	KubernetesVersion string `json:"kubernetesVersion"`
 
+	// DistributionRelease tells the node where to install the k0s/k3s release
+	// matching KubernetesVersion from when the Kairos image ships a different
+	// one, and whether a node that still ends up on a different release fails
+	// or warns. When nil, the node only verifies the release shipped in the
+	// image and refuses to start the distribution on a mismatch.
+	// +optional
+	DistributionRelease *DistributionRelease `json:"distributionRelease,omitempty"`
+
 	// ServerAddress is the address of the Kubernetes API server (for worker nodes)
 	// +optional
 	ServerAddress string `json:"serverAddress,omitempty"`
@@ -139,14 +208,98 @@ type KairosConfigSpec struct {
 	// is serialized with yaml.v3, which automatically selects block-scalar
 	// representation for multi-line content.
 	//
-	// Constraints: at most 32 files; each file's content is limited to 32 KiB
-	// (32768 bytes); paths must be absolute and must not contain .. segments.
+	// Constraints: at most 32 files; each file's inline content is limited to
+	// 32 KiB (32768 bytes); paths must be absolute and must not contain ..
+	// segments. Larger or sensitive content is read from a Secret or ConfigMap
+	// with contentFrom.
 	//
 	// This field was accepted but silently ignored before this release.
 	// +optional
 	// +kubebuilder:validation:MaxItems=32
 	Files []File `json:"files,omitempty"`
 
+	// Registries configures registry mirrors, registry TLS and pull
+	// credentials for the distribution's containerd. The bootstrap controller
+	// resolves every AuthSecretRef and renders the matching files for the
+	// distribution: /etc/rancher/k3s/registries.yaml for k3s, and a
+	// /etc/k0s/containerd.d drop-in plus hosts.toml files under
+	// /etc/k0s/certs.d for k0s. Applies to control-plane and worker nodes.
+	// +optional
+	Registries *Registries `json:"registries,omitempty"`
+
+	// Proxy configures an egress HTTP/HTTPS proxy for the node. It is
+	// rendered into an environment file loaded by the k0s/k3s service (and
+	// so its containerd), by the provider's post-bootstrap and etcd units,
+	// and by login shells. NO_PROXY always includes localhost, the pod and
+	// service CIDRs, the control-plane endpoint and the management API host.
+	// +optional
+	Proxy *Proxy `json:"proxy,omitempty"`
+
+	// AirgapImages lists image bundles (k3s airgap image tarballs, k0s airgap
+	// bundles) the node places in the distribution's image import directory
+	// before the k0s/k3s service starts, so the node comes up without
+	// registry access. A bundle that cannot be fetched or fails its digest
+	// check keeps the distribution from starting and is recorded on the node
+	// with the reason AirgapImagesMissing. At most 16 bundles.
+	// +kubebuilder:validation:MaxItems=16
+	// +optional
+	AirgapImages []AirgapImageBundle `json:"airgapImages,omitempty"`
+
+	// Network configures static node networking: interfaces, bonds, VLANs,
+	// addresses, gateways, static routes and per-link DNS. It is rendered
+	// into systemd-networkd .netdev/.network files, and the k0s/k3s service
+	// does not start until networkd has applied them, so the distribution
+	// never binds a DHCP address first. For sites without DHCP.
+	// +optional
+	Network *Network `json:"network,omitempty"`
+
+	// NodeLabels are set on the Node by its kubelet when it first registers,
+	// so pool selectors match from the start. Keys and values follow the
+	// Kubernetes label syntax. Keys in the kubernetes.io and k8s.io namespaces
+	// are limited to the kubelet.kubernetes.io and node.kubernetes.io prefixes,
+	// which the kubelet may set on its own Node. Rendered as k0s --labels and
+	// k3s node-label.
+	// +kubebuilder:validation:MaxProperties=64
+	// +optional
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+
+	// NodeTaints are set on the Node by its kubelet when it first registers.
+	// Rendered as k0s --taints and k3s node-taint.
+	// +kubebuilder:validation:MaxItems=32
+	// +optional
+	NodeTaints []NodeTaint `json:"nodeTaints,omitempty"`
+
+	// KubeletExtraArgs are extra kubelet flags, keyed by flag name without the
+	// leading dashes (e.g. "max-pods": "200"). provider-id, node-labels and
+	// register-with-taints are reserved: the first is managed by the provider,
+	// the others by NodeLabels and NodeTaints. Values must not contain
+	// whitespace, quotes, '$', '%' or backslashes, because the k0s flags are
+	// parsed as part of the service command line.
+	// +kubebuilder:validation:MaxProperties=64
+	// +optional
+	KubeletExtraArgs map[string]string `json:"kubeletExtraArgs,omitempty"`
+
+	// K0sConfig is a k0s ClusterConfig spec fragment (the content of
+	// ClusterConfig.spec, e.g. network.provider, network.kubeProxy,
+	// extensions, telemetry, storage) deep-merged into /etc/k0s/k0s.yaml on
+	// control-plane nodes. The provider owns network.podCIDR and
+	// network.serviceCIDR (set them with PodCIDR and ServiceCIDR) and adds its
+	// own api.sans entries to any listed here. HA control planes require the
+	// etcd storage type. k0s only.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	// +optional
+	K0sConfig *apiextensionsv1.JSON `json:"k0sConfig,omitempty"`
+
+	// K3sConfig holds k3s configuration file options for the server and agent,
+	// rendered into /etc/rancher/k3s/config.yaml.d on top of the provider's own
+	// drop-ins (e.g. disable, flannel-backend, cluster-domain, etcd snapshot
+	// settings). Keys the provider manages (tokens, server URL, tls-san, node
+	// IP, cluster-init, kubelet-arg, node-label, node-taint, private-registry)
+	// are rejected. k3s only.
+	// +optional
+	K3sConfig *K3sConfig `json:"k3sConfig,omitempty"`
+
 	// PreCommands are commands to run before k0s/k3s installation
 	// +optional
 	PreCommands []string `json:"preCommands,omitempty"`
@@ -160,7 +313,9 @@ type KairosConfigSpec struct {
 	Pause bool `json:"pause,omitempty"`
 
 	// SingleNode indicates this is a single-node control plane cluster.
-	// When true, k0s will be configured with --single flag.
+	// With the single role, k0s is configured with the --single flag; with
+	// the init or join role, the k0s controller also runs workloads
+	// (--enable-worker --no-taints).
 	//
 	// Deprecated: SingleNode is derived by the KairosControlPlane controller
 	// from spec.replicas (true when replicas==1) and will be removed in a
@@ -205,6 +360,9 @@ type KairosConfigSpec struct {
 	// userPassword, userPasswordSecretRef, sshPublicKey, or gitHubUser; the
 	// validating webhook enforces this. If both UserPassword and
 	// UserPasswordSecretRef are set, UserPasswordSecretRef takes precedence.
+	//
+	// The bootstrap controller hashes the password with SHA-512 crypt before
+	// rendering, so the bootstrap data holds the hash only.
 	// +optional
 	UserPassword string `json:"userPassword,omitempty"`
 
@@ -212,6 +370,10 @@ type KairosConfigSpec struct {
 	// password. The Secret must live in the same namespace as the KairosConfig
 	// unless Namespace is set explicitly. The Secret's data key defaults to
 	// "password". Recommended over inline UserPassword.
+	//
+	// The value may be plaintext, which is hashed with SHA-512 crypt before
+	// rendering, or a crypt(3) SHA-512 ($6$), SHA-256 ($5$) or yescrypt ($y$)
+	// hash, which is used as is.
 	// +optional
 	UserPasswordSecretRef *UserPasswordSecretReference `json:"userPasswordSecretRef,omitempty"`
 
@@ -264,8 +426,8 @@ type KairosConfigSpec struct {
 	// token is secret material and must live in a Secret, never in this spec.
 	// The Secret must contain a key specified by Key (defaults to "token").
 	//
-	// k3s HA reuses K3sTokenSecretRef for the shared server token; this field is
-	// k0s-specific.
+	// On rke2 it references the controller-generated shared server token
+	// instead. k3s HA reuses K3sTokenSecretRef for the shared server token.
 	// +optional
 	ControlPlaneJoinTokenSecretRef *WorkerTokenSecretReference `json:"controlPlaneJoinTokenSecretRef,omitempty"`
 
@@ -282,6 +444,36 @@ type KairosConfigSpec struct {
 	// +optional
 	ControlPlaneVIP *ControlPlaneVIP `json:"controlPlaneVIP,omitempty"`
 
+	// EtcdBackup is the scheduled etcd snapshot configuration the
+	// KairosControlPlane controller copies down from
+	// KairosControlPlane.Spec.EtcdBackup. The bootstrap controller resolves the
+	// referenced credentials and renders the snapshot timer on HA (init/join)
+	// control-plane nodes only.
+	//
+	// Set by the KairosControlPlane controller; not user-set.
+	// +optional
+	EtcdBackup *ControlPlaneEtcdBackup `json:"etcdBackup,omitempty"`
+
+	// EtcdRestore makes an HA init node restore an etcd snapshot before its
+	// distribution first starts. The KairosControlPlane controller sets it
+	// only on the init machine it creates while restoring
+	// KairosControlPlane.Spec.EtcdRestore; the snapshot is downloaded with
+	// the EtcdBackup S3 settings, so EtcdBackup must be set as well.
+	//
+	// Set by the KairosControlPlane controller; not user-set.
+	// +optional
+	EtcdRestore *ControlPlaneEtcdRestore `json:"etcdRestore,omitempty"`
+
+	// ControlPlaneCNI is the network plugin the KairosControlPlane controller
+	// copies down from KairosControlPlane.Spec.CNI. The renderer replaces the
+	// distribution's default plugin on control-plane nodes: the k0s
+	// network.provider or the k3s flannel settings, plus a chart resource
+	// delivered with Manifests. Nil keeps the distribution default.
+	//
+	// Set by the KairosControlPlane controller; not user-set.
+	// +optional
+	ControlPlaneCNI *ControlPlaneCNI `json:"controlPlaneCNI,omitempty"`
+
 	// Manifests are Kubernetes manifests to be placed in the distribution manifests directory.
 	// These will be automatically applied by the distribution at cluster startup.
 	// k0s: /var/lib/k0s/manifests/{Name}/{File}
@@ -307,13 +499,15 @@ type KairosConfigSpec struct {
 	// +optional
 	DNSServers []string `json:"dnsServers,omitempty"`
 
-	// PodCIDR configures the pod network CIDR for k0s
-	// Defaults to k0s defaults if not specified.
+	// PodCIDR configures the pod network CIDR: network.podCIDR on k0s and
+	// cluster-cidr on k3s and rke2 control-plane nodes. It also sizes the CNI
+	// IP pool. Defaults to the distribution default if not specified.
 	// +optional
 	PodCIDR string `json:"podCIDR,omitempty"`
 
-	// ServiceCIDR configures the service network CIDR for k0s
-	// Defaults to k0s defaults if not specified.
+	// ServiceCIDR configures the service network CIDR: network.serviceCIDR on
+	// k0s and service-cidr on k3s and rke2 control-plane nodes. Defaults to the
+	// distribution default if not specified.
 	// +optional
 	ServiceCIDR string `json:"serviceCIDR,omitempty"`
 
@@ -328,6 +522,66 @@ type KairosConfigSpec struct {
 	Install *InstallConfig `json:"install,omitempty"`
 }
 
+// DistributionReleaseMismatchPolicy selects what a node does when the k0s/k3s
+// release it would run does not match spec.kubernetesVersion.
+// +kubebuilder:validation:Enum=Fail;Warn
+type DistributionReleaseMismatchPolicy string
+
+const (
+	// DistributionReleaseMismatchFail keeps the distribution service from
+	// starting. The node never registers, so a wrong release never joins the
+	// cluster.
+	DistributionReleaseMismatchFail DistributionReleaseMismatchPolicy = "Fail"
+
+	// DistributionReleaseMismatchWarn starts the distribution anyway. The
+	// mismatch is logged on the node and surfaced on the KairosConfig through
+	// the KubernetesVersionMatched condition once the Node registers.
+	DistributionReleaseMismatchWarn DistributionReleaseMismatchPolicy = "Warn"
+)
+
+// DistributionRelease is the source of the k0s/k3s release binary matching
+// spec.kubernetesVersion. At most one of Image, Path, or URL may be set; with
+// none set the node only verifies the release shipped in the Kairos image.
+//
+// A release installed from a source is staged under /usr/local/lib/kairos-capi
+// (persistent) and bind-mounted over the image's binary before the
+// distribution service starts, so the immutable rootfs is never modified.
+type DistributionRelease struct {
+	// Image is an OCI image reference (e.g. a Kairos bundle) carrying the
+	// distribution binary at /<distribution>, /usr/local/bin/<distribution>
+	// or /usr/bin/<distribution>. Unpacked on the node with `luet util unpack`.
+	// +optional
+	// +kubebuilder:validation:MaxLength=512
+	Image string `json:"image,omitempty"`
+
+	// Path is an absolute path on the node to a pre-staged distribution binary
+	// (e.g. baked into a derived image or written by spec.files).
+	// +optional
+	// +kubebuilder:validation:Pattern=`^/`
+	Path string `json:"path,omitempty"`
+
+	// URL is the base URL of a release mirror laid out like the upstream
+	// GitHub releases: the node downloads <url>/<kubernetesVersion>/<asset>,
+	// where asset is k0s-<version>-<arch> for k0s, k3s / k3s-<arch> for k3s
+	// and rke2.linux-<arch> for rke2.
+	// Requires kubernetesVersion to carry the distribution suffix.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^https?://`
+	URL string `json:"url,omitempty"`
+
+	// SHA256 is the expected hex-encoded SHA-256 digest of the release binary.
+	// When set, a fetched binary with a different digest is discarded.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[a-f0-9]{64}$`
+	SHA256 string `json:"sha256,omitempty"`
+
+	// OnMismatch selects what the node does when the release it would run
+	// still does not match kubernetesVersion. Defaults to Fail.
+	// +kubebuilder:default=Fail
+	// +optional
+	OnMismatch DistributionReleaseMismatchPolicy `json:"onMismatch,omitempty"`
+}
+
 // InstallConfig specifies the Kairos installation configuration
 type InstallConfig struct {
 	// Auto enables automatic installation to disk
@@ -422,10 +676,424 @@ type ControlPlaneVIP struct {
 	Mode string `json:"mode,omitempty"`
 }
 
+// ControlPlaneCNI is the flat, render-ready view of
+// KairosControlPlane.Spec.CNI propagated onto a control-plane KairosConfig.
+// The distribution default is represented by a nil ControlPlaneCNI. This field
+// is set by the controller, not by end users.
+type ControlPlaneCNI struct {
+	// Provider is the network plugin: "calico", "cilium" or "none" (bring
+	// your own).
+	// +kubebuilder:validation:Enum=calico;cilium;none
+	// +kubebuilder:validation:Required
+	Provider string `json:"provider"`
+}
+
+// ControlPlaneEtcdBackup is the flat, render-ready view of
+// KairosControlPlane.Spec.EtcdBackup propagated onto a control-plane
+// KairosConfig. The bootstrap controller converts it into
+// internal/bootstrap.EtcdBackupConfig; every field is re-validated at render
+// time. This field is set by the controller, not by end users.
+type ControlPlaneEtcdBackup struct {
+	// Schedule is a systemd OnCalendar expression.
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9*:/,.~ -]+$`
+	Schedule string `json:"schedule"`
+
+	// Retention is the number of snapshots each node keeps locally and in the
+	// bucket.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	Retention int32 `json:"retention"`
+
+	// Endpoint is the base http(s) URL of the S3 API.
+	Endpoint string `json:"endpoint"`
+
+	// Bucket is the S3 bucket name.
+	Bucket string `json:"bucket"`
+
+	// Prefix is the optional key prefix inside the bucket.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// Region is the signing region.
+	Region string `json:"region"`
+
+	// CredentialsSecretRef references the Secret holding the keys
+	// "accessKeyID" and "secretAccessKey".
+	CredentialsSecretRef EtcdBackupCredentialsSecretReference `json:"credentialsSecretRef"`
+}
+
+const (
+	// EtcdBackupAccessKeyIDKey is the credentials Secret key holding the S3
+	// access key ID.
+	EtcdBackupAccessKeyIDKey = "accessKeyID"
+
+	// EtcdBackupSecretAccessKeyKey is the credentials Secret key holding the
+	// S3 secret access key.
+	EtcdBackupSecretAccessKeyKey = "secretAccessKey"
+)
+
+// ControlPlaneEtcdRestore names the snapshot an HA init node restores. This
+// field is set by the controller, not by end users.
+type ControlPlaneEtcdRestore struct {
+	// Location is the object URL of the snapshot inside the EtcdBackup
+	// bucket.
+	// +kubebuilder:validation:MaxLength=1024
+	Location string `json:"location"`
+}
+
+// EtcdBackupCredentialsSecretReference is a reference to the Secret holding
+// S3 credentials for etcd backups.
+type EtcdBackupCredentialsSecretReference struct {
+	// Name is the name of the Secret.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the Secret. If not specified, defaults to
+	// the same namespace as the KairosConfig.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// NetworkBondMode is the bonding mode of a NetworkBond.
+// +kubebuilder:validation:Enum=balance-rr;active-backup;balance-xor;broadcast;"802.3ad";balance-tlb;balance-alb
+type NetworkBondMode string
+
+// Network is the static network configuration of a node. Every link name is
+// unique across interfaces, bonds and VLANs.
+type Network struct {
+	// Interfaces are the physical links to configure, either directly or as
+	// bond members and VLAN parents.
+	// +kubebuilder:validation:MaxItems=16
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Interfaces []NetworkInterface `json:"interfaces,omitempty"`
+
+	// Bonds aggregate interfaces into one link.
+	// +kubebuilder:validation:MaxItems=8
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Bonds []NetworkBond `json:"bonds,omitempty"`
+
+	// VLANs are tagged links on top of an interface or a bond.
+	// +kubebuilder:validation:MaxItems=32
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	VLANs []NetworkVLAN `json:"vlans,omitempty"`
+}
+
+// NetworkAddressing is the layer-3 configuration shared by interfaces, bonds
+// and VLANs. A link with none of it set only carries bonds or VLANs.
+type NetworkAddressing struct {
+	// DHCP4 enables DHCPv4 on the link.
+	// +optional
+	DHCP4 bool `json:"dhcp4,omitempty"`
+
+	// DHCP6 enables DHCPv6 on the link.
+	// +optional
+	DHCP6 bool `json:"dhcp6,omitempty"`
+
+	// Addresses are static addresses in CIDR notation, e.g. "192.168.1.10/24".
+	// +kubebuilder:validation:MaxItems=16
+	// +optional
+	Addresses []string `json:"addresses,omitempty"`
+
+	// Gateway4 is the IPv4 default gateway.
+	// +optional
+	Gateway4 string `json:"gateway4,omitempty"`
+
+	// Gateway6 is the IPv6 default gateway.
+	// +optional
+	Gateway6 string `json:"gateway6,omitempty"`
+
+	// Routes are static routes through this link.
+	// +kubebuilder:validation:MaxItems=32
+	// +optional
+	Routes []NetworkRoute `json:"routes,omitempty"`
+
+	// Nameservers are DNS servers for this link, applied through
+	// systemd-resolved. Use spec.dnsServers for /etc/resolv.conf.
+	// +kubebuilder:validation:MaxItems=8
+	// +optional
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// SearchDomains are DNS search domains for this link.
+	// +kubebuilder:validation:MaxItems=8
+	// +optional
+	SearchDomains []string `json:"searchDomains,omitempty"`
+
+	// MTU sets the link MTU in bytes.
+	// +kubebuilder:validation:Minimum=68
+	// +kubebuilder:validation:Maximum=9216
+	// +optional
+	MTU *int32 `json:"mtu,omitempty"`
+}
+
+// NetworkInterface configures a physical link.
+type NetworkInterface struct {
+	// Name is the kernel interface name, e.g. "ens192". It is also how bonds
+	// and VLANs refer to this interface.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z][a-zA-Z0-9._-]{0,14}$`
+	Name string `json:"name"`
+
+	// MACAddress, when set, matches the link by MAC address instead of by
+	// name, for hosts whose interface names are not predictable.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`
+	MACAddress string `json:"macAddress,omitempty"`
+
+	NetworkAddressing `json:",inline"`
+}
+
+// NetworkBond configures a bond over interfaces declared in
+// Network.Interfaces. Members must not carry addressing of their own.
+type NetworkBond struct {
+	// Name is the bond link name, e.g. "bond0".
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z][a-zA-Z0-9._-]{0,14}$`
+	Name string `json:"name"`
+
+	// Interfaces are the names of the member interfaces.
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=8
+	Interfaces []string `json:"interfaces"`
+
+	// Mode is the bonding mode. Defaults to active-backup.
+	// +kubebuilder:default=active-backup
+	// +optional
+	Mode NetworkBondMode `json:"mode,omitempty"`
+
+	NetworkAddressing `json:",inline"`
+}
+
+// NetworkVLAN configures a tagged link.
+type NetworkVLAN struct {
+	// Name is the VLAN link name, e.g. "vlan100".
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z][a-zA-Z0-9._-]{0,14}$`
+	Name string `json:"name"`
+
+	// ID is the VLAN tag.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=4094
+	ID int32 `json:"id"`
+
+	// Link is the name of the parent interface or bond.
+	// +kubebuilder:validation:Required
+	Link string `json:"link"`
+
+	NetworkAddressing `json:",inline"`
+}
+
+// NetworkRoute is a static route.
+type NetworkRoute struct {
+	// To is the destination in CIDR notation, or "default".
+	// +kubebuilder:validation:Required
+	To string `json:"to"`
+
+	// Via is the next-hop address. When empty the destination is on-link.
+	// +optional
+	Via string `json:"via,omitempty"`
+
+	// Metric is the route priority; lower is preferred.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Metric *int32 `json:"metric,omitempty"`
+}
+
+// NodeTaintEffect is the effect of a NodeTaint.
+// +kubebuilder:validation:Enum=NoSchedule;PreferNoSchedule;NoExecute
+type NodeTaintEffect string
+
+// NodeTaint is a taint the kubelet registers the Node with.
+type NodeTaint struct {
+	// Key is the taint key, a qualified name such as
+	// "dedicated" or "example.com/pool".
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MaxLength=253
+	Key string `json:"key"`
+
+	// Value is the taint value, in label-value syntax.
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	Value string `json:"value,omitempty"`
+
+	// Effect is the taint effect.
+	// +kubebuilder:validation:Required
+	Effect NodeTaintEffect `json:"effect"`
+}
+
+// K3sConfig holds k3s configuration file options, keyed by the k3s flag name
+// without leading dashes (e.g. "flannel-backend": "wireguard-native",
+// "disable": ["traefik", "servicelb"]). A key may end in "+" to append to a
+// list set by an earlier file. Values are strings, numbers, booleans or lists
+// of those.
+type K3sConfig struct {
+	// Server options, rendered on control-plane nodes only.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	// +optional
+	Server *apiextensionsv1.JSON `json:"server,omitempty"`
+
+	// Agent options, rendered on every node: k3s servers run an agent too. A
+	// key must not be set in both Server and Agent.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	// +optional
+	Agent *apiextensionsv1.JSON `json:"agent,omitempty"`
+}
+
+// AirgapImageBundle is one image bundle preloaded into the distribution's
+// containerd before the distribution starts. Exactly one of Image, Path, or URL
+// must be set. k0s imports uncompressed .tar bundles; k3s also imports
+// .tar.gz/.tgz, .tar.zst/.tzst, .tar.bz2/.tbz and .tar.lz4.
+type AirgapImageBundle struct {
+	// Image is an OCI image reference whose filesystem carries one or more
+	// bundle files. Unpacked on the node with `luet util unpack`, like
+	// DistributionRelease.Image; every bundle file found is imported.
+	// +optional
+	// +kubebuilder:validation:MaxLength=512
+	Image string `json:"image,omitempty"`
+
+	// Path is an absolute path on the node to a bundle file, e.g. one baked
+	// into a derived Kairos image. It is bind-mounted into the import
+	// directory rather than copied.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^/`
+	// +kubebuilder:validation:MaxLength=4096
+	Path string `json:"path,omitempty"`
+
+	// URL is an http(s) URL of a bundle file. It is downloaded once and kept
+	// in the import directory across reboots.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +kubebuilder:validation:MaxLength=2048
+	URL string `json:"url,omitempty"`
+
+	// SHA256 is the expected hex-encoded SHA-256 digest of the bundle file.
+	// Only valid with Path or URL.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[a-f0-9]{64}$`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Proxy is the egress proxy configuration for a node.
+type Proxy struct {
+	// HTTPProxy is the proxy URL for plain-HTTP requests (HTTP_PROXY), e.g.
+	// "http://proxy.example.com:3128". Credentials must not be embedded.
+	// +kubebuilder:validation:MaxLength=2048
+	// +optional
+	HTTPProxy string `json:"httpProxy,omitempty"`
+
+	// HTTPSProxy is the proxy URL for HTTPS requests (HTTPS_PROXY).
+	// Credentials must not be embedded.
+	// +kubebuilder:validation:MaxLength=2048
+	// +optional
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+
+	// NoProxy lists additional hosts, domain suffixes, IPs or CIDRs that
+	// bypass the proxy. The cluster's own networks and endpoints are always
+	// added; see KairosConfigSpec.Proxy.
+	// +kubebuilder:validation:MaxItems=64
+	// +optional
+	NoProxy []string `json:"noProxy,omitempty"`
+}
+
+// Registries configures containerd registry mirrors and per-registry TLS and
+// authentication.
+type Registries struct {
+	// Mirrors redirects pulls from an upstream registry to mirror endpoints.
+	// The endpoints are tried in order before the upstream registry itself.
+	// +listType=map
+	// +listMapKey=registry
+	// +kubebuilder:validation:MaxItems=32
+	// +optional
+	Mirrors []RegistryMirror `json:"mirrors,omitempty"`
+
+	// Configs sets TLS and authentication for a registry host. The host may
+	// be an upstream registry or a mirror endpoint host.
+	// +listType=map
+	// +listMapKey=host
+	// +kubebuilder:validation:MaxItems=32
+	// +optional
+	Configs []RegistryConfig `json:"configs,omitempty"`
+}
+
+// RegistryMirror maps an upstream registry to its mirror endpoints.
+type RegistryMirror struct {
+	// Registry is the upstream registry host, with an optional port (e.g.
+	// "docker.io" or "registry.example.com:5000"). "*" applies the mirror to
+	// every registry.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^(\*|[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?(:[0-9]{1,5})?)$`
+	Registry string `json:"registry"`
+
+	// Endpoints are the http(s) URLs of the mirrors, in order of preference.
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=8
+	Endpoints []string `json:"endpoints"`
+}
+
+// RegistryConfig holds the TLS and authentication settings for one registry
+// host.
+type RegistryConfig struct {
+	// Host is the registry host, with an optional port, these settings apply
+	// to (e.g. "registry.example.com:5000").
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?(:[0-9]{1,5})?$`
+	Host string `json:"host"`
+
+	// CA is a PEM bundle of the certificates the registry's serving
+	// certificate is verified against, in addition to the system roots.
+	// +kubebuilder:validation:MaxLength=65536
+	// +optional
+	CA string `json:"ca,omitempty"`
+
+	// InsecureSkipVerify disables TLS certificate verification for this host.
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+
+	// AuthSecretRef references a Secret holding the registry credentials in
+	// the keys "username" and "password". The Secret must live in the same
+	// namespace as the KairosConfig unless Namespace is set explicitly.
+	// +optional
+	AuthSecretRef *RegistryAuthSecretReference `json:"authSecretRef,omitempty"`
+}
+
+const (
+	// RegistryAuthUsernameKey is the registry auth Secret key holding the
+	// username.
+	RegistryAuthUsernameKey = "username"
+
+	// RegistryAuthPasswordKey is the registry auth Secret key holding the
+	// password or token.
+	RegistryAuthPasswordKey = "password"
+)
+
+// RegistryAuthSecretReference is a reference to the Secret holding registry
+// credentials.
+type RegistryAuthSecretReference struct {
+	// Name is the name of the Secret.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the Secret. If not specified, defaults to
+	// the same namespace as the KairosConfig.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
 // Manifest represents a Kubernetes manifest file to be deployed by the
 // workload distribution. The manifest is placed at:
 //   - k0s: /var/lib/k0s/manifests/{Name}/{File}
 //   - k3s: /var/lib/rancher/k3s/server/manifests/{Name}/{File}
+//   - rke2: /var/lib/rancher/rke2/server/manifests/{Name}/{File}
 //
 // and is auto-applied by the distribution at server start. Manifests are
 // applied on control-plane nodes only.
@@ -434,6 +1102,7 @@ type Manifest struct {
 	// This creates a directory structure:
 	//   - k0s: /var/lib/k0s/manifests/{Name}/{File}
 	//   - k3s: /var/lib/rancher/k3s/server/manifests/{Name}/{File}
+	//   - rke2: /var/lib/rancher/rke2/server/manifests/{Name}/{File}
 	// +kubebuilder:validation:Required
 	Name string `json:"name"`
 
@@ -441,12 +1110,21 @@ type Manifest struct {
 	// manifest loader auto-applies it from:
 	//   - k0s: /var/lib/k0s/manifests/{Name}/{File}
 	//   - k3s: /var/lib/rancher/k3s/server/manifests/{Name}/{File}
+	//   - rke2: /var/lib/rancher/rke2/server/manifests/{Name}/{File}
 	// +kubebuilder:validation:Required
 	File string `json:"file"`
 
-	// Content is the manifest YAML content
-	// +kubebuilder:validation:Required
-	Content string `json:"content"`
+	// Content is the manifest YAML content. Exactly one of Content and
+	// ContentFrom must be set.
+	// +optional
+	Content string `json:"content,omitempty"`
+
+	// ContentFrom reads the manifest from a Secret or ConfigMap key in the
+	// KairosConfig's namespace. The bootstrap controller resolves it when it
+	// renders the bootstrap data, and renders again when the referenced data
+	// changes.
+	// +optional
+	ContentFrom *ContentSource `json:"contentFrom,omitempty"`
 }
 
 // File represents a file to be written via the cloud-config write_files: list.
@@ -461,10 +1139,22 @@ type File struct {
 	Path string `json:"path"`
 
 	// Content is the file content. Multi-line strings are accepted and are
-	// emitted as a YAML block scalar. Maximum 32 KiB (32768 bytes).
-	// +kubebuilder:validation:Required
+	// emitted as a YAML block scalar. Maximum 32 KiB (32768 bytes). Exactly
+	// one of Content and ContentFrom must be set.
+	// +optional
 	// +kubebuilder:validation:MaxLength=32768
-	Content string `json:"content"`
+	Content string `json:"content,omitempty"`
+
+	// ContentFrom reads the file content from a Secret or ConfigMap key in the
+	// KairosConfig's namespace, for content that must not be stored in the
+	// KairosConfig, such as TLS keys, or that exceeds the inline limit. The
+	// bootstrap controller resolves it when it renders the bootstrap data, and
+	// renders again when the referenced data changes.
+	//
+	// The renderer serializes File with yaml.v3, so the field is excluded
+	// there; the controller has already replaced it with Content.
+	// +optional
+	ContentFrom *ContentSource `json:"contentFrom,omitempty" yaml:"-"`
 
 	// Permissions is the file mode in octal notation. Accepts 3-digit or
 	// 4-digit forms; the leading digit encodes setuid (4), setgid (2), and
@@ -483,6 +1173,33 @@ type File struct {
 	Owner string `json:"owner,omitempty"`
 }
 
+// ContentSource references the content of a File or Manifest. Exactly one of
+// Secret and ConfigMap must be set. The object is always read from the
+// KairosConfig's namespace.
+type ContentSource struct {
+	// Secret selects a key of a Secret.
+	// +optional
+	Secret *ContentSourceKeySelector `json:"secret,omitempty"`
+
+	// ConfigMap selects a key of a ConfigMap. Both data and binaryData keys
+	// are read.
+	// +optional
+	ConfigMap *ContentSourceKeySelector `json:"configMap,omitempty"`
+}
+
+// ContentSourceKeySelector selects a key of a Secret or ConfigMap.
+type ContentSourceKeySelector struct {
+	// Name is the name of the Secret or ConfigMap.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Key is the data key whose value becomes the content.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+}
+
 // KairosConfigStatus defines the observed state of KairosConfig
 // Contract: BootstrapConfig v1beta2 MUST expose a dataSecretName and ready status
 type KairosConfigStatus struct {
@@ -17,12 +17,19 @@ permissions and limitations under the License.
 package v1beta2
 
 import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/url"
 	"regexp"
 	"strings"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -107,37 +114,40 @@ func (r *KairosConfig) validate() error {
 	}
 
 	// Validate distribution
-	if r.Spec.Distribution != "" && r.Spec.Distribution != "k0s" && r.Spec.Distribution != "k3s" {
+	if r.Spec.Distribution != "" && r.Spec.Distribution != "k0s" && r.Spec.Distribution != "k3s" && r.Spec.Distribution != "rke2" {
 		allErrs = append(allErrs, field.Invalid(
 			field.NewPath("spec", "distribution"),
 			r.Spec.Distribution,
-			"spec.distribution must be one of [k0s, k3s]",
+			"spec.distribution must be one of [k0s, k3s, rke2]",
 		))
 	}
 
-	// Validate worker token requirement
-	if r.Spec.Role == "worker" {
-		switch r.Spec.Distribution {
-		case "k3s":
-			hasK3sToken := r.Spec.K3sToken != ""
-			hasK3sTokenRef := r.Spec.K3sTokenSecretRef != nil && r.Spec.K3sTokenSecretRef.Name != ""
-			hasWorkerToken := r.Spec.WorkerToken != ""
-			hasWorkerTokenRef := r.Spec.WorkerTokenSecretRef != nil && r.Spec.WorkerTokenSecretRef.Name != ""
-			if !hasK3sToken && !hasK3sTokenRef && !hasWorkerToken && !hasWorkerTokenRef {
-				allErrs = append(allErrs, field.Required(
-					field.NewPath("spec", "k3sToken"),
-					"k3s worker requires spec.k3sToken, spec.k3sTokenSecretRef, spec.workerToken, or spec.workerTokenSecretRef to be set",
-				))
-			}
-		default:
-			hasToken := r.Spec.WorkerToken != ""
-			hasTokenRef := r.Spec.WorkerTokenSecretRef != nil && r.Spec.WorkerTokenSecretRef.Name != ""
-			if !hasToken && !hasTokenRef {
-				allErrs = append(allErrs, field.Required(
-					field.NewPath("spec", "workerToken"),
-					"worker KairosConfig requires either spec.workerToken or spec.workerTokenSecretRef to be set",
-				))
-			}
+	// Validate kubernetesVersion. It is interpolated into the node's
+	// distribution version gate and, for a URL release source, into the
+	// download path, so the shape is enforced here as well as by the CRD
+	// pattern (older apiservers may skip pattern validation).
+	if !webhookKubernetesVersionRe.MatchString(r.Spec.KubernetesVersion) {
+		allErrs = append(allErrs, field.Invalid(
+			field.NewPath("spec", "kubernetesVersion"),
+			r.Spec.KubernetesVersion,
+			"kubernetesVersion must be a release version such as \"v1.34.1+k0s.1\", \"v1.33.5+k3s1\" or \"v1.33.5+rke2r1\"",
+		))
+	}
+	if rel := r.Spec.DistributionRelease; rel != nil {
+		allErrs = append(allErrs, validateDistributionRelease(rel, r.Spec.KubernetesVersion, field.NewPath("spec", "distributionRelease"))...)
+	}
+
+	// Validate worker token requirement. k0s and k3s workers without a token
+	// of their own join with the <cluster>-worker-token Secret their
+	// KairosControlPlane mints; rke2 workers must name one.
+	if r.Spec.Role == "worker" && r.Spec.Distribution == "rke2" {
+		hasToken := r.Spec.WorkerToken != ""
+		hasTokenRef := r.Spec.WorkerTokenSecretRef != nil && r.Spec.WorkerTokenSecretRef.Name != ""
+		if !hasToken && !hasTokenRef {
+			allErrs = append(allErrs, field.Required(
+				field.NewPath("spec", "workerToken"),
+				"rke2 worker KairosConfig requires either spec.workerToken or spec.workerTokenSecretRef to be set",
+			))
 		}
 	}
 
@@ -205,6 +215,41 @@ func (r *KairosConfig) validate() error {
 				"owner must be in user or user:group format using POSIX username characters (e.g. \"root\" or \"root:root\")",
 			))
 		}
+		allErrs = append(allErrs, validateContent(f.Content, f.ContentFrom, fPath)...)
+	}
+
+	for i, m := range r.Spec.Manifests {
+		allErrs = append(allErrs, validateContent(m.Content, m.ContentFrom, field.NewPath("spec", "manifests").Index(i))...)
+	}
+
+	if r.Spec.Registries != nil {
+		allErrs = append(allErrs, validateRegistries(r.Spec.Registries, field.NewPath("spec", "registries"))...)
+	}
+
+	if r.Spec.Proxy != nil {
+		allErrs = append(allErrs, validateProxy(r.Spec.Proxy, field.NewPath("spec", "proxy"))...)
+	}
+
+	if len(r.Spec.AirgapImages) > 0 {
+		allErrs = append(allErrs, validateAirgapImages(r.Spec.AirgapImages, r.Spec.Distribution, field.NewPath("spec", "airgapImages"))...)
+	}
+
+	if r.Spec.Network != nil {
+		allErrs = append(allErrs, validateNetwork(r.Spec.Network, field.NewPath("spec", "network"))...)
+	}
+
+	allErrs = append(allErrs, validateNodeRegistration(&r.Spec, field.NewPath("spec"))...)
+
+	if r.Spec.K0sConfig != nil {
+		allErrs = append(allErrs, validateK0sConfig(&r.Spec, field.NewPath("spec", "k0sConfig"))...)
+	}
+
+	if r.Spec.K3sConfig != nil {
+		allErrs = append(allErrs, validateK3sConfig(&r.Spec, field.NewPath("spec", "k3sConfig"))...)
+	}
+
+	if r.Spec.ControlPlaneCNI != nil {
+		allErrs = append(allErrs, validateControlPlaneCNI(&r.Spec, field.NewPath("spec", "controlPlaneCNI"))...)
 	}
 
 	if len(allErrs) > 0 {
@@ -218,6 +263,772 @@ func (r *KairosConfig) validate() error {
 	return nil
 }
 
+// validateDistributionRelease checks the release source of spec.distributionRelease.
+// At most one source may be set, and each source must have a shape the node's
+// version gate can consume without further interpretation.
+func validateDistributionRelease(rel *DistributionRelease, kubernetesVersion string, base *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	sources := 0
+	for _, s := range []string{rel.Image, rel.Path, rel.URL} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		allErrs = append(allErrs, field.Invalid(base, "", "at most one of image, path, or url may be set"))
+	}
+
+	if rel.Image != "" && strings.ContainsAny(rel.Image, " \t\r\n'\"\\$`;|&") {
+		allErrs = append(allErrs, field.Invalid(base.Child("image"), rel.Image,
+			"image must be an OCI image reference without whitespace or shell metacharacters"))
+	}
+	if rel.Path != "" {
+		if !strings.HasPrefix(rel.Path, "/") {
+			allErrs = append(allErrs, field.Invalid(base.Child("path"), rel.Path, "path must be absolute (must begin with '/')"))
+		} else {
+			for _, seg := range strings.Split(rel.Path, "/") {
+				if seg == ".." {
+					allErrs = append(allErrs, field.Invalid(base.Child("path"), rel.Path, "path must not contain '..' path traversal segments"))
+					break
+				}
+			}
+		}
+	}
+	if rel.URL != "" {
+		u, err := url.Parse(rel.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+			allErrs = append(allErrs, field.Invalid(base.Child("url"), rel.URL,
+				"url must be an http(s) URL with a host and no embedded credentials"))
+		}
+		// The mirror layout is keyed by the full release tag; a bare
+		// Kubernetes version cannot be mapped to a download path.
+		if !strings.Contains(kubernetesVersion, "+") {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "kubernetesVersion"), kubernetesVersion,
+				"kubernetesVersion must carry the distribution suffix (e.g. \"+k0s.1\", \"+k3s1\" or \"+rke2r1\") when distributionRelease.url is set"))
+		}
+	}
+	if rel.SHA256 != "" && !webhookSHA256Re.MatchString(rel.SHA256) {
+		allErrs = append(allErrs, field.Invalid(base.Child("sha256"), rel.SHA256, "sha256 must be 64 lowercase hex characters"))
+	}
+	switch rel.OnMismatch {
+	case "", DistributionReleaseMismatchFail, DistributionReleaseMismatchWarn:
+	default:
+		allErrs = append(allErrs, field.NotSupported(base.Child("onMismatch"), rel.OnMismatch,
+			[]string{string(DistributionReleaseMismatchFail), string(DistributionReleaseMismatchWarn)}))
+	}
+	return allErrs
+}
+
+// validateRegistries checks spec.registries. Hosts and endpoints are written
+// into containerd and k3s configuration files on the node, so their shape is
+// enforced here as well as by the CRD patterns.
+func validateRegistries(regs *Registries, base *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	seen := map[string]bool{}
+	for i, m := range regs.Mirrors {
+		mPath := base.Child("mirrors").Index(i)
+		if m.Registry != "*" && !webhookRegistryHostRe.MatchString(m.Registry) {
+			allErrs = append(allErrs, field.Invalid(mPath.Child("registry"), m.Registry,
+				"registry must be a host with an optional port (e.g. \"docker.io\" or \"registry.example.com:5000\"), or \"*\""))
+		}
+		if seen[m.Registry] {
+			allErrs = append(allErrs, field.Duplicate(mPath.Child("registry"), m.Registry))
+		}
+		seen[m.Registry] = true
+		if len(m.Endpoints) == 0 {
+			allErrs = append(allErrs, field.Required(mPath.Child("endpoints"), "at least one mirror endpoint is required"))
+		}
+		for j, e := range m.Endpoints {
+			if !isRegistryEndpoint(e) {
+				allErrs = append(allErrs, field.Invalid(mPath.Child("endpoints").Index(j), e,
+					"endpoint must be an http(s) URL with a host and no credentials, query, whitespace, quotes, or backslashes"))
+			}
+		}
+	}
+
+	seen = map[string]bool{}
+	for i, c := range regs.Configs {
+		cPath := base.Child("configs").Index(i)
+		if !webhookRegistryHostRe.MatchString(c.Host) {
+			allErrs = append(allErrs, field.Invalid(cPath.Child("host"), c.Host,
+				"host must be a registry host with an optional port (e.g. \"registry.example.com:5000\")"))
+		}
+		if seen[c.Host] {
+			allErrs = append(allErrs, field.Duplicate(cPath.Child("host"), c.Host))
+		}
+		seen[c.Host] = true
+		if c.CA != "" && !isPEMCertificates(c.CA) {
+			allErrs = append(allErrs, field.Invalid(cPath.Child("ca"), "<ca>", "ca must be one or more PEM-encoded certificates"))
+		}
+		if c.AuthSecretRef != nil && c.AuthSecretRef.Name == "" {
+			allErrs = append(allErrs, field.Required(cPath.Child("authSecretRef", "name"), "authSecretRef.name must be set"))
+		}
+	}
+	return allErrs
+}
+
+// validateProxy checks spec.proxy. The values are written into an
+// environment file read by systemd and sh, so they must be single tokens; the
+// file is world-readable, so proxy URLs must not carry credentials.
+func validateProxy(p *Proxy, base *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if p.HTTPProxy == "" && p.HTTPSProxy == "" {
+		allErrs = append(allErrs, field.Required(base, "at least one of httpProxy or httpsProxy must be set"))
+	}
+	for _, f := range []struct {
+		name, value string
+	}{
+		{"httpProxy", p.HTTPProxy},
+		{"httpsProxy", p.HTTPSProxy},
+	} {
+		if f.value != "" && !isProxyURL(f.value) {
+			allErrs = append(allErrs, field.Invalid(base.Child(f.name), f.value,
+				"must be an http(s) URL with a host and no credentials, path, whitespace, quotes, or backslashes"))
+		}
+	}
+	for i, e := range p.NoProxy {
+		if !webhookNoProxyEntryRe.MatchString(e) {
+			allErrs = append(allErrs, field.Invalid(base.Child("noProxy").Index(i), e,
+				"must be a host, domain suffix (e.g. \".example.com\"), IP, or CIDR"))
+		}
+	}
+	return allErrs
+}
+
+// isProxyURL reports whether s is an http(s) proxy URL without credentials
+// that can be written into an environment file verbatim.
+func isProxyURL(s string) bool {
+	for _, r := range s {
+		if r <= ' ' || r > '~' || r == '"' || r == '\'' || r == '\\' {
+			return false
+		}
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.User == nil && strings.Trim(u.Path, "/") == "" && u.RawQuery == "" && u.Fragment == ""
+}
+
+// webhookNoProxyEntryRe matches the NO_PROXY entry shapes the renderer
+// accepts: hosts, domain suffixes, IPs, bracketed IPv6, CIDRs and host:port.
+var webhookNoProxyEntryRe = regexp.MustCompile(`^[A-Za-z0-9.*:/\[\]_-]{1,253}$`)
+
+// validateAirgapImages checks spec.airgapImages. Every bundle needs exactly
+// one source, and a Path or URL must name a file whose extension the
+// distribution imports; k0s only imports uncompressed .tar bundles.
+func validateAirgapImages(bundles []AirgapImageBundle, distribution string, base *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, b := range bundles {
+		p := base.Index(i)
+		sources := 0
+		for _, s := range []string{b.Image, b.Path, b.URL} {
+			if s != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			allErrs = append(allErrs, field.Invalid(p, "", "exactly one of image, path, or url must be set"))
+		}
+		if b.Image != "" {
+			if strings.ContainsAny(b.Image, " \t\r\n'\"\\$`;|&") {
+				allErrs = append(allErrs, field.Invalid(p.Child("image"), b.Image,
+					"image must be an OCI image reference without whitespace or shell metacharacters"))
+			}
+			if b.SHA256 != "" {
+				allErrs = append(allErrs, field.Invalid(p.Child("sha256"), b.SHA256, "sha256 is only valid with path or url"))
+			}
+		}
+		if b.Path != "" {
+			if !strings.HasPrefix(b.Path, "/") || strings.ContainsAny(b.Path, "\r\n") {
+				allErrs = append(allErrs, field.Invalid(p.Child("path"), b.Path, "path must be absolute (must begin with '/') and a single line"))
+			} else {
+				for _, seg := range strings.Split(b.Path, "/") {
+					if seg == ".." {
+						allErrs = append(allErrs, field.Invalid(p.Child("path"), b.Path, "path must not contain '..' path traversal segments"))
+						break
+					}
+				}
+			}
+			if airgapBundleExt(distribution, b.Path) == "" {
+				allErrs = append(allErrs, field.Invalid(p.Child("path"), b.Path, airgapBundleExtMessage(distribution)))
+			}
+		}
+		if b.URL != "" {
+			u, err := url.Parse(b.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil ||
+				strings.ContainsAny(b.URL, " \t\r\n") {
+				allErrs = append(allErrs, field.Invalid(p.Child("url"), b.URL,
+					"url must be an http(s) URL with a host and no embedded credentials"))
+			} else if airgapBundleExt(distribution, u.Path) == "" {
+				allErrs = append(allErrs, field.Invalid(p.Child("url"), b.URL, airgapBundleExtMessage(distribution)))
+			}
+		}
+		if b.SHA256 != "" && !webhookSHA256Re.MatchString(b.SHA256) {
+			allErrs = append(allErrs, field.Invalid(p.Child("sha256"), b.SHA256, "sha256 must be 64 lowercase hex characters"))
+		}
+	}
+	return allErrs
+}
+
+// validateNetwork checks spec.network. Link names are unique across
+// interfaces, bonds and VLANs; bond members and VLAN parents must be declared;
+// an interface belongs to at most one bond and then carries no addressing or
+// VLANs of its own. Every address, gateway, route and nameserver must parse,
+// with gateways and next hops in the matching address family.
+func validateNetwork(n *Network, base *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(n.Interfaces)+len(n.Bonds)+len(n.VLANs) == 0 {
+		allErrs = append(allErrs, field.Required(base, "at least one interface, bond, or VLAN must be set"))
+	}
+	links := map[string]string{} // name -> "interface" | "bond" | "vlan"
+	addLink := func(p *field.Path, name, kind string) {
+		if !webhookLinkNameRe.MatchString(name) {
+			allErrs = append(allErrs, field.Invalid(p, name, "must be a Linux interface name: a letter followed by up to 14 letters, digits, '.', '_' or '-'"))
+		}
+		if _, dup := links[name]; dup {
+			allErrs = append(allErrs, field.Duplicate(p, name))
+			return
+		}
+		links[name] = kind
+	}
+	for i, iface := range n.Interfaces {
+		p := base.Child("interfaces").Index(i)
+		addLink(p.Child("name"), iface.Name, "interface")
+		if iface.MACAddress != "" && !webhookMACAddressRe.MatchString(iface.MACAddress) {
+			allErrs = append(allErrs, field.Invalid(p.Child("macAddress"), iface.MACAddress, "must be a colon-separated MAC address"))
+		}
+		allErrs = append(allErrs, validateNetworkAddressing(iface.NetworkAddressing, p)...)
+	}
+	for i, b := range n.Bonds {
+		addLink(base.Child("bonds").Index(i).Child("name"), b.Name, "bond")
+	}
+	for i, v := range n.VLANs {
+		addLink(base.Child("vlans").Index(i).Child("name"), v.Name, "vlan")
+	}
+
+	members := map[string]string{} // interface -> bond
+	for i, b := range n.Bonds {
+		p := base.Child("bonds").Index(i)
+		if len(b.Interfaces) == 0 {
+			allErrs = append(allErrs, field.Required(p.Child("interfaces"), "a bond needs at least one member interface"))
+		}
+		for j, m := range b.Interfaces {
+			mp := p.Child("interfaces").Index(j)
+			if links[m] != "interface" {
+				allErrs = append(allErrs, field.NotFound(mp, m))
+				continue
+			}
+			if other, taken := members[m]; taken {
+				allErrs = append(allErrs, field.Invalid(mp, m, "interface is already a member of bond "+other))
+				continue
+			}
+			members[m] = b.Name
+		}
+		switch b.Mode {
+		case "", "balance-rr", "active-backup", "balance-xor", "broadcast", "802.3ad", "balance-tlb", "balance-alb":
+		default:
+			allErrs = append(allErrs, field.NotSupported(p.Child("mode"), b.Mode,
+				[]string{"balance-rr", "active-backup", "balance-xor", "broadcast", "802.3ad", "balance-tlb", "balance-alb"}))
+		}
+		allErrs = append(allErrs, validateNetworkAddressing(b.NetworkAddressing, p)...)
+	}
+	for i, iface := range n.Interfaces {
+		if bond, ok := members[iface.Name]; ok && hasNetworkAddressing(iface.NetworkAddressing) {
+			allErrs = append(allErrs, field.Invalid(base.Child("interfaces").Index(i), iface.Name,
+				"member of bond "+bond+" must not set dhcp, addresses, gateways, routes, nameservers, or searchDomains"))
+		}
+	}
+	for i, v := range n.VLANs {
+		p := base.Child("vlans").Index(i)
+		if v.ID < 1 || v.ID > 4094 {
+			allErrs = append(allErrs, field.Invalid(p.Child("id"), v.ID, "must be between 1 and 4094"))
+		}
+		switch kind := links[v.Link]; {
+		case kind != "interface" && kind != "bond":
+			allErrs = append(allErrs, field.NotFound(p.Child("link"), v.Link))
+		case members[v.Link] != "":
+			allErrs = append(allErrs, field.Invalid(p.Child("link"), v.Link, "a bond member cannot carry VLANs; use the bond"))
+		}
+		allErrs = append(allErrs, validateNetworkAddressing(v.NetworkAddressing, p)...)
+	}
+	return allErrs
+}
+
+// validateNetworkAddressing checks the layer-3 fields of one link.
+func validateNetworkAddressing(a NetworkAddressing, p *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, addr := range a.Addresses {
+		if ip, _, err := net.ParseCIDR(addr); err != nil || ip == nil {
+			allErrs = append(allErrs, field.Invalid(p.Child("addresses").Index(i), addr, "must be an address in CIDR notation, e.g. 192.168.1.10/24"))
+		}
+	}
+	if a.Gateway4 != "" {
+		if ip := net.ParseIP(a.Gateway4); ip == nil || ip.To4() == nil {
+			allErrs = append(allErrs, field.Invalid(p.Child("gateway4"), a.Gateway4, "must be an IPv4 address"))
+		}
+	}
+	if a.Gateway6 != "" {
+		if ip := net.ParseIP(a.Gateway6); ip == nil || ip.To4() != nil {
+			allErrs = append(allErrs, field.Invalid(p.Child("gateway6"), a.Gateway6, "must be an IPv6 address"))
+		}
+	}
+	for i, r := range a.Routes {
+		rp := p.Child("routes").Index(i)
+		var dst *net.IPNet
+		if r.To != "default" {
+			_, ipNet, err := net.ParseCIDR(r.To)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(rp.Child("to"), r.To, "must be a CIDR or \"default\""))
+			}
+			dst = ipNet
+		}
+		if r.Via != "" {
+			via := net.ParseIP(r.Via)
+			switch {
+			case via == nil:
+				allErrs = append(allErrs, field.Invalid(rp.Child("via"), r.Via, "must be an IP address"))
+			case dst != nil && (dst.IP.To4() == nil) != (via.To4() == nil):
+				allErrs = append(allErrs, field.Invalid(rp.Child("via"), r.Via, "must be in the same address family as to"))
+			}
+		} else if r.To == "default" {
+			allErrs = append(allErrs, field.Required(rp.Child("via"), "a default route needs a next hop"))
+		}
+		if r.Metric != nil && *r.Metric < 0 {
+			allErrs = append(allErrs, field.Invalid(rp.Child("metric"), *r.Metric, "must not be negative"))
+		}
+	}
+	for i, ns := range a.Nameservers {
+		if net.ParseIP(ns) == nil {
+			allErrs = append(allErrs, field.Invalid(p.Child("nameservers").Index(i), ns, "must be an IP address"))
+		}
+	}
+	for i, d := range a.SearchDomains {
+		if !webhookSearchDomainRe.MatchString(d) {
+			allErrs = append(allErrs, field.Invalid(p.Child("searchDomains").Index(i), d, "must be a DNS domain, optionally prefixed with '~'"))
+		}
+	}
+	if a.MTU != nil && (*a.MTU < 68 || *a.MTU > 9216) {
+		allErrs = append(allErrs, field.Invalid(p.Child("mtu"), *a.MTU, "must be between 68 and 9216"))
+	}
+	return allErrs
+}
+
+// hasNetworkAddressing reports whether a link sets any layer-3 field. MTU is
+// a link property and is allowed on bond members.
+func hasNetworkAddressing(a NetworkAddressing) bool {
+	return a.DHCP4 || a.DHCP6 || len(a.Addresses) > 0 || a.Gateway4 != "" || a.Gateway6 != "" ||
+		len(a.Routes) > 0 || len(a.Nameservers) > 0 || len(a.SearchDomains) > 0
+}
+
+// webhookLinkNameRe mirrors the kubebuilder marker on the network link names.
+var webhookLinkNameRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9._-]{0,14}$`)
+
+// webhookMACAddressRe mirrors the kubebuilder marker on
+// NetworkInterface.MACAddress.
+var webhookMACAddressRe = regexp.MustCompile(`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`)
+
+// webhookSearchDomainRe matches DNS domains, with systemd-networkd's optional
+// "~" routing-domain prefix.
+var webhookSearchDomainRe = regexp.MustCompile(`^~?([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*\.?$`)
+
+// validateNodeRegistration checks NodeLabels, NodeTaints and
+// KubeletExtraArgs. Labels and taints follow the Kubernetes syntax, which
+// already excludes every shell and YAML metacharacter, and label keys are
+// further held to webhookNodeLabelAllowed. Kubelet flag names are
+// lower-case words joined by '-', and values are held to
+// webhookKubeletArgValueRe because k0s receives them on the service command
+// line.
+func validateNodeRegistration(spec *KairosConfigSpec, base *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	labelsPath := base.Child("nodeLabels")
+	for k, v := range spec.NodeLabels {
+		for _, msg := range validation.IsQualifiedName(k) {
+			allErrs = append(allErrs, field.Invalid(labelsPath.Key(k), k, msg))
+		}
+		if !webhookNodeLabelAllowed(k) {
+			allErrs = append(allErrs, field.Invalid(labelsPath.Key(k), k,
+				"labels in the kubernetes.io and k8s.io namespaces are limited to the kubelet.kubernetes.io and node.kubernetes.io prefixes"))
+		}
+		for _, msg := range validation.IsValidLabelValue(v) {
+			allErrs = append(allErrs, field.Invalid(labelsPath.Key(k), v, msg))
+		}
+	}
+	seenTaints := map[string]bool{}
+	for i, t := range spec.NodeTaints {
+		p := base.Child("nodeTaints").Index(i)
+		for _, msg := range validation.IsQualifiedName(t.Key) {
+			allErrs = append(allErrs, field.Invalid(p.Child("key"), t.Key, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(t.Value) {
+			allErrs = append(allErrs, field.Invalid(p.Child("value"), t.Value, msg))
+		}
+		switch t.Effect {
+		case "NoSchedule", "PreferNoSchedule", "NoExecute":
+		default:
+			allErrs = append(allErrs, field.NotSupported(p.Child("effect"), t.Effect,
+				[]string{"NoSchedule", "PreferNoSchedule", "NoExecute"}))
+		}
+		id := t.Key + ":" + string(t.Effect)
+		if seenTaints[id] {
+			allErrs = append(allErrs, field.Duplicate(p, id))
+		}
+		seenTaints[id] = true
+	}
+	argsPath := base.Child("kubeletExtraArgs")
+	for k, v := range spec.KubeletExtraArgs {
+		switch {
+		case !webhookKubeletArgNameRe.MatchString(k):
+			allErrs = append(allErrs, field.Invalid(argsPath.Key(k), k, "must be a kubelet flag name without leading dashes, e.g. max-pods"))
+		case k == "provider-id":
+			allErrs = append(allErrs, field.Forbidden(argsPath.Key(k), "the provider sets the kubelet provider ID"))
+		case k == "node-labels":
+			allErrs = append(allErrs, field.Forbidden(argsPath.Key(k), "use spec.nodeLabels"))
+		case k == "register-with-taints":
+			allErrs = append(allErrs, field.Forbidden(argsPath.Key(k), "use spec.nodeTaints"))
+		}
+		if !webhookKubeletArgValueRe.MatchString(v) {
+			allErrs = append(allErrs, field.Invalid(argsPath.Key(k), v,
+				"must be at most 256 letters, digits and '.', '_', ':', '/', '=', ',', '@', '+', '<', '*' or '-'"))
+		}
+	}
+	return allErrs
+}
+
+// webhookNodeLabelAllowed reports whether a kubelet may set the label key on
+// its own Node. As in CAPI's kubeadm bootstrap provider, keys in the
+// kubernetes.io and k8s.io namespaces are limited to the kubelet.kubernetes.io
+// and node.kubernetes.io prefixes: the NodeRestriction admission plugin
+// refuses the others, e.g. node-role.kubernetes.io/worker, and the kubelet
+// then never registers.
+func webhookNodeLabelAllowed(key string) bool {
+	prefix, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return true
+	}
+	prefix = strings.ToLower(prefix)
+	inDomain := func(domain string) bool { return prefix == domain || strings.HasSuffix(prefix, "."+domain) }
+	if !inDomain("kubernetes.io") && !inDomain("k8s.io") {
+		return true
+	}
+	return inDomain("kubelet.kubernetes.io") || inDomain("node.kubernetes.io")
+}
+
+// webhookKubeletArgNameRe matches kubelet flag names without leading dashes.
+var webhookKubeletArgNameRe = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// webhookKubeletArgValueRe matches kubelet flag values that are safe on a
+// systemd or shell command line inside double quotes and in a YAML scalar:
+// no whitespace, quotes, '$', '%', '`' or backslash.
+var webhookKubeletArgValueRe = regexp.MustCompile(`^[A-Za-z0-9._:/=,@+<*-]{0,256}$`)
+
+// webhookK0sConfigKeys are the ClusterConfig spec keys k0sConfig may set.
+var webhookK0sConfigKeys = []string{
+	"api", "controllerManager", "extensions", "featureGates", "images", "installConfig",
+	"konnectivity", "network", "scheduler", "storage", "telemetry", "workerProfiles",
+}
+
+// validateK0sConfig checks spec.k0sConfig: it must be a ClusterConfig spec
+// fragment on a k0s control-plane config, must not set the keys the provider
+// owns, and must keep the etcd storage an HA control plane joins through.
+// api.sans is merged with the provider's entries, so it only has to be a list
+// of strings.
+func validateK0sConfig(spec *KairosConfigSpec, base *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if spec.Distribution != "" && spec.Distribution != "k0s" {
+		allErrs = append(allErrs, field.Forbidden(base, "k0sConfig applies to the k0s distribution only"))
+	}
+	if spec.Role == "worker" {
+		allErrs = append(allErrs, field.Forbidden(base, "k0sConfig applies to control-plane nodes only; k0s workers receive their configuration from the controllers"))
+	}
+	var cfg map[string]any
+	if err := json.Unmarshal(spec.K0sConfig.Raw, &cfg); err != nil || cfg == nil {
+		return append(allErrs, field.Invalid(base, string(spec.K0sConfig.Raw), "must be an object"))
+	}
+	for k := range cfg {
+		switch k {
+		case "apiVersion", "kind", "metadata", "spec":
+			allErrs = append(allErrs, field.Invalid(base.Child(k), k,
+				"k0sConfig is the ClusterConfig spec; omit apiVersion, kind, metadata and spec"))
+			continue
+		}
+		known := false
+		for _, allowed := range webhookK0sConfigKeys {
+			known = known || k == allowed
+		}
+		if !known {
+			allErrs = append(allErrs, field.NotSupported(base.Child(k), k, webhookK0sConfigKeys))
+		}
+	}
+	if network, ok := cfg["network"].(map[string]any); ok {
+		for _, key := range []string{"podCIDR", "serviceCIDR"} {
+			if _, set := network[key]; set {
+				allErrs = append(allErrs, field.Forbidden(base.Child("network", key), "set by the provider from spec."+key))
+			}
+		}
+	}
+	if api, ok := cfg["api"].(map[string]any); ok {
+		if sans, set := api["sans"]; set {
+			list, ok := sans.([]any)
+			for _, s := range list {
+				if _, isString := s.(string); !isString {
+					ok = false
+				}
+			}
+			if !ok {
+				allErrs = append(allErrs, field.Invalid(base.Child("api", "sans"), sans, "must be a list of strings"))
+			}
+		}
+	}
+	if spec.ControlPlaneRole == ControlPlaneRoleInit || spec.ControlPlaneRole == ControlPlaneRoleJoin {
+		if storage, ok := cfg["storage"].(map[string]any); ok {
+			if t, set := storage["type"]; set && t != "etcd" {
+				allErrs = append(allErrs, field.Invalid(base.Child("storage", "type"), t,
+					"an HA control plane requires etcd storage; its members join through it"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// webhookK3sConfigKeyRe matches k3s config file keys: a flag name without
+// leading dashes, optionally suffixed with "+" to append to a list.
+var webhookK3sConfigKeyRe = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*\+?$`)
+
+// webhookK3sReservedKeys are the k3s options the provider manages, with the
+// reason each is rejected in k3sConfig.
+var webhookK3sReservedKeys = map[string]string{
+	"token":            "the provider manages the join tokens",
+	"token-file":       "the provider manages the join tokens",
+	"agent-token":      "the provider manages the join tokens",
+	"agent-token-file": "the provider manages the join tokens",
+	"server":           "the provider sets the server URL",
+	"cluster-init":     "set by spec.controlPlaneRole",
+	"tls-san":          "the provider sets the serving certificate SANs",
+	"node-ip":          "the provider manages the node IP",
+	"node-external-ip": "the provider manages the node IP",
+	"kubelet-arg":      "use spec.kubeletExtraArgs",
+	"node-label":       "use spec.nodeLabels",
+	"node-taint":       "use spec.nodeTaints",
+	"private-registry": "use spec.registries",
+}
+
+// validateK3sConfig checks spec.k3sConfig: it applies to k3s only, server
+// options to control-plane configs only, and every option must be a
+// non-reserved flag name with a scalar or list-of-scalars value, set in at
+// most one section.
+func validateK3sConfig(spec *KairosConfigSpec, base *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if spec.Distribution != "k3s" {
+		allErrs = append(allErrs, field.Forbidden(base, "k3sConfig applies to the k3s distribution only"))
+	}
+	if spec.K3sConfig.Server != nil && spec.Role == "worker" {
+		allErrs = append(allErrs, field.Forbidden(base.Child("server"), "server options apply to control-plane nodes only"))
+	}
+	server, errs := validateK3sConfigSection(spec.K3sConfig.Server, base.Child("server"))
+	allErrs = append(allErrs, errs...)
+	agent, errs := validateK3sConfigSection(spec.K3sConfig.Agent, base.Child("agent"))
+	allErrs = append(allErrs, errs...)
+	for _, c := range []struct{ key, field, value string }{
+		{"cluster-cidr", "podCIDR", spec.PodCIDR}, {"service-cidr", "serviceCIDR", spec.ServiceCIDR},
+	} {
+		if _, set := server[c.key]; set && c.value != "" {
+			allErrs = append(allErrs, field.Forbidden(base.Child("server").Key(c.key), "set by the provider from spec."+c.field))
+		}
+	}
+	for k := range agent {
+		if _, dup := server[k]; dup {
+			allErrs = append(allErrs, field.Duplicate(base.Child("agent").Key(k), k))
+		}
+	}
+	return allErrs
+}
+
+// validateK3sConfigSection decodes and checks one k3sConfig section. It
+// returns the decoded options for the cross-section duplicate check.
+func validateK3sConfigSection(raw *apiextensionsv1.JSON, base *field.Path) (map[string]any, field.ErrorList) {
+	if raw == nil {
+		return nil, nil
+	}
+	var allErrs field.ErrorList
+	var opts map[string]any
+	if err := json.Unmarshal(raw.Raw, &opts); err != nil || opts == nil {
+		return nil, append(allErrs, field.Invalid(base, string(raw.Raw), "must be an object"))
+	}
+	for k, v := range opts {
+		p := base.Key(k)
+		if !webhookK3sConfigKeyRe.MatchString(k) {
+			allErrs = append(allErrs, field.Invalid(p, k, "must be a k3s flag name without leading dashes"))
+			continue
+		}
+		if reason, ok := webhookK3sReservedKeys[strings.TrimSuffix(k, "+")]; ok {
+			allErrs = append(allErrs, field.Forbidden(p, reason))
+			continue
+		}
+		if list, ok := v.([]any); ok {
+			for i, e := range list {
+				if !isK3sConfigScalar(e) {
+					allErrs = append(allErrs, field.Invalid(p.Index(i), e, "must be a string, number or boolean"))
+				}
+			}
+		} else if !isK3sConfigScalar(v) {
+			allErrs = append(allErrs, field.Invalid(p, v, "must be a string, number, boolean or a list of those"))
+		}
+	}
+	return opts, allErrs
+}
+
+// isK3sConfigScalar reports whether a decoded JSON value is a string, number
+// or boolean.
+func isK3sConfigScalar(v any) bool {
+	switch v.(type) {
+	case string, float64, bool:
+		return true
+	}
+	return false
+}
+
+// validateContent checks that a File or Manifest sets exactly one of content
+// and contentFrom, and that contentFrom names exactly one Secret or ConfigMap
+// key.
+func validateContent(content string, from *ContentSource, base *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	switch {
+	case content != "" && from != nil:
+		return append(allErrs, field.Forbidden(base.Child("contentFrom"), "content and contentFrom are mutually exclusive"))
+	case content == "" && from == nil:
+		return append(allErrs, field.Required(base.Child("content"), "one of content or contentFrom must be set"))
+	case from == nil:
+		return nil
+	}
+	p := base.Child("contentFrom")
+	if (from.Secret == nil) == (from.ConfigMap == nil) {
+		return append(allErrs, field.Invalid(p, "", "exactly one of secret or configMap must be set"))
+	}
+	sel, selPath := from.Secret, p.Child("secret")
+	if sel == nil {
+		sel, selPath = from.ConfigMap, p.Child("configMap")
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(sel.Name) {
+		allErrs = append(allErrs, field.Invalid(selPath.Child("name"), sel.Name, msg))
+	}
+	for _, msg := range validation.IsConfigMapKey(sel.Key) {
+		allErrs = append(allErrs, field.Invalid(selPath.Child("key"), sel.Key, msg))
+	}
+	return allErrs
+}
+
+// validateControlPlaneCNI checks the CNI selection the KairosControlPlane
+// copies down: it applies to control-plane configs only, and the user's
+// k0sConfig and k3sConfig must not set the options it renders.
+func validateControlPlaneCNI(spec *KairosConfigSpec, base *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	switch spec.ControlPlaneCNI.Provider {
+	case "calico", "cilium", "none":
+	default:
+		allErrs = append(allErrs, field.NotSupported(base.Child("provider"), spec.ControlPlaneCNI.Provider,
+			[]string{"calico", "cilium", "none"}))
+	}
+	if spec.Role == "worker" {
+		allErrs = append(allErrs, field.Forbidden(base, "the CNI is installed by the control plane"))
+	}
+	if spec.K0sConfig != nil {
+		var cfg map[string]any
+		if err := json.Unmarshal(spec.K0sConfig.Raw, &cfg); err == nil {
+			if network, ok := cfg["network"].(map[string]any); ok {
+				if _, set := network["provider"]; set {
+					allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "k0sConfig", "network", "provider"),
+						"set by the control plane's CNI selection"))
+				}
+			}
+		}
+	}
+	if spec.K3sConfig != nil && spec.K3sConfig.Server != nil {
+		var opts map[string]any
+		if err := json.Unmarshal(spec.K3sConfig.Server.Raw, &opts); err == nil {
+			for _, k := range []string{"flannel-backend", "disable-network-policy"} {
+				if _, set := opts[k]; set {
+					allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "k3sConfig", "server").Key(k),
+						"set by the control plane's CNI selection"))
+				}
+			}
+		}
+	}
+	return allErrs
+}
+
+// webhookK3sAirgapExts are the archive extensions k3s and rke2 import from
+// their agent/images directory. k0s imports only ".tar".
+var webhookK3sAirgapExts = []string{".tar", ".tar.gz", ".tgz", ".tar.zst", ".tzst", ".tar.bz2", ".tbz", ".tar.lz4"}
+
+// airgapBundleExt returns the bundle extension of name the distribution
+// imports, or "" when it imports none. An empty distribution is k0s, the
+// defaulted value.
+func airgapBundleExt(distribution, name string) string {
+	exts := []string{".tar"}
+	if distribution == "k3s" || distribution == "rke2" {
+		exts = webhookK3sAirgapExts
+	}
+	for _, ext := range exts {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+func airgapBundleExtMessage(distribution string) string {
+	if distribution == "k3s" || distribution == "rke2" {
+		return distribution + " imports only " + strings.Join(webhookK3sAirgapExts, ", ") + " bundles"
+	}
+	return "k0s imports only uncompressed .tar bundles"
+}
+
+// isRegistryEndpoint reports whether e is an http(s) mirror URL the node-side
+// configuration files can carry as a plain quoted string.
+func isRegistryEndpoint(e string) bool {
+	for _, r := range e {
+		if r <= ' ' || r > '~' || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	u, err := url.Parse(e)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.User == nil && u.RawQuery == "" && u.Fragment == ""
+}
+
+// isPEMCertificates reports whether s is a sequence of PEM CERTIFICATE blocks
+// that parse as X.509 certificates, with nothing but whitespace around them.
+func isPEMCertificates(s string) bool {
+	rest := []byte(s)
+	n := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return false
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return false
+		}
+		n++
+	}
+	return n > 0 && strings.TrimSpace(string(rest)) == ""
+}
+
+// webhookRegistryHostRe mirrors the kubebuilder marker on RegistryConfig.Host.
+var webhookRegistryHostRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?(:[0-9]{1,5})?$`)
+
+// webhookKubernetesVersionRe mirrors the kubebuilder marker on
+// KairosConfigSpec.KubernetesVersion.
+var webhookKubernetesVersionRe = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+([-+][0-9A-Za-z.+-]+)?$`)
+
+// webhookSHA256Re mirrors the kubebuilder marker on DistributionRelease.SHA256.
+var webhookSHA256Re = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
 // webhookOctalPermissionsRe matches octal file-permission strings such as
 // "644", "0644", "1755". It mirrors the kubebuilder marker on File.Permissions.
 var webhookOctalPermissionsRe = regexp.MustCompile(`^0?[0-7]{3,4}$`)
@@ -50,6 +50,48 @@ const (
 	// when quorum holds but a member is degraded; False(Warning) at or below the
 	// (N/2)+1 quorum minimum. Not surfaced for single-node control planes.
 	EtcdHealthyCondition = "EtcdHealthy"
+
+	// InPlaceUpgradeCondition reports an InPlace rollout. True once every
+	// machine runs spec.version; False(Info) while a node is upgrading or
+	// waiting for the etcd quorum gate; False(Warning) when a node's upgrade
+	// failed. Only surfaced when spec.rolloutStrategy.type is InPlace.
+	InPlaceUpgradeCondition = "InPlaceUpgrade"
+
+	// EtcdBackupReadyCondition reports scheduled etcd snapshots. True when
+	// every current control-plane node's latest snapshot succeeded and at
+	// least one has been uploaded; False(Info) until the first snapshot;
+	// False(Warning) when a node's latest snapshot failed. Only surfaced when
+	// spec.etcdBackup is set.
+	EtcdBackupReadyCondition = "EtcdBackupReady"
+
+	// EtcdRestoreCondition reports a restore requested by spec.etcdRestore.
+	// False(Info) while machines are deleted, the snapshot is restored, and
+	// members rejoin; True once the control plane is back at spec.replicas.
+	// Only surfaced when spec.etcdRestore is set.
+	EtcdRestoreCondition = "EtcdRestore"
+
+	// SingleRoleMigrationCondition reports the migration of a control-plane
+	// Machine created with controlPlaneRole single to an etcd-backed init node,
+	// which runs before spec.replicas above 1 is acted on. False(Info) while
+	// the node is converted in place; False(Warning) when the conversion
+	// failed or the distribution cannot convert its datastore; True once no
+	// single-role Machine is left. Only surfaced when such a Machine exists.
+	SingleRoleMigrationCondition = "SingleRoleMigration"
+
+	// WorkerTokenReadyCondition reports the worker join token in the
+	// <cluster>-worker-token Secret. True while the Secret holds a token that
+	// has not expired; False(Info) until the first token is published;
+	// False(Warning) when a due rotation failed. Only surfaced for k0s and
+	// k3s, whose worker tokens the control plane manages.
+	WorkerTokenReadyCondition = "WorkerTokenReady"
+
+	// CertificatesExpiringSoonCondition reports control-plane certificate
+	// expiry. It has negative polarity: True(Warning) when a node certificate
+	// or the kubeconfig client certificate expires within the warning window
+	// (30 days, or spec.rolloutBefore.certificatesExpiryDays if larger);
+	// False otherwise; Unknown until a node has reported its certificates.
+	// In hosted mode only the kubeconfig client certificate is tracked.
+	CertificatesExpiringSoonCondition = "CertificatesExpiringSoon"
 )
 
 // Condition reasons
@@ -95,6 +137,83 @@ const (
 	// k0s joiner gate).
 	WaitingForEtcdMemberReason = "WaitingForEtcdMember"
 
+	// InPlaceUpgradeInProgressReason is the False(Info) reason on
+	// InPlaceUpgradeCondition while a node is being upgraded.
+	InPlaceUpgradeInProgressReason = "InPlaceUpgradeInProgress"
+
+	// WaitingForEtcdQuorumReason is the False(Info) reason on
+	// InPlaceUpgradeCondition while the next node's upgrade is held back
+	// because taking it down would break etcd quorum.
+	WaitingForEtcdQuorumReason = "WaitingForEtcdQuorum"
+
+	// InPlaceUpgradeFailedReason is the False(Warning) reason on
+	// InPlaceUpgradeCondition when a node's NodeOpUpgrade failed.
+	InPlaceUpgradeFailedReason = "InPlaceUpgradeFailed"
+
+	// WaitingForFirstEtcdSnapshotReason is the False(Info) reason on
+	// EtcdBackupReadyCondition before any node has reported a snapshot.
+	WaitingForFirstEtcdSnapshotReason = "WaitingForFirstEtcdSnapshot"
+
+	// EtcdSnapshotFailedReason is the False(Warning) reason on
+	// EtcdBackupReadyCondition when a node's latest snapshot or upload failed.
+	EtcdSnapshotFailedReason = "EtcdSnapshotFailed"
+
+	// EtcdRestoreInProgressReason is the False(Info) reason on
+	// EtcdRestoreCondition until the restore has completed. The message
+	// names the current phase.
+	EtcdRestoreInProgressReason = "EtcdRestoreInProgress"
+
+	// SingleRoleMigrationInProgressReason is the False(Info) reason on
+	// SingleRoleMigrationCondition while the node's server token is exported
+	// and its datastore converted to etcd.
+	SingleRoleMigrationInProgressReason = "SingleRoleMigrationInProgress"
+
+	// SingleRoleMigrationFailedReason is the False(Warning) reason on
+	// SingleRoleMigrationCondition when the node-side conversion failed.
+	SingleRoleMigrationFailedReason = "SingleRoleMigrationFailed"
+
+	// SingleRoleMigrationUnsupportedReason is the False(Warning) reason on
+	// SingleRoleMigrationCondition for k0s: a k0s --single controller keeps
+	// its data in kine, which k0s cannot convert to etcd, so the control
+	// plane stays at its single machine.
+	SingleRoleMigrationUnsupportedReason = "SingleRoleMigrationUnsupported"
+
+	// WaitingForWorkerTokenReason is the False(Info) reason on
+	// WorkerTokenReadyCondition until the first worker token is published:
+	// by the k0s init node, or by the controller once a k3s control plane is
+	// initialized.
+	WaitingForWorkerTokenReason = "WaitingForWorkerToken"
+
+	// WorkerTokenRotationFailedReason is the False(Warning) reason on
+	// WorkerTokenReadyCondition when the controller could not mint a
+	// replacement token in the workload cluster. The current token keeps
+	// working until it expires; the rotation is retried on the next
+	// reconcile.
+	WorkerTokenRotationFailedReason = "WorkerTokenRotationFailed"
+
+	// CertificatesExpiringReason is the True(Warning) reason on
+	// CertificatesExpiringSoonCondition. The message names the certificate
+	// that expires first.
+	CertificatesExpiringReason = "CertificatesExpiring"
+
+	// WaitingForCertificateExpiryReportsReason is the Unknown reason on
+	// CertificatesExpiringSoonCondition until a current control-plane node
+	// has reported its certificates, or while every report failed. In hosted
+	// mode it is used until the kubeconfig client certificate is readable.
+	WaitingForCertificateExpiryReportsReason = "WaitingForCertificateExpiryReports"
+
+	// WaitingForHostedControlPlaneEndpointReason is the False(Info) reason on
+	// Ready, Available and KubeconfigReady of a hosted control plane
+	// (spec.hosted) while its Service has no address yet. k0s is only
+	// started, and the kubeconfig only written, once the address is known.
+	WaitingForHostedControlPlaneEndpointReason = "WaitingForHostedControlPlaneEndpoint"
+
+	// WaitingForHostedControlPlaneReason is the False reason on Ready (and,
+	// before initialization, Available) of a hosted control plane while its
+	// k0s controller pod is not ready. Severity is Info until the control
+	// plane has been initialized, Warning afterwards.
+	WaitingForHostedControlPlaneReason = "WaitingForHostedControlPlane"
+
 	// WaitingForMachinesReadyReason indicates that the control plane is waiting for machines to be ready
 	WaitingForMachinesReadyReason = "WaitingForMachinesReady"
 
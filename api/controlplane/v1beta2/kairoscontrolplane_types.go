@@ -17,7 +17,11 @@ permissions and limitations under the License.
 package v1beta2
 
 import (
+	"strings"
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
@@ -26,6 +30,16 @@ const (
 	// KairosControlPlaneFinalizer allows the reconciler to clean up resources associated with KairosControlPlane before
 	// removing it from the API server.
 	KairosControlPlaneFinalizer = "kairoscontrolplane.controlplane.cluster.x-k8s.io"
+
+	// RemediationInProgressAnnotation is set on the KairosControlPlane while an
+	// unhealthy Machine is being replaced. Its value is the JSON form of
+	// LastRemediationStatus; it moves to the replacement Machine as
+	// RemediationForAnnotation when that Machine is created.
+	RemediationInProgressAnnotation = "controlplane.cluster.x-k8s.io/remediation-in-progress"
+
+	// RemediationForAnnotation links a replacement Machine to the remediation
+	// that created it, so a replacement that fails again counts as a retry.
+	RemediationForAnnotation = "controlplane.cluster.x-k8s.io/remediation-for"
 )
 
 // KairosControlPlaneSpec defines the desired state of KairosControlPlane
@@ -39,10 +53,11 @@ type KairosControlPlaneSpec struct {
 	// are also rejected; beyond 5 etcd members the quorum cost outweighs the
 	// additional fault tolerance for a control plane.
 	//
-	// replicas: 1 configures a single-node control plane (k0s --single /
-	// k3s single-server). replicas: 3 or 5 configure an HA control plane using
-	// the classic join path (ADR 0005, Phase 3+); kube-vip (ARP/L2 by default)
-	// provides the stable VIP — configure spec.ha.vip for the VIP parameters.
+	// replicas: 1 configures a single-node control plane running a
+	// single-member etcd cluster, so it can later be scaled to 3 or 5 without a
+	// rebuild. replicas: 3 or 5 configure an HA control plane using the classic
+	// join path (ADR 0005, Phase 3+); kube-vip (ARP/L2 by default) provides the
+	// stable VIP — configure spec.ha.vip for the VIP parameters.
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:validation:Maximum=5
 	// +kubebuilder:default=1
@@ -54,29 +69,46 @@ type KairosControlPlaneSpec struct {
 	Version string `json:"version"`
 
 	// Distribution specifies the Kubernetes distribution to install
-	// +kubebuilder:validation:Enum=k0s;k3s
+	// +kubebuilder:validation:Enum=k0s;k3s;rke2
 	// +kubebuilder:default=k0s
 	// +optional
 	Distribution string `json:"distribution,omitempty"`
 
 	// MachineTemplate defines the template for creating control plane machines
 	// Contract: ControlPlane MUST expose machineTemplate
-	MachineTemplate KairosControlPlaneMachineTemplate `json:"machineTemplate"`
+	// Required unless spec.hosted is set.
+	// +optional
+	MachineTemplate KairosControlPlaneMachineTemplate `json:"machineTemplate,omitempty"`
 
 	// KairosConfigTemplate is a reference to a KairosConfigTemplate resource
 	// Contract: ControlPlane MUST reference a BootstrapConfigTemplate
-	KairosConfigTemplate KairosConfigTemplateReference `json:"kairosConfigTemplate"`
+	// Required unless spec.hosted is set.
+	// +optional
+	KairosConfigTemplate KairosConfigTemplateReference `json:"kairosConfigTemplate,omitempty"`
 
 	// RolloutStrategy defines the strategy for rolling out updates
 	// +optional
 	RolloutStrategy *RolloutStrategy `json:"rolloutStrategy,omitempty"`
 
+	// RolloutBefore triggers a rollout of control-plane machines ahead of
+	// events that would otherwise break them, currently certificate expiry.
+	// +optional
+	RolloutBefore *RolloutBefore `json:"rolloutBefore,omitempty"`
+
+	// RemediationStrategy tunes how control-plane Machines marked unhealthy by
+	// a MachineHealthCheck are remediated. Remediation only runs for HA
+	// control planes (spec.replicas > 1): one Machine at a time, only when
+	// removing it keeps etcd quorum, and always through the etcd-leave
+	// handshake before a replacement is created.
+	// +optional
+	RemediationStrategy *RemediationStrategy `json:"remediationStrategy,omitempty"`
+
 	// HA holds configuration for high-availability control planes
-	// (spec.replicas in {3, 5}). Ignored when spec.replicas is 1.
+	// (spec.replicas in {3, 5}).
 	//
-	// For single-node clusters (replicas: 1) this field must be left unset or
-	// nil; kube-vip is not rendered for single-node control planes, and a
-	// non-nil VIP block will trigger a validation warning.
+	// On a single-node cluster (replicas: 1) a VIP block is optional: when set,
+	// the lone control-plane node already runs kube-vip, so scaling out to 3
+	// keeps the same endpoint.
 	// +optional
 	HA *HAConfig `json:"ha,omitempty"`
 
@@ -89,11 +121,11 @@ type KairosControlPlaneSpec struct {
 	// KubeconfigReadyCondition has been False(WaitingForNodePush) for longer
 	// than spec.sshFallback.activateAfter (default 15m), and Enabled=true,
 	// the SSH-fetch path dials the workload node, retrieves the local admin
-	// kubeconfig from /var/lib/k0s/pki/admin.conf (k0s) or
-	// /etc/rancher/k3s/k3s.yaml (k3s), and writes the cluster kubeconfig
-	// Secret. KubeconfigReadyCondition then transitions to
-	// True(KubeconfigReadyViaSSHFallback) so operators can audit which
-	// path supplied the kubeconfig.
+	// kubeconfig from /var/lib/k0s/pki/admin.conf (k0s),
+	// /etc/rancher/k3s/k3s.yaml (k3s) or /etc/rancher/rke2/rke2.yaml (rke2),
+	// and writes the cluster kubeconfig Secret. KubeconfigReadyCondition then
+	// transitions to True(KubeconfigReadyViaSSHFallback) so operators can
+	// audit which path supplied the kubeconfig.
 	//
 	// SECURITY: host-key verification is mandatory. The controller refuses
 	// to connect unless the workload node's host key matches an entry in
@@ -103,6 +135,287 @@ type KairosControlPlaneSpec struct {
 	// Off by default. Adding fields here is opt-in via Enabled=true.
 	// +optional
 	SSHFallback *SSHFallback `json:"sshFallback,omitempty"`
+
+	// EtcdBackup configures scheduled etcd snapshots uploaded to S3-compatible
+	// object storage.
+	//
+	// Every control-plane node takes a snapshot on the schedule (`k0s backup`,
+	// `k3s etcd-snapshot save` or `rke2 etcd-snapshot save`), uploads it under
+	// <prefix>/<node name>/ and reports the outcome into the workload-cluster
+	// Secret kube-system/kairos-etcd-backup-status. The controller surfaces
+	// the newest successful snapshot in status.lastEtcdSnapshot and the
+	// outcome as the EtcdBackupReady condition.
+	//
+	// The configuration and the resolved credentials are rendered into each
+	// node's bootstrap data, so changing this block rolls the control plane
+	// like a KairosConfigTemplate change. Rotating the credentials Secret
+	// takes effect on machines created afterwards.
+	// +optional
+	EtcdBackup *EtcdBackup `json:"etcdBackup,omitempty"`
+
+	// EtcdRestore rebuilds the control plane from an etcd snapshot taken by
+	// spec.etcdBackup, e.g. after the cluster lost etcd quorum. Requires
+	// spec.etcdBackup, whose bucket and credentials are used for the download.
+	//
+	// Setting a location the controller has not restored yet starts a
+	// restore: every control-plane machine is deleted without the etcd quorum
+	// guard, a new init machine restores the snapshot before the distribution
+	// starts, and the remaining members rejoin it through the usual joiner
+	// gate. Progress is reported in status.etcdRestore and the EtcdRestore
+	// condition. Remove the block once the restore has completed.
+	// +optional
+	EtcdRestore *EtcdRestore `json:"etcdRestore,omitempty"`
+
+	// CNI selects the workload cluster's network plugin. When unset, or with
+	// provider "default", each distribution installs its own (k0s kube-router,
+	// k3s flannel, rke2 canal).
+	//
+	// The selection is rendered into every control-plane node's bootstrap
+	// data: the distribution settings that turn off the default plugin, and
+	// on k0s and k3s a Helm chart resource delivered through the
+	// distribution's manifests directory; rke2 installs the selected plugin
+	// from its own bundled charts. It cannot be changed once the control
+	// plane is initialized.
+	// +optional
+	CNI *CNI `json:"cni,omitempty"`
+
+	// WorkerToken configures the worker join token the control plane keeps in
+	// the <cluster>-worker-token Secret. Worker KairosConfigs that set no
+	// token of their own join with it. On k0s the init node mints the first
+	// token (`k0s token create --role=worker`) and pushes it over the
+	// node-push channel; on k3s the controller generates it once the control
+	// plane is initialized. Either way the controller then replaces it every
+	// rotation interval with a new bootstrap token in the workload cluster.
+	// rke2 workers still need an explicit token.
+	// +optional
+	WorkerToken *WorkerToken `json:"workerToken,omitempty"`
+
+	// Hosted runs the control plane as pods in the management cluster instead
+	// of on Kairos machines: a k0s controller with its etcd in a StatefulSet,
+	// exposed by a Service. The controller writes the kubeconfig Secret
+	// itself, and only workers are Kairos machines; they join with the worker
+	// token in the <cluster>-worker-token Secret.
+	//
+	// Hosted control planes run k0s with a single replica. spec.machineTemplate,
+	// spec.kairosConfigTemplate and the machine-only blocks (ha, sshFallback,
+	// etcdBackup, etcdRestore, rolloutStrategy, rolloutBefore) do not apply.
+	// The mode cannot be switched on or off after creation.
+	// +optional
+	Hosted *HostedControlPlane `json:"hosted,omitempty"`
+
+	// ControlPlaneEndpoint is the hosted control plane's API server endpoint,
+	// set by the controller from the Service address. CAPI core copies it
+	// into Cluster.Spec.ControlPlaneEndpoint once the control plane is ready.
+	// Unused for machine-based control planes, whose endpoint comes from the
+	// infrastructure provider.
+	// +optional
+	ControlPlaneEndpoint clusterv1.APIEndpoint `json:"controlPlaneEndpoint,omitempty"`
+}
+
+// HostedControlPlane configures a control plane that runs as pods in the
+// management cluster. See KairosControlPlaneSpec.Hosted.
+type HostedControlPlane struct {
+	// Image is the k0s image the controller pod runs. Defaults to
+	// quay.io/k0sproject/k0s tagged with spec.version, which then must be a
+	// full k0s release such as v1.34.1+k0s.0.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Service configures the Service that exposes the API server, the k0s
+	// join API and konnectivity to the workers.
+	// +optional
+	Service HostedControlPlaneService `json:"service,omitempty"`
+
+	// Persistence configures the volume holding the k0s data directory (etcd
+	// data and PKI).
+	// +optional
+	Persistence HostedControlPlanePersistence `json:"persistence,omitempty"`
+}
+
+// DefaultHostedImageRepository is the k0s image repository a hosted control
+// plane runs when spec.hosted.image is unset.
+const DefaultHostedImageRepository = "quay.io/k0sproject/k0s"
+
+// HostedImage returns the k0s image of a hosted control plane: spec.hosted.image,
+// or DefaultHostedImageRepository tagged with spec.version ('+' becomes '-',
+// as in the upstream tags). It returns "" when spec.version is not a full k0s
+// release and no image is set.
+func HostedImage(spec *KairosControlPlaneSpec) string {
+	if spec.Hosted != nil && spec.Hosted.Image != "" {
+		return spec.Hosted.Image
+	}
+	if !strings.Contains(spec.Version, "+k0s.") {
+		return ""
+	}
+	return DefaultHostedImageRepository + ":" + strings.Replace(spec.Version, "+", "-", 1)
+}
+
+// HostedControlPlaneService configures the hosted control plane's Service.
+type HostedControlPlaneService struct {
+	// Type is the Service type. With LoadBalancer the first ingress address
+	// becomes the endpoint; with ClusterIP the cluster IP does, which only
+	// workers routed into the management cluster's service network reach.
+	// +kubebuilder:validation:Enum=LoadBalancer;ClusterIP
+	// +kubebuilder:default=LoadBalancer
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Annotations are added to the Service, e.g. to pick a load-balancer
+	// address pool.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// HostedControlPlanePersistence configures the hosted control plane's data
+// volume.
+type HostedControlPlanePersistence struct {
+	// Size is the requested size of the data volume. Defaults to 10Gi.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// StorageClassName is the StorageClass of the data volume. Empty uses the
+	// management cluster's default StorageClass.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+}
+
+// CNIProvider selects the cluster network plugin.
+// +kubebuilder:validation:Enum=default;calico;cilium;none
+type CNIProvider string
+
+const (
+	// CNIProviderDefault keeps the distribution's bundled plugin: kube-router
+	// on k0s, flannel on k3s, canal on rke2.
+	CNIProviderDefault CNIProvider = "default"
+
+	// CNIProviderCalico installs Calico: k0s's built-in Calico, the
+	// tigera-operator chart on k3s, or rke2's bundled Calico.
+	CNIProviderCalico CNIProvider = "calico"
+
+	// CNIProviderCilium installs the Cilium chart.
+	CNIProviderCilium CNIProvider = "cilium"
+
+	// CNIProviderNone turns off the bundled plugin and installs nothing, for
+	// a bring-your-own CNI. Nodes stay NotReady until one is installed.
+	CNIProviderNone CNIProvider = "none"
+)
+
+// CNI configures the workload cluster's network plugin.
+type CNI struct {
+	// Provider is the network plugin to install.
+	// +kubebuilder:default=default
+	// +optional
+	Provider CNIProvider `json:"provider,omitempty"`
+}
+
+// WorkerToken configures the per-cluster worker join token. See
+// KairosControlPlaneSpec.WorkerToken.
+type WorkerToken struct {
+	// RotationInterval is how often the controller replaces the token. Each
+	// token the controller mints stays valid for twice the interval, so a
+	// machine whose bootstrap data still carries the previous token can join
+	// for one more interval. Defaults to 24h; must be at least 1h.
+	// +optional
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"`
+}
+
+const (
+	// DefaultWorkerTokenRotationInterval applies when
+	// spec.workerToken.rotationInterval is unset.
+	DefaultWorkerTokenRotationInterval = 24 * time.Hour
+
+	// MinWorkerTokenRotationInterval is the shortest rotation interval the
+	// webhook accepts.
+	MinWorkerTokenRotationInterval = time.Hour
+)
+
+// WorkerTokenRotationInterval returns spec.workerToken.rotationInterval, or
+// DefaultWorkerTokenRotationInterval when it is unset.
+func WorkerTokenRotationInterval(spec *KairosControlPlaneSpec) time.Duration {
+	if spec.WorkerToken == nil || spec.WorkerToken.RotationInterval == nil {
+		return DefaultWorkerTokenRotationInterval
+	}
+	return spec.WorkerToken.RotationInterval.Duration
+}
+
+// EtcdBackup configures scheduled etcd snapshots for a control plane.
+// See KairosControlPlaneSpec.EtcdBackup.
+type EtcdBackup struct {
+	// Schedule is a systemd OnCalendar expression (e.g. "daily", "hourly",
+	// "*-*-* 02,14:00:00"). Each node adds up to five minutes of random
+	// delay so the members do not snapshot at the same instant.
+	// +kubebuilder:default=daily
+	// +kubebuilder:validation:MaxLength=64
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9*:/,.~ -]+$`
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Retention is the number of snapshots each node keeps, both locally and
+	// in the bucket. Older snapshots are deleted after a successful upload.
+	// +kubebuilder:default=7
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	Retention *int32 `json:"retention,omitempty"`
+
+	// S3 is the S3-compatible upload target.
+	S3 EtcdBackupS3 `json:"s3"`
+}
+
+// EtcdBackupS3 is an S3-compatible bucket (AWS S3, MinIO, Ceph RGW, ...).
+// Objects are addressed path-style: <endpoint>/<bucket>/<prefix>/<node>/<name>.
+type EtcdBackupS3 struct {
+	// Endpoint is the base URL of the S3 API, e.g. "https://s3.eu-west-1.amazonaws.com"
+	// or "http://minio.backup.svc:9000". It must not carry credentials, a
+	// path, or a query. TLS is verified against the node's system trust store.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	Endpoint string `json:"endpoint"`
+
+	// Bucket is the bucket name. The bucket must already exist.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`
+	Bucket string `json:"bucket"`
+
+	// Prefix is an optional key prefix inside the bucket (e.g. "clusters/prod").
+	// +kubebuilder:validation:MaxLength=256
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9._/-]*$`
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// Region is the signing region. MinIO and most other S3-compatible stores
+	// accept the default.
+	// +kubebuilder:default=us-east-1
+	// +kubebuilder:validation:Pattern=`^[a-z0-9-]+$`
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// CredentialsSecretRef references a Secret in the KairosControlPlane's
+	// namespace holding the keys "accessKeyID" and "secretAccessKey".
+	// +kubebuilder:validation:Required
+	CredentialsSecretRef EtcdBackupCredentialsReference `json:"credentialsSecretRef"`
+}
+
+// EtcdBackupCredentialsReference names the Secret holding S3 credentials.
+type EtcdBackupCredentialsReference struct {
+	// Name of the Secret.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// EtcdRestore names the etcd snapshot to rebuild the control plane from.
+// See KairosControlPlaneSpec.EtcdRestore.
+type EtcdRestore struct {
+	// Location is the object URL of the snapshot, as reported in
+	// status.lastEtcdSnapshot.location. It must lie in the
+	// spec.etcdBackup.s3 bucket:
+	// <endpoint>/<bucket>/<key>.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=1024
+	Location string `json:"location"`
 }
 
 // SSHFallback configures the opt-in SSH-pull fallback for the
@@ -233,16 +546,83 @@ type KairosConfigTemplateReference struct {
 
 // RolloutStrategy defines the strategy for rolling out updates
 type RolloutStrategy struct {
-	// Type is the type of rollout strategy
-	// +kubebuilder:validation:Enum=RollingUpdate
+	// Type is the type of rollout strategy.
+	// RollingUpdate replaces outdated machines with new ones. InPlace upgrades
+	// the Kairos image of each control-plane node through its A/B partitions,
+	// one node at a time, without reprovisioning.
+	// +kubebuilder:validation:Enum=RollingUpdate;InPlace
 	// +kubebuilder:default=RollingUpdate
 	Type string `json:"type,omitempty"`
 
 	// RollingUpdate defines the rolling update configuration
 	// +optional
 	RollingUpdate *RollingUpdate `json:"rollingUpdate,omitempty"`
+
+	// InPlace defines the in-place upgrade configuration. Required when Type
+	// is InPlace.
+	// +optional
+	InPlace *InPlaceUpgrade `json:"inPlace,omitempty"`
+}
+
+// RolloutBefore configures rollouts that are triggered ahead of an event
+// rather than by a spec change.
+type RolloutBefore struct {
+	// CertificatesExpiryDays rolls out a control-plane machine once one of
+	// its certificates, or the kubeconfig client certificate, expires within
+	// this many days. The replacement issues fresh certificates and pushes a
+	// new kubeconfig. Machines are replaced one at a time through
+	// spec.rolloutStrategy. Must be at least 7.
+	// +optional
+	// +kubebuilder:validation:Minimum=7
+	CertificatesExpiryDays *int32 `json:"certificatesExpiryDays,omitempty"`
+}
+
+// MinCertificatesExpiryDays is the smallest
+// spec.rolloutBefore.certificatesExpiryDays the webhook accepts.
+const MinCertificatesExpiryDays = 7
+
+// DefaultCertificatesExpiringSoonDays is the window in which the
+// CertificatesExpiringSoon condition warns when spec.rolloutBefore does not
+// set a larger one.
+const DefaultCertificatesExpiringSoonDays = 30
+
+const (
+	// RollingUpdateStrategyType replaces outdated machines with new ones.
+	RollingUpdateStrategyType = "RollingUpdate"
+
+	// InPlaceStrategyType upgrades outdated machines through their Kairos A/B
+	// partitions.
+	InPlaceStrategyType = "InPlace"
+)
+
+// InPlaceUpgrade configures in-place Kairos A/B upgrades of control-plane
+// nodes. The upgrade is driven through a kairos-operator NodeOpUpgrade in the
+// workload cluster, so the kairos-operator must be installed there.
+//
+// A machine is upgraded in place when its Kubernetes version differs from
+// spec.version. Changes to the KairosConfigTemplate or the infrastructure
+// template cannot be delivered by an image upgrade and still replace the
+// machine.
+type InPlaceUpgrade struct {
+	// Image is the Kairos OCI image to upgrade to. It must carry the
+	// distribution release matching spec.version.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=512
+	Image string `json:"image"`
+
+	// Namespace is the workload-cluster namespace the NodeOp and
+	// NodeOpUpgrade objects are created in. It must be a namespace the
+	// kairos-operator watches.
+	// +kubebuilder:default=default
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
+// DefaultInPlaceUpgradeNamespace applies when spec.rolloutStrategy.inPlace.namespace
+// is unset.
+const DefaultInPlaceUpgradeNamespace = "default"
+
 // RollingUpdate defines the rolling update configuration
 type RollingUpdate struct {
 	// MaxSurge is the maximum number of machines that can be created above the
@@ -251,6 +631,29 @@ type RollingUpdate struct {
 	MaxSurge *int32 `json:"maxSurge,omitempty"`
 }
 
+// RemediationStrategy tunes the remediation of unhealthy control-plane
+// Machines. See KairosControlPlaneSpec.RemediationStrategy.
+type RemediationStrategy struct {
+	// MaxRetry is the maximum number of times a replacement Machine is
+	// remediated again when it also turns unhealthy within MinHealthyPeriod.
+	// Once reached, the Machine is left for the operator. Unlimited when
+	// unset.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxRetry *int32 `json:"maxRetry,omitempty"`
+
+	// RetryPeriod is how long to wait after a remediation before the
+	// replacement Machine may itself be remediated. Defaults to 0.
+	// +optional
+	RetryPeriod metav1.Duration `json:"retryPeriod,omitempty"`
+
+	// MinHealthyPeriod is how long a replacement Machine must stay healthy
+	// before its next remediation counts as a new failure instead of a retry.
+	// Defaults to 1h.
+	// +optional
+	MinHealthyPeriod *metav1.Duration `json:"minHealthyPeriod,omitempty"`
+}
+
 // HAConfig configures high-availability behaviour for a KairosControlPlane
 // with spec.replicas > 1.
 type HAConfig struct {
@@ -341,6 +744,12 @@ type KairosControlPlaneStatus struct {
 	// +optional
 	Initialization KairosControlPlaneInitializationStatus `json:"initialization,omitempty,omitzero"`
 
+	// Ready is true while a hosted control plane's pods are serving. CAPI
+	// core waits for it before copying spec.controlPlaneEndpoint into the
+	// Cluster. Only set in hosted mode.
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
 	// ReadyReplicas is the number of control plane machines that are ready
 	// Contract: ControlPlane MUST expose readyReplicas
 	// A machine is considered ready when it has a NodeRef and the Node is ready.
@@ -405,6 +814,49 @@ type KairosControlPlaneStatus struct {
 	// +optional
 	Selector string `json:"selector,omitempty"`
 
+	// FailureDomains is the number of control-plane machines in each failure
+	// domain. Every control-plane-eligible domain reported on the Cluster is
+	// listed, including empty ones, plus any other domain a machine still
+	// occupies. Machines being deleted are not counted. Empty when the
+	// infrastructure reports no failure domains.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	FailureDomains []FailureDomainReplicas `json:"failureDomains,omitempty"`
+
+	// InPlaceUpgrades reports per-machine progress of the current InPlace
+	// rollout. Entries are kept after they succeed so the rollout can be
+	// followed to the end, and are cleared when a rollout to a different
+	// image starts.
+	// +optional
+	// +listType=map
+	// +listMapKey=machineName
+	InPlaceUpgrades []MachineInPlaceUpgrade `json:"inPlaceUpgrades,omitempty"`
+
+	// LastEtcdSnapshot is the newest successful etcd snapshot reported by any
+	// current control-plane node. Nil until the first snapshot succeeds or
+	// when spec.etcdBackup is unset.
+	// +optional
+	LastEtcdSnapshot *EtcdSnapshot `json:"lastEtcdSnapshot,omitempty"`
+
+	// EtcdRestore reports the progress of the restore requested by
+	// spec.etcdRestore. Kept after completion so the same location is not
+	// restored twice; cleared when spec.etcdRestore is removed.
+	// +optional
+	EtcdRestore *EtcdRestoreStatus `json:"etcdRestore,omitempty"`
+
+	// EarliestCertificateExpiry is the certificate that expires first among
+	// those reported by the current control-plane nodes and the kubeconfig
+	// client certificate. Nil until a node has reported. In hosted mode it is
+	// the kubeconfig client certificate.
+	// +optional
+	EarliestCertificateExpiry *CertificateExpiry `json:"earliestCertificateExpiry,omitempty"`
+
+	// LastRemediation is the most recent remediation of an unhealthy
+	// control-plane Machine, as recorded on the Machine that replaced it.
+	// +optional
+	LastRemediation *LastRemediationStatus `json:"lastRemediation,omitempty"`
+
 	// LastNodePushObserved is the timestamp at which the controlplane
 	// reconciler first observed that the workload-cluster kubeconfig Secret
 	// was missing for this KairosControlPlane on the node-push path (KD-3b).
@@ -417,6 +869,154 @@ type KairosControlPlaneStatus struct {
 	LastNodePushObserved *metav1.Time `json:"lastNodePushObserved,omitempty"`
 }
 
+// LastRemediationStatus describes one remediation of an unhealthy
+// control-plane Machine.
+type LastRemediationStatus struct {
+	// Machine is the name of the remediated Machine.
+	Machine string `json:"machine"`
+
+	// Timestamp is when the remediation started.
+	Timestamp metav1.Time `json:"timestamp"`
+
+	// RetryCount is the number of consecutive remediations of replacement
+	// Machines that turned unhealthy within MinHealthyPeriod; 0 for a first
+	// remediation.
+	RetryCount int32 `json:"retryCount"`
+}
+
+// FailureDomainReplicas is the control-plane machine count of one failure domain.
+type FailureDomainReplicas struct {
+	// Name is the failure domain name as reported in Cluster.Status.FailureDomains.
+	Name string `json:"name"`
+
+	// Replicas is the number of control-plane machines in this failure domain.
+	Replicas int32 `json:"replicas"`
+}
+
+// InPlaceUpgradePhase is the progress of one machine's in-place upgrade.
+// +kubebuilder:validation:Enum=Pending;Upgrading;Succeeded;Failed
+type InPlaceUpgradePhase string
+
+const (
+	// InPlaceUpgradePending means the machine waits for its turn or for the
+	// etcd quorum gate.
+	InPlaceUpgradePending InPlaceUpgradePhase = "Pending"
+
+	// InPlaceUpgradeUpgrading means the NodeOpUpgrade for the machine's node
+	// is running or the node is rebooting into the new image.
+	InPlaceUpgradeUpgrading InPlaceUpgradePhase = "Upgrading"
+
+	// InPlaceUpgradeSucceeded means the node runs spec.version from the new
+	// image.
+	InPlaceUpgradeSucceeded InPlaceUpgradePhase = "Succeeded"
+
+	// InPlaceUpgradeFailed means the NodeOpUpgrade failed. The rollout stops
+	// until the image is changed or the machine is replaced.
+	InPlaceUpgradeFailed InPlaceUpgradePhase = "Failed"
+)
+
+// MachineInPlaceUpgrade is the in-place upgrade progress of one
+// control-plane machine.
+type MachineInPlaceUpgrade struct {
+	// MachineName is the name of the control-plane Machine.
+	MachineName string `json:"machineName"`
+
+	// NodeName is the workload-cluster Node backing the machine.
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+
+	// Image is the Kairos image the machine is being upgraded to.
+	Image string `json:"image"`
+
+	// Phase is the upgrade progress.
+	Phase InPlaceUpgradePhase `json:"phase"`
+
+	// Message is a human-readable detail for the current phase.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// LastTransitionTime is when Phase last changed.
+	// +optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// EtcdSnapshot describes one uploaded etcd snapshot.
+type EtcdSnapshot struct {
+	// Name is the snapshot file name.
+	Name string `json:"name"`
+
+	// NodeName is the control-plane node that took the snapshot.
+	NodeName string `json:"nodeName"`
+
+	// Location is the object URL the snapshot was uploaded to.
+	Location string `json:"location"`
+
+	// SizeBytes is the snapshot size.
+	SizeBytes int64 `json:"sizeBytes"`
+
+	// Time is when the snapshot was taken.
+	Time metav1.Time `json:"time"`
+}
+
+// CertificateExpiry identifies one certificate and when it expires.
+type CertificateExpiry struct {
+	// Name is the certificate file, relative to the distribution's PKI
+	// directory, or "kubeconfig" for the client certificate of the
+	// kubeconfig Secret.
+	Name string `json:"name"`
+
+	// NodeName is the control-plane node holding the certificate. Empty for
+	// the kubeconfig client certificate.
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+
+	// NotAfter is when the certificate expires.
+	NotAfter metav1.Time `json:"notAfter"`
+}
+
+// EtcdRestorePhase is the progress of an etcd restore.
+// +kubebuilder:validation:Enum=DeletingMachines;RestoringSnapshot;JoiningMembers;Completed
+type EtcdRestorePhase string
+
+const (
+	// EtcdRestoreDeletingMachines means the existing control-plane machines
+	// are being deleted.
+	EtcdRestoreDeletingMachines EtcdRestorePhase = "DeletingMachines"
+
+	// EtcdRestoreRestoringSnapshot means the new init machine is downloading
+	// and restoring the snapshot, and has not yet come up as a joinable
+	// etcd member.
+	EtcdRestoreRestoringSnapshot EtcdRestorePhase = "RestoringSnapshot"
+
+	// EtcdRestoreJoiningMembers means the restored init machine is up and
+	// the remaining members are joining it.
+	EtcdRestoreJoiningMembers EtcdRestorePhase = "JoiningMembers"
+
+	// EtcdRestoreCompleted means every desired control-plane machine has
+	// registered its Node against the restored cluster.
+	EtcdRestoreCompleted EtcdRestorePhase = "Completed"
+)
+
+// EtcdRestoreStatus is the progress of an etcd restore.
+type EtcdRestoreStatus struct {
+	// Location is the snapshot being restored.
+	Location string `json:"location"`
+
+	// Phase is the restore progress.
+	Phase EtcdRestorePhase `json:"phase"`
+
+	// Message is a human-readable detail for the current phase.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// StartedAt is when the restore started.
+	StartedAt metav1.Time `json:"startedAt"`
+
+	// CompletedAt is when the restore completed.
+	// +optional
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+}
+
 // KairosControlPlaneInitializationStatus provides observations of the control plane initialization process.
 // +kubebuilder:validation:MinProperties=1
 type KairosControlPlaneInitializationStatus struct {
@@ -17,8 +17,11 @@ permissions and limitations under the License.
 package v1beta2
 
 import (
+	"fmt"
 	"net"
+	"net/url"
 	"regexp"
+	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -45,6 +48,24 @@ var sshFallbackUserRegex = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
 // webhook adds a second line of defense for older API servers.
 var vipInterfaceRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9._-]{0,14}$`)
 
+// inPlaceImageRe matches an OCI image reference: registry/repository with an
+// optional :tag and/or @digest. It is deliberately a shape check, not a full
+// reference grammar.
+var inPlaceImageRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]*[a-z0-9])?(:[0-9]+)?(/[a-z0-9]([a-z0-9._-]*[a-z0-9])?)*(:[A-Za-z0-9_][A-Za-z0-9._-]{0,127})?(@sha256:[a-f0-9]{64})?$`)
+
+// etcdBackupScheduleRe, etcdBackupBucketRe, etcdBackupPrefixRe and
+// etcdBackupRegionRe mirror the kubebuilder markers on EtcdBackup and
+// EtcdBackupS3. The values are rendered into a systemd unit and a shell env
+// file on every control-plane node. etcdRestoreKeyRe is the object key part
+// of EtcdRestore.Location.
+var (
+	etcdBackupScheduleRe = regexp.MustCompile(`^[A-Za-z0-9*:/,.~ -]+$`)
+	etcdBackupBucketRe   = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	etcdBackupPrefixRe   = regexp.MustCompile(`^[A-Za-z0-9._/-]*$`)
+	etcdBackupRegionRe   = regexp.MustCompile(`^[a-z0-9-]+$`)
+	etcdRestoreKeyRe     = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+)
+
 // log is for logging in this package.
 var kairoscontrolplaneLog = logf.Log.WithName("kairoscontrolplane-resource")
 
@@ -116,23 +137,68 @@ func (r *KairosControlPlane) ValidateCreate() (admission.Warnings, error) {
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *KairosControlPlane) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
 	kairoscontrolplaneLog.Info("validate update", "name", r.Name)
+	if oldKCP, ok := old.(*KairosControlPlane); ok {
+		allErrs := validateCNIUpdate(oldKCP, r)
+		allErrs = append(allErrs, validateHostedUpdate(oldKCP, r)...)
+		if len(allErrs) > 0 {
+			return nil, errors.NewInvalid(
+				schema.GroupKind{Group: GroupVersion.Group, Kind: "KairosControlPlane"},
+				r.Name,
+				allErrs,
+			)
+		}
+	}
 	return r.validateWithWarnings()
 }
 
+// cniProvider returns the effective CNI provider; an unset block or provider
+// is the distribution default.
+func cniProvider(c *CNI) CNIProvider {
+	if c == nil || c.Provider == "" {
+		return CNIProviderDefault
+	}
+	return c.Provider
+}
+
+// validateCNIUpdate rejects a CNI change once the control plane is
+// initialized. The running nodes already carry the old plugin, and the
+// selection only reaches machines created afterwards, so switching would
+// leave the cluster with two network plugins.
+func validateCNIUpdate(oldKCP, newKCP *KairosControlPlane) field.ErrorList {
+	initialized := oldKCP.Status.Initialized ||
+		(oldKCP.Status.Initialization.ControlPlaneInitialized != nil && *oldKCP.Status.Initialization.ControlPlaneInitialized)
+	from, to := cniProvider(oldKCP.Spec.CNI), cniProvider(newKCP.Spec.CNI)
+	if !initialized || from == to {
+		return nil
+	}
+	return field.ErrorList{field.Forbidden(field.NewPath("spec", "cni", "provider"),
+		"the CNI cannot be changed from "+string(from)+" to "+string(to)+" once the control plane is initialized")}
+}
+
+// validateHostedUpdate rejects switching spec.hosted on or off. A hosted
+// control plane's etcd lives in the management cluster and a machine-based
+// one's on its machines; neither can be handed over to the other.
+func validateHostedUpdate(oldKCP, newKCP *KairosControlPlane) field.ErrorList {
+	if (oldKCP.Spec.Hosted == nil) == (newKCP.Spec.Hosted == nil) {
+		return nil
+	}
+	return field.ErrorList{field.Forbidden(field.NewPath("spec", "hosted"),
+		"hosted mode cannot be switched on or off after creation")}
+}
+
 // validateWithWarnings runs validate() and also collects non-blocking warnings.
 func (r *KairosControlPlane) validateWithWarnings() (admission.Warnings, error) {
 	var warnings admission.Warnings
 
-	// Warn (but do not reject) when a VIP block is set on a single-node
-	// control plane. The VIP configuration will be silently ignored by the
-	// controller until replicas is increased to 3 or 5, so surfacing this as a
-	// warning lets operators catch configuration drift early.
-	if r.Spec.HA != nil && r.Spec.HA.VIP != nil &&
-		r.Spec.Replicas != nil && *r.Spec.Replicas == 1 {
+	// Warn when a restore is requested: it deletes every control-plane
+	// machine, bypassing the etcd quorum guard, before rebuilding from the
+	// snapshot.
+	if r.Spec.EtcdRestore != nil &&
+		(r.Status.EtcdRestore == nil || r.Status.EtcdRestore.Location != r.Spec.EtcdRestore.Location) {
 		warnings = append(warnings,
-			"spec.ha.vip is set but spec.replicas is 1: kube-vip is not "+
-				"rendered for single-node control planes. Remove spec.ha.vip "+
-				"or set spec.replicas to 3 or 5.",
+			"spec.etcdRestore is set: every control-plane machine will be "+
+				"deleted and the control plane rebuilt from "+r.Spec.EtcdRestore.Location+
+				". Changes made to the cluster after the snapshot are lost.",
 		)
 	}
 
@@ -190,16 +256,23 @@ func (r *KairosControlPlane) validate() error {
 	}
 
 	// Validate distribution
-	if r.Spec.Distribution != "" && r.Spec.Distribution != "k0s" && r.Spec.Distribution != "k3s" {
+	if r.Spec.Distribution != "" && r.Spec.Distribution != "k0s" && r.Spec.Distribution != "k3s" && r.Spec.Distribution != "rke2" {
 		allErrs = append(allErrs, field.Invalid(
 			field.NewPath("spec", "distribution"),
 			r.Spec.Distribution,
-			"spec.distribution must be one of [k0s, k3s]",
+			"spec.distribution must be one of [k0s, k3s, rke2]",
 		))
 	}
 
+	allErrs = append(allErrs, validateHosted(&r.Spec, field.NewPath("spec"))...)
 	allErrs = append(allErrs, validateHA(r.Spec.HA, field.NewPath("spec", "ha"))...)
+	allErrs = append(allErrs, validateWorkerToken(&r.Spec, field.NewPath("spec"))...)
+	allErrs = append(allErrs, validateRolloutStrategy(r.Spec.RolloutStrategy, field.NewPath("spec", "rolloutStrategy"))...)
+	allErrs = append(allErrs, validateRolloutBefore(r.Spec.RolloutBefore, field.NewPath("spec", "rolloutBefore"))...)
+	allErrs = append(allErrs, validateRemediationStrategy(r.Spec.RemediationStrategy, field.NewPath("spec", "remediationStrategy"))...)
 	allErrs = append(allErrs, validateSSHFallback(r.Spec.SSHFallback, r.Namespace, field.NewPath("spec", "sshFallback"))...)
+	allErrs = append(allErrs, validateEtcdBackup(r.Spec.EtcdBackup, field.NewPath("spec", "etcdBackup"))...)
+	allErrs = append(allErrs, validateEtcdRestore(r.Spec.EtcdRestore, r.Spec.EtcdBackup, field.NewPath("spec", "etcdRestore"))...)
 
 	if len(allErrs) > 0 {
 		return errors.NewInvalid(
@@ -212,6 +285,87 @@ func (r *KairosControlPlane) validate() error {
 	return nil
 }
 
+// validateHosted checks the fields whose rules depend on spec.hosted. A
+// machine-based control plane needs an infrastructure template and a
+// KairosConfigTemplate. A hosted one runs a single k0s controller pod, so it
+// needs a k0s image and rejects the blocks that only machines act on.
+func validateHosted(s *KairosControlPlaneSpec, base *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if s.Hosted == nil {
+		if s.MachineTemplate.InfrastructureRef.Name == "" {
+			errs = append(errs, field.Required(base.Child("machineTemplate", "infrastructureRef"),
+				"an infrastructure machine template is required unless spec.hosted is set"))
+		}
+		if s.KairosConfigTemplate.Name == "" {
+			errs = append(errs, field.Required(base.Child("kairosConfigTemplate", "name"),
+				"a KairosConfigTemplate is required unless spec.hosted is set"))
+		}
+		return errs
+	}
+
+	hosted := base.Child("hosted")
+	if s.Distribution != "" && s.Distribution != "k0s" {
+		errs = append(errs, field.Invalid(base.Child("distribution"), s.Distribution,
+			"hosted control planes run k0s"))
+	}
+	if s.Replicas != nil && *s.Replicas != 1 {
+		errs = append(errs, field.Invalid(base.Child("replicas"), *s.Replicas,
+			"hosted control planes run a single replica"))
+	}
+	if HostedImage(s) == "" {
+		errs = append(errs, field.Required(hosted.Child("image"),
+			"an image is required when spec.version is not a full k0s release (e.g. \"v1.34.1+k0s.0\")"))
+	} else if s.Hosted.Image != "" && !inPlaceImageRe.MatchString(s.Hosted.Image) {
+		errs = append(errs, field.Invalid(hosted.Child("image"), s.Hosted.Image,
+			"hosted.image must be an OCI image reference (e.g. \"quay.io/k0sproject/k0s:v1.34.1-k0s.0\")"))
+	}
+	if s.Hosted.Persistence.Size != nil && s.Hosted.Persistence.Size.Sign() <= 0 {
+		errs = append(errs, field.Invalid(hosted.Child("persistence", "size"), s.Hosted.Persistence.Size.String(),
+			"persistence.size must be positive"))
+	}
+	if cniProvider(s.CNI) == CNIProviderCilium {
+		errs = append(errs, field.NotSupported(base.Child("cni", "provider"), s.CNI.Provider,
+			[]string{string(CNIProviderDefault), string(CNIProviderCalico), string(CNIProviderNone)}))
+	}
+
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"ha", s.HA != nil},
+		{"sshFallback", s.SSHFallback != nil},
+		{"etcdBackup", s.EtcdBackup != nil},
+		{"etcdRestore", s.EtcdRestore != nil},
+		{"rolloutStrategy", s.RolloutStrategy != nil},
+		{"rolloutBefore", s.RolloutBefore != nil},
+	} {
+		if f.set {
+			errs = append(errs, field.Forbidden(base.Child(f.name),
+				f.name+" applies to control-plane machines and is not supported with spec.hosted"))
+		}
+	}
+	return errs
+}
+
+// validateWorkerToken rejects a rotation interval below
+// MinWorkerTokenRotationInterval, and the block on rke2, whose worker tokens
+// the control plane does not manage.
+func validateWorkerToken(s *KairosControlPlaneSpec, base *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if s.WorkerToken == nil {
+		return errs
+	}
+	if s.Distribution == "rke2" {
+		errs = append(errs, field.Forbidden(base.Child("workerToken"),
+			"workerToken is not supported for rke2; rke2 workers set workerTokenSecretRef"))
+	}
+	if i := s.WorkerToken.RotationInterval; i != nil && i.Duration < MinWorkerTokenRotationInterval {
+		errs = append(errs, field.Invalid(base.Child("workerToken", "rotationInterval"), i.Duration.String(),
+			"rotationInterval must be at least "+MinWorkerTokenRotationInterval.String()))
+	}
+	return errs
+}
+
 // validateHA validates the optional HA configuration block. When ha is nil
 // (single-node or unset HA), it is a no-op. Shape validation of the VIP
 // address and interface name runs unconditionally when VIP is non-nil;
@@ -255,6 +409,143 @@ func validateHA(ha *HAConfig, base *field.Path) field.ErrorList {
 	return errs
 }
 
+// validateRolloutStrategy requires an image for InPlace rollouts and rejects
+// one for RollingUpdate, where it would be silently ignored. The image ends up
+// in a NodeOpUpgrade on the workload cluster, so it must look like an OCI
+// reference: no whitespace or control characters. The namespace must be a
+// valid namespace name.
+func validateRolloutStrategy(s *RolloutStrategy, base *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if s == nil {
+		return errs
+	}
+	if s.Type != InPlaceStrategyType {
+		if s.InPlace != nil {
+			errs = append(errs, field.Forbidden(base.Child("inPlace"),
+				"inPlace is only valid when rolloutStrategy.type is InPlace"))
+		}
+		return errs
+	}
+	if s.InPlace == nil || s.InPlace.Image == "" {
+		errs = append(errs, field.Required(base.Child("inPlace", "image"),
+			"an image is required when rolloutStrategy.type is InPlace"))
+		return errs
+	}
+	if !inPlaceImageRe.MatchString(s.InPlace.Image) {
+		errs = append(errs, field.Invalid(base.Child("inPlace", "image"), s.InPlace.Image,
+			"inPlace.image must be an OCI image reference (e.g. \"quay.io/kairos/ubuntu:24.04-standard-amd64-generic-v3.5.0-k0s-v1.34.1\")"))
+	}
+	if ns := s.InPlace.Namespace; ns != "" {
+		for _, msg := range validation.IsDNS1123Label(ns) {
+			errs = append(errs, field.Invalid(base.Child("inPlace", "namespace"), ns, msg))
+		}
+	}
+	return errs
+}
+
+// validateRolloutBefore rejects a certificate expiry window below
+// MinCertificatesExpiryDays: a replacement needs time to roll through every
+// machine before the certificates expire.
+func validateRolloutBefore(rb *RolloutBefore, base *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if rb == nil {
+		return errs
+	}
+	if d := rb.CertificatesExpiryDays; d != nil && *d < MinCertificatesExpiryDays {
+		errs = append(errs, field.Invalid(base.Child("certificatesExpiryDays"), *d,
+			fmt.Sprintf("certificatesExpiryDays must be at least %d", MinCertificatesExpiryDays)))
+	}
+	return errs
+}
+
+// validateRemediationStrategy rejects negative retry counts and periods; the
+// CRD marker covers maxRetry, durations have no schema-level bound.
+func validateRemediationStrategy(s *RemediationStrategy, base *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if s == nil {
+		return errs
+	}
+	if s.MaxRetry != nil && *s.MaxRetry < 0 {
+		errs = append(errs, field.Invalid(base.Child("maxRetry"), *s.MaxRetry,
+			"maxRetry must not be negative"))
+	}
+	if s.RetryPeriod.Duration < 0 {
+		errs = append(errs, field.Invalid(base.Child("retryPeriod"), s.RetryPeriod.Duration.String(),
+			"retryPeriod must not be negative"))
+	}
+	if s.MinHealthyPeriod != nil && s.MinHealthyPeriod.Duration < 0 {
+		errs = append(errs, field.Invalid(base.Child("minHealthyPeriod"), s.MinHealthyPeriod.Duration.String(),
+			"minHealthyPeriod must not be negative"))
+	}
+	return errs
+}
+
+// validateEtcdBackup re-checks the shapes the node-side backup unit relies on: an http(s) endpoint with no
+// credentials, path or query, an S3 bucket name, and a prefix that cannot
+// escape the bucket.
+func validateEtcdBackup(b *EtcdBackup, base *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if b == nil {
+		return errs
+	}
+	if b.Schedule != "" && (len(b.Schedule) > 64 || !etcdBackupScheduleRe.MatchString(b.Schedule)) {
+		errs = append(errs, field.Invalid(base.Child("schedule"), b.Schedule,
+			"schedule must be a systemd OnCalendar expression of at most 64 characters (e.g. \"daily\" or \"*-*-* 02:00:00\")"))
+	}
+	if b.Retention != nil && (*b.Retention < 1 || *b.Retention > 100) {
+		errs = append(errs, field.Invalid(base.Child("retention"), *b.Retention,
+			"retention must be between 1 and 100"))
+	}
+
+	s3 := base.Child("s3")
+	if u, err := url.Parse(b.S3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+		u.Host == "" || u.User != nil || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+		errs = append(errs, field.Invalid(s3.Child("endpoint"), b.S3.Endpoint,
+			"endpoint must be an http(s) URL with a host and no credentials, path, or query (e.g. \"https://minio.example.com:9000\")"))
+	}
+	if !etcdBackupBucketRe.MatchString(b.S3.Bucket) {
+		errs = append(errs, field.Invalid(s3.Child("bucket"), b.S3.Bucket,
+			"bucket must be a valid S3 bucket name: 3-63 lowercase letters, digits, '.' or '-'"))
+	}
+	if !etcdBackupPrefixRe.MatchString(b.S3.Prefix) || strings.HasPrefix(b.S3.Prefix, "/") ||
+		strings.Contains("/"+b.S3.Prefix+"/", "/../") {
+		errs = append(errs, field.Invalid(s3.Child("prefix"), b.S3.Prefix,
+			"prefix must be a relative key prefix of letters, digits, '.', '_', '-' or '/' without '..' segments"))
+	}
+	if b.S3.Region != "" && !etcdBackupRegionRe.MatchString(b.S3.Region) {
+		errs = append(errs, field.Invalid(s3.Child("region"), b.S3.Region,
+			"region must contain only lowercase letters, digits, and '-'"))
+	}
+	if b.S3.CredentialsSecretRef.Name == "" {
+		errs = append(errs, field.Required(s3.Child("credentialsSecretRef", "name"),
+			"a Secret with accessKeyID and secretAccessKey is required"))
+	}
+	return errs
+}
+
+// validateEtcdRestore requires spec.etcdBackup, whose bucket and credentials
+// the restoring node downloads with, and a snapshot location inside that
+// bucket: <endpoint>/<bucket>/<key> with a key that cannot escape it.
+func validateEtcdRestore(rs *EtcdRestore, b *EtcdBackup, base *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if rs == nil {
+		return errs
+	}
+	if b == nil {
+		errs = append(errs, field.Required(field.NewPath("spec", "etcdBackup"),
+			"etcdRestore downloads the snapshot with the etcdBackup S3 settings"))
+		return errs
+	}
+	bucketURL := strings.TrimSuffix(b.S3.Endpoint, "/") + "/" + b.S3.Bucket + "/"
+	key, ok := strings.CutPrefix(rs.Location, bucketURL)
+	if !ok || !etcdRestoreKeyRe.MatchString(key) || strings.HasSuffix(key, "/") ||
+		strings.Contains("/"+key+"/", "/../") {
+		errs = append(errs, field.Invalid(base.Child("location"), rs.Location,
+			"location must be a snapshot object URL in the etcdBackup bucket ("+bucketURL+"<key>), as reported in status.lastEtcdSnapshot.location"))
+	}
+	return errs
+}
+
 // validateSSHFallback enforces the cross-field invariants of the opt-in
 // SSH fallback block. Designed to be called from any webhook that admits
 // a KairosControlPlaneSpec (currently only the KCP webhook itself; the
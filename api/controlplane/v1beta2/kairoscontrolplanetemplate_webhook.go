@@ -137,17 +137,26 @@ func (r *KairosControlPlaneTemplate) validate() error {
 	}
 
 	// Distribution: same enum as KCP.
-	if s.Distribution != "" && s.Distribution != "k0s" && s.Distribution != "k3s" {
+	if s.Distribution != "" && s.Distribution != "k0s" && s.Distribution != "k3s" && s.Distribution != "rke2" {
 		allErrs = append(allErrs, field.Invalid(
 			base.Child("distribution"),
 			s.Distribution,
-			"spec.template.spec.distribution must be one of [k0s, k3s]",
+			"spec.template.spec.distribution must be one of [k0s, k3s, rke2]",
 		))
 	}
 
+	// Hosted mode and the machine template: shared helper with KCP.
+	allErrs = append(allErrs, validateHosted(s, base)...)
+
 	// HA: shared helper with KCP.
 	allErrs = append(allErrs, validateHA(s.HA, base.Child("ha"))...)
 
+	// Worker token rotation: shared helper with KCP.
+	allErrs = append(allErrs, validateWorkerToken(s, base)...)
+
+	// Certificate expiry rollout window: shared helper with KCP.
+	allErrs = append(allErrs, validateRolloutBefore(s.RolloutBefore, base.Child("rolloutBefore"))...)
+
 	// SSHFallback: shared helper with KCP. The helper takes the owner
 	// namespace because cross-namespace Secret refs are rejected and
 	// the template's namespace is the same one a stamped KCP would
@@ -112,7 +112,8 @@ func TestKairosControlPlaneTemplate_Validate_Distribution(t *testing.T) {
 		{"empty-valid", "", ""},
 		{"k0s-valid", "k0s", ""},
 		{"k3s-valid", "k3s", ""},
-		{"unknown-rejected", "kthreesomething", "must be one of [k0s, k3s]"},
+		{"rke2-valid", "rke2", ""},
+		{"unknown-rejected", "kthreesomething", "must be one of [k0s, k3s, rke2]"},
 	}
 	for _, tc := range cases {
 		tc := tc
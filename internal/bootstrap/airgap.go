@@ -0,0 +1,351 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// AirgapBundleConfig is the render-ready view of one
+// KairosConfig.Spec.AirgapImages entry. Exactly one of Image/Path/URL is set.
+//
+// Every field lands in the airgap env file as a shquote'd shell assignment
+// (see airgapImagesEnv) and is re-validated at render time by
+// validateAirgapImages.
+type AirgapBundleConfig struct {
+	// Image is an OCI image reference unpacked with `luet util unpack`; every
+	// bundle file found in it is imported.
+	Image string
+	// Path is an absolute path to a bundle file already on the node.
+	Path string
+	// URL is an http(s) URL of a bundle file.
+	URL string
+	// SHA256 is the expected hex digest of a Path or URL bundle (optional).
+	SHA256 string
+}
+
+// airgapImagesDirs are the directories each distribution imports image
+// bundles from when its containerd starts (default data directories).
+var airgapImagesDirs = map[string]string{
+	"k0s":  "/var/lib/k0s/images",
+	"k3s":  "/var/lib/rancher/k3s/agent/images",
+	"rke2": "/var/lib/rancher/rke2/agent/images",
+}
+
+// k3sAirgapExts are the archive extensions k3s and rke2 import. k0s imports
+// only uncompressed ".tar" bundles.
+var k3sAirgapExts = []string{".tar", ".tar.gz", ".tgz", ".tar.zst", ".tzst", ".tar.bz2", ".tbz", ".tar.lz4"}
+
+// airgapBundleExt returns the extension of name that distribution imports, or
+// "" when it imports none.
+func airgapBundleExt(distribution, name string) string {
+	exts := []string{".tar"}
+	if distribution == "k3s" || distribution == "rke2" {
+		exts = k3sAirgapExts
+	}
+	for _, ext := range exts {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// airgapImagesScript is the node-side preload. It runs as an ExecStartPre of
+// the distribution service, after the version gate, and:
+//
+//  1. reads the distribution, its image import directory and the bundle list
+//     from the env file written next to it;
+//  2. places every bundle in the import directory: a URL is downloaded once
+//     (kept across reboots, since the directory is persistent), a Path is
+//     bind-mounted so a large file baked into the image is never copied, and
+//     an Image is unpacked with luet and its bundle files moved in;
+//  3. verifies the optional SHA256 of Path and URL bundles;
+//  4. records the outcome in /run/cluster-api/airgap-images and, when any
+//     bundle is missing, exits non-zero with the reason AirgapImagesMissing so
+//     the distribution never starts a node that would wait on image pulls.
+//     The service's Restart= policy retries, so a transient download failure
+//     recovers on its own;
+//  5. when the env file names a status Secret (control-plane nodes with a
+//     management endpoint), PATCHes the same outcome under its own key into
+//     that management-cluster Secret over the node-push channel, best-effort.
+//     The bootstrap controller turns it into the AirgapImagesReady condition.
+//
+// SECURITY: the script is a compile-time constant, like
+// distributionVersionGateScript. No TemplateData field is interpolated into
+// it; the bundle sources reach it only through the env file, where
+// airgapImagesEnv emits every value through shquote.
+const airgapImagesScript = `#!/bin/bash
+# Kairos CAPI airgap image preload (ExecStartPre of the distribution service).
+set -uo pipefail
+
+env_file=/usr/local/etc/kairos-capi/airgap-images.env
+status_file=/run/cluster-api/airgap-images
+stage_dir=/usr/local/lib/kairos-capi/airgap
+
+# The distribution never runs on the Kairos live installer.
+if grep -qw cdroot /proc/cmdline 2>/dev/null; then
+  exit 0
+fi
+if [ ! -f "${env_file}" ]; then
+  echo "kairos-airgap-images: ${env_file} not found; nothing to preload"
+  exit 0
+fi
+# shellcheck source=/dev/null
+. "${env_file}"
+
+DISTRIBUTION="${DISTRIBUTION:-}"
+IMAGES_DIR="${IMAGES_DIR:-}"
+BUNDLE_COUNT="${BUNDLE_COUNT:-0}"
+
+# report pushes the outcome into the management-cluster status Secret. The
+# message is reduced to JSON-safe characters; the token is never logged.
+report() {
+  [ -n "${STATUS_SECRET:-}" ] || return 0
+  command -v curl >/dev/null 2>&1 || { echo "kairos-airgap-images: curl not available; cannot report"; return 0; }
+  local message now status_json status_b64 code
+  message=$(printf '%s' "$3" | tr -c 'a-zA-Z0-9 ._:/@=+,()-' '_')
+  now=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+  status_json=$(printf '{"result":"%s","bundle":"%s","message":"%s","reportedAt":"%s"}' "$1" "$2" "${message}" "${now}")
+  status_b64=$(printf '%s' "${status_json}" | base64 -w 0 2>/dev/null || printf '%s' "${status_json}" | base64 | tr -d '\n')
+  code=$(curl --cacert /usr/local/etc/kairos-capi/management-ca.crt -sS -o /dev/null -w "%{http_code}" --max-time 30 \
+    -H "Authorization: Bearer ${STATUS_TOKEN:-}" \
+    -H "Content-Type: application/strategic-merge-patch+json" \
+    -X PATCH \
+    --data "{\"data\":{\"${STATUS_KEY}\":\"${status_b64}\"}}" \
+    "${STATUS_API}/api/v1/namespaces/${STATUS_NAMESPACE}/secrets/${STATUS_SECRET}" || true)
+  if [ "${code}" -ge 200 ] 2>/dev/null && [ "${code}" -lt 300 ]; then
+    return 0
+  fi
+  echo "kairos-airgap-images: could not report to ${STATUS_NAMESPACE}/${STATUS_SECRET} (status ${code})"
+}
+
+missing() {
+  mkdir -p "$(dirname "${status_file}")"
+  printf 'result=missing\nreason=AirgapImagesMissing\nbundle=%s\nmessage=%s\n' "$1" "$2" > "${status_file}"
+  echo "kairos-airgap-images: AirgapImagesMissing: bundle ${1}: ${2}" >&2
+  report missing "$1" "$2"
+  exit 1
+}
+
+sha256_ok() {
+  [ -z "$2" ] && return 0
+  printf '%s  %s\n' "$2" "$1" | sha256sum -c - >/dev/null 2>&1
+}
+
+bundle_files() {
+  case "${DISTRIBUTION}" in
+    k0s) find "$1" -type f -name '*.tar' -print0 ;;
+    *) find "$1" -type f \( -name '*.tar' -o -name '*.tar.gz' -o -name '*.tgz' -o -name '*.tar.zst' \
+         -o -name '*.tzst' -o -name '*.tar.bz2' -o -name '*.tbz' -o -name '*.tar.lz4' \) -print0 ;;
+  esac
+}
+
+[ -n "${IMAGES_DIR}" ] || missing - "IMAGES_DIR is not set in ${env_file}"
+mkdir -p "${IMAGES_DIR}" "${stage_dir}" || missing - "cannot create ${IMAGES_DIR}"
+
+i=0
+while [ "${i}" -lt "${BUNDLE_COUNT}" ]; do
+  type_var="BUNDLE_${i}_TYPE"
+  source_var="BUNDLE_${i}_SOURCE"
+  file_var="BUNDLE_${i}_FILE"
+  sha_var="BUNDLE_${i}_SHA256"
+  type="${!type_var:-}"
+  source="${!source_var:-}"
+  file="${!file_var:-}"
+  sha="${!sha_var:-}"
+  dest="${IMAGES_DIR}/${file}"
+  case "${type}" in
+    path)
+      if ! mountpoint -q "${dest}" 2>/dev/null; then
+        [ -f "${source}" ] || missing "${i}" "${source} not found on the node"
+        sha256_ok "${source}" "${sha}" || missing "${i}" "sha256 mismatch for ${source}"
+        touch "${dest}" && mount --bind "${source}" "${dest}" || missing "${i}" "could not bind-mount ${source} into ${IMAGES_DIR}"
+      fi
+      ;;
+    url)
+      if [ ! -f "${dest}" ] || ! sha256_ok "${dest}" "${sha}"; then
+        command -v curl >/dev/null 2>&1 || missing "${i}" "curl not available to fetch ${source}"
+        if ! curl -fsSL --retry 5 --retry-delay 5 --max-time 1800 -o "${dest}.partial" "${source}"; then
+          rm -f "${dest}.partial"
+          missing "${i}" "could not download ${source}"
+        fi
+        if ! sha256_ok "${dest}.partial" "${sha}"; then
+          rm -f "${dest}.partial"
+          missing "${i}" "sha256 mismatch for ${source}"
+        fi
+        mv -f "${dest}.partial" "${dest}"
+      fi
+      ;;
+    image)
+      marker="${stage_dir}/${file}.done"
+      if [ ! -f "${marker}" ] || [ "$(cat "${marker}")" != "${source}" ]; then
+        command -v luet >/dev/null 2>&1 || missing "${i}" "luet not available to unpack ${source}"
+        tmp="${stage_dir}/${file}.unpack"
+        rm -rf "${tmp}"
+        mkdir -p "${tmp}"
+        if ! timeout 1800 luet util unpack "${source}" "${tmp}" >/dev/null; then
+          rm -rf "${tmp}"
+          missing "${i}" "could not unpack ${source}"
+        fi
+        found=0
+        while IFS= read -r -d '' f; do
+          mv -f "${f}" "${IMAGES_DIR}/${file}-$(basename "${f}")" && found=$((found + 1))
+        done < <(bundle_files "${tmp}")
+        rm -rf "${tmp}"
+        [ "${found}" -gt 0 ] || missing "${i}" "no ${DISTRIBUTION} image bundle found in ${source}"
+        printf '%s' "${source}" > "${marker}"
+      fi
+      ;;
+    *)
+      missing "${i}" "unknown bundle source type '${type}'"
+      ;;
+  esac
+  i=$((i + 1))
+done
+
+mkdir -p "$(dirname "${status_file}")"
+printf 'result=ready\nbundles=%s\n' "${BUNDLE_COUNT}" > "${status_file}"
+echo "kairos-airgap-images: ${BUNDLE_COUNT} bundle(s) ready in ${IMAGES_DIR}"
+report ready - "${BUNDLE_COUNT} bundle(s) ready in ${IMAGES_DIR}"
+`
+
+// airgapImagesPreload returns the static preload script. Zero-arg on purpose
+// (see the SECURITY note on airgapImagesScript); intended to be piped through
+// `indent N` under a `content: |` block scalar.
+func airgapImagesPreload() string {
+	return airgapImagesScript
+}
+
+// airgapImagesEnv renders the env file the preload script sources. Each bundle
+// gets a file name in the import directory, kairos-capi-airgap-<index> plus
+// the source's extension (Image bundles keep their own names behind that
+// prefix), so two bundles never collide. When mgmt names an airgap status
+// Secret, the report target and bearer token are added as STATUS_* variables.
+// Every value is emitted through shquote; the file is sourced by bash.
+func airgapImagesEnv(distribution string, bundles []AirgapBundleConfig, mgmt *ManagementEndpoint) (string, error) {
+	var lines []string
+	add := func(k, v string) {
+		lines = append(lines, k+"="+shquote(v))
+	}
+	add("DISTRIBUTION", distribution)
+	add("IMAGES_DIR", airgapImagesDirs[distribution])
+	add("BUNDLE_COUNT", strconv.Itoa(len(bundles)))
+	for i, b := range bundles {
+		prefix := fmt.Sprintf("BUNDLE_%d_", i)
+		file := fmt.Sprintf("kairos-capi-airgap-%d", i)
+		switch {
+		case b.Image != "":
+			add(prefix+"TYPE", "image")
+			add(prefix+"SOURCE", b.Image)
+		case b.Path != "":
+			ext := airgapBundleExt(distribution, b.Path)
+			if ext == "" {
+				return "", fmt.Errorf("airgapImages[%d].path %q is not a bundle %s imports", i, b.Path, distribution)
+			}
+			add(prefix+"TYPE", "path")
+			add(prefix+"SOURCE", b.Path)
+			file += ext
+		case b.URL != "":
+			u, err := url.Parse(b.URL)
+			if err != nil {
+				return "", fmt.Errorf("airgapImages[%d].url: %w", i, err)
+			}
+			ext := airgapBundleExt(distribution, u.Path)
+			if ext == "" {
+				return "", fmt.Errorf("airgapImages[%d].url %q is not a bundle %s imports", i, b.URL, distribution)
+			}
+			add(prefix+"TYPE", "url")
+			add(prefix+"SOURCE", b.URL)
+			file += ext
+		}
+		add(prefix+"FILE", file)
+		if b.SHA256 != "" {
+			add(prefix+"SHA256", b.SHA256)
+		}
+	}
+	if mgmt != nil && mgmt.AirgapStatusSecretName != "" {
+		add("STATUS_API", mgmt.APIServer)
+		add("STATUS_NAMESPACE", mgmt.KubeconfigSecretNamespace)
+		add("STATUS_SECRET", mgmt.AirgapStatusSecretName)
+		add("STATUS_KEY", mgmt.AirgapStatusKey)
+		add("STATUS_TOKEN", mgmt.Token)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// validateAirgapImages re-applies the webhook checks at render time: exactly
+// one source per bundle, a shell-safe Image reference, an absolute
+// traversal-free Path, an http(s) URL without credentials, and a hex SHA256
+// only alongside a Path or URL. The per-distribution extension check happens
+// in airgapImagesEnv, which knows the distribution.
+func validateAirgapImages(bundles []AirgapBundleConfig) error {
+	var errs []error
+	if len(bundles) > 16 {
+		errs = append(errs, fmt.Errorf("airgapImages: at most 16 bundles are allowed, got %d", len(bundles)))
+	}
+	for i, b := range bundles {
+		name := fmt.Sprintf("airgapImages[%d]", i)
+		sources := 0
+		for _, f := range []struct{ field, value string }{
+			{"image", b.Image}, {"path", b.Path}, {"url", b.URL}, {"sha256", b.SHA256},
+		} {
+			if err := rejectControlChars(name+"."+f.field, f.value); err != nil {
+				errs = append(errs, err)
+			}
+			if f.field != "sha256" && f.value != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			errs = append(errs, fmt.Errorf("%s: exactly one of image, path, or url must be set", name))
+		}
+		if b.Image != "" {
+			if strings.ContainsAny(b.Image, " \t'\"\\$`;|&") {
+				errs = append(errs, fmt.Errorf("%s.image %q must not contain whitespace or shell metacharacters", name, b.Image))
+			}
+			if b.SHA256 != "" {
+				errs = append(errs, fmt.Errorf("%s.sha256 is only valid with path or url", name))
+			}
+		}
+		if b.Path != "" {
+			if !strings.HasPrefix(b.Path, "/") {
+				errs = append(errs, fmt.Errorf("%s.path %q must be absolute", name, b.Path))
+			}
+			for _, seg := range strings.Split(b.Path, "/") {
+				if seg == ".." {
+					errs = append(errs, fmt.Errorf("%s.path %q must not contain '..' path segments", name, b.Path))
+					break
+				}
+			}
+		}
+		if b.URL != "" {
+			u, err := url.Parse(b.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil || strings.ContainsAny(b.URL, " \t") {
+				errs = append(errs, fmt.Errorf("%s.url %q must be an http(s) URL with a host and no embedded credentials", name, b.URL))
+			}
+		}
+		if b.SHA256 != "" && !sha256Pattern.MatchString(b.SHA256) {
+			errs = append(errs, fmt.Errorf("%s.sha256 %q must be 64 lowercase hex characters", name, b.SHA256))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,321 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const airgapTestSHA = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func airgapBundles() []AirgapBundleConfig {
+	return []AirgapBundleConfig{
+		{URL: "https://mirror.example.com/k3s-airgap-images-amd64.tar?X-Sig=abc", SHA256: airgapTestSHA},
+		{Path: "/opt/airgap/images.tar"},
+		{Image: "quay.io/example/airgap-bundle:v1.30.0"},
+	}
+}
+
+// TestAirgapImages_Rendered asserts every template writes the 0600 env file,
+// the preload script and the ExecStartPre drop-in on the distribution service.
+func TestAirgapImages_Rendered(t *testing.T) {
+	for _, distro := range []string{"k0s", "k3s"} {
+		render := RenderK0sCloudConfig
+		importDir := "/var/lib/k0s/images"
+		if distro == "k3s" {
+			render = RenderK3sCloudConfig
+			importDir = "/var/lib/rancher/k3s/agent/images"
+		}
+		for _, kv := range []bool{false, true} {
+			for _, role := range []string{"control-plane", "worker"} {
+				name := distro + "/" + role
+				if kv {
+					name += "/capk"
+				}
+				t.Run(name, func(t *testing.T) {
+					d := haCPData("init", kv)
+					if role == "worker" {
+						d = TemplateData{Role: "worker", Hostname: "w", UserName: "kairos", WorkerToken: "tok",
+							K3sServerURL: "https://10.0.0.1:6443", K3sToken: "tok", IsKubeVirt: kv}
+					}
+					d.AirgapImages = airgapBundles()
+					out, err := render(d)
+					if err != nil {
+						t.Fatalf("render: %v", err)
+					}
+					parseRendered(t, out)
+
+					if !strings.Contains(out, "- path: /usr/local/etc/kairos-capi/airgap-images.env\n    permissions: \"0600\"") {
+						t.Error("airgap env file is not 0600")
+					}
+					env := extractWriteFile(t, out, "/usr/local/etc/kairos-capi/airgap-images.env")
+					for _, want := range []string{
+						"DISTRIBUTION='" + distro + "'",
+						"IMAGES_DIR='" + importDir + "'",
+						"BUNDLE_COUNT='3'",
+						"BUNDLE_0_TYPE='url'",
+						"BUNDLE_0_FILE='kairos-capi-airgap-0.tar'",
+						"BUNDLE_0_SHA256='" + airgapTestSHA + "'",
+						"BUNDLE_1_SOURCE='/opt/airgap/images.tar'",
+						"BUNDLE_2_TYPE='image'",
+						"BUNDLE_2_FILE='kairos-capi-airgap-2'",
+					} {
+						if !strings.Contains(env, want) {
+							t.Errorf("airgap env missing %q:\n%s", want, env)
+						}
+					}
+					if !strings.Contains(extractWriteFile(t, out, "/usr/local/bin/kairos-airgap-images.sh"), "AirgapImagesMissing") {
+						t.Error("preload script not rendered")
+					}
+					unit := map[string]string{"k0s/control-plane": "k0scontroller", "k0s/worker": "k0sworker",
+						"k3s/control-plane": "k3s", "k3s/worker": "k3s-agent"}[distro+"/"+role]
+					dropIn := extractWriteFile(t, out, "/etc/systemd/system/"+unit+".service.d/15-kairos-airgap-images.conf")
+					if !strings.Contains(dropIn, "ExecStartPre=/usr/local/bin/kairos-airgap-images.sh") {
+						t.Errorf("airgap drop-in = %q", dropIn)
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestAirgapImages_AbsentByDefault: renders without spec.airgapImages carry no
+// preload files.
+func TestAirgapImages_AbsentByDefault(t *testing.T) {
+	for _, render := range []func(TemplateData) (string, error){RenderK0sCloudConfig, RenderK3sCloudConfig, RenderRKE2CloudConfig} {
+		out, err := render(haCPData("join", false))
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		if strings.Contains(out, "airgap") {
+			t.Error("airgap preload rendered without spec.airgapImages")
+		}
+	}
+}
+
+// TestAirgapImages_ExtensionPerDistribution: k3s keeps a compressed bundle's
+// extension; k0s refuses to render one, since it would never be imported.
+func TestAirgapImages_ExtensionPerDistribution(t *testing.T) {
+	bundles := []AirgapBundleConfig{{URL: "https://mirror.example.com/k3s-airgap-images-amd64.tar.zst"}}
+	env, err := airgapImagesEnv("k3s", bundles, nil)
+	if err != nil {
+		t.Fatalf("k3s: %v", err)
+	}
+	if !strings.Contains(env, "BUNDLE_0_FILE='kairos-capi-airgap-0.tar.zst'") {
+		t.Errorf("k3s env = %s", env)
+	}
+	d := haCPData("init", false)
+	d.AirgapImages = bundles
+	if _, err := RenderK0sCloudConfig(d); err == nil || !strings.Contains(err.Error(), "not a bundle k0s imports") {
+		t.Errorf("k0s render error = %v", err)
+	}
+}
+
+// airgapScriptHarness writes the preload script with its fixed node paths
+// redirected into a temp directory and returns the script path, the env file
+// path, the import directory and the status file path.
+func airgapScriptHarness(t *testing.T) (script, envFile, importDir, statusFile string) {
+	t.Helper()
+	for _, bin := range []string{"bash", "curl", "sha256sum"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not available; skipping preload script run", bin)
+		}
+	}
+	dir := t.TempDir()
+	envFile = filepath.Join(dir, "airgap-images.env")
+	importDir = filepath.Join(dir, "images")
+	statusFile = filepath.Join(dir, "run", "airgap-images")
+	body := strings.NewReplacer(
+		"/usr/local/etc/kairos-capi/airgap-images.env", envFile,
+		"/run/cluster-api/airgap-images", statusFile,
+		"/usr/local/lib/kairos-capi/airgap", filepath.Join(dir, "stage"),
+		"/usr/local/etc/kairos-capi/management-ca.crt", filepath.Join(dir, "management-ca.crt"),
+	).Replace(airgapImagesPreload())
+	script = filepath.Join(dir, "kairos-airgap-images.sh")
+	if err := os.WriteFile(script, []byte(body), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return script, envFile, importDir, statusFile
+}
+
+// writeAirgapEnv renders the env file for bundles with IMAGES_DIR pointed at
+// importDir.
+func writeAirgapEnv(t *testing.T, envFile, importDir string, bundles []AirgapBundleConfig) {
+	t.Helper()
+	env, err := airgapImagesEnv("k3s", bundles, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env = strings.Replace(env, "IMAGES_DIR='/var/lib/rancher/k3s/agent/images'", "IMAGES_DIR="+shquote(importDir), 1)
+	if err := os.WriteFile(envFile, []byte(env+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAirgapImages_ScriptDownloadsAndReportsMissing runs the preload script
+// against a local HTTP server: a served bundle with a matching digest lands in
+// the import directory, and a missing one exits non-zero with the reason
+// AirgapImagesMissing in the status file.
+func TestAirgapImages_ScriptDownloadsAndReportsMissing(t *testing.T) {
+	script, envFile, importDir, statusFile := airgapScriptHarness(t)
+	bundle := []byte("fake image bundle")
+	sum := sha256.Sum256(bundle)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(bundle)
+	}))
+	defer srv.Close()
+
+	writeAirgapEnv(t, envFile, importDir, []AirgapBundleConfig{{URL: srv.URL + "/images.tar.gz", SHA256: hex.EncodeToString(sum[:])}})
+	if out, err := exec.Command("bash", script).CombinedOutput(); err != nil {
+		t.Fatalf("preload failed: %v\n%s", err, out)
+	}
+	got, err := os.ReadFile(filepath.Join(importDir, "kairos-capi-airgap-0.tar.gz"))
+	if err != nil || string(got) != string(bundle) {
+		t.Fatalf("bundle not placed: %v %q", err, got)
+	}
+	if status, _ := os.ReadFile(statusFile); !strings.Contains(string(status), "result=ready") {
+		t.Errorf("status = %q", status)
+	}
+
+	writeAirgapEnv(t, envFile, importDir, []AirgapBundleConfig{{URL: srv.URL + "/missing.tar"}})
+	out, err := exec.Command("bash", script).CombinedOutput()
+	if err == nil {
+		t.Fatalf("preload succeeded with a missing bundle:\n%s", out)
+	}
+	status, _ := os.ReadFile(statusFile)
+	if !strings.Contains(string(status), "reason=AirgapImagesMissing") || !strings.Contains(string(out), "AirgapImagesMissing") {
+		t.Errorf("missing bundle not reported:\nstatus: %s\noutput: %s", status, out)
+	}
+
+	writeAirgapEnv(t, envFile, importDir, []AirgapBundleConfig{{URL: srv.URL + "/images.tar.gz", SHA256: airgapTestSHA}})
+	if err := os.Remove(filepath.Join(importDir, "kairos-capi-airgap-0.tar.gz")); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("bash", script).CombinedOutput(); err == nil || !strings.Contains(string(out), "sha256 mismatch") {
+		t.Errorf("digest mismatch not reported: %v\n%s", err, out)
+	}
+}
+
+// TestAirgapImages_ScriptReportsToManagement: with a status Secret in the env
+// file, the script PATCHes its outcome under its own key over the node-push
+// channel, verifying the management apiserver against the rendered CA.
+func TestAirgapImages_ScriptReportsToManagement(t *testing.T) {
+	script, envFile, importDir, _ := airgapScriptHarness(t)
+	var patches []map[string]map[string]string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/api/v1/namespaces/default/secrets/c-airgap-status" ||
+			r.Header.Get("Authorization") != "Bearer node-token" {
+			http.Error(w, "unexpected request", http.StatusForbidden)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var patch map[string]map[string]string
+		if err := json.Unmarshal(body, &patch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		patches = append(patches, patch)
+	}))
+	defer srv.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(filepath.Join(filepath.Dir(script), "management-ca.crt"), ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mgmt := &ManagementEndpoint{
+		APIServer:                 srv.URL,
+		Token:                     "node-token",
+		KubeconfigSecretNamespace: "default",
+		AirgapStatusSecretName:    "c-airgap-status",
+		AirgapStatusKey:           "cp-0",
+	}
+	env, err := airgapImagesEnv("k3s", []AirgapBundleConfig{{Path: filepath.Join(importDir, "absent.tar")}}, mgmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env = strings.Replace(env, "IMAGES_DIR='/var/lib/rancher/k3s/agent/images'", "IMAGES_DIR="+shquote(importDir), 1)
+	if err := os.WriteFile(envFile, []byte(env+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("bash", script).CombinedOutput(); err == nil {
+		t.Fatalf("preload succeeded with a missing bundle:\n%s", out)
+	}
+	if len(patches) != 1 {
+		t.Fatalf("got %d reports, want 1", len(patches))
+	}
+	raw, err := base64.StdEncoding.DecodeString(patches[0]["data"]["cp-0"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct{ Result, Bundle, Message string }
+	if err := json.Unmarshal(raw, &report); err != nil {
+		t.Fatalf("report %q: %v", raw, err)
+	}
+	if report.Result != "missing" || report.Bundle != "0" || !strings.Contains(report.Message, "not found on the node") {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestValidateAirgapImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(b []AirgapBundleConfig)
+		wantErr string
+	}{
+		{"valid", func([]AirgapBundleConfig) {}, ""},
+		{"no source", func(b []AirgapBundleConfig) { b[1].Path = "" }, "airgapImages[1]: exactly one"},
+		{"two sources", func(b []AirgapBundleConfig) { b[1].URL = "https://m/x.tar" }, "airgapImages[1]: exactly one"},
+		{"relative path", func(b []AirgapBundleConfig) { b[1].Path = "opt/images.tar" }, "airgapImages[1].path"},
+		{"path traversal", func(b []AirgapBundleConfig) { b[1].Path = "/opt/../etc/images.tar" }, "airgapImages[1].path"},
+		{"credentials in URL", func(b []AirgapBundleConfig) { b[0].URL = "https://u:p@m/x.tar" }, "airgapImages[0].url"},
+		{"image with metacharacters", func(b []AirgapBundleConfig) { b[2].Image = "quay.io/x;reboot" }, "airgapImages[2].image"},
+		{"sha256 with image", func(b []AirgapBundleConfig) { b[2].SHA256 = airgapTestSHA }, "only valid with path or url"},
+		{"bad sha256", func(b []AirgapBundleConfig) { b[0].SHA256 = "ABC" }, "airgapImages[0].sha256"},
+		{"newline in path", func(b []AirgapBundleConfig) { b[1].Path = "/opt/a\nb.tar" }, "airgapImages[1].path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := airgapBundles()
+			tt.mutate(b)
+			err := validateAirgapImages(b)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
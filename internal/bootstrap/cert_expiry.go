@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+// RenderCertificateExpiryReport reports whether the certificate expiry
+// reporter is rendered: on every control-plane node, whatever its role. Workers
+// hold no control-plane certificates.
+func (d TemplateData) RenderCertificateExpiryReport() bool {
+	return d.IsControlPlane()
+}
+
+// certExpiryScriptContent is the node-side reporter run by
+// kairos-cert-expiry.service on kairos-cert-expiry.timer (shortly after boot,
+// then twice a day). Its only argument is the distribution name, which the
+// templates pass as a literal. It:
+//
+//  1. reads the notAfter date of every certificate under the distribution's
+//     server PKI directory and its etcd/ subdirectory (/var/lib/k0s/pki,
+//     /var/lib/rancher/k3s/server/tls, /var/lib/rancher/rke2/server/tls),
+//     skipping the CA certificates, which outlive the node;
+//  2. PATCHes its own key (the sanitized hostname == the Node name) in the
+//     workload-cluster Secret kube-system/kairos-cert-expiry-status with the
+//     list. Like the etcd backup report, the write uses the local admin
+//     kubeconfig, so it keeps working after the management bearer token in
+//     the bootstrap data has expired.
+//
+// SECURITY: the script is a compile-time constant, like etcdBackupScriptContent.
+// Certificate names are sanitized to [a-zA-Z0-9._/-] before they reach the
+// report JSON, and the dates are produced by date(1).
+const certExpiryScriptContent = `#!/bin/bash
+# Kairos CAPI certificate expiry report (kairos-cert-expiry.service).
+set -uo pipefail
+
+DISTRIBUTION="${1:-}"
+status_ns=kube-system
+status_secret=kairos-cert-expiry-status
+
+# Same report key as the etcd-status and etcd backup reporters.
+node=$(hostname | tr -d '\n' | tr -c 'a-zA-Z0-9._-' '-')
+
+case "${DISTRIBUTION}" in
+  k0s) pki_dir=/var/lib/k0s/pki ;;
+  k3s) pki_dir=/var/lib/rancher/k3s/server/tls ;;
+  rke2) pki_dir=/var/lib/rancher/rke2/server/tls ;;
+  *) pki_dir= ;;
+esac
+
+kctl() {
+  case "${DISTRIBUTION}" in
+    k0s) k0s kubectl "$@" ;;
+    k3s) k3s kubectl "$@" ;;
+    rke2) /var/lib/rancher/rke2/bin/kubectl --kubeconfig /etc/rancher/rke2/rke2.yaml "$@" ;;
+    *) return 1 ;;
+  esac
+}
+
+report() {
+  local success="$1" message="$2" certificates="$3" now status_json status_b64
+  now=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+  status_json=$(printf '{"node":"%s","time":"%s","success":%s,"message":"%s","certificates":[%s]}' \
+    "${node}" "${now}" "${success}" "${message}" "${certificates}")
+  status_b64=$(printf '%s' "${status_json}" | base64 -w 0 2>/dev/null || printf '%s' "${status_json}" | base64 | tr -d '\n')
+  kctl -n "${status_ns}" create secret generic "${status_secret}" >/dev/null 2>&1 || true
+  if ! kctl -n "${status_ns}" patch secret "${status_secret}" --type merge \
+    -p "{\"data\":{\"${node}\":\"${status_b64}\"}}" >/dev/null; then
+    echo "kairos-cert-expiry: could not write the report to ${status_ns}/${status_secret}"
+    exit 1
+  fi
+  echo "kairos-cert-expiry: ${message}"
+}
+
+[ -n "${pki_dir}" ] || { echo "kairos-cert-expiry: unsupported distribution ${DISTRIBUTION}"; exit 1; }
+command -v openssl >/dev/null 2>&1 || { report false "openssl is not available" ""; exit 1; }
+[ -d "${pki_dir}" ] || { report false "${pki_dir} does not exist" ""; exit 1; }
+
+certificates=
+count=0
+while read -r path; do
+  base=$(basename "${path}")
+  case "${base}" in
+    ca.crt | *-ca.crt) continue ;;
+  esac
+  end=$(openssl x509 -noout -enddate -in "${path}" 2>/dev/null | sed -n 's/^notAfter=//p')
+  [ -n "${end}" ] || continue
+  not_after=$(date -u -d "${end}" +%Y-%m-%dT%H:%M:%SZ 2>/dev/null) || continue
+  name=$(printf '%s' "${path#"${pki_dir}"/}" | tr -c 'a-zA-Z0-9._/-' '-')
+  certificates="${certificates}${certificates:+,}{\"name\":\"${name}\",\"notAfter\":\"${not_after}\"}"
+  count=$((count + 1))
+done < <(find "${pki_dir}" -maxdepth 2 -name '*.crt' -type f 2>/dev/null | sort)
+
+report true "read ${count} certificates from ${pki_dir}" "${certificates}"
+`
+
+// certExpiryScript returns the static reporter script. Zero-arg on purpose (see
+// the SECURITY note on certExpiryScriptContent); intended to be piped through
+// `indent N` under a `content: |` block scalar.
+func certExpiryScript() string {
+	return certExpiryScriptContent
+}
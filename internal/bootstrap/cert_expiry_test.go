@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestCertExpiry_RenderedOnControlPlanes asserts every template renders the
+// reporter script, service and timer, and arms the timer, on control-plane
+// nodes of every role, with the distribution passed to the script.
+func TestCertExpiry_RenderedOnControlPlanes(t *testing.T) {
+	renders := map[string]func(TemplateData) (string, error){
+		"k0s":  RenderK0sCloudConfig,
+		"k3s":  RenderK3sCloudConfig,
+		"rke2": RenderRKE2CloudConfig,
+	}
+	for distro, render := range renders {
+		for _, kv := range []bool{false, true} {
+			for _, role := range []string{"single", "init", "join"} {
+				name := distro + "/" + role
+				if kv {
+					name += "/capk"
+				}
+				t.Run(name, func(t *testing.T) {
+					d := haCPData(role, kv)
+					if role == "single" {
+						d.SingleNode = true
+					}
+					out, err := render(d)
+					if err != nil {
+						t.Fatalf("render: %v", err)
+					}
+					parseRendered(t, out)
+
+					if script := extractWriteFile(t, out, "/usr/local/bin/kairos-cert-expiry.sh"); script != certExpiryScriptContent {
+						t.Error("cert expiry script did not round-trip through the YAML block scalar")
+					}
+					if svc := extractWriteFile(t, out, "/etc/systemd/system/kairos-cert-expiry.service"); !strings.Contains(svc, "ExecStart=/usr/local/bin/kairos-cert-expiry.sh "+distro+"\n") {
+						t.Errorf("service does not run the script for %s:\n%s", distro, svc)
+					}
+					if timer := extractWriteFile(t, out, "/etc/systemd/system/kairos-cert-expiry.timer"); !strings.Contains(timer, "OnUnitActiveSec=12h\n") {
+						t.Errorf("timer missing its interval:\n%s", timer)
+					}
+					if !strings.Contains(out, "- /bin/systemctl enable --now kairos-cert-expiry.timer || true") {
+						t.Error("runcmd does not arm the cert expiry timer")
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestCertExpiry_AbsentOnWorkers: workers hold no control-plane certificates.
+func TestCertExpiry_AbsentOnWorkers(t *testing.T) {
+	d := TemplateData{Role: "worker", Hostname: "n", UserName: "kairos", WorkerToken: "t", K3sServerURL: "https://10.0.0.1:6443", K3sToken: "t", RKE2ServerURL: "https://10.0.0.1:9345", RKE2Token: "t"}
+	for _, render := range []func(TemplateData) (string, error){RenderK0sCloudConfig, RenderK3sCloudConfig, RenderRKE2CloudConfig} {
+		out, err := render(d)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		if strings.Contains(out, "kairos-cert-expiry") {
+			t.Error("cert expiry reporter rendered on a worker")
+		}
+	}
+}
+
+// TestCertExpiry_ScriptValidBash runs `bash -n` on the reporter script.
+func TestCertExpiry_ScriptValidBash(t *testing.T) {
+	bashPath, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available; skipping rendered-script syntax check")
+	}
+	f := filepathJoinTemp(t, "cert-expiry.sh")
+	if err := os.WriteFile(f, []byte(certExpiryScript()), 0o600); err != nil {
+		t.Fatalf("write temp script: %v", err)
+	}
+	if b, err := exec.Command(bashPath, "-n", f).CombinedOutput(); err != nil {
+		t.Fatalf("cert expiry script is not valid bash: %v\n%s", err, b)
+	}
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+)
+
+// CNIConfig is the render-ready view of KairosConfig.Spec.ControlPlaneCNI, the
+// network plugin the KairosControlPlane selected. The controller leaves it nil
+// for the distribution default (k0s kube-router, k3s flannel, rke2 canal).
+type CNIConfig struct {
+	// Provider is calico, cilium or none.
+	Provider string
+}
+
+// Chart versions the provider installs. The Calico version matches the one
+// cmd/kubevirt-env installs on the management cluster.
+const (
+	calicoChartVersion = "v3.29.1"
+	ciliumChartVersion = "1.16.5"
+
+	calicoChartRepo = "https://docs.tigera.io/calico/charts"
+	ciliumChartRepo = "https://helm.cilium.io"
+
+	// k0sCiliumRepoName is the k0s.yaml extensions.helm repository the cilium
+	// Chart resource installs from.
+	k0sCiliumRepoName = "cilium"
+
+	// cniManifestDir is the Manifests directory the CNI chart resource is
+	// written to.
+	cniManifestDir = "kairos-cni"
+)
+
+// Default pod and service CIDRs of each distribution, used for the CNI IP
+// pools and NO_PROXY when the KairosConfig does not set its own.
+const (
+	K0sDefaultPodCIDR     = "10.244.0.0/16"
+	K0sDefaultServiceCIDR = "10.96.0.0/12"
+	K3sDefaultPodCIDR     = "10.42.0.0/16"
+	K3sDefaultServiceCIDR = "10.43.0.0/16"
+	// rke2 uses the same defaults as k3s.
+	RKE2DefaultPodCIDR     = "10.42.0.0/16"
+	RKE2DefaultServiceCIDR = "10.43.0.0/16"
+)
+
+// k0sNetworkProvider returns the k0s.yaml network.provider for c: k0s ships
+// Calico itself, every other plugin is "custom".
+func k0sNetworkProvider(c *CNIConfig) string {
+	switch {
+	case c == nil:
+		return ""
+	case c.Provider == "calico":
+		return "calico"
+	default:
+		return "custom"
+	}
+}
+
+// k3sCNIConfig renders the k3s server drop-in
+// /etc/rancher/k3s/config.yaml.d/92-kairos-cni.yaml that turns off the
+// bundled flannel and network policy controller, or "" for the default CNI.
+func k3sCNIConfig(c *CNIConfig) string {
+	if c == nil {
+		return ""
+	}
+	return "flannel-backend: none\ndisable-network-policy: true"
+}
+
+// rke2CNIConfig renders the rke2 server drop-in
+// /etc/rancher/rke2/config.yaml.d/92-kairos-cni.yaml selecting one of the
+// plugins rke2 bundles in place of canal, or "" for the default CNI.
+func rke2CNIConfig(c *CNIConfig) string {
+	if c == nil {
+		return ""
+	}
+	return "cni: " + c.Provider
+}
+
+// cniPodCIDRs returns the pod CIDRs the CNI IP pools must cover: spec.podCIDR
+// on every distribution, else the k3sConfig cluster-cidr on k3s, else the
+// distribution default.
+func cniPodCIDRs(distribution string, d *TemplateData) []string {
+	cidr := d.PodCIDR
+	if cidr == "" {
+		switch distribution {
+		case "k3s":
+			cidr = K3sDefaultPodCIDR
+			if d.K3sConfig != nil {
+				if s, ok := d.K3sConfig.Server["cluster-cidr"].(string); ok && s != "" {
+					cidr = s
+				}
+			}
+		case "rke2":
+			cidr = RKE2DefaultPodCIDR
+		default:
+			cidr = K0sDefaultPodCIDR
+		}
+	}
+	var out []string
+	for _, c := range strings.Split(cidr, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// cniManifests returns the chart resource that installs the selected CNI on a
+// control-plane node, delivered through the Manifests path: a k3s HelmChart,
+// or a k0s Chart installed from the repository k0sClusterConfig adds. k0s
+// installs Calico itself, rke2 installs every plugin from its own bundled
+// charts, and "none" installs nothing.
+//
+// SECURITY: the resource and its values are Go value trees serialized with
+// gopkg.in/yaml.v3; the pod CIDRs are validated by validateCNI.
+func cniManifests(distribution string, d *TemplateData) ([]bootstrapv1beta2.Manifest, error) {
+	c := d.CNI
+	if c == nil || !d.IsControlPlane() || c.Provider == "none" || distribution == "rke2" || (c.Provider == "calico" && distribution != "k3s") {
+		return nil, nil
+	}
+	cidrs := cniPodCIDRs(distribution, d)
+	var values map[string]any
+	var chart, repo, version, namespace string
+	switch c.Provider {
+	case "calico":
+		chart, repo, version, namespace = "tigera-operator", calicoChartRepo, calicoChartVersion, "tigera-operator"
+		var pools []any
+		for _, cidr := range cidrs {
+			pools = append(pools, map[string]any{
+				"cidr": cidr, "encapsulation": "VXLAN", "natOutgoing": "Enabled", "nodeSelector": "all()",
+			})
+		}
+		values = map[string]any{"installation": map[string]any{"calicoNetwork": map[string]any{
+			"containerIPForwarding": "Enabled",
+			"ipPools":               pools,
+		}}}
+	case "cilium":
+		chart, repo, version, namespace = "cilium", ciliumChartRepo, ciliumChartVersion, "kube-system"
+		var v4, v6 []string
+		for _, cidr := range cidrs {
+			if ip, _, err := net.ParseCIDR(cidr); err == nil && ip.To4() == nil {
+				v6 = append(v6, cidr)
+				continue
+			}
+			v4 = append(v4, cidr)
+		}
+		operator := map[string]any{}
+		if len(v4) > 0 {
+			operator["clusterPoolIPv4PodCIDRList"] = v4
+		}
+		if len(v6) > 0 {
+			operator["clusterPoolIPv6PodCIDRList"] = v6
+		}
+		values = map[string]any{"ipam": map[string]any{"operator": operator}}
+		if len(v6) > 0 {
+			values["ipv6"] = map[string]any{"enabled": true}
+		}
+		if distribution == "k3s" {
+			// k3s's containerd looks for CNI plugins and configs under its
+			// own data directory, not /opt/cni/bin and /etc/cni/net.d.
+			values["cni"] = map[string]any{
+				"binPath":  "/var/lib/rancher/k3s/data/current/bin",
+				"confPath": "/var/lib/rancher/k3s/agent/etc/cni/net.d",
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported CNI provider %q", c.Provider)
+	}
+	valuesYAML, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s chart values: %w", chart, err)
+	}
+
+	var doc any
+	if distribution == "k3s" {
+		// bootstrap: true runs the install job on the host network before the
+		// node has a CNI.
+		doc = map[string]any{
+			"apiVersion": "helm.cattle.io/v1",
+			"kind":       "HelmChart",
+			"metadata":   map[string]any{"name": chart, "namespace": "kube-system"},
+			"spec": map[string]any{
+				"repo":            repo,
+				"chart":           chart,
+				"version":         version,
+				"targetNamespace": namespace,
+				"createNamespace": true,
+				"bootstrap":       true,
+				"valuesContent":   string(valuesYAML),
+			},
+		}
+	} else {
+		// k0s manages Chart resources named k0s-addon-chart-<release>.
+		doc = map[string]any{
+			"apiVersion": "helm.k0sproject.io/v1beta1",
+			"kind":       "Chart",
+			"metadata": map[string]any{
+				"name":       "k0s-addon-chart-" + chart,
+				"namespace":  "kube-system",
+				"finalizers": []string{"helm.k0sproject.io/uninstall-helm-release"},
+			},
+			"spec": map[string]any{
+				"chartName":   k0sCiliumRepoName + "/" + chart,
+				"releaseName": chart,
+				"version":     version,
+				"namespace":   namespace,
+				"values":      string(valuesYAML),
+			},
+		}
+	}
+	content, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s chart resource: %w", chart, err)
+	}
+	return []bootstrapv1beta2.Manifest{{
+		Name:    cniManifestDir,
+		File:    c.Provider + ".yaml",
+		Content: strings.TrimRight(string(content), "\n"),
+	}}, nil
+}
+
+// withCNIManifests validates the CNI selection and returns d with the CNI
+// chart resource prepended to its Manifests, leaving the caller's slice
+// untouched. The render entry points call it before renderTemplate because
+// the checks depend on the distribution, which TemplateData does not carry.
+func withCNIManifests(distribution string, d TemplateData) (TemplateData, error) {
+	if d.CNI == nil {
+		return d, nil
+	}
+	if err := validateCNI(distribution, &d); err != nil {
+		return d, fmt.Errorf("invalid template data: %w", err)
+	}
+	extra, err := cniManifests(distribution, &d)
+	if err != nil || len(extra) == 0 {
+		return d, err
+	}
+	d.Manifests = append(extra, d.Manifests...)
+	return d, nil
+}
+
+// validateCNI re-applies the webhook checks at render time: a known provider,
+// parseable pod CIDRs, and no user option that would fight the selection.
+func validateCNI(distribution string, d *TemplateData) error {
+	var errs []error
+	switch d.CNI.Provider {
+	case "calico", "cilium", "none":
+	default:
+		errs = append(errs, fmt.Errorf("cni provider %q must be calico, cilium or none", d.CNI.Provider))
+	}
+	for _, cidr := range cniPodCIDRs(distribution, d) {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("pod CIDR %q for the CNI IP pool: %w", cidr, err))
+		}
+	}
+	if network, ok := d.K0sConfig["network"].(map[string]any); ok {
+		if _, set := network["provider"]; set {
+			errs = append(errs, errors.New("k0sConfig.network.provider is set by the control plane's CNI selection"))
+		}
+	}
+	if d.K3sConfig != nil {
+		for _, k := range []string{"flannel-backend", "disable-network-policy"} {
+			if _, set := d.K3sConfig.Server[k]; set {
+				errs = append(errs, fmt.Errorf("k3sConfig.server[%s] is set by the control plane's CNI selection", k))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
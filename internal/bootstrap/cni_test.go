@@ -0,0 +1,385 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+)
+
+const k3sCNIConfigPath = "/etc/rancher/k3s/config.yaml.d/92-kairos-cni.yaml"
+
+// renderedManifest returns the content the Manifests heredoc writes to
+// <dir>/<file>, searched across every write_files script, or "" when no
+// script writes it.
+func renderedManifest(t *testing.T, out, dir, file string) string {
+	t.Helper()
+	var cc struct {
+		WriteFiles []struct {
+			Content string `yaml:"content"`
+		} `yaml:"write_files"`
+	}
+	if err := yaml.Unmarshal([]byte(out), &cc); err != nil {
+		t.Fatalf("parse rendered YAML: %v", err)
+	}
+	marker := "/" + dir + "/" + file + " << 'MANIFEST_EOF'\n"
+	for _, wf := range cc.WriteFiles {
+		_, rest, ok := strings.Cut(wf.Content, marker)
+		if !ok {
+			continue
+		}
+		body, _, ok := strings.Cut(rest, "\nMANIFEST_EOF\n")
+		if !ok {
+			t.Fatalf("manifest %s/%s heredoc is not terminated", dir, file)
+		}
+		return body
+	}
+	return ""
+}
+
+// TestCNI_K0s asserts k0s.yaml carries network.provider for every selection,
+// Cilium adds its Helm repository and Chart resource, and k0s's own Calico
+// needs no manifest.
+func TestCNI_K0s(t *testing.T) {
+	for _, kv := range []bool{false, true} {
+		for _, provider := range []string{"calico", "cilium", "none"} {
+			name := provider
+			if kv {
+				name += "/capk"
+			}
+			t.Run(name, func(t *testing.T) {
+				d := haCPData("init", kv)
+				d.PodCIDR = "10.100.0.0/16"
+				d.CNI = &CNIConfig{Provider: provider}
+				out, err := RenderK0sCloudConfig(d)
+				if err != nil {
+					t.Fatalf("render: %v", err)
+				}
+				parseRendered(t, out)
+				var cfg struct {
+					Spec struct {
+						Network    map[string]any `yaml:"network"`
+						Extensions struct {
+							Helm struct {
+								Repositories []map[string]string `yaml:"repositories"`
+							} `yaml:"helm"`
+						} `yaml:"extensions"`
+					} `yaml:"spec"`
+				}
+				if err := yaml.Unmarshal([]byte(extractWriteFile(t, out, "/etc/k0s/k0s.yaml")), &cfg); err != nil {
+					t.Fatalf("parse k0s.yaml: %v", err)
+				}
+				if want := k0sNetworkProvider(d.CNI); cfg.Spec.Network["provider"] != want {
+					t.Errorf("network.provider = %v, want %s", cfg.Spec.Network["provider"], want)
+				}
+				chart := renderedManifest(t, out, cniManifestDir, provider+".yaml")
+				if provider != "cilium" {
+					if chart != "" || len(cfg.Spec.Extensions.Helm.Repositories) > 0 {
+						t.Errorf("%s rendered a chart resource or Helm repository", provider)
+					}
+					return
+				}
+				repos := cfg.Spec.Extensions.Helm.Repositories
+				if len(repos) != 1 || repos[0]["name"] != "cilium" || repos[0]["url"] != ciliumChartRepo {
+					t.Errorf("helm repositories = %v", repos)
+				}
+				var doc struct {
+					Kind string `yaml:"kind"`
+					Spec struct {
+						ChartName string `yaml:"chartName"`
+						Version   string `yaml:"version"`
+						Values    string `yaml:"values"`
+					} `yaml:"spec"`
+				}
+				if err := yaml.Unmarshal([]byte(chart), &doc); err != nil {
+					t.Fatalf("parse chart resource: %v\n%s", err, chart)
+				}
+				if doc.Kind != "Chart" || doc.Spec.ChartName != "cilium/cilium" || doc.Spec.Version != ciliumChartVersion ||
+					!strings.Contains(doc.Spec.Values, "- 10.100.0.0/16") {
+					t.Errorf("chart resource = %+v", doc)
+				}
+			})
+		}
+	}
+}
+
+// TestCNI_K3s asserts the k3s servers disable flannel and get a HelmChart
+// whose IP pool follows the k3sConfig cluster-cidr.
+func TestCNI_K3s(t *testing.T) {
+	for _, kv := range []bool{false, true} {
+		for _, provider := range []string{"calico", "cilium", "none"} {
+			name := provider
+			if kv {
+				name += "/capk"
+			}
+			t.Run(name, func(t *testing.T) {
+				d := haCPData("init", kv)
+				d.K3sConfig = &K3sConfig{Server: map[string]any{"cluster-cidr": "10.60.0.0/16,fd00:60::/56"}}
+				d.CNI = &CNIConfig{Provider: provider}
+				out, err := RenderK3sCloudConfig(d)
+				if err != nil {
+					t.Fatalf("render: %v", err)
+				}
+				parseRendered(t, out)
+				var dropIn map[string]any
+				if err := yaml.Unmarshal([]byte(extractWriteFile(t, out, k3sCNIConfigPath)), &dropIn); err != nil {
+					t.Fatalf("parse drop-in: %v", err)
+				}
+				if dropIn["flannel-backend"] != "none" || dropIn["disable-network-policy"] != true {
+					t.Errorf("cni drop-in = %v", dropIn)
+				}
+				chart := renderedManifest(t, out, cniManifestDir, provider+".yaml")
+				if provider == "none" {
+					if chart != "" {
+						t.Error("none rendered a chart resource")
+					}
+					return
+				}
+				var doc struct {
+					Kind string `yaml:"kind"`
+					Spec struct {
+						Chart         string `yaml:"chart"`
+						Bootstrap     bool   `yaml:"bootstrap"`
+						ValuesContent string `yaml:"valuesContent"`
+					} `yaml:"spec"`
+				}
+				if err := yaml.Unmarshal([]byte(chart), &doc); err != nil {
+					t.Fatalf("parse chart resource: %v\n%s", err, chart)
+				}
+				if doc.Kind != "HelmChart" || !doc.Spec.Bootstrap {
+					t.Errorf("chart resource = %+v", doc)
+				}
+				var want []string
+				switch provider {
+				case "calico":
+					want = []string{"cidr: 10.60.0.0/16", "cidr: fd00:60::/56", "encapsulation: VXLAN"}
+				case "cilium":
+					want = []string{"clusterPoolIPv4PodCIDRList:\n            - 10.60.0.0/16",
+						"clusterPoolIPv6PodCIDRList:\n            - fd00:60::/56", "binPath: /var/lib/rancher/k3s/data/current/bin"}
+				}
+				for _, w := range want {
+					if !strings.Contains(doc.Spec.ValuesContent, w) {
+						t.Errorf("values missing %q:\n%s", w, doc.Spec.ValuesContent)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestCNI_RKE2 asserts rke2 servers select the plugin through the cni config
+// key and, since rke2 bundles the charts itself, receive no chart resource.
+func TestCNI_RKE2(t *testing.T) {
+	for _, kv := range []bool{false, true} {
+		for _, provider := range []string{"calico", "cilium", "none"} {
+			name := provider
+			if kv {
+				name += "/capk"
+			}
+			t.Run(name, func(t *testing.T) {
+				d := haCPData("init", kv)
+				d.CNI = &CNIConfig{Provider: provider}
+				out, err := RenderRKE2CloudConfig(d)
+				if err != nil {
+					t.Fatalf("render: %v", err)
+				}
+				parseRendered(t, out)
+				var dropIn map[string]any
+				if err := yaml.Unmarshal([]byte(extractWriteFile(t, out, "/etc/rancher/rke2/config.yaml.d/92-kairos-cni.yaml")), &dropIn); err != nil {
+					t.Fatalf("parse drop-in: %v", err)
+				}
+				if dropIn["cni"] != provider {
+					t.Errorf("cni drop-in = %v", dropIn)
+				}
+				if strings.Contains(out, "/"+cniManifestDir+"/") {
+					t.Error("rke2 rendered a chart resource")
+				}
+			})
+		}
+	}
+}
+
+// TestCNIPodCIDRs: spec.podCIDR sizes the IP pool on every distribution,
+// ahead of the k3sConfig cluster-cidr and the distribution default.
+func TestCNIPodCIDRs(t *testing.T) {
+	tests := []struct {
+		distribution string
+		podCIDR      string
+		clusterCIDR  string
+		want         []string
+	}{
+		{"k0s", "", "", []string{K0sDefaultPodCIDR}},
+		{"k0s", "10.50.0.0/16", "", []string{"10.50.0.0/16"}},
+		{"k3s", "", "", []string{K3sDefaultPodCIDR}},
+		{"k3s", "", "10.60.0.0/16,fd00:60::/56", []string{"10.60.0.0/16", "fd00:60::/56"}},
+		{"k3s", "10.50.0.0/16", "", []string{"10.50.0.0/16"}},
+		{"rke2", "", "", []string{RKE2DefaultPodCIDR}},
+		{"rke2", "10.50.0.0/16,fd00:50::/56", "", []string{"10.50.0.0/16", "fd00:50::/56"}},
+	}
+	for _, tt := range tests {
+		d := TemplateData{PodCIDR: tt.podCIDR}
+		if tt.clusterCIDR != "" {
+			d.K3sConfig = &K3sConfig{Server: map[string]any{"cluster-cidr": tt.clusterCIDR}}
+		}
+		if got := cniPodCIDRs(tt.distribution, &d); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("cniPodCIDRs(%s, podCIDR=%q, cluster-cidr=%q) = %v, want %v", tt.distribution, tt.podCIDR, tt.clusterCIDR, got, tt.want)
+		}
+	}
+}
+
+// TestServerCIDRConfig: k3s and rke2 control planes get spec.podCIDR and
+// spec.serviceCIDR as cluster-cidr and service-cidr; workers and configs
+// without them get no drop-in.
+func TestServerCIDRConfig(t *testing.T) {
+	for _, distro := range []string{"k3s", "rke2"} {
+		render := RenderK3sCloudConfig
+		if distro == "rke2" {
+			render = RenderRKE2CloudConfig
+		}
+		for _, kv := range []bool{false, true} {
+			name := distro
+			if kv {
+				name += "/capk"
+			}
+			t.Run(name, func(t *testing.T) {
+				path := "/etc/rancher/" + distro + "/config.yaml.d/91-kairos-cidr.yaml"
+				d := haCPData("init", kv)
+				d.PodCIDR, d.ServiceCIDR = "10.50.0.0/16", "10.51.0.0/16"
+				out, err := render(d)
+				if err != nil {
+					t.Fatalf("render: %v", err)
+				}
+				parseRendered(t, out)
+				var dropIn map[string]any
+				if err := yaml.Unmarshal([]byte(extractWriteFile(t, out, path)), &dropIn); err != nil {
+					t.Fatalf("parse drop-in: %v", err)
+				}
+				if dropIn["cluster-cidr"] != "10.50.0.0/16" || dropIn["service-cidr"] != "10.51.0.0/16" {
+					t.Errorf("cidr drop-in = %v", dropIn)
+				}
+
+				w := TemplateData{Role: "worker", Hostname: "w", UserName: "kairos", WorkerToken: "tok",
+					K3sServerURL: "https://10.0.0.1:6443", K3sToken: "tok", RKE2ServerURL: "https://10.0.0.1:9345", RKE2Token: "tok",
+					IsKubeVirt: kv, PodCIDR: d.PodCIDR, ServiceCIDR: d.ServiceCIDR}
+				if out, err = render(w); err != nil {
+					t.Fatalf("render worker: %v", err)
+				}
+				if strings.Contains(out, "91-kairos-cidr.yaml") {
+					t.Error("cidr drop-in rendered on a worker")
+				}
+				if out, err = render(haCPData("init", kv)); err != nil {
+					t.Fatalf("render: %v", err)
+				}
+				if strings.Contains(out, "91-kairos-cidr.yaml") {
+					t.Error("cidr drop-in rendered without spec.podCIDR or spec.serviceCIDR")
+				}
+			})
+		}
+	}
+}
+
+// TestCNI_ControlPlaneOnly: workers get neither the k3s drop-in nor a chart
+// resource, and the user's manifests keep their place after the CNI's.
+func TestCNI_ControlPlaneOnly(t *testing.T) {
+	w := TemplateData{Role: "worker", Hostname: "w", UserName: "kairos", WorkerToken: "tok",
+		K3sServerURL: "https://10.0.0.1:6443", K3sToken: "tok", CNI: &CNIConfig{Provider: "cilium"}}
+	for _, render := range []func(TemplateData) (string, error){RenderK0sCloudConfig, RenderK3sCloudConfig, RenderRKE2CloudConfig} {
+		out, err := render(w)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		if strings.Contains(out, cniManifestDir) || strings.Contains(out, "92-kairos-cni.yaml") {
+			t.Error("CNI rendered on a worker")
+		}
+	}
+
+	d := haCPData("join", false)
+	d.CNI = &CNIConfig{Provider: "calico"}
+	d.Manifests = []bootstrapv1beta2.Manifest{{Name: "apps", File: "ns.yaml", Content: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: apps"}}
+	out, err := RenderK3sCloudConfig(d)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	cni := strings.Index(out, "/"+cniManifestDir+"/calico.yaml << 'MANIFEST_EOF'")
+	user := strings.Index(out, "/apps/ns.yaml << 'MANIFEST_EOF'")
+	if cni < 0 || user < cni {
+		t.Errorf("manifest order: cni at %d, user at %d", cni, user)
+	}
+	if len(d.Manifests) != 1 {
+		t.Errorf("caller's Manifests modified: %v", d.Manifests)
+	}
+}
+
+// TestCNI_AbsentByDefault: without a selection neither distribution renders
+// a CNI setting or chart resource.
+func TestCNI_AbsentByDefault(t *testing.T) {
+	for _, render := range []func(TemplateData) (string, error){RenderK0sCloudConfig, RenderK3sCloudConfig, RenderRKE2CloudConfig} {
+		out, err := render(haCPData("init", false))
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		if strings.Contains(out, cniManifestDir) || strings.Contains(out, "92-kairos-cni.yaml") ||
+			strings.Contains(out, "provider: custom") {
+			t.Error("CNI configuration rendered without a selection")
+		}
+	}
+}
+
+func TestValidateCNI(t *testing.T) {
+	tests := []struct {
+		name         string
+		distribution string
+		mutate       func(d *TemplateData)
+		wantErr      string
+	}{
+		{"valid k0s", "k0s", func(*TemplateData) {}, ""},
+		{"valid k3s", "k3s", func(*TemplateData) {}, ""},
+		{"unknown provider", "k0s", func(d *TemplateData) { d.CNI.Provider = "weave" }, "cni provider"},
+		{"bad pod CIDR", "k0s", func(d *TemplateData) { d.PodCIDR = "10.0.0.0" }, "pod CIDR"},
+		{"bad cluster-cidr", "k3s", func(d *TemplateData) {
+			d.K3sConfig = &K3sConfig{Server: map[string]any{"cluster-cidr": "10.0.0.0/16,x"}}
+		}, "pod CIDR \"x\""},
+		{"k0s network.provider", "k0s", func(d *TemplateData) {
+			d.K0sConfig = map[string]any{"network": map[string]any{"provider": "kuberouter"}}
+		}, "k0sConfig.network.provider"},
+		{"k3s flannel-backend", "k3s", func(d *TemplateData) {
+			d.K3sConfig = &K3sConfig{Server: map[string]any{"flannel-backend": "vxlan"}}
+		}, "k3sConfig.server[flannel-backend]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := haCPData("init", false)
+			d.CNI = &CNIConfig{Provider: "cilium"}
+			tt.mutate(&d)
+			err := validateCNI(tt.distribution, &d)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EtcdBackupConfig is the render-ready view of KairosConfig.Spec.EtcdBackup
+// with the credentials Secret already resolved by the controller. Every field
+// lands in the 0600 backup env file through shquote (see etcdBackupEnv), except
+// Schedule, which is the timer's OnCalendar value; all of them are
+// re-validated at render time by validateEtcdBackup.
+type EtcdBackupConfig struct {
+	// Schedule is a systemd OnCalendar expression.
+	Schedule string
+	// Retention is the number of snapshots kept locally and in the bucket.
+	Retention int32
+	// Endpoint is the base http(s) URL of the S3 API.
+	Endpoint string
+	// Bucket is the S3 bucket name.
+	Bucket string
+	// Prefix is the optional key prefix inside the bucket.
+	Prefix string
+	// Region is the SigV4 signing region.
+	Region string
+	// AccessKeyID and SecretAccessKey are the resolved S3 credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// RenderEtcdBackup reports whether the scheduled etcd snapshot unit is
+// rendered: only on etcd-member (init/join) control-plane nodes with a backup
+// config. The legacy single role and workers have no etcd.
+func (d TemplateData) RenderEtcdBackup() bool {
+	return d.IsHAControlPlane() && d.EtcdBackup != nil
+}
+
+// etcdBackupScriptContent is the node-side snapshot job run by
+// kairos-etcd-backup.service on the kairos-etcd-backup.timer schedule. It:
+//
+//  1. takes a snapshot into /usr/local/lib/kairos-capi/etcd-snapshots
+//     (`k0s backup` / `k3s etcd-snapshot save` / `rke2 etcd-snapshot save`);
+//  2. uploads it path-style to <endpoint>/<bucket>/<prefix>/<node>/<file> with
+//     curl's SigV4 signing; the credentials reach curl on stdin (-K -), never
+//     on its command line;
+//  3. keeps the newest RETENTION snapshots locally and under the node's key
+//     prefix in the bucket;
+//  4. PATCHes its own key (the sanitized hostname == the Node name) in the
+//     workload-cluster Secret kube-system/kairos-etcd-backup-status with the
+//     outcome and the node's last successful snapshot. The write uses the
+//     local admin kubeconfig: the management bearer token in the bootstrap
+//     data expires after a day, long before most scheduled runs.
+//
+// SECURITY: the script is a compile-time constant, like
+// distributionVersionGateScript. Operator values reach it only through the env
+// file, where etcdBackupEnv shquotes every value. Every string placed into the
+// report JSON is either script-generated or render-validated to exclude quotes
+// and backslashes.
+const etcdBackupScriptContent = `#!/bin/bash
+# Kairos CAPI scheduled etcd snapshot (kairos-etcd-backup.service).
+set -uo pipefail
+
+env_file=/usr/local/etc/kairos-capi/etcd-backup.env
+snapshot_dir=/usr/local/lib/kairos-capi/etcd-snapshots
+last_file=/usr/local/lib/kairos-capi/etcd-backup-last.json
+status_ns=kube-system
+status_secret=kairos-etcd-backup-status
+
+if [ ! -f "${env_file}" ]; then
+  echo "kairos-etcd-backup: ${env_file} not found; nothing to do"
+  exit 0
+fi
+# shellcheck source=/dev/null
+. "${env_file}"
+
+DISTRIBUTION="${DISTRIBUTION:-}"
+RETENTION="${RETENTION:-7}"
+S3_ENDPOINT="${S3_ENDPOINT:-}"
+S3_ENDPOINT="${S3_ENDPOINT%/}"
+S3_BUCKET="${S3_BUCKET:-}"
+S3_PREFIX="${S3_PREFIX:-}"
+S3_REGION="${S3_REGION:-us-east-1}"
+S3_ACCESS_KEY_ID="${S3_ACCESS_KEY_ID:-}"
+S3_SECRET_ACCESS_KEY="${S3_SECRET_ACCESS_KEY:-}"
+
+# Same member key as the etcd-status reporter: the hostname, sanitized, with
+# the trailing newline stripped first so it equals the Node name.
+node=$(hostname | tr -d '\n' | tr -c 'a-zA-Z0-9._-' '-')
+key_prefix="${node}/"
+if [ -n "${S3_PREFIX}" ]; then
+  key_prefix="${S3_PREFIX%/}/${node}/"
+fi
+
+kctl() {
+  case "${DISTRIBUTION}" in
+    k0s) k0s kubectl "$@" ;;
+    k3s) k3s kubectl "$@" ;;
+    rke2) /var/lib/rancher/rke2/bin/kubectl --kubeconfig /etc/rancher/rke2/rke2.yaml "$@" ;;
+    *) return 1 ;;
+  esac
+}
+
+# s3 runs a SigV4-signed curl request. The credentials are passed as a curl
+# config on stdin so they never show up in the process list.
+s3() {
+  local ak="${S3_ACCESS_KEY_ID//\\/\\\\}" sk="${S3_SECRET_ACCESS_KEY//\\/\\\\}"
+  printf 'user = "%s:%s"\n' "${ak//\"/\\\"}" "${sk//\"/\\\"}" |
+    curl -K - -fsS --retry 3 --retry-delay 5 --aws-sigv4 "aws:amz:${S3_REGION}:s3" "$@"
+}
+
+report() {
+  local success="$1" message="$2" now snapshot=null status_json status_b64
+  now=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+  if [ -s "${last_file}" ]; then
+    snapshot=$(cat "${last_file}")
+  fi
+  status_json=$(printf '{"node":"%s","time":"%s","success":%s,"message":"%s","snapshot":%s}' \
+    "${node}" "${now}" "${success}" "${message}" "${snapshot}")
+  status_b64=$(printf '%s' "${status_json}" | base64 -w 0 2>/dev/null || printf '%s' "${status_json}" | base64 | tr -d '\n')
+  kctl -n "${status_ns}" create secret generic "${status_secret}" >/dev/null 2>&1 || true
+  if ! kctl -n "${status_ns}" patch secret "${status_secret}" --type merge \
+    -p "{\"data\":{\"${node}\":\"${status_b64}\"}}" >/dev/null; then
+    echo "kairos-etcd-backup: could not write the report to ${status_ns}/${status_secret}"
+  fi
+  echo "kairos-etcd-backup: ${message}"
+}
+
+fail() {
+  report false "$1"
+  exit 1
+}
+
+prune_remote() {
+  local listing keys count old
+  listing=$(s3 "${S3_ENDPOINT}/${S3_BUCKET}?list-type=2&prefix=${key_prefix//\//%2F}") || return 1
+  keys=$(printf '%s' "${listing}" | grep -o '<Key>[^<]*</Key>' | sed -e 's#<Key>##' -e 's#</Key>##' | sort)
+  count=$(printf '%s\n' "${keys}" | grep -c . || true)
+  [ "${count}" -gt "${RETENTION}" ] || return 0
+  while read -r old; do
+    s3 -o /dev/null -X DELETE "${S3_ENDPOINT}/${S3_BUCKET}/${old}" || return 1
+  done < <(printf '%s\n' "${keys}" | head -n "$((count - RETENTION))")
+}
+
+command -v curl >/dev/null 2>&1 || fail "curl is not available"
+mkdir -p "${snapshot_dir}"
+
+case "${DISTRIBUTION}" in
+  k0s) k0s backup --save-path "${snapshot_dir}" >/dev/null || fail "k0s backup failed" ;;
+  k3s) k3s etcd-snapshot save --dir "${snapshot_dir}" --name kairos-capi >/dev/null || fail "k3s etcd-snapshot save failed" ;;
+  rke2) rke2 etcd-snapshot save --dir "${snapshot_dir}" --name kairos-capi >/dev/null || fail "rke2 etcd-snapshot save failed" ;;
+  *) fail "unsupported distribution ${DISTRIBUTION}" ;;
+esac
+
+file=$(ls -1t "${snapshot_dir}" 2>/dev/null | head -n 1)
+[ -n "${file}" ] || fail "no snapshot was written to ${snapshot_dir}"
+path="${snapshot_dir}/${file}"
+file=$(printf '%s' "${file}" | tr -c 'a-zA-Z0-9._-' '-')
+size=$(stat -c %s "${path}")
+taken=$(date -u -r "${path}" +%Y-%m-%dT%H:%M:%SZ)
+location="${S3_ENDPOINT}/${S3_BUCKET}/${key_prefix}${file}"
+
+s3 -o /dev/null -T "${path}" "${location}" || fail "upload of ${file} to ${S3_ENDPOINT}/${S3_BUCKET} failed"
+
+printf '{"name":"%s","location":"%s","sizeBytes":%s,"time":"%s"}' \
+  "${file}" "${location}" "${size}" "${taken}" > "${last_file}.tmp" && mv -f "${last_file}.tmp" "${last_file}"
+
+ls -1t "${snapshot_dir}" | tail -n +"$((RETENTION + 1))" | while read -r old; do
+  rm -f "${snapshot_dir:?}/${old}"
+done
+
+if ! prune_remote; then
+  report true "uploaded ${file} (${size} bytes); pruning old snapshots in the bucket failed"
+  exit 0
+fi
+report true "uploaded ${file} (${size} bytes)"
+`
+
+// etcdBackupScript returns the static backup script. Zero-arg on purpose (see
+// the SECURITY note on etcdBackupScriptContent); intended to be piped through
+// `indent N` under a `content: |` block scalar.
+func etcdBackupScript() string {
+	return etcdBackupScriptContent
+}
+
+// etcdBackupEnv renders the 0600 env file the backup script sources. The
+// template passes the distribution name explicitly, as for
+// distributionReleaseEnv. Every value is emitted through shquote.
+func etcdBackupEnv(distribution string, b *EtcdBackupConfig) string {
+	if b == nil {
+		return ""
+	}
+	var lines []string
+	add := func(k, v string) {
+		lines = append(lines, k+"="+shquote(v))
+	}
+	add("DISTRIBUTION", distribution)
+	add("RETENTION", strconv.Itoa(int(b.Retention)))
+	add("S3_ENDPOINT", b.Endpoint)
+	add("S3_BUCKET", b.Bucket)
+	add("S3_PREFIX", b.Prefix)
+	add("S3_REGION", b.Region)
+	add("S3_ACCESS_KEY_ID", b.AccessKeyID)
+	add("S3_SECRET_ACCESS_KEY", b.SecretAccessKey)
+	return strings.Join(lines, "\n")
+}
+
+// etcdBackupSchedulePattern, etcdBackupBucketPattern, etcdBackupPrefixPattern
+// and etcdBackupRegionPattern mirror the KCP webhook. The schedule is written
+// unquoted into the timer unit, so it must be a single line of OnCalendar
+// characters.
+var (
+	etcdBackupSchedulePattern = regexp.MustCompile(`^[A-Za-z0-9*:/,.~ -]{1,64}$`)
+	etcdBackupBucketPattern   = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	etcdBackupPrefixPattern   = regexp.MustCompile(`^[A-Za-z0-9._/-]{0,256}$`)
+	etcdBackupRegionPattern   = regexp.MustCompile(`^[a-z0-9-]+$`)
+)
+
+// validateEtcdBackup re-applies the webhook checks at render time and requires
+// resolved credentials. Control characters are rejected on every field.
+func validateEtcdBackup(b *EtcdBackupConfig) error {
+	var errs []error
+	for _, f := range []struct{ name, value string }{
+		{"etcdBackup.schedule", b.Schedule},
+		{"etcdBackup.endpoint", b.Endpoint},
+		{"etcdBackup.bucket", b.Bucket},
+		{"etcdBackup.prefix", b.Prefix},
+		{"etcdBackup.region", b.Region},
+		{"etcdBackup.accessKeyID", b.AccessKeyID},
+		{"etcdBackup.secretAccessKey", b.SecretAccessKey},
+	} {
+		if err := rejectControlChars(f.name, f.value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if !etcdBackupSchedulePattern.MatchString(b.Schedule) {
+		errs = append(errs, fmt.Errorf("etcdBackup.schedule %q must be a single-line systemd OnCalendar expression", b.Schedule))
+	}
+	if b.Retention < 1 || b.Retention > 100 {
+		errs = append(errs, fmt.Errorf("etcdBackup.retention %d must be between 1 and 100", b.Retention))
+	}
+	u, err := url.Parse(b.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil ||
+		strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" ||
+		strings.ContainsAny(b.Endpoint, "\"\\ ") {
+		errs = append(errs, fmt.Errorf("etcdBackup.endpoint %q must be an http(s) URL with a host and no credentials, path, or query", b.Endpoint))
+	}
+	if !etcdBackupBucketPattern.MatchString(b.Bucket) {
+		errs = append(errs, fmt.Errorf("etcdBackup.bucket %q is not a valid S3 bucket name", b.Bucket))
+	}
+	if !etcdBackupPrefixPattern.MatchString(b.Prefix) || strings.HasPrefix(b.Prefix, "/") ||
+		strings.Contains("/"+b.Prefix+"/", "/../") {
+		errs = append(errs, fmt.Errorf("etcdBackup.prefix %q must be a relative key prefix without '..' segments", b.Prefix))
+	}
+	if !etcdBackupRegionPattern.MatchString(b.Region) {
+		errs = append(errs, fmt.Errorf("etcdBackup.region %q must contain only lowercase letters, digits, and '-'", b.Region))
+	}
+	if b.AccessKeyID == "" || b.SecretAccessKey == "" {
+		errs = append(errs, fmt.Errorf("etcdBackup: accessKeyID and secretAccessKey must both be set"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func etcdBackupConfig() *EtcdBackupConfig {
+	return &EtcdBackupConfig{
+		Schedule:        "*-*-* 02:00:00",
+		Retention:       5,
+		Endpoint:        "http://minio.backup.svc:9000",
+		Bucket:          "etcd-backups",
+		Prefix:          "clusters/prod",
+		Region:          "us-east-1",
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio123",
+	}
+}
+
+// TestEtcdBackup_RenderedOnHANodes asserts every template renders the env
+// file, script, service, timer and the runcmd that arms the timer on HA
+// init/join nodes.
+func TestEtcdBackup_RenderedOnHANodes(t *testing.T) {
+	for _, distro := range []string{"k0s", "k3s"} {
+		render := RenderK0sCloudConfig
+		if distro == "k3s" {
+			render = RenderK3sCloudConfig
+		}
+		for _, kv := range []bool{false, true} {
+			for _, role := range []string{"init", "join"} {
+				name := distro + "/" + role
+				if kv {
+					name += "/capk"
+				}
+				t.Run(name, func(t *testing.T) {
+					d := haCPData(role, kv)
+					d.EtcdBackup = etcdBackupConfig()
+					out, err := render(d)
+					if err != nil {
+						t.Fatalf("render: %v", err)
+					}
+					parseRendered(t, out)
+
+					env := extractWriteFile(t, out, "/usr/local/etc/kairos-capi/etcd-backup.env")
+					for _, want := range []string{
+						"DISTRIBUTION='" + distro + "'",
+						"RETENTION='5'",
+						"S3_ENDPOINT='http://minio.backup.svc:9000'",
+						"S3_BUCKET='etcd-backups'",
+						"S3_PREFIX='clusters/prod'",
+						"S3_SECRET_ACCESS_KEY='minio123'",
+					} {
+						if !strings.Contains(env, want) {
+							t.Errorf("env file missing %q:\n%s", want, env)
+						}
+					}
+					if !strings.Contains(out, "- path: /usr/local/etc/kairos-capi/etcd-backup.env\n    permissions: \"0600\"") {
+						t.Error("etcd backup env file is not 0600")
+					}
+					if script := extractWriteFile(t, out, "/usr/local/bin/kairos-etcd-backup.sh"); script != etcdBackupScriptContent {
+						t.Error("backup script did not round-trip through the YAML block scalar")
+					}
+					timer := extractWriteFile(t, out, "/etc/systemd/system/kairos-etcd-backup.timer")
+					if !strings.Contains(timer, "OnCalendar=*-*-* 02:00:00\n") {
+						t.Errorf("timer missing OnCalendar:\n%s", timer)
+					}
+					if svc := extractWriteFile(t, out, "/etc/systemd/system/kairos-etcd-backup.service"); !strings.Contains(svc, "ExecStart=/usr/local/bin/kairos-etcd-backup.sh") {
+						t.Errorf("service missing ExecStart:\n%s", svc)
+					}
+					if !strings.Contains(out, "- /bin/systemctl enable --now kairos-etcd-backup.timer || true") {
+						t.Error("runcmd does not arm the etcd backup timer")
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestEtcdBackup_AbsentOffHA: single-node and worker renders never carry the
+// backup unit, even if a config slips through.
+func TestEtcdBackup_AbsentOffHA(t *testing.T) {
+	for _, d := range []TemplateData{
+		{Role: "control-plane", ControlPlaneRole: "single", SingleNode: true, Hostname: "n", UserName: "kairos"},
+		{Role: "worker", ControlPlaneRole: "init", Hostname: "n", UserName: "kairos"},
+	} {
+		d.EtcdBackup = etcdBackupConfig()
+		for _, render := range []func(TemplateData) (string, error){RenderK0sCloudConfig, RenderK3sCloudConfig, RenderRKE2CloudConfig} {
+			out, err := render(d)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if strings.Contains(out, "kairos-etcd-backup") {
+				t.Errorf("etcd backup rendered for role=%s controlPlaneRole=%s", d.Role, d.ControlPlaneRole)
+			}
+		}
+	}
+}
+
+// TestEtcdBackup_ScriptValidBash runs `bash -n` on the backup script and
+// sources a rendered env file whose credentials carry shell metacharacters.
+func TestEtcdBackup_ScriptValidBash(t *testing.T) {
+	bashPath, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available; skipping rendered-script syntax check")
+	}
+	f := filepathJoinTemp(t, "etcd-backup.sh")
+	if err := os.WriteFile(f, []byte(etcdBackupScript()), 0o600); err != nil {
+		t.Fatalf("write temp script: %v", err)
+	}
+	if b, err := exec.Command(bashPath, "-n", f).CombinedOutput(); err != nil {
+		t.Fatalf("etcd backup script is not valid bash: %v\n%s", err, b)
+	}
+
+	hostile := `it's "$(reboot)";` + "`id`"
+	b := etcdBackupConfig()
+	b.SecretAccessKey = hostile
+	envFile := filepathJoinTemp(t, "etcd-backup.env")
+	if err := os.WriteFile(envFile, []byte(etcdBackupEnv("k3s", b)), 0o600); err != nil {
+		t.Fatalf("write temp env: %v", err)
+	}
+	got, err := exec.Command(bashPath, "-c", `. "$1"; printf '%s|%s|%s' "$DISTRIBUTION" "$S3_BUCKET" "$S3_SECRET_ACCESS_KEY"`, "_", envFile).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sourcing env file failed: %v\n%s", err, got)
+	}
+	if want := "k3s|etcd-backups|" + hostile; string(got) != want {
+		t.Errorf("env file did not round-trip:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+// TestEtcdBackup_ValidationRejects re-asserts the webhook rules at render time.
+func TestEtcdBackup_ValidationRejects(t *testing.T) {
+	cases := []struct {
+		name    string
+		mutate  func(b *EtcdBackupConfig)
+		wantErr string
+	}{
+		{"schedule newline", func(b *EtcdBackupConfig) { b.Schedule = "daily\n[Service]" }, "control character"},
+		{"schedule metacharacters", func(b *EtcdBackupConfig) { b.Schedule = "daily;reboot" }, "etcdBackup.schedule"},
+		{"retention", func(b *EtcdBackupConfig) { b.Retention = 0 }, "etcdBackup.retention"},
+		{"endpoint scheme", func(b *EtcdBackupConfig) { b.Endpoint = "file:///etc/shadow" }, "etcdBackup.endpoint"},
+		{"endpoint credentials", func(b *EtcdBackupConfig) { b.Endpoint = "https://k:s@minio" }, "etcdBackup.endpoint"},
+		{"endpoint quote", func(b *EtcdBackupConfig) { b.Endpoint = `https://minio"x` }, "etcdBackup.endpoint"},
+		{"bucket", func(b *EtcdBackupConfig) { b.Bucket = "a" }, "etcdBackup.bucket"},
+		{"prefix traversal", func(b *EtcdBackupConfig) { b.Prefix = "../other" }, "etcdBackup.prefix"},
+		{"region", func(b *EtcdBackupConfig) { b.Region = "US" }, "etcdBackup.region"},
+		{"missing credentials", func(b *EtcdBackupConfig) { b.SecretAccessKey = "" }, "secretAccessKey"},
+		{"credential newline", func(b *EtcdBackupConfig) { b.AccessKeyID = "a\nb" }, "control character"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := haCPData("init", false)
+			d.EtcdBackup = etcdBackupConfig()
+			tc.mutate(d.EtcdBackup)
+			_, err := RenderK0sCloudConfig(d)
+			if err == nil {
+				t.Fatalf("render accepted invalid input; want error containing %q", tc.wantErr)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("error %q does not contain %q", err.Error(), tc.wantErr)
+			}
+		})
+	}
+}
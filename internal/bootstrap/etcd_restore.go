@@ -0,0 +1,167 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// EtcdRestoreConfig is the render-ready view of KairosConfig.Spec.EtcdRestore.
+// The snapshot is downloaded with the EtcdBackup S3 settings and credentials,
+// so a render with EtcdRestore also needs EtcdBackup.
+type EtcdRestoreConfig struct {
+	// Location is the object URL of the snapshot:
+	// <EtcdBackup.Endpoint>/<EtcdBackup.Bucket>/<key>.
+	Location string
+}
+
+// RenderEtcdRestore reports whether the one-shot snapshot restore is rendered:
+// only on the HA init node, which is the node the restored cluster starts
+// from. Joiners get their data from it through the normal join path.
+func (d TemplateData) RenderEtcdRestore() bool {
+	return d.IsInitControlPlane() && d.EtcdRestore != nil && d.EtcdBackup != nil
+}
+
+// etcdRestoreScriptContent restores the snapshot named in the restore env
+// file before the distribution service starts for the first time. It runs as
+// an ExecStartPre of k0scontroller.service / k3s.service / rke2-server.service
+// and:
+//
+//  1. exits at once when the done marker exists, so later service restarts
+//     and reboots start the distribution normally;
+//  2. downloads SNAPSHOT_LOCATION with the same SigV4-signed curl as the
+//     backup script, using the credentials from the backup env file;
+//  3. restores it: `k0s restore` into the k0s data dir, or a
+//     `k3s server` / `rke2 server` `--cluster-reset --cluster-reset-restore-path`
+//     run with the shared server token, which leaves a single-member etcd
+//     behind;
+//  4. writes the done marker.
+//
+// Any failure exits non-zero, so the service fails to start and systemd
+// retries it on its usual restart schedule; the distribution never starts on
+// an empty datastore.
+//
+// SECURITY: compile-time constant, like etcdBackupScriptContent. The location
+// reaches it only through the env file, shquoted by etcdRestoreEnv.
+const etcdRestoreScriptContent = `#!/bin/bash
+# Kairos CAPI etcd restore (ExecStartPre of the distribution service).
+set -uo pipefail
+
+backup_env=/usr/local/etc/kairos-capi/etcd-backup.env
+restore_env=/usr/local/etc/kairos-capi/etcd-restore.env
+restore_dir=/usr/local/lib/kairos-capi/etcd-restore
+done_file="${restore_dir}/restored"
+
+if [ -f "${done_file}" ]; then
+  exit 0
+fi
+for f in "${backup_env}" "${restore_env}"; do
+  if [ ! -f "${f}" ]; then
+    echo "kairos-etcd-restore: ${f} not found" >&2
+    exit 1
+  fi
+  # shellcheck source=/dev/null
+  . "${f}"
+done
+
+DISTRIBUTION="${DISTRIBUTION:-}"
+S3_REGION="${S3_REGION:-us-east-1}"
+S3_ACCESS_KEY_ID="${S3_ACCESS_KEY_ID:-}"
+S3_SECRET_ACCESS_KEY="${S3_SECRET_ACCESS_KEY:-}"
+SNAPSHOT_LOCATION="${SNAPSHOT_LOCATION:-}"
+
+# Same as the backup script: credentials reach curl on stdin, never argv.
+s3() {
+  local ak="${S3_ACCESS_KEY_ID//\\/\\\\}" sk="${S3_SECRET_ACCESS_KEY//\\/\\\\}"
+  printf 'user = "%s:%s"\n' "${ak//\"/\\\"}" "${sk//\"/\\\"}" |
+    curl -K - -fsS --retry 5 --retry-delay 10 --aws-sigv4 "aws:amz:${S3_REGION}:s3" "$@"
+}
+
+fail() {
+  echo "kairos-etcd-restore: $1" >&2
+  exit 1
+}
+
+command -v curl >/dev/null 2>&1 || fail "curl is not available"
+[ -n "${SNAPSHOT_LOCATION}" ] || fail "SNAPSHOT_LOCATION is empty"
+mkdir -p "${restore_dir}"
+
+file="${restore_dir}/$(basename "${SNAPSHOT_LOCATION}")"
+if [ ! -s "${file}" ]; then
+  echo "kairos-etcd-restore: downloading ${SNAPSHOT_LOCATION}"
+  s3 -o "${file}.part" "${SNAPSHOT_LOCATION}" || fail "download of ${SNAPSHOT_LOCATION} failed"
+  mv -f "${file}.part" "${file}"
+fi
+
+echo "kairos-etcd-restore: restoring $(basename "${file}")"
+case "${DISTRIBUTION}" in
+  k0s)
+    k0s restore --config-out "${restore_dir}/k0s-restored.yaml" "${file}" || fail "k0s restore failed"
+    ;;
+  k3s)
+    k3s server --cluster-reset --cluster-reset-restore-path="${file}" \
+      --token-file=/etc/rancher/k3s/server-token || fail "k3s cluster-reset restore failed"
+    ;;
+  rke2)
+    rke2 server --cluster-reset --cluster-reset-restore-path="${file}" \
+      --token-file=/etc/rancher/rke2/server-token || fail "rke2 cluster-reset restore failed"
+    ;;
+  *) fail "unsupported distribution ${DISTRIBUTION}" ;;
+esac
+
+touch "${done_file}"
+echo "kairos-etcd-restore: restore complete"
+`
+
+// etcdRestoreScript returns the static restore script. Zero-arg on purpose
+// (see the SECURITY note on etcdRestoreScriptContent).
+func etcdRestoreScript() string {
+	return etcdRestoreScriptContent
+}
+
+// etcdRestoreEnv renders the env file naming the snapshot to restore.
+func etcdRestoreEnv(r *EtcdRestoreConfig) string {
+	if r == nil {
+		return ""
+	}
+	return "SNAPSHOT_LOCATION=" + shquote(r.Location)
+}
+
+// etcdRestoreKeyPattern mirrors the KCP webhook's check on the object key
+// part of the location.
+var etcdRestoreKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+// validateEtcdRestore requires the backup config the restore downloads with
+// and a location inside its bucket whose key cannot escape it.
+func validateEtcdRestore(r *EtcdRestoreConfig, b *EtcdBackupConfig) error {
+	if err := rejectControlChars("etcdRestore.location", r.Location); err != nil {
+		return err
+	}
+	if b == nil {
+		return errors.New("etcdRestore requires etcdBackup for the S3 settings and credentials")
+	}
+	bucketURL := strings.TrimSuffix(b.Endpoint, "/") + "/" + b.Bucket + "/"
+	key, ok := strings.CutPrefix(r.Location, bucketURL)
+	if !ok || len(r.Location) > 1024 || !etcdRestoreKeyPattern.MatchString(key) || strings.HasSuffix(key, "/") ||
+		strings.Contains("/"+key+"/", "/../") {
+		return fmt.Errorf("etcdRestore.location %q must be a snapshot object URL under %s", r.Location, bucketURL)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+const testRestoreLocation = "http://minio.backup.svc:9000/etcd-backups/clusters/prod/node-a/k0s_backup.tar.gz"
+
+// TestEtcdRestore_RenderedOnInitOnly asserts every template renders the
+// restore env, script and service drop-in on the HA init node, and never on a
+// joiner.
+func TestEtcdRestore_RenderedOnInitOnly(t *testing.T) {
+	for _, tc := range []struct {
+		distro, unit string
+		render       func(TemplateData) (string, error)
+	}{
+		{"k0s", "k0scontroller", RenderK0sCloudConfig},
+		{"k3s", "k3s", RenderK3sCloudConfig},
+	} {
+		for _, kv := range []bool{false, true} {
+			name := tc.distro
+			if kv {
+				name += "/capk"
+			}
+			t.Run(name, func(t *testing.T) {
+				d := haCPData("init", kv)
+				d.EtcdBackup = etcdBackupConfig()
+				d.EtcdRestore = &EtcdRestoreConfig{Location: testRestoreLocation}
+				out, err := tc.render(d)
+				if err != nil {
+					t.Fatalf("render: %v", err)
+				}
+				parseRendered(t, out)
+
+				env := extractWriteFile(t, out, "/usr/local/etc/kairos-capi/etcd-restore.env")
+				if !strings.Contains(env, "SNAPSHOT_LOCATION='"+testRestoreLocation+"'") {
+					t.Errorf("restore env missing the location:\n%s", env)
+				}
+				if script := extractWriteFile(t, out, "/usr/local/bin/kairos-etcd-restore.sh"); script != etcdRestoreScriptContent {
+					t.Error("restore script did not round-trip through the YAML block scalar")
+				}
+				dropIn := extractWriteFile(t, out, "/etc/systemd/system/"+tc.unit+".service.d/20-kairos-etcd-restore.conf")
+				if !strings.Contains(dropIn, "ExecStartPre=/usr/local/bin/kairos-etcd-restore.sh") {
+					t.Errorf("drop-in missing ExecStartPre:\n%s", dropIn)
+				}
+
+				join := haCPData("join", kv)
+				join.EtcdBackup = etcdBackupConfig()
+				join.EtcdRestore = &EtcdRestoreConfig{Location: testRestoreLocation}
+				out, err = tc.render(join)
+				if err != nil {
+					t.Fatalf("render join: %v", err)
+				}
+				if strings.Contains(out, "kairos-etcd-restore") {
+					t.Error("etcd restore rendered on a join node")
+				}
+			})
+		}
+	}
+}
+
+// TestEtcdRestore_ScriptValidBash runs `bash -n` on the restore script.
+func TestEtcdRestore_ScriptValidBash(t *testing.T) {
+	bashPath, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available; skipping rendered-script syntax check")
+	}
+	f := filepathJoinTemp(t, "etcd-restore.sh")
+	if err := os.WriteFile(f, []byte(etcdRestoreScript()), 0o600); err != nil {
+		t.Fatalf("write temp script: %v", err)
+	}
+	if b, err := exec.Command(bashPath, "-n", f).CombinedOutput(); err != nil {
+		t.Fatalf("etcd restore script is not valid bash: %v\n%s", err, b)
+	}
+}
+
+func TestEtcdRestore_ValidationRejects(t *testing.T) {
+	cases := []struct {
+		name     string
+		backup   bool
+		location string
+		wantErr  string
+	}{
+		{"no backup config", false, testRestoreLocation, "requires etcdBackup"},
+		{"other bucket", true, "http://minio.backup.svc:9000/other/snap.db", "etcdRestore.location"},
+		{"traversal", true, "http://minio.backup.svc:9000/etcd-backups/a/../../snap.db", "etcdRestore.location"},
+		{"quote", true, `http://minio.backup.svc:9000/etcd-backups/a'b`, "etcdRestore.location"},
+		{"newline", true, "http://minio.backup.svc:9000/etcd-backups/a\nb", "control character"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := haCPData("init", false)
+			if tc.backup {
+				d.EtcdBackup = etcdBackupConfig()
+			}
+			d.EtcdRestore = &EtcdRestoreConfig{Location: tc.location}
+			_, err := RenderK3sCloudConfig(d)
+			if err == nil {
+				t.Fatalf("render accepted invalid input; want error containing %q", tc.wantErr)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("error %q does not contain %q", err.Error(), tc.wantErr)
+			}
+		})
+	}
+}
@@ -41,14 +41,37 @@ import (
 //   - quotes scalars containing YAML metacharacters (`:`, `#`, `---`, etc.).
 func newFuncMap() template.FuncMap {
 	return template.FuncMap{
-		"quote":           quote,
-		"toYaml":          toYaml,
-		"shquote":         shquote,
-		"indent":          safeIndent,
-		"nindent":         nindent,
-		"trimSuffix":      trimSuffix,
-		"persistencyOEM":  persistencyOEM,
-		"kubeVIPManifest": kubeVIPManifest,
+		"quote":                   quote,
+		"toYaml":                  toYaml,
+		"shquote":                 shquote,
+		"indent":                  safeIndent,
+		"nindent":                 nindent,
+		"trimSuffix":              trimSuffix,
+		"persistencyOEM":          persistencyOEM,
+		"kubeVIPManifest":         kubeVIPManifest,
+		"distributionVersionGate": distributionVersionGate,
+		"distributionReleaseEnv":  distributionReleaseEnv,
+		"etcdBackupScript":        etcdBackupScript,
+		"etcdBackupEnv":           etcdBackupEnv,
+		"etcdRestoreScript":       etcdRestoreScript,
+		"etcdRestoreEnv":          etcdRestoreEnv,
+		"certExpiryScript":        certExpiryScript,
+		"registryFiles":           registryFiles,
+		"proxyEnv":                proxyEnv,
+		"proxyUnits":              proxyUnits,
+		"airgapImagesPreload":     airgapImagesPreload,
+		"airgapImagesEnv":         airgapImagesEnv,
+		"networkFiles":            networkFiles,
+		"networkApply":            networkApply,
+		"networkApplyLinks":       networkApplyLinks,
+		"k0sNodeArgs":             k0sNodeArgs,
+		"k0sKubeletExtraArgs":     k0sKubeletExtraArgs,
+		"k3sKubeletConfig":        k3sKubeletConfig,
+		"k0sClusterConfig":        k0sClusterConfig,
+		"k3sUserConfig":           k3sUserConfig,
+		"k3sCNIConfig":            k3sCNIConfig,
+		"serverCIDRConfig":        serverCIDRConfig,
+		"rke2CNIConfig":           rke2CNIConfig,
 	}
 }
 
@@ -20,6 +20,7 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
@@ -39,7 +40,7 @@ var updateGolden = flag.Bool("update", false, "regenerate golden files under tes
 // goldenCase is one (distribution, infra, role) render fixture.
 type goldenCase struct {
 	name   string                             // golden file basename (without .yaml)
-	render func(TemplateData) (string, error) // RenderK0sCloudConfig / RenderK3sCloudConfig
+	render func(TemplateData) (string, error) // RenderK0sCloudConfig / RenderK3sCloudConfig / RenderRKE2CloudConfig
 	data   TemplateData
 }
 
@@ -87,6 +88,7 @@ func goldenCases() []goldenCase {
 			KubeconfigSecretName:      "cluster-kubeconfig",
 			KubeconfigSecretNamespace: "default",
 			ClusterName:               "ha-cluster",
+			CABundle:                  testManagementCA,
 			ControlPlaneEndpointHost:  host,
 		}
 		return d
@@ -98,20 +100,26 @@ func goldenCases() []goldenCase {
 		{"k3s_capv_single", RenderK3sCloudConfig, base(bootstrapv1beta2.ControlPlaneRoleSingle, true, false, false)},
 		{"k0s_capk_single", RenderK0sCloudConfig, base(bootstrapv1beta2.ControlPlaneRoleSingle, true, true, false)},
 		{"k3s_capk_single", RenderK3sCloudConfig, base(bootstrapv1beta2.ControlPlaneRoleSingle, true, true, false)},
+		{"rke2_capv_single", RenderRKE2CloudConfig, base(bootstrapv1beta2.ControlPlaneRoleSingle, true, false, false)},
+		{"rke2_capk_single", RenderRKE2CloudConfig, base(bootstrapv1beta2.ControlPlaneRoleSingle, true, true, false)},
 
 		// --- init (HA first node, CAPV: kube-vip + etcd-health reporter rendered) ---
-		{"k0s_capv_init", RenderK0sCloudConfig, withEtcdStatusSecretName(withJoinTokenSecretName(withEndpoint(withVIP(base(bootstrapv1beta2.ControlPlaneRoleInit, false, false, false)), "192.168.1.240"), "ha-cluster-control-plane-join-token"), "ha-cluster-etcd-status")},
+		{"k0s_capv_init", RenderK0sCloudConfig, withEtcdStatusSecretName(withWorkerTokenSecretName(withJoinTokenSecretName(withEndpoint(withVIP(base(bootstrapv1beta2.ControlPlaneRoleInit, false, false, false)), "192.168.1.240"), "ha-cluster-control-plane-join-token"), "ha-cluster-worker-token"), "ha-cluster-etcd-status")},
 		{"k3s_capv_init", RenderK3sCloudConfig, withEtcdStatusSecretName(withEndpoint(withVIP(base(bootstrapv1beta2.ControlPlaneRoleInit, false, false, false)), "192.168.1.240"), "ha-cluster-etcd-status")},
+		{"rke2_capv_init", RenderRKE2CloudConfig, withEtcdStatusSecretName(withEndpoint(withVIP(base(bootstrapv1beta2.ControlPlaneRoleInit, false, false, false)), "192.168.1.240"), "ha-cluster-etcd-status")},
 
 		// --- join (HA subsequent node, CAPV: kube-vip + etcd-health reporter rendered) ---
 		{"k0s_capv_join", RenderK0sCloudConfig, withEtcdStatusSecretName(withJoinToken(withEndpoint(withVIP(base(bootstrapv1beta2.ControlPlaneRoleJoin, false, false, false)), "192.168.1.240")), "ha-cluster-etcd-status")},
 		{"k3s_capv_join", RenderK3sCloudConfig, withEtcdStatusSecretName(withJoinToken(withEndpoint(withVIP(base(bootstrapv1beta2.ControlPlaneRoleJoin, false, false, false)), "192.168.1.240")), "ha-cluster-etcd-status")},
+		{"rke2_capv_join", RenderRKE2CloudConfig, withEtcdStatusSecretName(withJoinToken(withEndpoint(withVIP(base(bootstrapv1beta2.ControlPlaneRoleJoin, false, false, false)), "192.168.1.240")), "ha-cluster-etcd-status")},
 
 		// --- CAPK HA (NO kube-vip; OQ-5): init/join still branch, LB Service is the endpoint ---
-		{"k0s_capk_init", RenderK0sCloudConfig, withJoinTokenSecretName(capkHA(base(bootstrapv1beta2.ControlPlaneRoleInit, false, true, false)), "ha-cluster-control-plane-join-token")},
+		{"k0s_capk_init", RenderK0sCloudConfig, withWorkerTokenSecretName(withJoinTokenSecretName(capkHA(base(bootstrapv1beta2.ControlPlaneRoleInit, false, true, false)), "ha-cluster-control-plane-join-token"), "ha-cluster-worker-token")},
 		{"k3s_capk_init", RenderK3sCloudConfig, capkHA(base(bootstrapv1beta2.ControlPlaneRoleInit, false, true, false))},
 		{"k0s_capk_join", RenderK0sCloudConfig, withJoinToken(capkHA(base(bootstrapv1beta2.ControlPlaneRoleJoin, false, true, false)))},
 		{"k3s_capk_join", RenderK3sCloudConfig, withJoinToken(capkHA(base(bootstrapv1beta2.ControlPlaneRoleJoin, false, true, false)))},
+		{"rke2_capk_init", RenderRKE2CloudConfig, capkHA(base(bootstrapv1beta2.ControlPlaneRoleInit, false, true, false))},
+		{"rke2_capk_join", RenderRKE2CloudConfig, withJoinToken(capkHA(base(bootstrapv1beta2.ControlPlaneRoleJoin, false, true, false)))},
 	}
 }
 
@@ -129,6 +137,14 @@ func withJoinTokenSecretName(d TemplateData, name string) TemplateData {
 	return d
 }
 
+// withWorkerTokenSecretName stamps the k0s init-node worker-token push-block
+// gate (ManagementEndpoint.WorkerTokenSecretName). Requires ManagementEndpoint
+// set.
+func withWorkerTokenSecretName(d TemplateData, name string) TemplateData {
+	d.ManagementEndpoint.WorkerTokenSecretName = name
+	return d
+}
+
 // withEtcdStatusSecretName stamps the HA etcd-health reporter gate
 // (ManagementEndpoint.EtcdStatusSecretName, ADR 0005 §E.1). Set for every HA
 // control-plane node (init AND join, both distros) on the CAPV path so the
@@ -150,6 +166,7 @@ func capkHA(d TemplateData) TemplateData {
 		KubeconfigSecretName:      "cluster-kubeconfig",
 		KubeconfigSecretNamespace: "default",
 		ClusterName:               "ha-cluster",
+		CABundle:                  testManagementCA,
 	}
 	return d
 }
@@ -196,7 +213,7 @@ func TestGolden(t *testing.T) {
 
 // TestGolden_EmptyRoleEqualsSingle is the load-bearing backward-compat proof:
 // ControlPlaneRole=="" MUST render byte-identically to ControlPlaneRole=="single"
-// for the same inputs, across both distributions and both infra paths.
+// for the same inputs, across every distribution and both infra paths.
 func TestGolden_EmptyRoleEqualsSingle(t *testing.T) {
 	cases := []struct {
 		name   string
@@ -207,6 +224,8 @@ func TestGolden_EmptyRoleEqualsSingle(t *testing.T) {
 		{"k3s_capv", RenderK3sCloudConfig, singleEqualityData(false)},
 		{"k0s_capk", RenderK0sCloudConfig, singleEqualityData(true)},
 		{"k3s_capk", RenderK3sCloudConfig, singleEqualityData(true)},
+		{"rke2_capv", RenderRKE2CloudConfig, singleEqualityData(false)},
+		{"rke2_capk", RenderRKE2CloudConfig, singleEqualityData(true)},
 	}
 	for _, tc := range cases {
 		tc := tc
@@ -243,3 +262,35 @@ func singleEqualityData(kubevirt bool) TemplateData {
 		IsKubeVirt: kubevirt,
 	}
 }
+
+// TestGolden_NodePushVerifiesTLS asserts no render talks to the management
+// apiserver without TLS verification: every curl call pins the management CA,
+// and renders that carry a CABundle ship it as a 0600 file.
+func TestGolden_NodePushVerifiesTLS(t *testing.T) {
+	for _, tc := range goldenCases() {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := tc.render(tc.data)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			for _, insecure := range []string{"curl -k", "--insecure", "curl -sk"} {
+				if strings.Contains(out, insecure) {
+					t.Errorf("render contains %q; node-push must verify the management CA", insecure)
+				}
+			}
+			if tc.data.ManagementEndpoint == nil {
+				return
+			}
+			if !strings.Contains(out, "curl --cacert /usr/local/etc/kairos-capi/management-ca.crt") {
+				t.Error("node-push calls must use --cacert with the management CA file")
+			}
+			if got := extractWriteFile(t, out, "/usr/local/etc/kairos-capi/management-ca.crt"); got != tc.data.ManagementEndpoint.CABundle {
+				t.Errorf("management CA file did not round-trip:\n got: %q\nwant: %q", got, tc.data.ManagementEndpoint.CABundle)
+			}
+			if !strings.Contains(out, "- path: /usr/local/etc/kairos-capi/management-ca.crt\n    permissions: \"0600\"") {
+				t.Error("management CA file must be written 0600")
+			}
+		})
+	}
+}
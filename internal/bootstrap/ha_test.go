@@ -49,6 +49,7 @@ func haCPData(role string, kubevirt bool) TemplateData {
 			KubeconfigSecretName:      "cluster-kubeconfig",
 			KubeconfigSecretNamespace: "default",
 			ClusterName:               "ha-cluster",
+			CABundle:                  testManagementCA,
 		}
 	} else {
 		d.VIP = &VIPConfig{Address: "192.168.1.240", Interface: "eth0", Mode: "ARP"}
@@ -58,6 +59,7 @@ func haCPData(role string, kubevirt bool) TemplateData {
 			KubeconfigSecretName:      "cluster-kubeconfig",
 			KubeconfigSecretNamespace: "default",
 			ClusterName:               "ha-cluster",
+			CABundle:                  testManagementCA,
 			ControlPlaneEndpointHost:  "192.168.1.240",
 		}
 	}
@@ -128,6 +130,37 @@ func TestHA_InitVsSingle_K0s(t *testing.T) {
 	}
 }
 
+// TestHA_SingleReplicaMember_K0s asserts that the init/join member of a
+// one-replica control plane runs managed etcd (no --single, so it can take
+// joiners) and still schedules workloads like a --single node, on both infras.
+func TestHA_SingleReplicaMember_K0s(t *testing.T) {
+	for _, tc := range []struct {
+		role string
+		kv   bool
+	}{{"init", false}, {"init", true}, {"join", false}, {"join", true}} {
+		d := haCPData(tc.role, tc.kv)
+		d.SingleNode = true
+		out, err := RenderK0sCloudConfig(d)
+		if err != nil {
+			t.Fatalf("%s kubevirt=%v: render: %v", tc.role, tc.kv, err)
+		}
+		if strings.Contains(out, "- --single") {
+			t.Errorf("%s kubevirt=%v: must NOT contain --single", tc.role, tc.kv)
+		}
+		if strings.Count(out, "- --enable-worker") != 1 || !strings.Contains(out, "- --no-taints") {
+			t.Errorf("%s kubevirt=%v: must run as an untainted worker exactly once:\n%s", tc.role, tc.kv, out)
+		}
+	}
+
+	out, err := RenderK0sCloudConfig(haCPData("join", false))
+	if err != nil {
+		t.Fatalf("render HA join: %v", err)
+	}
+	if strings.Contains(out, "- --no-taints") {
+		t.Error("HA members of a multi-replica control plane keep the control-plane taint")
+	}
+}
+
 // TestHA_JoinTokenFile asserts join nodes write the token file and reference it,
 // across both distributions, and that the token round-trips (no shell/YAML
 // mangling of an opaque token).
@@ -206,6 +239,47 @@ func TestHA_K3sInitWritesAndUsesServerToken(t *testing.T) {
 	}
 }
 
+// TestHA_RKE2JoinUsesSupervisorPort: rke2 joiners register against the
+// supervisor port (9345) of the stable endpoint, and every HA server reads the
+// shared token from server-token; rke2 has no --cluster-init equivalent.
+func TestHA_RKE2JoinUsesSupervisorPort(t *testing.T) {
+	for _, tc := range []struct {
+		role, server string
+		kv           bool
+	}{
+		{"init", "", false},
+		{"join", "https://192.168.1.240:9345", false},
+		{"init", "", true},
+		{"join", "https://10.96.0.10:9345", true},
+	} {
+		name := tc.role
+		if tc.kv {
+			name += "/capk"
+		}
+		t.Run(name, func(t *testing.T) {
+			d := haCPData(tc.role, tc.kv)
+			d.JoinToken = "K10shared::server:tokenvalue"
+			out, err := RenderRKE2CloudConfig(d)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			var dropIn map[string]any
+			if err := yaml.Unmarshal([]byte(extractWriteFile(t, out, "/etc/rancher/rke2/config.yaml.d/10-kairos-server.yaml")), &dropIn); err != nil {
+				t.Fatalf("parse server drop-in: %v", err)
+			}
+			if dropIn["token-file"] != "/etc/rancher/rke2/server-token" {
+				t.Errorf("token-file = %v", dropIn["token-file"])
+			}
+			if got, _ := dropIn["server"].(string); got != tc.server {
+				t.Errorf("server = %q, want %q", got, tc.server)
+			}
+			if strings.TrimSpace(extractWriteFile(t, out, "/etc/rancher/rke2/server-token")) != d.JoinToken {
+				t.Error("rke2 server-token did not round-trip")
+			}
+		})
+	}
+}
+
 // TestHA_JoinTokenAdversarialRoundTrip asserts that adversarial-but-legal join
 // tokens (containing YAML-significant characters but no control chars) survive
 // the write_files block-scalar embed byte-for-byte, and that tokens carrying
@@ -228,7 +302,7 @@ func TestHA_JoinTokenAdversarialRoundTrip(t *testing.T) {
 		"tok\x00nul",
 	}
 
-	for _, render := range []func(TemplateData) (string, error){RenderK0sCloudConfig, RenderK3sCloudConfig} {
+	for _, render := range []func(TemplateData) (string, error){RenderK0sCloudConfig, RenderK3sCloudConfig, RenderRKE2CloudConfig} {
 		tokenPath := "/etc/k0s/controller-token"
 		for _, tok := range roundTrip {
 			d := haCPData("join", false)
@@ -241,6 +315,8 @@ func TestHA_JoinTokenAdversarialRoundTrip(t *testing.T) {
 			path := tokenPath
 			if strings.Contains(out, "/etc/rancher/k3s/server-token") {
 				path = "/etc/rancher/k3s/server-token"
+			} else if strings.Contains(out, "/etc/rancher/rke2/server-token") {
+				path = "/etc/rancher/rke2/server-token"
 			}
 			content := extractWriteFile(t, out, path)
 			if strings.TrimSpace(content) != tok {
@@ -698,12 +774,11 @@ func TestHA_RenderedScriptsValidBash(t *testing.T) {
 	}
 }
 
-// TestHA_EtcdLeaveResponder_k0sOnly asserts the ADR 0005 §E.3 etcd-leave
+// TestHA_EtcdLeaveResponder_k0s asserts the ADR 0005 §E.3 etcd-leave
 // responder renders on k0s CAPV HA nodes (valid bash; gates on the fixed
 // leave-requested sentinel via string equality; runs `k0s etcd leave` with NO
-// externally-supplied argument), and does NOT render for k0s single-node or for
-// k3s (no clean member-remove, KD-5d).
-func TestHA_EtcdLeaveResponder_k0sOnly(t *testing.T) {
+// externally-supplied argument), and does NOT render for k0s single-node.
+func TestHA_EtcdLeaveResponder_k0s(t *testing.T) {
 	bashPath, err := exec.LookPath("bash")
 	if err != nil {
 		t.Skip("bash not available; skipping rendered-script syntax check")
@@ -743,13 +818,23 @@ func TestHA_EtcdLeaveResponder_k0sOnly(t *testing.T) {
 	if extractWriteFile(t, sout, "kairos-etcd-leave.sh") != "" {
 		t.Error("k0s single-node must NOT render the etcd-leave responder")
 	}
+}
 
-	// k3s HA must NOT render it (KD-5d: no clean member-remove).
-	kout, err := RenderK3sCloudConfig(haCPData("init", false))
-	if err != nil {
-		t.Fatalf("render k3s init: %v", err)
-	}
-	if extractWriteFile(t, kout, "kairos-etcd-leave.sh") != "" {
-		t.Error("k3s must NOT render the etcd-leave responder (KD-5d)")
+// TestHA_NoEtcdLeaveResponder asserts k3s and rke2 render no etcd-leave
+// responder in any role: the controller removes their members through the
+// distribution's Node removal annotation, so the node needs no etcdctl.
+func TestHA_NoEtcdLeaveResponder(t *testing.T) {
+	single := haCPData("single", false)
+	single.SingleNode = true
+	for distro, render := range map[string]func(TemplateData) (string, error){"k3s": RenderK3sCloudConfig, "rke2": RenderRKE2CloudConfig} {
+		for name, d := range map[string]TemplateData{"init": haCPData("init", false), "join": haCPData("join", false), "single": single} {
+			out, err := render(d)
+			if err != nil {
+				t.Fatalf("render %s %s: %v", distro, name, err)
+			}
+			if strings.Contains(out, "kairos-etcd-leave") {
+				t.Errorf("%s %s must NOT render the etcd-leave responder", distro, name)
+			}
+		}
 	}
 }
@@ -0,0 +1,224 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// k0sConfigKeys are the ClusterConfig spec keys KairosConfig.Spec.K0sConfig
+// may set. Mirrors webhookK0sConfigKeys in the API package.
+var k0sConfigKeys = map[string]bool{
+	"api": true, "controllerManager": true, "extensions": true, "featureGates": true,
+	"images": true, "installConfig": true, "konnectivity": true, "network": true,
+	"scheduler": true, "storage": true, "telemetry": true, "workerProfiles": true,
+}
+
+// k0sClusterConfigDoc is the /etc/k0s/k0s.yaml document. The field order is
+// the order k0s itself writes.
+type k0sClusterConfigDoc struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec map[string]any `yaml:"spec"`
+}
+
+// k0sClusterConfig renders /etc/k0s/k0s.yaml: the user's ClusterConfig spec
+// fragment (KairosConfig.Spec.K0sConfig, may be nil) deep-merged with the
+// provider-owned keys. podCIDR and serviceCIDR, when set, become
+// network.podCIDR and network.serviceCIDR; every non-empty san is appended to
+// api.sans after the user's entries, without duplicates. A CNI selection sets
+// network.provider and, for Cilium, the Helm repository its Chart resource
+// installs from.
+//
+// SECURITY: like kubeVIPManifest, the document is a Go value tree serialized
+// with gopkg.in/yaml.v3, never string concatenation, so no fragment value can
+// break out of its scalar. validateK0sConfig has already rejected fragments
+// that set the provider-owned CIDRs.
+//
+// The output is indented by two spaces with list items under their key, the
+// layout the CAPK api.sans updater scripts edit in place with sed.
+func k0sClusterConfig(fragment map[string]any, cni *CNIConfig, podCIDR, serviceCIDR string, sans ...string) (string, error) {
+	spec, _ := deepCopyYAMLValue(fragment).(map[string]any)
+	if spec == nil {
+		spec = map[string]any{}
+	}
+	var providerSANs []string
+	for _, s := range sans {
+		if s != "" {
+			providerSANs = append(providerSANs, s)
+		}
+	}
+	if len(providerSANs) > 0 {
+		api, _ := spec["api"].(map[string]any)
+		if api == nil {
+			api = map[string]any{}
+		}
+		existing, _ := api["sans"].([]any)
+		seen := map[string]bool{}
+		for _, s := range existing {
+			if str, ok := s.(string); ok {
+				seen[str] = true
+			}
+		}
+		for _, s := range providerSANs {
+			if !seen[s] {
+				existing = append(existing, s)
+				seen[s] = true
+			}
+		}
+		api["sans"] = existing
+		spec["api"] = api
+	}
+	provider := k0sNetworkProvider(cni)
+	if podCIDR != "" || serviceCIDR != "" || provider != "" {
+		network, _ := spec["network"].(map[string]any)
+		if network == nil {
+			network = map[string]any{}
+		}
+		if podCIDR != "" {
+			network["podCIDR"] = podCIDR
+		}
+		if serviceCIDR != "" {
+			network["serviceCIDR"] = serviceCIDR
+		}
+		if provider != "" {
+			network["provider"] = provider
+		}
+		spec["network"] = network
+	}
+	if cni != nil && cni.Provider == "cilium" {
+		extensions, _ := spec["extensions"].(map[string]any)
+		if extensions == nil {
+			extensions = map[string]any{}
+		}
+		helm, _ := extensions["helm"].(map[string]any)
+		if helm == nil {
+			helm = map[string]any{}
+		}
+		repos, _ := helm["repositories"].([]any)
+		found := false
+		for _, r := range repos {
+			if m, ok := r.(map[string]any); ok && m["name"] == k0sCiliumRepoName {
+				found = true
+			}
+		}
+		if !found {
+			repos = append(repos, map[string]any{"name": k0sCiliumRepoName, "url": ciliumChartRepo})
+		}
+		helm["repositories"] = repos
+		extensions["helm"] = helm
+		spec["extensions"] = extensions
+	}
+
+	doc := k0sClusterConfigDoc{APIVersion: "k0s.k0sproject.io/v1beta1", Kind: "ClusterConfig", Spec: spec}
+	doc.Metadata.Name = "k0s"
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return "", fmt.Errorf("marshal k0s ClusterConfig: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("marshal k0s ClusterConfig: %w", err)
+	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
+
+// RenderHostedK0sConfig renders the ClusterConfig of a hosted control plane's
+// k0s controller. api.externalAddress is the address workers reach, and it
+// leads api.sans, followed by every non-empty san (the in-cluster Service
+// names). cni selects network.provider as on control-plane nodes; nil keeps
+// kube-router.
+func RenderHostedK0sConfig(externalAddress string, cni *CNIConfig, sans ...string) (string, error) {
+	fragment := map[string]any{"api": map[string]any{"externalAddress": externalAddress}}
+	return k0sClusterConfig(fragment, cni, "", "", append([]string{externalAddress}, sans...)...)
+}
+
+// deepCopyYAMLValue copies the maps and slices of a decoded YAML/JSON value so
+// the merge in k0sClusterConfig never writes into the caller's fragment.
+func deepCopyYAMLValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, e := range t {
+			out[k] = deepCopyYAMLValue(e)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			out[i] = deepCopyYAMLValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// validateK0sConfig re-applies the webhook checks on the ClusterConfig spec
+// fragment at render time. haControlPlane is true on HA init and join nodes,
+// which must keep k0s's etcd storage.
+func validateK0sConfig(fragment map[string]any, haControlPlane bool) error {
+	var errs []error
+	keys := make([]string, 0, len(fragment))
+	for k := range fragment {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !k0sConfigKeys[k] {
+			errs = append(errs, fmt.Errorf("k0sConfig.%s is not a ClusterConfig spec key", k))
+		}
+	}
+	if network, ok := fragment["network"].(map[string]any); ok {
+		for _, k := range []string{"podCIDR", "serviceCIDR"} {
+			if _, set := network[k]; set {
+				errs = append(errs, fmt.Errorf("k0sConfig.network.%s is set by the provider from %s", k, k))
+			}
+		}
+	}
+	if api, ok := fragment["api"].(map[string]any); ok {
+		if sans, set := api["sans"]; set {
+			list, ok := sans.([]any)
+			for _, s := range list {
+				if _, isString := s.(string); !isString {
+					ok = false
+				}
+			}
+			if !ok {
+				errs = append(errs, errors.New("k0sConfig.api.sans must be a list of strings"))
+			}
+		}
+	}
+	if haControlPlane {
+		if storage, ok := fragment["storage"].(map[string]any); ok {
+			if t, set := storage["type"]; set && t != "etcd" {
+				errs = append(errs, fmt.Errorf("k0sConfig.storage.type %v: an HA control plane requires etcd storage", t))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// k0sConfigFragment switches the CNI to Calico with IPVS kube-proxy and lists
+// one extra SAN, as decoded from spec.k0sConfig.
+func k0sConfigFragment() map[string]any {
+	return map[string]any{
+		"api": map[string]any{"sans": []any{"api.corp.example.com", "192.168.1.240"}},
+		"network": map[string]any{
+			"provider":  "calico",
+			"kubeProxy": map[string]any{"mode": "ipvs"},
+		},
+		"telemetry": map[string]any{"enabled": false},
+	}
+}
+
+// parseK0sClusterConfig decodes a rendered /etc/k0s/k0s.yaml.
+func parseK0sClusterConfig(t *testing.T, content string) map[string]any {
+	t.Helper()
+	var doc map[string]any
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		t.Fatalf("parse k0s.yaml: %v\n%s", err, content)
+	}
+	return doc
+}
+
+// TestK0sClusterConfig_Merge asserts the fragment is kept, the provider CIDRs
+// are set beside it and the provider SANs are appended once.
+func TestK0sClusterConfig_Merge(t *testing.T) {
+	fragment := k0sConfigFragment()
+	out, err := k0sClusterConfig(fragment, nil, "10.244.0.0/16", "10.96.0.0/12", "192.168.1.240", "", "10.0.0.5")
+	if err != nil {
+		t.Fatalf("k0sClusterConfig: %v", err)
+	}
+	doc := parseK0sClusterConfig(t, out)
+	if doc["apiVersion"] != "k0s.k0sproject.io/v1beta1" || doc["kind"] != "ClusterConfig" {
+		t.Errorf("header = %v %v", doc["apiVersion"], doc["kind"])
+	}
+	spec := doc["spec"].(map[string]any)
+	network := spec["network"].(map[string]any)
+	if network["provider"] != "calico" || network["kubeProxy"].(map[string]any)["mode"] != "ipvs" {
+		t.Errorf("network = %v", network)
+	}
+	if network["podCIDR"] != "10.244.0.0/16" || network["serviceCIDR"] != "10.96.0.0/12" {
+		t.Errorf("provider CIDRs = %v", network)
+	}
+	if spec["telemetry"].(map[string]any)["enabled"] != false {
+		t.Errorf("telemetry = %v", spec["telemetry"])
+	}
+	var sans []string
+	for _, s := range spec["api"].(map[string]any)["sans"].([]any) {
+		sans = append(sans, s.(string))
+	}
+	if got := strings.Join(sans, ","); got != "api.corp.example.com,192.168.1.240,10.0.0.5" {
+		t.Errorf("api.sans = %s", got)
+	}
+	if _, set := fragment["network"].(map[string]any)["podCIDR"]; set {
+		t.Error("k0sClusterConfig wrote into the caller's fragment")
+	}
+	if len(fragment["api"].(map[string]any)["sans"].([]any)) != 2 {
+		t.Error("k0sClusterConfig appended to the caller's api.sans")
+	}
+}
+
+// TestK0sClusterConfig_Layout pins the provider-only document: the CAPK SAN
+// updater scripts edit it in place, so the layout must not drift.
+func TestK0sClusterConfig_Layout(t *testing.T) {
+	out, err := k0sClusterConfig(nil, nil, "10.244.0.0/16", "", "10.96.0.10")
+	if err != nil {
+		t.Fatalf("k0sClusterConfig: %v", err)
+	}
+	want := `apiVersion: k0s.k0sproject.io/v1beta1
+kind: ClusterConfig
+metadata:
+  name: k0s
+spec:
+  api:
+    sans:
+      - 10.96.0.10
+  network:
+    podCIDR: 10.244.0.0/16`
+	if out != want {
+		t.Errorf("k0s.yaml =\n%s\nwant\n%s", out, want)
+	}
+}
+
+// TestRenderHostedK0sConfig asserts the hosted controller's ClusterConfig
+// publishes the external address, lists it first in api.sans and maps the
+// CNI selection onto network.provider.
+func TestRenderHostedK0sConfig(t *testing.T) {
+	out, err := RenderHostedK0sConfig("203.0.113.10", &CNIConfig{Provider: "calico"},
+		"c1-k0s-controller", "", "c1-k0s-controller.ns.svc")
+	if err != nil {
+		t.Fatalf("RenderHostedK0sConfig: %v", err)
+	}
+	spec := parseK0sClusterConfig(t, out)["spec"].(map[string]any)
+	api := spec["api"].(map[string]any)
+	if api["externalAddress"] != "203.0.113.10" {
+		t.Errorf("api.externalAddress = %v", api["externalAddress"])
+	}
+	var sans []string
+	for _, s := range api["sans"].([]any) {
+		sans = append(sans, s.(string))
+	}
+	if got := strings.Join(sans, ","); got != "203.0.113.10,c1-k0s-controller,c1-k0s-controller.ns.svc" {
+		t.Errorf("api.sans = %s", got)
+	}
+	if p := spec["network"].(map[string]any)["provider"]; p != "calico" {
+		t.Errorf("network.provider = %v", p)
+	}
+
+	out, err = RenderHostedK0sConfig("cp.example.com", nil)
+	if err != nil {
+		t.Fatalf("RenderHostedK0sConfig: %v", err)
+	}
+	if _, set := parseK0sClusterConfig(t, out)["spec"].(map[string]any)["network"]; set {
+		t.Errorf("default CNI rendered a network block:\n%s", out)
+	}
+}
+
+// TestK0sConfig_Rendered asserts both k0s templates write the merged
+// k0s.yaml and point k0s at it when only spec.k0sConfig is set.
+func TestK0sConfig_Rendered(t *testing.T) {
+	for _, kv := range []bool{false, true} {
+		name := "capv"
+		if kv {
+			name = "capk"
+		}
+		t.Run(name, func(t *testing.T) {
+			d := TemplateData{Role: "control-plane", Hostname: "cp", UserName: "kairos", IsKubeVirt: kv,
+				K0sConfig: k0sConfigFragment()}
+			out, err := RenderK0sCloudConfig(d)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			parseRendered(t, out)
+			found := false
+			for _, a := range k0sArgs(t, out) {
+				found = found || a == "--config /etc/k0s/k0s.yaml"
+			}
+			if !found {
+				t.Errorf("k0s args missing --config:\n%s", out)
+			}
+			spec := parseK0sClusterConfig(t, extractWriteFile(t, out, "/etc/k0s/k0s.yaml"))["spec"].(map[string]any)
+			if spec["network"].(map[string]any)["provider"] != "calico" {
+				t.Errorf("k0s.yaml spec = %v", spec)
+			}
+		})
+	}
+}
+
+// TestK0sConfig_HAKeepsProviderSANs: on HA init nodes the stable endpoint is
+// still added to api.sans next to the user's entries.
+func TestK0sConfig_HAKeepsProviderSANs(t *testing.T) {
+	for _, kv := range []bool{false, true} {
+		d := haCPData("init", kv)
+		d.K0sConfig = map[string]any{"api": map[string]any{"sans": []any{"api.corp.example.com"}}}
+		out, err := RenderK0sCloudConfig(d)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		content := extractWriteFile(t, out, "/etc/k0s/k0s.yaml")
+		endpoint := "192.168.1.240"
+		if kv {
+			endpoint = d.ControlPlaneLBEndpoint
+		}
+		if !strings.Contains(content, "- api.corp.example.com\n      - "+endpoint) {
+			t.Errorf("kubevirt=%v api.sans missing user or provider entry:\n%s", kv, content)
+		}
+	}
+}
+
+func TestValidateK0sConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(f map[string]any)
+		ha      bool
+		wantErr string
+	}{
+		{"valid", func(map[string]any) {}, false, ""},
+		{"valid HA with etcd", func(f map[string]any) { f["storage"] = map[string]any{"type": "etcd"} }, true, ""},
+		{"kine without HA", func(f map[string]any) { f["storage"] = map[string]any{"type": "kine"} }, false, ""},
+		{"unknown key", func(f map[string]any) { f["apiVersion"] = "k0s.k0sproject.io/v1beta1" }, false, "k0sConfig.apiVersion"},
+		{"podCIDR", func(f map[string]any) { f["network"].(map[string]any)["podCIDR"] = "10.0.0.0/8" }, false, "network.podCIDR"},
+		{"serviceCIDR", func(f map[string]any) { f["network"].(map[string]any)["serviceCIDR"] = "10.0.0.0/8" }, false, "network.serviceCIDR"},
+		{"sans not a list", func(f map[string]any) { f["api"].(map[string]any)["sans"] = "a" }, false, "api.sans"},
+		{"sans with number", func(f map[string]any) { f["api"].(map[string]any)["sans"] = []any{"a", 1} }, false, "api.sans"},
+		{"kine on HA", func(f map[string]any) { f["storage"] = map[string]any{"type": "kine"} }, true, "requires etcd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := k0sConfigFragment()
+			tt.mutate(f)
+			err := validateK0sConfig(f, tt.ha)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// K3sConfig is the render-ready view of KairosConfig.Spec.K3sConfig: k3s
+// configuration file options keyed by flag name. The controller leaves it nil
+// when neither section is set.
+type K3sConfig struct {
+	Server map[string]any
+	Agent  map[string]any
+}
+
+// k3sConfigKeyPattern and k3sReservedKeys mirror the webhook checks on
+// K3sConfig.
+var k3sConfigKeyPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*\+?$`)
+
+var k3sReservedKeys = map[string]bool{
+	"token": true, "token-file": true, "agent-token": true, "agent-token-file": true,
+	"server": true, "cluster-init": true, "tls-san": true, "node-ip": true, "node-external-ip": true,
+	"kubelet-arg": true, "node-label": true, "node-taint": true, "private-registry": true,
+}
+
+// k3sUserConfig renders the k3s drop-in
+// /etc/rancher/k3s/config.yaml.d/93-kairos-k3s.yaml: the agent options on
+// every node plus the server options on control-plane nodes. It returns ""
+// when the node gets no options, so the template can skip the file. The
+// document is marshaled by yaml.v3, which quotes every value as needed.
+func k3sUserConfig(role string, c *K3sConfig) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	opts := map[string]any{}
+	for k, v := range c.Agent {
+		opts[k] = v
+	}
+	if role == "control-plane" {
+		for k, v := range c.Server {
+			opts[k] = v
+		}
+	}
+	if len(opts) == 0 {
+		return "", nil
+	}
+	b, err := yaml.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("marshal k3s config: %w", err)
+	}
+	return strings.TrimRight(string(b), "\n"), nil
+}
+
+// serverCIDRConfig renders the k3s or rke2 server drop-in
+// config.yaml.d/91-kairos-cidr.yaml from spec.podCIDR and spec.serviceCIDR,
+// or "" when neither is set. It sorts before the user's k3sConfig drop-in,
+// whose cluster-cidr and service-cidr are rejected when these are set.
+func serverCIDRConfig(podCIDR, serviceCIDR string) (string, error) {
+	opts := map[string]string{}
+	if podCIDR != "" {
+		opts["cluster-cidr"] = podCIDR
+	}
+	if serviceCIDR != "" {
+		opts["service-cidr"] = serviceCIDR
+	}
+	if len(opts) == 0 {
+		return "", nil
+	}
+	b, err := yaml.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("marshal server CIDR config: %w", err)
+	}
+	return strings.TrimRight(string(b), "\n"), nil
+}
+
+// validateK3sConfig re-applies the webhook checks at render time.
+func validateK3sConfig(c *K3sConfig, role string) error {
+	var errs []error
+	if len(c.Server) > 0 && role != "control-plane" {
+		errs = append(errs, errors.New("k3sConfig.server applies to control-plane nodes only"))
+	}
+	for _, section := range []struct {
+		name string
+		opts map[string]any
+	}{{"server", c.Server}, {"agent", c.Agent}} {
+		keys := make([]string, 0, len(section.opts))
+		for k := range section.opts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			switch {
+			case !k3sConfigKeyPattern.MatchString(k):
+				errs = append(errs, fmt.Errorf("k3sConfig.%s key %q must be a k3s flag name without leading dashes", section.name, k))
+			case k3sReservedKeys[strings.TrimSuffix(k, "+")]:
+				errs = append(errs, fmt.Errorf("k3sConfig.%s[%s] is managed by the provider", section.name, k))
+			case !isK3sConfigValue(section.opts[k]):
+				errs = append(errs, fmt.Errorf("k3sConfig.%s[%s] must be a string, number, boolean or a list of those", section.name, k))
+			}
+			if _, dup := c.Server[k]; dup && section.name == "agent" {
+				errs = append(errs, fmt.Errorf("k3sConfig.agent[%s] is also set in k3sConfig.server", k))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isK3sConfigValue reports whether v is a scalar or a list of scalars, the
+// only shapes a k3s configuration file option takes.
+func isK3sConfigValue(v any) bool {
+	if list, ok := v.([]any); ok {
+		for _, e := range list {
+			if !isK3sConfigScalar(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return isK3sConfigScalar(v)
+}
+
+func isK3sConfigScalar(v any) bool {
+	switch v.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// k3sConfig disables the bundled ingress and load balancer on servers and
+// sets a kube-proxy flag on every node, as decoded from spec.k3sConfig.
+func k3sConfig() *K3sConfig {
+	return &K3sConfig{
+		Server: map[string]any{
+			"disable":                 []any{"traefik", "servicelb"},
+			"flannel-backend":         "wireguard-native",
+			"etcd-snapshot-retention": 10,
+			"secrets-encryption":      true,
+		},
+		Agent: map[string]any{
+			"kube-proxy-arg+": []any{"proxy-mode=ipvs"},
+		},
+	}
+}
+
+const k3sUserConfigPath = "/etc/rancher/k3s/config.yaml.d/93-kairos-k3s.yaml"
+
+// TestK3sConfig_Rendered asserts control planes get both sections and
+// workers only the agent section, on both k3s templates.
+func TestK3sConfig_Rendered(t *testing.T) {
+	for _, kv := range []bool{false, true} {
+		for _, role := range []string{"control-plane", "worker"} {
+			name := role
+			if kv {
+				name += "/capk"
+			}
+			t.Run(name, func(t *testing.T) {
+				d := haCPData("init", kv)
+				d.K3sConfig = k3sConfig()
+				if role == "worker" {
+					d = TemplateData{Role: "worker", Hostname: "w", UserName: "kairos",
+						K3sServerURL: "https://10.0.0.1:6443", K3sToken: "tok", IsKubeVirt: kv,
+						K3sConfig: &K3sConfig{Agent: k3sConfig().Agent}}
+				}
+				out, err := RenderK3sCloudConfig(d)
+				if err != nil {
+					t.Fatalf("render: %v", err)
+				}
+				parseRendered(t, out)
+				var got map[string]any
+				if err := yaml.Unmarshal([]byte(extractWriteFile(t, out, k3sUserConfigPath)), &got); err != nil {
+					t.Fatalf("parse drop-in: %v", err)
+				}
+				if got["kube-proxy-arg+"].([]any)[0] != "proxy-mode=ipvs" {
+					t.Errorf("agent option missing: %v", got)
+				}
+				_, hasServer := got["flannel-backend"]
+				if hasServer != (role == "control-plane") {
+					t.Errorf("server options rendered = %v on %s: %v", hasServer, role, got)
+				}
+				if role == "control-plane" && (got["etcd-snapshot-retention"] != 10 || got["secrets-encryption"] != true) {
+					t.Errorf("server option types not kept: %v", got)
+				}
+			})
+		}
+	}
+}
+
+// TestK3sConfig_AbsentByDefault: without spec.k3sConfig, or with no options
+// for the node's role, no drop-in is written.
+func TestK3sConfig_AbsentByDefault(t *testing.T) {
+	out, err := RenderK3sCloudConfig(haCPData("join", false))
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if strings.Contains(out, "93-kairos-k3s.yaml") {
+		t.Error("k3s config drop-in rendered without spec.k3sConfig")
+	}
+	if got, _ := k3sUserConfig("worker", &K3sConfig{}); got != "" {
+		t.Errorf("empty k3sConfig rendered %q", got)
+	}
+}
+
+func TestValidateK3sConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    string
+		mutate  func(c *K3sConfig)
+		wantErr string
+	}{
+		{"valid", "control-plane", func(*K3sConfig) {}, ""},
+		{"append key", "control-plane", func(c *K3sConfig) { c.Server["disable+"] = []any{"metrics-server"} }, ""},
+		{"server on worker", "worker", func(*K3sConfig) {}, "control-plane nodes only"},
+		{"flag with dashes", "control-plane", func(c *K3sConfig) { c.Server["--disable"] = "traefik" }, "flag name"},
+		{"reserved token", "control-plane", func(c *K3sConfig) { c.Server["token"] = "x" }, "k3sConfig.server[token] is managed"},
+		{"reserved append", "control-plane", func(c *K3sConfig) { c.Agent["node-label+"] = []any{"a=b"} }, "k3sConfig.agent[node-label+]"},
+		{"nested object", "control-plane", func(c *K3sConfig) { c.Server["etcd"] = map[string]any{"a": 1} }, "k3sConfig.server[etcd]"},
+		{"list of objects", "control-plane", func(c *K3sConfig) { c.Agent["kubelet-x"] = []any{map[string]any{}} }, "k3sConfig.agent[kubelet-x]"},
+		{"both sections", "control-plane", func(c *K3sConfig) { c.Agent["flannel-backend"] = "vxlan" }, "also set in k3sConfig.server"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := k3sConfig()
+			tt.mutate(c)
+			err := validateK3sConfig(c, tt.role)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestK3sConfig_CIDRConflict: k3sConfig must not set the CIDRs the provider
+// renders from spec.podCIDR and spec.serviceCIDR.
+func TestK3sConfig_CIDRConflict(t *testing.T) {
+	d := haCPData("init", false)
+	d.PodCIDR = "10.50.0.0/16"
+	d.K3sConfig = &K3sConfig{Server: map[string]any{"cluster-cidr": "10.60.0.0/16", "service-cidr": "10.61.0.0/16"}}
+	_, err := RenderK3sCloudConfig(d)
+	if err == nil || !strings.Contains(err.Error(), "k3sConfig.server[cluster-cidr] is set by the provider from podCIDR") {
+		t.Fatalf("error = %v, want the cluster-cidr conflict", err)
+	}
+	if strings.Contains(err.Error(), "service-cidr") {
+		t.Errorf("service-cidr rejected without spec.serviceCIDR: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// KubeletConfig is the render-ready view of KairosConfig.Spec.NodeLabels,
+// NodeTaints and KubeletExtraArgs. The controller leaves it nil when all three
+// are empty. Every field is re-validated at render time by validateKubelet.
+type KubeletConfig struct {
+	Labels    map[string]string
+	Taints    []NodeTaintConfig
+	ExtraArgs map[string]string
+}
+
+// NodeTaintConfig is one registration taint.
+type NodeTaintConfig struct {
+	Key    string
+	Value  string
+	Effect string
+}
+
+// sortedPairs returns m as "key=value" strings in key order, so renders are
+// deterministic.
+func sortedPairs(m map[string]string) []string {
+	pairs := make([]string, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		pairs = append(pairs, k+"="+m[k])
+	}
+	return pairs
+}
+
+// taintStrings returns the taints in the kubelet --register-with-taints form,
+// key=value:Effect, or key:Effect when the value is empty.
+func taintStrings(taints []NodeTaintConfig) []string {
+	out := make([]string, 0, len(taints))
+	for _, t := range taints {
+		if t.Value == "" {
+			out = append(out, t.Key+":"+t.Effect)
+			continue
+		}
+		out = append(out, t.Key+"="+t.Value+":"+t.Effect)
+	}
+	return out
+}
+
+// k0sNodeArgs returns the k0s --labels and --taints flags for k, as k0s.args
+// or k0s-worker.args list items. Label and taint syntax admits no whitespace,
+// quotes or YAML indicators, so the items need no quoting.
+func k0sNodeArgs(k *KubeletConfig) []string {
+	if k == nil {
+		return nil
+	}
+	var args []string
+	if len(k.Labels) > 0 {
+		args = append(args, "--labels="+strings.Join(sortedPairs(k.Labels), ","))
+	}
+	if len(k.Taints) > 0 {
+		args = append(args, "--taints="+strings.Join(taintStrings(k.Taints), ","))
+	}
+	return args
+}
+
+// k0sKubeletExtraArgs returns the single k0s --kubelet-extra-args list item
+// carrying the provider ID (empty for Metal3, where CAPM3 owns it) and the
+// user's kubelet flags. k0s honors only one --kubelet-extra-args, so both
+// share it.
+//
+// Without user flags the item is exactly --kubelet-extra-args=--provider-id=X,
+// as before. With them the value holds spaces, so the item is wrapped in
+// double quotes that survive into the service command line, where systemd
+// keeps the quoted word together. validateKubelet holds every value to
+// kubeletArgValuePattern, which excludes quotes, '$', '%' and backslashes, so
+// nothing inside the quotes is expanded.
+func k0sKubeletExtraArgs(providerID string, k *KubeletConfig) string {
+	var flags []string
+	if providerID != "" {
+		flags = append(flags, "--provider-id="+providerID)
+	}
+	if k != nil {
+		for _, p := range sortedPairs(k.ExtraArgs) {
+			flags = append(flags, "--"+p)
+		}
+	}
+	if len(flags) == 0 {
+		return ""
+	}
+	arg := "--kubelet-extra-args=" + strings.Join(flags, " ")
+	if len(flags) == 1 {
+		return arg
+	}
+	return `'"` + arg + `"'`
+}
+
+// k3sKubeletConfig renders the k3s drop-in
+// /etc/rancher/k3s/config.yaml.d/92-kairos-kubelet.yaml. It sorts after
+// 90-provider-id.yaml, and its keys use the "+" suffix so k3s appends to the
+// node-label and kubelet-arg lists that file sets instead of replacing them.
+// yaml.v3 quotes every value as needed. rke2 reads the same keys from its
+// /etc/rancher/rke2/config.yaml.d and reuses this drop-in.
+func k3sKubeletConfig(k *KubeletConfig) (string, error) {
+	if k == nil {
+		return "", nil
+	}
+	doc := struct {
+		NodeLabel  []string `yaml:"node-label+,omitempty"`
+		NodeTaint  []string `yaml:"node-taint+,omitempty"`
+		KubeletArg []string `yaml:"kubelet-arg+,omitempty"`
+	}{
+		NodeLabel:  sortedPairs(k.Labels),
+		NodeTaint:  taintStrings(k.Taints),
+		KubeletArg: sortedPairs(k.ExtraArgs),
+	}
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\n"), nil
+}
+
+// kubeletArgNamePattern and kubeletArgValuePattern mirror the webhook checks
+// on KubeletExtraArgs.
+var (
+	kubeletArgNamePattern  = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	kubeletArgValuePattern = regexp.MustCompile(`^[A-Za-z0-9._:/=,@+<*-]{0,256}$`)
+)
+
+// kubeletReservedArgs are the kubelet flags KubeletExtraArgs must not set.
+var kubeletReservedArgs = map[string]string{
+	"provider-id":          "the provider sets the kubelet provider ID",
+	"node-labels":          "use nodeLabels",
+	"register-with-taints": "use nodeTaints",
+}
+
+// nodeLabelAllowed mirrors the webhook's node label namespace check: the
+// NodeRestriction admission plugin refuses kubernetes.io and k8s.io labels
+// outside kubelet.kubernetes.io and node.kubernetes.io, so a kubelet started
+// with one never registers.
+func nodeLabelAllowed(key string) bool {
+	prefix, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return true
+	}
+	prefix = strings.ToLower(prefix)
+	inDomain := func(domain string) bool { return prefix == domain || strings.HasSuffix(prefix, "."+domain) }
+	if !inDomain("kubernetes.io") && !inDomain("k8s.io") {
+		return true
+	}
+	return inDomain("kubelet.kubernetes.io") || inDomain("node.kubernetes.io")
+}
+
+// validateKubelet re-applies the webhook checks at render time. The values
+// land unquoted in k0s args and inside the quoted --kubelet-extra-args word,
+// so the syntax rules here are what keep them from breaking out.
+func validateKubelet(k *KubeletConfig) error {
+	var errs []error
+	for _, key := range sortedKeys(k.Labels) {
+		v := k.Labels[key]
+		if msgs := validation.IsQualifiedName(key); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("nodeLabels key %q: %s", key, strings.Join(msgs, "; ")))
+		}
+		if !nodeLabelAllowed(key) {
+			errs = append(errs, fmt.Errorf("nodeLabels key %q: only the kubelet.kubernetes.io and node.kubernetes.io prefixes are allowed in the kubernetes.io and k8s.io namespaces", key))
+		}
+		if msgs := validation.IsValidLabelValue(v); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("nodeLabels[%s] value %q: %s", key, v, strings.Join(msgs, "; ")))
+		}
+	}
+	for i, t := range k.Taints {
+		if msgs := validation.IsQualifiedName(t.Key); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("nodeTaints[%d].key %q: %s", i, t.Key, strings.Join(msgs, "; ")))
+		}
+		if msgs := validation.IsValidLabelValue(t.Value); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("nodeTaints[%d].value %q: %s", i, t.Value, strings.Join(msgs, "; ")))
+		}
+		switch t.Effect {
+		case "NoSchedule", "PreferNoSchedule", "NoExecute":
+		default:
+			errs = append(errs, fmt.Errorf("nodeTaints[%d].effect %q must be NoSchedule, PreferNoSchedule or NoExecute", i, t.Effect))
+		}
+	}
+	for _, name := range sortedKeys(k.ExtraArgs) {
+		v := k.ExtraArgs[name]
+		if !kubeletArgNamePattern.MatchString(name) {
+			errs = append(errs, fmt.Errorf("kubeletExtraArgs key %q must be a kubelet flag name without leading dashes", name))
+		} else if reason, ok := kubeletReservedArgs[name]; ok {
+			errs = append(errs, fmt.Errorf("kubeletExtraArgs[%s] is reserved: %s", name, reason))
+		}
+		if !kubeletArgValuePattern.MatchString(v) {
+			errs = append(errs, fmt.Errorf("kubeletExtraArgs[%s] value %q does not match required pattern %q", name, v, kubeletArgValuePattern.String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
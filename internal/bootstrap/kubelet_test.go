@@ -0,0 +1,219 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func kubeletConfig() *KubeletConfig {
+	return &KubeletConfig{
+		Labels: map[string]string{"node.example.com/pool": "gpu", "tier": "batch"},
+		Taints: []NodeTaintConfig{
+			{Key: "dedicated", Value: "gpu", Effect: "NoSchedule"},
+			{Key: "example.com/draining", Effect: "NoExecute"},
+		},
+		ExtraArgs: map[string]string{"max-pods": "200", "system-reserved": "cpu=500m,memory=1Gi"},
+	}
+}
+
+// k0sArgs returns the k0s or k0s-worker args list of a rendered k0s
+// cloud-config.
+func k0sArgs(t *testing.T, out string) []string {
+	t.Helper()
+	var doc struct {
+		K0s struct {
+			Args []string `yaml:"args"`
+		} `yaml:"k0s"`
+		K0sWorker struct {
+			Args []string `yaml:"args"`
+		} `yaml:"k0s-worker"`
+	}
+	if err := yaml.Unmarshal([]byte(strings.TrimPrefix(out, "#cloud-config\n")), &doc); err != nil {
+		t.Fatalf("parse rendered cloud-config: %v", err)
+	}
+	return append(doc.K0s.Args, doc.K0sWorker.Args...)
+}
+
+// TestKubelet_K0sArgs asserts k0s gets --labels, --taints and a single
+// --kubelet-extra-args that keeps the provider ID, on control-plane and
+// worker nodes.
+func TestKubelet_K0sArgs(t *testing.T) {
+	for _, kv := range []bool{false, true} {
+		for _, role := range []string{"control-plane", "worker"} {
+			name := role
+			if kv {
+				name += "/capk"
+			}
+			t.Run(name, func(t *testing.T) {
+				d := haCPData("init", kv)
+				if role == "worker" {
+					d = TemplateData{Role: "worker", Hostname: "w", UserName: "kairos", WorkerToken: "tok", IsKubeVirt: kv}
+				}
+				d.ProviderID = "vsphere://4207b5e2-0000-0000-0000-000000000001"
+				d.Kubelet = kubeletConfig()
+				out, err := RenderK0sCloudConfig(d)
+				if err != nil {
+					t.Fatalf("render: %v", err)
+				}
+				parseRendered(t, out)
+				args := k0sArgs(t, out)
+				want := []string{
+					"--labels=node.example.com/pool=gpu,tier=batch",
+					"--taints=dedicated=gpu:NoSchedule,example.com/draining:NoExecute",
+					`"--kubelet-extra-args=--provider-id=vsphere://4207b5e2-0000-0000-0000-000000000001 --max-pods=200 --system-reserved=cpu=500m,memory=1Gi"`,
+				}
+				for _, w := range want {
+					found := false
+					for _, a := range args {
+						found = found || a == w
+					}
+					if !found {
+						t.Errorf("k0s args %q missing %q", args, w)
+					}
+				}
+				n := 0
+				for _, a := range args {
+					if strings.Contains(a, "--kubelet-extra-args") {
+						n++
+					}
+				}
+				if n != 1 {
+					t.Errorf("--kubelet-extra-args rendered %d times, want 1", n)
+				}
+			})
+		}
+	}
+}
+
+// TestKubelet_K0sExtraArgsWithoutProviderID: Metal3 leaves the provider ID to
+// CAPM3, but the user's kubelet flags are still rendered. A single flag needs
+// no quoting.
+func TestKubelet_K0sExtraArgsWithoutProviderID(t *testing.T) {
+	d := TemplateData{Role: "worker", Hostname: "w", UserName: "kairos", WorkerToken: "tok", Metal3: true,
+		ProviderID: "metal3://0000", Kubelet: &KubeletConfig{ExtraArgs: map[string]string{"max-pods": "200"}}}
+	out, err := RenderK0sCloudConfig(d)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	args := k0sArgs(t, out)
+	if args[len(args)-1] != "--kubelet-extra-args=--max-pods=200" || strings.Contains(out, "--provider-id=") {
+		t.Errorf("k0s-worker args = %q", args)
+	}
+}
+
+// TestKubelet_K3sDropIn asserts every k3s template writes the config.yaml.d
+// drop-in with appending keys.
+func TestKubelet_K3sDropIn(t *testing.T) {
+	for _, kv := range []bool{false, true} {
+		for _, role := range []string{"control-plane", "worker"} {
+			t.Run(role, func(t *testing.T) {
+				d := haCPData("init", kv)
+				if role == "worker" {
+					d = TemplateData{Role: "worker", Hostname: "w", UserName: "kairos",
+						K3sServerURL: "https://10.0.0.1:6443", K3sToken: "tok", IsKubeVirt: kv}
+				}
+				d.Kubelet = kubeletConfig()
+				out, err := RenderK3sCloudConfig(d)
+				if err != nil {
+					t.Fatalf("render: %v", err)
+				}
+				parseRendered(t, out)
+				var got map[string][]string
+				if err := yaml.Unmarshal([]byte(extractWriteFile(t, out, "/etc/rancher/k3s/config.yaml.d/92-kairos-kubelet.yaml")), &got); err != nil {
+					t.Fatalf("parse drop-in: %v", err)
+				}
+				want := map[string][]string{
+					"node-label+":  {"node.example.com/pool=gpu", "tier=batch"},
+					"node-taint+":  {"dedicated=gpu:NoSchedule", "example.com/draining:NoExecute"},
+					"kubelet-arg+": {"max-pods=200", "system-reserved=cpu=500m,memory=1Gi"},
+				}
+				for k, v := range want {
+					if strings.Join(got[k], " ") != strings.Join(v, " ") {
+						t.Errorf("%s = %q, want %q", k, got[k], v)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestKubelet_AbsentByDefault: without labels, taints or kubelet flags the
+// k0s args and k3s drop-ins are unchanged.
+func TestKubelet_AbsentByDefault(t *testing.T) {
+	d := TemplateData{Role: "worker", Hostname: "w", UserName: "kairos", WorkerToken: "tok",
+		ProviderID: "vsphere://4207b5e2-0000-0000-0000-000000000001"}
+	out, err := RenderK0sCloudConfig(d)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(out, "- --kubelet-extra-args=--provider-id=vsphere://4207b5e2-0000-0000-0000-000000000001\n") ||
+		strings.Contains(out, "--labels=") || strings.Contains(out, "--taints=") {
+		t.Errorf("k0s args changed without spec.kubelet fields:\n%s", out)
+	}
+	out, err = RenderK3sCloudConfig(haCPData("join", false))
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if strings.Contains(out, "92-kairos-kubelet.yaml") {
+		t.Error("k3s kubelet drop-in rendered without labels, taints or kubelet flags")
+	}
+}
+
+func TestValidateKubelet(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(k *KubeletConfig)
+		wantErr string
+	}{
+		{"valid", func(*KubeletConfig) {}, ""},
+		{"empty label value", func(k *KubeletConfig) { k.Labels["empty"] = "" }, ""},
+		{"eviction threshold", func(k *KubeletConfig) { k.ExtraArgs["eviction-hard"] = "memory.available<500Mi" }, ""},
+		{"label key with space", func(k *KubeletConfig) { k.Labels["a b"] = "x" }, "nodeLabels key"},
+		{"node.kubernetes.io label", func(k *KubeletConfig) { k.Labels["node.kubernetes.io/pool"] = "gpu" }, ""},
+		{"node-role label", func(k *KubeletConfig) { k.Labels["node-role.kubernetes.io/worker"] = "" }, "nodeLabels key"},
+		{"label value with comma", func(k *KubeletConfig) { k.Labels["tier"] = "a,b" }, "nodeLabels[tier]"},
+		{"taint key with newline", func(k *KubeletConfig) { k.Taints[0].Key = "a\nb" }, "nodeTaints[0].key"},
+		{"bad taint effect", func(k *KubeletConfig) { k.Taints[1].Effect = "Evict" }, "nodeTaints[1].effect"},
+		{"flag name with dashes", func(k *KubeletConfig) { k.ExtraArgs["--max-pods"] = "1" }, "flag name"},
+		{"reserved provider-id", func(k *KubeletConfig) { k.ExtraArgs["provider-id"] = "aws://x" }, "reserved"},
+		{"reserved node-labels", func(k *KubeletConfig) { k.ExtraArgs["node-labels"] = "a=b" }, "use nodeLabels"},
+		{"value with space", func(k *KubeletConfig) { k.ExtraArgs["max-pods"] = "200 --anonymous-auth=true" }, "kubeletExtraArgs[max-pods]"},
+		{"value with quote", func(k *KubeletConfig) { k.ExtraArgs["max-pods"] = `200"` }, "kubeletExtraArgs[max-pods]"},
+		{"value with dollar", func(k *KubeletConfig) { k.ExtraArgs["max-pods"] = "$(id)" }, "kubeletExtraArgs[max-pods]"},
+		{"value with percent", func(k *KubeletConfig) { k.ExtraArgs["eviction-hard"] = "nodefs.available<10%" }, "kubeletExtraArgs[eviction-hard]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := kubeletConfig()
+			tt.mutate(k)
+			err := validateKubelet(k)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,490 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NetworkConfig is the render-ready view of KairosConfig.Spec.Network. It is
+// rendered into systemd-networkd .netdev/.network files by networkFiles,
+// written by the yip initramfs and network stages, and re-validated at render
+// time by validateNetwork.
+type NetworkConfig struct {
+	Interfaces []NetworkInterfaceConfig
+	Bonds      []NetworkBondConfig
+	VLANs      []NetworkVLANConfig
+}
+
+// NetworkAddressingConfig is the layer-3 configuration of one link. MTU is
+// zero when unset.
+type NetworkAddressingConfig struct {
+	DHCP4         bool
+	DHCP6         bool
+	Addresses     []string
+	Gateway4      string
+	Gateway6      string
+	Routes        []NetworkRouteConfig
+	Nameservers   []string
+	SearchDomains []string
+	MTU           int32
+}
+
+// NetworkInterfaceConfig is a physical link, matched by its permanent
+// MACAddress when set and by Name otherwise.
+type NetworkInterfaceConfig struct {
+	Name       string
+	MACAddress string
+	NetworkAddressingConfig
+}
+
+// NetworkBondConfig is a bond over Interfaces (names of
+// NetworkInterfaceConfig entries). Mode is empty for active-backup.
+type NetworkBondConfig struct {
+	Name       string
+	Interfaces []string
+	Mode       string
+	NetworkAddressingConfig
+}
+
+// NetworkVLANConfig is a tagged link on top of the interface or bond Link.
+type NetworkVLANConfig struct {
+	Name string
+	ID   int32
+	Link string
+	NetworkAddressingConfig
+}
+
+// NetworkRouteConfig is a static route. To is a CIDR or "default"; Metric is
+// nil when unset.
+type NetworkRouteConfig struct {
+	To     string
+	Via    string
+	Metric *int32
+}
+
+// networkdDir is where the rendered units land. The 05-kairos- prefix sorts
+// them before the image's catch-all DHCP .network files, so networkd picks
+// them for the links they match.
+const networkdDir = "/etc/systemd/network"
+
+// yipFile is one `files:` entry of a yip stage. Unlike write_files, yip takes
+// the permissions, owner and group as numbers.
+type yipFile struct {
+	Path        string `yaml:"path"`
+	Permissions uint32 `yaml:"permissions"`
+	Owner       int    `yaml:"owner"`
+	Group       int    `yaml:"group"`
+	Content     string `yaml:"content"`
+}
+
+// networkFiles renders one .network file per link and one .netdev file per
+// bond and VLAN, in declaration order, as yip stage files (rendered with
+// toYaml). Every value was validated by validateNetwork, so the unit files are
+// assembled as plain text.
+func networkFiles(n *NetworkConfig) []yipFile {
+	if n == nil {
+		return nil
+	}
+	bondOf := map[string]string{}
+	for _, b := range n.Bonds {
+		for _, m := range b.Interfaces {
+			bondOf[m] = b.Name
+		}
+	}
+	vlansOn := map[string][]string{}
+	for _, v := range n.VLANs {
+		vlansOn[v.Link] = append(vlansOn[v.Link], v.Name)
+	}
+	unit := func(name, ext string, sections ...string) yipFile {
+		return yipFile{
+			Path:        networkdDir + "/05-kairos-" + name + "." + ext,
+			Permissions: 0o644,
+			Content:     strings.Join(sections, "\n"),
+		}
+	}
+
+	var files []yipFile
+	for _, iface := range n.Interfaces {
+		match := "[Match]\nName=" + iface.Name + "\n"
+		if iface.MACAddress != "" {
+			// The permanent address: bonds and VLANs inherit the current
+			// one, and a bond rewrites its members' current address.
+			match = "[Match]\nPermanentMACAddress=" + strings.ToLower(iface.MACAddress) + "\n"
+		}
+		if bond, ok := bondOf[iface.Name]; ok {
+			sections := []string{match}
+			if iface.MTU != 0 {
+				sections = append(sections, linkSection(iface.MTU))
+			}
+			sections = append(sections, "[Network]\nBond="+bond+"\n")
+			files = append(files, unit(iface.Name, "network", sections...))
+			continue
+		}
+		files = append(files, unit(iface.Name, "network", networkSections(match, iface.NetworkAddressingConfig, vlansOn[iface.Name])...))
+	}
+	for _, b := range n.Bonds {
+		mode := b.Mode
+		if mode == "" {
+			mode = "active-backup"
+		}
+		files = append(files,
+			unit(b.Name, "netdev", "[NetDev]\nName="+b.Name+"\nKind=bond\n", "[Bond]\nMode="+mode+"\nMIIMonitorSec=100ms\n"),
+			unit(b.Name, "network", networkSections("[Match]\nName="+b.Name+"\n", b.NetworkAddressingConfig, vlansOn[b.Name])...))
+	}
+	for _, v := range n.VLANs {
+		files = append(files,
+			unit(v.Name, "netdev", "[NetDev]\nName="+v.Name+"\nKind=vlan\n", "[VLAN]\nId="+strconv.Itoa(int(v.ID))+"\n"),
+			unit(v.Name, "network", networkSections("[Match]\nName="+v.Name+"\n", v.NetworkAddressingConfig, vlansOn[v.Name])...))
+	}
+	return files
+}
+
+func linkSection(mtu int32) string {
+	return "[Link]\nMTUBytes=" + strconv.Itoa(int(mtu)) + "\n"
+}
+
+// networkSections renders the [Link], [Network] and [Route] sections of a
+// link that is not a bond member.
+func networkSections(match string, a NetworkAddressingConfig, vlans []string) []string {
+	sections := []string{match}
+	if a.MTU != 0 {
+		sections = append(sections, linkSection(a.MTU))
+	}
+	dhcp := "no"
+	switch {
+	case a.DHCP4 && a.DHCP6:
+		dhcp = "yes"
+	case a.DHCP4:
+		dhcp = "ipv4"
+	case a.DHCP6:
+		dhcp = "ipv6"
+	}
+	var b strings.Builder
+	b.WriteString("[Network]\nDHCP=" + dhcp + "\n")
+	for _, addr := range a.Addresses {
+		b.WriteString("Address=" + addr + "\n")
+	}
+	for _, gw := range []string{a.Gateway4, a.Gateway6} {
+		if gw != "" {
+			b.WriteString("Gateway=" + gw + "\n")
+		}
+	}
+	for _, ns := range a.Nameservers {
+		b.WriteString("DNS=" + ns + "\n")
+	}
+	if len(a.SearchDomains) > 0 {
+		b.WriteString("Domains=" + strings.Join(a.SearchDomains, " ") + "\n")
+	}
+	for _, v := range vlans {
+		b.WriteString("VLAN=" + v + "\n")
+	}
+	sections = append(sections, b.String())
+	for _, r := range a.Routes {
+		var rb strings.Builder
+		rb.WriteString("[Route]\n")
+		if r.To != "default" {
+			rb.WriteString("Destination=" + r.To + "\n")
+		}
+		if r.Via != "" {
+			rb.WriteString("Gateway=" + r.Via + "\n")
+		}
+		if r.Metric != nil {
+			rb.WriteString("Metric=" + strconv.Itoa(int(*r.Metric)) + "\n")
+		}
+		sections = append(sections, rb.String())
+	}
+	return sections
+}
+
+// networkApplyLinks returns the space-separated links that carry addressing:
+// the links the apply script waits for before the distribution starts. An
+// interface matched by MAC address is passed as "mac:<address>", since its
+// kernel name need not be the declared one. Names and MACs are validated
+// against networkLinkNamePattern and networkMACPattern, so they are safe as
+// literal ExecStartPre arguments.
+func networkApplyLinks(n *NetworkConfig) string {
+	if n == nil {
+		return ""
+	}
+	var links []string
+	for _, iface := range n.Interfaces {
+		if !hasNetworkAddressing(iface.NetworkAddressingConfig) {
+			continue
+		}
+		if iface.MACAddress != "" {
+			links = append(links, "mac:"+strings.ToLower(iface.MACAddress))
+		} else {
+			links = append(links, iface.Name)
+		}
+	}
+	for _, b := range n.Bonds {
+		if hasNetworkAddressing(b.NetworkAddressingConfig) {
+			links = append(links, b.Name)
+		}
+	}
+	for _, v := range n.VLANs {
+		if hasNetworkAddressing(v.NetworkAddressingConfig) {
+			links = append(links, v.Name)
+		}
+	}
+	return strings.Join(links, " ")
+}
+
+// hasNetworkAddressing reports whether a link sets any layer-3 field.
+func hasNetworkAddressing(a NetworkAddressingConfig) bool {
+	return a.DHCP4 || a.DHCP6 || len(a.Addresses) > 0 || a.Gateway4 != "" || a.Gateway6 != "" ||
+		len(a.Routes) > 0 || len(a.Nameservers) > 0 || len(a.SearchDomains) > 0
+}
+
+// networkApplyScript runs as an ExecStartPre of the distribution service,
+// before the version gate. The unit files are written by the initramfs and
+// network stages; the script reloads networkd once more, so a unit written
+// after networkd configured a link still replaces its DHCP lease, then waits
+// until every addressed link (its arguments) is configured. The distribution
+// therefore never starts on, or binds, the DHCP address. A link that does not
+// come up fails the unit, and the service's Restart= policy retries. An image
+// without systemd-networkd only gets a warning: the units are inert there and
+// the distribution starts on the image's own network configuration.
+//
+// SECURITY: the script is a compile-time constant. Its only inputs are the
+// link names passed as arguments by the drop-in, validated against
+// networkLinkNamePattern.
+const networkApplyScript = `#!/bin/bash
+# Kairos CAPI static network apply (ExecStartPre of the distribution service).
+# Arguments: the links that carry addressing, by name or as mac:<address>.
+set -uo pipefail
+
+# The distribution never runs on the Kairos live installer.
+if grep -qw cdroot /proc/cmdline 2>/dev/null; then
+  exit 0
+fi
+if ! command -v networkctl >/dev/null 2>&1; then
+  echo "kairos-network: networkctl not found; spec.network is not applied without systemd-networkd"
+  exit 0
+fi
+# Resolve mac:<address> arguments to the kernel link name.
+links=()
+for arg in "$@"; do
+  case "${arg}" in
+    mac:*)
+      name=""
+      for dev in /sys/class/net/*; do
+        # Physical links only; bonds and VLANs share the address.
+        if [ -e "${dev}/device" ] && [ "$(cat "${dev}/address" 2>/dev/null)" = "${arg#mac:}" ]; then
+          name="$(basename "${dev}")"
+          break
+        fi
+      done
+      if [ -z "${name}" ]; then
+        echo "kairos-network: no link with MAC address ${arg#mac:}"
+        exit 1
+      fi
+      links+=("${name}")
+      ;;
+    *)
+      links+=("${arg}")
+      ;;
+  esac
+done
+set -- ${links[@]+"${links[@]}"}
+if ! networkctl reload; then
+  echo "kairos-network: networkctl reload failed"
+  exit 1
+fi
+for link in "$@"; do
+  # A bond or VLAN created by the reload may not exist yet; wait-online
+  # below covers it.
+  networkctl reconfigure "${link}" >/dev/null 2>&1 || true
+done
+[ "$#" -gt 0 ] || exit 0
+
+wait_online=""
+for candidate in /usr/lib/systemd/systemd-networkd-wait-online /lib/systemd/systemd-networkd-wait-online; do
+  if [ -x "${candidate}" ]; then
+    wait_online="${candidate}"
+    break
+  fi
+done
+if [ -z "${wait_online}" ]; then
+  echo "kairos-network: systemd-networkd-wait-online not found; not waiting for $*"
+  exit 0
+fi
+args=()
+for link in "$@"; do
+  args+=("--interface=${link}")
+done
+if ! "${wait_online}" "${args[@]}" --timeout=120; then
+  echo "kairos-network: links not configured within 120s: $*"
+  networkctl status "$@" --no-pager 2>/dev/null || true
+  exit 1
+fi
+echo "kairos-network: configured $*"
+`
+
+// networkApply returns the static apply script. Zero-arg on purpose (see the
+// SECURITY note on networkApplyScript); intended to be piped through
+// `indent N` under a `content: |` block scalar.
+func networkApply() string {
+	return networkApplyScript
+}
+
+// networkLinkNamePattern mirrors the kubebuilder marker on the link names: a
+// Linux interface name, 1–15 characters.
+var networkLinkNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9._-]{0,14}$`)
+
+// networkMACPattern mirrors the kubebuilder marker on
+// NetworkInterface.MACAddress.
+var networkMACPattern = regexp.MustCompile(`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`)
+
+// networkSearchDomainPattern matches DNS domains with networkd's optional "~"
+// routing-domain prefix.
+var networkSearchDomainPattern = regexp.MustCompile(`^~?([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*\.?$`)
+
+// networkBondModes are the bonding modes networkd accepts.
+var networkBondModes = map[string]bool{
+	"": true, "balance-rr": true, "active-backup": true, "balance-xor": true,
+	"broadcast": true, "802.3ad": true, "balance-tlb": true, "balance-alb": true,
+}
+
+// validateNetwork re-applies the webhook checks at render time. Every value
+// lands verbatim in a networkd unit file (one key per line), and link names
+// also land on the apply script's ExecStartPre line, so each one is held to
+// its strict shape here.
+func validateNetwork(n *NetworkConfig) error {
+	var errs []error
+	links := map[string]string{}
+	addLink := func(field, name, kind string) {
+		if !networkLinkNamePattern.MatchString(name) {
+			errs = append(errs, fmt.Errorf("%s %q must be a Linux interface name", field, name))
+		}
+		if _, dup := links[name]; dup {
+			errs = append(errs, fmt.Errorf("%s %q is not unique across interfaces, bonds and VLANs", field, name))
+			return
+		}
+		links[name] = kind
+	}
+	for i, iface := range n.Interfaces {
+		f := fmt.Sprintf("network.interfaces[%d]", i)
+		addLink(f+".name", iface.Name, "interface")
+		if iface.MACAddress != "" && !networkMACPattern.MatchString(iface.MACAddress) {
+			errs = append(errs, fmt.Errorf("%s.macAddress %q must be a colon-separated MAC address", f, iface.MACAddress))
+		}
+		errs = append(errs, validateNetworkAddressing(f, iface.NetworkAddressingConfig)...)
+	}
+	for i, b := range n.Bonds {
+		addLink(fmt.Sprintf("network.bonds[%d].name", i), b.Name, "bond")
+	}
+	for i, v := range n.VLANs {
+		addLink(fmt.Sprintf("network.vlans[%d].name", i), v.Name, "vlan")
+	}
+	members := map[string]bool{}
+	for i, b := range n.Bonds {
+		f := fmt.Sprintf("network.bonds[%d]", i)
+		if len(b.Interfaces) == 0 {
+			errs = append(errs, fmt.Errorf("%s.interfaces: at least one member is required", f))
+		}
+		for j, m := range b.Interfaces {
+			switch {
+			case links[m] != "interface":
+				errs = append(errs, fmt.Errorf("%s.interfaces[%d] %q is not a declared interface", f, j, m))
+			case members[m]:
+				errs = append(errs, fmt.Errorf("%s.interfaces[%d] %q is already a bond member", f, j, m))
+			default:
+				members[m] = true
+			}
+		}
+		if !networkBondModes[b.Mode] {
+			errs = append(errs, fmt.Errorf("%s.mode %q is not a supported bonding mode", f, b.Mode))
+		}
+		errs = append(errs, validateNetworkAddressing(f, b.NetworkAddressingConfig)...)
+	}
+	for i, iface := range n.Interfaces {
+		if members[iface.Name] && hasNetworkAddressing(iface.NetworkAddressingConfig) {
+			errs = append(errs, fmt.Errorf("network.interfaces[%d] %q is a bond member and must not carry addressing", i, iface.Name))
+		}
+	}
+	for i, v := range n.VLANs {
+		f := fmt.Sprintf("network.vlans[%d]", i)
+		if v.ID < 1 || v.ID > 4094 {
+			errs = append(errs, fmt.Errorf("%s.id %d must be between 1 and 4094", f, v.ID))
+		}
+		if kind := links[v.Link]; (kind != "interface" && kind != "bond") || members[v.Link] {
+			errs = append(errs, fmt.Errorf("%s.link %q must be a declared interface or bond that is not a bond member", f, v.Link))
+		}
+		errs = append(errs, validateNetworkAddressing(f, v.NetworkAddressingConfig)...)
+	}
+	return errors.Join(errs...)
+}
+
+// validateNetworkAddressing checks the layer-3 fields of one link.
+func validateNetworkAddressing(f string, a NetworkAddressingConfig) []error {
+	var errs []error
+	for i, addr := range a.Addresses {
+		if _, _, err := net.ParseCIDR(addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s.addresses[%d] %q must be an address in CIDR notation", f, i, addr))
+		}
+	}
+	if ip := net.ParseIP(a.Gateway4); a.Gateway4 != "" && (ip == nil || ip.To4() == nil) {
+		errs = append(errs, fmt.Errorf("%s.gateway4 %q must be an IPv4 address", f, a.Gateway4))
+	}
+	if ip := net.ParseIP(a.Gateway6); a.Gateway6 != "" && (ip == nil || ip.To4() != nil) {
+		errs = append(errs, fmt.Errorf("%s.gateway6 %q must be an IPv6 address", f, a.Gateway6))
+	}
+	for i, r := range a.Routes {
+		rf := fmt.Sprintf("%s.routes[%d]", f, i)
+		var dst *net.IPNet
+		if r.To != "default" {
+			_, ipNet, err := net.ParseCIDR(r.To)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s.to %q must be a CIDR or \"default\"", rf, r.To))
+			}
+			dst = ipNet
+		}
+		via := net.ParseIP(r.Via)
+		switch {
+		case r.Via == "" && r.To == "default":
+			errs = append(errs, fmt.Errorf("%s.via: a default route needs a next hop", rf))
+		case r.Via != "" && via == nil:
+			errs = append(errs, fmt.Errorf("%s.via %q must be an IP address", rf, r.Via))
+		case via != nil && dst != nil && (dst.IP.To4() == nil) != (via.To4() == nil):
+			errs = append(errs, fmt.Errorf("%s.via %q must be in the same address family as to", rf, r.Via))
+		}
+		if r.Metric != nil && *r.Metric < 0 {
+			errs = append(errs, fmt.Errorf("%s.metric %d must not be negative", rf, *r.Metric))
+		}
+	}
+	for i, ns := range a.Nameservers {
+		if net.ParseIP(ns) == nil {
+			errs = append(errs, fmt.Errorf("%s.nameservers[%d] %q must be an IP address", f, i, ns))
+		}
+	}
+	for i, d := range a.SearchDomains {
+		if !networkSearchDomainPattern.MatchString(d) {
+			errs = append(errs, fmt.Errorf("%s.searchDomains[%d] %q must be a DNS domain", f, i, d))
+		}
+	}
+	if a.MTU != 0 && (a.MTU < 68 || a.MTU > 9216) {
+		errs = append(errs, fmt.Errorf("%s.mtu %d must be between 68 and 9216", f, a.MTU))
+	}
+	return errs
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// networkConfig is a bonded uplink with a tagged VLAN on top and a separate
+// storage NIC matched by MAC address.
+func networkConfig() *NetworkConfig {
+	metric := int32(100)
+	return &NetworkConfig{
+		Interfaces: []NetworkInterfaceConfig{
+			{Name: "eno1", NetworkAddressingConfig: NetworkAddressingConfig{MTU: 9000}},
+			{Name: "eno2"},
+			{Name: "storage0", MACAddress: "AA:BB:CC:DD:EE:01", NetworkAddressingConfig: NetworkAddressingConfig{
+				Addresses: []string{"10.20.0.10/24"},
+			}},
+		},
+		Bonds: []NetworkBondConfig{{
+			Name:       "bond0",
+			Interfaces: []string{"eno1", "eno2"},
+			Mode:       "802.3ad",
+			NetworkAddressingConfig: NetworkAddressingConfig{
+				Addresses:     []string{"192.168.100.10/24", "fd00::10/64"},
+				Gateway4:      "192.168.100.1",
+				Gateway6:      "fd00::1",
+				Nameservers:   []string{"192.168.100.1"},
+				SearchDomains: []string{"corp.example.com"},
+				MTU:           9000,
+			},
+		}},
+		VLANs: []NetworkVLANConfig{{
+			Name: "vlan200",
+			ID:   200,
+			Link: "bond0",
+			NetworkAddressingConfig: NetworkAddressingConfig{
+				Addresses: []string{"172.16.0.10/16"},
+				Routes: []NetworkRouteConfig{
+					{To: "10.50.0.0/16", Via: "172.16.0.1", Metric: &metric},
+				},
+			},
+		}},
+	}
+}
+
+// networkStageFiles returns the files of the yip stage's steps in out.
+func networkStageFiles(t *testing.T, out, stage string) []yipFile {
+	t.Helper()
+	var cc struct {
+		Stages map[string][]struct {
+			Files []yipFile `yaml:"files"`
+		} `yaml:"stages"`
+	}
+	if err := yaml.Unmarshal([]byte(out), &cc); err != nil {
+		t.Fatalf("parse rendered YAML: %v", err)
+	}
+	var files []yipFile
+	for _, step := range cc.Stages[stage] {
+		files = append(files, step.Files...)
+	}
+	return files
+}
+
+// TestNetwork_Rendered asserts every template writes the networkd units from
+// the initramfs and network stages and renders the apply drop-in on the
+// distribution service, on control-plane and worker nodes.
+func TestNetwork_Rendered(t *testing.T) {
+	for _, distro := range []string{"k0s", "k3s"} {
+		render := RenderK0sCloudConfig
+		if distro == "k3s" {
+			render = RenderK3sCloudConfig
+		}
+		for _, kv := range []bool{false, true} {
+			for _, role := range []string{"control-plane", "worker"} {
+				name := distro + "/" + role
+				if kv {
+					name += "/capk"
+				}
+				t.Run(name, func(t *testing.T) {
+					d := haCPData("init", kv)
+					if role == "worker" {
+						d = TemplateData{Role: "worker", Hostname: "w", UserName: "kairos", WorkerToken: "tok",
+							K3sServerURL: "https://10.0.0.1:6443", K3sToken: "tok", IsKubeVirt: kv}
+					}
+					d.Network = networkConfig()
+					out, err := render(d)
+					if err != nil {
+						t.Fatalf("render: %v", err)
+					}
+					parseRendered(t, out)
+
+					for _, stage := range []string{"initramfs", "network"} {
+						if got := networkStageFiles(t, out, stage); !reflect.DeepEqual(got, networkFiles(d.Network)) {
+							t.Errorf("stages.%s files = %+v, want %+v", stage, got, networkFiles(d.Network))
+						}
+					}
+					if extractWriteFile(t, out, "/etc/systemd/network/05-kairos-bond0.network") != "" {
+						t.Error("networkd units must not be rendered as write_files")
+					}
+					unit := map[string]string{"k0s/control-plane": "k0scontroller", "k0s/worker": "k0sworker",
+						"k3s/control-plane": "k3s", "k3s/worker": "k3s-agent"}[distro+"/"+role]
+					dropIn := extractWriteFile(t, out, "/etc/systemd/system/"+unit+".service.d/08-kairos-network.conf")
+					if !strings.Contains(dropIn, "ExecStartPre=/usr/local/bin/kairos-network-apply.sh mac:aa:bb:cc:dd:ee:01 bond0 vlan200") {
+						t.Errorf("network drop-in = %q", dropIn)
+					}
+					if !strings.Contains(extractWriteFile(t, out, "/usr/local/bin/kairos-network-apply.sh"), "networkctl reload") {
+						t.Error("apply script not rendered")
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestNetwork_Units checks the generated networkd units field by field.
+func TestNetwork_Units(t *testing.T) {
+	files := map[string]string{}
+	var order []string
+	for _, f := range networkFiles(networkConfig()) {
+		files[f.Path] = f.Content
+		order = append(order, f.Path)
+	}
+	want := []string{
+		"/etc/systemd/network/05-kairos-eno1.network",
+		"/etc/systemd/network/05-kairos-eno2.network",
+		"/etc/systemd/network/05-kairos-storage0.network",
+		"/etc/systemd/network/05-kairos-bond0.netdev",
+		"/etc/systemd/network/05-kairos-bond0.network",
+		"/etc/systemd/network/05-kairos-vlan200.netdev",
+		"/etc/systemd/network/05-kairos-vlan200.network",
+	}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Fatalf("files = %v\nwant %v", order, want)
+	}
+	for path, wantLines := range map[string][]string{
+		want[0]: {"Name=eno1", "MTUBytes=9000", "Bond=bond0"},
+		want[2]: {"PermanentMACAddress=aa:bb:cc:dd:ee:01", "DHCP=no", "Address=10.20.0.10/24"},
+		want[3]: {"Kind=bond", "Mode=802.3ad", "MIIMonitorSec=100ms"},
+		want[4]: {"Address=192.168.100.10/24", "Address=fd00::10/64", "Gateway=192.168.100.1", "Gateway=fd00::1",
+			"DNS=192.168.100.1", "Domains=corp.example.com", "VLAN=vlan200"},
+		want[5]: {"Kind=vlan", "Id=200"},
+		want[6]: {"[Route]\nDestination=10.50.0.0/16\nGateway=172.16.0.1\nMetric=100"},
+	} {
+		for _, l := range wantLines {
+			if !strings.Contains(files[path], l) {
+				t.Errorf("%s missing %q:\n%s", path, l, files[path])
+			}
+		}
+	}
+	if strings.Contains(files[want[0]], "DHCP=") || strings.Contains(files[want[0]], "Address=") {
+		t.Errorf("bond member carries addressing:\n%s", files[want[0]])
+	}
+}
+
+// TestNetwork_DHCPAndDefaultRoute covers the DHCP switch and a default route
+// without a Destination.
+func TestNetwork_DHCPAndDefaultRoute(t *testing.T) {
+	n := &NetworkConfig{Interfaces: []NetworkInterfaceConfig{{Name: "ens192", NetworkAddressingConfig: NetworkAddressingConfig{
+		DHCP4:  true,
+		Routes: []NetworkRouteConfig{{To: "default", Via: "192.168.1.254"}},
+	}}}}
+	content := networkFiles(n)[0].Content
+	if !strings.Contains(content, "DHCP=ipv4") || !strings.Contains(content, "[Route]\nGateway=192.168.1.254\n") || strings.Contains(content, "Destination=") {
+		t.Errorf("content = %q", content)
+	}
+}
+
+// TestNetwork_AbsentByDefault: renders without spec.network carry no network
+// units or apply drop-in.
+func TestNetwork_AbsentByDefault(t *testing.T) {
+	for _, render := range []func(TemplateData) (string, error){RenderK0sCloudConfig, RenderK3sCloudConfig, RenderRKE2CloudConfig} {
+		out, err := render(haCPData("join", false))
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		if strings.Contains(out, "/etc/systemd/network/") || strings.Contains(out, "kairos-network-apply") {
+			t.Error("network configuration rendered without spec.network")
+		}
+	}
+}
+
+// TestNetwork_ApplyScriptValidBash runs `bash -n` on the apply script.
+func TestNetwork_ApplyScriptValidBash(t *testing.T) {
+	bashPath, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available; skipping rendered-script syntax check")
+	}
+	f := filepathJoinTemp(t, "network-apply.sh")
+	if err := os.WriteFile(f, []byte(networkApply()), 0o600); err != nil {
+		t.Fatalf("write temp script: %v", err)
+	}
+	if b, err := exec.Command(bashPath, "-n", f).CombinedOutput(); err != nil {
+		t.Fatalf("network apply script is not valid bash: %v\n%s", err, b)
+	}
+}
+
+func TestValidateNetwork(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(n *NetworkConfig)
+		wantErr string
+	}{
+		{"valid", func(*NetworkConfig) {}, ""},
+		{"bad link name", func(n *NetworkConfig) { n.Interfaces[2].Name = "eth0\nDHCP=yes" }, "network.interfaces[2].name"},
+		{"duplicate name", func(n *NetworkConfig) { n.VLANs[0].Name = "bond0" }, "not unique"},
+		{"bad MAC", func(n *NetworkConfig) { n.Interfaces[2].MACAddress = "aa:bb" }, "macAddress"},
+		{"undeclared bond member", func(n *NetworkConfig) { n.Bonds[0].Interfaces[1] = "eno9" }, "not a declared interface"},
+		{"member in two bonds", func(n *NetworkConfig) {
+			n.Bonds = append(n.Bonds, NetworkBondConfig{Name: "bond1", Interfaces: []string{"eno2"}})
+		}, "already a bond member"},
+		{"member with address", func(n *NetworkConfig) { n.Interfaces[0].Addresses = []string{"10.0.0.1/24"} }, "must not carry addressing"},
+		{"bad bond mode", func(n *NetworkConfig) { n.Bonds[0].Mode = "lacp" }, "bonding mode"},
+		{"VLAN on bond member", func(n *NetworkConfig) { n.VLANs[0].Link = "eno1" }, "network.vlans[0].link"},
+		{"VLAN on unknown link", func(n *NetworkConfig) { n.VLANs[0].Link = "eth7" }, "network.vlans[0].link"},
+		{"VLAN id out of range", func(n *NetworkConfig) { n.VLANs[0].ID = 4095 }, "network.vlans[0].id"},
+		{"address without prefix", func(n *NetworkConfig) { n.Bonds[0].Addresses[0] = "192.168.100.10" }, "network.bonds[0].addresses[0]"},
+		{"IPv6 gateway4", func(n *NetworkConfig) { n.Bonds[0].Gateway4 = "fd00::1" }, "gateway4"},
+		{"route family mismatch", func(n *NetworkConfig) { n.VLANs[0].Routes[0].Via = "fd00::1" }, "same address family"},
+		{"default route without via", func(n *NetworkConfig) {
+			n.VLANs[0].Routes[0] = NetworkRouteConfig{To: "default"}
+		}, "needs a next hop"},
+		{"bad nameserver", func(n *NetworkConfig) { n.Bonds[0].Nameservers[0] = "dns.example.com" }, "nameservers[0]"},
+		{"search domain with newline", func(n *NetworkConfig) { n.Bonds[0].SearchDomains[0] = "a\n[Network]" }, "searchDomains[0]"},
+		{"MTU too small", func(n *NetworkConfig) { n.Bonds[0].MTU = 10 }, "mtu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := networkConfig()
+			tt.mutate(n)
+			err := validateNetwork(n)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
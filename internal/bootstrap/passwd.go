@@ -0,0 +1,178 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// cryptAlphabet is the crypt(3) base64 alphabet used for salts and digests.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Parameters of the SHA-512 crypt hashes HashPassword generates: glibc's
+// default round count (so the rounds= field is omitted) and the maximum salt
+// length.
+const (
+	sha512CryptRounds  = 5000
+	sha512CryptSaltLen = 16
+)
+
+// passwordHashPattern matches the crypt(3) hashes the Kairos images'
+// libxcrypt verifies and yip writes to /etc/shadow unchanged: SHA-512 ($6$)
+// and SHA-256 ($5$) crypt with an optional rounds= field, and yescrypt ($y$).
+var passwordHashPattern = regexp.MustCompile(
+	`^(\$6\$(rounds=[0-9]{4,9}\$)?[./0-9A-Za-z]{1,16}\$[./0-9A-Za-z]{86}` +
+		`|\$5\$(rounds=[0-9]{4,9}\$)?[./0-9A-Za-z]{1,16}\$[./0-9A-Za-z]{43}` +
+		`|\$y\$[./0-9A-Za-z]+\$[./0-9A-Za-z]{1,86}\$[./0-9A-Za-z]{43})$`)
+
+// IsPasswordHash reports whether s is a crypt(3) hash HashPassword passes
+// through unchanged.
+func IsPasswordHash(s string) bool {
+	return passwordHashPattern.MatchString(s)
+}
+
+// HashPassword returns the crypt(3) form of password for the users[].passwd
+// field of the cloud-config. A value that is already a SHA-512, SHA-256 or
+// yescrypt hash is returned as is, so a Secret may hold a pre-hashed password;
+// anything else is hashed with SHA-512 crypt and a random salt. The empty
+// password stays empty: the templates then emit no passwd field.
+func HashPassword(password string) (string, error) {
+	if password == "" || IsPasswordHash(password) {
+		return password, nil
+	}
+	salt := make([]byte, sha512CryptSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate password salt: %w", err)
+	}
+	for i, b := range salt {
+		salt[i] = cryptAlphabet[int(b)%len(cryptAlphabet)]
+	}
+	return sha512Crypt([]byte(password), salt, sha512CryptRounds), nil
+}
+
+// sha512Crypt implements the SHA-512 crypt scheme of glibc
+// (https://www.akkadia.org/drepper/SHA-crypt.txt). The rounds= field is
+// written only for a non-default round count.
+func sha512Crypt(password, salt []byte, rounds int) string {
+	if len(salt) > sha512CryptSaltLen {
+		salt = salt[:sha512CryptSaltLen]
+	}
+
+	b := sha512.New()
+	b.Write(password)
+	b.Write(salt)
+	b.Write(password)
+	digestB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(password)
+	a.Write(salt)
+	a.Write(repeatToLen(digestB, len(password)))
+	for n := len(password); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(password)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	dp := sha512.New()
+	for range password {
+		dp.Write(password)
+	}
+	pSeq := repeatToLen(dp.Sum(nil), len(password))
+
+	ds := sha512.New()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(salt)
+	}
+	sSeq := repeatToLen(ds.Sum(nil), len(salt))
+
+	c := digestA
+	for i := 0; i < rounds; i++ {
+		h := sha512.New()
+		if i%2 != 0 {
+			h.Write(pSeq)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(sSeq)
+		}
+		if i%7 != 0 {
+			h.Write(pSeq)
+		}
+		if i%2 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(pSeq)
+		}
+		c = h.Sum(nil)
+	}
+
+	out := []byte("$6$")
+	if rounds != sha512CryptRounds {
+		out = append(out, "rounds="+strconv.Itoa(rounds)+"$"...)
+	}
+	out = append(out, salt...)
+	out = append(out, '$')
+	// The digest bytes are encoded in the permuted order the scheme defines.
+	for i := 0; i < 21; i++ {
+		out = appendCrypt64(out, c[i], c[(i+21)%63], c[(i+42)%63], i)
+	}
+	w := uint(c[63])
+	for n := 0; n < 2; n++ {
+		out = append(out, cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+	return string(out)
+}
+
+// appendCrypt64 appends the four crypt base64 characters of one 24-bit group
+// of the SHA-512 crypt digest. Group i takes bytes i, i+21 and i+42 (mod 63),
+// rotated so the most significant byte cycles through the three.
+func appendCrypt64(out []byte, x, y, z byte, i int) []byte {
+	var b2, b1, b0 byte
+	switch i % 3 {
+	case 0:
+		b2, b1, b0 = x, y, z
+	case 1:
+		b2, b1, b0 = y, z, x
+	default:
+		b2, b1, b0 = z, x, y
+	}
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for n := 0; n < 4; n++ {
+		out = append(out, cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+	return out
+}
+
+// repeatToLen returns digest repeated, then truncated, to n bytes.
+func repeatToLen(digest []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, digest[:min(len(digest), n-len(out))]...)
+	}
+	return out
+}
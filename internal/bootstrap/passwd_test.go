@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSHA512Crypt checks the implementation against glibc's reference vectors
+// (SHA-crypt.txt) and openssl passwd -6 output, including a salt longer than
+// 16 characters and a password longer than one SHA-512 digest.
+func TestSHA512Crypt(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		rounds         int
+		want           string
+	}{
+		{"Hello world!", "saltstring", 5000,
+			"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+		{"Hello world!", "saltstringsaltstring", 5000,
+			"$6$saltstringsaltst$e.3mR68CqZEpesEX1HlFZT6sEanSOjM/b5UoDyDo00a8syek2cJldMjrbtKP86.FJvzluVR7nc3DNzelAwTxj."},
+		{"Hello world!", "saltstringsaltstring", 10000,
+			"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v."},
+		{"p", "x", 5000,
+			"$6$x$r39k5JD7gq4TL1cbIvXhiANv3.KUJxnTZfrlpZGUTcMqtXY1OU00ux2BzFw.1q8FUFoF4EvGK382pcmMfVQG01"},
+		{strings.Repeat("a", 130), "kairosSaltKairos", 5000,
+			"$6$kairosSaltKairos$i4Aq5D.N.QOMXiVKcXbZhe3o50BycMDbaUU0tXa9CADLwcSgydINSTveyW8f5iPUFGmtCvm.Rfg50lSVjSwi4/"},
+	}
+	for _, tt := range tests {
+		if got := sha512Crypt([]byte(tt.password), []byte(tt.salt), tt.rounds); got != tt.want {
+			t.Errorf("sha512Crypt(%q, %q, %d) = %q, want %q", tt.password, tt.salt, tt.rounds, got, tt.want)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hashed, err := HashPassword("kairos")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if !strings.HasPrefix(hashed, "$6$") || !IsPasswordHash(hashed) || strings.Contains(hashed, "kairos") {
+		t.Fatalf("HashPassword(kairos) = %q, want a SHA-512 crypt hash", hashed)
+	}
+	salt := strings.Split(hashed, "$")[2]
+	if want := sha512Crypt([]byte("kairos"), []byte(salt), sha512CryptRounds); hashed != want {
+		t.Errorf("hash does not verify: got %q, recomputed %q", hashed, want)
+	}
+	again, _ := HashPassword("kairos")
+	if again == hashed {
+		t.Error("two hashes of the same password share a salt")
+	}
+
+	for _, pre := range []string{
+		"",
+		hashed,
+		"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		"$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5",
+		"$y$j9T$F5Jx5fExrKuPp53xLKQ..1$X3DX6M94c7o.9agCG9G317fhZg9SqC.5i5rd.RhAtQ7",
+	} {
+		got, err := HashPassword(pre)
+		if err != nil || got != pre {
+			t.Errorf("HashPassword(%q) = %q, %v; want it unchanged", pre, got, err)
+		}
+	}
+
+	// Values that only look like hashes are hashed like any other password.
+	for _, plain := range []string{"$6$salt$short", "$1$saltsalt$qjXMvbEw8oaL.CzflDugX/", "$6$salt$" + strings.Repeat("a", 86) + "\nx"} {
+		got, err := HashPassword(plain)
+		if err != nil || got == plain || !strings.HasPrefix(got, "$6$") {
+			t.Errorf("HashPassword(%q) = %q, %v; want a fresh SHA-512 crypt hash", plain, got, err)
+		}
+	}
+}
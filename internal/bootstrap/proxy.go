@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ProxyConfig is the render-ready view of KairosConfig.Spec.Proxy. NoProxy is
+// the complete list: the controller has already appended the cluster CIDRs and
+// the control-plane and management endpoint hosts to the user's entries (see
+// proxyRenderData in the bootstrap controller). Every field is re-validated at
+// render time by validateProxy.
+type ProxyConfig struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    []string
+}
+
+// proxyEnvPath is the environment file every proxy-aware unit loads through
+// its EnvironmentFile= drop-in and the login-shell profile sources.
+const proxyEnvPath = "/usr/local/etc/kairos-capi/proxy.env"
+
+// proxyEnv renders the proxy environment file. Both the upper- and lower-case
+// spellings are set because curl only honors lower-case http_proxy, while Go
+// programs (k0s, k3s, containerd) read either. Values go through shquote; the
+// file is read both by systemd (EnvironmentFile=) and by sh.
+func proxyEnv(p *ProxyConfig) string {
+	if p == nil {
+		return ""
+	}
+	var lines []string
+	add := func(k, v string) {
+		if v == "" {
+			return
+		}
+		lines = append(lines, k+"="+shquote(v), strings.ToLower(k)+"="+shquote(v))
+	}
+	add("HTTP_PROXY", p.HTTPProxy)
+	add("HTTPS_PROXY", p.HTTPSProxy)
+	add("NO_PROXY", strings.Join(p.NoProxy, ","))
+	return strings.Join(lines, "\n")
+}
+
+// proxyUnits lists the systemd units that get the proxy EnvironmentFile=
+// drop-in: the distribution service (whose containerd child and version-gate
+// ExecStartPre inherit the environment) and every provider unit that reaches
+// the network with curl. A drop-in for a unit a template does not install is
+// inert.
+func proxyUnits(distribution, role string) []string {
+	switch distribution {
+	case "k3s":
+		if role == "control-plane" {
+			return []string{"k3s", "kairos-k3s-post-bootstrap", "kairos-etcd-backup"}
+		}
+		return []string{"k3s-agent", "kairos-k3s-post-bootstrap"}
+	case "rke2":
+		if role == "control-plane" {
+			return []string{"rke2-server", "kairos-rke2-post-bootstrap", "kairos-etcd-backup"}
+		}
+		return []string{"rke2-agent", "kairos-rke2-post-bootstrap"}
+	}
+	if role == "control-plane" {
+		return []string{"k0scontroller", "kairos-k0s-post-bootstrap", "kairos-k0s-lb-sans", "kairos-etcd-backup", "kairos-etcd-leave"}
+	}
+	return []string{"k0sworker", "kairos-k0s-post-bootstrap"}
+}
+
+// noProxyEntryPattern accepts hosts, domain suffixes (".example.com",
+// "*.example.com"), IPs, bracketed IPv6 addresses, CIDRs and host:port.
+var noProxyEntryPattern = regexp.MustCompile(`^[A-Za-z0-9.*:/\[\]_-]{1,253}$`)
+
+// validateProxy re-applies the webhook checks at render time. The proxy URLs
+// must not carry credentials, since the env file is world-readable, and
+// neither they nor the NO_PROXY entries may contain whitespace or quotes.
+func validateProxy(p *ProxyConfig) error {
+	var errs []error
+	if p.HTTPProxy == "" && p.HTTPSProxy == "" {
+		errs = append(errs, fmt.Errorf("proxy: at least one of httpProxy or httpsProxy must be set"))
+	}
+	for _, f := range []struct{ name, value string }{
+		{"proxy.httpProxy", p.HTTPProxy},
+		{"proxy.httpsProxy", p.HTTPSProxy},
+	} {
+		if f.value != "" && !isProxyURL(f.value) {
+			errs = append(errs, fmt.Errorf("%s %q must be an http(s) URL with a host and no credentials, path, whitespace, quotes, or backslashes", f.name, f.value))
+		}
+	}
+	for i, e := range p.NoProxy {
+		if !noProxyEntryPattern.MatchString(e) {
+			errs = append(errs, fmt.Errorf("proxy.noProxy[%d] %q must be a host, domain suffix, IP, or CIDR", i, e))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isProxyURL reports whether s is an http(s) proxy URL that can be written
+// into the env file verbatim.
+func isProxyURL(s string) bool {
+	for _, r := range s {
+		if r <= ' ' || r > '~' || r == '"' || r == '\'' || r == '\\' {
+			return false
+		}
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.User == nil && strings.Trim(u.Path, "/") == "" && u.RawQuery == "" && u.Fragment == ""
+}
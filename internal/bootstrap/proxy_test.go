@@ -0,0 +1,159 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func proxyConfig() *ProxyConfig {
+	return &ProxyConfig{
+		HTTPProxy:  "http://proxy.example.com:3128",
+		HTTPSProxy: "http://proxy.example.com:3128",
+		NoProxy:    []string{".corp.example.com", "localhost", "10.244.0.0/16", "mgmt.example.com"},
+	}
+}
+
+// TestProxy_Rendered asserts every template writes the env file and the
+// EnvironmentFile= drop-in for the distribution service and the provider's
+// curl-using units, on control-plane and worker nodes.
+func TestProxy_Rendered(t *testing.T) {
+	for _, distro := range []string{"k0s", "k3s", "rke2"} {
+		render := map[string]func(TemplateData) (string, error){
+			"k0s": RenderK0sCloudConfig, "k3s": RenderK3sCloudConfig, "rke2": RenderRKE2CloudConfig,
+		}[distro]
+		for _, kv := range []bool{false, true} {
+			for _, role := range []string{"control-plane", "worker"} {
+				name := distro + "/" + role
+				if kv {
+					name += "/capk"
+				}
+				t.Run(name, func(t *testing.T) {
+					d := haCPData("init", kv)
+					if role == "worker" {
+						d = TemplateData{Role: "worker", Hostname: "w", UserName: "kairos", WorkerToken: "tok",
+							K3sServerURL: "https://10.0.0.1:6443", K3sToken: "tok",
+							RKE2ServerURL: "https://10.0.0.1:9345", RKE2Token: "tok", IsKubeVirt: kv}
+					}
+					d.Proxy = proxyConfig()
+					out, err := render(d)
+					if err != nil {
+						t.Fatalf("render: %v", err)
+					}
+					parseRendered(t, out)
+
+					env := extractWriteFile(t, out, "/usr/local/etc/kairos-capi/proxy.env")
+					for _, want := range []string{
+						"HTTP_PROXY='http://proxy.example.com:3128'",
+						"https_proxy='http://proxy.example.com:3128'",
+						"NO_PROXY='.corp.example.com,localhost,10.244.0.0/16,mgmt.example.com'",
+						"no_proxy='.corp.example.com,localhost,10.244.0.0/16,mgmt.example.com'",
+					} {
+						if !strings.Contains(env, want) {
+							t.Errorf("proxy env missing %q:\n%s", want, env)
+						}
+					}
+					units := proxyUnits(distro, role)
+					if units[0] != map[string]string{"k0s/control-plane": "k0scontroller", "k0s/worker": "k0sworker",
+						"k3s/control-plane": "k3s", "k3s/worker": "k3s-agent",
+						"rke2/control-plane": "rke2-server", "rke2/worker": "rke2-agent"}[distro+"/"+role] {
+						t.Errorf("first proxy unit = %q", units[0])
+					}
+					for _, unit := range units {
+						dropIn := extractWriteFile(t, out, "/etc/systemd/system/"+unit+".service.d/05-kairos-proxy.conf")
+						if !strings.Contains(dropIn, "EnvironmentFile=/usr/local/etc/kairos-capi/proxy.env") {
+							t.Errorf("%s proxy drop-in = %q", unit, dropIn)
+						}
+					}
+					if profile := extractWriteFile(t, out, "/etc/profile.d/kairos-capi-proxy.sh"); !strings.Contains(profile, ". /usr/local/etc/kairos-capi/proxy.env") {
+						t.Errorf("profile script = %q", profile)
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestProxy_AbsentByDefault: renders without spec.proxy carry no proxy files.
+func TestProxy_AbsentByDefault(t *testing.T) {
+	for _, render := range []func(TemplateData) (string, error){RenderK0sCloudConfig, RenderK3sCloudConfig, RenderRKE2CloudConfig} {
+		out, err := render(haCPData("join", false))
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		if strings.Contains(out, "proxy.env") || strings.Contains(out, "kairos-proxy.conf") {
+			t.Error("proxy files rendered without spec.proxy")
+		}
+	}
+}
+
+// TestProxy_EnvSourceable sources the rendered env file with sh and checks
+// the values survive unchanged.
+func TestProxy_EnvSourceable(t *testing.T) {
+	shPath, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available; skipping env file check")
+	}
+	path := filepath.Join(t.TempDir(), "proxy.env")
+	if err := os.WriteFile(path, []byte(proxyEnv(proxyConfig())+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(shPath, "-c", `. "$1"; printf '%s|%s' "$https_proxy" "$NO_PROXY"`, "sh", path).Output()
+	if err != nil {
+		t.Fatalf("source env file: %v", err)
+	}
+	if want := "http://proxy.example.com:3128|.corp.example.com,localhost,10.244.0.0/16,mgmt.example.com"; string(out) != want {
+		t.Errorf("sourced values = %q, want %q", out, want)
+	}
+}
+
+func TestValidateProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(p *ProxyConfig)
+		wantErr string
+	}{
+		{"valid", func(*ProxyConfig) {}, ""},
+		{"https only", func(p *ProxyConfig) { p.HTTPProxy = "" }, ""},
+		{"no proxy URL", func(p *ProxyConfig) { p.HTTPProxy, p.HTTPSProxy = "", "" }, "at least one"},
+		{"credentials in URL", func(p *ProxyConfig) { p.HTTPProxy = "http://u:p@proxy:3128" }, "proxy.httpProxy"},
+		{"quote in URL", func(p *ProxyConfig) { p.HTTPSProxy = "http://proxy'$(id)'" }, "proxy.httpsProxy"},
+		{"socks scheme", func(p *ProxyConfig) { p.HTTPSProxy = "socks5://proxy:1080" }, "proxy.httpsProxy"},
+		{"space in noProxy", func(p *ProxyConfig) { p.NoProxy[0] = "a b" }, "proxy.noProxy[0]"},
+		{"comma in noProxy", func(p *ProxyConfig) { p.NoProxy[0] = "a,b" }, "proxy.noProxy[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := proxyConfig()
+			tt.mutate(p)
+			err := validateProxy(p)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
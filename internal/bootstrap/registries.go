@@ -0,0 +1,350 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// RegistriesConfig is the render-ready view of KairosConfig.Spec.Registries
+// with every auth Secret already resolved by the controller. registryFiles
+// turns it into the distribution's containerd configuration; every field is
+// re-validated at render time by validateRegistries.
+type RegistriesConfig struct {
+	Mirrors []RegistryMirrorConfig
+	Configs []RegistryHostConfig
+}
+
+// RegistryMirrorConfig maps an upstream registry to its mirror endpoints.
+type RegistryMirrorConfig struct {
+	// Registry is the upstream registry host, or "*" for every registry.
+	Registry string
+	// Endpoints are the http(s) mirror URLs in order of preference.
+	Endpoints []string
+}
+
+// RegistryHostConfig holds the TLS settings and resolved credentials for one
+// registry host. Username and Password are both empty for anonymous pulls.
+type RegistryHostConfig struct {
+	Host               string
+	CA                 string
+	InsecureSkipVerify bool
+	Username           string
+	Password           string
+}
+
+// nodeFile is one write_files entry produced by a renderer helper such as
+// registryFiles. Content is marshaled YAML/TOML, a validated
+// PEM bundle, or a generated unit file, embedded with indent.
+type nodeFile struct {
+	Path        string
+	Permissions string
+	Content     string
+}
+
+// Node-side locations of the rendered registry configuration. k3s and rke2
+// read registries.yaml natively; k0s merges containerd.d drop-ins into its CRI
+// configuration, and the drop-in points containerd at the hosts directory.
+// All of them sit under persistent paths (see persistency.go).
+const (
+	k3sRegistriesPath       = "/etc/rancher/k3s/registries.yaml"
+	k3sRegistryCADir        = "/etc/rancher/k3s/registry-ca"
+	rke2RegistriesPath      = "/etc/rancher/rke2/registries.yaml"
+	rke2RegistryCADir       = "/etc/rancher/rke2/registry-ca"
+	k0sRegistriesDropInPath = "/etc/k0s/containerd.d/10-kairos-registries.toml"
+	k0sRegistryHostsDir     = "/etc/k0s/certs.d"
+	k0sRegistryCADir        = "/etc/k0s/registry-ca"
+)
+
+// registryFiles renders the registry configuration for the named
+// distribution. Both formats are produced by marshaling typed values; the only
+// hand-written TOML is the [host."<endpoint>"] table header, whose endpoint
+// validateRegistries restricts to printable ASCII without quotes or
+// backslashes. The files carrying credentials are 0600.
+func registryFiles(distribution string, r *RegistriesConfig) ([]nodeFile, error) {
+	if r == nil {
+		return nil, nil
+	}
+	switch distribution {
+	case "k3s":
+		return k3sRegistryFiles(r, k3sRegistriesPath, k3sRegistryCADir)
+	case "rke2":
+		return k3sRegistryFiles(r, rke2RegistriesPath, rke2RegistryCADir)
+	}
+	return k0sRegistryFiles(r)
+}
+
+type k3sRegistries struct {
+	Mirrors map[string]k3sRegistryMirror `yaml:"mirrors,omitempty"`
+	Configs map[string]k3sRegistryConfig `yaml:"configs,omitempty"`
+}
+
+type k3sRegistryMirror struct {
+	Endpoint []string `yaml:"endpoint"`
+}
+
+type k3sRegistryConfig struct {
+	Auth *k3sRegistryAuth `yaml:"auth,omitempty"`
+	TLS  *k3sRegistryTLS  `yaml:"tls,omitempty"`
+}
+
+type k3sRegistryAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type k3sRegistryTLS struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// k3sRegistryFiles renders a k3s-format registries.yaml at registriesPath,
+// with CA files under caDir. rke2 reads the same format from its own
+// configuration directory.
+func k3sRegistryFiles(r *RegistriesConfig, registriesPath, caDir string) ([]nodeFile, error) {
+	var files []nodeFile
+	regs := k3sRegistries{}
+	for _, m := range r.Mirrors {
+		if regs.Mirrors == nil {
+			regs.Mirrors = map[string]k3sRegistryMirror{}
+		}
+		regs.Mirrors[m.Registry] = k3sRegistryMirror{Endpoint: m.Endpoints}
+	}
+	for _, c := range r.Configs {
+		var cfg k3sRegistryConfig
+		if c.Username != "" {
+			cfg.Auth = &k3sRegistryAuth{Username: c.Username, Password: c.Password}
+		}
+		if c.CA != "" || c.InsecureSkipVerify {
+			cfg.TLS = &k3sRegistryTLS{InsecureSkipVerify: c.InsecureSkipVerify}
+		}
+		if c.CA != "" {
+			cfg.TLS.CAFile = caDir + "/" + registryFileName(c.Host) + ".crt"
+			files = append(files, nodeFile{Path: cfg.TLS.CAFile, Permissions: "0644", Content: c.CA})
+		}
+		if cfg.Auth == nil && cfg.TLS == nil {
+			continue
+		}
+		if regs.Configs == nil {
+			regs.Configs = map[string]k3sRegistryConfig{}
+		}
+		regs.Configs[c.Host] = cfg
+	}
+	b, err := yaml.Marshal(regs)
+	if err != nil {
+		return nil, fmt.Errorf("marshal registries.yaml: %w", err)
+	}
+	files = append(files, nodeFile{Path: registriesPath, Permissions: "0600", Content: string(b)})
+	return files, nil
+}
+
+// k0sHostsFile is the top of a containerd hosts.toml: the upstream server and
+// the TLS settings used when pulling from it directly.
+type k0sHostsFile struct {
+	Server     string `toml:"server,omitempty"`
+	CA         string `toml:"ca,omitempty"`
+	SkipVerify bool   `toml:"skip_verify,omitempty"`
+}
+
+// k0sHostEntry is the body of one [host."<endpoint>"] table. containerd tries
+// the tables in file order, which is why they are written one by one rather
+// than marshaled as a (sorted) map.
+type k0sHostEntry struct {
+	Capabilities []string `toml:"capabilities"`
+	CA           string   `toml:"ca,omitempty"`
+	SkipVerify   bool     `toml:"skip_verify,omitempty"`
+}
+
+func k0sRegistryFiles(r *RegistriesConfig) ([]nodeFile, error) {
+	var files []nodeFile
+	configs := map[string]RegistryHostConfig{}
+	caFiles := map[string]string{}
+	for _, c := range r.Configs {
+		configs[c.Host] = c
+		if c.CA != "" {
+			caFiles[c.Host] = k0sRegistryCADir + "/" + registryFileName(c.Host) + ".crt"
+			files = append(files, nodeFile{Path: caFiles[c.Host], Permissions: "0644", Content: c.CA})
+		}
+	}
+
+	hostsFile := func(registry string, endpoints []string) (nodeFile, error) {
+		top := k0sHostsFile{}
+		if registry != "*" {
+			top.Server = registryUpstreamURL(registry)
+			top.CA = caFiles[registry]
+			top.SkipVerify = configs[registry].InsecureSkipVerify
+		}
+		b, err := toml.Marshal(top)
+		if err != nil {
+			return nodeFile{}, fmt.Errorf("marshal hosts.toml for %s: %w", registry, err)
+		}
+		var sb strings.Builder
+		sb.Write(b)
+		for _, e := range endpoints {
+			host := ""
+			if u, err := url.Parse(e); err == nil {
+				host = u.Host
+			}
+			b, err := toml.Marshal(k0sHostEntry{
+				Capabilities: []string{"pull", "resolve"},
+				CA:           caFiles[host],
+				SkipVerify:   configs[host].InsecureSkipVerify,
+			})
+			if err != nil {
+				return nodeFile{}, fmt.Errorf("marshal hosts.toml entry for %s: %w", registry, err)
+			}
+			fmt.Fprintf(&sb, "\n[host.\"%s\"]\n", e)
+			sb.Write(b)
+		}
+		return nodeFile{
+			Path:        k0sRegistryHostsDir + "/" + registryHostsDirName(registry) + "/hosts.toml",
+			Permissions: "0644",
+			Content:     sb.String(),
+		}, nil
+	}
+
+	mirrored := map[string]bool{}
+	for _, m := range r.Mirrors {
+		mirrored[m.Registry] = true
+		f, err := hostsFile(m.Registry, m.Endpoints)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	auths := map[string]any{}
+	for _, c := range r.Configs {
+		if !mirrored[c.Host] && (c.CA != "" || c.InsecureSkipVerify) {
+			f, err := hostsFile(c.Host, nil)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f)
+		}
+		if c.Username != "" {
+			auths[c.Host] = map[string]any{
+				"auth": map[string]string{"username": c.Username, "password": c.Password},
+			}
+		}
+	}
+
+	registry := map[string]any{"config_path": k0sRegistryHostsDir}
+	if len(auths) > 0 {
+		registry["configs"] = auths
+	}
+	b, err := toml.Marshal(map[string]any{
+		"version": 2,
+		"plugins": map[string]any{
+			"io.containerd.grpc.v1.cri": map[string]any{"registry": registry},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal k0s containerd registries drop-in: %w", err)
+	}
+	files = append(files, nodeFile{Path: k0sRegistriesDropInPath, Permissions: "0600", Content: string(b)})
+	return files, nil
+}
+
+// registryUpstreamURL is the server containerd falls back to when no mirror
+// answers. Docker Hub's API lives on a different host than its image names.
+func registryUpstreamURL(registry string) string {
+	if registry == "docker.io" {
+		return "https://registry-1.docker.io"
+	}
+	return "https://" + registry
+}
+
+// registryHostsDirName is the containerd hosts directory for a registry;
+// "_default" is containerd's catch-all.
+func registryHostsDirName(registry string) string {
+	if registry == "*" {
+		return "_default"
+	}
+	return registry
+}
+
+// registryFileName turns a host[:port] into a file name.
+func registryFileName(host string) string {
+	return strings.ReplaceAll(host, ":", "_")
+}
+
+// registryHostPattern mirrors the kubebuilder marker on RegistryConfig.Host.
+var registryHostPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?(:[0-9]{1,5})?$`)
+
+// validateRegistries re-applies the webhook checks at render time. Hosts and
+// endpoints become file paths and TOML table headers, so they are held to
+// their patterns here; credentials are only checked for control characters.
+func validateRegistries(r *RegistriesConfig) error {
+	var errs []error
+	for i, m := range r.Mirrors {
+		name := fmt.Sprintf("registries.mirrors[%d]", i)
+		if m.Registry != "*" && !registryHostPattern.MatchString(m.Registry) {
+			errs = append(errs, fmt.Errorf("%s.registry %q must be a host with an optional port, or \"*\"", name, m.Registry))
+		}
+		if len(m.Endpoints) == 0 {
+			errs = append(errs, fmt.Errorf("%s.endpoints: at least one endpoint is required", name))
+		}
+		for j, e := range m.Endpoints {
+			if !isRegistryEndpoint(e) {
+				errs = append(errs, fmt.Errorf("%s.endpoints[%d] %q must be an http(s) URL with a host and no credentials, query, whitespace, quotes, or backslashes", name, j, e))
+			}
+		}
+	}
+	for i, c := range r.Configs {
+		name := fmt.Sprintf("registries.configs[%d]", i)
+		if !registryHostPattern.MatchString(c.Host) {
+			errs = append(errs, fmt.Errorf("%s.host %q must be a host with an optional port", name, c.Host))
+		}
+		if c.CA != "" {
+			if err := validatePEMCertificates(name+".ca", c.CA); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, f := range []struct{ name, value string }{
+			{name + ".username", c.Username},
+			{name + ".password", c.Password},
+		} {
+			if err := rejectControlChars(f.name, f.value); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if (c.Username == "") != (c.Password == "") {
+			errs = append(errs, fmt.Errorf("%s: username and password must both be set or both be empty", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isRegistryEndpoint reports whether e is an http(s) mirror URL that can be
+// written into a TOML table header and a YAML list without escaping.
+func isRegistryEndpoint(e string) bool {
+	for _, r := range e {
+		if r <= ' ' || r > '~' || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	u, err := url.Parse(e)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.User == nil && u.RawQuery == "" && u.Fragment == ""
+}
@@ -0,0 +1,268 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+
+	toml "github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// registryPassword carries YAML, TOML and shell metacharacters; it must
+// round-trip through both formats unchanged.
+const registryPassword = `p"a'ss\word: $(id) #x`
+
+func registriesConfig() *RegistriesConfig {
+	return &RegistriesConfig{
+		Mirrors: []RegistryMirrorConfig{
+			{Registry: "docker.io", Endpoints: []string{"https://mirror.example.com:5000", "https://backup.example.com"}},
+			{Registry: "*", Endpoints: []string{"https://mirror.example.com:5000"}},
+		},
+		Configs: []RegistryHostConfig{
+			{Host: "mirror.example.com:5000", CA: testManagementCA, Username: "puller", Password: registryPassword},
+			{Host: "private.example.com", InsecureSkipVerify: true},
+		},
+	}
+}
+
+// registryRenders covers both infrastructure templates for both node roles.
+func registryRenders() map[string]TemplateData {
+	renders := map[string]TemplateData{}
+	for _, kv := range []bool{false, true} {
+		suffix := ""
+		if kv {
+			suffix = "/capk"
+		}
+		cp := haCPData("init", kv)
+		cp.Registries = registriesConfig()
+		renders["control-plane"+suffix] = cp
+		renders["worker"+suffix] = TemplateData{
+			Role:          "worker",
+			Hostname:      "w",
+			UserName:      "kairos",
+			WorkerToken:   "tok",
+			K3sServerURL:  "https://10.0.0.1:6443",
+			K3sToken:      "tok",
+			RKE2ServerURL: "https://10.0.0.1:9345",
+			RKE2Token:     "tok",
+			IsKubeVirt:    kv,
+			Registries:    registriesConfig(),
+		}
+	}
+	return renders
+}
+
+// TestRegistries_K3s asserts registries.yaml carries mirrors in order, the
+// resolved credentials and the CA file path, and that the CA is written.
+func TestRegistries_K3s(t *testing.T) {
+	for name, d := range registryRenders() {
+		t.Run(name, func(t *testing.T) {
+			out, err := RenderK3sCloudConfig(d)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			parseRendered(t, out)
+			if !strings.Contains(out, "- path: /etc/rancher/k3s/registries.yaml\n    permissions: \"0600\"") {
+				t.Error("registries.yaml is not 0600")
+			}
+			var regs k3sRegistries
+			if err := yaml.Unmarshal([]byte(extractWriteFile(t, out, "/etc/rancher/k3s/registries.yaml")), &regs); err != nil {
+				t.Fatalf("parse registries.yaml: %v", err)
+			}
+			if got := regs.Mirrors["docker.io"].Endpoint; strings.Join(got, ",") != "https://mirror.example.com:5000,https://backup.example.com" {
+				t.Errorf("docker.io endpoints = %v", got)
+			}
+			if _, ok := regs.Mirrors["*"]; !ok {
+				t.Error("wildcard mirror missing")
+			}
+			m := regs.Configs["mirror.example.com:5000"]
+			if m.Auth == nil || m.Auth.Username != "puller" || m.Auth.Password != registryPassword {
+				t.Errorf("mirror auth = %+v", m.Auth)
+			}
+			if m.TLS == nil || m.TLS.CAFile != "/etc/rancher/k3s/registry-ca/mirror.example.com_5000.crt" {
+				t.Errorf("mirror tls = %+v", m.TLS)
+			}
+			if p := regs.Configs["private.example.com"]; p.Auth != nil || p.TLS == nil || !p.TLS.InsecureSkipVerify {
+				t.Errorf("private config = %+v", p)
+			}
+			if ca := extractWriteFile(t, out, "/etc/rancher/k3s/registry-ca/mirror.example.com_5000.crt"); strings.TrimSpace(ca) != strings.TrimSpace(testManagementCA) {
+				t.Error("registry CA did not round-trip through the YAML block scalar")
+			}
+		})
+	}
+}
+
+// TestRegistries_RKE2 asserts rke2 gets the same registries.yaml as k3s,
+// under its own configuration directory.
+func TestRegistries_RKE2(t *testing.T) {
+	for name, d := range registryRenders() {
+		t.Run(name, func(t *testing.T) {
+			out, err := RenderRKE2CloudConfig(d)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			parseRendered(t, out)
+			if !strings.Contains(out, "- path: /etc/rancher/rke2/registries.yaml\n    permissions: \"0600\"") {
+				t.Error("registries.yaml is not 0600")
+			}
+			var regs k3sRegistries
+			if err := yaml.Unmarshal([]byte(extractWriteFile(t, out, "/etc/rancher/rke2/registries.yaml")), &regs); err != nil {
+				t.Fatalf("parse registries.yaml: %v", err)
+			}
+			if got := regs.Mirrors["docker.io"].Endpoint; strings.Join(got, ",") != "https://mirror.example.com:5000,https://backup.example.com" {
+				t.Errorf("docker.io endpoints = %v", got)
+			}
+			if m := regs.Configs["mirror.example.com:5000"]; m.TLS == nil || m.TLS.CAFile != "/etc/rancher/rke2/registry-ca/mirror.example.com_5000.crt" {
+				t.Errorf("mirror tls = %+v", m.TLS)
+			}
+			if ca := extractWriteFile(t, out, "/etc/rancher/rke2/registry-ca/mirror.example.com_5000.crt"); strings.TrimSpace(ca) != strings.TrimSpace(testManagementCA) {
+				t.Error("registry CA did not round-trip through the YAML block scalar")
+			}
+			if strings.Contains(out, "/etc/rancher/k3s/") {
+				t.Error("rke2 render references the k3s configuration directory")
+			}
+		})
+	}
+}
+
+// TestRegistries_K0s asserts the containerd drop-in points at the hosts
+// directory and carries the credentials, and that hosts.toml lists the mirror
+// endpoints in order with their TLS settings.
+func TestRegistries_K0s(t *testing.T) {
+	for name, d := range registryRenders() {
+		t.Run(name, func(t *testing.T) {
+			out, err := RenderK0sCloudConfig(d)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			parseRendered(t, out)
+			if !strings.Contains(out, "- path: /etc/k0s/containerd.d/10-kairos-registries.toml\n    permissions: \"0600\"") {
+				t.Error("containerd drop-in is not 0600")
+			}
+			var dropIn struct {
+				Version int `toml:"version"`
+				Plugins map[string]struct {
+					Registry struct {
+						ConfigPath string `toml:"config_path"`
+						Configs    map[string]struct {
+							Auth struct {
+								Username string `toml:"username"`
+								Password string `toml:"password"`
+							} `toml:"auth"`
+						} `toml:"configs"`
+					} `toml:"registry"`
+				} `toml:"plugins"`
+			}
+			if err := toml.Unmarshal([]byte(extractWriteFile(t, out, "/etc/k0s/containerd.d/10-kairos-registries.toml")), &dropIn); err != nil {
+				t.Fatalf("parse drop-in: %v", err)
+			}
+			cri := dropIn.Plugins["io.containerd.grpc.v1.cri"].Registry
+			if dropIn.Version != 2 || cri.ConfigPath != "/etc/k0s/certs.d" {
+				t.Errorf("drop-in version=%d config_path=%q", dropIn.Version, cri.ConfigPath)
+			}
+			if a := cri.Configs["mirror.example.com:5000"].Auth; a.Username != "puller" || a.Password != registryPassword {
+				t.Errorf("mirror auth = %+v", a)
+			}
+			if _, ok := cri.Configs["private.example.com"]; ok {
+				t.Error("anonymous registry got an auth entry")
+			}
+
+			hosts := extractWriteFile(t, out, "/etc/k0s/certs.d/docker.io/hosts.toml")
+			var parsed struct {
+				Server string `toml:"server"`
+				Host   map[string]struct {
+					Capabilities []string `toml:"capabilities"`
+					CA           string   `toml:"ca"`
+				} `toml:"host"`
+			}
+			if err := toml.Unmarshal([]byte(hosts), &parsed); err != nil {
+				t.Fatalf("parse hosts.toml: %v\n%s", err, hosts)
+			}
+			if parsed.Server != "https://registry-1.docker.io" {
+				t.Errorf("server = %q", parsed.Server)
+			}
+			if ca := parsed.Host["https://mirror.example.com:5000"].CA; ca != "/etc/k0s/registry-ca/mirror.example.com_5000.crt" {
+				t.Errorf("mirror ca = %q", ca)
+			}
+			first := strings.Index(hosts, `[host."https://mirror.example.com:5000"]`)
+			second := strings.Index(hosts, `[host."https://backup.example.com"]`)
+			if first < 0 || second < first {
+				t.Errorf("mirror endpoints out of order:\n%s", hosts)
+			}
+			if extractWriteFile(t, out, "/etc/k0s/certs.d/_default/hosts.toml") == "" {
+				t.Error("wildcard mirror hosts.toml missing")
+			}
+			if private := extractWriteFile(t, out, "/etc/k0s/certs.d/private.example.com/hosts.toml"); !strings.Contains(private, "skip_verify = true") {
+				t.Errorf("private hosts.toml = %q", private)
+			}
+		})
+	}
+}
+
+// TestRegistries_AbsentByDefault: renders without spec.registries carry none
+// of the registry files.
+func TestRegistries_AbsentByDefault(t *testing.T) {
+	d := haCPData("init", false)
+	for _, render := range []func(TemplateData) (string, error){RenderK0sCloudConfig, RenderK3sCloudConfig, RenderRKE2CloudConfig} {
+		out, err := render(d)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		for _, p := range []string{"registries.yaml", "containerd.d", "certs.d", "registry-ca"} {
+			if strings.Contains(out, p) {
+				t.Errorf("registry file %q rendered without spec.registries", p)
+			}
+		}
+	}
+}
+
+func TestValidateRegistries(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(r *RegistriesConfig)
+		wantErr string
+	}{
+		{"valid", func(*RegistriesConfig) {}, ""},
+		{"registry with path", func(r *RegistriesConfig) { r.Mirrors[0].Registry = "docker.io/library" }, "mirrors[0].registry"},
+		{"no endpoints", func(r *RegistriesConfig) { r.Mirrors[0].Endpoints = nil }, "at least one endpoint"},
+		{"endpoint with quote", func(r *RegistriesConfig) { r.Mirrors[0].Endpoints[0] = `https://m"]\n[x` }, "endpoints[0]"},
+		{"endpoint with credentials", func(r *RegistriesConfig) { r.Mirrors[0].Endpoints[0] = "https://u:p@m" }, "endpoints[0]"},
+		{"ftp endpoint", func(r *RegistriesConfig) { r.Mirrors[0].Endpoints[0] = "ftp://m" }, "endpoints[0]"},
+		{"host traversal", func(r *RegistriesConfig) { r.Configs[0].Host = "../../etc" }, "configs[0].host"},
+		{"bad CA", func(r *RegistriesConfig) { r.Configs[0].CA = "not a cert" }, "configs[0].ca"},
+		{"newline in password", func(r *RegistriesConfig) { r.Configs[0].Password = "a\nb" }, "configs[0].password"},
+		{"username without password", func(r *RegistriesConfig) { r.Configs[0].Password = "" }, "both be set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := registriesConfig()
+			tt.mutate(r)
+			err := validateRegistries(r)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want substring %q", err, tt.wantErr)
+			}
+		})
+	}
+}
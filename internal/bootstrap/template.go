@@ -40,10 +40,13 @@ var templateFS embed.FS
 // representation for Content automatically; per-field hand-assembly with
 // `quote` is NOT used for Files (KD-Files design).
 type TemplateData struct {
-	Role         string
-	SingleNode   bool
-	Hostname     string
-	UserName     string
+	Role       string
+	SingleNode bool
+	Hostname   string
+	UserName   string
+	// UserPassword is the users[].passwd value: the controller passes the
+	// crypt(3) hash from HashPassword, never plaintext. The renderer does not
+	// hash it itself, so golden renders stay deterministic.
 	UserPassword string
 	UserGroups   []string
 	GitHubUser   string
@@ -73,6 +76,8 @@ type TemplateData struct {
 	ProviderID                     string // ProviderID for the Node (e.g., "vsphere://<vm-uuid>"). Validated against providerIDPattern at render time.
 	K3sServerURL                   string
 	K3sToken                       string
+	RKE2ServerURL                  string
+	RKE2Token                      string
 	ControlPlaneLBServiceName      string
 	ControlPlaneLBServiceNamespace string
 	ControlPlaneLBEndpoint         string
@@ -92,7 +97,7 @@ type TemplateData struct {
 	// not branch on ControlPlaneRole when Role != "control-plane").
 	ControlPlaneRole string
 	// JoinToken is the cluster join token for an HA "join" node (k0s
-	// controller-join token / shared k3s server token). It is written to a
+	// controller-join token / shared k3s or rke2 server token). It is written to a
 	// 0600 token file via a write_files YAML block scalar — NOT a shell
 	// context — so its protection is literal-block-scalar embedding plus the
 	// rejectControlChars check in validate.go (no newline/CR/NUL), NOT shquote.
@@ -123,6 +128,52 @@ type TemplateData struct {
 	// management-cluster contact is rendered. Resolved by the controller from a
 	// ManagementEndpointResolver; see internal/controllers/bootstrap/CLAUDE.md.
 	ManagementEndpoint *ManagementEndpoint
+	// KubernetesVersion mirrors KairosConfig.Spec.KubernetesVersion. When set,
+	// every template renders the distribution version gate (an ExecStartPre
+	// on the k0s/k3s service) that refuses to start a release that differs
+	// from it; see version.go.
+	KubernetesVersion string
+	// DistributionRelease, when non-nil, tells the version gate where to
+	// fetch the matching release from on a mismatch. Nil means verify only.
+	DistributionRelease *DistributionReleaseConfig
+	// EtcdBackup, when non-nil on an HA control-plane render, emits the
+	// scheduled etcd snapshot timer, its script and its 0600 env file with the
+	// resolved S3 credentials; see etcd_backup.go.
+	EtcdBackup *EtcdBackupConfig
+	// EtcdRestore, when non-nil on an HA init render (with EtcdBackup), emits
+	// the one-shot snapshot restore that runs before the distribution first
+	// starts; see etcd_restore.go.
+	EtcdRestore *EtcdRestoreConfig
+	// Registries, when non-nil, emits the distribution's registry mirror,
+	// TLS and credentials files on every node; see registries.go.
+	Registries *RegistriesConfig
+	// Proxy, when non-nil, emits the egress proxy env file and the
+	// EnvironmentFile= drop-ins that load it on every node; see proxy.go.
+	Proxy *ProxyConfig
+	// AirgapImages, when non-empty, emits the image-bundle preload (an
+	// ExecStartPre on the k0s/k3s service, after the version gate) that places
+	// every bundle in the distribution's import directory; see airgap.go.
+	AirgapImages []AirgapBundleConfig
+	// Network, when non-nil, emits the systemd-networkd units for the static
+	// network configuration and the apply ExecStartPre on the k0s/k3s
+	// service that waits for them; see network.go.
+	Network *NetworkConfig
+	// Kubelet, when non-nil, carries the node labels, registration taints and
+	// extra kubelet flags: k0s --labels/--taints/--kubelet-extra-args, or the
+	// k3s config.yaml.d drop-in; see kubelet.go.
+	Kubelet *KubeletConfig
+	// K0sConfig is the user's k0s ClusterConfig spec fragment, merged into
+	// /etc/k0s/k0s.yaml with the provider-owned keys by k0sClusterConfig.
+	// Control-plane k0s renders only; see k0sconfig.go.
+	K0sConfig map[string]any
+	// K3sConfig, when non-nil, carries the user's k3s configuration file
+	// options, written to a config.yaml.d drop-in by k3sUserConfig. k3s
+	// renders only; see k3sconfig.go.
+	K3sConfig *K3sConfig
+	// CNI, when non-nil, replaces the distribution's default network plugin
+	// on control-plane nodes: the k0s network.provider or the k3s flannel
+	// drop-in, plus the chart resource added to Manifests; see cni.go.
+	CNI *CNIConfig
 }
 
 // ManagementEndpoint bundles the values the rendered cloud-config needs
@@ -161,6 +212,14 @@ type ManagementEndpoint struct {
 	// through text/template. Only meaningful for k0s init; k3s uses a
 	// controller-generated token and never runs this block.
 	JoinTokenSecretName string
+	// WorkerTokenSecretName, when non-empty AND the render is a k0s init node,
+	// enables the worker-token push block: the init node runs `k0s token
+	// create --role=worker` and PATCHes the token into this Secret over the
+	// same node-push channel. Like JoinTokenSecretName, the Secret is
+	// pre-created empty + owner-ref'd by the KCP controller, which rotates
+	// the token afterwards; the token is never interpolated through
+	// text/template. k3s workers get a controller-generated token instead.
+	WorkerTokenSecretName string
 	// EtcdStatusSecretName, when non-empty, enables the etcd-health reporter
 	// block (ADR 0005 §E.1): every HA control-plane node (init AND join) reports
 	// its own etcd member health into this per-cluster Secret over the same
@@ -171,6 +230,20 @@ type ManagementEndpoint struct {
 	// interpolated through text/template — the reporter builds the JSON on-node.
 	// Set for init+join (both distros); empty for single-node and workers.
 	EtcdStatusSecretName string
+	// AirgapStatusSecretName, when non-empty on a render with AirgapImages,
+	// makes the airgap preload report its result (ready, or missing with the
+	// failing bundle) into this per-cluster Secret under AirgapStatusKey, the
+	// KairosConfig name. The values reach the preload script only through its
+	// 0600 env file (airgapImagesEnv), each one shquote'd.
+	AirgapStatusSecretName string
+	AirgapStatusKey        string
+	// CABundle is the PEM-encoded CA bundle of the management apiserver. It is
+	// written to /usr/local/etc/kairos-capi/management-ca.crt (0600) and every
+	// node-push curl call verifies TLS against it (--cacert); the push blocks
+	// never use -k. When empty no CA file is rendered and the push calls fail
+	// closed (curl cannot load the CA file) rather than falling back to an
+	// unverified connection. Validated as PEM certificates at render time.
+	CABundle string
 }
 
 // InstallConfig holds installation configuration for the template
@@ -247,6 +320,10 @@ func (d TemplateData) RenderKubeVIP() bool {
 
 // RenderK0sCloudConfig renders the k0s Kairos cloud-config template.
 func RenderK0sCloudConfig(data TemplateData) (string, error) {
+	data, err := withCNIManifests("k0s", data)
+	if err != nil {
+		return "", err
+	}
 	templatePath := "templates/k0s_kairos_cloud_config_capv.yaml.tmpl"
 	if data.IsKubeVirt {
 		templatePath = "templates/k0s_kairos_cloud_config_capk.yaml.tmpl"
@@ -256,6 +333,10 @@ func RenderK0sCloudConfig(data TemplateData) (string, error) {
 
 // RenderK3sCloudConfig renders the k3s Kairos cloud-config template.
 func RenderK3sCloudConfig(data TemplateData) (string, error) {
+	data, err := withCNIManifests("k3s", data)
+	if err != nil {
+		return "", err
+	}
 	templatePath := "templates/k3s_kairos_cloud_config_capv.yaml.tmpl"
 	if data.IsKubeVirt {
 		templatePath = "templates/k3s_kairos_cloud_config_capk.yaml.tmpl"
@@ -263,7 +344,20 @@ func RenderK3sCloudConfig(data TemplateData) (string, error) {
 	return renderTemplate("k3s_kairos_cloud_config", templatePath, data)
 }
 
-// renderTemplate is the shared entry point for both distribution renderers.
+// RenderRKE2CloudConfig renders the rke2 Kairos cloud-config template.
+func RenderRKE2CloudConfig(data TemplateData) (string, error) {
+	data, err := withCNIManifests("rke2", data)
+	if err != nil {
+		return "", err
+	}
+	templatePath := "templates/rke2_kairos_cloud_config_capv.yaml.tmpl"
+	if data.IsKubeVirt {
+		templatePath = "templates/rke2_kairos_cloud_config_capk.yaml.tmpl"
+	}
+	return renderTemplate("rke2_kairos_cloud_config", templatePath, data)
+}
+
+// renderTemplate is the shared entry point for the distribution renderers.
 // It validates TemplateData, loads the template from the embedded FS, attaches
 // the shared FuncMap, executes, and returns the rendered cloud-config.
 //
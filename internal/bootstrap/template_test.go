@@ -296,6 +296,84 @@ func TestRenderK3sCloudConfig_Worker(t *testing.T) {
 	}
 }
 
+func TestRenderRKE2CloudConfig_ControlPlaneSingleNode(t *testing.T) {
+	data := TemplateData{
+		Role:         "control-plane",
+		SingleNode:   true,
+		Hostname:     "kairos-control-plane-rke2-0",
+		UserName:     "kairos",
+		UserPassword: "kairos",
+		UserGroups:   []string{"admin"},
+	}
+
+	result, err := RenderRKE2CloudConfig(data)
+	if err != nil {
+		t.Fatalf("Failed to render template: %v", err)
+	}
+	parseRendered(t, result)
+
+	if strings.Contains(result, "\nk3s:") || strings.Contains(result, "\nk0s:") {
+		t.Error("rke2 render must not carry a Kairos provider block")
+	}
+
+	if !strings.Contains(result, "/bin/systemctl enable --now --no-block rke2-server.service") {
+		t.Error("Missing rke2-server enable in runcmd")
+	}
+
+	if !strings.Contains(result, "/bin/systemctl enable --now kairos-rke2-post-bootstrap.service") {
+		t.Error("Missing systemctl enable for rke2 post-bootstrap service in runcmd")
+	}
+
+	if !strings.Contains(result, "/etc/systemd/system/rke2-server.service.d/00-skip-on-live-installer.conf") {
+		t.Error("Missing live-installer drop-in for rke2-server")
+	}
+
+	if strings.Contains(result, "/etc/rancher/rke2/config.yaml.d/10-kairos-server.yaml") {
+		t.Error("Single-node server should not get a join drop-in")
+	}
+}
+
+func TestRenderRKE2CloudConfig_Worker(t *testing.T) {
+	data := TemplateData{
+		Role:          "worker",
+		UserName:      "kairos",
+		UserPassword:  "kairos",
+		UserGroups:    []string{"admin"},
+		RKE2ServerURL: "https://10.0.0.10:9345",
+		RKE2Token:     "test-rke2-token",
+	}
+
+	result, err := RenderRKE2CloudConfig(data)
+	if err != nil {
+		t.Fatalf("Failed to render template: %v", err)
+	}
+	parseRendered(t, result)
+
+	var agent map[string]any
+	if err := yaml.Unmarshal([]byte(extractWriteFile(t, result, "/etc/rancher/rke2/config.yaml.d/10-kairos-agent.yaml")), &agent); err != nil {
+		t.Fatalf("parse agent drop-in: %v", err)
+	}
+	if agent["server"] != "https://10.0.0.10:9345" || agent["token-file"] != "/etc/rancher/rke2/token" {
+		t.Errorf("agent drop-in = %v", agent)
+	}
+
+	if !strings.Contains(result, "- path: /etc/rancher/rke2/token\n    permissions: \"0600\"") {
+		t.Error("rke2 token file is not 0600")
+	}
+
+	if strings.TrimSpace(extractWriteFile(t, result, "/etc/rancher/rke2/token")) != "test-rke2-token" {
+		t.Error("Missing rke2 token in file content")
+	}
+
+	if !strings.Contains(result, "/bin/systemctl enable --now --no-block rke2-agent.service") {
+		t.Error("Missing rke2-agent enable in runcmd")
+	}
+
+	if strings.Contains(result, "rke2-server.service") {
+		t.Error("Worker should not reference rke2-server")
+	}
+}
+
 func TestRenderK3sCloudConfig_ControlPlaneWithProviderID(t *testing.T) {
 	data := TemplateData{
 		Role:         "control-plane",
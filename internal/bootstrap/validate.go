@@ -17,6 +17,8 @@ permissions and limitations under the License.
 package bootstrap
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net"
@@ -91,6 +93,8 @@ func validateTemplateData(d *TemplateData) error {
 		{"workerToken", d.WorkerToken},
 		{"k3sServerURL", d.K3sServerURL},
 		{"k3sToken", d.K3sToken},
+		{"rke2ServerURL", d.RKE2ServerURL},
+		{"rke2Token", d.RKE2Token},
 		{"podCIDR", d.PodCIDR},
 		{"serviceCIDR", d.ServiceCIDR},
 		{"primaryIP", d.PrimaryIP},
@@ -122,12 +126,20 @@ func validateTemplateData(d *TemplateData) error {
 			{"managementEndpoint.kubeconfigSecretName", d.ManagementEndpoint.KubeconfigSecretName},
 			{"managementEndpoint.kubeconfigSecretNamespace", d.ManagementEndpoint.KubeconfigSecretNamespace},
 			{"managementEndpoint.joinTokenSecretName", d.ManagementEndpoint.JoinTokenSecretName},
+			{"managementEndpoint.workerTokenSecretName", d.ManagementEndpoint.WorkerTokenSecretName},
 		}
 		for _, f := range nested {
 			if err := rejectControlChars(f.name, f.value); err != nil {
 				errs = append(errs, err)
 			}
 		}
+		// CABundle is multi-line by nature, so it cannot go through
+		// rejectControlChars; hold it to "PEM certificates only" instead.
+		if d.ManagementEndpoint.CABundle != "" {
+			if err := validateCABundle(d.ManagementEndpoint.CABundle); err != nil {
+				errs = append(errs, err)
+			}
+		}
 	}
 	for i, g := range d.UserGroups {
 		if err := rejectControlChars(fmt.Sprintf("userGroups[%d]", i), g); err != nil {
@@ -173,6 +185,27 @@ func validateTemplateData(d *TemplateData) error {
 			}
 		}
 	}
+	// contentFrom is resolved into Content by the controller; an unresolved
+	// reference would render an empty file. A manifest is written through a
+	// quoted heredoc, so a line equal to its terminator would end the heredoc
+	// early and run the rest of the manifest as shell. Resolved content comes
+	// from Secrets and ConfigMaps the webhook never sees.
+	for i, f := range d.Files {
+		if f.ContentFrom != nil {
+			errs = append(errs, fmt.Errorf("files[%d].contentFrom was not resolved", i))
+		}
+	}
+	for i, m := range d.Manifests {
+		if m.ContentFrom != nil {
+			errs = append(errs, fmt.Errorf("manifests[%d].contentFrom was not resolved", i))
+		}
+		for _, line := range strings.Split(m.Content, "\n") {
+			if strings.TrimSpace(line) == manifestHeredocTerminator {
+				errs = append(errs, fmt.Errorf("manifests[%d].content: must not contain a %s line", i, manifestHeredocTerminator))
+				break
+			}
+		}
+	}
 	// VIP (kube-vip) is render-time re-validated (VIP-INV-3): older API servers
 	// may skip CRD pattern validation, and the renderer is the last line of
 	// defense before root-privileged userdata. Only validated when set; a nil
@@ -182,6 +215,68 @@ func validateTemplateData(d *TemplateData) error {
 			errs = append(errs, err)
 		}
 	}
+	// KubernetesVersion lands in the version-gate env file and, for a URL
+	// release source, in the download path; hold it to the API pattern.
+	if d.KubernetesVersion != "" && !kubernetesVersionPattern.MatchString(d.KubernetesVersion) {
+		errs = append(errs, fmt.Errorf("kubernetesVersion %q does not match required pattern %q", d.KubernetesVersion, kubernetesVersionPattern.String()))
+	}
+	if d.DistributionRelease != nil {
+		if err := validateDistributionRelease(d.DistributionRelease, d.KubernetesVersion); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if d.EtcdBackup != nil {
+		if err := validateEtcdBackup(d.EtcdBackup); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if d.EtcdRestore != nil {
+		if err := validateEtcdRestore(d.EtcdRestore, d.EtcdBackup); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if d.Registries != nil {
+		if err := validateRegistries(d.Registries); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if d.Proxy != nil {
+		if err := validateProxy(d.Proxy); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(d.AirgapImages) > 0 {
+		if err := validateAirgapImages(d.AirgapImages); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if d.Network != nil {
+		if err := validateNetwork(d.Network); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if d.Kubelet != nil {
+		if err := validateKubelet(d.Kubelet); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(d.K0sConfig) > 0 {
+		if err := validateK0sConfig(d.K0sConfig, d.IsHAControlPlane()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if d.K3sConfig != nil {
+		if err := validateK3sConfig(d.K3sConfig, d.Role); err != nil {
+			errs = append(errs, err)
+		}
+		for _, c := range []struct{ key, field, value string }{
+			{"cluster-cidr", "podCIDR", d.PodCIDR}, {"service-cidr", "serviceCIDR", d.ServiceCIDR},
+		} {
+			if _, set := d.K3sConfig.Server[c.key]; set && c.value != "" {
+				errs = append(errs, fmt.Errorf("k3sConfig.server[%s] is set by the provider from %s", c.key, c.field))
+			}
+		}
+	}
 	return errors.Join(errs...)
 }
 
@@ -232,6 +327,10 @@ func validateVIP(v *VIPConfig) error {
 	return errors.Join(errs...)
 }
 
+// manifestHeredocTerminator ends the quoted heredoc each manifest is written
+// with in the templates.
+const manifestHeredocTerminator = "MANIFEST_EOF"
+
 // filePermissionsPattern matches octal file-permission strings.
 // Mirrors the kubebuilder marker on File.Permissions.
 var filePermissionsPattern = regexp.MustCompile(`^0?[0-7]{3,4}$`)
@@ -253,3 +352,38 @@ func rejectControlChars(field, s string) error {
 	}
 	return nil
 }
+
+// validateCABundle accepts only a sequence of PEM CERTIFICATE blocks that
+// parse as X.509 certificates, with nothing but whitespace around them. The
+// bundle is embedded in a YAML block scalar via indent, so this shape check
+// (not quoting) is what keeps arbitrary text out of the rendered file.
+func validateCABundle(bundle string) error {
+	return validatePEMCertificates("managementEndpoint.caBundle", bundle)
+}
+
+// validatePEMCertificates is validateCABundle for any named PEM bundle field.
+func validatePEMCertificates(field, bundle string) error {
+	rest := []byte(bundle)
+	n := 0
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return fmt.Errorf("%s: unexpected PEM block %q (only CERTIFICATE is allowed)", field, block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("%s: certificate %d does not parse: %w", field, n, err)
+		}
+		n++
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: no PEM certificates found", field)
+	}
+	if len(strings.TrimSpace(string(rest))) != 0 {
+		return fmt.Errorf("%s: unexpected trailing data after the last certificate", field)
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DistributionReleaseConfig is the render-ready view of
+// KairosConfig.Spec.DistributionRelease: where the node installs the k0s/k3s
+// release matching KubernetesVersion from, and what it does when the release
+// it would run still differs. At most one of Image/Path/URL is set.
+//
+// Every field lands in the version-gate env file as a shquote'd shell
+// assignment (see distributionReleaseEnv) and is re-validated at render time
+// by validateDistributionRelease — the webhook is not the only gate.
+type DistributionReleaseConfig struct {
+	// Image is an OCI image reference unpacked with `luet util unpack`.
+	Image string
+	// Path is an absolute path to a pre-staged binary on the node.
+	Path string
+	// URL is the base URL of a release mirror laid out like upstream GitHub
+	// releases (<url>/<version>/<asset>).
+	URL string
+	// SHA256 is the expected hex digest of the fetched binary (optional).
+	SHA256 string
+	// OnMismatch is "Fail" (default when empty) or "Warn".
+	OnMismatch string
+}
+
+// RenderVersionGate reports whether the distribution version gate is rendered.
+// True whenever KubernetesVersion is set — the controller always sets it (the
+// API field is required), so every real render pins the release; fixtures that
+// predate the field render byte-for-byte as before.
+func (d TemplateData) RenderVersionGate() bool {
+	return d.KubernetesVersion != ""
+}
+
+// distributionVersionGateScript is the node-side version gate. It runs as an
+// ExecStartPre of the k0s/k3s/rke2 service (systemd drop-in rendered by every
+// template) and:
+//
+//  1. reads the distribution, wanted release, mismatch policy and optional
+//     release source from the env file written next to it;
+//  2. compares the release the service is about to start (`k0s version` /
+//     `k3s --version` / `rke2 --version`) with the wanted release;
+//  3. on a mismatch with a source configured, stages the matching binary under
+//     /usr/local/lib/kairos-capi (persistent) and bind-mounts it over the
+//     image's binary — the immutable rootfs is never written;
+//  4. records the outcome in /run/cluster-api/kubernetes-version and, when the
+//     release still does not match, exits non-zero (onMismatch=Fail) so the
+//     distribution never starts on the wrong version, or logs and continues
+//     (onMismatch=Warn). The KairosConfig KubernetesVersionMatched condition is
+//     the management-side view of the same check.
+//
+// The cloud-config rewrites the env file with the provisioning-time release on
+// every boot, so an in-place upgrade (spec.rolloutStrategy.type=InPlace on the
+// KairosControlPlane) records the release of the image it installs in a
+// separate file, InPlaceUpgradeVersionFile. A binary matching that release
+// passes the gate too; a node whose upgrade never happened still matches the
+// env file.
+//
+// SECURITY: the script is a compile-time constant, like persistencyOEMContent.
+// No TemplateData field is interpolated into it; operator-influenced values
+// reach it only through the env file, where distributionReleaseEnv emits every
+// value through shquote, and every value is re-validated at render time.
+const distributionVersionGateScript = `#!/bin/bash
+# Kairos CAPI distribution version gate (ExecStartPre of the distribution service).
+set -uo pipefail
+
+env_file=/usr/local/etc/kairos-capi/distribution-release.env
+upgrade_version_file=/usr/local/etc/kairos-capi/in-place-upgrade-version
+status_file=/run/cluster-api/kubernetes-version
+stage_dir=/usr/local/lib/kairos-capi
+
+# The distribution never runs on the Kairos live installer.
+if grep -qw cdroot /proc/cmdline 2>/dev/null; then
+  exit 0
+fi
+if [ ! -f "${env_file}" ]; then
+  echo "kairos-version-gate: ${env_file} not found; nothing to verify"
+  exit 0
+fi
+# shellcheck source=/dev/null
+. "${env_file}"
+
+DISTRIBUTION="${DISTRIBUTION:-}"
+WANT_VERSION="${WANT_VERSION:-}"
+ON_MISMATCH="${ON_MISMATCH:-Fail}"
+SOURCE_TYPE="${SOURCE_TYPE:-}"
+SOURCE="${SOURCE:-}"
+SHA256="${SHA256:-}"
+have=""
+
+# Written by the in-place upgrade; a single release string, never sourced.
+UPGRADE_VERSION=""
+if [ -f "${upgrade_version_file}" ]; then
+  UPGRADE_VERSION="$(head -n 1 "${upgrade_version_file}" | tr -d '[:space:]')"
+  if ! [[ "${UPGRADE_VERSION}" =~ ^v?[0-9]+\.[0-9]+\.[0-9]+([-+][0-9A-Za-z.+-]+)?$ ]]; then
+    echo "kairos-version-gate: ignoring malformed ${upgrade_version_file}"
+    UPGRADE_VERSION=""
+  fi
+fi
+
+report() {
+  mkdir -p "$(dirname "${status_file}")"
+  printf 'result=%s\nwant=%s\nhave=%s\n' "$1" "${WANT_VERSION}" "${have}" > "${status_file}"
+  echo "kairos-version-gate: $2"
+}
+
+binary_version() {
+  case "${DISTRIBUTION}" in
+    k0s) "$1" version 2>/dev/null | head -n 1 | tr -d '[:space:]' ;;
+    k3s|rke2) "$1" --version 2>/dev/null | head -n 1 | awk '{print $3}' ;;
+  esac
+}
+
+# An exact release tag must match exactly; a bare Kubernetes version matches
+# any distribution release of it (v1.34.1 matches v1.34.1+k0s.1). The wanted
+# release is $2, or WANT_VERSION.
+version_matches() {
+  local got="${1#v}" want="${2:-${WANT_VERSION}}"
+  want="${want#v}"
+  [ -n "${got}" ] || return 1
+  [ "${got}" = "${want}" ] && return 0
+  case "${want}" in
+    *+*) return 1 ;;
+  esac
+  case "${got}" in
+    "${want}+"*) return 0 ;;
+  esac
+  return 1
+}
+
+fetch_release() {
+  local tmp="${staged}.partial"
+  rm -rf "${tmp}" "${tmp}.d"
+  case "${SOURCE_TYPE}" in
+    path)
+      cp -f "${SOURCE}" "${tmp}" || return 1
+      ;;
+    url)
+      local arch asset
+      case "$(uname -m)" in
+        x86_64|amd64) arch=amd64 ;;
+        aarch64|arm64) arch=arm64 ;;
+        armv7l|armhf) arch=arm ;;
+        *) arch="$(uname -m)" ;;
+      esac
+      if [ "${DISTRIBUTION}" = "k0s" ]; then
+        asset="k0s-${WANT_VERSION}-${arch}"
+      elif [ "${DISTRIBUTION}" = "rke2" ]; then
+        asset="rke2.linux-${arch}"
+      elif [ "${arch}" = "amd64" ]; then
+        asset="k3s"
+      elif [ "${arch}" = "arm" ]; then
+        asset="k3s-armhf"
+      else
+        asset="k3s-${arch}"
+      fi
+      command -v curl >/dev/null 2>&1 || return 1
+      curl -fsSL --retry 5 --retry-delay 5 -o "${tmp}" "${SOURCE%/}/${WANT_VERSION}/${asset}" || return 1
+      ;;
+    image)
+      command -v luet >/dev/null 2>&1 || return 1
+      mkdir -p "${tmp}.d"
+      if ! luet util unpack "${SOURCE}" "${tmp}.d" >/dev/null; then
+        rm -rf "${tmp}.d"
+        return 1
+      fi
+      local candidate found=""
+      for candidate in "${tmp}.d/${DISTRIBUTION}" "${tmp}.d/usr/local/bin/${DISTRIBUTION}" "${tmp}.d/usr/bin/${DISTRIBUTION}"; do
+        if [ -f "${candidate}" ]; then
+          found="${candidate}"
+          break
+        fi
+      done
+      if [ -z "${found}" ]; then
+        rm -rf "${tmp}.d"
+        return 1
+      fi
+      mv -f "${found}" "${tmp}"
+      rm -rf "${tmp}.d"
+      ;;
+    *)
+      return 1
+      ;;
+  esac
+  if [ -n "${SHA256}" ] && ! printf '%s  %s\n' "${SHA256}" "${tmp}" | sha256sum -c - >/dev/null 2>&1; then
+    echo "kairos-version-gate: sha256 mismatch for the fetched ${DISTRIBUTION} release; discarding it"
+    rm -f "${tmp}"
+    return 1
+  fi
+  chmod 0755 "${tmp}"
+  mv -f "${tmp}" "${staged}"
+}
+
+case "${DISTRIBUTION}" in
+  k0s|k3s|rke2) ;;
+  *)
+    echo "kairos-version-gate: unsupported distribution '${DISTRIBUTION}'"
+    exit 1
+    ;;
+esac
+
+bin="$(command -v "${DISTRIBUTION}" 2>/dev/null || true)"
+[ -n "${bin}" ] || bin="/usr/bin/${DISTRIBUTION}"
+if [ -x "${bin}" ]; then
+  have="$(binary_version "${bin}" || true)"
+fi
+if version_matches "${have}"; then
+  report match "${DISTRIBUTION} ${have} matches kubernetesVersion ${WANT_VERSION}"
+  exit 0
+fi
+if [ -n "${UPGRADE_VERSION}" ] && version_matches "${have}" "${UPGRADE_VERSION}"; then
+  WANT_VERSION="${UPGRADE_VERSION}"
+  report match "${DISTRIBUTION} ${have} matches the in-place upgrade release ${UPGRADE_VERSION}"
+  exit 0
+fi
+
+if [ -n "${SOURCE_TYPE}" ]; then
+  staged="${stage_dir}/${DISTRIBUTION}-${WANT_VERSION}"
+  mkdir -p "${stage_dir}"
+  staged_version=""
+  [ -x "${staged}" ] && staged_version="$(binary_version "${staged}" || true)"
+  if ! version_matches "${staged_version}"; then
+    if ! fetch_release; then
+      echo "kairos-version-gate: could not fetch ${DISTRIBUTION} ${WANT_VERSION} from the ${SOURCE_TYPE} source"
+    fi
+    staged_version=""
+    [ -x "${staged}" ] && staged_version="$(binary_version "${staged}" || true)"
+  fi
+  if version_matches "${staged_version}"; then
+    if [ -e "${bin}" ] && mount --bind "${staged}" "${bin}"; then
+      have="$(binary_version "${bin}" || true)"
+    else
+      echo "kairos-version-gate: could not bind-mount ${staged} over ${bin}"
+    fi
+  elif [ -n "${staged_version}" ]; then
+    echo "kairos-version-gate: staged release reports ${staged_version}, not ${WANT_VERSION}"
+  fi
+  if version_matches "${have}"; then
+    report installed "installed ${DISTRIBUTION} ${have} from the ${SOURCE_TYPE} source"
+    exit 0
+  fi
+fi
+
+report mismatch "${DISTRIBUTION} release '${have}' does not match kubernetesVersion ${WANT_VERSION}"
+if [ "${ON_MISMATCH}" = "Warn" ]; then
+  echo "kairos-version-gate: onMismatch=Warn; starting ${DISTRIBUTION} anyway"
+  exit 0
+fi
+exit 1
+`
+
+// InPlaceUpgradeVersionFile is where an in-place upgrade records the release
+// of the image it installs, for the version gate. It lives on the persistent
+// /usr/local and is not part of the cloud-config.
+const InPlaceUpgradeVersionFile = "/usr/local/etc/kairos-capi/in-place-upgrade-version"
+
+// distributionVersionGate returns the static version-gate script. Zero-arg on
+// purpose (see the SECURITY note on distributionVersionGateScript); intended to
+// be piped through `indent N` under a `content: |` block scalar.
+func distributionVersionGate() string {
+	return distributionVersionGateScript
+}
+
+// distributionReleaseEnv renders the env file the version gate sources. The
+// template passes the distribution name explicitly ("k0s"/"k3s"/"rke2") because the
+// renderer picks the distribution by entry point, not by a TemplateData field.
+// Every value is emitted through shquote; the file is sourced by bash.
+func distributionReleaseEnv(distribution string, d TemplateData) string {
+	onMismatch := "Fail"
+	var lines []string
+	add := func(k, v string) {
+		lines = append(lines, k+"="+shquote(v))
+	}
+	add("DISTRIBUTION", distribution)
+	add("WANT_VERSION", d.KubernetesVersion)
+	if r := d.DistributionRelease; r != nil {
+		if r.OnMismatch != "" {
+			onMismatch = r.OnMismatch
+		}
+		switch {
+		case r.Image != "":
+			add("SOURCE_TYPE", "image")
+			add("SOURCE", r.Image)
+		case r.Path != "":
+			add("SOURCE_TYPE", "path")
+			add("SOURCE", r.Path)
+		case r.URL != "":
+			add("SOURCE_TYPE", "url")
+			add("SOURCE", r.URL)
+		}
+		if r.SHA256 != "" {
+			add("SHA256", r.SHA256)
+		}
+	}
+	add("ON_MISMATCH", onMismatch)
+	return strings.Join(lines, "\n")
+}
+
+// kubernetesVersionPattern mirrors the kubebuilder marker on
+// KairosConfigSpec.KubernetesVersion. Re-asserted at render time because the
+// value lands in the version-gate env file and, for a URL source, in the
+// download path.
+var kubernetesVersionPattern = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+([-+][0-9A-Za-z.+-]+)?$`)
+
+// sha256Pattern mirrors the kubebuilder marker on DistributionRelease.SHA256.
+var sha256Pattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// validateDistributionRelease re-applies the webhook checks on the release
+// source at render time: at most one source, an absolute traversal-free Path,
+// an http(s) URL without credentials, a hex SHA256, and a known mismatch
+// policy. Control characters are rejected on every field.
+func validateDistributionRelease(r *DistributionReleaseConfig, kubernetesVersion string) error {
+	var errs []error
+	fields := []struct{ name, value string }{
+		{"distributionRelease.image", r.Image},
+		{"distributionRelease.path", r.Path},
+		{"distributionRelease.url", r.URL},
+		{"distributionRelease.sha256", r.SHA256},
+		{"distributionRelease.onMismatch", r.OnMismatch},
+	}
+	sources := 0
+	for _, f := range fields {
+		if err := rejectControlChars(f.name, f.value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, s := range []string{r.Image, r.Path, r.URL} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		errs = append(errs, fmt.Errorf("distributionRelease: at most one of image, path, or url may be set"))
+	}
+	if r.Image != "" && strings.ContainsAny(r.Image, " \t'\"\\$`;|&") {
+		errs = append(errs, fmt.Errorf("distributionRelease.image %q must not contain whitespace or shell metacharacters", r.Image))
+	}
+	if r.Path != "" {
+		if !strings.HasPrefix(r.Path, "/") {
+			errs = append(errs, fmt.Errorf("distributionRelease.path %q must be absolute", r.Path))
+		}
+		for _, seg := range strings.Split(r.Path, "/") {
+			if seg == ".." {
+				errs = append(errs, fmt.Errorf("distributionRelease.path %q must not contain '..' path segments", r.Path))
+				break
+			}
+		}
+	}
+	if r.URL != "" {
+		u, err := url.Parse(r.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+			errs = append(errs, fmt.Errorf("distributionRelease.url %q must be an http(s) URL with a host and no embedded credentials", r.URL))
+		}
+		if !strings.Contains(kubernetesVersion, "+") {
+			errs = append(errs, fmt.Errorf("distributionRelease.url requires kubernetesVersion with a distribution suffix, got %q", kubernetesVersion))
+		}
+	}
+	if r.SHA256 != "" && !sha256Pattern.MatchString(r.SHA256) {
+		errs = append(errs, fmt.Errorf("distributionRelease.sha256 %q must be 64 lowercase hex characters", r.SHA256))
+	}
+	switch r.OnMismatch {
+	case "", "Fail", "Warn":
+	default:
+		errs = append(errs, fmt.Errorf("distributionRelease.onMismatch %q must be one of \"Fail\", \"Warn\", or empty", r.OnMismatch))
+	}
+	return errors.Join(errs...)
+}
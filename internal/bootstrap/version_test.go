@@ -0,0 +1,273 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// versionGateCases is the k0s/k3s × CAPV/CAPK × control-plane/worker matrix
+// with the systemd unit each render must attach the version gate to.
+func versionGateCases() []struct {
+	name    string
+	distro  string
+	render  func(TemplateData) (string, error)
+	role    string
+	kv      bool
+	dropIn  string
+	version string
+} {
+	return []struct {
+		name    string
+		distro  string
+		render  func(TemplateData) (string, error)
+		role    string
+		kv      bool
+		dropIn  string
+		version string
+	}{
+		{"k0s_capv_cp", "k0s", RenderK0sCloudConfig, "control-plane", false, "/etc/systemd/system/k0scontroller.service.d/10-kairos-version-gate.conf", "v1.34.1+k0s.1"},
+		{"k0s_capv_worker", "k0s", RenderK0sCloudConfig, "worker", false, "/etc/systemd/system/k0sworker.service.d/10-kairos-version-gate.conf", "v1.34.1+k0s.1"},
+		{"k0s_capk_cp", "k0s", RenderK0sCloudConfig, "control-plane", true, "/etc/systemd/system/k0scontroller.service.d/10-kairos-version-gate.conf", "v1.34.1+k0s.1"},
+		{"k0s_capk_worker", "k0s", RenderK0sCloudConfig, "worker", true, "/etc/systemd/system/k0sworker.service.d/10-kairos-version-gate.conf", "v1.34.1+k0s.1"},
+		{"k3s_capv_cp", "k3s", RenderK3sCloudConfig, "control-plane", false, "/etc/systemd/system/k3s.service.d/10-kairos-version-gate.conf", "v1.33.5+k3s1"},
+		{"k3s_capv_worker", "k3s", RenderK3sCloudConfig, "worker", false, "/etc/systemd/system/k3s-agent.service.d/10-kairos-version-gate.conf", "v1.33.5+k3s1"},
+		{"k3s_capk_cp", "k3s", RenderK3sCloudConfig, "control-plane", true, "/etc/systemd/system/k3s.service.d/10-kairos-version-gate.conf", "v1.33.5+k3s1"},
+		{"k3s_capk_worker", "k3s", RenderK3sCloudConfig, "worker", true, "/etc/systemd/system/k3s-agent.service.d/10-kairos-version-gate.conf", "v1.33.5+k3s1"},
+	}
+}
+
+func versionGateData(role string, kubevirt bool, version string) TemplateData {
+	return TemplateData{
+		Role:              role,
+		SingleNode:        role == "control-plane",
+		Hostname:          "node-0",
+		UserName:          "kairos",
+		IsKubeVirt:        kubevirt,
+		KubernetesVersion: version,
+		DistributionRelease: &DistributionReleaseConfig{
+			URL:    "https://mirror.example.com/releases",
+			SHA256: strings.Repeat("ab", 32),
+		},
+	}
+}
+
+// TestVersionGate_RenderedOnEveryTemplate asserts every template renders the
+// env file, the gate script and the ExecStartPre drop-in on the unit that
+// actually runs the distribution for the node's role.
+func TestVersionGate_RenderedOnEveryTemplate(t *testing.T) {
+	for _, tc := range versionGateCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := tc.render(versionGateData(tc.role, tc.kv, tc.version))
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			parseRendered(t, out)
+
+			env := extractWriteFile(t, out, "/usr/local/etc/kairos-capi/distribution-release.env")
+			for _, want := range []string{
+				"DISTRIBUTION='" + tc.distro + "'",
+				"WANT_VERSION='" + tc.version + "'",
+				"SOURCE_TYPE='url'",
+				"SOURCE='https://mirror.example.com/releases'",
+				"ON_MISMATCH='Fail'",
+			} {
+				if !strings.Contains(env, want) {
+					t.Errorf("env file missing %q:\n%s", want, env)
+				}
+			}
+			if script := extractWriteFile(t, out, "/usr/local/bin/kairos-distribution-version-gate.sh"); script != distributionVersionGateScript {
+				t.Errorf("gate script did not round-trip through the YAML block scalar")
+			}
+			dropIn := extractWriteFile(t, out, tc.dropIn)
+			if !strings.Contains(dropIn, "ExecStartPre=/usr/local/bin/kairos-distribution-version-gate.sh") {
+				t.Errorf("drop-in %s missing or without ExecStartPre: %q", tc.dropIn, dropIn)
+			}
+		})
+	}
+}
+
+// TestVersionGate_AbsentWithoutKubernetesVersion keeps renders that predate
+// the field (and the goldens) byte-for-byte unchanged.
+func TestVersionGate_AbsentWithoutKubernetesVersion(t *testing.T) {
+	for _, tc := range versionGateCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			d := versionGateData(tc.role, tc.kv, "")
+			d.DistributionRelease = nil
+			out, err := tc.render(d)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if strings.Contains(out, "kairos-distribution-version-gate") || strings.Contains(out, "distribution-release.env") {
+				t.Error("version gate rendered without kubernetesVersion")
+			}
+		})
+	}
+}
+
+// TestVersionGate_ScriptsValidBash runs `bash -n` on the gate script and
+// sources the rendered env file to prove every value survives shquote.
+func TestVersionGate_ScriptsValidBash(t *testing.T) {
+	bashPath, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available; skipping rendered-script syntax check")
+	}
+	f := filepathJoinTemp(t, "version-gate.sh")
+	if err := os.WriteFile(f, []byte(distributionVersionGate()), 0o600); err != nil {
+		t.Fatalf("write temp script: %v", err)
+	}
+	if b, err := exec.Command(bashPath, "-n", f).CombinedOutput(); err != nil {
+		t.Fatalf("version gate script is not valid bash: %v\n%s", err, b)
+	}
+
+	// A path with quotes and shell metacharacters is legal (validation only
+	// rejects control characters and traversal); it must reach the script as
+	// data, never as code.
+	hostile := `/opt/k0s bin/it's $(reboot);`
+	d := versionGateData("worker", false, "v1.34.1")
+	d.DistributionRelease = &DistributionReleaseConfig{Path: hostile, OnMismatch: "Warn"}
+	out, err := RenderK0sCloudConfig(d)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	env := extractWriteFile(t, out, "distribution-release.env")
+	envFile := filepathJoinTemp(t, "distribution-release.env")
+	if err := os.WriteFile(envFile, []byte(env), 0o600); err != nil {
+		t.Fatalf("write temp env: %v", err)
+	}
+	got, err := exec.Command(bashPath, "-c", `. "$1"; printf '%s|%s|%s|%s' "$DISTRIBUTION" "$WANT_VERSION" "$SOURCE" "$ON_MISMATCH"`, "_", envFile).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sourcing env file failed: %v\n%s", err, got)
+	}
+	if want := "k0s|v1.34.1|" + hostile + "|Warn"; string(got) != want {
+		t.Errorf("env file did not round-trip:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+// TestVersionGate_ValidationRejects re-asserts the webhook rules at render time.
+func TestVersionGate_ValidationRejects(t *testing.T) {
+	cases := []struct {
+		name    string
+		mutate  func(d *TemplateData)
+		wantErr string
+	}{
+		{"version injection", func(d *TemplateData) { d.KubernetesVersion = "v1.34.1';reboot;'" }, "kubernetesVersion"},
+		{"version newline", func(d *TemplateData) { d.KubernetesVersion = "v1.34.1\nSOURCE=x" }, "kubernetesVersion"},
+		{"two sources", func(d *TemplateData) { d.DistributionRelease.Path = "/opt/k0s" }, "at most one"},
+		{"relative path", func(d *TemplateData) {
+			d.DistributionRelease = &DistributionReleaseConfig{Path: "opt/k0s"}
+		}, "distributionRelease.path"},
+		{"path traversal", func(d *TemplateData) {
+			d.DistributionRelease = &DistributionReleaseConfig{Path: "/opt/../etc/shadow"}
+		}, "distributionRelease.path"},
+		{"path newline", func(d *TemplateData) {
+			d.DistributionRelease = &DistributionReleaseConfig{Path: "/opt/k0s\nSOURCE_TYPE=image"}
+		}, "control character"},
+		{"file url", func(d *TemplateData) { d.DistributionRelease.URL = "file:///etc/shadow" }, "distributionRelease.url"},
+		{"url without distribution suffix", func(d *TemplateData) { d.KubernetesVersion = "v1.34.1" }, "distributionRelease.url"},
+		{"image metacharacters", func(d *TemplateData) {
+			d.DistributionRelease = &DistributionReleaseConfig{Image: "quay.io/k0s:`reboot`"}
+		}, "distributionRelease.image"},
+		{"bad sha256", func(d *TemplateData) { d.DistributionRelease.SHA256 = "xyz" }, "distributionRelease.sha256"},
+		{"bad onMismatch", func(d *TemplateData) { d.DistributionRelease.OnMismatch = "Ignore" }, "distributionRelease.onMismatch"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := versionGateData("worker", false, "v1.34.1+k0s.1")
+			tc.mutate(&d)
+			_, err := RenderK0sCloudConfig(d)
+			if err == nil {
+				t.Fatalf("render accepted invalid input; want error containing %q", tc.wantErr)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("error %q does not contain %q", err.Error(), tc.wantErr)
+			}
+		})
+	}
+}
+
+// TestVersionGate_AcceptsInPlaceUpgradeRelease runs the gate on a node whose
+// cloud-config still pins the provisioning-time release: after an in-place
+// upgrade the image's binary matches InPlaceUpgradeVersionFile instead, and
+// the gate must let the distribution start. Paths are redirected into a temp
+// directory and the distribution binary is a stub on PATH.
+func TestVersionGate_AcceptsInPlaceUpgradeRelease(t *testing.T) {
+	bashPath, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available; skipping version gate run")
+	}
+	cases := []struct {
+		name          string
+		binaryVersion string
+		upgradeFile   string
+		wantExit      bool
+		wantWant      string
+	}{
+		{"upgraded node", "v1.35.0+k0s.0", "v1.35.0+k0s.0\n", true, "v1.35.0+k0s.0"},
+		{"upgrade never applied", "v1.34.1+k0s.1", "v1.35.0+k0s.0\n", true, "v1.34.1+k0s.1"},
+		{"upgraded node without the record", "v1.35.0+k0s.0", "", false, "v1.34.1+k0s.1"},
+		{"malformed record ignored", "v1.35.0+k0s.0", "$(reboot)\n", false, "v1.34.1+k0s.1"},
+		{"unrelated release", "v1.36.0+k0s.0", "v1.35.0+k0s.0\n", false, "v1.34.1+k0s.1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			script := distributionVersionGate()
+			for from, to := range map[string]string{
+				"/usr/local/etc/kairos-capi/distribution-release.env": dir + "/distribution-release.env",
+				InPlaceUpgradeVersionFile:                             dir + "/in-place-upgrade-version",
+				"/run/cluster-api/kubernetes-version":                 dir + "/kubernetes-version",
+				"/usr/local/lib/kairos-capi":                          dir + "/stage",
+			} {
+				script = strings.ReplaceAll(script, from, to)
+			}
+			write := func(name, content string, mode os.FileMode) {
+				if err := os.WriteFile(dir+"/"+name, []byte(content), mode); err != nil {
+					t.Fatalf("write %s: %v", name, err)
+				}
+			}
+			write("gate.sh", script, 0o700)
+			d := versionGateData("control-plane", false, "v1.34.1+k0s.1")
+			d.DistributionRelease = nil
+			write("distribution-release.env", distributionReleaseEnv("k0s", d), 0o600)
+			if tc.upgradeFile != "" {
+				write("in-place-upgrade-version", tc.upgradeFile, 0o600)
+			}
+			if err := os.Mkdir(dir+"/bin", 0o700); err != nil {
+				t.Fatalf("mkdir: %v", err)
+			}
+			write("bin/k0s", "#!/bin/sh\necho "+tc.binaryVersion+"\n", 0o700)
+
+			cmd := exec.Command(bashPath, dir+"/gate.sh")
+			cmd.Env = append(os.Environ(), "PATH="+dir+"/bin:"+os.Getenv("PATH"))
+			out, err := cmd.CombinedOutput()
+			if tc.wantExit != (err == nil) {
+				t.Fatalf("gate exit error = %v, want success %v\n%s", err, tc.wantExit, out)
+			}
+			status, err := os.ReadFile(dir + "/kubernetes-version")
+			if err != nil {
+				t.Fatalf("gate wrote no status: %v\n%s", err, out)
+			}
+			if !strings.Contains(string(status), "want="+tc.wantWant+"\n") {
+				t.Errorf("status %q does not record want=%s", status, tc.wantWant)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+)
+
+// airgapImagesReport is the record the airgap preload script PATCHes under the
+// node's KairosConfig name into the airgap-status Secret. The controller only
+// reads it.
+type airgapImagesReport struct {
+	// Result is "ready" or "missing".
+	Result string `json:"result"`
+	// Bundle is the index of the failing spec.airgapImages entry, or "-".
+	Bundle     string `json:"bundle"`
+	Message    string `json:"message"`
+	ReportedAt string `json:"reportedAt"`
+}
+
+// reportsAirgapImages reports whether the node behind kairosConfig pushes its
+// airgap preload result: it needs spec.airgapImages and the node-push channel,
+// which only control-plane nodes on push-capable infrastructure get. Other
+// nodes keep the result in /run/cluster-api/airgap-images.
+func (r *KairosConfigReconciler) reportsAirgapImages(kairosConfig *bootstrapv1beta2.KairosConfig, machine *clusterv1.Machine) bool {
+	if len(kairosConfig.Spec.AirgapImages) == 0 || r.MgmtEndpointResolver == nil || !supportsManagementEndpoint(machine) {
+		return false
+	}
+	role := kairosConfig.Spec.Role
+	if role == "" && util.IsControlPlaneMachine(machine) {
+		role = "control-plane"
+	}
+	return role == "control-plane"
+}
+
+// ensureAirgapStatusSecret pre-creates the empty, Cluster-owned airgap-status
+// Secret the control-plane nodes PATCH their preload result into. Like the
+// etcd-status Secret, the node-authored keys are never touched here.
+func (r *KairosConfigReconciler) ensureAirgapStatusSecret(ctx context.Context, cluster *clusterv1.Cluster) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      bootstrapv1beta2.AirgapStatusSecretName(cluster.Name),
+			Namespace: cluster.Namespace,
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		if secret.Labels == nil {
+			secret.Labels = map[string]string{}
+		}
+		secret.Labels[clusterv1.ClusterNameLabel] = cluster.Name
+		secret.Labels[bootstrapv1beta2.SecretTypeLabel] = bootstrapv1beta2.AirgapStatusSecretTypeValue
+		return controllerutil.SetControllerReference(cluster, secret, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("ensure airgap-status secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return nil
+}
+
+// setAirgapImagesReady records the node's airgap preload result on
+// AirgapImagesReadyCondition. The condition is informational and never gates
+// bootstrap readiness: the bootstrap data is fine, the node just cannot start
+// its distribution until the bundle is reachable. It is removed for nodes that
+// do not report.
+func (r *KairosConfigReconciler) setAirgapImagesReady(ctx context.Context, kairosConfig *bootstrapv1beta2.KairosConfig, machine *clusterv1.Machine, cluster *clusterv1.Cluster) error {
+	if !r.reportsAirgapImages(kairosConfig, machine) {
+		conditions.Delete(kairosConfig, bootstrapv1beta2.AirgapImagesReadyCondition)
+		return nil
+	}
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: bootstrapv1beta2.AirgapStatusSecretName(cluster.Name), Namespace: cluster.Namespace}
+	if err := r.Get(ctx, key, secret); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("read airgap-status secret %s/%s: %w", key.Namespace, key.Name, err)
+	}
+	var report airgapImagesReport
+	raw, ok := secret.Data[kairosConfig.Name]
+	if !ok || json.Unmarshal(raw, &report) != nil || (report.Result != "ready" && report.Result != "missing") {
+		conditions.MarkFalse(kairosConfig, bootstrapv1beta2.AirgapImagesReadyCondition,
+			bootstrapv1beta2.WaitingForAirgapImagesReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for the node to report its airgap image preload")
+		return nil
+	}
+	if report.Result == "ready" {
+		conditions.MarkTrue(kairosConfig, bootstrapv1beta2.AirgapImagesReadyCondition)
+		return nil
+	}
+	conditions.MarkFalse(kairosConfig, bootstrapv1beta2.AirgapImagesReadyCondition,
+		bootstrapv1beta2.AirgapImagesMissingReason, clusterv1.ConditionSeverityError,
+		"spec.airgapImages[%s]: %s (reported %s)", report.Bundle, report.Message, report.ReportedAt)
+	return nil
+}
+
+// removeAirgapStatusReport drops a deleted KairosConfig's key from the
+// airgap-status Secret so reports of rolled-out Machines do not pile up. A
+// missing Secret or key is not an error.
+func (r *KairosConfigReconciler) removeAirgapStatusReport(ctx context.Context, kairosConfig *bootstrapv1beta2.KairosConfig) error {
+	clusterName := kairosConfig.Labels[clusterv1.ClusterNameLabel]
+	if len(kairosConfig.Spec.AirgapImages) == 0 || clusterName == "" {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: bootstrapv1beta2.AirgapStatusSecretName(clusterName), Namespace: kairosConfig.Namespace}
+	if err := r.Get(ctx, key, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if _, ok := secret.Data[kairosConfig.Name]; !ok {
+		return nil
+	}
+	base := secret.DeepCopy()
+	delete(secret.Data, kairosConfig.Name)
+	return client.IgnoreNotFound(r.Patch(ctx, secret, client.MergeFrom(base)))
+}
+
+// airgapStatusSecretToKairosConfig maps the airgap-status Secret to the
+// KairosConfigs that reported into it: every data key is a KairosConfig name
+// in the Secret's namespace.
+func (r *KairosConfigReconciler) airgapStatusSecretToKairosConfig(_ context.Context, o client.Object) []reconcile.Request {
+	secret, ok := o.(*corev1.Secret)
+	if !ok || secret.Labels[bootstrapv1beta2.SecretTypeLabel] != bootstrapv1beta2.AirgapStatusSecretTypeValue {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(secret.Data))
+	for name := range secret.Data {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: name, Namespace: secret.Namespace},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+)
+
+// airgapFixture is a k3s control-plane KairosConfig with one airgap bundle on
+// a CAPV Machine, so the node-push channel is rendered.
+func airgapFixture(t *testing.T, objs ...*corev1.Secret) (*KairosConfigReconciler, ctrl.Request) {
+	scheme := newBootstrapTestScheme(t)
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec:       clusterv1.ClusterSpec{ControlPlaneEndpoint: clusterv1.APIEndpoint{Host: "10.0.0.42", Port: 6443}},
+	}
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cp-0",
+			Namespace: "default",
+			Labels: map[string]string{
+				clusterv1.ClusterNameLabel:         "test-cluster",
+				clusterv1.MachineControlPlaneLabel: "",
+			},
+		},
+		Spec: clusterv1.MachineSpec{
+			ClusterName:       "test-cluster",
+			ProviderID:        ptr.To("vsphere://cp-0"),
+			InfrastructureRef: corev1.ObjectReference{Kind: "VSphereMachine", Name: "cp-0", Namespace: "default"},
+		},
+	}
+	kairosConfig := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cp-0",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(machine, clusterv1.GroupVersion.WithKind("Machine")),
+			},
+		},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "control-plane",
+			Distribution:      "k3s",
+			KubernetesVersion: "v1.30.0+k3s.0",
+			SingleNode:        true,
+			UserName:          "kairos",
+			UserPassword:      "kairos",
+			UserGroups:        []string{"admin"},
+			AirgapImages:      []bootstrapv1beta2.AirgapImageBundle{{URL: "https://mirror.example.com/k3s-airgap-images.tar"}},
+		},
+	}
+	builder := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(cluster, machine, kairosConfig).
+		WithStatusSubresource(&bootstrapv1beta2.KairosConfig{})
+	for _, o := range objs {
+		builder = builder.WithObjects(o)
+	}
+	r := &KairosConfigReconciler{
+		Client: builder.Build(),
+		Scheme: scheme,
+		MgmtEndpointResolver: &stubResolver{endpoint: &ManagementEndpoint{
+			APIServer:                 "https://mgmt.example.com:6443",
+			Token:                     "test-token",
+			KubeconfigSecretName:      "test-cluster-kubeconfig",
+			KubeconfigSecretNamespace: "default",
+			CABundle:                  testResolverCA,
+		}},
+	}
+	return r, ctrl.Request{NamespacedName: types.NamespacedName{Name: "cp-0", Namespace: "default"}}
+}
+
+func airgapStatusSecret(report string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      bootstrapv1beta2.AirgapStatusSecretName("test-cluster"),
+			Namespace: "default",
+			Labels:    map[string]string{bootstrapv1beta2.SecretTypeLabel: bootstrapv1beta2.AirgapStatusSecretTypeValue},
+		},
+		Data: map[string][]byte{"cp-0": []byte(report)},
+	}
+}
+
+// TestReconcile_AirgapImagesReport: the control-plane render points the preload
+// at the pre-created airgap-status Secret, and the node's report drives
+// AirgapImagesReady without touching Ready.
+func TestReconcile_AirgapImagesReport(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	r, req := airgapFixture(t)
+
+	_, err := r.Reconcile(ctx, req)
+	g.Expect(err).NotTo(HaveOccurred())
+	got := &bootstrapv1beta2.KairosConfig{}
+	g.Expect(r.Get(ctx, req.NamespacedName, got)).To(Succeed())
+	g.Expect(conditions.IsTrue(got, clusterv1.ReadyCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(got, bootstrapv1beta2.AirgapImagesReadyCondition)).To(Equal(bootstrapv1beta2.WaitingForAirgapImagesReason))
+
+	status := &corev1.Secret{}
+	g.Expect(r.Get(ctx, types.NamespacedName{Name: "test-cluster-airgap-status", Namespace: "default"}, status)).To(Succeed())
+	g.Expect(status.Labels).To(HaveKeyWithValue(bootstrapv1beta2.SecretTypeLabel, bootstrapv1beta2.AirgapStatusSecretTypeValue))
+	g.Expect(metav1.GetControllerOf(status).Kind).To(Equal("Cluster"))
+	data := &corev1.Secret{}
+	g.Expect(r.Get(ctx, types.NamespacedName{Name: *got.Status.DataSecretName, Namespace: "default"}, data)).To(Succeed())
+	g.Expect(string(data.Data["value"])).To(And(
+		ContainSubstring("STATUS_SECRET='test-cluster-airgap-status'"),
+		ContainSubstring("STATUS_KEY='cp-0'"),
+	))
+
+	status.Data = map[string][]byte{"cp-0": []byte(`{"result":"missing","bundle":"0","message":"could not download https://mirror.example.com/k3s-airgap-images.tar","reportedAt":"2026-10-18T10:00:00Z"}`)}
+	g.Expect(r.Update(ctx, status)).To(Succeed())
+	_, err = r.Reconcile(ctx, req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(r.Get(ctx, req.NamespacedName, got)).To(Succeed())
+	cond := conditions.Get(got, bootstrapv1beta2.AirgapImagesReadyCondition)
+	g.Expect(cond.Status).To(Equal(corev1.ConditionFalse))
+	g.Expect(cond.Reason).To(Equal(bootstrapv1beta2.AirgapImagesMissingReason))
+	g.Expect(cond.Severity).To(Equal(clusterv1.ConditionSeverityError))
+	g.Expect(cond.Message).To(ContainSubstring("spec.airgapImages[0]: could not download"))
+	g.Expect(conditions.IsTrue(got, clusterv1.ReadyCondition)).To(BeTrue())
+
+	status.Data = map[string][]byte{"cp-0": []byte(`{"result":"ready","bundle":"-","message":"1 bundle(s) ready","reportedAt":"2026-10-18T10:05:00Z"}`)}
+	g.Expect(r.Update(ctx, status)).To(Succeed())
+	_, err = r.Reconcile(ctx, req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(r.Get(ctx, req.NamespacedName, got)).To(Succeed())
+	g.Expect(conditions.IsTrue(got, bootstrapv1beta2.AirgapImagesReadyCondition)).To(BeTrue())
+}
+
+// TestSetAirgapImagesReady_NotReported: nodes without the node-push channel
+// (workers, or no resolver) and configs without airgapImages carry no
+// condition.
+func TestSetAirgapImagesReady_NotReported(t *testing.T) {
+	ctx := context.Background()
+	for name, mutate := range map[string]func(r *KairosConfigReconciler, kc *bootstrapv1beta2.KairosConfig){
+		"no airgapImages": func(_ *KairosConfigReconciler, kc *bootstrapv1beta2.KairosConfig) { kc.Spec.AirgapImages = nil },
+		"worker":          func(_ *KairosConfigReconciler, kc *bootstrapv1beta2.KairosConfig) { kc.Spec.Role = "worker" },
+		"no resolver":     func(r *KairosConfigReconciler, _ *bootstrapv1beta2.KairosConfig) { r.MgmtEndpointResolver = nil },
+	} {
+		t.Run(name, func(t *testing.T) {
+			g := NewWithT(t)
+			r, req := airgapFixture(t, airgapStatusSecret(`{"result":"ready"}`))
+			kc := &bootstrapv1beta2.KairosConfig{}
+			g.Expect(r.Get(ctx, req.NamespacedName, kc)).To(Succeed())
+			conditions.MarkTrue(kc, bootstrapv1beta2.AirgapImagesReadyCondition)
+			mutate(r, kc)
+			machine := &clusterv1.Machine{}
+			g.Expect(r.Get(ctx, types.NamespacedName{Name: "cp-0", Namespace: "default"}, machine)).To(Succeed())
+			if kc.Spec.Role == "worker" {
+				delete(machine.Labels, clusterv1.MachineControlPlaneLabel)
+			}
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+
+			g.Expect(r.setAirgapImagesReady(ctx, kc, machine, cluster)).To(Succeed())
+			g.Expect(conditions.Has(kc, bootstrapv1beta2.AirgapImagesReadyCondition)).To(BeFalse())
+		})
+	}
+}
+
+// TestRemoveAirgapStatusReport: deleting a KairosConfig drops only its own
+// report.
+func TestRemoveAirgapStatusReport(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	status := airgapStatusSecret(`{"result":"ready"}`)
+	status.Data["cp-1"] = []byte(`{"result":"ready"}`)
+	r, req := airgapFixture(t, status)
+	kc := &bootstrapv1beta2.KairosConfig{}
+	g.Expect(r.Get(ctx, req.NamespacedName, kc)).To(Succeed())
+	kc.Labels = map[string]string{clusterv1.ClusterNameLabel: "test-cluster"}
+
+	g.Expect(r.removeAirgapStatusReport(ctx, kc)).To(Succeed())
+	g.Expect(r.Get(ctx, types.NamespacedName{Name: status.Name, Namespace: "default"}, status)).To(Succeed())
+	g.Expect(status.Data).To(HaveLen(1))
+	g.Expect(status.Data).To(HaveKey("cp-1"))
+}
+
+func TestAirgapStatusSecretToKairosConfig(t *testing.T) {
+	g := NewWithT(t)
+	r := &KairosConfigReconciler{}
+	reqs := r.airgapStatusSecretToKairosConfig(context.Background(), airgapStatusSecret(`{}`))
+	g.Expect(reqs).To(ConsistOf(ctrl.Request{NamespacedName: types.NamespacedName{Name: "cp-0", Namespace: "default"}}))
+
+	unlabeled := airgapStatusSecret(`{}`)
+	unlabeled.Labels = nil
+	g.Expect(r.airgapStatusSecretToKairosConfig(context.Background(), unlabeled)).To(BeEmpty())
+}
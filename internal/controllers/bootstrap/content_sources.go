@@ -0,0 +1,219 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+)
+
+// errContentSourceNotReady signals that a Secret or ConfigMap referenced by a
+// file or manifest contentFrom does not exist yet, for example a certificate
+// Secret cert-manager has not issued. reconcileBootstrapData maps it to a
+// timed requeue, like errTokenNotReady; the content source watches usually
+// wake the KairosConfig sooner.
+var errContentSourceNotReady = errors.New("contentFrom source not ready")
+
+// contentSourceHashAnnotation is stamped on the bootstrap data Secret of a
+// KairosConfig whose files or manifests use contentFrom. Its value is the
+// hash of the resolved content; reconcileBootstrapData renders again when the
+// referenced data no longer matches it.
+const contentSourceHashAnnotation = "bootstrap.cluster.x-k8s.io/kairos-content-hash"
+
+// resolvedContent is spec.files and spec.manifests with every contentFrom
+// replaced by the referenced data.
+type resolvedContent struct {
+	Files     []bootstrapv1beta2.File
+	Manifests []bootstrapv1beta2.Manifest
+	// Hash covers the resolved contentFrom data, in spec order. Empty when
+	// nothing uses contentFrom.
+	Hash string
+}
+
+// resolveContentSources reads every file and manifest contentFrom from the
+// KairosConfig's namespace, the way tokenFromWorkerRef reads token Secrets.
+// The spec slices are copied, never modified. A missing Secret or ConfigMap
+// returns errContentSourceNotReady; a missing key is a hard error. The
+// resolved content is never logged.
+func (r *KairosConfigReconciler) resolveContentSources(ctx context.Context, kc *bootstrapv1beta2.KairosConfig) (*resolvedContent, error) {
+	out := &resolvedContent{}
+	h := sha256.New()
+	referenced := false
+	for i, f := range kc.Spec.Files {
+		if f.ContentFrom != nil {
+			content, err := r.contentFromSource(ctx, kc.Namespace, f.ContentFrom, fmt.Sprintf("spec.files[%d]", i))
+			if err != nil {
+				return nil, err
+			}
+			f.Content, f.ContentFrom = content, nil
+			fmt.Fprintf(h, "files[%d]:%d:%s", i, len(content), content)
+			referenced = true
+		}
+		out.Files = append(out.Files, f)
+	}
+	for i, m := range kc.Spec.Manifests {
+		if m.ContentFrom != nil {
+			content, err := r.contentFromSource(ctx, kc.Namespace, m.ContentFrom, fmt.Sprintf("spec.manifests[%d]", i))
+			if err != nil {
+				return nil, err
+			}
+			m.Content, m.ContentFrom = content, nil
+			fmt.Fprintf(h, "manifests[%d]:%d:%s", i, len(content), content)
+			referenced = true
+		}
+		out.Manifests = append(out.Manifests, m)
+	}
+	if referenced {
+		out.Hash = hex.EncodeToString(h.Sum(nil))
+	}
+	return out, nil
+}
+
+// contentFromSource returns the value of the Secret or ConfigMap key src
+// selects. ConfigMap keys are looked up in data, then binaryData. label names
+// the spec entry in errors.
+func (r *KairosConfigReconciler) contentFromSource(ctx context.Context, namespace string, src *bootstrapv1beta2.ContentSource, label string) (string, error) {
+	switch {
+	case src.Secret != nil:
+		key := types.NamespacedName{Namespace: namespace, Name: src.Secret.Name}
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, key, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "", fmt.Errorf("%s: secret %s/%s: %w", label, key.Namespace, key.Name, errContentSourceNotReady)
+			}
+			return "", fmt.Errorf("failed to get %s content secret %s/%s: %w", label, key.Namespace, key.Name, err)
+		}
+		data, ok := secret.Data[src.Secret.Key]
+		if !ok {
+			return "", fmt.Errorf("%s content secret %s/%s does not contain key '%s'", label, key.Namespace, key.Name, src.Secret.Key)
+		}
+		return string(data), nil
+	case src.ConfigMap != nil:
+		key := types.NamespacedName{Namespace: namespace, Name: src.ConfigMap.Name}
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, key, cm); err != nil {
+			if apierrors.IsNotFound(err) {
+				return "", fmt.Errorf("%s: configmap %s/%s: %w", label, key.Namespace, key.Name, errContentSourceNotReady)
+			}
+			return "", fmt.Errorf("failed to get %s content configmap %s/%s: %w", label, key.Namespace, key.Name, err)
+		}
+		if data, ok := cm.Data[src.ConfigMap.Key]; ok {
+			return data, nil
+		}
+		if data, ok := cm.BinaryData[src.ConfigMap.Key]; ok {
+			return string(data), nil
+		}
+		return "", fmt.Errorf("%s content configmap %s/%s does not contain key '%s'", label, key.Namespace, key.Name, src.ConfigMap.Key)
+	default:
+		return "", fmt.Errorf("%s: contentFrom sets neither secret nor configMap", label)
+	}
+}
+
+// contentSourcesChanged reports whether the content the KairosConfig's
+// contentFrom references differs from what the existing bootstrap Secret was
+// rendered with. A source that cannot be read now does not count as a change:
+// the rendered data stays until it can be rendered again.
+func (r *KairosConfigReconciler) contentSourcesChanged(ctx context.Context, kc *bootstrapv1beta2.KairosConfig, secret *corev1.Secret) bool {
+	if !usesContentFrom(kc) && secret.Annotations[contentSourceHashAnnotation] == "" {
+		return false
+	}
+	resolved, err := r.resolveContentSources(ctx, kc)
+	if err != nil {
+		return false
+	}
+	return resolved.Hash != secret.Annotations[contentSourceHashAnnotation]
+}
+
+// usesContentFrom reports whether any file or manifest of kc uses contentFrom.
+func usesContentFrom(kc *bootstrapv1beta2.KairosConfig) bool {
+	for _, f := range kc.Spec.Files {
+		if f.ContentFrom != nil {
+			return true
+		}
+	}
+	for _, m := range kc.Spec.Manifests {
+		if m.ContentFrom != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// referencesContentSource reports whether kc reads file or manifest content
+// from the named Secret (secret true) or ConfigMap.
+func referencesContentSource(kc *bootstrapv1beta2.KairosConfig, name string, secret bool) bool {
+	matches := func(src *bootstrapv1beta2.ContentSource) bool {
+		if src == nil {
+			return false
+		}
+		if secret {
+			return src.Secret != nil && src.Secret.Name == name
+		}
+		return src.ConfigMap != nil && src.ConfigMap.Name == name
+	}
+	for _, f := range kc.Spec.Files {
+		if matches(f.ContentFrom) {
+			return true
+		}
+	}
+	for _, m := range kc.Spec.Manifests {
+		if matches(m.ContentFrom) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentSourceToKairosConfig maps a Secret or ConfigMap to the KairosConfigs
+// in its namespace whose files or manifests read from it, so a source that
+// appears or changes is picked up without waiting for the requeue.
+func (r *KairosConfigReconciler) contentSourceToKairosConfig(ctx context.Context, o client.Object) []reconcile.Request {
+	var secret bool
+	switch o.(type) {
+	case *corev1.Secret:
+		secret = true
+	case *corev1.ConfigMap:
+	default:
+		return nil
+	}
+	kcList := &bootstrapv1beta2.KairosConfigList{}
+	if err := r.List(ctx, kcList, client.InNamespace(o.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range kcList.Items {
+		kc := &kcList.Items[i]
+		if !referencesContentSource(kc, o.GetName(), secret) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: kc.Name, Namespace: kc.Namespace},
+		})
+	}
+	return requests
+}
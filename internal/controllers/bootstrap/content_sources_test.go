@@ -0,0 +1,199 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+)
+
+func secretSource(name, key string) *bootstrapv1beta2.ContentSource {
+	return &bootstrapv1beta2.ContentSource{Secret: &bootstrapv1beta2.ContentSourceKeySelector{Name: name, Key: key}}
+}
+
+func configMapSource(name, key string) *bootstrapv1beta2.ContentSource {
+	return &bootstrapv1beta2.ContentSource{ConfigMap: &bootstrapv1beta2.ContentSourceKeySelector{Name: name, Key: key}}
+}
+
+func contentConfig(files []bootstrapv1beta2.File, manifests []bootstrapv1beta2.Manifest) *bootstrapv1beta2.KairosConfig {
+	return &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "kc", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "control-plane",
+			Distribution:      "k0s",
+			KubernetesVersion: "v1.30.0+k0s.0",
+			UserName:          "kairos",
+			UserPassword:      "kairos",
+			UserGroups:        []string{"admin"},
+			Files:             files,
+			Manifests:         manifests,
+		},
+	}
+}
+
+// TestResolveContentSources asserts every contentFrom is replaced by the
+// referenced Secret or ConfigMap value, inline content is kept, and the spec
+// is left untouched.
+func TestResolveContentSources(t *testing.T) {
+	g := NewWithT(t)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-config", Namespace: "default"},
+		Data:       map[string]string{"ns.yaml": "kind: Namespace"},
+		BinaryData: map[string][]byte{"blob": []byte("binary")},
+	}
+	r := tokenReconciler(g, tokenSecret("app-tls", "default", "tls.crt", "CERT"), cm)
+	kc := contentConfig(
+		[]bootstrapv1beta2.File{
+			{Path: "/etc/app/tls.crt", ContentFrom: secretSource("app-tls", "tls.crt")},
+			{Path: "/etc/app/inline", Content: "inline"},
+			{Path: "/etc/app/blob", ContentFrom: configMapSource("app-config", "blob")},
+		},
+		[]bootstrapv1beta2.Manifest{{Name: "apps", File: "ns.yaml", ContentFrom: configMapSource("app-config", "ns.yaml")}},
+	)
+
+	resolved, err := r.resolveContentSources(context.Background(), kc)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resolved.Files).To(HaveLen(3))
+	g.Expect(resolved.Files[0].Content).To(Equal("CERT"))
+	g.Expect(resolved.Files[0].ContentFrom).To(BeNil())
+	g.Expect(resolved.Files[1].Content).To(Equal("inline"))
+	g.Expect(resolved.Files[2].Content).To(Equal("binary"))
+	g.Expect(resolved.Manifests[0].Content).To(Equal("kind: Namespace"))
+	g.Expect(resolved.Hash).NotTo(BeEmpty())
+	g.Expect(kc.Spec.Files[0].ContentFrom).NotTo(BeNil())
+	g.Expect(kc.Spec.Files[0].Content).To(BeEmpty())
+
+	inline := contentConfig([]bootstrapv1beta2.File{{Path: "/etc/app/inline", Content: "inline"}}, nil)
+	resolved, err = r.resolveContentSources(context.Background(), inline)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resolved.Hash).To(BeEmpty())
+}
+
+// TestResolveContentSources_Errors: a missing object is not ready yet, a
+// missing key is a hard error.
+func TestResolveContentSources_Errors(t *testing.T) {
+	g := NewWithT(t)
+	r := tokenReconciler(g, tokenSecret("app-tls", "default", "tls.crt", "CERT"))
+
+	_, err := r.resolveContentSources(context.Background(), contentConfig(
+		[]bootstrapv1beta2.File{{Path: "/etc/app/tls.crt", ContentFrom: secretSource("absent", "tls.crt")}}, nil))
+	g.Expect(err).To(MatchError(errContentSourceNotReady))
+
+	_, err = r.resolveContentSources(context.Background(), contentConfig(nil,
+		[]bootstrapv1beta2.Manifest{{Name: "apps", File: "ns.yaml", ContentFrom: configMapSource("absent", "ns.yaml")}}))
+	g.Expect(err).To(MatchError(errContentSourceNotReady))
+
+	_, err = r.resolveContentSources(context.Background(), contentConfig(
+		[]bootstrapv1beta2.File{{Path: "/etc/app/tls.key", ContentFrom: secretSource("app-tls", "tls.key")}}, nil))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err).NotTo(MatchError(errContentSourceNotReady))
+	g.Expect(err.Error()).To(ContainSubstring("does not contain key 'tls.key'"))
+}
+
+// TestContentSourcesChanged asserts the bootstrap Secret is re-rendered once
+// the referenced data no longer matches the stamped hash, and not while the
+// source is missing.
+func TestContentSourcesChanged(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	src := tokenSecret("app-tls", "default", "tls.crt", "CERT")
+	r := tokenReconciler(g, src)
+	kc := contentConfig([]bootstrapv1beta2.File{{Path: "/etc/app/tls.crt", ContentFrom: secretSource("app-tls", "tls.crt")}}, nil)
+
+	resolved, err := r.resolveContentSources(ctx, kc)
+	g.Expect(err).NotTo(HaveOccurred())
+	bootstrapSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{contentSourceHashAnnotation: resolved.Hash},
+	}}
+	g.Expect(r.contentSourcesChanged(ctx, kc, bootstrapSecret)).To(BeFalse())
+
+	src.Data["tls.crt"] = []byte("RENEWED")
+	g.Expect(r.Update(ctx, src)).To(Succeed())
+	g.Expect(r.contentSourcesChanged(ctx, kc, bootstrapSecret)).To(BeTrue())
+
+	g.Expect(r.Delete(ctx, src)).To(Succeed())
+	g.Expect(r.contentSourcesChanged(ctx, kc, bootstrapSecret)).To(BeFalse())
+
+	// Dropping contentFrom from the spec re-renders once to clear the hash.
+	g.Expect(r.contentSourcesChanged(ctx, contentConfig(nil, nil), bootstrapSecret)).To(BeTrue())
+	g.Expect(r.contentSourcesChanged(ctx, contentConfig(nil, nil), &corev1.Secret{})).To(BeFalse())
+}
+
+func TestContentSourceToKairosConfig(t *testing.T) {
+	g := NewWithT(t)
+	fromSecret := contentConfig([]bootstrapv1beta2.File{{Path: "/etc/a", ContentFrom: secretSource("shared", "a")}}, nil)
+	fromConfigMap := contentConfig(nil, []bootstrapv1beta2.Manifest{{Name: "apps", File: "a.yaml", ContentFrom: configMapSource("shared", "a")}})
+	fromConfigMap.Name = "kc-cm"
+	other := contentConfig([]bootstrapv1beta2.File{{Path: "/etc/a", Content: "inline"}}, nil)
+	other.Name = "kc-inline"
+	otherNamespace := contentConfig([]bootstrapv1beta2.File{{Path: "/etc/a", ContentFrom: secretSource("shared", "a")}}, nil)
+	otherNamespace.Namespace = "other"
+	r := tokenReconciler(g, fromSecret, fromConfigMap, other, otherNamespace)
+
+	meta := metav1.ObjectMeta{Name: "shared", Namespace: "default"}
+	g.Expect(r.contentSourceToKairosConfig(context.Background(), &corev1.Secret{ObjectMeta: meta})).To(ConsistOf(
+		reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "kc"}}))
+	g.Expect(r.contentSourceToKairosConfig(context.Background(), &corev1.ConfigMap{ObjectMeta: meta})).To(ConsistOf(
+		reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "kc-cm"}}))
+	meta.Name = "unrelated"
+	g.Expect(r.contentSourceToKairosConfig(context.Background(), &corev1.Secret{ObjectMeta: meta})).To(BeEmpty())
+}
+
+// TestGenerateCloudConfig_ContentFrom asserts resolved content reaches the
+// rendered cloud-config, and the Metal3 config-drive budget counts it.
+func TestGenerateCloudConfig_ContentFrom(t *testing.T) {
+	g := NewWithT(t)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-manifests", Namespace: "default"},
+		Data:       map[string]string{"ns.yaml": "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: from-configmap"},
+	}
+	large := tokenSecret("large", "default", "blob", strings.Repeat("x", 30*1024))
+	r := tokenReconciler(g, tokenSecret("app-tls", "default", "tls.crt", "FROM-SECRET"), cm, large)
+	kc := contentConfig(
+		[]bootstrapv1beta2.File{{Path: "/etc/app/tls.crt", ContentFrom: secretSource("app-tls", "tls.crt")}},
+		[]bootstrapv1beta2.Manifest{{Name: "apps", File: "ns.yaml", ContentFrom: configMapSource("app-manifests", "ns.yaml")}},
+	)
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+
+	cloudConfig, err := r.generateK0sCloudConfig(context.Background(), log.Log, kc, machine, cluster, "control-plane", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("FROM-SECRET"))
+	g.Expect(cloudConfig).To(ContainSubstring("name: from-configmap"))
+	g.Expect(cloudConfig).NotTo(ContainSubstring("contentfrom"))
+
+	// Two 30 KiB values: each fits the file limit, together they exceed the
+	// 60 KiB Metal3 budget.
+	kc.Spec.Files = []bootstrapv1beta2.File{
+		{Path: "/etc/app/a", ContentFrom: secretSource("large", "blob")},
+		{Path: "/etc/app/b", ContentFrom: secretSource("large", "blob")},
+	}
+	_, err = r.generateK0sCloudConfig(context.Background(), log.Log, kc, machineWithInfraKind("Metal3Machine"), cluster, "control-plane", "")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("60KiB safety budget"))
+}
@@ -22,11 +22,15 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -235,6 +239,13 @@ func (r *KairosConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	kairosConfig.Status.FailureReason = ""
 	kairosConfig.Status.FailureMessage = ""
 
+	// Informational only: never gates Ready. The Machine watch re-reconciles
+	// once the kubelet reports NodeInfo.
+	setKubernetesVersionMatched(kairosConfig, machine)
+	if err := r.setAirgapImagesReady(ctx, kairosConfig, machine, cluster); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	return ctrl.Result{}, nil
 }
 
@@ -408,10 +419,7 @@ func (r *KairosConfigReconciler) reconcileBootstrapData(ctx context.Context, log
 					}
 					// Check if there's a post-bootstrap service (indicating providerID was included)
 					// If Machine has providerID but secret has no service, we need to regenerate
-					hasPostBootstrapService := strings.Contains(cloudConfigStr, "kairos-k0s-post-bootstrap.service")
-					if distribution == "k3s" {
-						hasPostBootstrapService = strings.Contains(cloudConfigStr, "kairos-k3s-post-bootstrap.service")
-					}
+					hasPostBootstrapService := strings.Contains(cloudConfigStr, postBootstrapServiceName(distribution))
 					// Ensure SSH enable stage exists (regression guard for CAPV access).
 					//
 					// KD-3a: the `hasSSHPassAuth` check that previously looked for
@@ -441,6 +449,22 @@ func (r *KairosConfigReconciler) reconcileBootstrapData(ctx context.Context, log
 				}
 			}
 
+			// Bootstrap data rendered before passwords were hashed is rendered
+			// again so the plaintext leaves the Secret.
+			if hasPlaintextPassword(secret) {
+				log.Info("Bootstrap secret carries a plaintext user password, regenerating",
+					"secret", *kairosConfig.Status.DataSecretName)
+				needsRegeneration = true
+			}
+
+			// Files and manifests read through contentFrom are rendered again
+			// when the referenced Secret or ConfigMap data changes.
+			if r.contentSourcesChanged(ctx, kairosConfig, secret) {
+				log.Info("Referenced file or manifest content changed, regenerating",
+					"secret", *kairosConfig.Status.DataSecretName)
+				needsRegeneration = true
+			}
+
 			if needsRegeneration {
 				// Keep the existing secret name and regenerate its contents.
 				// The Machine's bootstrap dataSecretName is immutable, so we must not change it.
@@ -474,13 +498,40 @@ func (r *KairosConfigReconciler) reconcileBootstrapData(ctx context.Context, log
 		}
 	}
 
+	// Hash the contentFrom data before rendering, so content that changes
+	// while rendering is seen as a change on the next reconcile.
+	contentHash := ""
+	if usesContentFrom(kairosConfig) {
+		resolved, err := r.resolveContentSources(ctx, kairosConfig)
+		if err != nil {
+			if errors.Is(err, errContentSourceNotReady) {
+				log.Info("Waiting for file or manifest contentFrom source before generating cloud-config", "reason", err.Error())
+				return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+			}
+			return ctrl.Result{}, fmt.Errorf("failed to resolve contentFrom: %w", err)
+		}
+		contentHash = resolved.Hash
+	}
+
 	// Generate Kairos cloud-config
 	cloudConfig, err := r.generateCloudConfig(ctx, log, kairosConfig, machine, cluster)
 	if err != nil {
+		if errors.Is(err, errContentSourceNotReady) {
+			log.Info("Waiting for file or manifest contentFrom source before generating cloud-config", "reason", err.Error())
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		}
 		if errors.Is(err, errLBEndpointNotReady) {
 			log.Info("Waiting for control plane LoadBalancer endpoint before generating cloud-config")
 			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
 		}
+		if errors.Is(err, errControlPlaneEndpointNotReady) {
+			log.Info("Waiting for the Cluster controlPlaneEndpoint before generating worker cloud-config")
+			conditions.MarkFalse(kairosConfig, bootstrapv1beta2.BootstrapReadyCondition, bootstrapv1beta2.WaitingForControlPlaneInitializationReason, clusterv1.ConditionSeverityInfo,
+				"Waiting for the Cluster controlPlaneEndpoint; set spec.serverAddress to join another address")
+			conditions.MarkFalse(kairosConfig, bootstrapv1beta2.DataSecretAvailableCondition, bootstrapv1beta2.WaitingForControlPlaneInitializationReason, clusterv1.ConditionSeverityInfo,
+				"Waiting for the Cluster controlPlaneEndpoint")
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		}
 		if errors.Is(err, errTokenNotReady) {
 			log.Info("Waiting for join token secret before generating cloud-config")
 			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
@@ -543,6 +594,9 @@ func (r *KairosConfigReconciler) reconcileBootstrapData(ctx context.Context, log
 			"value": []byte(cloudConfig),
 		},
 	}
+	if contentHash != "" {
+		secret.Annotations = map[string]string{contentSourceHashAnnotation: contentHash}
+	}
 	// KD-48a: set the controller owner reference via the scheme instead of
 	// hand-rolling it. A KairosConfig fetched with r.Get carries an empty
 	// TypeMeta, so the previous hand-rolled reference had empty APIVersion/Kind
@@ -579,6 +633,14 @@ func (r *KairosConfigReconciler) reconcileBootstrapData(ctx context.Context, log
 		}
 		existingSecret.Type = secret.Type
 		existingSecret.Labels = secret.Labels
+		if contentHash != "" {
+			if existingSecret.Annotations == nil {
+				existingSecret.Annotations = map[string]string{}
+			}
+			existingSecret.Annotations[contentSourceHashAnnotation] = contentHash
+		} else {
+			delete(existingSecret.Annotations, contentSourceHashAnnotation)
+		}
 		existingSecret.OwnerReferences = secret.OwnerReferences
 		existingSecret.Data = secret.Data
 		if err := r.Update(ctx, existingSecret); err != nil {
@@ -600,11 +662,8 @@ func (r *KairosConfigReconciler) reconcileBootstrapData(ctx context.Context, log
 		if distribution == "" {
 			distribution = "k0s"
 		}
-		// Check for the systemd service that sets providerID (runs after k3s/k0s service starts)
-		hasPostBootstrapService := strings.Contains(cloudConfig, "kairos-k0s-post-bootstrap.service")
-		if distribution == "k3s" {
-			hasPostBootstrapService = strings.Contains(cloudConfig, "kairos-k3s-post-bootstrap.service")
-		}
+		// Check for the systemd service that sets providerID (runs after the distribution service starts)
+		hasPostBootstrapService := strings.Contains(cloudConfig, postBootstrapServiceName(distribution))
 
 		if hasProviderIDInSecret && hasPostBootstrapService {
 			kairosConfig.Status.Ready = true
@@ -690,6 +749,13 @@ func isMetal3Machine(machine *clusterv1.Machine) bool {
 	return machine.Spec.InfrastructureRef.Kind == "Metal3Machine"
 }
 
+// postBootstrapServiceName returns the systemd unit every template of the
+// distribution renders to run the post-bootstrap tasks (providerID patch,
+// kubeconfig push). Its presence marks bootstrap data rendered with them.
+func postBootstrapServiceName(distribution string) string {
+	return "kairos-" + distribution + "-post-bootstrap.service"
+}
+
 func (r *KairosConfigReconciler) sanitizeCapkUserdataSecret(ctx context.Context, log logr.Logger, kairosConfig *bootstrapv1beta2.KairosConfig, machine *clusterv1.Machine) (bool, bool, error) {
 	secretName := ""
 	if machine != nil && machine.Spec.Bootstrap.DataSecretName != nil && *machine.Spec.Bootstrap.DataSecretName != "" {
@@ -831,10 +897,13 @@ func (r *KairosConfigReconciler) generateCloudConfig(ctx context.Context, log lo
 		distribution = "k0s"
 	}
 
-	// Get cluster information
-	serverAddress := kairosConfig.Spec.ServerAddress
-	if serverAddress == "" && cluster.Spec.ControlPlaneEndpoint.IsValid() {
-		serverAddress = fmt.Sprintf("https://%s:%d", cluster.Spec.ControlPlaneEndpoint.Host, cluster.Spec.ControlPlaneEndpoint.Port)
+	// Workers join spec.serverAddress, else the Cluster's controlPlaneEndpoint
+	// (server_address.go). An explicit address that disagrees with the
+	// endpoint is rendered as given and reported on ServerAddressMatched.
+	serverAddress := resolveServerAddress(kairosConfig, cluster)
+	setServerAddressMatched(kairosConfig, cluster, role, distribution)
+	if serverAddress != kairosConfig.Spec.ServerAddress {
+		log.V(4).Info("Derived server address from the Cluster controlPlaneEndpoint", "serverAddress", serverAddress)
 	}
 
 	// Generate cloud-config based on distribution
@@ -843,6 +912,8 @@ func (r *KairosConfigReconciler) generateCloudConfig(ctx context.Context, log lo
 		return r.generateK0sCloudConfig(ctx, log, kairosConfig, machine, cluster, role, serverAddress)
 	case "k3s":
 		return r.generateK3sCloudConfig(ctx, log, kairosConfig, machine, cluster, role, serverAddress)
+	case "rke2":
+		return r.generateRKE2CloudConfig(ctx, log, kairosConfig, machine, cluster, role, serverAddress)
 	default:
 		return "", fmt.Errorf("unsupported distribution: %s", distribution)
 	}
@@ -892,6 +963,38 @@ func (r *KairosConfigReconciler) applyControlPlaneRenderData(ctx context.Context
 		}
 	}
 
+	// The airgap preload reports its result under the KairosConfig name over
+	// the same channel; setAirgapImagesReady reads it back.
+	if td.ManagementEndpoint != nil && cluster != nil && len(td.AirgapImages) > 0 {
+		if err := r.ensureAirgapStatusSecret(ctx, cluster); err != nil {
+			return err
+		}
+		td.ManagementEndpoint.AirgapStatusSecretName = bootstrapv1beta2.AirgapStatusSecretName(cluster.Name)
+		td.ManagementEndpoint.AirgapStatusKey = kairosConfig.Name
+	}
+
+	// Scheduled etcd snapshots run on every HA member (init AND join); the S3
+	// credentials are resolved here and land only in the 0600 env file.
+	if b := kairosConfig.Spec.EtcdBackup; b != nil {
+		switch kairosConfig.Spec.ControlPlaneRole {
+		case bootstrapv1beta2.ControlPlaneRoleInit, bootstrapv1beta2.ControlPlaneRoleJoin:
+			backup, err := r.resolveEtcdBackup(ctx, kairosConfig, b)
+			if err != nil {
+				return err
+			}
+			td.EtcdBackup = backup
+		}
+	}
+
+	// An etcd restore is only rendered on the init node the rebuilt cluster
+	// starts from; it downloads with the EtcdBackup settings resolved above.
+	if rs := kairosConfig.Spec.EtcdRestore; rs != nil && kairosConfig.Spec.ControlPlaneRole == bootstrapv1beta2.ControlPlaneRoleInit {
+		if td.EtcdBackup == nil {
+			return fmt.Errorf("etcdRestore requires etcdBackup on KairosConfig %s/%s", kairosConfig.Namespace, kairosConfig.Name)
+		}
+		td.EtcdRestore = &bootstrap.EtcdRestoreConfig{Location: rs.Location}
+	}
+
 	// The join token is only meaningful for init/join nodes. single needs none.
 	switch kairosConfig.Spec.ControlPlaneRole {
 	case bootstrapv1beta2.ControlPlaneRoleInit:
@@ -899,14 +1002,16 @@ func (r *KairosConfigReconciler) applyControlPlaneRenderData(ctx context.Context
 		// mints it via `k0s token create` and pushes it over the node-push
 		// channel; the renderer needs the target Secret name to build that push
 		// block. The init node does NOT embed a token in its own k0s config.
+		// It mints the first worker join token the same way.
 		if distribution == "k0s" {
 			if td.ManagementEndpoint != nil && cluster != nil {
 				td.ManagementEndpoint.JoinTokenSecretName = bootstrapv1beta2.ControlPlaneJoinTokenSecretName(cluster.Name)
+				td.ManagementEndpoint.WorkerTokenSecretName = bootstrapv1beta2.WorkerTokenSecretName(cluster.Name)
 			}
 			break
 		}
-		// k3s init carries the controller-generated shared server token (written
-		// to the token file for BOTH init and join per BLOCKER-1).
+		// k3s and rke2 init carry the controller-generated shared server token
+		// (written to the token file for BOTH init and join per BLOCKER-1).
 		token, err := r.resolveToken(ctx, tokenKindControlPlaneJoin, kairosConfig, cluster)
 		if err != nil {
 			return err
@@ -922,8 +1027,286 @@ func (r *KairosConfigReconciler) applyControlPlaneRenderData(ctx context.Context
 	return nil
 }
 
-// resolveUserPassword returns the user password for the default user, in
-// precedence order: UserPasswordSecretRef > inline UserPassword > "" (empty).
+// resolveEtcdBackup converts the propagated etcd backup block into the render
+// config, reading the S3 credentials from the referenced Secret (defaulting to
+// the KairosConfig's namespace). Both keys are required; the credentials are
+// never logged.
+func (r *KairosConfigReconciler) resolveEtcdBackup(ctx context.Context, kairosConfig *bootstrapv1beta2.KairosConfig, b *bootstrapv1beta2.ControlPlaneEtcdBackup) (*bootstrap.EtcdBackupConfig, error) {
+	secretKey := types.NamespacedName{
+		Namespace: kairosConfig.Namespace,
+		Name:      b.CredentialsSecretRef.Name,
+	}
+	if b.CredentialsSecretRef.Namespace != "" {
+		secretKey.Namespace = b.CredentialsSecretRef.Namespace
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, secretKey, secret); err != nil {
+		return nil, fmt.Errorf("get etcd backup credentials secret %s/%s: %w", secretKey.Namespace, secretKey.Name, err)
+	}
+	creds := map[string]string{}
+	for _, key := range []string{bootstrapv1beta2.EtcdBackupAccessKeyIDKey, bootstrapv1beta2.EtcdBackupSecretAccessKeyKey} {
+		data, ok := secret.Data[key]
+		if !ok || len(data) == 0 {
+			return nil, fmt.Errorf("etcd backup credentials secret %s/%s does not contain key %q", secretKey.Namespace, secretKey.Name, key)
+		}
+		creds[key] = string(data)
+	}
+	return &bootstrap.EtcdBackupConfig{
+		Schedule:        b.Schedule,
+		Retention:       b.Retention,
+		Endpoint:        b.Endpoint,
+		Bucket:          b.Bucket,
+		Prefix:          b.Prefix,
+		Region:          b.Region,
+		AccessKeyID:     creds[bootstrapv1beta2.EtcdBackupAccessKeyIDKey],
+		SecretAccessKey: creds[bootstrapv1beta2.EtcdBackupSecretAccessKeyKey],
+	}, nil
+}
+
+// resolveRegistries converts spec.registries into the render config, reading
+// each AuthSecretRef the same way resolveUserPassword reads its Secret
+// (defaulting to the KairosConfig's namespace). Both the username and password
+// keys are required; the credentials are never logged.
+func (r *KairosConfigReconciler) resolveRegistries(ctx context.Context, kairosConfig *bootstrapv1beta2.KairosConfig) (*bootstrap.RegistriesConfig, error) {
+	regs := kairosConfig.Spec.Registries
+	if regs == nil {
+		return nil, nil
+	}
+	out := &bootstrap.RegistriesConfig{}
+	for _, m := range regs.Mirrors {
+		out.Mirrors = append(out.Mirrors, bootstrap.RegistryMirrorConfig{
+			Registry:  m.Registry,
+			Endpoints: m.Endpoints,
+		})
+	}
+	for _, c := range regs.Configs {
+		host := bootstrap.RegistryHostConfig{
+			Host:               c.Host,
+			CA:                 c.CA,
+			InsecureSkipVerify: c.InsecureSkipVerify,
+		}
+		if ref := c.AuthSecretRef; ref != nil && ref.Name != "" {
+			secretKey := types.NamespacedName{
+				Namespace: kairosConfig.Namespace,
+				Name:      ref.Name,
+			}
+			if ref.Namespace != "" {
+				secretKey.Namespace = ref.Namespace
+			}
+			secret := &corev1.Secret{}
+			if err := r.Get(ctx, secretKey, secret); err != nil {
+				return nil, fmt.Errorf("get registry auth secret %s/%s for %s: %w", secretKey.Namespace, secretKey.Name, c.Host, err)
+			}
+			creds := map[string]string{}
+			for _, key := range []string{bootstrapv1beta2.RegistryAuthUsernameKey, bootstrapv1beta2.RegistryAuthPasswordKey} {
+				data, ok := secret.Data[key]
+				if !ok || len(data) == 0 {
+					return nil, fmt.Errorf("registry auth secret %s/%s does not contain key %q", secretKey.Namespace, secretKey.Name, key)
+				}
+				creds[key] = string(data)
+			}
+			host.Username = creds[bootstrapv1beta2.RegistryAuthUsernameKey]
+			host.Password = creds[bootstrapv1beta2.RegistryAuthPasswordKey]
+		}
+		out.Configs = append(out.Configs, host)
+	}
+	return out, nil
+}
+
+// proxyRenderData converts spec.proxy into the render config. NO_PROXY is
+// completed with everything the node must reach directly: loopback, the
+// in-cluster service domains, the pod and service CIDRs, the control-plane
+// endpoint (Cluster endpoint, CAPK LoadBalancer, kube-vip VIP, server
+// address) and the management API host the node-push channel talks to.
+// Without the last one the kubeconfig and token pushes would be sent through
+// the proxy. It runs after the rest of td is filled in.
+func proxyRenderData(kairosConfig *bootstrapv1beta2.KairosConfig, cluster *clusterv1.Cluster, td *bootstrap.TemplateData) *bootstrap.ProxyConfig {
+	p := kairosConfig.Spec.Proxy
+	if p == nil {
+		return nil
+	}
+	podCIDR, serviceCIDR := bootstrap.K0sDefaultPodCIDR, bootstrap.K0sDefaultServiceCIDR
+	switch kairosConfig.Spec.Distribution {
+	case "k3s":
+		podCIDR, serviceCIDR = bootstrap.K3sDefaultPodCIDR, bootstrap.K3sDefaultServiceCIDR
+	case "rke2":
+		podCIDR, serviceCIDR = bootstrap.RKE2DefaultPodCIDR, bootstrap.RKE2DefaultServiceCIDR
+	}
+	if kairosConfig.Spec.PodCIDR != "" {
+		podCIDR = kairosConfig.Spec.PodCIDR
+	}
+	if kairosConfig.Spec.ServiceCIDR != "" {
+		serviceCIDR = kairosConfig.Spec.ServiceCIDR
+	}
+
+	var noProxy []string
+	seen := map[string]bool{}
+	add := func(entries ...string) {
+		for _, e := range entries {
+			if e != "" && !seen[e] {
+				seen[e] = true
+				noProxy = append(noProxy, e)
+			}
+		}
+	}
+	urlHost := func(raw string) string {
+		if u, err := url.Parse(raw); err == nil && u.Host != "" {
+			return u.Hostname()
+		}
+		return ""
+	}
+	add(p.NoProxy...)
+	add("localhost", "127.0.0.1", "::1", ".svc", ".cluster.local", podCIDR, serviceCIDR)
+	if cluster != nil {
+		add(cluster.Spec.ControlPlaneEndpoint.Host)
+	}
+	add(td.ControlPlaneLBEndpoint, urlHost(kairosConfig.Spec.ServerAddress), urlHost(td.K3sServerURL), urlHost(td.RKE2ServerURL))
+	if td.VIP != nil {
+		add(td.VIP.Address)
+	}
+	if td.ManagementEndpoint != nil {
+		add(urlHost(td.ManagementEndpoint.APIServer))
+	}
+	return &bootstrap.ProxyConfig{
+		HTTPProxy:  p.HTTPProxy,
+		HTTPSProxy: p.HTTPSProxy,
+		NoProxy:    noProxy,
+	}
+}
+
+// airgapImagesRenderData converts spec.airgapImages into the renderer's flat
+// view. The bundles need no API-server lookups; the node fetches them itself.
+func airgapImagesRenderData(bundles []bootstrapv1beta2.AirgapImageBundle) []bootstrap.AirgapBundleConfig {
+	if len(bundles) == 0 {
+		return nil
+	}
+	out := make([]bootstrap.AirgapBundleConfig, 0, len(bundles))
+	for _, b := range bundles {
+		out = append(out, bootstrap.AirgapBundleConfig{
+			Image:  b.Image,
+			Path:   b.Path,
+			URL:    b.URL,
+			SHA256: b.SHA256,
+		})
+	}
+	return out
+}
+
+// networkRenderData converts spec.network into the renderer's flat view.
+func networkRenderData(n *bootstrapv1beta2.Network) *bootstrap.NetworkConfig {
+	if n == nil {
+		return nil
+	}
+	addressing := func(a bootstrapv1beta2.NetworkAddressing) bootstrap.NetworkAddressingConfig {
+		out := bootstrap.NetworkAddressingConfig{
+			DHCP4:         a.DHCP4,
+			DHCP6:         a.DHCP6,
+			Addresses:     a.Addresses,
+			Gateway4:      a.Gateway4,
+			Gateway6:      a.Gateway6,
+			Nameservers:   a.Nameservers,
+			SearchDomains: a.SearchDomains,
+		}
+		if a.MTU != nil {
+			out.MTU = *a.MTU
+		}
+		for _, r := range a.Routes {
+			out.Routes = append(out.Routes, bootstrap.NetworkRouteConfig{To: r.To, Via: r.Via, Metric: r.Metric})
+		}
+		return out
+	}
+	out := &bootstrap.NetworkConfig{}
+	for _, i := range n.Interfaces {
+		out.Interfaces = append(out.Interfaces, bootstrap.NetworkInterfaceConfig{
+			Name:                    i.Name,
+			MACAddress:              i.MACAddress,
+			NetworkAddressingConfig: addressing(i.NetworkAddressing),
+		})
+	}
+	for _, b := range n.Bonds {
+		out.Bonds = append(out.Bonds, bootstrap.NetworkBondConfig{
+			Name:                    b.Name,
+			Interfaces:              b.Interfaces,
+			Mode:                    string(b.Mode),
+			NetworkAddressingConfig: addressing(b.NetworkAddressing),
+		})
+	}
+	for _, v := range n.VLANs {
+		out.VLANs = append(out.VLANs, bootstrap.NetworkVLANConfig{
+			Name:                    v.Name,
+			ID:                      v.ID,
+			Link:                    v.Link,
+			NetworkAddressingConfig: addressing(v.NetworkAddressing),
+		})
+	}
+	return out
+}
+
+// kubeletRenderData converts spec.nodeLabels, spec.nodeTaints and
+// spec.kubeletExtraArgs into the renderer's view, or nil when all are empty.
+func kubeletRenderData(spec *bootstrapv1beta2.KairosConfigSpec) *bootstrap.KubeletConfig {
+	if len(spec.NodeLabels) == 0 && len(spec.NodeTaints) == 0 && len(spec.KubeletExtraArgs) == 0 {
+		return nil
+	}
+	out := &bootstrap.KubeletConfig{
+		Labels:    spec.NodeLabels,
+		ExtraArgs: spec.KubeletExtraArgs,
+	}
+	for _, t := range spec.NodeTaints {
+		out.Taints = append(out.Taints, bootstrap.NodeTaintConfig{Key: t.Key, Value: t.Value, Effect: string(t.Effect)})
+	}
+	return out
+}
+
+// cniRenderData converts spec.controlPlaneCNI into the render config, or nil
+// for the distribution default.
+func cniRenderData(c *bootstrapv1beta2.ControlPlaneCNI) *bootstrap.CNIConfig {
+	if c == nil {
+		return nil
+	}
+	return &bootstrap.CNIConfig{Provider: c.Provider}
+}
+
+// jsonObjectRenderData decodes a free-form spec object (spec.k0sConfig, a
+// spec.k3sConfig section) into the renderer's generic map. The JSON is decoded
+// as YAML so integers stay integers when the renderer marshals them again.
+func jsonObjectRenderData(raw *apiextensionsv1.JSON, path string) (map[string]any, error) {
+	if raw == nil || len(raw.Raw) == 0 {
+		return nil, nil
+	}
+	var out map[string]any
+	if err := yaml.Unmarshal(raw.Raw, &out); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// k3sConfigRenderData converts spec.k3sConfig into the render config, or nil
+// when neither section is set.
+func k3sConfigRenderData(c *bootstrapv1beta2.K3sConfig) (*bootstrap.K3sConfig, error) {
+	if c == nil {
+		return nil, nil
+	}
+	server, err := jsonObjectRenderData(c.Server, "spec.k3sConfig.server")
+	if err != nil {
+		return nil, err
+	}
+	agent, err := jsonObjectRenderData(c.Agent, "spec.k3sConfig.agent")
+	if err != nil {
+		return nil, err
+	}
+	if len(server) == 0 && len(agent) == 0 {
+		return nil, nil
+	}
+	return &bootstrap.K3sConfig{Server: server, Agent: agent}, nil
+}
+
+// resolveUserPassword returns the crypt(3) hash of the default user's
+// password, in precedence order: UserPasswordSecretRef > inline UserPassword >
+// "" (empty). Plaintext is hashed with SHA-512 crypt before it reaches the
+// renderer, so it is never stored in the bootstrap data Secret; a value that
+// is already a SHA-512, SHA-256 or yescrypt hash is used as is (see
+// bootstrap.HashPassword).
 //
 // Empty is a valid return value here. The validating webhook requires the
 // KairosConfig to set at least one of userPassword/userPasswordSecretRef/
@@ -934,6 +1317,7 @@ func (r *KairosConfigReconciler) applyControlPlaneRenderData(ctx context.Context
 // KD-3a, v0.1.0-alpha.2: this replaced the previous behaviour of defaulting
 // to "kairos" when no password was set.
 func (r *KairosConfigReconciler) resolveUserPassword(ctx context.Context, kairosConfig *bootstrapv1beta2.KairosConfig) (string, error) {
+	password := kairosConfig.Spec.UserPassword
 	if ref := kairosConfig.Spec.UserPasswordSecretRef; ref != nil && ref.Name != "" {
 		secretKey := types.NamespacedName{
 			Namespace: kairosConfig.Namespace,
@@ -954,9 +1338,29 @@ func (r *KairosConfigReconciler) resolveUserPassword(ctx context.Context, kairos
 		if !ok {
 			return "", fmt.Errorf("user password secret %s/%s does not contain key %q", secretKey.Namespace, secretKey.Name, key)
 		}
-		return string(data), nil
+		password = string(data)
+	}
+	return bootstrap.HashPassword(password)
+}
+
+// hasPlaintextPassword reports whether the cloud-config in a bootstrap data
+// Secret sets a users[].passwd that is not a crypt(3) hash. Data that does not
+// parse as a cloud-config is left to the other regeneration checks.
+func hasPlaintextPassword(secret *corev1.Secret) bool {
+	var cloudConfig struct {
+		Users []struct {
+			Passwd string `yaml:"passwd"`
+		} `yaml:"users"`
+	}
+	if err := yaml.Unmarshal(secret.Data["value"], &cloudConfig); err != nil {
+		return false
+	}
+	for _, u := range cloudConfig.Users {
+		if u.Passwd != "" && !bootstrap.IsPasswordHash(u.Passwd) {
+			return true
+		}
 	}
-	return kairosConfig.Spec.UserPassword, nil
+	return false
 }
 
 func (r *KairosConfigReconciler) generateK0sCloudConfig(ctx context.Context, log logr.Logger, kairosConfig *bootstrapv1beta2.KairosConfig, machine *clusterv1.Machine, cluster *clusterv1.Cluster, role, serverAddress string) (string, error) {
@@ -977,11 +1381,12 @@ func (r *KairosConfigReconciler) generateK0sCloudConfig(ctx context.Context, log
 
 	// Get worker token if needed (for worker nodes).
 	// Precedence (tokenKindK0sWorker): WorkerTokenSecretRef > WorkerToken >
-	// TokenSecretRef > Token. Resolution is centralized in resolveToken
-	// (tokens.go). NOTE: a missing referenced Secret now surfaces as
-	// errTokenNotReady (timed requeue) rather than a hard error, aligning the
-	// k0s worker path with the k3s worker path's pre-existing requeue behavior;
-	// a missing token Secret is transient, not terminal.
+	// TokenSecretRef > Token > the KairosControlPlane's <cluster>-worker-token
+	// Secret. Resolution is centralized in resolveToken (tokens.go). NOTE: a
+	// missing referenced Secret now surfaces as errTokenNotReady (timed
+	// requeue) rather than a hard error, aligning the k0s worker path with the
+	// k3s worker path's pre-existing requeue behavior; a missing token Secret
+	// is transient, not terminal.
 	var workerToken string
 	if role == "worker" {
 		var err error
@@ -991,7 +1396,7 @@ func (r *KairosConfigReconciler) generateK0sCloudConfig(ctx context.Context, log
 		}
 		// Validate worker token is present
 		if workerToken == "" {
-			return "", fmt.Errorf("worker token is required for worker nodes: either WorkerTokenSecretRef, WorkerToken, TokenSecretRef, or Token must be set")
+			return "", fmt.Errorf("worker token is required for worker nodes: either WorkerTokenSecretRef, WorkerToken, TokenSecretRef, or Token must be set when the control plane is not a KairosControlPlane")
 		}
 	}
 
@@ -1004,6 +1409,18 @@ func (r *KairosConfigReconciler) generateK0sCloudConfig(ctx context.Context, log
 	if err != nil {
 		return "", err
 	}
+	registries, err := r.resolveRegistries(ctx, kairosConfig)
+	if err != nil {
+		return "", err
+	}
+	content, err := r.resolveContentSources(ctx, kairosConfig)
+	if err != nil {
+		return "", err
+	}
+	k0sConfig, err := jsonObjectRenderData(kairosConfig.Spec.K0sConfig, "spec.k0sConfig")
+	if err != nil {
+		return "", err
+	}
 	userGroups := kairosConfig.Spec.UserGroups
 	if len(userGroups) == 0 {
 		userGroups = []string{"admin"}
@@ -1082,8 +1499,8 @@ func (r *KairosConfigReconciler) generateK0sCloudConfig(ctx context.Context, log
 		GitHubUser:                     kairosConfig.Spec.GitHubUser,
 		SSHPublicKey:                   kairosConfig.Spec.SSHPublicKey,
 		WorkerToken:                    workerToken,
-		Manifests:                      kairosConfig.Spec.Manifests,
-		Files:                          kairosConfig.Spec.Files,
+		Manifests:                      content.Manifests,
+		Files:                          content.Files,
 		HostnamePrefix:                 hostnamePrefix,
 		DNSServers:                     kairosConfig.Spec.DNSServers,
 		PodCIDR:                        kairosConfig.Spec.PodCIDR,
@@ -1098,6 +1515,14 @@ func (r *KairosConfigReconciler) generateK0sCloudConfig(ctx context.Context, log
 		ControlPlaneLBServiceName:      "",
 		ControlPlaneLBServiceNamespace: "",
 		ControlPlaneLBEndpoint:         "",
+		KubernetesVersion:              kairosConfig.Spec.KubernetesVersion,
+		DistributionRelease:            distributionReleaseRenderData(kairosConfig.Spec.DistributionRelease),
+		Registries:                     registries,
+		AirgapImages:                   airgapImagesRenderData(kairosConfig.Spec.AirgapImages),
+		Network:                        networkRenderData(kairosConfig.Spec.Network),
+		Kubelet:                        kubeletRenderData(&kairosConfig.Spec),
+		K0sConfig:                      k0sConfig,
+		CNI:                            cniRenderData(kairosConfig.Spec.ControlPlaneCNI),
 	}
 	if mgmtEndpoint != nil {
 		// One-line conversion preserves the rule that internal/bootstrap is
@@ -1118,6 +1543,7 @@ func (r *KairosConfigReconciler) generateK0sCloudConfig(ctx context.Context, log
 			KubeconfigSecretNamespace: mgmtEndpoint.KubeconfigSecretNamespace,
 			ClusterName:               cluster.Name,
 			ControlPlaneEndpointHost:  cluster.Spec.ControlPlaneEndpoint.Host,
+			CABundle:                  mgmtEndpoint.CABundle,
 		}
 	}
 	if machine != nil {
@@ -1143,6 +1569,7 @@ func (r *KairosConfigReconciler) generateK0sCloudConfig(ctx context.Context, log
 	if err := r.applyControlPlaneRenderData(ctx, &templateData, kairosConfig, cluster, role); err != nil {
 		return "", err
 	}
+	templateData.Proxy = proxyRenderData(kairosConfig, cluster, &templateData)
 
 	// Render template
 	return bootstrap.RenderK0sCloudConfig(templateData)
@@ -1160,7 +1587,8 @@ func (r *KairosConfigReconciler) generateK3sCloudConfig(ctx context.Context, log
 
 	// Resolve k3s token if needed (for worker nodes).
 	// Precedence (tokenKindK3sWorker): K3sTokenSecretRef > K3sToken >
-	// WorkerTokenSecretRef > WorkerToken > TokenSecretRef > Token. Resolution is
+	// WorkerTokenSecretRef > WorkerToken > TokenSecretRef > Token > the
+	// KairosControlPlane's <cluster>-worker-token Secret. Resolution is
 	// centralized in resolveToken (tokens.go); a missing referenced Secret
 	// surfaces as errTokenNotReady (timed requeue), preserving the pre-refactor
 	// behavior of this path.
@@ -1173,10 +1601,10 @@ func (r *KairosConfigReconciler) generateK3sCloudConfig(ctx context.Context, log
 		}
 
 		if k3sToken == "" {
-			return "", fmt.Errorf("k3s worker requires a join token: set k3sTokenSecretRef, k3sToken, workerTokenSecretRef, workerToken, tokenSecretRef, or token")
+			return "", fmt.Errorf("k3s worker requires a join token: set k3sTokenSecretRef, k3sToken, workerTokenSecretRef, workerToken, tokenSecretRef, or token when the control plane is not a KairosControlPlane")
 		}
 		if serverAddress == "" {
-			return "", fmt.Errorf("k3s worker requires serverAddress or cluster controlPlaneEndpoint")
+			return "", errControlPlaneEndpointNotReady
 		}
 	}
 
@@ -1189,6 +1617,18 @@ func (r *KairosConfigReconciler) generateK3sCloudConfig(ctx context.Context, log
 	if err != nil {
 		return "", err
 	}
+	registries, err := r.resolveRegistries(ctx, kairosConfig)
+	if err != nil {
+		return "", err
+	}
+	content, err := r.resolveContentSources(ctx, kairosConfig)
+	if err != nil {
+		return "", err
+	}
+	k3sConfig, err := k3sConfigRenderData(kairosConfig.Spec.K3sConfig)
+	if err != nil {
+		return "", err
+	}
 	userGroups := kairosConfig.Spec.UserGroups
 	if len(userGroups) == 0 {
 		userGroups = []string{"admin"}
@@ -1261,8 +1701,8 @@ func (r *KairosConfigReconciler) generateK3sCloudConfig(ctx context.Context, log
 		UserGroups:                     userGroups,
 		GitHubUser:                     kairosConfig.Spec.GitHubUser,
 		SSHPublicKey:                   kairosConfig.Spec.SSHPublicKey,
-		Manifests:                      kairosConfig.Spec.Manifests,
-		Files:                          kairosConfig.Spec.Files,
+		Manifests:                      content.Manifests,
+		Files:                          content.Files,
 		HostnamePrefix:                 hostnamePrefix,
 		DNSServers:                     kairosConfig.Spec.DNSServers,
 		PrimaryIP:                      kairosConfig.Spec.PrimaryIP,
@@ -1277,6 +1717,14 @@ func (r *KairosConfigReconciler) generateK3sCloudConfig(ctx context.Context, log
 		ControlPlaneLBServiceName:      "",
 		ControlPlaneLBServiceNamespace: "",
 		ControlPlaneLBEndpoint:         "",
+		KubernetesVersion:              kairosConfig.Spec.KubernetesVersion,
+		DistributionRelease:            distributionReleaseRenderData(kairosConfig.Spec.DistributionRelease),
+		Registries:                     registries,
+		AirgapImages:                   airgapImagesRenderData(kairosConfig.Spec.AirgapImages),
+		Network:                        networkRenderData(kairosConfig.Spec.Network),
+		Kubelet:                        kubeletRenderData(&kairosConfig.Spec),
+		K3sConfig:                      k3sConfig,
+		CNI:                            cniRenderData(kairosConfig.Spec.ControlPlaneCNI),
 	}
 	if mgmtEndpoint != nil {
 		// See k0s twin above for the rationale behind stamping ClusterName /
@@ -1288,6 +1736,7 @@ func (r *KairosConfigReconciler) generateK3sCloudConfig(ctx context.Context, log
 			KubeconfigSecretNamespace: mgmtEndpoint.KubeconfigSecretNamespace,
 			ClusterName:               cluster.Name,
 			ControlPlaneEndpointHost:  cluster.Spec.ControlPlaneEndpoint.Host,
+			CABundle:                  mgmtEndpoint.CABundle,
 		}
 	}
 	if machine != nil {
@@ -1313,10 +1762,211 @@ func (r *KairosConfigReconciler) generateK3sCloudConfig(ctx context.Context, log
 	if err := r.applyControlPlaneRenderData(ctx, &templateData, kairosConfig, cluster, role); err != nil {
 		return "", err
 	}
+	templateData.Proxy = proxyRenderData(kairosConfig, cluster, &templateData)
 
 	return bootstrap.RenderK3sCloudConfig(templateData)
 }
 
+func (r *KairosConfigReconciler) generateRKE2CloudConfig(ctx context.Context, log logr.Logger, kairosConfig *bootstrapv1beta2.KairosConfig, machine *clusterv1.Machine, cluster *clusterv1.Cluster, role, serverAddress string) (string, error) {
+	// Determine single-node mode
+	singleNode := kairosConfig.Spec.SingleNode
+	if !singleNode && role == "control-plane" && machine != nil {
+		ownerRef := metav1.GetControllerOf(machine)
+		if ownerRef != nil && ownerRef.Kind == "KairosControlPlane" {
+			log.V(4).Info("Control plane node, single-node mode determined from spec", "singleNode", singleNode)
+		}
+	}
+
+	// Resolve the rke2 agent token (for worker nodes).
+	// Precedence (tokenKindRKE2Worker): WorkerTokenSecretRef > WorkerToken >
+	// TokenSecretRef > Token. Agents register through the supervisor port of
+	// the control-plane endpoint, not the API server port serverAddress
+	// carries.
+	var rke2Token, rke2ServerURL string
+	if role == "worker" {
+		var err error
+		rke2Token, err = r.resolveToken(ctx, tokenKindRKE2Worker, kairosConfig, cluster)
+		if err != nil {
+			return "", err
+		}
+
+		if rke2Token == "" {
+			return "", fmt.Errorf("rke2 worker requires a join token: set workerTokenSecretRef, workerToken, tokenSecretRef, or token")
+		}
+		if serverAddress == "" {
+			return "", errControlPlaneEndpointNotReady
+		}
+		rke2ServerURL, err = rke2SupervisorURL(serverAddress)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Set defaults for user configuration
+	userName := kairosConfig.Spec.UserName
+	if userName == "" {
+		userName = "kairos"
+	}
+	userPassword, err := r.resolveUserPassword(ctx, kairosConfig)
+	if err != nil {
+		return "", err
+	}
+	registries, err := r.resolveRegistries(ctx, kairosConfig)
+	if err != nil {
+		return "", err
+	}
+	content, err := r.resolveContentSources(ctx, kairosConfig)
+	if err != nil {
+		return "", err
+	}
+	userGroups := kairosConfig.Spec.UserGroups
+	if len(userGroups) == 0 {
+		userGroups = []string{"admin"}
+	}
+
+	// Set hostname prefix (default to "metal-" if not specified)
+	hostnamePrefix := kairosConfig.Spec.HostnamePrefix
+	if hostnamePrefix == "" {
+		hostnamePrefix = "metal-"
+	}
+
+	// Prefer explicit hostname, otherwise use Machine name
+	hostname := kairosConfig.Spec.Hostname
+	if hostname == "" && machine != nil {
+		hostname = machine.Name
+	}
+
+	// Set install configuration (with defaults)
+	var installConfig *bootstrap.InstallConfig
+	if kairosConfig.Spec.Install != nil {
+		installConfig = &bootstrap.InstallConfig{
+			Auto:   true,
+			Device: "auto",
+			Reboot: true,
+		}
+		if kairosConfig.Spec.Install.Auto != nil {
+			installConfig.Auto = *kairosConfig.Spec.Install.Auto
+		}
+		if kairosConfig.Spec.Install.Device != "" {
+			installConfig.Device = kairosConfig.Spec.Install.Device
+		}
+		if kairosConfig.Spec.Install.Reboot != nil {
+			installConfig.Reboot = *kairosConfig.Spec.Install.Reboot
+		}
+	}
+
+	if installConfig != nil {
+		log.Info("Using install configuration", "auto", installConfig.Auto, "device", installConfig.Device, "reboot", installConfig.Reboot)
+	} else {
+		log.Info("No install configuration provided; install block will be omitted")
+	}
+
+	// Get providerID from Machine's infrastructure reference.
+	// CAPM3 owns Node.spec.providerID for Metal3 machines — suppress it here so
+	// the template does not emit --provider-id args or the kubectl patch block.
+	// (ADR 0004, OQ-1 RESOLVED.)
+	var providerID string
+	if !isMetal3Machine(machine) {
+		providerID = r.getProviderID(ctx, log, machine)
+	}
+
+	// Control-plane: same routing as the k0s and k3s paths above.
+	var mgmtEndpoint *ManagementEndpoint
+	if supportsManagementEndpoint(machine) && role == "control-plane" && r.MgmtEndpointResolver != nil {
+		var err error
+		mgmtEndpoint, err = r.MgmtEndpointResolver.Resolve(ctx, kairosConfig, cluster)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Build template data
+	templateData := bootstrap.TemplateData{
+		Role:                           role,
+		SingleNode:                     singleNode,
+		Hostname:                       hostname,
+		UserName:                       userName,
+		UserPassword:                   userPassword,
+		UserGroups:                     userGroups,
+		GitHubUser:                     kairosConfig.Spec.GitHubUser,
+		SSHPublicKey:                   kairosConfig.Spec.SSHPublicKey,
+		Manifests:                      content.Manifests,
+		Files:                          content.Files,
+		HostnamePrefix:                 hostnamePrefix,
+		DNSServers:                     kairosConfig.Spec.DNSServers,
+		PrimaryIP:                      kairosConfig.Spec.PrimaryIP,
+		MachineName:                    "",
+		ClusterNS:                      "",
+		IsKubeVirt:                     isKubevirtMachine(machine),
+		Metal3:                         isMetal3Machine(machine),
+		Install:                        installConfig,
+		ProviderID:                     providerID,
+		RKE2ServerURL:                  rke2ServerURL,
+		RKE2Token:                      rke2Token,
+		ControlPlaneLBServiceName:      "",
+		ControlPlaneLBServiceNamespace: "",
+		ControlPlaneLBEndpoint:         "",
+		KubernetesVersion:              kairosConfig.Spec.KubernetesVersion,
+		DistributionRelease:            distributionReleaseRenderData(kairosConfig.Spec.DistributionRelease),
+		Registries:                     registries,
+		AirgapImages:                   airgapImagesRenderData(kairosConfig.Spec.AirgapImages),
+		Network:                        networkRenderData(kairosConfig.Spec.Network),
+		Kubelet:                        kubeletRenderData(&kairosConfig.Spec),
+		CNI:                            cniRenderData(kairosConfig.Spec.ControlPlaneCNI),
+	}
+	if mgmtEndpoint != nil {
+		// See the k0s twin for the rationale behind stamping ClusterName /
+		// ControlPlaneEndpointHost from the live Cluster (not the resolver).
+		templateData.ManagementEndpoint = &bootstrap.ManagementEndpoint{
+			APIServer:                 mgmtEndpoint.APIServer,
+			Token:                     mgmtEndpoint.Token,
+			KubeconfigSecretName:      mgmtEndpoint.KubeconfigSecretName,
+			KubeconfigSecretNamespace: mgmtEndpoint.KubeconfigSecretNamespace,
+			ClusterName:               cluster.Name,
+			ControlPlaneEndpointHost:  cluster.Spec.ControlPlaneEndpoint.Host,
+			CABundle:                  mgmtEndpoint.CABundle,
+		}
+	}
+	if machine != nil {
+		templateData.MachineName = machine.Name
+	}
+	if cluster != nil {
+		templateData.ClusterNS = cluster.Namespace
+		templateData.ControlPlaneLBServiceName = fmt.Sprintf("%s-%s", cluster.Name, controlPlaneLBServiceSuffix)
+		templateData.ControlPlaneLBServiceNamespace = cluster.Namespace
+	}
+	if cluster != nil && isKubevirtMachine(machine) && role == "control-plane" {
+		lbEndpoint, err := r.getControlPlaneLBEndpoint(ctx, cluster.Namespace, templateData.ControlPlaneLBServiceName)
+		if err != nil {
+			return "", fmt.Errorf("failed to get control plane LB endpoint: %w", err)
+		}
+		if lbEndpoint == "" {
+			return "", errLBEndpointNotReady
+		}
+		templateData.ControlPlaneLBEndpoint = lbEndpoint
+	}
+
+	// HA: role / join token / VIP (ADR 0005 Phase 3). No-op on workers (CPR-INV-1).
+	if err := r.applyControlPlaneRenderData(ctx, &templateData, kairosConfig, cluster, role); err != nil {
+		return "", err
+	}
+	templateData.Proxy = proxyRenderData(kairosConfig, cluster, &templateData)
+
+	return bootstrap.RenderRKE2CloudConfig(templateData)
+}
+
+// rke2SupervisorURL rewrites the API server URL to the rke2 supervisor port
+// (9345) on the same host, where agents register.
+func rke2SupervisorURL(serverAddress string) (string, error) {
+	u, err := url.Parse(serverAddress)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid rke2 server address %q", serverAddress)
+	}
+	u.Host = net.JoinHostPort(u.Hostname(), "9345")
+	u.Path = ""
+	return u.String(), nil
+}
+
 func (r *KairosConfigReconciler) getControlPlaneLBEndpoint(ctx context.Context, namespace, name string) (string, error) {
 	if namespace == "" || name == "" {
 		return "", nil
@@ -1369,6 +2019,9 @@ func (r *KairosConfigReconciler) reconcileDelete(ctx context.Context, log logr.L
 			"secret", *kairosConfig.Status.DataSecretName)
 		return ctrl.Result{RequeueAfter: bootstrapDeleteRequeueAfter}, false, nil
 	}
+	if err := r.removeAirgapStatusReport(ctx, kairosConfig); err != nil {
+		return ctrl.Result{}, false, err
+	}
 
 	// Terminal step: remove the finalizer with a bare r.Update. The patch
 	// helper is bypassed via skipPatch=true so the deferred closure in
@@ -1435,11 +2088,11 @@ func (r *KairosConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			&corev1.Secret{},
 			handler.EnqueueRequestsFromMapFunc(r.secretToKairosConfig),
 		).
-		// HA join-token Secret watch (ADR 0005 Phase 3, BLOCKER-2). Label-filtered
-		// to the join-token secret-type label so a join KairosConfig is
-		// re-reconciled the moment the k0s init node pushes the token, instead of
-		// waiting for the requeue backstop. Distinct handler from the userdata
-		// Secret watch above.
+		// HA join-token and worker-token Secret watch (ADR 0005 Phase 3,
+		// BLOCKER-2). Label-filtered to the two secret-type label values so a
+		// join or worker KairosConfig is re-reconciled the moment its token is
+		// published, instead of waiting for the requeue backstop. Distinct
+		// handler from the userdata Secret watch above.
 		Watches(
 			&corev1.Secret{},
 			handler.EnqueueRequestsFromMapFunc(r.joinTokenSecretToKairosConfig),
@@ -1448,12 +2101,36 @@ func (r *KairosConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				if !ok {
 					return false
 				}
-				return secret.Labels[bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeLabel] == bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeValue
+				switch secret.Labels[bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeLabel] {
+				case bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeValue, bootstrapv1beta2.WorkerTokenSecretTypeValue:
+					return true
+				}
+				return false
+			})),
+		).
+		// Airgap preload reports: a node PATCHing its result re-reconciles its
+		// KairosConfig so AirgapImagesReady follows without a requeue.
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.airgapStatusSecretToKairosConfig),
+			ctrlbuilder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return obj.GetLabels()[bootstrapv1beta2.SecretTypeLabel] == bootstrapv1beta2.AirgapStatusSecretTypeValue
 			})),
 		).
 		Watches(
 			&clusterv1.Machine{},
 			handler.EnqueueRequestsFromMapFunc(r.machineToKairosConfig),
+		).
+		// Secrets and ConfigMaps that files and manifests read through
+		// contentFrom. A source that appears wakes a KairosConfig waiting on
+		// it; a changed source re-renders the bootstrap data.
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.contentSourceToKairosConfig),
+		).
+		Watches(
+			&corev1.ConfigMap{},
+			handler.EnqueueRequestsFromMapFunc(r.contentSourceToKairosConfig),
 		)
 
 	for _, gvk := range optionalInfraWatches {
@@ -1530,7 +2207,10 @@ func (r *KairosConfigReconciler) secretToKairosConfig(ctx context.Context, o cli
 // Secret, this wakes every pending join KairosConfig immediately instead of
 // waiting for the 10s requeue.
 //
-// It enqueues all control-plane KairosConfigs for the cluster (a small set); the
+// The worker-token Secret maps the same way to the cluster's worker
+// KairosConfigs, which wait on it when they set no token of their own.
+//
+// It enqueues all control-plane (or worker) KairosConfigs for the cluster; the
 // reconcile itself is idempotent and no-ops for configs whose bootstrap data is
 // already generated, so over-enqueueing is harmless.
 func (r *KairosConfigReconciler) joinTokenSecretToKairosConfig(ctx context.Context, o client.Object) []reconcile.Request {
@@ -1538,7 +2218,13 @@ func (r *KairosConfigReconciler) joinTokenSecretToKairosConfig(ctx context.Conte
 	if !ok {
 		return nil
 	}
-	if secret.Labels[bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeLabel] != bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeValue {
+	var role string
+	switch secret.Labels[bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeLabel] {
+	case bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeValue:
+		role = "control-plane"
+	case bootstrapv1beta2.WorkerTokenSecretTypeValue:
+		role = "worker"
+	default:
 		return nil
 	}
 	clusterName := secret.Labels[clusterv1.ClusterNameLabel]
@@ -1555,7 +2241,7 @@ func (r *KairosConfigReconciler) joinTokenSecretToKairosConfig(ctx context.Conte
 	var requests []reconcile.Request
 	for i := range kcList.Items {
 		kc := &kcList.Items[i]
-		if kc.Spec.Role != "control-plane" {
+		if kc.Spec.Role != role {
 			continue
 		}
 		requests = append(requests, reconcile.Request{
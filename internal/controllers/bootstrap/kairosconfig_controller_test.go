@@ -22,6 +22,7 @@ import (
 
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -32,6 +33,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	"github.com/kairos-io/cluster-api-provider-kairos/internal/bootstrap"
 )
 
 func TestGenerateK0sCloudConfig_ControlPlaneSingleNode(t *testing.T) {
@@ -904,6 +906,50 @@ func TestGenerateK3sCloudConfig_WorkerTokenSecretRef(t *testing.T) {
 	g.Expect(cloudConfig).To(ContainSubstring("k3s-secret-token"))
 }
 
+// TestGenerateRKE2CloudConfig_Worker asserts an rke2 agent registers through
+// the supervisor port of the server address with the resolved worker token.
+func TestGenerateRKE2CloudConfig_Worker(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-token", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte("rke2-secret-token")},
+	}
+	reconciler := &KairosConfigReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build(),
+		Scheme: scheme,
+	}
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:                 "worker",
+			Distribution:         "rke2",
+			KubernetesVersion:    "v1.30.0+rke2r1",
+			WorkerTokenSecretRef: &bootstrapv1beta2.WorkerTokenSecretReference{Name: "worker-token"},
+			UserName:             "kairos",
+			UserPassword:         "kairos",
+			UserGroups:           []string{"admin"},
+		},
+	}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+
+	cloudConfig, err := reconciler.generateRKE2CloudConfig(context.Background(), log.Log, kc, machine, cluster, "worker", "https://control-plane:6443")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("server: https://control-plane:9345"))
+	g.Expect(cloudConfig).To(ContainSubstring("rke2-secret-token"))
+	g.Expect(cloudConfig).To(ContainSubstring(postBootstrapServiceName("rke2")))
+
+	kc.Spec.WorkerTokenSecretRef = nil
+	_, err = reconciler.generateRKE2CloudConfig(context.Background(), log.Log, kc, machine, cluster, "worker", "https://control-plane:6443")
+	g.Expect(err).To(MatchError(ContainSubstring("rke2 worker requires a join token")))
+}
+
 func TestGenerateK3sCloudConfig_WorkerTokenSecretMissing(t *testing.T) {
 	g := NewWithT(t)
 
@@ -964,6 +1010,96 @@ func TestGenerateK3sCloudConfig_WorkerTokenSecretMissing(t *testing.T) {
 	g.Expect(err).To(MatchError(errTokenNotReady))
 }
 
+func registriesKairosConfig(distribution, version string) *bootstrapv1beta2.KairosConfig {
+	return &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-config",
+			Namespace: "default",
+		},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "worker",
+			Distribution:      distribution,
+			KubernetesVersion: version,
+			WorkerToken:       "worker-token",
+			K3sToken:          "k3s-token",
+			UserName:          "kairos",
+			UserPassword:      "kairos",
+			UserGroups:        []string{"admin"},
+			Registries: &bootstrapv1beta2.Registries{
+				Mirrors: []bootstrapv1beta2.RegistryMirror{
+					{Registry: "docker.io", Endpoints: []string{"https://mirror.example.com"}},
+				},
+				Configs: []bootstrapv1beta2.RegistryConfig{
+					{
+						Host:          "mirror.example.com",
+						AuthSecretRef: &bootstrapv1beta2.RegistryAuthSecretReference{Name: "mirror-creds", Namespace: "registries"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestGenerateK3sCloudConfig_RegistriesResolveAuthSecret(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "mirror-creds", Namespace: "registries"},
+		Data: map[string][]byte{
+			bootstrapv1beta2.RegistryAuthUsernameKey: []byte("puller"),
+			bootstrapv1beta2.RegistryAuthPasswordKey: []byte("s3cret-registry-password"),
+		},
+	}
+	reconciler := &KairosConfigReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build(),
+		Scheme: scheme,
+	}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+
+	cloudConfig, err := reconciler.generateK3sCloudConfig(context.Background(), log.Log,
+		registriesKairosConfig("k3s", "v1.30.0+k3s.0"), machine, cluster, "worker", "https://control-plane:6443")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("/etc/rancher/k3s/registries.yaml"))
+	g.Expect(cloudConfig).To(ContainSubstring("username: puller"))
+	g.Expect(cloudConfig).To(ContainSubstring("password: s3cret-registry-password"))
+
+	cloudConfig, err = reconciler.generateK0sCloudConfig(context.Background(), log.Log,
+		registriesKairosConfig("k0s", "v1.30.0+k0s.0"), machine, cluster, "worker", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("/etc/k0s/containerd.d/10-kairos-registries.toml"))
+	g.Expect(cloudConfig).To(ContainSubstring("password = 's3cret-registry-password'"))
+}
+
+func TestGenerateK0sCloudConfig_RegistriesAuthSecretIncomplete(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "mirror-creds", Namespace: "registries"},
+		Data:       map[string][]byte{bootstrapv1beta2.RegistryAuthUsernameKey: []byte("puller")},
+	}
+	reconciler := &KairosConfigReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build(),
+		Scheme: scheme,
+	}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+
+	_, err := reconciler.generateK0sCloudConfig(context.Background(), log.Log,
+		registriesKairosConfig("k0s", "v1.30.0+k0s.0"), machine, cluster, "worker", "")
+	g.Expect(err).To(MatchError(ContainSubstring(`does not contain key "password"`)))
+}
+
 func TestGenerateK3sCloudConfig_ControlPlaneKubeVirtCapk(t *testing.T) {
 	g := NewWithT(t)
 
@@ -1306,6 +1442,7 @@ func TestGenerateK0sCloudConfig_CapvControlPlane_RendersPushBlock(t *testing.T)
 		Token:                     "test-token",
 		KubeconfigSecretName:      "test-cluster-kubeconfig",
 		KubeconfigSecretNamespace: "default",
+		CABundle:                  testResolverCA,
 	}}
 	reconciler := &KairosConfigReconciler{
 		Client:               client,
@@ -1345,6 +1482,10 @@ func TestGenerateK0sCloudConfig_CapvControlPlane_RendersPushBlock(t *testing.T)
 	// Cluster (not the resolver output), per the call-site convention.
 	g.Expect(out).To(ContainSubstring("local cluster_name='test-cluster'"))
 	g.Expect(out).To(ContainSubstring("local cp_endpoint_host='10.0.0.42'"))
+	// The resolver's CA bundle is carried through and pinned by every push call.
+	g.Expect(out).To(ContainSubstring("- path: /usr/local/etc/kairos-capi/management-ca.crt"))
+	g.Expect(out).To(ContainSubstring("curl --cacert /usr/local/etc/kairos-capi/management-ca.crt"))
+	g.Expect(out).NotTo(ContainSubstring("curl -k"))
 }
 
 // TestGenerateK0sCloudConfig_CapkWorker_NoPushBlock guards the role gate: a
@@ -1456,3 +1597,392 @@ func TestBootstrapSecretBelongsTo(t *testing.T) {
 	g.Expect(bootstrapSecretBelongsTo(secretWith("", ""), kcNoUID, clusterName)).To(BeFalse())
 	g.Expect(bootstrapSecretBelongsTo(secretWith("", clusterName), kcNoUID, clusterName)).To(BeTrue())
 }
+
+func TestGenerateK3sCloudConfig_ProxyNoProxyDefaults(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	reconciler := &KairosConfigReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "worker",
+			Distribution:      "k3s",
+			KubernetesVersion: "v1.30.0+k3s.0",
+			K3sToken:          "k3s-token",
+			UserName:          "kairos",
+			UserPassword:      "kairos",
+			UserGroups:        []string{"admin"},
+			Proxy: &bootstrapv1beta2.Proxy{
+				HTTPProxy:  "http://proxy.example.com:3128",
+				HTTPSProxy: "http://proxy.example.com:3128",
+				NoProxy:    []string{".corp.example.com", "localhost"},
+			},
+		},
+	}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: clusterv1.ClusterSpec{
+			ControlPlaneEndpoint: clusterv1.APIEndpoint{Host: "192.168.1.100", Port: 6443},
+		},
+	}
+
+	cloudConfig, err := reconciler.generateK3sCloudConfig(context.Background(), log.Log, kc, machine, cluster, "worker", "https://control-plane.example.com:6443")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("HTTPS_PROXY='http://proxy.example.com:3128'"))
+	// User entries first (deduplicated), then the built-in defaults, the k3s
+	// CIDR defaults and the control-plane endpoint hosts.
+	g.Expect(cloudConfig).To(ContainSubstring(
+		"NO_PROXY='.corp.example.com,localhost,127.0.0.1,::1,.svc,.cluster.local,10.42.0.0/16,10.43.0.0/16,192.168.1.100,control-plane.example.com'"))
+	g.Expect(cloudConfig).To(ContainSubstring("/etc/systemd/system/k3s-agent.service.d/05-kairos-proxy.conf"))
+}
+
+func TestProxyRenderData_K0sControlPlane(t *testing.T) {
+	g := NewWithT(t)
+
+	kc := &bootstrapv1beta2.KairosConfig{
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Distribution: "k0s",
+			PodCIDR:      "10.10.0.0/16",
+			Proxy:        &bootstrapv1beta2.Proxy{HTTPSProxy: "http://proxy.example.com:3128"},
+		},
+	}
+	td := &bootstrap.TemplateData{
+		ControlPlaneLBEndpoint: "10.0.0.50",
+		ManagementEndpoint:     &bootstrap.ManagementEndpoint{APIServer: "https://mgmt.example.com:6443"},
+	}
+	p := proxyRenderData(kc, nil, td)
+	g.Expect(p).NotTo(BeNil())
+	g.Expect(p.HTTPProxy).To(BeEmpty())
+	g.Expect(p.NoProxy).To(ContainElements("10.10.0.0/16", "10.96.0.0/12", "10.0.0.50", "mgmt.example.com"))
+	g.Expect(p.NoProxy).NotTo(ContainElement("10.244.0.0/16"))
+
+	kc.Spec.Proxy = nil
+	g.Expect(proxyRenderData(kc, nil, td)).To(BeNil())
+}
+
+func TestGenerateK0sCloudConfig_AirgapImages(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	reconciler := &KairosConfigReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "worker",
+			Distribution:      "k0s",
+			KubernetesVersion: "v1.30.0+k0s.0",
+			WorkerToken:       "worker-token",
+			UserName:          "kairos",
+			UserPassword:      "kairos",
+			UserGroups:        []string{"admin"},
+			AirgapImages: []bootstrapv1beta2.AirgapImageBundle{
+				{URL: "https://mirror.example.com/k0s-airgap-bundle-v1.30.0+k0s.0-amd64.tar"},
+				{Path: "/opt/airgap/extra.tar"},
+			},
+		},
+	}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+
+	cloudConfig, err := reconciler.generateK0sCloudConfig(context.Background(), log.Log, kc, machine, cluster, "worker", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("/etc/systemd/system/k0sworker.service.d/15-kairos-airgap-images.conf"))
+	g.Expect(cloudConfig).To(ContainSubstring("BUNDLE_0_SOURCE='https://mirror.example.com/k0s-airgap-bundle-v1.30.0+k0s.0-amd64.tar'"))
+	g.Expect(cloudConfig).To(ContainSubstring("BUNDLE_1_SOURCE='/opt/airgap/extra.tar'"))
+}
+
+func TestGenerateK3sCloudConfig_Network(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	reconciler := &KairosConfigReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+	mtu := int32(9000)
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "worker",
+			Distribution:      "k3s",
+			KubernetesVersion: "v1.30.0+k3s1",
+			WorkerToken:       "worker-token",
+			UserName:          "kairos",
+			UserPassword:      "kairos",
+			UserGroups:        []string{"admin"},
+			Network: &bootstrapv1beta2.Network{
+				Interfaces: []bootstrapv1beta2.NetworkInterface{{
+					Name:       "uplink0",
+					MACAddress: "AA:BB:CC:DD:EE:01",
+					NetworkAddressing: bootstrapv1beta2.NetworkAddressing{
+						Addresses: []string{"192.168.100.21/24"},
+						Gateway4:  "192.168.100.1",
+						MTU:       &mtu,
+					},
+				}},
+			},
+		},
+	}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+
+	cloudConfig, err := reconciler.generateK3sCloudConfig(context.Background(), log.Log, kc, machine, cluster, "worker", "https://10.0.0.1:6443")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("/etc/systemd/network/05-kairos-uplink0.network"))
+	g.Expect(cloudConfig).To(ContainSubstring("PermanentMACAddress=aa:bb:cc:dd:ee:01"))
+	g.Expect(cloudConfig).To(ContainSubstring("MTUBytes=9000"))
+	g.Expect(cloudConfig).To(ContainSubstring("ExecStartPre=/usr/local/bin/kairos-network-apply.sh mac:aa:bb:cc:dd:ee:01"))
+	g.Expect(networkRenderData(nil)).To(BeNil())
+}
+
+func TestGenerateK0sCloudConfig_NodeRegistration(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	reconciler := &KairosConfigReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "worker",
+			Distribution:      "k0s",
+			KubernetesVersion: "v1.30.0+k0s.0",
+			WorkerToken:       "worker-token",
+			UserName:          "kairos",
+			UserPassword:      "kairos",
+			UserGroups:        []string{"admin"},
+			NodeLabels:        map[string]string{"node.example.com/pool": "gpu"},
+			NodeTaints:        []bootstrapv1beta2.NodeTaint{{Key: "dedicated", Value: "gpu", Effect: "NoSchedule"}},
+			KubeletExtraArgs:  map[string]string{"max-pods": "200"},
+		},
+	}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+
+	cloudConfig, err := reconciler.generateK0sCloudConfig(context.Background(), log.Log, kc, machine, cluster, "worker", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("- --labels=node.example.com/pool=gpu"))
+	g.Expect(cloudConfig).To(ContainSubstring("- --taints=dedicated=gpu:NoSchedule"))
+	g.Expect(cloudConfig).To(ContainSubstring("- --kubelet-extra-args=--max-pods=200"))
+	g.Expect(kubeletRenderData(&bootstrapv1beta2.KairosConfigSpec{})).To(BeNil())
+}
+
+func TestGenerateK0sCloudConfig_K0sConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	reconciler := &KairosConfigReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "control-plane",
+			Distribution:      "k0s",
+			KubernetesVersion: "v1.30.0+k0s.0",
+			UserName:          "kairos",
+			UserPassword:      "kairos",
+			UserGroups:        []string{"admin"},
+			PodCIDR:           "10.244.0.0/16",
+			K0sConfig: &apiextensionsv1.JSON{Raw: []byte(
+				`{"network":{"provider":"calico","calico":{"mtu":1450},"kubeProxy":{"mode":"ipvs"}}}`)},
+		},
+	}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+
+	cloudConfig, err := reconciler.generateK0sCloudConfig(context.Background(), log.Log, kc, machine, cluster, "control-plane", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("- --config /etc/k0s/k0s.yaml"))
+	g.Expect(cloudConfig).To(ContainSubstring("        provider: calico\n"))
+	g.Expect(cloudConfig).To(ContainSubstring("          mtu: 1450\n"))
+	g.Expect(cloudConfig).To(ContainSubstring("          mode: ipvs\n"))
+	g.Expect(cloudConfig).To(ContainSubstring("        podCIDR: 10.244.0.0/16\n"))
+
+	fragment, err := jsonObjectRenderData(nil, "spec.k0sConfig")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(fragment).To(BeNil())
+}
+
+func TestGenerateK3sCloudConfig_K3sConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	reconciler := &KairosConfigReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "control-plane",
+			Distribution:      "k3s",
+			KubernetesVersion: "v1.30.0+k3s1",
+			UserName:          "kairos",
+			UserPassword:      "kairos",
+			UserGroups:        []string{"admin"},
+			K3sConfig: &bootstrapv1beta2.K3sConfig{
+				Server: &apiextensionsv1.JSON{Raw: []byte(`{"disable":["traefik","servicelb"],"etcd-snapshot-retention":10}`)},
+				Agent:  &apiextensionsv1.JSON{Raw: []byte(`{"kube-proxy-arg":["proxy-mode=ipvs"]}`)},
+			},
+		},
+	}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+
+	cloudConfig, err := reconciler.generateK3sCloudConfig(context.Background(), log.Log, kc, machine, cluster, "control-plane", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("- path: /etc/rancher/k3s/config.yaml.d/93-kairos-k3s.yaml"))
+	g.Expect(cloudConfig).To(ContainSubstring("      disable:\n          - traefik\n          - servicelb\n"))
+	g.Expect(cloudConfig).To(ContainSubstring("      etcd-snapshot-retention: 10\n"))
+	g.Expect(cloudConfig).To(ContainSubstring("      kube-proxy-arg:\n          - proxy-mode=ipvs\n"))
+
+	k3sConfig, err := k3sConfigRenderData(&bootstrapv1beta2.K3sConfig{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(k3sConfig).To(BeNil())
+}
+
+// TestGenerateCloudConfig_ControlPlaneCNI asserts spec.controlPlaneCNI
+// reaches both renderers: the k0s network.provider and the k3s flannel
+// drop-in, each with the chart resource in the Manifests path.
+func TestGenerateCloudConfig_ControlPlaneCNI(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	reconciler := &KairosConfigReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme: scheme,
+	}
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "control-plane",
+			Distribution:      "k0s",
+			KubernetesVersion: "v1.30.0+k0s.0",
+			UserName:          "kairos",
+			UserPassword:      "kairos",
+			UserGroups:        []string{"admin"},
+			ControlPlaneCNI:   &bootstrapv1beta2.ControlPlaneCNI{Provider: "cilium"},
+		},
+	}
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+
+	cloudConfig, err := reconciler.generateK0sCloudConfig(context.Background(), log.Log, kc, machine, cluster, "control-plane", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("        provider: custom\n"))
+	g.Expect(cloudConfig).To(ContainSubstring("/var/lib/k0s/manifests/kairos-cni/cilium.yaml"))
+
+	kc.Spec.Distribution = "k3s"
+	kc.Spec.KubernetesVersion = "v1.30.0+k3s1"
+	kc.Spec.ControlPlaneCNI.Provider = "calico"
+	cloudConfig, err = reconciler.generateK3sCloudConfig(context.Background(), log.Log, kc, machine, cluster, "control-plane", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).To(ContainSubstring("- path: /etc/rancher/k3s/config.yaml.d/92-kairos-cni.yaml"))
+	g.Expect(cloudConfig).To(ContainSubstring("      flannel-backend: none\n"))
+	g.Expect(cloudConfig).To(ContainSubstring("/var/lib/rancher/k3s/server/manifests/kairos-cni/calico.yaml"))
+
+	g.Expect(cniRenderData(nil)).To(BeNil())
+}
+
+// TestResolveUserPassword_Hashed asserts plaintext from either source is
+// hashed before rendering, a pre-hashed Secret value is used as is, and the
+// rendered cloud-config never carries the plaintext.
+func TestResolveUserPassword_Hashed(t *testing.T) {
+	g := NewWithT(t)
+	const preHashed = "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"
+	r := tokenReconciler(g,
+		tokenSecret("plain", "default", "password", "s3cret-passw0rd"),
+		tokenSecret("hashed", "default", "password", preHashed),
+	)
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-config", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "control-plane",
+			Distribution:      "k0s",
+			KubernetesVersion: "v1.30.0+k0s.0",
+			UserName:          "kairos",
+			UserPassword:      "s3cret-passw0rd",
+			UserGroups:        []string{"admin"},
+		},
+	}
+
+	got, err := r.resolveUserPassword(context.Background(), kc)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(got).To(HavePrefix("$6$"))
+	g.Expect(bootstrap.IsPasswordHash(got)).To(BeTrue())
+
+	kc.Spec.UserPasswordSecretRef = &bootstrapv1beta2.UserPasswordSecretReference{Name: "plain", Key: "password"}
+	got, err = r.resolveUserPassword(context.Background(), kc)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(got).To(HavePrefix("$6$"))
+
+	kc.Spec.UserPasswordSecretRef.Name = "hashed"
+	got, err = r.resolveUserPassword(context.Background(), kc)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(got).To(Equal(preHashed))
+
+	kc.Spec.UserPasswordSecretRef = nil
+	machine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "test-machine", Namespace: "default"}}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	cloudConfig, err := r.generateK0sCloudConfig(context.Background(), log.Log, kc, machine, cluster, "control-plane", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).NotTo(ContainSubstring("s3cret-passw0rd"))
+	g.Expect(cloudConfig).To(MatchRegexp(`passwd: "?\$6\$[./0-9A-Za-z]{16}\$[./0-9A-Za-z]{86}"?\n`))
+
+	kc.Spec.UserPassword = ""
+	kc.Spec.SSHPublicKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+	cloudConfig, err = r.generateK0sCloudConfig(context.Background(), log.Log, kc, machine, cluster, "control-plane", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cloudConfig).NotTo(ContainSubstring("passwd:"))
+}
+
+func TestHasPlaintextPassword(t *testing.T) {
+	g := NewWithT(t)
+	secret := func(value string) *corev1.Secret {
+		return &corev1.Secret{Data: map[string][]byte{"value": []byte(value)}}
+	}
+	g.Expect(hasPlaintextPassword(secret("#cloud-config\nusers:\n- name: kairos\n  passwd: \"kairos\"\n"))).To(BeTrue())
+	g.Expect(hasPlaintextPassword(secret("#cloud-config\nusers:\n- name: kairos\n  passwd: \"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1\"\n- name: capk\n"))).To(BeFalse())
+	g.Expect(hasPlaintextPassword(secret("#cloud-config\nusers:\n- name: kairos\n  ssh_authorized_keys: [\"github:octocat\"]\n"))).To(BeFalse())
+	g.Expect(hasPlaintextPassword(secret("not: [yaml"))).To(BeFalse())
+}
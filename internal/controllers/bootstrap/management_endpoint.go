@@ -49,6 +49,11 @@ type ManagementEndpoint struct {
 	// into (ADR 0005 Phase 3). Stamped by the bootstrap controller only for k0s
 	// init control-plane renders; the renderer's twin drives the push block.
 	JoinTokenSecretName string
+	// CABundle is the PEM CA bundle the node verifies the management
+	// apiserver's serving certificate against (curl --cacert). Resolvers
+	// must always return it: the rendered push calls never skip TLS
+	// verification.
+	CABundle string
 }
 
 // ManagementEndpointResolver materialises the management-cluster contact info
@@ -57,7 +62,8 @@ type ManagementEndpoint struct {
 //   - Mint or look up an authenticated token whose RBAC reach is the bare
 //     minimum required to push the kubeconfig Secret (and read VMI status,
 //     under CAPK, for the SAN-detection script).
-//   - Compute the management API URL the node should call back to.
+//   - Compute the management API URL the node should call back to, and the
+//     CA bundle the node verifies that URL's serving certificate against.
 //   - Pick the (namespace, name) of the kubeconfig Secret to write.
 //
 // Returning (nil, nil) is the documented "disabled" signal — used by the
@@ -18,13 +18,17 @@ package bootstrap
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
+	"os"
 
 	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -68,8 +72,26 @@ type kubeVirtTokenResolver struct {
 	// wiring pulls this from mgr.GetConfig().Host at SetupWithManager time.
 	// Empty string is the disabled-resolver signal.
 	ManagementAPIServer string
+
+	// CABundle is the PEM CA bundle nodes verify ManagementAPIServer against.
+	// Production wiring loads it from the manager's rest.Config at startup
+	// (ManagementCABundleFromRESTConfig). Used when CASecretRef is nil.
+	CABundle []byte
+
+	// CASecretRef, when set, names a Secret whose ManagementCASecretKey entry
+	// is the CA bundle instead of CABundle. Needed when nodes reach the
+	// management apiserver through an endpoint that presents a different
+	// chain than the in-cluster one (KAIROS_MANAGEMENT_API_OVERRIDE behind a
+	// TLS-terminating proxy). Read on every Resolve so a rotated CA is picked
+	// up on the next render.
+	CASecretRef *types.NamespacedName
 }
 
+// ManagementCASecretKey is the data key read from the Secret named by
+// kubeVirtTokenResolver.CASecretRef. Matches the key kube-root-ca.crt and
+// cert-manager use for CA material.
+const ManagementCASecretKey = "ca.crt"
+
 // Resolve performs the same idempotent SA/Role/RoleBinding upsert as the
 // removed KairosConfigReconciler.ensureKubeconfigPushConfig and mints a fresh
 // 24h serviceaccount token via the TokenRequest subresource API.
@@ -91,6 +113,13 @@ func (r *kubeVirtTokenResolver) Resolve(ctx context.Context, kc *bootstrapv1beta
 		return nil, nil
 	}
 
+	// Resolve the CA before touching RBAC: without it the node cannot verify
+	// the management apiserver, and the push must not be rendered at all.
+	caBundle, err := r.resolveCABundle(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	secretName := fmt.Sprintf("%s-kubeconfig", cluster.Name)
 	saName := kubeconfigWriterName(cluster.Name)
 
@@ -113,7 +142,7 @@ func (r *kubeVirtTokenResolver) Resolve(ctx context.Context, kc *bootstrapv1beta
 			Namespace: cluster.Namespace,
 		},
 	}
-	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, serviceAccount, func() error {
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, serviceAccount, func() error {
 		if serviceAccount.Labels == nil {
 			serviceAccount.Labels = map[string]string{}
 		}
@@ -185,6 +214,14 @@ func (r *kubeVirtTokenResolver) Resolve(ctx context.Context, kc *bootstrapv1beta
 		// only; deliberate, bounded widening, identical in shape to the join-token
 		// grant. Non-HA clusters never create the Secret, so the grant is inert.
 		etcdStatusSecretName := bootstrapv1beta2.EtcdStatusSecretName(cluster.Name)
+		// The k0s init node also PATCHes the first worker join token into the
+		// controller-created, KCP-owned worker-token Secret. Same shape: named
+		// Secret, no create.
+		workerTokenSecretName := bootstrapv1beta2.WorkerTokenSecretName(cluster.Name)
+		// Control-plane nodes with spec.airgapImages PATCH their preload result
+		// into the per-cluster airgap-status Secret. Same shape: named Secret,
+		// no create (the bootstrap controller pre-creates it).
+		airgapStatusSecretName := bootstrapv1beta2.AirgapStatusSecretName(cluster.Name)
 		role.Rules = []rbacv1.PolicyRule{
 			{
 				APIGroups: []string{""},
@@ -194,7 +231,7 @@ func (r *kubeVirtTokenResolver) Resolve(ctx context.Context, kc *bootstrapv1beta
 			{
 				APIGroups:     []string{""},
 				Resources:     []string{"secrets"},
-				ResourceNames: []string{secretName, joinTokenSecretName, etcdStatusSecretName},
+				ResourceNames: []string{secretName, joinTokenSecretName, workerTokenSecretName, etcdStatusSecretName, airgapStatusSecretName},
 				Verbs:         []string{"get", "update", "patch"},
 			},
 		}
@@ -283,9 +320,54 @@ func (r *kubeVirtTokenResolver) Resolve(ctx context.Context, kc *bootstrapv1beta
 		APIServer:                 r.ManagementAPIServer,
 		KubeconfigSecretName:      secretName,
 		KubeconfigSecretNamespace: cluster.Namespace,
+		CABundle:                  string(caBundle),
 	}, nil
 }
 
+// resolveCABundle returns the management CA bundle from CASecretRef when set,
+// otherwise from CABundle. An empty or non-PEM bundle is an error: the node
+// would otherwise have nothing to verify the management apiserver against.
+func (r *kubeVirtTokenResolver) resolveCABundle(ctx context.Context) ([]byte, error) {
+	bundle := r.CABundle
+	source := "the manager's REST config"
+	if r.CASecretRef != nil {
+		secret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, *r.CASecretRef, secret); err != nil {
+			return nil, fmt.Errorf("failed to get management CA secret %s: %w", r.CASecretRef, err)
+		}
+		bundle = secret.Data[ManagementCASecretKey]
+		source = fmt.Sprintf("secret %s key %q", r.CASecretRef, ManagementCASecretKey)
+	}
+	if len(bundle) == 0 {
+		return nil, fmt.Errorf("no management CA bundle available from %s; refusing to render an unverified node push", source)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("management CA bundle from %s contains no PEM certificates", source)
+	}
+	return bundle, nil
+}
+
+// ManagementCABundleFromRESTConfig returns the CA bundle the manager itself
+// uses to trust the management apiserver: CAData when inlined, otherwise the
+// contents of CAFile (the in-cluster service-account CA). Returns nil when the
+// config carries neither.
+func ManagementCABundleFromRESTConfig(cfg *rest.Config) ([]byte, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if len(cfg.CAData) > 0 {
+		return cfg.CAData, nil
+	}
+	if cfg.CAFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(cfg.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read management CA file %s: %w", cfg.CAFile, err)
+	}
+	return data, nil
+}
+
 // Compile-time guard that kubeVirtTokenResolver satisfies the interface.
 var _ ManagementEndpointResolver = (*kubeVirtTokenResolver)(nil)
 
@@ -293,11 +375,13 @@ var _ ManagementEndpointResolver = (*kubeVirtTokenResolver)(nil)
 // controller-runtime client's SubResource method directly. main.go calls this
 // at manager startup; tests in this package construct the struct literally
 // with a fake SubResource client.
-func NewKubeVirtTokenResolver(c client.Client, scheme *runtime.Scheme, mgmtAPIServer string) ManagementEndpointResolver {
+func NewKubeVirtTokenResolver(c client.Client, scheme *runtime.Scheme, mgmtAPIServer string, caBundle []byte, caSecretRef *types.NamespacedName) ManagementEndpointResolver {
 	return &kubeVirtTokenResolver{
 		Client:              c,
 		SubResource:         c.SubResource,
 		Scheme:              scheme,
 		ManagementAPIServer: mgmtAPIServer,
+		CABundle:            caBundle,
+		CASecretRef:         caSecretRef,
 	}
 }
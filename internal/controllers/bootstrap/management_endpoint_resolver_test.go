@@ -19,6 +19,8 @@ package bootstrap
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -29,6 +31,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -77,6 +80,21 @@ func (f *fakeSubResourceClient) Patch(_ context.Context, _ client.Object, _ clie
 	return errors.New("fakeSubResourceClient.Patch not implemented")
 }
 
+// testResolverCA is a throwaway self-signed CA (no private key kept) standing
+// in for the management apiserver CA.
+const testResolverCA = `-----BEGIN CERTIFICATE-----
+MIIBpjCCAUugAwIBAgIUfqKfXXpb0DKtbl6yQbvc2llPW5wwCgYIKoZIzj0EAwIw
+JzElMCMGA1UEAwwca2Fpcm9zLWNhcGktdGVzdC1yZXNvbHZlci1jYTAgFw0yNjEw
+MTgwODM0MzBaGA8yMTI2MDkyNDA4MzQzMFowJzElMCMGA1UEAwwca2Fpcm9zLWNh
+cGktdGVzdC1yZXNvbHZlci1jYTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABPh0
+/BGMxZtEKQC5wXjhQqQOIX3F55hlj1ZnZbMc0h2MfkiW8Ijx+7ClGy8MY/hEmZoS
+j2d20J7gm3f1ZiR9RfqjUzBRMB0GA1UdDgQWBBTLdnLVAf3oKMIJXZW8iuL9kneV
+0DAfBgNVHSMEGDAWgBTLdnLVAf3oKMIJXZW8iuL9kneV0DAPBgNVHRMBAf8EBTAD
+AQH/MAoGCCqGSM49BAMCA0kAMEYCIQChoOCJGJCRvFrGaq7oLsiqDWX15Ay8psul
+N8V1cRFqUQIhAID4TAP96VS+w+w9FX+yPvAb5LCPCQYUZm5ojHxQgsyf
+-----END CERTIFICATE-----
+`
+
 func newResolverScheme(t *testing.T) *runtime.Scheme {
 	t.Helper()
 	g := NewWithT(t)
@@ -110,6 +128,7 @@ func newResolverFixture(scheme *runtime.Scheme, sub *fakeSubResourceClient, mgmt
 		SubResource:         func(string) client.SubResourceClient { return sub },
 		Scheme:              scheme,
 		ManagementAPIServer: mgmtAPI,
+		CABundle:            []byte(testResolverCA),
 	}
 	return r, kc, cluster
 }
@@ -458,6 +477,54 @@ func TestResolve_GrantsEtcdStatusSecret(t *testing.T) {
 	g.Expect(roleGrantsNamedSecret(role, etcdName, "create")).To(BeFalse(), "node SA must NOT create the etcd-status Secret (controller pre-creates it)")
 }
 
+// TestResolve_GrantsWorkerTokenSecret asserts the node SA may get/update/patch
+// (and NOT create) the per-cluster worker-token Secret the k0s init node
+// pushes the first worker join token into.
+func TestResolve_GrantsWorkerTokenSecret(t *testing.T) {
+	g := NewWithT(t)
+	scheme := newResolverScheme(t)
+	sub := &fakeSubResourceClient{token: "tok"}
+	r, kc, cluster := newResolverFixture(scheme, sub, "https://mgmt:6443")
+	kc.Spec.Role = "control-plane"
+	kc.Spec.Distribution = "k0s"
+
+	_, err := r.Resolve(context.Background(), kc, cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	role := &rbacv1.Role{}
+	saName := kubeconfigWriterName("test-cluster")
+	g.Expect(r.Client.Get(context.Background(), types.NamespacedName{Name: saName, Namespace: "default"}, role)).To(Succeed())
+
+	name := bootstrapv1beta2.WorkerTokenSecretName("test-cluster")
+	for _, verb := range []string{"get", "update", "patch"} {
+		g.Expect(roleGrantsNamedSecret(role, name, verb)).To(BeTrue(), "node SA must %s the worker-token Secret", verb)
+	}
+	g.Expect(roleGrantsNamedSecret(role, name, "create")).To(BeFalse(), "node SA must NOT create the worker-token Secret (controller pre-creates it)")
+}
+
+// TestResolve_GrantsAirgapStatusSecret asserts the node SA may get/update/patch
+// (and NOT create) the per-cluster airgap-status Secret control-plane nodes
+// report their airgap preload result into.
+func TestResolve_GrantsAirgapStatusSecret(t *testing.T) {
+	g := NewWithT(t)
+	scheme := newResolverScheme(t)
+	sub := &fakeSubResourceClient{token: "tok"}
+	r, kc, cluster := newResolverFixture(scheme, sub, "https://mgmt:6443")
+	kc.Spec.Role = "control-plane"
+
+	_, err := r.Resolve(context.Background(), kc, cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	role := &rbacv1.Role{}
+	g.Expect(r.Client.Get(context.Background(), types.NamespacedName{Name: kubeconfigWriterName("test-cluster"), Namespace: "default"}, role)).To(Succeed())
+
+	name := bootstrapv1beta2.AirgapStatusSecretName("test-cluster")
+	for _, verb := range []string{"get", "update", "patch"} {
+		g.Expect(roleGrantsNamedSecret(role, name, verb)).To(BeTrue(), "node SA must %s the airgap-status Secret", verb)
+	}
+	g.Expect(roleGrantsNamedSecret(role, name, "create")).To(BeFalse(), "node SA must NOT create the airgap-status Secret (controller pre-creates it)")
+}
+
 // roleGrantsNamedSecret reports whether the Role grants the given verb on the
 // named core Secret via a resourceNames-scoped rule (the create rule carries no
 // resourceNames, so a create check only matches a named-create rule — which we
@@ -502,3 +569,82 @@ func roleGrantsNamedSecret(role *rbacv1.Role, name, verb string) bool {
 	}
 	return false
 }
+
+// TestResolve_ReturnsCABundle asserts the resolver hands the node the CA it
+// must verify the management apiserver with, from the REST config by default
+// and from CASecretRef when configured.
+func TestResolve_ReturnsCABundle(t *testing.T) {
+	g := NewWithT(t)
+	scheme := newResolverScheme(t)
+	sub := &fakeSubResourceClient{token: "tok-abc"}
+	r, kc, cluster := newResolverFixture(scheme, sub, "https://mgmt:6443")
+
+	got, err := r.Resolve(context.Background(), kc, cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(got.CABundle).To(Equal(testResolverCA))
+
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "mgmt-ca", Namespace: "kairos-system"},
+		Data:       map[string][]byte{ManagementCASecretKey: []byte(testResolverCA + testResolverCA)},
+	}
+	r, kc, cluster = newResolverFixture(scheme, sub, "https://mgmt:6443", caSecret)
+	r.CABundle = nil
+	r.CASecretRef = &types.NamespacedName{Namespace: "kairos-system", Name: "mgmt-ca"}
+	got, err = r.Resolve(context.Background(), kc, cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(got.CABundle).To(Equal(testResolverCA + testResolverCA))
+}
+
+// TestResolve_NoCABundle_FailsClosed asserts a missing or malformed CA is an
+// error raised before any RBAC or token is created: the node push is never
+// rendered without something to verify the management apiserver against.
+func TestResolve_NoCABundle_FailsClosed(t *testing.T) {
+	cases := []struct {
+		name   string
+		mutate func(r *kubeVirtTokenResolver)
+	}{
+		{"empty REST config CA", func(r *kubeVirtTokenResolver) { r.CABundle = nil }},
+		{"non-PEM CA", func(r *kubeVirtTokenResolver) { r.CABundle = []byte("not a certificate") }},
+		{"CA secret missing", func(r *kubeVirtTokenResolver) {
+			r.CASecretRef = &types.NamespacedName{Namespace: "kairos-system", Name: "absent"}
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			scheme := newResolverScheme(t)
+			sub := &fakeSubResourceClient{token: "tok-abc"}
+			r, kc, cluster := newResolverFixture(scheme, sub, "https://mgmt:6443")
+			tc.mutate(r)
+
+			got, err := r.Resolve(context.Background(), kc, cluster)
+			g.Expect(err).To(HaveOccurred())
+			g.Expect(got).To(BeNil())
+			g.Expect(sub.createCalls).To(Equal(0))
+			sa := &corev1.ServiceAccount{}
+			err = r.Client.Get(context.Background(), types.NamespacedName{Name: kubeconfigWriterName("test-cluster"), Namespace: "default"}, sa)
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	}
+}
+
+func TestManagementCABundleFromRESTConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	got, err := ManagementCABundleFromRESTConfig(&rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: []byte(testResolverCA)}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(got)).To(Equal(testResolverCA))
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	g.Expect(os.WriteFile(caFile, []byte(testResolverCA), 0o600)).To(Succeed())
+	got, err = ManagementCABundleFromRESTConfig(&rest.Config{TLSClientConfig: rest.TLSClientConfig{CAFile: caFile}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(got)).To(Equal(testResolverCA))
+
+	got, err = ManagementCABundleFromRESTConfig(&rest.Config{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(got).To(BeNil())
+
+	_, err = ManagementCABundleFromRESTConfig(&rest.Config{TLSClientConfig: rest.TLSClientConfig{CAFile: filepath.Join(t.TempDir(), "missing")}})
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+)
+
+// errControlPlaneEndpointNotReady signals that a worker needs the control-plane
+// address, spec.serverAddress is empty and the Cluster has no
+// controlPlaneEndpoint yet. reconcileBootstrapData waits on it with the
+// WaitingForControlPlaneInitialization reason.
+var errControlPlaneEndpointNotReady = errors.New("cluster control plane endpoint not set")
+
+// defaultAPIServerPort is the API server port of k0s, k3s and rke2. It is used
+// when the Cluster's controlPlaneEndpoint carries a host but no port.
+const defaultAPIServerPort = 6443
+
+// endpointServerAddress returns the API server URL of the Cluster's
+// controlPlaneEndpoint, or "" while the infrastructure or control-plane
+// provider has not set its host.
+func endpointServerAddress(cluster *clusterv1.Cluster) string {
+	if cluster == nil || cluster.Spec.ControlPlaneEndpoint.Host == "" {
+		return ""
+	}
+	port := int(cluster.Spec.ControlPlaneEndpoint.Port)
+	if port == 0 {
+		port = defaultAPIServerPort
+	}
+	return "https://" + net.JoinHostPort(cluster.Spec.ControlPlaneEndpoint.Host, strconv.Itoa(port))
+}
+
+// resolveServerAddress returns the API server URL nodes join: spec.serverAddress
+// when set, else the Cluster's controlPlaneEndpoint.
+func resolveServerAddress(kairosConfig *bootstrapv1beta2.KairosConfig, cluster *clusterv1.Cluster) string {
+	if kairosConfig.Spec.ServerAddress != "" {
+		return kairosConfig.Spec.ServerAddress
+	}
+	return endpointServerAddress(cluster)
+}
+
+// joinsByServerAddress reports whether the rendered bootstrap data of a node
+// with this role and distribution points at the server address. k0s workers
+// take the address from their join token instead.
+func joinsByServerAddress(role, distribution string) bool {
+	return role == "worker" && (distribution == "k3s" || distribution == "rke2")
+}
+
+// setServerAddressMatched records whether an explicit spec.serverAddress points
+// at the Cluster's controlPlaneEndpoint. A mismatch is usually a stale VIP or
+// load-balancer address, but it may be deliberate (a proxy in front of the
+// API), so the condition is informational and never gates bootstrap readiness.
+// It is removed when there is nothing to compare.
+func setServerAddressMatched(kairosConfig *bootstrapv1beta2.KairosConfig, cluster *clusterv1.Cluster, role, distribution string) {
+	explicit := kairosConfig.Spec.ServerAddress
+	derived := endpointServerAddress(cluster)
+	if !joinsByServerAddress(role, distribution) || explicit == "" || derived == "" {
+		conditions.Delete(kairosConfig, bootstrapv1beta2.ServerAddressMatchedCondition)
+		return
+	}
+	if serverAddressesMatch(explicit, derived) {
+		conditions.MarkTrue(kairosConfig, bootstrapv1beta2.ServerAddressMatchedCondition)
+		return
+	}
+	conditions.MarkFalse(kairosConfig, bootstrapv1beta2.ServerAddressMatchedCondition,
+		bootstrapv1beta2.ServerAddressMismatchReason, clusterv1.ConditionSeverityWarning,
+		"spec.serverAddress %s does not match the Cluster controlPlaneEndpoint %s", explicit, derived)
+}
+
+// serverAddressesMatch compares the host and port of two server URLs. The host
+// is compared case-insensitively; a URL without a port uses its scheme's
+// default. Unparseable input never matches.
+func serverAddressesMatch(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil || ua.Hostname() == "" {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil || ub.Hostname() == "" {
+		return false
+	}
+	return strings.EqualFold(ua.Hostname(), ub.Hostname()) && urlPort(ua) == urlPort(ub)
+}
+
+// urlPort returns the explicit port of u, or the default port of its scheme.
+func urlPort(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	if u.Scheme == "http" {
+		return "80"
+	}
+	return "443"
+}
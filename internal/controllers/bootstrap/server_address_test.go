@@ -0,0 +1,172 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+)
+
+func TestResolveServerAddress(t *testing.T) {
+	cases := []struct {
+		name     string
+		explicit string
+		endpoint clusterv1.APIEndpoint
+		want     string
+	}{
+		{name: "endpoint with port", endpoint: clusterv1.APIEndpoint{Host: "10.0.0.1", Port: 6443}, want: "https://10.0.0.1:6443"},
+		{name: "load balancer port", endpoint: clusterv1.APIEndpoint{Host: "lb.example.com", Port: 443}, want: "https://lb.example.com:443"},
+		{name: "endpoint without port uses the distribution default", endpoint: clusterv1.APIEndpoint{Host: "10.0.0.1"}, want: "https://10.0.0.1:6443"},
+		{name: "IPv6 endpoint", endpoint: clusterv1.APIEndpoint{Host: "fd00::1", Port: 6443}, want: "https://[fd00::1]:6443"},
+		{name: "explicit address wins", explicit: "https://10.0.0.9:6443", endpoint: clusterv1.APIEndpoint{Host: "10.0.0.1", Port: 6443}, want: "https://10.0.0.9:6443"},
+		{name: "no endpoint yet", want: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			kc := &bootstrapv1beta2.KairosConfig{Spec: bootstrapv1beta2.KairosConfigSpec{ServerAddress: tc.explicit}}
+			cluster := &clusterv1.Cluster{Spec: clusterv1.ClusterSpec{ControlPlaneEndpoint: tc.endpoint}}
+			g.Expect(resolveServerAddress(kc, cluster)).To(Equal(tc.want))
+		})
+	}
+}
+
+func TestSetServerAddressMatched(t *testing.T) {
+	endpoint := clusterv1.APIEndpoint{Host: "10.0.0.1", Port: 6443}
+	cases := []struct {
+		name         string
+		role         string
+		distribution string
+		explicit     string
+		endpoint     clusterv1.APIEndpoint
+		wantStatus   corev1.ConditionStatus
+		wantReason   string
+	}{
+		{name: "same host and port", role: "worker", distribution: "k3s", explicit: "https://10.0.0.1:6443", endpoint: endpoint, wantStatus: corev1.ConditionTrue},
+		{name: "host differs only in case", role: "worker", distribution: "rke2", explicit: "https://CP.example.com:6443", endpoint: clusterv1.APIEndpoint{Host: "cp.example.com", Port: 6443}, wantStatus: corev1.ConditionTrue},
+		{name: "stale VIP", role: "worker", distribution: "k3s", explicit: "https://10.0.0.9:6443", endpoint: endpoint, wantStatus: corev1.ConditionFalse, wantReason: bootstrapv1beta2.ServerAddressMismatchReason},
+		{name: "port differs", role: "worker", distribution: "k3s", explicit: "https://10.0.0.1", endpoint: endpoint, wantStatus: corev1.ConditionFalse, wantReason: bootstrapv1beta2.ServerAddressMismatchReason},
+		{name: "no explicit address", role: "worker", distribution: "k3s", endpoint: endpoint},
+		{name: "no endpoint", role: "worker", distribution: "k3s", explicit: "https://10.0.0.9:6443"},
+		{name: "k0s workers join through their token", role: "worker", distribution: "k0s", explicit: "https://10.0.0.9:6443", endpoint: endpoint},
+		{name: "control planes do not join the address", role: "control-plane", distribution: "k3s", explicit: "https://10.0.0.9:6443", endpoint: endpoint},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			kc := &bootstrapv1beta2.KairosConfig{Spec: bootstrapv1beta2.KairosConfigSpec{ServerAddress: tc.explicit}}
+			conditions.MarkTrue(kc, bootstrapv1beta2.ServerAddressMatchedCondition)
+			cluster := &clusterv1.Cluster{Spec: clusterv1.ClusterSpec{ControlPlaneEndpoint: tc.endpoint}}
+
+			setServerAddressMatched(kc, cluster, tc.role, tc.distribution)
+
+			c := conditions.Get(kc, bootstrapv1beta2.ServerAddressMatchedCondition)
+			if tc.wantStatus == "" {
+				g.Expect(c).To(BeNil())
+				return
+			}
+			g.Expect(c).NotTo(BeNil())
+			g.Expect(c.Status).To(Equal(tc.wantStatus))
+			g.Expect(c.Reason).To(Equal(tc.wantReason))
+			if tc.wantReason != "" {
+				g.Expect(c.Severity).To(Equal(clusterv1.ConditionSeverityWarning))
+			}
+		})
+	}
+}
+
+// TestReconcile_WorkerWaitsForControlPlaneEndpoint: a k3s worker without
+// spec.serverAddress waits with WaitingForControlPlaneInitialization until the
+// Cluster has an endpoint, then joins that endpoint on the default port.
+func TestReconcile_WorkerWaitsForControlPlaneEndpoint(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	scheme := newBootstrapTestScheme(t)
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-machine",
+			Namespace: "default",
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: "test-cluster"},
+		},
+		Spec: clusterv1.MachineSpec{ClusterName: "test-cluster"},
+	}
+	kairosConfig := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "worker-config",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(machine, clusterv1.GroupVersion.WithKind("Machine")),
+			},
+		},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Role:              "worker",
+			Distribution:      "k3s",
+			KubernetesVersion: "v1.30.0+k3s.0",
+			K3sToken:          "k3s-token",
+			UserName:          "kairos",
+			UserPassword:      "kairos",
+			UserGroups:        []string{"admin"},
+		},
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(cluster, machine, kairosConfig).
+		WithStatusSubresource(&bootstrapv1beta2.KairosConfig{}).
+		Build()
+	r := &KairosConfigReconciler{Client: c, Scheme: scheme}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "worker-config", Namespace: "default"}}
+
+	res, err := r.Reconcile(ctx, req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+
+	got := &bootstrapv1beta2.KairosConfig{}
+	g.Expect(c.Get(ctx, req.NamespacedName, got)).To(Succeed())
+	g.Expect(got.Status.DataSecretName).To(BeNil())
+	g.Expect(got.Status.FailureReason).To(BeEmpty())
+	cond := conditions.Get(got, bootstrapv1beta2.BootstrapReadyCondition)
+	g.Expect(cond).NotTo(BeNil())
+	g.Expect(cond.Reason).To(Equal(bootstrapv1beta2.WaitingForControlPlaneInitializationReason))
+	g.Expect(cond.Severity).To(Equal(clusterv1.ConditionSeverityInfo))
+
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: "test-cluster", Namespace: "default"}, cluster)).To(Succeed())
+	cluster.Spec.ControlPlaneEndpoint = clusterv1.APIEndpoint{Host: "10.0.0.42"}
+	g.Expect(c.Update(ctx, cluster)).To(Succeed())
+
+	_, err = r.Reconcile(ctx, req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(c.Get(ctx, req.NamespacedName, got)).To(Succeed())
+	g.Expect(conditions.IsTrue(got, bootstrapv1beta2.BootstrapReadyCondition)).To(BeTrue())
+	g.Expect(got.Status.DataSecretName).NotTo(BeNil())
+
+	secret := &corev1.Secret{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: *got.Status.DataSecretName, Namespace: "default"}, secret)).To(Succeed())
+	g.Expect(string(secret.Data["value"])).To(ContainSubstring("--server https://10.0.0.42:6443"))
+}
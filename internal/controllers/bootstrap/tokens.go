@@ -28,10 +28,10 @@ import (
 	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
 )
 
-// tokenKind selects which precedence chain resolveToken walks. The two chains
-// are NOT identical: the k3s worker path prefers the k3s-specific ref/inline
+// tokenKind selects which precedence chain resolveToken walks. The chains are
+// NOT identical: the k3s worker path prefers the k3s-specific ref/inline
 // fields before falling through to the generic worker/legacy fields, whereas
-// the k0s worker path starts at the generic worker fields. resolveToken
+// the k0s and rke2 worker paths start at the generic worker fields. resolveToken
 // preserves each chain's historical precedence verbatim (this is a pure
 // refactor of the open-coded blocks that used to live in generateK0sCloudConfig
 // / generateK3sCloudConfig — controllers/CLAUDE.md § "resolveToken").
@@ -39,14 +39,21 @@ type tokenKind int
 
 const (
 	// tokenKindK0sWorker resolves a k0s worker join token.
-	// Precedence: WorkerTokenSecretRef > WorkerToken > TokenSecretRef > Token.
+	// Precedence: WorkerTokenSecretRef > WorkerToken > TokenSecretRef > Token >
+	// the KairosControlPlane-managed <cluster>-worker-token Secret.
 	tokenKindK0sWorker tokenKind = iota
 
 	// tokenKindK3sWorker resolves a k3s worker/server join token.
 	// Precedence: K3sTokenSecretRef > K3sToken > WorkerTokenSecretRef >
-	// WorkerToken > TokenSecretRef > Token.
+	// WorkerToken > TokenSecretRef > Token > the KairosControlPlane-managed
+	// <cluster>-worker-token Secret.
 	tokenKindK3sWorker
 
+	// tokenKindRKE2Worker resolves an rke2 agent join token. rke2 has no
+	// distribution-specific token fields.
+	// Precedence: WorkerTokenSecretRef > WorkerToken > TokenSecretRef > Token.
+	tokenKindRKE2Worker
+
 	// tokenKindControlPlaneJoin resolves the control-plane join token used by an
 	// HA join node (ADR 0005 Phase 3). It is ONLY sourced from a *SecretRef —
 	// never an inline spec field (TOKEN-INV / api CLAUDE.md § "No new
@@ -55,6 +62,8 @@ const (
 	//   - k0s: ControlPlaneJoinTokenSecretRef (the controller-join token the
 	//     init node minted via `k0s token create` and pushed back over the
 	//     node-push channel).
+	//   - rke2: ControlPlaneJoinTokenSecretRef (the controller-generated shared
+	//     server token).
 	// A missing referenced Secret returns errTokenNotReady so the caller
 	// requeues until the token Secret exists, rather than failing hard.
 	//
@@ -91,8 +100,10 @@ func (r *KairosConfigReconciler) resolveToken(ctx context.Context, kind tokenKin
 		if kc.Spec.K3sToken != "" {
 			return kc.Spec.K3sToken, nil
 		}
-		return r.resolveWorkerToken(ctx, kc, cluster)
+		return r.resolveManagedWorkerToken(ctx, kc, cluster)
 	case tokenKindK0sWorker:
+		return r.resolveManagedWorkerToken(ctx, kc, cluster)
+	case tokenKindRKE2Worker:
 		return r.resolveWorkerToken(ctx, kc, cluster)
 	default:
 		return "", fmt.Errorf("unknown token kind %d", kind)
@@ -101,7 +112,7 @@ func (r *KairosConfigReconciler) resolveToken(ctx context.Context, kind tokenKin
 
 // resolveWorkerToken walks the shared worker/legacy precedence tail:
 // WorkerTokenSecretRef > WorkerToken > TokenSecretRef > Token. It is the
-// common suffix of both the k0s and k3s worker chains.
+// common suffix of the k0s, k3s and rke2 worker chains.
 func (r *KairosConfigReconciler) resolveWorkerToken(ctx context.Context, kc *bootstrapv1beta2.KairosConfig, cluster *clusterv1.Cluster) (string, error) {
 	switch {
 	case kc.Spec.WorkerTokenSecretRef != nil:
@@ -116,9 +127,28 @@ func (r *KairosConfigReconciler) resolveWorkerToken(ctx context.Context, kc *boo
 	return "", nil
 }
 
+// resolveManagedWorkerToken walks the shared worker/legacy tail and, when the
+// KairosConfig sets no token at all, falls back to the worker-token Secret the
+// cluster's KairosControlPlane mints and rotates. The fallback is limited to
+// KairosControlPlane clusters, which are the only ones that create the Secret;
+// until its token is published it resolves to errTokenNotReady.
+func (r *KairosConfigReconciler) resolveManagedWorkerToken(ctx context.Context, kc *bootstrapv1beta2.KairosConfig, cluster *clusterv1.Cluster) (string, error) {
+	tok, err := r.resolveWorkerToken(ctx, kc, cluster)
+	if err != nil || tok != "" || cluster == nil {
+		return tok, err
+	}
+	if ref := cluster.Spec.ControlPlaneRef; ref == nil || ref.Kind != "KairosControlPlane" {
+		return "", nil
+	}
+	ref := &bootstrapv1beta2.WorkerTokenSecretReference{Name: bootstrapv1beta2.WorkerTokenSecretName(cluster.Name)}
+	return r.tokenFromWorkerRef(ctx, cluster.Namespace, ref, "worker token")
+}
+
 // tokenFromWorkerRef reads a WorkerTokenSecretReference-shaped ref. The Secret's
 // namespace defaults to the KairosConfig namespace; the data key defaults to
-// "token". A 404 surfaces as errTokenNotReady (requeue); a present-but-keyless
+// "token". A 404 surfaces as errTokenNotReady (requeue), and so does an empty
+// or keyless Secret the KairosControlPlane controller created for a token that
+// is published later (the k0s join and worker tokens); any other keyless
 // Secret is a hard error. label is a human-readable noun for error messages
 // ("worker token" / "k3s token") and is the only thing logged — never the
 // resolved value.
@@ -142,12 +172,26 @@ func (r *KairosConfigReconciler) tokenFromWorkerRef(ctx context.Context, default
 		key = "token"
 	}
 	tokenData, ok := secret.Data[key]
+	if len(tokenData) == 0 && awaitsPublishedToken(secret) {
+		return "", errTokenNotReady
+	}
 	if !ok {
 		return "", fmt.Errorf("%s secret %s/%s does not contain key '%s'", label, secretKey.Namespace, secretKey.Name, key)
 	}
 	return string(tokenData), nil
 }
 
+// awaitsPublishedToken reports whether secret is a controller-created token
+// Secret, which stays empty until a node or the hosted control-plane pod
+// publishes the token into it.
+func awaitsPublishedToken(secret *corev1.Secret) bool {
+	switch secret.Labels[bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeLabel] {
+	case bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeValue, bootstrapv1beta2.WorkerTokenSecretTypeValue:
+		return true
+	}
+	return false
+}
+
 // tokenFromLegacyRef reads the legacy TokenSecretRef (a bare
 // corev1.ObjectReference). It is resolved in the cluster namespace and accepts
 // either a "token" or "value" data key, preserving the pre-refactor behavior.
@@ -176,7 +220,8 @@ func (r *KairosConfigReconciler) tokenFromLegacyRef(ctx context.Context, namespa
 // distribution-appropriate *SecretRef (TOKEN-INV: *SecretRef only, never
 // inline). k3s uses K3sTokenSecretRef (the controller-generated shared server
 // token); k0s uses ControlPlaneJoinTokenSecretRef (the init-node-minted
-// controller-join token pushed back over the node-push channel). A missing
+// controller-join token pushed back over the node-push channel), and so does
+// rke2, where it holds the controller-generated shared server token. A missing
 // Secret returns errTokenNotReady so the caller requeues until the token lands.
 //
 // The k0s arm (ControlPlaneJoinTokenSecretRef) is wired in the API/controller
@@ -197,6 +242,11 @@ func (r *KairosConfigReconciler) resolveControlPlaneJoinToken(ctx context.Contex
 			return "", errTokenNotReady
 		}
 		return r.tokenFromWorkerRef(ctx, kc.Namespace, kc.Spec.ControlPlaneJoinTokenSecretRef, "k0s control-plane join token")
+	case "rke2":
+		if kc.Spec.ControlPlaneJoinTokenSecretRef == nil {
+			return "", errTokenNotReady
+		}
+		return r.tokenFromWorkerRef(ctx, kc.Namespace, kc.Spec.ControlPlaneJoinTokenSecretRef, "rke2 control-plane join token")
 	default:
 		return "", fmt.Errorf("unsupported distribution for control-plane join token: %s", distribution)
 	}
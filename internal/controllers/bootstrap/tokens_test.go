@@ -121,6 +121,25 @@ func TestResolveToken_K0sWorkerPrecedence(t *testing.T) {
 	}
 }
 
+// TestResolveToken_RKE2WorkerIgnoresK3sFields asserts the rke2 worker chain is
+// the shared worker/legacy tail: the k3s-specific fields are not consulted.
+func TestResolveToken_RKE2WorkerIgnoresK3sFields(t *testing.T) {
+	g := NewWithT(t)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default"}}
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "kc", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			Distribution: "rke2",
+			K3sToken:     "k3s-inline",
+			WorkerToken:  "inline-worker",
+		},
+	}
+	r := tokenReconciler(g)
+	got, err := r.resolveToken(context.Background(), tokenKindRKE2Worker, kc, cluster)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(got).To(Equal("inline-worker"))
+}
+
 // TestResolveToken_K3sWorkerPrecedence asserts the k3s worker chain prefers the
 // k3s-specific fields ahead of the shared worker/legacy tail.
 func TestResolveToken_K3sWorkerPrecedence(t *testing.T) {
@@ -214,6 +233,16 @@ func TestResolveToken_ControlPlaneJoin(t *testing.T) {
 			objs: []client.Object{tokenSecret("cp-join", "default", "token", "k0s-controller-token")},
 			want: "k0s-controller-token",
 		},
+		{
+			name: "rke2 resolves shared server token from ControlPlaneJoinTokenSecretRef",
+			spec: bootstrapv1beta2.KairosConfigSpec{
+				Distribution:                   "rke2",
+				ControlPlaneJoinTokenSecretRef: &bootstrapv1beta2.WorkerTokenSecretReference{Name: "cp-join"},
+				K3sTokenSecretRef:              &bootstrapv1beta2.WorkerTokenSecretReference{Name: "ignored"},
+			},
+			objs: []client.Object{tokenSecret("cp-join", "default", "token", "rke2-server-token")},
+			want: "rke2-server-token",
+		},
 		{
 			name:  "k0s with no ref requeues",
 			spec:  bootstrapv1beta2.KairosConfigSpec{Distribution: "k0s"},
@@ -262,3 +291,124 @@ func TestResolveToken_KeylessSecretIsHardError(t *testing.T) {
 	g.Expect(err).To(HaveOccurred())
 	g.Expect(err).ToNot(MatchError(errTokenNotReady))
 }
+
+// TestResolveToken_UnpublishedWorkerTokenRequeues asserts that the empty
+// worker-token Secret a hosted KairosControlPlane creates is a requeue, not a
+// hard error, until its pod publishes the token.
+func TestResolveToken_UnpublishedWorkerTokenRequeues(t *testing.T) {
+	g := NewWithT(t)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default"}}
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "kc", Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigSpec{
+			WorkerTokenSecretRef: &bootstrapv1beta2.WorkerTokenSecretReference{Name: bootstrapv1beta2.WorkerTokenSecretName("c")},
+		},
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      bootstrapv1beta2.WorkerTokenSecretName("c"),
+		Namespace: "default",
+		Labels:    map[string]string{bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeLabel: bootstrapv1beta2.WorkerTokenSecretTypeValue},
+	}}
+	r := tokenReconciler(g, secret)
+	_, err := r.resolveToken(context.Background(), tokenKindK0sWorker, kc, cluster)
+	g.Expect(err).To(MatchError(errTokenNotReady))
+
+	secret.Data = map[string][]byte{"token": []byte("published")}
+	g.Expect(r.Update(context.Background(), secret)).To(Succeed())
+	tok, err := r.resolveToken(context.Background(), tokenKindK0sWorker, kc, cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(tok).To(Equal("published"))
+}
+
+// TestResolveToken_FallsBackToManagedWorkerToken asserts that k0s and k3s
+// workers with no token configured use the worker-token Secret their
+// KairosControlPlane mints, and that clusters without a KairosControlPlane
+// keep resolving to no token.
+func TestResolveToken_FallsBackToManagedWorkerToken(t *testing.T) {
+	kcpCluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default"},
+		Spec: clusterv1.ClusterSpec{
+			ControlPlaneRef: &corev1.ObjectReference{Kind: "KairosControlPlane", Name: "kcp", Namespace: "default"},
+		},
+	}
+	otherCluster := kcpCluster.DeepCopy()
+	otherCluster.Spec.ControlPlaneRef.Kind = "KubeadmControlPlane"
+
+	workerTokenSecret := func(token string) *corev1.Secret {
+		s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      bootstrapv1beta2.WorkerTokenSecretName("c"),
+			Namespace: "default",
+			Labels:    map[string]string{bootstrapv1beta2.ControlPlaneJoinTokenSecretTypeLabel: bootstrapv1beta2.WorkerTokenSecretTypeValue},
+		}}
+		if token != "" {
+			s.Data = map[string][]byte{"token": []byte(token)}
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		kind    tokenKind
+		spec    bootstrapv1beta2.KairosConfigSpec
+		cluster *clusterv1.Cluster
+		objs    []client.Object
+		want    string
+		errIs   error
+	}{
+		{
+			name:    "k0s worker uses the minted token",
+			kind:    tokenKindK0sWorker,
+			cluster: kcpCluster,
+			objs:    []client.Object{workerTokenSecret("minted")},
+			want:    "minted",
+		},
+		{
+			name:    "k3s worker uses the minted token",
+			kind:    tokenKindK3sWorker,
+			spec:    bootstrapv1beta2.KairosConfigSpec{Role: "worker"},
+			cluster: kcpCluster,
+			objs:    []client.Object{workerTokenSecret("minted")},
+			want:    "minted",
+		},
+		{
+			name:    "unminted token requeues",
+			kind:    tokenKindK0sWorker,
+			cluster: kcpCluster,
+			objs:    []client.Object{workerTokenSecret("")},
+			errIs:   errTokenNotReady,
+		},
+		{
+			name:    "explicit token wins over the minted one",
+			kind:    tokenKindK0sWorker,
+			spec:    bootstrapv1beta2.KairosConfigSpec{WorkerToken: "inline-worker"},
+			cluster: kcpCluster,
+			objs:    []client.Object{workerTokenSecret("minted")},
+			want:    "inline-worker",
+		},
+		{
+			name:    "no fallback without a KairosControlPlane",
+			kind:    tokenKindK0sWorker,
+			cluster: otherCluster,
+			objs:    []client.Object{workerTokenSecret("minted")},
+			want:    "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			kc := &bootstrapv1beta2.KairosConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "kc", Namespace: "default"},
+				Spec:       tc.spec,
+			}
+			r := tokenReconciler(g, tc.objs...)
+			got, err := r.resolveToken(context.Background(), tc.kind, kc, tc.cluster)
+			if tc.errIs != nil {
+				g.Expect(err).To(MatchError(tc.errIs))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tc.want))
+		})
+	}
+}
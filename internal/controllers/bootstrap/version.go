@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"k8s.io/apimachinery/pkg/util/version"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	"github.com/kairos-io/cluster-api-provider-kairos/internal/bootstrap"
+)
+
+// distributionReleaseRenderData converts the API DistributionRelease into the
+// renderer's flat twin (the renderer stays free of API types). Nil in, nil out.
+func distributionReleaseRenderData(r *bootstrapv1beta2.DistributionRelease) *bootstrap.DistributionReleaseConfig {
+	if r == nil {
+		return nil
+	}
+	return &bootstrap.DistributionReleaseConfig{
+		Image:      r.Image,
+		Path:       r.Path,
+		URL:        r.URL,
+		SHA256:     r.SHA256,
+		OnMismatch: string(r.OnMismatch),
+	}
+}
+
+// setKubernetesVersionMatched records whether the kubelet on the Machine's Node
+// runs the Kubernetes version requested by spec.kubernetesVersion. The node-side
+// version gate is what enforces the pin; this condition is the management-side
+// view of the outcome and never gates bootstrap readiness.
+//
+// Only major.minor.patch is compared: kubelets report the upstream version with
+// a distribution suffix that differs from the release tag (k0s release
+// v1.34.1+k0s.1 runs kubelet v1.34.1+k0s; k3s v1.33.5+k3s1 runs v1.33.5+k3s1).
+func setKubernetesVersionMatched(kairosConfig *bootstrapv1beta2.KairosConfig, machine *clusterv1.Machine) {
+	want := kairosConfig.Spec.KubernetesVersion
+	if want == "" {
+		conditions.Delete(kairosConfig, bootstrapv1beta2.KubernetesVersionMatchedCondition)
+		return
+	}
+	if machine == nil || machine.Status.NodeInfo == nil || machine.Status.NodeInfo.KubeletVersion == "" {
+		conditions.MarkFalse(kairosConfig, bootstrapv1beta2.KubernetesVersionMatchedCondition,
+			bootstrapv1beta2.WaitingForNodeInfoReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for the Node to report its kubelet version")
+		return
+	}
+	have := machine.Status.NodeInfo.KubeletVersion
+	if kubernetesVersionsMatch(want, have) {
+		conditions.MarkTrue(kairosConfig, bootstrapv1beta2.KubernetesVersionMatchedCondition)
+		return
+	}
+	conditions.MarkFalse(kairosConfig, bootstrapv1beta2.KubernetesVersionMatchedCondition,
+		bootstrapv1beta2.KubernetesVersionMismatchReason, clusterv1.ConditionSeverityWarning,
+		"Node runs kubelet %s, spec.kubernetesVersion is %s", have, want)
+}
+
+// kubernetesVersionsMatch compares the major.minor.patch of two version
+// strings, ignoring pre-release and build metadata. Unparseable input never
+// matches.
+func kubernetesVersionsMatch(want, have string) bool {
+	w, err := version.ParseGeneric(want)
+	if err != nil {
+		return false
+	}
+	h, err := version.ParseGeneric(have)
+	if err != nil {
+		return false
+	}
+	return w.Major() == h.Major() && w.Minor() == h.Minor() && w.Patch() == h.Patch()
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+)
+
+func TestSetKubernetesVersionMatched(t *testing.T) {
+	cases := []struct {
+		name       string
+		want       string
+		kubelet    string
+		noNodeInfo bool
+		wantStatus corev1.ConditionStatus
+		wantReason string
+	}{
+		{name: "k0s release vs kubelet suffix", want: "v1.34.1+k0s.1", kubelet: "v1.34.1+k0s", wantStatus: corev1.ConditionTrue},
+		{name: "k3s exact", want: "v1.33.5+k3s1", kubelet: "v1.33.5+k3s1", wantStatus: corev1.ConditionTrue},
+		{name: "bare version", want: "1.33.5", kubelet: "v1.33.5+k3s1", wantStatus: corev1.ConditionTrue},
+		{name: "patch mismatch", want: "v1.34.2+k0s.0", kubelet: "v1.34.1+k0s", wantStatus: corev1.ConditionFalse, wantReason: bootstrapv1beta2.KubernetesVersionMismatchReason},
+		{name: "no node info yet", want: "v1.34.1+k0s.1", noNodeInfo: true, wantStatus: corev1.ConditionFalse, wantReason: bootstrapv1beta2.WaitingForNodeInfoReason},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			kc := &bootstrapv1beta2.KairosConfig{Spec: bootstrapv1beta2.KairosConfigSpec{KubernetesVersion: tc.want}}
+			machine := &clusterv1.Machine{}
+			if !tc.noNodeInfo {
+				machine.Status.NodeInfo = &corev1.NodeSystemInfo{KubeletVersion: tc.kubelet}
+			}
+
+			setKubernetesVersionMatched(kc, machine)
+
+			c := conditions.Get(kc, bootstrapv1beta2.KubernetesVersionMatchedCondition)
+			g.Expect(c).NotTo(BeNil())
+			g.Expect(c.Status).To(Equal(tc.wantStatus))
+			g.Expect(c.Reason).To(Equal(tc.wantReason))
+		})
+	}
+}
+
+func TestSetKubernetesVersionMatched_NeverGatesReady(t *testing.T) {
+	g := NewWithT(t)
+	kc := &bootstrapv1beta2.KairosConfig{Spec: bootstrapv1beta2.KairosConfigSpec{KubernetesVersion: "v1.34.2+k0s.0"}}
+	conditions.MarkTrue(kc, clusterv1.ReadyCondition)
+	machine := &clusterv1.Machine{Status: clusterv1.MachineStatus{NodeInfo: &corev1.NodeSystemInfo{KubeletVersion: "v1.30.0"}}}
+
+	setKubernetesVersionMatched(kc, machine)
+
+	g.Expect(conditions.IsFalse(kc, bootstrapv1beta2.KubernetesVersionMatchedCondition)).To(BeTrue())
+	g.Expect(conditions.IsTrue(kc, clusterv1.ReadyCondition)).To(BeTrue())
+}
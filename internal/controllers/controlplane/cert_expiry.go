@@ -0,0 +1,322 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+const (
+	// certExpiryStatusSecretName / -Namespace name the workload-cluster Secret
+	// each control-plane node's kairos-cert-expiry unit writes its own report
+	// key into, with the node's local admin kubeconfig.
+	certExpiryStatusSecretName      = "kairos-cert-expiry-status"
+	certExpiryStatusSecretNamespace = "kube-system"
+
+	// certExpiryStatusRequeueAfter is how often the reports are re-read. The
+	// nodes report twice a day and the workload Secret is not watched.
+	certExpiryStatusRequeueAfter = time.Hour
+
+	// kubeconfigCertificateName is the CertificateExpiry name of the client
+	// certificate embedded in the <cluster>-kubeconfig Secret.
+	kubeconfigCertificateName = "kubeconfig"
+)
+
+// certExpiryReport is one node's latest certificate scan as written by the
+// node-side reporter.
+type certExpiryReport struct {
+	Node         string                  `json:"node"`
+	Time         string                  `json:"time"`
+	Success      bool                    `json:"success"`
+	Message      string                  `json:"message"`
+	Certificates []certificateExpiryItem `json:"certificates"`
+}
+
+type certificateExpiryItem struct {
+	Name     string `json:"name"`
+	NotAfter string `json:"notAfter"`
+}
+
+// readCertificateExpiryStatus loads the per-node reports from the
+// workload-cluster certificate expiry Secret. A missing Secret (no node has
+// reported yet) is an empty map; malformed keys are skipped.
+func readCertificateExpiryStatus(ctx context.Context, wc client.Client) (map[string]certExpiryReport, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: certExpiryStatusSecretNamespace, Name: certExpiryStatusSecretName}
+	if err := wc.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return map[string]certExpiryReport{}, nil
+		}
+		return nil, fmt.Errorf("read certificate expiry status secret %s: %w", key, err)
+	}
+	out := make(map[string]certExpiryReport, len(secret.Data))
+	for node, raw := range secret.Data {
+		var rep certExpiryReport
+		if err := json.Unmarshal(raw, &rep); err != nil {
+			continue
+		}
+		out[node] = rep
+	}
+	return out, nil
+}
+
+// earliestReportedCertificate returns the report's certificate that expires
+// first. Entries without a parseable notAfter are ignored.
+func earliestReportedCertificate(node string, rep certExpiryReport) *controlplanev1beta2.CertificateExpiry {
+	var earliest *controlplanev1beta2.CertificateExpiry
+	for _, c := range rep.Certificates {
+		t, err := time.Parse(time.RFC3339, c.NotAfter)
+		if err != nil || c.Name == "" {
+			continue
+		}
+		if earliest == nil || t.Before(earliest.NotAfter.Time) {
+			earliest = &controlplanev1beta2.CertificateExpiry{Name: c.Name, NodeName: node, NotAfter: metav1.NewTime(t)}
+		}
+	}
+	return earliest
+}
+
+// kubeconfigClientCertificateExpiry returns the expiry of the client
+// certificate of the current context in the <cluster>-kubeconfig Secret, or
+// nil when the Secret is missing or authenticates some other way.
+func (r *KairosControlPlaneReconciler) kubeconfigClientCertificateExpiry(ctx context.Context, cluster *clusterv1.Cluster) (*controlplanev1beta2.CertificateExpiry, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: fmt.Sprintf("%s-kubeconfig", cluster.Name)}
+	if err := r.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get workload kubeconfig secret %s: %w", key, err)
+	}
+	cert, err := kubeconfigClientCertificate(secret.Data["value"])
+	if err != nil {
+		return nil, fmt.Errorf("workload kubeconfig %s: %w", key, err)
+	}
+	if cert == nil {
+		return nil, nil
+	}
+	return &controlplanev1beta2.CertificateExpiry{Name: kubeconfigCertificateName, NotAfter: metav1.NewTime(cert.NotAfter)}, nil
+}
+
+// setCertificateExpiry surfaces the node certificate reports and the
+// kubeconfig client certificate as status.earliestCertificateExpiry and
+// CertificatesExpiringSoonCondition, and stamps each current machine's
+// earliest expiry in clusterv1.MachineCertificatesExpiryDateAnnotation, which
+// machineUpToDate compares against spec.rolloutBefore. The kubeconfig
+// certificate is charged to the oldest machine: every control-plane node
+// pushes a fresh kubeconfig when it bootstraps, so replacing any of them
+// renews it. Only reports from the Nodes of current control-plane machines
+// count. Best-effort like setEtcdBackupStatus: a workload client or read
+// error leaves the status unchanged. It returns when to re-read the reports.
+func (r *KairosControlPlaneReconciler) setCertificateExpiry(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) time.Duration {
+	if !kcp.Status.Initialized {
+		conditions.MarkUnknown(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition,
+			controlplanev1beta2.WaitingForCertificateExpiryReportsReason,
+			"Waiting for the control plane to initialize")
+		return 0
+	}
+
+	machines, err := r.getControlPlaneMachines(ctx, kcp, cluster)
+	if err != nil {
+		log.V(4).Info("Cannot list control plane machines for certificate expiry", "error", err)
+		return certExpiryStatusRequeueAfter
+	}
+	factory := r.WorkloadClientFactory
+	if factory == nil {
+		factory = r.defaultWorkloadClient
+	}
+	wc, err := factory(ctx, cluster)
+	if err != nil {
+		log.V(4).Info("Cannot build workload client for certificate expiry", "error", err)
+		return certExpiryStatusRequeueAfter
+	}
+	reports, err := readCertificateExpiryStatus(ctx, wc)
+	if err != nil {
+		log.V(4).Info("Cannot read certificate expiry status", "error", err)
+		return certExpiryStatusRequeueAfter
+	}
+	kubeconfigCert, err := r.kubeconfigClientCertificateExpiry(ctx, cluster)
+	if err != nil {
+		log.V(4).Info("Cannot read the kubeconfig client certificate", "error", err)
+	}
+
+	live := make([]*clusterv1.Machine, 0, len(machines))
+	for _, m := range machines {
+		if m.Status.NodeRef != nil && m.DeletionTimestamp.IsZero() {
+			live = append(live, m)
+		}
+	}
+	sort.SliceStable(live, func(i, j int) bool {
+		if !live[i].CreationTimestamp.Equal(&live[j].CreationTimestamp) {
+			return live[i].CreationTimestamp.Before(&live[j].CreationTimestamp)
+		}
+		return live[i].Name < live[j].Name
+	})
+
+	earliest := kubeconfigCert
+	reported := 0
+	var failed []string
+	for i, m := range live {
+		var machineEarliest *controlplanev1beta2.CertificateExpiry
+		if rep, ok := reports[m.Status.NodeRef.Name]; ok {
+			if rep.Success {
+				reported++
+				machineEarliest = earliestReportedCertificate(m.Status.NodeRef.Name, rep)
+			} else {
+				failed = append(failed, fmt.Sprintf("%s: %s", m.Status.NodeRef.Name, rep.Message))
+			}
+		}
+		if machineEarliest != nil && (earliest == nil || machineEarliest.NotAfter.Before(&earliest.NotAfter)) {
+			earliest = machineEarliest
+		}
+		if i == 0 && kubeconfigCert != nil && (machineEarliest == nil || kubeconfigCert.NotAfter.Before(&machineEarliest.NotAfter)) {
+			machineEarliest = kubeconfigCert
+		}
+		if machineEarliest != nil {
+			if err := r.stampCertificatesExpiry(ctx, m, machineEarliest.NotAfter.Time); err != nil {
+				log.V(4).Info("Cannot stamp certificate expiry on machine", "machine", m.Name, "error", err)
+			}
+		}
+	}
+	kcp.Status.EarliestCertificateExpiry = earliest
+
+	window := time.Duration(certificatesExpiringSoonDays(kcp)) * 24 * time.Hour
+	switch {
+	case earliest != nil && !earliest.NotAfter.After(time.Now().Add(window)):
+		conditions.MarkTrueWithNegativePolarity(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition,
+			controlplanev1beta2.CertificatesExpiringReason, clusterv1.ConditionSeverityWarning,
+			"%s expires at %s", describeCertificate(earliest), earliest.NotAfter.UTC().Format(time.RFC3339))
+	case reported == 0 && len(failed) > 0:
+		sort.Strings(failed)
+		conditions.MarkUnknown(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition,
+			controlplanev1beta2.WaitingForCertificateExpiryReportsReason,
+			"Certificate expiry report failed on %s", strings.Join(failed, "; "))
+	case reported == 0:
+		conditions.MarkUnknown(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition,
+			controlplanev1beta2.WaitingForCertificateExpiryReportsReason,
+			"No control-plane node has reported its certificates yet")
+	default:
+		conditions.MarkFalseWithNegativePolarity(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition)
+	}
+	return certExpiryStatusRequeueAfter
+}
+
+// setHostedCertificateExpiry is setCertificateExpiry for a hosted control
+// plane. There are no Machines and no node reports, so the kubeconfig client
+// certificate, which ensureHostedKubeconfig renews hostedAdminClientRenewBefore
+// ahead of expiry, is the only one tracked. The condition therefore only
+// turns True when that renewal keeps failing. It returns when to check again,
+// which also schedules the renewal.
+func (r *KairosControlPlaneReconciler) setHostedCertificateExpiry(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) time.Duration {
+	if !kcp.Status.Initialized {
+		conditions.MarkUnknown(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition,
+			controlplanev1beta2.WaitingForCertificateExpiryReportsReason,
+			"Waiting for the control plane to initialize")
+		return certExpiryStatusRequeueAfter
+	}
+	kubeconfigCert, err := r.kubeconfigClientCertificateExpiry(ctx, cluster)
+	if err != nil {
+		log.V(4).Info("Cannot read the kubeconfig client certificate", "error", err)
+		return certExpiryStatusRequeueAfter
+	}
+	kcp.Status.EarliestCertificateExpiry = kubeconfigCert
+
+	window := time.Duration(certificatesExpiringSoonDays(kcp)) * 24 * time.Hour
+	switch {
+	case kubeconfigCert == nil:
+		conditions.MarkUnknown(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition,
+			controlplanev1beta2.WaitingForCertificateExpiryReportsReason,
+			"The kubeconfig Secret has no client certificate yet")
+	case !kubeconfigCert.NotAfter.After(time.Now().Add(window)):
+		conditions.MarkTrueWithNegativePolarity(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition,
+			controlplanev1beta2.CertificatesExpiringReason, clusterv1.ConditionSeverityWarning,
+			"%s expires at %s", describeCertificate(kubeconfigCert), kubeconfigCert.NotAfter.UTC().Format(time.RFC3339))
+	default:
+		conditions.MarkFalseWithNegativePolarity(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition)
+	}
+	return certExpiryStatusRequeueAfter
+}
+
+// stampCertificatesExpiry records notAfter on the Machine, patching only when
+// the value changes.
+func (r *KairosControlPlaneReconciler) stampCertificatesExpiry(ctx context.Context, m *clusterv1.Machine, notAfter time.Time) error {
+	value := notAfter.UTC().Format(time.RFC3339)
+	if m.Annotations[clusterv1.MachineCertificatesExpiryDateAnnotation] == value {
+		return nil
+	}
+	patch := client.MergeFrom(m.DeepCopy())
+	if m.Annotations == nil {
+		m.Annotations = map[string]string{}
+	}
+	m.Annotations[clusterv1.MachineCertificatesExpiryDateAnnotation] = value
+	return r.Patch(ctx, m, patch)
+}
+
+// certificatesExpiringSoonDays is the CertificatesExpiringSoon warning window:
+// DefaultCertificatesExpiringSoonDays, or the rollout window when larger, so
+// the condition is raised no later than the rollout starts.
+func certificatesExpiringSoonDays(kcp *controlplanev1beta2.KairosControlPlane) int32 {
+	days := int32(controlplanev1beta2.DefaultCertificatesExpiringSoonDays)
+	if rb := kcp.Spec.RolloutBefore; rb != nil && rb.CertificatesExpiryDays != nil && *rb.CertificatesExpiryDays > days {
+		days = *rb.CertificatesExpiryDays
+	}
+	return days
+}
+
+// describeCertificate names a certificate for condition messages.
+func describeCertificate(c *controlplanev1beta2.CertificateExpiry) string {
+	if c.NodeName == "" {
+		return "The kubeconfig client certificate"
+	}
+	return fmt.Sprintf("Certificate %s on %s", c.Name, c.NodeName)
+}
+
+// certificatesExpiring reports whether spec.rolloutBefore asks for the
+// machine to be replaced because its recorded certificate expiry falls within
+// the window. Machines without a recorded expiry never are.
+func certificatesExpiring(machine *clusterv1.Machine, kcp *controlplanev1beta2.KairosControlPlane, now time.Time) bool {
+	rb := kcp.Spec.RolloutBefore
+	if rb == nil || rb.CertificatesExpiryDays == nil {
+		return false
+	}
+	value, ok := machine.Annotations[clusterv1.MachineCertificatesExpiryDateAnnotation]
+	if !ok {
+		return false
+	}
+	notAfter, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return false
+	}
+	window := time.Duration(*rb.CertificatesExpiryDays) * 24 * time.Hour
+	return !notAfter.After(now.Add(window))
+}
@@ -0,0 +1,303 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+func certExpiryKCP() *controlplanev1beta2.KairosControlPlane {
+	kcp := k0sKCP()
+	kcp.Status.Initialized = true
+	return kcp
+}
+
+func certExpiryStatusSecret(data map[string]string) *corev1.Secret {
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: certExpiryStatusSecretName, Namespace: certExpiryStatusSecretNamespace},
+		Data:       map[string][]byte{},
+	}
+	for k, v := range data {
+		s.Data[k] = []byte(v)
+	}
+	return s
+}
+
+// certReport renders a successful node report whose certificates expire the
+// given durations from now.
+func certReport(node string, expiries map[string]time.Duration) string {
+	certs := ""
+	for name, d := range expiries {
+		if certs != "" {
+			certs += ","
+		}
+		certs += fmt.Sprintf(`{"name":%q,"notAfter":%q}`, name, time.Now().Add(d).UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf(`{"node":%q,"time":"2026-01-02T02:00:00Z","success":true,"certificates":[%s]}`, node, certs)
+}
+
+const day = 24 * time.Hour
+
+func TestSetCertificateExpiry(t *testing.T) {
+	failA := `{"node":"node-a","time":"2026-01-02T02:00:00Z","success":false,"message":"openssl is not available","certificates":[]}`
+
+	for _, tc := range []struct {
+		name         string
+		secret       *corev1.Secret
+		wantStatus   corev1.ConditionStatus
+		wantReason   string
+		wantEarliest string
+		wantNode     string
+	}{
+		{"no reports yet", nil, corev1.ConditionUnknown, controlplanev1beta2.WaitingForCertificateExpiryReportsReason, "", ""},
+		{"every report failed", certExpiryStatusSecret(map[string]string{"node-a": failA}), corev1.ConditionUnknown, controlplanev1beta2.WaitingForCertificateExpiryReportsReason, "", ""},
+		{"earliest across nodes", certExpiryStatusSecret(map[string]string{
+			"node-a": certReport("node-a", map[string]time.Duration{"server.crt": 300 * day, "etcd/server.crt": 200 * day}),
+			"node-b": certReport("node-b", map[string]time.Duration{"server.crt": 250 * day}),
+		}), corev1.ConditionFalse, "", "etcd/server.crt", "node-a"},
+		{"expiring within the warning window", certExpiryStatusSecret(map[string]string{
+			"node-a": certReport("node-a", map[string]time.Duration{"server.crt": 300 * day}),
+			"node-b": certReport("node-b", map[string]time.Duration{"admin.crt": 10 * day}),
+		}), corev1.ConditionTrue, controlplanev1beta2.CertificatesExpiringReason, "admin.crt", "node-b"},
+		{"removed node ignored", certExpiryStatusSecret(map[string]string{
+			"node-a": certReport("node-a", map[string]time.Duration{"server.crt": 300 * day}),
+			"node-x": certReport("node-x", map[string]time.Duration{"server.crt": day}),
+		}), corev1.ConditionFalse, "", "server.crt", "node-a"},
+		{"malformed report skipped", certExpiryStatusSecret(map[string]string{
+			"node-a": certReport("node-a", map[string]time.Duration{"server.crt": 300 * day}),
+			"node-b": "{",
+		}), corev1.ConditionFalse, "", "server.crt", "node-a"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			scheme := haTestScheme(g)
+			kcp := certExpiryKCP()
+			c := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(ownedCPMachine("cp-0", "node-a"), ownedCPMachine("cp-1", "node-b")).Build()
+			wb := fake.NewClientBuilder().WithScheme(scheme)
+			if tc.secret != nil {
+				wb = wb.WithObjects(tc.secret)
+			}
+			r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme, WorkloadClientFactory: staticWorkloadClient(wb.Build())}
+
+			g.Expect(r.setCertificateExpiry(context.Background(), log.Log, kcp, testCluster())).To(Equal(certExpiryStatusRequeueAfter))
+
+			cond := conditions.Get(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition)
+			g.Expect(cond).NotTo(BeNil())
+			g.Expect(cond.Status).To(Equal(tc.wantStatus))
+			g.Expect(cond.Reason).To(Equal(tc.wantReason))
+			if tc.wantStatus == corev1.ConditionTrue {
+				g.Expect(cond.Severity).To(Equal(clusterv1.ConditionSeverityWarning))
+			}
+			if tc.wantEarliest == "" {
+				g.Expect(kcp.Status.EarliestCertificateExpiry).To(BeNil())
+				return
+			}
+			g.Expect(kcp.Status.EarliestCertificateExpiry).NotTo(BeNil())
+			g.Expect(kcp.Status.EarliestCertificateExpiry.Name).To(Equal(tc.wantEarliest))
+			g.Expect(kcp.Status.EarliestCertificateExpiry.NodeName).To(Equal(tc.wantNode))
+		})
+	}
+}
+
+// TestSetCertificateExpiry_StampsMachines: each machine carries its node's
+// earliest expiry, and the oldest one also the kubeconfig client certificate
+// when that expires first.
+func TestSetCertificateExpiry_StampsMachines(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	scheme := haTestScheme(g)
+	kcp := certExpiryKCP()
+	cluster := testCluster()
+
+	caCert, caKey, err := generateHostedCA(cluster.Name)
+	g.Expect(err).NotTo(HaveOccurred())
+	kubeconfig, err := hostedAdminKubeconfig(cluster.Name, "https://10.0.0.1:6443", caCert, caKey)
+	g.Expect(err).NotTo(HaveOccurred())
+	kubeconfigSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: cluster.Name + "-kubeconfig", Namespace: cluster.Namespace},
+		Data:       map[string][]byte{"value": kubeconfig},
+	}
+
+	older, newer := ownedCPMachine("cp-1", "node-b"), ownedCPMachine("cp-0", "node-a")
+	older.CreationTimestamp = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	newer.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(older, newer, kubeconfigSecret).Build()
+	wc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(certExpiryStatusSecret(map[string]string{
+		"node-a": certReport("node-a", map[string]time.Duration{"server.crt": 500 * day}),
+		"node-b": certReport("node-b", map[string]time.Duration{"server.crt": 400 * day}),
+	})).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme, WorkloadClientFactory: staticWorkloadClient(wc)}
+
+	r.setCertificateExpiry(ctx, log.Log, kcp, cluster)
+
+	// The kubeconfig certificate (365d) expires before either node's.
+	g.Expect(kcp.Status.EarliestCertificateExpiry).NotTo(BeNil())
+	g.Expect(kcp.Status.EarliestCertificateExpiry.Name).To(Equal(kubeconfigCertificateName))
+	g.Expect(kcp.Status.EarliestCertificateExpiry.NodeName).To(BeEmpty())
+	g.Expect(conditions.IsFalse(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition)).To(BeTrue())
+
+	got := &clusterv1.Machine{}
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(older), got)).To(Succeed())
+	g.Expect(got.Annotations[clusterv1.MachineCertificatesExpiryDateAnnotation]).To(
+		Equal(kcp.Status.EarliestCertificateExpiry.NotAfter.UTC().Format(time.RFC3339)))
+
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: "cp-0", Namespace: "default"}, got)).To(Succeed())
+	stamped, err := time.Parse(time.RFC3339, got.Annotations[clusterv1.MachineCertificatesExpiryDateAnnotation])
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stamped).To(BeTemporally("~", time.Now().Add(500*day), time.Minute))
+}
+
+// TestSetCertificateExpiry_RolloutWindowWidensWarning: a rolloutBefore window
+// beyond the 30-day default raises the condition no later than the rollout.
+func TestSetCertificateExpiry_RolloutWindowWidensWarning(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	kcp := certExpiryKCP()
+	kcp.Spec.RolloutBefore = &controlplanev1beta2.RolloutBefore{CertificatesExpiryDays: ptr.To(int32(90))}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ownedCPMachine("cp-0", "node-a")).Build()
+	wc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(certExpiryStatusSecret(map[string]string{
+		"node-a": certReport("node-a", map[string]time.Duration{"server.crt": 60 * day}),
+	})).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme, WorkloadClientFactory: staticWorkloadClient(wc)}
+
+	r.setCertificateExpiry(context.Background(), log.Log, kcp, testCluster())
+
+	g.Expect(conditions.IsTrue(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition)).To(BeTrue())
+	g.Expect(conditions.GetMessage(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition)).To(ContainSubstring("server.crt on node-a"))
+}
+
+func TestSetCertificateExpiry_WaitsForInitialization(t *testing.T) {
+	g := NewWithT(t)
+	kcp := k0sKCP()
+
+	r := &KairosControlPlaneReconciler{}
+	g.Expect(r.setCertificateExpiry(context.Background(), log.Log, kcp, testCluster())).To(BeZero())
+
+	g.Expect(conditions.IsUnknown(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition)).To(
+		Equal(controlplanev1beta2.WaitingForCertificateExpiryReportsReason))
+}
+
+func TestSetCertificateExpiry_ClientErrorRetains(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	kcp := certExpiryKCP()
+	kcp.Status.EarliestCertificateExpiry = &controlplanev1beta2.CertificateExpiry{Name: "old"}
+	conditions.MarkFalseWithNegativePolarity(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition)
+
+	r := &KairosControlPlaneReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme,
+		WorkloadClientFactory: func(context.Context, *clusterv1.Cluster) (client.Client, error) {
+			return nil, errors.New("unreachable")
+		},
+	}
+	r.setCertificateExpiry(context.Background(), log.Log, kcp, testCluster())
+
+	g.Expect(kcp.Status.EarliestCertificateExpiry.Name).To(Equal("old"))
+	g.Expect(conditions.IsFalse(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition)).To(BeTrue())
+}
+
+// TestSetHostedCertificateExpiry: a hosted control plane has no node
+// reports; the kubeconfig client certificate alone drives the status.
+func TestSetHostedCertificateExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn time.Duration // 0: no kubeconfig Secret
+		status    metav1.ConditionStatus
+	}{
+		{name: "fresh certificate", expiresIn: 300 * day, status: metav1.ConditionFalse},
+		{name: "renewal failing", expiresIn: 20 * day, status: metav1.ConditionTrue},
+		{name: "no kubeconfig yet", status: metav1.ConditionUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			scheme := haTestScheme(g)
+			kcp := certExpiryKCP()
+			cluster := testCluster()
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			if tt.expiresIn != 0 {
+				caCert, caKey, err := generateHostedCA(cluster.Name)
+				g.Expect(err).NotTo(HaveOccurred())
+				builder = builder.WithObjects(&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: cluster.Name + "-kubeconfig", Namespace: cluster.Namespace},
+					Data:       map[string][]byte{"value": hostedAdminKubeconfigExpiringIn(t, "https://10.0.0.1:6443", caCert, caKey, tt.expiresIn)},
+				})
+			}
+			r := &KairosControlPlaneReconciler{Client: builder.Build(), Scheme: scheme}
+
+			g.Expect(r.setHostedCertificateExpiry(context.Background(), log.Log, kcp, cluster)).To(Equal(certExpiryStatusRequeueAfter))
+
+			g.Expect(conditions.Get(kcp, controlplanev1beta2.CertificatesExpiringSoonCondition).Status).To(BeEquivalentTo(tt.status))
+			if tt.expiresIn == 0 {
+				g.Expect(kcp.Status.EarliestCertificateExpiry).To(BeNil())
+				return
+			}
+			g.Expect(kcp.Status.EarliestCertificateExpiry).NotTo(BeNil())
+			g.Expect(kcp.Status.EarliestCertificateExpiry.Name).To(Equal(kubeconfigCertificateName))
+			g.Expect(kcp.Status.EarliestCertificateExpiry.NotAfter.Time).To(BeTemporally("~", time.Now().Add(tt.expiresIn), time.Minute))
+		})
+	}
+}
+
+func TestCertificatesExpiring(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) map[string]string {
+		return map[string]string{clusterv1.MachineCertificatesExpiryDateAnnotation: now.Add(d).UTC().Format(time.RFC3339)}
+	}
+	for _, tc := range []struct {
+		name        string
+		days        *int32
+		annotations map[string]string
+		want        bool
+	}{
+		{"rolloutBefore unset", nil, at(day), false},
+		{"no recorded expiry", ptr.To(int32(30)), nil, false},
+		{"unparseable expiry", ptr.To(int32(30)), map[string]string{clusterv1.MachineCertificatesExpiryDateAnnotation: "soon"}, false},
+		{"outside the window", ptr.To(int32(30)), at(31 * day), false},
+		{"inside the window", ptr.To(int32(30)), at(29 * day), true},
+		{"already expired", ptr.To(int32(30)), at(-day), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			kcp := k0sKCP()
+			if tc.days != nil {
+				kcp.Spec.RolloutBefore = &controlplanev1beta2.RolloutBefore{CertificatesExpiryDays: tc.days}
+			}
+			m := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			g.Expect(certificatesExpiring(m, kcp, now)).To(Equal(tc.want))
+		})
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+const (
+	// etcdBackupStatusSecretName / -Namespace name the workload-cluster Secret
+	// each HA control-plane node's backup unit writes its own report key into.
+	// It lives in the workload cluster, written with the node's local admin
+	// kubeconfig, because the management-cluster bearer token rendered into
+	// the bootstrap data expires long before the first scheduled snapshot.
+	etcdBackupStatusSecretName      = "kairos-etcd-backup-status"
+	etcdBackupStatusSecretNamespace = "kube-system"
+
+	// etcdBackupStatusRequeueAfter is how often a KCP with spec.etcdBackup is
+	// re-read for new snapshot reports. The workload Secret is not watched.
+	etcdBackupStatusRequeueAfter = 5 * time.Minute
+
+	defaultEtcdBackupSchedule  = "daily"
+	defaultEtcdBackupRetention = int32(7)
+	defaultEtcdBackupRegion    = "us-east-1"
+)
+
+// etcdBackupSpec converts the KCP etcd backup block into the flat KairosConfig
+// copy, applying the CRD defaults for objects admitted before defaulting ran.
+// The credentials Secret is always resolved in the KCP's namespace.
+func etcdBackupSpec(kcp *controlplanev1beta2.KairosControlPlane) *bootstrapv1beta2.ControlPlaneEtcdBackup {
+	b := kcp.Spec.EtcdBackup
+	if b == nil {
+		return nil
+	}
+	out := &bootstrapv1beta2.ControlPlaneEtcdBackup{
+		Schedule:  b.Schedule,
+		Retention: defaultEtcdBackupRetention,
+		Endpoint:  b.S3.Endpoint,
+		Bucket:    b.S3.Bucket,
+		Prefix:    b.S3.Prefix,
+		Region:    b.S3.Region,
+		CredentialsSecretRef: bootstrapv1beta2.EtcdBackupCredentialsSecretReference{
+			Name:      b.S3.CredentialsSecretRef.Name,
+			Namespace: kcp.Namespace,
+		},
+	}
+	if out.Schedule == "" {
+		out.Schedule = defaultEtcdBackupSchedule
+	}
+	if b.Retention != nil {
+		out.Retention = *b.Retention
+	}
+	if out.Region == "" {
+		out.Region = defaultEtcdBackupRegion
+	}
+	return out
+}
+
+// etcdBackupReport is one node's latest backup attempt as written by the
+// node-side backup script. Snapshot carries the node's most recent successful
+// upload, kept across failed attempts so a failure never hides the last good
+// snapshot.
+type etcdBackupReport struct {
+	Node     string              `json:"node"`
+	Time     string              `json:"time"`
+	Success  bool                `json:"success"`
+	Message  string              `json:"message"`
+	Snapshot *etcdSnapshotReport `json:"snapshot"`
+}
+
+type etcdSnapshotReport struct {
+	Name      string `json:"name"`
+	Location  string `json:"location"`
+	SizeBytes int64  `json:"sizeBytes"`
+	Time      string `json:"time"`
+}
+
+// readEtcdBackupStatus loads the per-node reports from the workload-cluster
+// backup status Secret. A missing Secret (no node has run a backup yet) is an
+// empty map; malformed keys are skipped, as in readEtcdStatus.
+func readEtcdBackupStatus(ctx context.Context, wc client.Client) (map[string]etcdBackupReport, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: etcdBackupStatusSecretNamespace, Name: etcdBackupStatusSecretName}
+	if err := wc.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return map[string]etcdBackupReport{}, nil
+		}
+		return nil, fmt.Errorf("read etcd backup status secret %s: %w", key, err)
+	}
+	out := make(map[string]etcdBackupReport, len(secret.Data))
+	for node, raw := range secret.Data {
+		var rep etcdBackupReport
+		if err := json.Unmarshal(raw, &rep); err != nil {
+			continue
+		}
+		out[node] = rep
+	}
+	return out, nil
+}
+
+// setEtcdBackupStatus surfaces the node backup reports as
+// status.lastEtcdSnapshot and EtcdBackupReadyCondition. Only reports from the
+// Nodes of current control-plane machines count, so a replaced node's stale
+// failure does not pin the condition. Best-effort like the etcd health
+// condition: a workload client or read error leaves both unchanged.
+func (r *KairosControlPlaneReconciler) setEtcdBackupStatus(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) {
+	if kcp.Spec.EtcdBackup == nil {
+		kcp.Status.LastEtcdSnapshot = nil
+		conditions.Delete(kcp, controlplanev1beta2.EtcdBackupReadyCondition)
+		return
+	}
+	if !kcp.Status.Initialized {
+		conditions.MarkFalse(kcp, controlplanev1beta2.EtcdBackupReadyCondition,
+			controlplanev1beta2.WaitingForFirstEtcdSnapshotReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for the control plane to initialize")
+		return
+	}
+
+	machines, err := r.getControlPlaneMachines(ctx, kcp, cluster)
+	if err != nil {
+		log.V(4).Info("Cannot list control plane machines for etcd backup status", "error", err)
+		return
+	}
+	factory := r.WorkloadClientFactory
+	if factory == nil {
+		factory = r.defaultWorkloadClient
+	}
+	wc, err := factory(ctx, cluster)
+	if err != nil {
+		log.V(4).Info("Cannot build workload client for etcd backup status", "error", err)
+		return
+	}
+	reports, err := readEtcdBackupStatus(ctx, wc)
+	if err != nil {
+		log.V(4).Info("Cannot read etcd backup status", "error", err)
+		return
+	}
+
+	var latest *controlplanev1beta2.EtcdSnapshot
+	var failed []string
+	for _, m := range machines {
+		if m.Status.NodeRef == nil || !m.DeletionTimestamp.IsZero() {
+			continue
+		}
+		rep, ok := reports[m.Status.NodeRef.Name]
+		if !ok {
+			continue
+		}
+		if !rep.Success {
+			failed = append(failed, fmt.Sprintf("%s: %s", m.Status.NodeRef.Name, rep.Message))
+		}
+		if snap := snapshotFromReport(m.Status.NodeRef.Name, rep.Snapshot); snap != nil &&
+			(latest == nil || snap.Time.After(latest.Time.Time)) {
+			latest = snap
+		}
+	}
+	kcp.Status.LastEtcdSnapshot = latest
+
+	switch {
+	case len(failed) > 0:
+		sort.Strings(failed)
+		conditions.MarkFalse(kcp, controlplanev1beta2.EtcdBackupReadyCondition,
+			controlplanev1beta2.EtcdSnapshotFailedReason, clusterv1.ConditionSeverityWarning,
+			"Latest etcd snapshot failed on %s", strings.Join(failed, "; "))
+	case latest == nil:
+		conditions.MarkFalse(kcp, controlplanev1beta2.EtcdBackupReadyCondition,
+			controlplanev1beta2.WaitingForFirstEtcdSnapshotReason, clusterv1.ConditionSeverityInfo,
+			"No control-plane node has uploaded an etcd snapshot yet")
+	default:
+		conditions.MarkTrue(kcp, controlplanev1beta2.EtcdBackupReadyCondition)
+	}
+}
+
+// snapshotFromReport converts a node's last successful snapshot into the API
+// type. A report without a parseable time is ignored.
+func snapshotFromReport(node string, s *etcdSnapshotReport) *controlplanev1beta2.EtcdSnapshot {
+	if s == nil || s.Name == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s.Time)
+	if err != nil {
+		return nil
+	}
+	return &controlplanev1beta2.EtcdSnapshot{
+		Name:      s.Name,
+		NodeName:  node,
+		Location:  s.Location,
+		SizeBytes: s.SizeBytes,
+		Time:      metav1.NewTime(t),
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+func etcdBackupKCP() *controlplanev1beta2.KairosControlPlane {
+	kcp := k0sKCP()
+	kcp.Status.Initialized = true
+	kcp.Spec.EtcdBackup = &controlplanev1beta2.EtcdBackup{
+		S3: controlplanev1beta2.EtcdBackupS3{
+			Endpoint:             "http://minio.backup.svc:9000",
+			Bucket:               "etcd-backups",
+			CredentialsSecretRef: controlplanev1beta2.EtcdBackupCredentialsReference{Name: "s3-creds"},
+		},
+	}
+	return kcp
+}
+
+// ownedCPMachine builds a control-plane Machine owned by kcp with the given
+// Node name, so getControlPlaneMachines returns it.
+func ownedCPMachine(name, node string) *clusterv1.Machine {
+	m := machineAt(name)
+	m.Labels = map[string]string{
+		clusterv1.ClusterNameLabel:         testClusterName,
+		clusterv1.MachineControlPlaneLabel: "",
+	}
+	m.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: controlplanev1beta2.GroupVersion.String(),
+		Kind:       "KairosControlPlane",
+		Name:       "kcp",
+		Controller: ptr.To(true),
+	}}
+	m.Status.NodeRef = &corev1.ObjectReference{Name: node}
+	return m
+}
+
+func etcdBackupStatusSecret(data map[string]string) *corev1.Secret {
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: etcdBackupStatusSecretName, Namespace: etcdBackupStatusSecretNamespace},
+		Data:       map[string][]byte{},
+	}
+	for k, v := range data {
+		s.Data[k] = []byte(v)
+	}
+	return s
+}
+
+func TestEtcdBackupSpec_Defaults(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(etcdBackupSpec(k0sKCP())).To(BeNil())
+
+	got := etcdBackupSpec(etcdBackupKCP())
+	g.Expect(got).NotTo(BeNil())
+	g.Expect(got.Schedule).To(Equal("daily"))
+	g.Expect(got.Retention).To(Equal(int32(7)))
+	g.Expect(got.Region).To(Equal("us-east-1"))
+	g.Expect(got.Endpoint).To(Equal("http://minio.backup.svc:9000"))
+	g.Expect(got.CredentialsSecretRef.Name).To(Equal("s3-creds"))
+	g.Expect(got.CredentialsSecretRef.Namespace).To(Equal("default"))
+
+	kcp := etcdBackupKCP()
+	kcp.Spec.EtcdBackup.Schedule = "hourly"
+	kcp.Spec.EtcdBackup.Retention = ptr.To(int32(3))
+	kcp.Spec.EtcdBackup.S3.Region = "eu-west-1"
+	got = etcdBackupSpec(kcp)
+	g.Expect(got.Schedule).To(Equal("hourly"))
+	g.Expect(got.Retention).To(Equal(int32(3)))
+	g.Expect(got.Region).To(Equal("eu-west-1"))
+}
+
+// TestSetEtcdBackupStatus drives the condition and status.lastEtcdSnapshot from
+// the workload-cluster report Secret.
+func TestSetEtcdBackupStatus(t *testing.T) {
+	const (
+		okA    = `{"node":"node-a","time":"2026-01-02T02:00:00Z","success":true,"snapshot":{"name":"a.db","location":"s3://b/a.db","sizeBytes":10,"time":"2026-01-02T02:00:00Z"}}`
+		okB    = `{"node":"node-b","time":"2026-01-02T03:00:00Z","success":true,"snapshot":{"name":"b.db","location":"s3://b/b.db","sizeBytes":20,"time":"2026-01-02T03:00:00Z"}}`
+		failA  = `{"node":"node-a","time":"2026-01-03T02:00:00Z","success":false,"message":"upload failed","snapshot":{"name":"a.db","location":"s3://b/a.db","sizeBytes":10,"time":"2026-01-02T02:00:00Z"}}`
+		failX  = `{"node":"node-x","time":"2026-01-03T02:00:00Z","success":false,"message":"gone","snapshot":{"name":"x.db","location":"s3://b/x.db","sizeBytes":5,"time":"2026-01-04T02:00:00Z"}}`
+		noSnap = `{"node":"node-a","time":"2026-01-03T02:00:00Z","success":true,"snapshot":null}`
+	)
+
+	for _, tc := range []struct {
+		name       string
+		secret     *corev1.Secret
+		wantStatus corev1.ConditionStatus
+		wantReason string
+		wantSnap   string
+	}{
+		{"no reports yet", nil, corev1.ConditionFalse, controlplanev1beta2.WaitingForFirstEtcdSnapshotReason, ""},
+		{"report without snapshot", etcdBackupStatusSecret(map[string]string{"node-a": noSnap}), corev1.ConditionFalse, controlplanev1beta2.WaitingForFirstEtcdSnapshotReason, ""},
+		{"newest snapshot wins", etcdBackupStatusSecret(map[string]string{"node-a": okA, "node-b": okB}), corev1.ConditionTrue, "", "b.db"},
+		{"failure keeps last snapshot", etcdBackupStatusSecret(map[string]string{"node-a": failA}), corev1.ConditionFalse, controlplanev1beta2.EtcdSnapshotFailedReason, "a.db"},
+		{"removed node ignored", etcdBackupStatusSecret(map[string]string{"node-a": okA, "node-x": failX}), corev1.ConditionTrue, "", "a.db"},
+		{"malformed report skipped", etcdBackupStatusSecret(map[string]string{"node-a": okA, "node-b": "{"}), corev1.ConditionTrue, "", "a.db"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			scheme := haTestScheme(g)
+			kcp := etcdBackupKCP()
+			c := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(ownedCPMachine("cp-0", "node-a"), ownedCPMachine("cp-1", "node-b")).Build()
+			wb := fake.NewClientBuilder().WithScheme(scheme)
+			if tc.secret != nil {
+				wb = wb.WithObjects(tc.secret)
+			}
+			r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme, WorkloadClientFactory: staticWorkloadClient(wb.Build())}
+
+			r.setEtcdBackupStatus(context.Background(), log.Log, kcp, testCluster())
+
+			cond := conditions.Get(kcp, controlplanev1beta2.EtcdBackupReadyCondition)
+			g.Expect(cond).NotTo(BeNil())
+			g.Expect(cond.Status).To(Equal(tc.wantStatus))
+			g.Expect(cond.Reason).To(Equal(tc.wantReason))
+			if tc.wantSnap == "" {
+				g.Expect(kcp.Status.LastEtcdSnapshot).To(BeNil())
+				return
+			}
+			g.Expect(kcp.Status.LastEtcdSnapshot).NotTo(BeNil())
+			g.Expect(kcp.Status.LastEtcdSnapshot.Name).To(Equal(tc.wantSnap))
+		})
+	}
+}
+
+func TestSetEtcdBackupStatus_DisabledClears(t *testing.T) {
+	g := NewWithT(t)
+	kcp := k0sKCP()
+	kcp.Status.LastEtcdSnapshot = &controlplanev1beta2.EtcdSnapshot{Name: "old"}
+	conditions.MarkTrue(kcp, controlplanev1beta2.EtcdBackupReadyCondition)
+
+	r := &KairosControlPlaneReconciler{}
+	r.setEtcdBackupStatus(context.Background(), log.Log, kcp, testCluster())
+
+	g.Expect(kcp.Status.LastEtcdSnapshot).To(BeNil())
+	g.Expect(conditions.Get(kcp, controlplanev1beta2.EtcdBackupReadyCondition)).To(BeNil())
+}
+
+// TestSetEtcdBackupStatus_ClientErrorRetains: an unreachable workload cluster
+// leaves the previous condition and snapshot in place.
+func TestSetEtcdBackupStatus_ClientErrorRetains(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	kcp := etcdBackupKCP()
+	kcp.Status.LastEtcdSnapshot = &controlplanev1beta2.EtcdSnapshot{Name: "old"}
+	conditions.MarkTrue(kcp, controlplanev1beta2.EtcdBackupReadyCondition)
+
+	r := &KairosControlPlaneReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme,
+		WorkloadClientFactory: func(context.Context, *clusterv1.Cluster) (client.Client, error) {
+			return nil, errors.New("unreachable")
+		},
+	}
+	r.setEtcdBackupStatus(context.Background(), log.Log, kcp, testCluster())
+
+	g.Expect(kcp.Status.LastEtcdSnapshot.Name).To(Equal("old"))
+	g.Expect(conditions.IsTrue(kcp, controlplanev1beta2.EtcdBackupReadyCondition)).To(BeTrue())
+}
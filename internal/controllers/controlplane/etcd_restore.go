@@ -0,0 +1,227 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+// reconcileEtcdRestore drives a restore requested by spec.etcdRestore through
+// its phases, recorded in status.etcdRestore so every step survives a
+// controller restart:
+//
+//  1. DeletingMachines: every control-plane machine is deleted. The etcd
+//     quorum guard and the etcd-leave hook are bypassed, and drain and
+//     volume-detach waits are skipped: the cluster being restored has
+//     typically lost quorum and cannot answer. Once none are left, the k0s
+//     join token and the etcd-status reports of the old members are cleared.
+//  2. RestoringSnapshot: a new init machine is created whose KairosConfig
+//     carries the snapshot location (applyControlPlaneHASpec), and the phase
+//     holds until that machine passes the joiner gate (initMachineJoinable).
+//  3. JoiningMembers: the normal scale-up path creates the remaining members
+//     through the same joiner gate.
+//  4. Completed: spec.replicas machines have registered their Nodes.
+//
+// done is false while the normal machine reconciliation must not run, i.e.
+// during the first two phases. A new location restarts from phase 1; a
+// completed location is never restored again.
+func (r *KairosControlPlaneReconciler) reconcileEtcdRestore(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, machines []*clusterv1.Machine, desiredReplicas int32) (ctrl.Result, bool, error) {
+	rs := kcp.Spec.EtcdRestore
+	if rs == nil {
+		kcp.Status.EtcdRestore = nil
+		conditions.Delete(kcp, controlplanev1beta2.EtcdRestoreCondition)
+		return ctrl.Result{}, true, nil
+	}
+
+	st := kcp.Status.EtcdRestore
+	if st == nil || st.Location != rs.Location {
+		log.Info("Starting etcd restore; deleting every control plane machine", "location", rs.Location)
+		st = &controlplanev1beta2.EtcdRestoreStatus{
+			Location:  rs.Location,
+			Phase:     controlplanev1beta2.EtcdRestoreDeletingMachines,
+			StartedAt: metav1.Now(),
+		}
+		kcp.Status.EtcdRestore = st
+		if r.Recorder != nil {
+			r.Recorder.Eventf(kcp, corev1.EventTypeNormal, "EtcdRestoreStarted",
+				"Restoring the control plane from etcd snapshot %s", rs.Location)
+		}
+	}
+
+	switch st.Phase {
+	case controlplanev1beta2.EtcdRestoreDeletingMachines:
+		if len(machines) > 0 {
+			if err := r.deleteMachinesForRestore(ctx, log, machines); err != nil {
+				return ctrl.Result{}, false, err
+			}
+			setEtcdRestorePhase(kcp, controlplanev1beta2.EtcdRestoreDeletingMachines,
+				fmt.Sprintf("Waiting for %d control plane machine(s) to be deleted", len(machines)))
+			return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, false, nil
+		}
+		if err := r.resetHAStateForRestore(ctx, kcp, cluster); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		// The init machine is created on the next reconcile, once this phase
+		// change is persisted: a lost status write must never leave a restore
+		// init machine behind a DeletingMachines phase that would delete it.
+		setEtcdRestorePhase(kcp, controlplanev1beta2.EtcdRestoreRestoringSnapshot,
+			"Creating the init machine that restores the snapshot")
+		return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, false, nil
+
+	case controlplanev1beta2.EtcdRestoreRestoringSnapshot:
+		if len(machines) == 0 {
+			if err := r.createControlPlaneMachine(ctx, log, kcp, cluster, r.nextMachineIndex(machines, kcp.Name),
+				bootstrapv1beta2.ControlPlaneRoleInit, failureDomainForNewMachine(cluster, machines)); err != nil {
+				return ctrl.Result{}, false, fmt.Errorf("failed to create etcd restore init machine: %w", err)
+			}
+			setEtcdRestorePhase(kcp, controlplanev1beta2.EtcdRestoreRestoringSnapshot,
+				"Waiting for the init machine to restore the snapshot")
+			return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, false, nil
+		}
+		joinable, reason, err := r.initMachineJoinable(ctx, kcp, cluster, machines)
+		if err != nil {
+			return ctrl.Result{}, false, fmt.Errorf("failed to evaluate init machine joinability: %w", err)
+		}
+		if !joinable {
+			setEtcdRestorePhase(kcp, controlplanev1beta2.EtcdRestoreRestoringSnapshot,
+				fmt.Sprintf("Waiting for %s to restore the snapshot: %s", machines[0].Name, reason))
+			return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, false, nil
+		}
+		log.Info("Etcd snapshot restored on the init machine; joining the remaining members", "machine", machines[0].Name)
+		setEtcdRestorePhase(kcp, controlplanev1beta2.EtcdRestoreJoiningMembers, "")
+		fallthrough
+
+	case controlplanev1beta2.EtcdRestoreJoiningMembers:
+		joined := int32(0)
+		for _, m := range machines {
+			if m.Status.NodeRef != nil && m.DeletionTimestamp.IsZero() {
+				joined++
+			}
+		}
+		if joined < desiredReplicas {
+			setEtcdRestorePhase(kcp, controlplanev1beta2.EtcdRestoreJoiningMembers,
+				fmt.Sprintf("%d of %d control plane machines joined the restored cluster", joined, desiredReplicas))
+			return ctrl.Result{}, true, nil
+		}
+		now := metav1.Now()
+		st.CompletedAt = &now
+		setEtcdRestorePhase(kcp, controlplanev1beta2.EtcdRestoreCompleted,
+			fmt.Sprintf("Restored from %s", st.Location))
+		log.Info("Etcd restore completed", "location", st.Location)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(kcp, corev1.EventTypeNormal, "EtcdRestoreCompleted",
+				"Control plane restored from etcd snapshot %s", st.Location)
+		}
+		return ctrl.Result{}, true, nil
+
+	default: // Completed
+		conditions.MarkTrue(kcp, controlplanev1beta2.EtcdRestoreCondition)
+		return ctrl.Result{}, true, nil
+	}
+}
+
+// setEtcdRestorePhase records the restore phase and mirrors it onto
+// EtcdRestoreCondition.
+func setEtcdRestorePhase(kcp *controlplanev1beta2.KairosControlPlane, phase controlplanev1beta2.EtcdRestorePhase, message string) {
+	kcp.Status.EtcdRestore.Phase = phase
+	kcp.Status.EtcdRestore.Message = message
+	if phase == controlplanev1beta2.EtcdRestoreCompleted {
+		conditions.MarkTrue(kcp, controlplanev1beta2.EtcdRestoreCondition)
+		return
+	}
+	msg := string(phase)
+	if message != "" {
+		msg += ": " + message
+	}
+	conditions.MarkFalse(kcp, controlplanev1beta2.EtcdRestoreCondition,
+		controlplanev1beta2.EtcdRestoreInProgressReason, clusterv1.ConditionSeverityInfo, "%s", msg)
+}
+
+// deleteMachinesForRestore deletes every control-plane machine without the
+// etcd-leave handshake: the hook is stripped, and node drain and volume-detach
+// waits are skipped because the workload cluster cannot be expected to answer.
+func (r *KairosControlPlaneReconciler) deleteMachinesForRestore(ctx context.Context, log logr.Logger, machines []*clusterv1.Machine) error {
+	for _, m := range machines {
+		helper, err := patch.NewHelper(m, r.Client)
+		if err != nil {
+			return err
+		}
+		if m.Annotations == nil {
+			m.Annotations = map[string]string{}
+		}
+		delete(m.Annotations, etcdLeaveHookAnnotation())
+		m.Annotations[clusterv1.ExcludeNodeDrainingAnnotation] = ""
+		m.Annotations[clusterv1.ExcludeWaitForNodeVolumeDetachAnnotation] = ""
+		if err := helper.Patch(ctx, m); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("failed to prepare machine %s for etcd restore: %w", m.Name, err)
+		}
+		if !m.DeletionTimestamp.IsZero() {
+			continue
+		}
+		log.Info("Deleting control plane machine for etcd restore", "machine", m.Name)
+		if err := r.Delete(ctx, m); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete machine %s for etcd restore: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// resetHAStateForRestore clears the node-reported HA state of the deleted
+// members so the joiner gate waits on the restored init node: the etcd-status
+// reports, and for k0s the controller-join token, which the restored init node
+// mints afresh. The k3s and rke2 shared server token is kept: the snapshot's
+// bootstrap data is encrypted with it.
+func (r *KairosControlPlaneReconciler) resetHAStateForRestore(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) error {
+	names := []string{etcdStatusSecretName(cluster.Name)}
+	if distributionOf(kcp) == "k0s" {
+		names = append(names, joinTokenSecretName(cluster.Name))
+	}
+	for _, name := range names {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: name}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("get secret %s/%s: %w", cluster.Namespace, name, err)
+		}
+		if len(secret.Data) == 0 {
+			continue
+		}
+		secret.Data = map[string][]byte{}
+		if err := r.Update(ctx, secret); err != nil {
+			return fmt.Errorf("reset secret %s/%s for etcd restore: %w", cluster.Namespace, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+const testRestoreLocation = "http://minio.backup.svc:9000/etcd-backups/node-a/k0s_backup.tar.gz"
+
+func etcdRestoreKCP(phase controlplanev1beta2.EtcdRestorePhase) *controlplanev1beta2.KairosControlPlane {
+	kcp := etcdBackupKCP()
+	kcp.Spec.EtcdRestore = &controlplanev1beta2.EtcdRestore{Location: testRestoreLocation}
+	if phase != "" {
+		kcp.Status.EtcdRestore = &controlplanev1beta2.EtcdRestoreStatus{Location: testRestoreLocation, Phase: phase}
+	}
+	return kcp
+}
+
+func restoreCondition(g *WithT, kcp *controlplanev1beta2.KairosControlPlane) *clusterv1.Condition {
+	cond := conditions.Get(kcp, controlplanev1beta2.EtcdRestoreCondition)
+	g.Expect(cond).NotTo(BeNil())
+	return cond
+}
+
+// TestEtcdRestore_StartDeletesEveryMachine: a new location deletes every
+// control-plane machine, stripping the etcd-leave hook and skipping drain.
+func TestEtcdRestore_StartDeletesEveryMachine(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	var machines []*clusterv1.Machine
+	var objs []client.Object
+	for _, n := range []string{"cp-0", "cp-1", "cp-2"} {
+		m := ownedCPMachine(n, "node-"+n)
+		m.Annotations = map[string]string{etcdLeaveHookAnnotation(): ""}
+		m.Finalizers = []string{clusterv1.MachineFinalizer}
+		machines = append(machines, m)
+		objs = append(objs, m)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+
+	kcp := etcdRestoreKCP("")
+	kcp.Status.EtcdRestore = &controlplanev1beta2.EtcdRestoreStatus{Location: "http://minio.backup.svc:9000/etcd-backups/old.db", Phase: controlplanev1beta2.EtcdRestoreCompleted}
+	res, done, err := r.reconcileEtcdRestore(context.Background(), log.Log, kcp, testCluster(), machines, 3)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+	g.Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+	g.Expect(kcp.Status.EtcdRestore.Location).To(Equal(testRestoreLocation))
+	g.Expect(kcp.Status.EtcdRestore.Phase).To(Equal(controlplanev1beta2.EtcdRestoreDeletingMachines))
+	g.Expect(restoreCondition(g, kcp).Reason).To(Equal(controlplanev1beta2.EtcdRestoreInProgressReason))
+
+	for _, m := range machines {
+		got := &clusterv1.Machine{}
+		g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: m.Name}, got)).To(Succeed())
+		g.Expect(got.DeletionTimestamp.IsZero()).To(BeFalse(), "machine %s not deleted", m.Name)
+		g.Expect(got.Annotations).NotTo(HaveKey(etcdLeaveHookAnnotation()))
+		g.Expect(got.Annotations).To(HaveKey(clusterv1.ExcludeNodeDrainingAnnotation))
+		g.Expect(got.Annotations).To(HaveKey(clusterv1.ExcludeWaitForNodeVolumeDetachAnnotation))
+	}
+}
+
+// TestEtcdRestore_ResetsHAStateOnceMachinesAreGone: with no machines left the
+// k0s join token and etcd-status reports are cleared and the phase moves on,
+// without creating the init machine in the same reconcile.
+func TestEtcdRestore_ResetsHAStateOnceMachinesAreGone(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	token := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: joinTokenSecretName(testClusterName), Namespace: "default"},
+		Data:       map[string][]byte{joinTokenSecretDataKey: []byte("old-token")},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(token, etcdStatusSecretForMembers("node-a", "node-b")).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+
+	kcp := etcdRestoreKCP(controlplanev1beta2.EtcdRestoreDeletingMachines)
+	_, done, err := r.reconcileEtcdRestore(context.Background(), log.Log, kcp, testCluster(), nil, 3)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+	g.Expect(kcp.Status.EtcdRestore.Phase).To(Equal(controlplanev1beta2.EtcdRestoreRestoringSnapshot))
+
+	for _, name := range []string{joinTokenSecretName(testClusterName), etcdStatusSecretName(testClusterName)} {
+		got := &corev1.Secret{}
+		g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, got)).To(Succeed())
+		g.Expect(got.Data).To(BeEmpty(), "secret %s not reset", name)
+	}
+	ml := &clusterv1.MachineList{}
+	g.Expect(c.List(context.Background(), ml)).To(Succeed())
+	g.Expect(ml.Items).To(BeEmpty())
+}
+
+// TestEtcdRestore_KeepsK3sServerToken: the k3s snapshot is encrypted with the
+// shared server token, so it survives the reset.
+func TestEtcdRestore_KeepsK3sServerToken(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	token := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: joinTokenSecretName(testClusterName), Namespace: "default"},
+		Data:       map[string][]byte{joinTokenSecretDataKey: []byte("server-token")},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(token).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+
+	kcp := etcdRestoreKCP(controlplanev1beta2.EtcdRestoreDeletingMachines)
+	kcp.Spec.Distribution = "k3s"
+	_, _, err := r.reconcileEtcdRestore(context.Background(), log.Log, kcp, testCluster(), nil, 3)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	got := &corev1.Secret{}
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: token.Name}, got)).To(Succeed())
+	g.Expect(string(got.Data[joinTokenSecretDataKey])).To(Equal("server-token"))
+}
+
+// TestEtcdRestore_HoldsUntilInitJoinable: the restoring init machine gates
+// the normal reconcile until it passes the joiner gate, then members join.
+func TestEtcdRestore_HoldsUntilInitJoinable(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+
+	kcp := etcdRestoreKCP(controlplanev1beta2.EtcdRestoreRestoringSnapshot)
+	kcp.Spec.Distribution = "k3s"
+	init := ownedCPMachine("cp-3", "node-3")
+	init.Status.NodeRef = nil
+
+	_, done, err := r.reconcileEtcdRestore(context.Background(), log.Log, kcp, testCluster(), []*clusterv1.Machine{init}, 3)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+	g.Expect(kcp.Status.EtcdRestore.Phase).To(Equal(controlplanev1beta2.EtcdRestoreRestoringSnapshot))
+	g.Expect(kcp.Status.EtcdRestore.Message).To(ContainSubstring("cp-3"))
+
+	init.Status.NodeRef = &corev1.ObjectReference{Name: "node-3"}
+	conditions.MarkTrue(kcp, controlplanev1beta2.KubeconfigReadyCondition)
+	_, done, err = r.reconcileEtcdRestore(context.Background(), log.Log, kcp, testCluster(), []*clusterv1.Machine{init}, 3)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(done).To(BeTrue())
+	g.Expect(kcp.Status.EtcdRestore.Phase).To(Equal(controlplanev1beta2.EtcdRestoreJoiningMembers))
+	g.Expect(kcp.Status.EtcdRestore.Message).To(Equal("1 of 3 control plane machines joined the restored cluster"))
+}
+
+func TestEtcdRestore_CompletesAtDesiredReplicas(t *testing.T) {
+	g := NewWithT(t)
+	r := &KairosControlPlaneReconciler{}
+	kcp := etcdRestoreKCP(controlplanev1beta2.EtcdRestoreJoiningMembers)
+	machines := []*clusterv1.Machine{ownedCPMachine("cp-3", "n3"), ownedCPMachine("cp-4", "n4"), ownedCPMachine("cp-5", "n5")}
+
+	_, done, err := r.reconcileEtcdRestore(context.Background(), log.Log, kcp, testCluster(), machines, 3)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(done).To(BeTrue())
+	g.Expect(kcp.Status.EtcdRestore.Phase).To(Equal(controlplanev1beta2.EtcdRestoreCompleted))
+	g.Expect(kcp.Status.EtcdRestore.CompletedAt).NotTo(BeNil())
+	g.Expect(conditions.IsTrue(kcp, controlplanev1beta2.EtcdRestoreCondition)).To(BeTrue())
+
+	// A completed location is not restored again.
+	_, done, err = r.reconcileEtcdRestore(context.Background(), log.Log, kcp, testCluster(), machines, 3)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(done).To(BeTrue())
+	g.Expect(kcp.Status.EtcdRestore.Phase).To(Equal(controlplanev1beta2.EtcdRestoreCompleted))
+}
+
+func TestEtcdRestore_RemovedSpecClearsStatus(t *testing.T) {
+	g := NewWithT(t)
+	r := &KairosControlPlaneReconciler{}
+	kcp := etcdRestoreKCP(controlplanev1beta2.EtcdRestoreCompleted)
+	conditions.MarkTrue(kcp, controlplanev1beta2.EtcdRestoreCondition)
+	kcp.Spec.EtcdRestore = nil
+
+	_, done, err := r.reconcileEtcdRestore(context.Background(), log.Log, kcp, testCluster(), nil, 3)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(done).To(BeTrue())
+	g.Expect(kcp.Status.EtcdRestore).To(BeNil())
+	g.Expect(conditions.Get(kcp, controlplanev1beta2.EtcdRestoreCondition)).To(BeNil())
+}
+
+// TestApplyControlPlaneHASpec_EtcdRestore: only the init machine created while
+// restoring carries the snapshot location.
+func TestApplyControlPlaneHASpec_EtcdRestore(t *testing.T) {
+	g := NewWithT(t)
+	r := &KairosControlPlaneReconciler{}
+	for _, tc := range []struct {
+		name  string
+		phase controlplanev1beta2.EtcdRestorePhase
+		role  bootstrapv1beta2.ControlPlaneRole
+		want  bool
+	}{
+		{"restoring init", controlplanev1beta2.EtcdRestoreRestoringSnapshot, bootstrapv1beta2.ControlPlaneRoleInit, true},
+		{"restoring join", controlplanev1beta2.EtcdRestoreRestoringSnapshot, bootstrapv1beta2.ControlPlaneRoleJoin, false},
+		{"joining members", controlplanev1beta2.EtcdRestoreJoiningMembers, bootstrapv1beta2.ControlPlaneRoleInit, false},
+		{"no restore", "", bootstrapv1beta2.ControlPlaneRoleInit, false},
+	} {
+		spec := &bootstrapv1beta2.KairosConfigSpec{Distribution: "k0s"}
+		r.applyControlPlaneHASpec(spec, etcdRestoreKCP(tc.phase), testCluster(), tc.role)
+		if !tc.want {
+			g.Expect(spec.EtcdRestore).To(BeNil(), tc.name)
+			continue
+		}
+		g.Expect(spec.EtcdRestore).NotTo(BeNil(), tc.name)
+		g.Expect(spec.EtcdRestore.Location).To(Equal(testRestoreLocation))
+		g.Expect(spec.EtcdBackup).NotTo(BeNil(), tc.name)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"sort"
+
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+// Failure-domain spreading follows KubeadmControlPlane: new machines go to the
+// least-crowded control-plane-eligible domain, deletions come out of the most
+// crowded one. Clusters whose infrastructure reports no failure domains keep the
+// previous behaviour exactly (no Machine.Spec.FailureDomain, same deletion pick).
+
+// controlPlaneFailureDomains returns the names of the Cluster's failure domains
+// that are eligible for control-plane machines, sorted for a stable tie-break.
+func controlPlaneFailureDomains(cluster *clusterv1.Cluster) []string {
+	if cluster == nil {
+		return nil
+	}
+	names := make([]string, 0, len(cluster.Status.FailureDomains))
+	for name, fd := range cluster.Status.FailureDomains {
+		if fd.ControlPlane {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// machineFailureDomain returns the Machine's failure domain, or "" when it has
+// none.
+func machineFailureDomain(m *clusterv1.Machine) string {
+	return ptr.Deref(m.Spec.FailureDomain, "")
+}
+
+// failureDomainCounts counts the non-deleting machines per failure domain.
+// Machines without a failure domain are counted under "".
+func failureDomainCounts(machines []*clusterv1.Machine) map[string]int32 {
+	counts := map[string]int32{}
+	for _, m := range machines {
+		if !m.DeletionTimestamp.IsZero() {
+			continue
+		}
+		counts[machineFailureDomain(m)]++
+	}
+	return counts
+}
+
+// failureDomainForNewMachine picks the eligible failure domain with the fewest
+// control-plane machines, breaking ties by name. Returns nil when the Cluster
+// reports no control-plane-eligible failure domains.
+func failureDomainForNewMachine(cluster *clusterv1.Cluster, machines []*clusterv1.Machine) *string {
+	eligible := controlPlaneFailureDomains(cluster)
+	if len(eligible) == 0 {
+		return nil
+	}
+	counts := failureDomainCounts(machines)
+	best := eligible[0]
+	for _, name := range eligible[1:] {
+		if counts[name] < counts[best] {
+			best = name
+		}
+	}
+	return ptr.To(best)
+}
+
+// selectMachineForDeletion picks the control-plane machine to remove next.
+// Outdated machines are always preferred over up-to-date ones. Among the
+// candidates, machines outside any eligible failure domain go first, then those
+// in the most crowded domain (ties broken by name). Within that group an
+// outdated pick is the oldest machine (rollout order) and a scale-down pick is
+// the newest, to reduce churn on older nodes. machines must be sorted oldest
+// first.
+func selectMachineForDeletion(cluster *clusterv1.Cluster, machines []*clusterv1.Machine, outdatedMachines []*clusterv1.Machine) *clusterv1.Machine {
+	candidates, oldest := outdatedMachines, true
+	if len(candidates) == 0 {
+		candidates, oldest = machines, false
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	eligible := map[string]bool{}
+	for _, name := range controlPlaneFailureDomains(cluster) {
+		eligible[name] = true
+	}
+	counts := failureDomainCounts(machines)
+
+	// A machine in no (or no longer eligible) failure domain is the first to
+	// go: removing it never makes the spread worse.
+	domainOf := func(m *clusterv1.Machine) (string, bool) {
+		fd := machineFailureDomain(m)
+		return fd, eligible[fd]
+	}
+	target, unplaced := "", false
+	for _, m := range candidates {
+		if _, ok := domainOf(m); !ok {
+			unplaced = true
+			break
+		}
+	}
+	if !unplaced {
+		first := true
+		for _, m := range candidates {
+			fd, _ := domainOf(m)
+			if first || counts[fd] > counts[target] || (counts[fd] == counts[target] && fd < target) {
+				target, first = fd, false
+			}
+		}
+	}
+
+	inTarget := func(m *clusterv1.Machine) bool {
+		fd, ok := domainOf(m)
+		if unplaced {
+			return !ok
+		}
+		return fd == target
+	}
+	if oldest {
+		for _, m := range candidates {
+			if inTarget(m) {
+				return m
+			}
+		}
+	} else {
+		for i := len(candidates) - 1; i >= 0; i-- {
+			if inTarget(candidates[i]) {
+				return candidates[i]
+			}
+		}
+	}
+	return nil
+}
+
+// failureDomainStatus reports how many control-plane machines sit in each
+// failure domain: every eligible domain (including empty ones) plus any other
+// domain a machine still occupies. Machines without a failure domain are not
+// listed. Returns nil when there is nothing to report.
+func failureDomainStatus(cluster *clusterv1.Cluster, machines []*clusterv1.Machine) []controlplanev1beta2.FailureDomainReplicas {
+	counts := failureDomainCounts(machines)
+	seen := map[string]bool{}
+	names := []string{}
+	for _, name := range controlPlaneFailureDomains(cluster) {
+		seen[name] = true
+		names = append(names, name)
+	}
+	for name := range counts {
+		if name != "" && !seen[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	out := make([]controlplanev1beta2.FailureDomainReplicas, 0, len(names))
+	for _, name := range names {
+		out = append(out, controlplanev1beta2.FailureDomainReplicas{Name: name, Replicas: counts[name]})
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+func fdCluster(domains map[string]bool) *clusterv1.Cluster {
+	c := &clusterv1.Cluster{}
+	if len(domains) > 0 {
+		c.Status.FailureDomains = clusterv1.FailureDomains{}
+		for name, cp := range domains {
+			c.Status.FailureDomains[name] = clusterv1.FailureDomainSpec{ControlPlane: cp}
+		}
+	}
+	return c
+}
+
+// fdMachines builds machines oldest first, one per domain entry ("" = none).
+func fdMachines(domains ...string) []*clusterv1.Machine {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	out := make([]*clusterv1.Machine, 0, len(domains))
+	for i, fd := range domains {
+		m := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{
+			Name:              "m" + string(rune('0'+i)),
+			CreationTimestamp: metav1.NewTime(base.Add(time.Duration(i) * time.Minute)),
+		}}
+		if fd != "" {
+			m.Spec.FailureDomain = ptr.To(fd)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestFailureDomainForNewMachine(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		domains  map[string]bool
+		machines []string
+		want     *string
+	}{
+		{"no failure domains", nil, []string{"", ""}, nil},
+		{"only worker domains", map[string]bool{"a": false, "b": false}, nil, nil},
+		{"empty cluster picks first by name", map[string]bool{"b": true, "a": true, "c": true}, nil, ptr.To("a")},
+		{"least crowded wins", map[string]bool{"a": true, "b": true, "c": true}, []string{"a", "b"}, ptr.To("c")},
+		{"tie broken by name", map[string]bool{"a": true, "b": true, "c": true}, []string{"a"}, ptr.To("b")},
+		{"ineligible domain skipped", map[string]bool{"a": true, "w": false}, []string{"a"}, ptr.To("a")},
+		{"machines in unknown domains ignored", map[string]bool{"a": true, "b": true}, []string{"gone", "gone", "a"}, ptr.To("b")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(failureDomainForNewMachine(fdCluster(tc.domains), fdMachines(tc.machines...))).To(Equal(tc.want))
+		})
+	}
+}
+
+// TestFailureDomainForNewMachine_IgnoresDeleting: a machine on its way out does
+// not occupy its domain, so its replacement may land there again.
+func TestFailureDomainForNewMachine_IgnoresDeleting(t *testing.T) {
+	g := NewWithT(t)
+	machines := fdMachines("a", "a", "b")
+	machines[0].DeletionTimestamp = ptr.To(metav1.Now())
+	machines[1].DeletionTimestamp = ptr.To(metav1.Now())
+	g.Expect(failureDomainForNewMachine(fdCluster(map[string]bool{"a": true, "b": true}), machines)).To(Equal(ptr.To("a")))
+}
+
+func TestSelectMachineForDeletion(t *testing.T) {
+	abc := map[string]bool{"a": true, "b": true, "c": true}
+	for _, tc := range []struct {
+		name     string
+		domains  map[string]bool
+		machines []string
+		outdated []int
+		want     string
+	}{
+		{"no machines", nil, nil, nil, ""},
+		{"no domains, scale down picks newest", nil, []string{"", "", ""}, nil, "m2"},
+		{"no domains, rollout picks oldest outdated", nil, []string{"", "", "", ""}, []int{1, 2}, "m1"},
+		{"scale down from most crowded domain", abc, []string{"a", "b", "b", "c"}, nil, "m2"},
+		{"scale down tie broken by name", abc, []string{"a", "b", "c", "a", "b"}, nil, "m3"},
+		{"rollout from most crowded domain", abc, []string{"a", "b", "c", "c"}, []int{0, 1, 2}, "m2"},
+		{"rollout only considers outdated", abc, []string{"a", "b", "b", "b", "c"}, []int{0, 4}, "m0"},
+		{"unplaced machine goes first", abc, []string{"a", "a", "", "b"}, nil, "m2"},
+		{"ineligible domain goes first", map[string]bool{"a": true, "w": false}, []string{"a", "a", "w"}, nil, "m2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			machines := fdMachines(tc.machines...)
+			var outdated []*clusterv1.Machine
+			for _, i := range tc.outdated {
+				outdated = append(outdated, machines[i])
+			}
+			got := selectMachineForDeletion(fdCluster(tc.domains), machines, outdated)
+			if tc.want == "" {
+				g.Expect(got).To(BeNil())
+				return
+			}
+			g.Expect(got).NotTo(BeNil())
+			g.Expect(got.Name).To(Equal(tc.want))
+		})
+	}
+}
+
+func TestFailureDomainStatus(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(failureDomainStatus(fdCluster(nil), fdMachines("", ""))).To(BeNil())
+
+	machines := fdMachines("a", "a", "old", "", "b")
+	machines[1].DeletionTimestamp = ptr.To(metav1.Now())
+	got := failureDomainStatus(fdCluster(map[string]bool{"a": true, "b": true, "c": true, "w": false}), machines)
+	g.Expect(got).To(Equal([]controlplanev1beta2.FailureDomainReplicas{
+		{Name: "a", Replicas: 1},
+		{Name: "b", Replicas: 1},
+		{Name: "c", Replicas: 0},
+		{Name: "old", Replicas: 1},
+	}))
+}
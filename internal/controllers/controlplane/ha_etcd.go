@@ -26,6 +26,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
@@ -55,8 +56,9 @@ func etcdStatusSecretName(clusterName string) string {
 // the KCP would strand it across a KCP replace. The mutate func NEVER clears
 // existing Data — that would wipe node-reported health on every reconcile.
 //
-// Gated by the caller on desiredReplicas > 1 (single-node clusters have no etcd
-// quorum to guard and no peers to report about).
+// Ensured for every control plane: a one-replica control plane is a
+// single-member etcd cluster whose node reports here too, so it can be scaled
+// out without a rebuild.
 func (r *KairosControlPlaneReconciler) ensureEtcdStatusSecret(ctx context.Context, log logr.Logger, cluster *clusterv1.Cluster) error {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -138,15 +140,68 @@ func etcdVotingHealthyCount(status map[string]etcdMemberStatus) int {
 	return n
 }
 
+// isEtcdMember reports whether a control-plane Machine runs an etcd member,
+// i.e. its KairosConfig has the init or join role. Machines created with the
+// single role (or before ControlPlaneRole existed) run the distribution's
+// single-node datastore (k0s --single / k3s without --cluster-init) and can
+// never accept a joiner. Anything that cannot be proven single — no
+// KairosConfig ref, a missing KairosConfig — counts as a member, so a lookup
+// gap never yields a second init node or skips the quorum guard.
+func (r *KairosControlPlaneReconciler) isEtcdMember(ctx context.Context, m *clusterv1.Machine) (bool, error) {
+	ref := m.Spec.Bootstrap.ConfigRef
+	if ref == nil || ref.Kind != "KairosConfig" {
+		return true, nil
+	}
+	kc := &bootstrapv1beta2.KairosConfig{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: m.Namespace, Name: ref.Name}, kc); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("get KairosConfig %s/%s: %w", m.Namespace, ref.Name, err)
+	}
+	switch kc.Spec.ControlPlaneRole {
+	case bootstrapv1beta2.ControlPlaneRoleInit, bootstrapv1beta2.ControlPlaneRoleJoin:
+		return true, nil
+	}
+	return false, nil
+}
+
+// etcdMembers returns the machines that run an etcd member and are not being
+// deleted, in the caller's (oldest-first) order. The first one is the member
+// new joiners are gated on.
+func (r *KairosControlPlaneReconciler) etcdMembers(ctx context.Context, machines []*clusterv1.Machine) ([]*clusterv1.Machine, error) {
+	members := make([]*clusterv1.Machine, 0, len(machines))
+	for _, m := range machines {
+		if !m.DeletionTimestamp.IsZero() {
+			continue
+		}
+		member, err := r.isEtcdMember(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		if member {
+			members = append(members, m)
+		}
+	}
+	return members, nil
+}
+
 // canRemoveMember reports whether deleting `target` (a control-plane Machine) is
 // safe for etcd quorum (ADR 0005 §E.2). It guards every NON-teardown CP-Machine
 // delete site (rollout replacement, scale-down); reconcileDelete does NOT call it
 // (whole-cluster teardown is the bypass).
 //
+// The quorum is that of the etcd cluster left behind: spec.replicas members, or
+// more while a scale-down is still removing them one at a time (3 → 1 passes
+// through a two-member cluster that needs both members).
+//
 // SECURITY (ADR 0005 §E.5, security-architect ruling — must-honor constraints):
 //   - FAILS CLOSED: a transient read error, or a live Running target with NO
 //     etcd-status report, refuses the delete ("cannot prove quorum safety") — a
-//     missing report on a live node may be a silent voting member.
+//     missing report on a live node may be a silent voting member. The one
+//     exception is a machine the controller itself migrated from the single
+//     role (annotation on the management-side Machine, not a node report): it
+//     runs no reporter and is treated as a voting member outside the count.
 //   - BYPASS is EXACT: only whole-cluster teardown (kcp.DeletionTimestamp set)
 //     bypasses. A per-Machine deletion timestamp, rollout, or scale-down never
 //     reaches the bypass.
@@ -160,12 +215,10 @@ func (r *KairosControlPlaneReconciler) canRemoveMember(ctx context.Context, kcp
 	if !kcp.ObjectMeta.DeletionTimestamp.IsZero() {
 		return true, "", nil
 	}
-	desiredReplicas := int32(1)
-	if kcp.Spec.Replicas != nil {
-		desiredReplicas = *kcp.Spec.Replicas
-	}
-	// Single-node (or unset) control planes have no etcd quorum to protect.
-	if desiredReplicas <= 1 {
+	// A machine that never joined etcd (single role) has no quorum to protect.
+	if member, err := r.isEtcdMember(ctx, target); err != nil {
+		return false, "", err
+	} else if !member {
 		return true, "", nil
 	}
 	// Failed-node fast path — OBJECTIVE liveness only (Machine phase / NodeRef),
@@ -184,17 +237,28 @@ func (r *KairosControlPlaneReconciler) canRemoveMember(ctx context.Context, kcp
 	}
 	targetKey := target.Status.NodeRef.Name
 	st, reported := status[targetKey]
-	if !reported {
+	if !reported && !singleRoleMigrated(target) {
 		// A live CP node with no etcd report may be a silent voting member whose
 		// report is stale — cannot prove safety, fail closed.
 		return false, "target is a live control-plane node with no etcd-status report; cannot prove quorum safety", nil
 	}
+	// A machine migrated from the single role runs no reporter. It is a voting
+	// member the reporters do not count, so removing it leaves their count as
+	// it is and the check below still proves quorum.
 	voting := etcdVotingHealthyCount(status)
 	postRemoval := voting
 	if st.Healthy && st.Voting {
 		postRemoval = voting - 1 // removing a member currently counted toward quorum
 	}
-	quorum := int(desiredReplicas/2 + 1)
+	remaining, err := r.remainingEtcdMembers(ctx, kcp, cluster, target)
+	if err != nil {
+		return false, "", err
+	}
+	size := int(ptr.Deref(kcp.Spec.Replicas, 1))
+	if remaining > size {
+		size = remaining
+	}
+	quorum := size/2 + 1
 	if postRemoval < quorum {
 		return false, fmt.Sprintf(
 			"removing this member would leave %d healthy voting etcd members, below the quorum minimum ((N/2)+1=%d)",
@@ -202,3 +266,22 @@ func (r *KairosControlPlaneReconciler) canRemoveMember(ctx context.Context, kcp
 	}
 	return true, "", nil
 }
+
+// remainingEtcdMembers counts the live etcd members other than target.
+func (r *KairosControlPlaneReconciler) remainingEtcdMembers(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, target *clusterv1.Machine) (int, error) {
+	machines, err := r.getControlPlaneMachines(ctx, kcp, cluster)
+	if err != nil {
+		return 0, fmt.Errorf("list control plane machines: %w", err)
+	}
+	members, err := r.etcdMembers(ctx, machines)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, m := range members {
+		if m.Name != target.Name {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -217,7 +217,8 @@ func TestInitMachineJoinable_GatesOnEtcdReport(t *testing.T) {
 // TestCanRemoveMember pins the ADR 0005 §E.2/§E.5 quorum guard: exact teardown
 // bypass, objective failed-node fast path (Machine phase, not the etcd
 // self-report), fail-closed on a live-but-unreported target, and correct quorum
-// arithmetic over healthy+voting reporters.
+// arithmetic over healthy+voting reporters, sized by the etcd cluster left
+// behind (a scale-down to one passes through a two-member cluster).
 func TestCanRemoveMember(t *testing.T) {
 	mkMachine := func(name, node, phase string) *clusterv1.Machine {
 		m := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
@@ -227,8 +228,24 @@ func TestCanRemoveMember(t *testing.T) {
 		}
 		return m
 	}
+	// withRole gives a machine a KairosConfig of the given role and makes it
+	// an owned control-plane machine, so it counts toward the live members.
+	withRole := func(m *clusterv1.Machine, role bootstrapv1beta2.ControlPlaneRole) []client.Object {
+		m.Labels = map[string]string{clusterv1.ClusterNameLabel: "c", clusterv1.MachineControlPlaneLabel: ""}
+		m.OwnerReferences = []metav1.OwnerReference{{Kind: "KairosControlPlane", Name: "kcp", Controller: ptr.To(true)}}
+		m.Spec.Bootstrap.ConfigRef = &corev1.ObjectReference{Kind: "KairosConfig", Name: m.Name}
+		return []client.Object{m, &bootstrapv1beta2.KairosConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: m.Name, Namespace: "default"},
+			Spec:       bootstrapv1beta2.KairosConfigSpec{ControlPlaneRole: role},
+		}}
+	}
 	type member struct{ healthy, voting bool }
 	running := string(clusterv1.MachinePhaseRunning)
+	legacySingle := mkMachine("cp-0", "cp-0", running)
+	scaleDownTarget := mkMachine("cp-0", "cp-0", running)
+	scaleDownObjs := append(withRole(scaleDownTarget, bootstrapv1beta2.ControlPlaneRoleInit),
+		withRole(mkMachine("cp-1", "cp-1", running), bootstrapv1beta2.ControlPlaneRoleJoin)...)
+	scaleDownObjs = append(scaleDownObjs, withRole(mkMachine("cp-2", "cp-2", running), bootstrapv1beta2.ControlPlaneRoleJoin)...)
 	for _, tc := range []struct {
 		name        string
 		desired     int32
@@ -236,21 +253,28 @@ func TestCanRemoveMember(t *testing.T) {
 		target      *clusterv1.Machine
 		deleting    bool
 		wantAllowed bool
+		objs        []client.Object
 	}{
-		{"teardown bypass allows even at zero quorum", 3, nil, mkMachine("cp-0", "cp-0", running), true, true},
-		{"single-node has no quorum to guard", 1, nil, mkMachine("cp-0", "cp-0", running), false, true},
+		{"teardown bypass allows even at zero quorum", 3, nil, mkMachine("cp-0", "cp-0", running), true, true, nil},
+		{"single-role machine has no quorum to guard", 1, nil, legacySingle, false, true,
+			withRole(legacySingle, bootstrapv1beta2.ControlPlaneRoleSingle)},
+		{"lone etcd member without a report fails closed", 1, nil, mkMachine("cp-0", "cp-0", running), false, false, nil},
+		{"scale-down to one, all healthy, keeps the two-member quorum", 1,
+			map[string]member{"cp-0": {true, true}, "cp-1": {true, true}, "cp-2": {true, true}}, scaleDownTarget, false, true, scaleDownObjs},
+		{"scale-down to one, one down, breaks the two-member quorum", 1,
+			map[string]member{"cp-0": {true, true}, "cp-1": {true, true}, "cp-2": {false, true}}, scaleDownTarget, false, false, scaleDownObjs},
 		{"failed node (no NodeRef) fast-path allows", 3,
-			map[string]member{"cp-1": {true, true}, "cp-2": {true, true}}, mkMachine("cp-0", "", "Provisioning"), false, true},
+			map[string]member{"cp-1": {true, true}, "cp-2": {true, true}}, mkMachine("cp-0", "", "Provisioning"), false, true, nil},
 		{"not-Running node fast-path allows", 3,
-			map[string]member{"cp-1": {true, true}, "cp-2": {true, true}}, mkMachine("cp-0", "cp-0", "Deleting"), false, true},
+			map[string]member{"cp-1": {true, true}, "cp-2": {true, true}}, mkMachine("cp-0", "cp-0", "Deleting"), false, true, nil},
 		{"3-node all healthy, remove one keeps quorum", 3,
-			map[string]member{"cp-0": {true, true}, "cp-1": {true, true}, "cp-2": {true, true}}, mkMachine("cp-0", "cp-0", running), false, true},
+			map[string]member{"cp-0": {true, true}, "cp-1": {true, true}, "cp-2": {true, true}}, mkMachine("cp-0", "cp-0", running), false, true, nil},
 		{"3-node one down, removing a healthy one breaks quorum", 3,
-			map[string]member{"cp-0": {true, true}, "cp-1": {true, true}, "cp-2": {false, true}}, mkMachine("cp-0", "cp-0", running), false, false},
+			map[string]member{"cp-0": {true, true}, "cp-1": {true, true}, "cp-2": {false, true}}, mkMachine("cp-0", "cp-0", running), false, false, nil},
 		{"live node with no etcd report fails closed", 3,
-			map[string]member{"cp-1": {true, true}, "cp-2": {true, true}}, mkMachine("cp-0", "cp-0", running), false, false},
+			map[string]member{"cp-1": {true, true}, "cp-2": {true, true}}, mkMachine("cp-0", "cp-0", running), false, false, nil},
 		{"removing an unhealthy member keeps quorum", 3,
-			map[string]member{"cp-0": {false, true}, "cp-1": {true, true}, "cp-2": {true, true}}, mkMachine("cp-0", "cp-0", running), false, true},
+			map[string]member{"cp-0": {false, true}, "cp-1": {true, true}, "cp-2": {true, true}}, mkMachine("cp-0", "cp-0", running), false, true, nil},
 	} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
@@ -265,7 +289,7 @@ func TestCanRemoveMember(t *testing.T) {
 				now := metav1.Now()
 				kcp.DeletionTimestamp = &now
 			}
-			objs := []client.Object{}
+			objs := append([]client.Object{}, tc.objs...)
 			if tc.members != nil {
 				data := map[string][]byte{}
 				for name, m := range tc.members {
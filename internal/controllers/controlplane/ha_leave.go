@@ -38,17 +38,20 @@ import (
 )
 
 // The etcd-leave handshake (ADR 0005 §E.3). These identifiers are a wire
-// contract shared with the node-side responder rendered by
+// contract shared with the node-side responders rendered by
 // internal/bootstrap/templates/k0s_kairos_cloud_config_capv.yaml.tmpl — the
 // ConfigMap name/namespace, the member key, and the two sentinel values MUST
-// match byte-for-byte or the node never sees its leave request.
+// match byte-for-byte or the node never sees its leave request. k3s and rke2
+// need no responder: their embedded etcd controller removes a member when asked
+// through a Node annotation.
 const (
 	// etcdLeaveHookName is the SUFFIX of the CAPI pre-terminate lifecycle-hook
-	// annotation stamped on k0s HA control-plane Machines. CAPI pauses Machine
+	// annotation stamped on HA control-plane Machines. CAPI pauses Machine
 	// termination *after drain, before infrastructure teardown* (node kubelet +
 	// workload API still up) for as long as any annotation with the
 	// pre-terminate prefix is present, giving the controller a window to drive a
-	// clean `k0s etcd leave`.
+	// clean etcd member removal (`k0s etcd leave`, or the k3s/rke2 removal
+	// annotation).
 	etcdLeaveHookName = "kairos-etcd-leave"
 
 	// etcdLeaveConfigMapName / -Namespace name the workload-cluster ConfigMap the
@@ -58,8 +61,8 @@ const (
 	etcdLeaveConfigMapNamespace = "kube-system"
 
 	// etcdLeaveRequestedValue is the fixed sentinel the controller writes for a
-	// member; etcdLeftValue is the ack the node writes back after `k0s etcd
-	// leave`. Compared by exact string equality on both ends — never eval'd.
+	// member; etcdLeftValue is the ack the node writes back once its member is
+	// removed. Compared by exact string equality on both ends — never eval'd.
 	etcdLeaveRequestedValue = "leave-requested"
 	etcdLeftValue           = "left"
 
@@ -74,8 +77,24 @@ const (
 	// member may be orphaned, and lets the delete proceed (quorum was already
 	// proven safe by canRemoveMember before the delete).
 	memberLeaveTimeout = 5 * time.Minute
+
+	// k3sEtcdRemoveAnnotation asks the k3s etcd controller to remove the
+	// annotated server Node's member; it sets k3sEtcdRemovedAnnotation once the
+	// member is gone. rke2 embeds the same controller under its own domain.
+	k3sEtcdRemoveAnnotation   = "etcd.k3s.cattle.io/remove"
+	k3sEtcdRemovedAnnotation  = "etcd.k3s.cattle.io/removed-node-name"
+	rke2EtcdRemoveAnnotation  = "etcd.rke2.cattle.io/remove"
+	rke2EtcdRemovedAnnotation = "etcd.rke2.cattle.io/removed-node-name"
 )
 
+// etcdRemovalAnnotations are the Node annotations that request the removal of
+// a server's etcd member (remove) and report it done (removed), for the
+// distributions whose embedded etcd controller acts on them.
+var etcdRemovalAnnotations = map[string]struct{ remove, removed string }{
+	"k3s":  {remove: k3sEtcdRemoveAnnotation, removed: k3sEtcdRemovedAnnotation},
+	"rke2": {remove: rke2EtcdRemoveAnnotation, removed: rke2EtcdRemovedAnnotation},
+}
+
 // etcdLeaveHookAnnotation is the full pre-terminate hook annotation key
 // (`<prefix>/<name>`) CAPI recognizes.
 func etcdLeaveHookAnnotation() string {
@@ -98,12 +117,26 @@ func distributionOf(kcp *controlplanev1beta2.KairosControlPlane) string {
 	return kcp.Spec.Distribution
 }
 
+// hasEtcdLeaveResponder reports whether the distribution's HA control-plane
+// nodes render the etcd-leave responder: only k0s, which runs `k0s etcd leave`.
+func hasEtcdLeaveResponder(distribution string) bool {
+	return distribution == "k0s"
+}
+
+// hasCleanEtcdLeave reports whether the controller can remove a departing
+// member of the distribution's etcd: through the node responder, or for k3s
+// and rke2 through the Node removal annotation.
+func hasCleanEtcdLeave(distribution string) bool {
+	_, annotated := etcdRemovalAnnotations[distribution]
+	return hasEtcdLeaveResponder(distribution) || annotated
+}
+
 // shouldStampEtcdLeaveHook decides whether a newly-created control-plane Machine
-// gets the etcd-leave pre-terminate hook: only k0s init/join members. Single-node
-// has no etcd cluster to leave; k3s embedded etcd has no supported member-remove
-// (KD-5d), so neither is hooked.
+// gets the etcd-leave pre-terminate hook: only init/join members of a
+// distribution with a clean etcd leave. Single-node has no etcd cluster to
+// leave.
 func shouldStampEtcdLeaveHook(kcp *controlplanev1beta2.KairosControlPlane, role bootstrapv1beta2.ControlPlaneRole) bool {
-	if distributionOf(kcp) != "k0s" {
+	if !hasCleanEtcdLeave(distributionOf(kcp)) {
 		return false
 	}
 	return role == bootstrapv1beta2.ControlPlaneRoleInit || role == bootstrapv1beta2.ControlPlaneRoleJoin
@@ -138,7 +171,7 @@ func (r *KairosControlPlaneReconciler) defaultWorkloadClient(ctx context.Context
 	return wc, nil
 }
 
-// reconcileMemberLeave drives the clean k0s etcd-leave handshake for a
+// reconcileMemberLeave drives the clean etcd-leave handshake for a
 // control-plane Machine that is being removed and still carries the etcd-leave
 // pre-terminate hook (ADR 0005 §E.3). It is called from the reconcileMachines
 // sweep for any owned, terminating, hooked Machine — which covers the
@@ -152,7 +185,9 @@ func (r *KairosControlPlaneReconciler) defaultWorkloadClient(ctx context.Context
 //     ONLY on NodeRef, never Machine phase: by the time the sweep runs the
 //     Machine is already `Deleting`, so a phase check would fire for every
 //     target and skip the leave for healthy members too.)
-//  2. Non-k0s carrying the hook (should never happen) → remove hook, done.
+//  2. Distribution without a clean etcd leave carrying the hook (should never
+//     happen) → remove hook, done. k3s and rke2 continue in
+//     reconcileAnnotatedMemberRemoval.
 //  3. Node acked `left` in the workload ConfigMap → remove hook, done.
 //  4. Already-requested AND (member gone from etcd-status OR past
 //     memberLeaveTimeout) → remove hook, done (timeout warns: member may be
@@ -170,8 +205,8 @@ func (r *KairosControlPlaneReconciler) reconcileMemberLeave(ctx context.Context,
 		log.Info("etcd-leave: target has no NodeRef; removing hook without leave handshake", "machine", target.Name)
 		return true, r.removeEtcdLeaveHook(ctx, target)
 	}
-	// (2) Defensive: only k0s stamps the hook.
-	if distributionOf(kcp) != "k0s" {
+	// (2) Defensive: only distributions with a clean etcd leave stamp the hook.
+	if !hasCleanEtcdLeave(distributionOf(kcp)) {
 		return true, r.removeEtcdLeaveHook(ctx, target)
 	}
 
@@ -187,6 +222,9 @@ func (r *KairosControlPlaneReconciler) reconcileMemberLeave(ctx context.Context,
 	if err != nil {
 		return false, fmt.Errorf("etcd-leave: build workload client: %w", err)
 	}
+	if _, ok := etcdRemovalAnnotations[distributionOf(kcp)]; ok {
+		return r.reconcileAnnotatedMemberRemoval(ctx, log, kcp, cluster, wc, target)
+	}
 	cmKey := types.NamespacedName{Namespace: etcdLeaveConfigMapNamespace, Name: etcdLeaveConfigMapName}
 
 	// (3) First entry for THIS eviction cycle (no timestamp stamped yet). FORCE the
@@ -222,6 +260,24 @@ func (r *KairosControlPlaneReconciler) reconcileMemberLeave(ctx context.Context,
 		log.Info("etcd-leave: node acked left; removing hook", "machine", target.Name, "node", nodeName)
 		return true, r.removeEtcdLeaveHook(ctx, target)
 	}
+	if done, err := r.finishSettledLeave(ctx, log, kcp, cluster, target); done || err != nil {
+		return done, err
+	}
+
+	// (5) Still waiting: keep the sentinel present (preserving a just-written `left`
+	// against a racy overwrite), then requeue.
+	if err := r.ensureLeaveRequested(ctx, wc, cmKey, nodeName, false); err != nil {
+		return false, err
+	}
+	log.Info("etcd-leave: awaiting node ack", "machine", target.Name, "node", nodeName)
+	return false, nil
+}
+
+// finishSettledLeave removes the hook once a requested leave has settled
+// without an explicit ack: the member is gone from node-reported etcd-status,
+// or memberLeaveTimeout has passed since the request.
+func (r *KairosControlPlaneReconciler) finishSettledLeave(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, target *clusterv1.Machine) (bool, error) {
+	nodeName := target.Status.NodeRef.Name
 	// Member gone from node-reported etcd-status → treat as left. Best-effort: a
 	// read error leaves the member "present" so we keep waiting, never skip.
 	if status, serr := r.readEtcdStatus(ctx, cluster); serr == nil {
@@ -242,13 +298,49 @@ func (r *KairosControlPlaneReconciler) reconcileMemberLeave(ctx context.Context,
 			return true, r.removeEtcdLeaveHook(ctx, target)
 		}
 	}
+	return false, nil
+}
 
-	// (5) Still waiting: keep the sentinel present (preserving a just-written `left`
-	// against a racy overwrite), then requeue.
-	if err := r.ensureLeaveRequested(ctx, wc, cmKey, nodeName, false); err != nil {
-		return false, err
+// reconcileAnnotatedMemberRemoval removes a k3s or rke2 member through the
+// distribution's own etcd controller instead of a node responder: it sets the
+// remove annotation on the workload Node and waits for the removed one. The
+// removal runs on the surviving servers, so no etcdctl is needed on the node.
+// Absence from etcd-status and the timeout end the wait as in the ConfigMap
+// handshake. A missing Node cannot be annotated and is left to those checks.
+func (r *KairosControlPlaneReconciler) reconcileAnnotatedMemberRemoval(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, wc client.Client, target *clusterv1.Machine) (bool, error) {
+	distribution := distributionOf(kcp)
+	annotations := etcdRemovalAnnotations[distribution]
+	nodeName := target.Status.NodeRef.Name
+	node := &corev1.Node{}
+	err := wc.Get(ctx, types.NamespacedName{Name: nodeName}, node)
+	switch {
+	case apierrors.IsNotFound(err):
+		log.Info("etcd-leave: workload Node is gone; cannot request etcd member removal", "machine", target.Name, "node", nodeName, "distribution", distribution)
+	case err != nil:
+		// Read error is fail-safe: hook retained, requeue.
+		return false, fmt.Errorf("etcd-leave: get workload Node %s: %w", nodeName, err)
+	case node.Annotations[annotations.removed] != "":
+		log.Info("etcd-leave: etcd member removed; removing hook", "machine", target.Name, "node", nodeName, "distribution", distribution)
+		return true, r.removeEtcdLeaveHook(ctx, target)
+	case node.Annotations[annotations.remove] != "true":
+		base := node.DeepCopy()
+		if node.Annotations == nil {
+			node.Annotations = map[string]string{}
+		}
+		node.Annotations[annotations.remove] = "true"
+		if err := wc.Patch(ctx, node, client.MergeFrom(base)); err != nil {
+			return false, fmt.Errorf("etcd-leave: annotate workload Node %s for etcd member removal: %w", nodeName, err)
+		}
+		log.Info("etcd-leave: requested etcd member removal", "machine", target.Name, "node", nodeName, "distribution", distribution)
 	}
-	log.Info("etcd-leave: awaiting node ack", "machine", target.Name, "node", nodeName)
+
+	if _, requested := target.Annotations[etcdLeaveRequestedAtAnnotation]; !requested {
+		return false, r.stampLeaveRequestedAt(ctx, target)
+	}
+	if done, err := r.finishSettledLeave(ctx, log, kcp, cluster, target); done || err != nil {
+		return done, err
+	}
+	log.Info("etcd-leave: awaiting etcd member removal", "machine", target.Name, "node", nodeName, "distribution", distribution)
 	return false, nil
 }
 
@@ -313,23 +405,3 @@ func (r *KairosControlPlaneReconciler) removeEtcdLeaveHook(ctx context.Context,
 	}
 	return nil
 }
-
-// warnIfK3sEtcdLimitation emits a Warning event when a k3s HA control-plane
-// member is removed: k3s embedded etcd has no supported member-remove, so the
-// member stays registered after the node is gone (KD-5d). No-op for k0s (which
-// removes members cleanly via the leave handshake) and for single-node (no etcd
-// cluster).
-func (r *KairosControlPlaneReconciler) warnIfK3sEtcdLimitation(kcp *controlplanev1beta2.KairosControlPlane, target *clusterv1.Machine) {
-	if r.Recorder == nil || distributionOf(kcp) == "k0s" {
-		return
-	}
-	desired := int32(1)
-	if kcp.Spec.Replicas != nil {
-		desired = *kcp.Spec.Replicas
-	}
-	if desired <= 1 {
-		return
-	}
-	r.Recorder.Eventf(kcp, corev1.EventTypeWarning, "EtcdMemberRemoveUnsupportedForK3s",
-		"Removing control-plane Machine %q: k3s embedded etcd has no supported member-remove; the etcd member remains registered after the node is gone and may require manual `etcdctl member remove` (KD-5d)", target.Name)
-}
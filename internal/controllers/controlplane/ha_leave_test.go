@@ -23,6 +23,7 @@ import (
 
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
@@ -45,8 +46,9 @@ func TestEtcdLeaveHookAnnotation(t *testing.T) {
 	g.Expect(etcdLeaveHookAnnotation()).To(Equal("pre-terminate.delete.hook.machine.cluster.x-k8s.io/kairos-etcd-leave"))
 }
 
-// TestShouldStampEtcdLeaveHook: only k0s init/join are hooked. Single-node has no
-// etcd cluster; k3s has no supported member-remove (KD-5d).
+// TestShouldStampEtcdLeaveHook: k0s, k3s and rke2 init/join are hooked.
+// Single-node has no etcd cluster; a distribution without a clean etcd leave is
+// never hooked.
 func TestShouldStampEtcdLeaveHook(t *testing.T) {
 	mk := func(dist string) *controlplanev1beta2.KairosControlPlane {
 		return &controlplanev1beta2.KairosControlPlane{Spec: controlplanev1beta2.KairosControlPlaneSpec{Distribution: dist}}
@@ -62,8 +64,12 @@ func TestShouldStampEtcdLeaveHook(t *testing.T) {
 		{"k0s single", mk("k0s"), bootstrapv1beta2.ControlPlaneRoleSingle, false},
 		{"empty dist defaults k0s init", mk(""), bootstrapv1beta2.ControlPlaneRoleInit, true},
 		{"empty dist single", mk(""), bootstrapv1beta2.ControlPlaneRoleSingle, false},
-		{"k3s init", mk("k3s"), bootstrapv1beta2.ControlPlaneRoleInit, false},
-		{"k3s join", mk("k3s"), bootstrapv1beta2.ControlPlaneRoleJoin, false},
+		{"k3s init", mk("k3s"), bootstrapv1beta2.ControlPlaneRoleInit, true},
+		{"k3s join", mk("k3s"), bootstrapv1beta2.ControlPlaneRoleJoin, true},
+		{"k3s single", mk("k3s"), bootstrapv1beta2.ControlPlaneRoleSingle, false},
+		{"rke2 init", mk("rke2"), bootstrapv1beta2.ControlPlaneRoleInit, true},
+		{"rke2 join", mk("rke2"), bootstrapv1beta2.ControlPlaneRoleJoin, true},
+		{"unknown dist join", mk("other"), bootstrapv1beta2.ControlPlaneRoleJoin, false},
 	} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
@@ -145,9 +151,10 @@ func TestReconcileMemberLeave_NoNodeRefFastPath(t *testing.T) {
 	assertHookGone(g, c, "cp-0")
 }
 
-// TestReconcileMemberLeave_NonK0sRemovesHook: defensive — a non-k0s Machine that
-// somehow carries the hook is unblocked without a k0s-specific leave.
-func TestReconcileMemberLeave_NonK0sRemovesHook(t *testing.T) {
+// TestReconcileMemberLeave_NoResponderRemovesHook: defensive — a Machine of a
+// distribution without a clean etcd leave that somehow carries the hook is
+// unblocked without a leave handshake.
+func TestReconcileMemberLeave_NoResponderRemovesHook(t *testing.T) {
 	g := NewWithT(t)
 	scheme := haTestScheme(g)
 	target := hookedMachine("cp-0", "cp-0", nil)
@@ -161,13 +168,80 @@ func TestReconcileMemberLeave_NonK0sRemovesHook(t *testing.T) {
 			return nil, nil
 		},
 	}
+	other := k0sKCP()
+	other.Spec.Distribution = "other"
+	done, err := r.reconcileMemberLeave(context.Background(), log.Log, other, testCluster(), target)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeTrue())
+	g.Expect(factoryCalled).To(BeFalse())
+	assertHookGone(g, c, "cp-0")
+}
+
+// TestReconcileMemberLeave_NodeRemovalAnnotation: a hooked k3s or rke2
+// Machine asks the distribution's etcd controller to remove its member through
+// the Node annotation, writes nothing to the leave ConfigMap, and is released
+// once the distribution reports the member removed.
+func TestReconcileMemberLeave_NodeRemovalAnnotation(t *testing.T) {
+	for _, tc := range []struct{ distribution, remove, removed string }{
+		{"k3s", k3sEtcdRemoveAnnotation, k3sEtcdRemovedAnnotation},
+		{"rke2", rke2EtcdRemoveAnnotation, rke2EtcdRemovedAnnotation},
+	} {
+		t.Run(tc.distribution, func(t *testing.T) {
+			g := NewWithT(t)
+			scheme := haTestScheme(g)
+			target := hookedMachine("cp-0", "cp-0", nil)
+			mgmt := fake.NewClientBuilder().WithScheme(scheme).WithObjects(target, etcdStatusSecretForMembers("cp-0", "cp-1", "cp-2")).Build()
+			wc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "cp-0"}}).Build()
+			r := &KairosControlPlaneReconciler{Client: mgmt, Scheme: scheme, WorkloadClientFactory: staticWorkloadClient(wc)}
+			kcp := k0sKCP()
+			kcp.Spec.Distribution = tc.distribution
+
+			done, err := r.reconcileMemberLeave(context.Background(), log.Log, kcp, testCluster(), target)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(done).To(BeFalse())
+			node := &corev1.Node{}
+			g.Expect(wc.Get(context.Background(), types.NamespacedName{Name: "cp-0"}, node)).To(Succeed())
+			g.Expect(node.Annotations).To(Equal(map[string]string{tc.remove: "true"}))
+			g.Expect(target.Annotations).To(HaveKey(etcdLeaveRequestedAtAnnotation))
+			g.Expect(hasEtcdLeaveHook(target)).To(BeTrue())
+			err = wc.Get(context.Background(), types.NamespacedName{Name: etcdLeaveConfigMapName, Namespace: etcdLeaveConfigMapNamespace}, &corev1.ConfigMap{})
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "%s has no node responder to signal", tc.distribution)
+
+			// Still waiting while the distribution has not removed the member.
+			done, err = r.reconcileMemberLeave(context.Background(), log.Log, kcp, testCluster(), target)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(done).To(BeFalse())
+
+			node.Annotations[tc.removed] = "cp-0-1a2b3c4d"
+			g.Expect(wc.Update(context.Background(), node)).To(Succeed())
+			done, err = r.reconcileMemberLeave(context.Background(), log.Log, kcp, testCluster(), target)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(done).To(BeTrue())
+			assertHookGone(g, mgmt, "cp-0")
+		})
+	}
+}
+
+// TestReconcileMemberLeave_K3sNodeGone: without a Node there is nothing to
+// annotate; the hook is held until the timeout, which warns about a possibly
+// orphaned member.
+func TestReconcileMemberLeave_K3sNodeGone(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	old := time.Now().Add(-2 * memberLeaveTimeout).UTC().Format(time.RFC3339)
+	target := hookedMachine("cp-0", "cp-0", map[string]string{etcdLeaveRequestedAtAnnotation: old})
+	mgmt := fake.NewClientBuilder().WithScheme(scheme).WithObjects(target, etcdStatusSecretForMembers("cp-0", "cp-1", "cp-2")).Build()
+	wc := fake.NewClientBuilder().WithScheme(scheme).Build()
+	rec := record.NewFakeRecorder(4)
+	r := &KairosControlPlaneReconciler{Client: mgmt, Scheme: scheme, Recorder: rec, WorkloadClientFactory: staticWorkloadClient(wc)}
 	k3s := k0sKCP()
 	k3s.Spec.Distribution = "k3s"
+
 	done, err := r.reconcileMemberLeave(context.Background(), log.Log, k3s, testCluster(), target)
 	g.Expect(err).ToNot(HaveOccurred())
 	g.Expect(done).To(BeTrue())
-	g.Expect(factoryCalled).To(BeFalse())
-	assertHookGone(g, c, "cp-0")
+	assertHookGone(g, mgmt, "cp-0")
+	g.Expect(rec.Events).To(Receive(ContainSubstring("EtcdMemberLeaveTimedOut")))
 }
 
 // TestReconcileMemberLeave_WritesRequestThenWaits: first entry writes the
@@ -338,38 +412,6 @@ func TestStripEtcdLeaveHooks_Teardown(t *testing.T) {
 	g.Expect(hasEtcdLeaveHook(gotForeign)).To(BeTrue(), "a Machine owned by a different KCP UID must be left alone")
 }
 
-// TestWarnIfK3sEtcdLimitation: the KD-5d warning fires for multi-replica k3s and
-// stays silent for k0s and for single-node.
-func TestWarnIfK3sEtcdLimitation(t *testing.T) {
-	target := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "cp-0", Namespace: "default"}}
-	for _, tc := range []struct {
-		name     string
-		dist     string
-		replicas int32
-		wantEvt  bool
-	}{
-		{"k3s HA warns", "k3s", 3, true},
-		{"k0s HA silent", "k0s", 3, false},
-		{"k3s single silent", "k3s", 1, false},
-	} {
-		tc := tc
-		t.Run(tc.name, func(t *testing.T) {
-			g := NewWithT(t)
-			rec := record.NewFakeRecorder(4)
-			r := &KairosControlPlaneReconciler{Recorder: rec}
-			kcp := &controlplanev1beta2.KairosControlPlane{Spec: controlplanev1beta2.KairosControlPlaneSpec{
-				Distribution: tc.dist, Replicas: ptr.To(tc.replicas),
-			}}
-			r.warnIfK3sEtcdLimitation(kcp, target)
-			if tc.wantEvt {
-				g.Expect(rec.Events).To(Receive(ContainSubstring("EtcdMemberRemoveUnsupportedForK3s")))
-			} else {
-				g.Expect(rec.Events).ToNot(Receive())
-			}
-		})
-	}
-}
-
 // TestReconcileMemberLeave_StaleLeftDoesNotShortCircuit: a fresh eviction (no
 // requested-at annotation) of a Machine whose workload ConfigMap key still holds
 // a STALE `left` from a prior eviction of a same-named Machine must NOT
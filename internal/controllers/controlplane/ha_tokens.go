@@ -27,6 +27,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
@@ -48,8 +49,8 @@ func joinTokenSecretName(clusterName string) string {
 // (TOKEN-INV: owner-ref'd, label-filtered watch; KD-15). It is idempotent.
 //
 // Distribution behavior (ADR 0005 Phase 3 §3):
-//   - k3s: the controller generates a strong random shared server token ONCE
-//     (crypto/rand). If the Secret already has a non-empty token, it is left
+//   - k3s, rke2: the controller generates a strong random shared server token
+//     ONCE (crypto/rand). If the Secret already has a non-empty token, it is left
 //     untouched (never regenerated — regenerating would orphan the running
 //     etcd cluster's token).
 //   - k0s: the Secret is created EMPTY. The init node mints the controller-join
@@ -81,10 +82,10 @@ func (r *KairosControlPlaneReconciler) ensureJoinTokenSecret(ctx context.Context
 		if secret.Data == nil {
 			secret.Data = map[string][]byte{}
 		}
-		// k3s: generate the shared server token exactly once. Never overwrite an
-		// existing non-empty token. k0s: leave the data empty for the init node
-		// to populate over the node-push channel.
-		if distribution == "k3s" {
+		// k3s/rke2: generate the shared server token exactly once. Never
+		// overwrite an existing non-empty token. k0s: leave the data empty for
+		// the init node to populate over the node-push channel.
+		if distribution == "k3s" || distribution == "rke2" {
 			if len(secret.Data[joinTokenSecretDataKey]) == 0 {
 				tok, genErr := generateJoinToken()
 				if genErr != nil {
@@ -123,8 +124,8 @@ func (r *KairosControlPlaneReconciler) joinTokenSecretValue(ctx context.Context,
 	return string(secret.Data[joinTokenSecretDataKey]), nil
 }
 
-// generateJoinToken returns a strong random join token suitable for use as a k3s
-// shared server token: 32 bytes of crypto/rand entropy, base64url-encoded
+// generateJoinToken returns a strong random join token suitable for use as a
+// k3s or rke2 shared server token: 32 bytes of crypto/rand entropy, base64url-encoded
 // (no padding), so it is shell- and YAML-safe (alphanumerics, '-' and '_'
 // only). Stdlib only (root rule § "No new external dependency").
 func generateJoinToken() (string, error) {
@@ -137,15 +138,22 @@ func generateJoinToken() (string, error) {
 
 // applyControlPlaneHASpec stamps the HA fields onto a control-plane
 // KairosConfig spec for the given role (ADR 0005 Phase 3):
-//   - ControlPlaneRole = role; SingleNode = (role == single) for back-compat.
+//   - ControlPlaneRole = role; SingleNode = (spec.replicas == 1). On an
+//     init/join machine it makes the lone member schedulable (k0s
+//     --enable-worker --no-taints) instead of selecting k0s --single.
 //   - For init/join: point the distribution-appropriate join-token *SecretRef at
 //     the per-cluster join-token Secret (TOKEN-INV: *SecretRef only, never
-//     inline) and copy the VIP block down so the renderer can emit kube-vip.
+//     inline) and copy the VIP and etcd backup blocks down so the renderer
+//     can emit kube-vip and the snapshot timer.
+//   - For the init machine of an etcd restore: the snapshot location.
+//   - For every role: the CNI selection, nil for the distribution default.
 //
-// Single-node clusters get no token ref and no VIP.
+// Single-role machines (created before one-replica control planes became
+// single-member etcd clusters) get no token ref and no VIP.
 func (r *KairosControlPlaneReconciler) applyControlPlaneHASpec(spec *bootstrapv1beta2.KairosConfigSpec, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, role bootstrapv1beta2.ControlPlaneRole) {
 	spec.ControlPlaneRole = role
-	spec.SingleNode = role == bootstrapv1beta2.ControlPlaneRoleSingle
+	spec.SingleNode = role == bootstrapv1beta2.ControlPlaneRoleSingle || ptr.Deref(kcp.Spec.Replicas, 1) <= 1
+	spec.ControlPlaneCNI = controlPlaneCNISpec(kcp)
 
 	if role == bootstrapv1beta2.ControlPlaneRoleSingle {
 		return
@@ -164,7 +172,7 @@ func (r *KairosControlPlaneReconciler) applyControlPlaneHASpec(spec *bootstrapv1
 	case "k3s":
 		// k3s HA reuses the K3sTokenSecretRef plumbing for the shared server token.
 		spec.K3sTokenSecretRef = tokenRef
-	default: // k0s
+	default: // k0s, rke2
 		spec.ControlPlaneJoinTokenSecretRef = tokenRef
 	}
 
@@ -177,4 +185,25 @@ func (r *KairosControlPlaneReconciler) applyControlPlaneHASpec(spec *bootstrapv1
 			Mode:      string(kcp.Spec.HA.VIP.Mode),
 		}
 	}
+
+	// Copy the etcd backup block down; the bootstrap controller resolves the
+	// credentials and renders the snapshot timer on init/join nodes.
+	spec.EtcdBackup = etcdBackupSpec(kcp)
+
+	// The init machine created while restoring starts the cluster from the
+	// snapshot instead of an empty datastore.
+	if st := kcp.Status.EtcdRestore; role == bootstrapv1beta2.ControlPlaneRoleInit && st != nil &&
+		st.Phase == controlplanev1beta2.EtcdRestoreRestoringSnapshot {
+		spec.EtcdRestore = &bootstrapv1beta2.ControlPlaneEtcdRestore{Location: st.Location}
+	}
+}
+
+// controlPlaneCNISpec converts spec.cni into the KairosConfig copy. The
+// distribution default needs nothing rendered, so it is left nil.
+func controlPlaneCNISpec(kcp *controlplanev1beta2.KairosControlPlane) *bootstrapv1beta2.ControlPlaneCNI {
+	c := kcp.Spec.CNI
+	if c == nil || c.Provider == "" || c.Provider == controlplanev1beta2.CNIProviderDefault {
+		return nil
+	}
+	return &bootstrapv1beta2.ControlPlaneCNI{Provider: string(c.Provider)}
 }
@@ -48,29 +48,26 @@ func machineAt(name string) *clusterv1.Machine {
 }
 
 // TestControlPlaneRoleForNewMachine is the role-assignment table (ADR 0005
-// Phase 3 §1), asserting observed output (the returned role) against the
-// (desiredReplicas, existing-machine-count) inputs.
+// Phase 3 §1), asserting observed output (the returned role) against the live
+// etcd members: the first machine is always init, so a one-replica control
+// plane can later take joiners.
 func TestControlPlaneRoleForNewMachine(t *testing.T) {
 	r := &KairosControlPlaneReconciler{}
 
 	tests := []struct {
-		name            string
-		desiredReplicas int32
-		existing        []*clusterv1.Machine
-		want            bootstrapv1beta2.ControlPlaneRole
+		name    string
+		members []*clusterv1.Machine
+		want    bootstrapv1beta2.ControlPlaneRole
 	}{
-		{"replicas 1 -> single", 1, nil, bootstrapv1beta2.ControlPlaneRoleSingle},
-		{"replicas 1 with existing -> single", 1, []*clusterv1.Machine{machineAt("m0")}, bootstrapv1beta2.ControlPlaneRoleSingle},
-		{"replicas 3 empty -> init", 3, nil, bootstrapv1beta2.ControlPlaneRoleInit},
-		{"replicas 3 with init -> join", 3, []*clusterv1.Machine{machineAt("m0")}, bootstrapv1beta2.ControlPlaneRoleJoin},
-		{"replicas 3 with two -> join", 3, []*clusterv1.Machine{machineAt("m0"), machineAt("m1")}, bootstrapv1beta2.ControlPlaneRoleJoin},
-		{"replicas 5 empty -> init", 5, nil, bootstrapv1beta2.ControlPlaneRoleInit},
+		{"no member -> init", nil, bootstrapv1beta2.ControlPlaneRoleInit},
+		{"one member -> join", []*clusterv1.Machine{machineAt("m0")}, bootstrapv1beta2.ControlPlaneRoleJoin},
+		{"two members -> join", []*clusterv1.Machine{machineAt("m0"), machineAt("m1")}, bootstrapv1beta2.ControlPlaneRoleJoin},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			g := NewWithT(t)
-			g.Expect(r.controlPlaneRoleForNewMachine(tc.desiredReplicas, tc.existing)).To(Equal(tc.want))
+			g.Expect(r.controlPlaneRoleForNewMachine(tc.members)).To(Equal(tc.want))
 		})
 	}
 }
@@ -111,6 +108,26 @@ func TestEnsureJoinTokenSecret_K3sIdempotent(t *testing.T) {
 	g.Expect(secret.Data[joinTokenSecretDataKey]).To(Equal(first), "k3s token must not be regenerated")
 }
 
+// TestEnsureJoinTokenSecret_RKE2Generated asserts rke2, like k3s, gets a
+// controller-generated shared server token.
+func TestEnsureJoinTokenSecret_RKE2Generated(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	kcp := &controlplanev1beta2.KairosControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "kcp", Namespace: "default", UID: "kcp-uid"},
+		Spec:       controlplanev1beta2.KairosControlPlaneSpec{Distribution: "rke2", Replicas: ptr.To(int32(3))},
+	}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default"}}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(kcp).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+
+	g.Expect(r.ensureJoinTokenSecret(context.Background(), log.Log, kcp, cluster)).To(Succeed())
+	val, err := r.joinTokenSecretValue(context.Background(), cluster)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(val).ToNot(BeEmpty(), "rke2 token must be generated")
+}
+
 // TestEnsureJoinTokenSecret_K0sEmpty asserts the k0s join-token Secret is created
 // empty — the init node fills it over the node-push channel, not the controller.
 func TestEnsureJoinTokenSecret_K0sEmpty(t *testing.T) {
@@ -161,7 +178,7 @@ func TestApplyControlPlaneHASpec_TokenRefAndVIP(t *testing.T) {
 
 	t.Run("k3s join uses K3sTokenSecretRef + VIP", func(t *testing.T) {
 		kcp := &controlplanev1beta2.KairosControlPlane{Spec: controlplanev1beta2.KairosControlPlaneSpec{
-			Distribution: "k3s", HA: &controlplanev1beta2.HAConfig{VIP: vip},
+			Distribution: "k3s", Replicas: ptr.To(int32(3)), HA: &controlplanev1beta2.HAConfig{VIP: vip},
 		}}
 		r := &KairosControlPlaneReconciler{}
 		spec := &bootstrapv1beta2.KairosConfigSpec{Distribution: "k3s"}
@@ -191,6 +208,31 @@ func TestApplyControlPlaneHASpec_TokenRefAndVIP(t *testing.T) {
 		g.Expect(spec.Token).To(BeEmpty())
 	})
 
+	t.Run("rke2 join uses ControlPlaneJoinTokenSecretRef", func(t *testing.T) {
+		kcp := &controlplanev1beta2.KairosControlPlane{Spec: controlplanev1beta2.KairosControlPlaneSpec{Distribution: "rke2", Replicas: ptr.To(int32(3))}}
+		r := &KairosControlPlaneReconciler{}
+		spec := &bootstrapv1beta2.KairosConfigSpec{Distribution: "rke2"}
+		r.applyControlPlaneHASpec(spec, kcp, cluster, bootstrapv1beta2.ControlPlaneRoleJoin)
+
+		g.Expect(spec.ControlPlaneJoinTokenSecretRef).ToNot(BeNil())
+		g.Expect(spec.ControlPlaneJoinTokenSecretRef.Name).To(Equal(joinTokenSecretName("c")))
+		g.Expect(spec.K3sTokenSecretRef).To(BeNil())
+	})
+
+	t.Run("init on one replica is a schedulable single member with token ref and VIP", func(t *testing.T) {
+		kcp := &controlplanev1beta2.KairosControlPlane{Spec: controlplanev1beta2.KairosControlPlaneSpec{
+			Distribution: "k0s", Replicas: ptr.To(int32(1)), HA: &controlplanev1beta2.HAConfig{VIP: vip},
+		}}
+		r := &KairosControlPlaneReconciler{}
+		spec := &bootstrapv1beta2.KairosConfigSpec{Distribution: "k0s"}
+		r.applyControlPlaneHASpec(spec, kcp, cluster, bootstrapv1beta2.ControlPlaneRoleInit)
+
+		g.Expect(spec.ControlPlaneRole).To(Equal(bootstrapv1beta2.ControlPlaneRoleInit))
+		g.Expect(spec.SingleNode).To(BeTrue())
+		g.Expect(spec.ControlPlaneJoinTokenSecretRef).ToNot(BeNil())
+		g.Expect(spec.ControlPlaneVIP).ToNot(BeNil())
+	})
+
 	t.Run("single gets no token ref and no VIP", func(t *testing.T) {
 		kcp := &controlplanev1beta2.KairosControlPlane{Spec: controlplanev1beta2.KairosControlPlaneSpec{
 			Distribution: "k0s", HA: &controlplanev1beta2.HAConfig{VIP: vip},
@@ -206,3 +248,28 @@ func TestApplyControlPlaneHASpec_TokenRefAndVIP(t *testing.T) {
 		g.Expect(spec.ControlPlaneVIP).To(BeNil())
 	})
 }
+
+// TestApplyControlPlaneHASpec_CNI asserts every role gets the CNI selection,
+// and the distribution default is left unset.
+func TestApplyControlPlaneHASpec_CNI(t *testing.T) {
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "ns"}}
+	for _, role := range []bootstrapv1beta2.ControlPlaneRole{
+		bootstrapv1beta2.ControlPlaneRoleSingle, bootstrapv1beta2.ControlPlaneRoleInit, bootstrapv1beta2.ControlPlaneRoleJoin,
+	} {
+		t.Run(string(role), func(t *testing.T) {
+			g := NewWithT(t)
+			r := &KairosControlPlaneReconciler{}
+			kcp := &controlplanev1beta2.KairosControlPlane{Spec: controlplanev1beta2.KairosControlPlaneSpec{
+				Distribution: "k3s", CNI: &controlplanev1beta2.CNI{Provider: controlplanev1beta2.CNIProviderCilium},
+			}}
+			spec := &bootstrapv1beta2.KairosConfigSpec{Distribution: "k3s"}
+			r.applyControlPlaneHASpec(spec, kcp, cluster, role)
+			g.Expect(spec.ControlPlaneCNI).To(Equal(&bootstrapv1beta2.ControlPlaneCNI{Provider: "cilium"}))
+
+			kcp.Spec.CNI.Provider = controlplanev1beta2.CNIProviderDefault
+			spec = &bootstrapv1beta2.KairosConfigSpec{Distribution: "k3s"}
+			r.applyControlPlaneHASpec(spec, kcp, cluster, role)
+			g.Expect(spec.ControlPlaneCNI).To(BeNil())
+		})
+	}
+}
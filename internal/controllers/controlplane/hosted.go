@@ -0,0 +1,710 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+	"github.com/kairos-io/cluster-api-provider-kairos/internal/bootstrap"
+)
+
+// Ports of the hosted k0s controller: the Kubernetes API, the k0s join API and
+// the konnectivity server the workers' agents dial.
+const (
+	hostedAPIPort          = 6443
+	hostedJoinAPIPort      = 9443
+	hostedKonnectivityPort = 8132
+)
+
+const (
+	// hostedComponentLabel selects the hosted control plane's pods; its value
+	// is the KairosControlPlane name.
+	hostedComponentLabel = "controlplane.cluster.x-k8s.io/hosted-control-plane"
+
+	// hostedConfigHashAnnotation on the pod template carries the hash of the
+	// rendered k0s.yaml, so a new endpoint or CNI rolls the pod.
+	hostedConfigHashAnnotation = "controlplane.cluster.x-k8s.io/hosted-config-hash"
+
+	// hostedDefaultVolumeSize is the data volume size when
+	// spec.hosted.persistence.size is unset.
+	hostedDefaultVolumeSize = "10Gi"
+
+	hostedDataDir   = "/var/lib/k0s"
+	hostedConfigDir = "/etc/kairos-hosted/config"
+	hostedCADir     = "/etc/kairos-hosted/ca"
+)
+
+// hostedManagementKubeconfig is the kubeconfig the worker-token container uses
+// to reach the management cluster with the pod's ServiceAccount token. It is a
+// constant: the namespace and Secret name reach the script through env vars.
+const hostedManagementKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: management
+  cluster:
+    server: https://kubernetes.default.svc
+    certificate-authority: /var/run/secrets/kubernetes.io/serviceaccount/ca.crt
+users:
+- name: worker-token
+  user:
+    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token
+contexts:
+- name: management
+  context:
+    cluster: management
+    user: worker-token
+current-context: management
+`
+
+// hostedInstallCAScript copies the cluster CA from the <cluster>-ca Secret into
+// the k0s PKI directory before k0s starts; k0s signs every other certificate
+// with it, so the controller-written kubeconfig is trusted.
+const hostedInstallCAScript = `set -eu
+mkdir -p ` + hostedDataDir + `/pki
+cp ` + hostedCADir + `/tls.crt ` + hostedDataDir + `/pki/ca.crt
+cp ` + hostedCADir + `/tls.key ` + hostedDataDir + `/pki/ca.key
+chmod 0600 ` + hostedDataDir + `/pki/ca.key
+`
+
+// hostedWorkerTokenScript mints the worker join token once the API is up and
+// publishes it into the controller-created, empty <cluster>-worker-token
+// Secret, the same hand-off the k0s HA init node does for the controller join
+// token. A Secret that already holds a token is left alone, and the check is
+// repeated so a re-created Secret is filled again.
+//
+// SECURITY: like distributionVersionGateScript, the script is a compile-time
+// constant; the Secret's namespace and name arrive as env vars. The token is
+// never echoed.
+const hostedWorkerTokenScript = `set -u
+kube() { k0s kubectl --kubeconfig=` + hostedConfigDir + `/management.conf -n "${SECRET_NAMESPACE}" "$@"; }
+while true; do
+  if current=$(kube get secret "${SECRET_NAME}" -o 'jsonpath={.data.token}') && [ -z "${current}" ]; then
+    if token=$(k0s token create --role=worker --expiry=48h --data-dir=` + hostedDataDir + ` 2>/dev/null) && [ -n "${token}" ]; then
+      data=$(printf '%s' "${token}" | base64 | tr -d '\n')
+      if kube patch secret "${SECRET_NAME}" --type=merge -p "{\"data\":{\"token\":\"${data}\"}}" >/dev/null; then
+        echo "published the worker token to ${SECRET_NAMESPACE}/${SECRET_NAME}"
+      fi
+    fi
+  fi
+  sleep 30
+done
+`
+
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups="",resources=configmaps;serviceaccounts,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch
+
+// hostedName names the hosted control plane's StatefulSet, Service, ConfigMap
+// and ServiceAccount/Role/RoleBinding.
+func hostedName(clusterName string) string {
+	return clusterName + "-k0s-controller"
+}
+
+// hostedCASecretName is the CAPI-conventional cluster CA Secret name.
+func hostedCASecretName(clusterName string) string {
+	return clusterName + "-ca"
+}
+
+// hostedLabels are the labels of every hosted object and the pod selector.
+func hostedLabels(kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) map[string]string {
+	return map[string]string{
+		clusterv1.ClusterNameLabel: cluster.Name,
+		hostedComponentLabel:       kcp.Name,
+	}
+}
+
+// reconcileHosted runs a hosted control plane (spec.hosted): the k0s
+// controller and its etcd run as a one-replica StatefulSet behind a Service
+// in the management cluster. There are no control-plane Machines, so the
+// machine, load-balancer and node-push paths of Reconcile do not apply:
+//
+//  1. the cluster CA is generated into <cluster>-ca and mounted into the pod;
+//  2. the Service address becomes spec.controlPlaneEndpoint and the k0s
+//     api.externalAddress;
+//  3. the controller signs an admin client certificate with the CA and writes
+//     the <cluster>-kubeconfig Secret itself;
+//  4. the pod mints the first worker join token and publishes it into the
+//     empty <cluster>-worker-token Secret, which workers without a token of
+//     their own resolve; reconcileWorkerToken rotates it from then on.
+//
+// Status mirrors the StatefulSet: the control plane is initialized and ready
+// once the pod passes its API readiness probe.
+func (r *KairosControlPlaneReconciler) reconcileHosted(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) (ctrl.Result, error) {
+	wasInitialized := kcp.Status.Initialized
+
+	sts, err := r.ensureHostedControlPlane(ctx, log, kcp, cluster)
+	if err != nil {
+		conditions.MarkFalse(kcp, clusterv1.ReadyCondition, controlplanev1beta2.ControlPlaneInitializationFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+		conditions.MarkFalse(kcp, controlplanev1beta2.AvailableCondition, controlplanev1beta2.ControlPlaneInitializationFailedReason, clusterv1.ConditionSeverityWarning, "%s", err.Error())
+		kcp.Status.FailureReason = controlplanev1beta2.ControlPlaneInitializationFailedReason
+		kcp.Status.FailureMessage = err.Error()
+		if updateErr := r.Status().Update(ctx, kcp); updateErr != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update KCP status: %w", updateErr)
+		}
+		return ctrl.Result{}, err
+	}
+	kcp.Status.FailureReason = ""
+	kcp.Status.FailureMessage = ""
+
+	updateHostedStatus(kcp, cluster, sts)
+	setHostedConditions(kcp, cluster, sts)
+	workerTokenRequeue := r.reconcileWorkerToken(ctx, log, kcp, cluster)
+	certExpiryRequeue := r.setHostedCertificateExpiry(ctx, log, kcp, cluster)
+
+	if err := r.Status().Update(ctx, kcp); err != nil {
+		if apierrors.IsConflict(err) {
+			log.V(4).Info("Conflict updating KCP status, will requeue", "error", err)
+			return ctrl.Result{Requeue: true}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("failed to update KCP status: %w", err)
+	}
+
+	if !wasInitialized && kcp.Status.Initialized {
+		log.Info("Hosted control plane initialized, triggering Cluster reconciliation", "cluster", cluster.Name)
+		if err := r.triggerClusterReconciliation(ctx, log, cluster); err != nil {
+			log.V(4).Info("Failed to trigger Cluster reconciliation", "error", err)
+		}
+	}
+	// The owned Service and StatefulSet wake us on address and readiness
+	// changes; only the worker-token rotation and the certificate expiry
+	// check, which also drives the kubeconfig renewal, are scheduled.
+	requeue := certExpiryRequeue
+	if workerTokenRequeue > 0 && workerTokenRequeue < requeue {
+		requeue = workerTokenRequeue
+	}
+	return ctrl.Result{RequeueAfter: requeue}, nil
+}
+
+// ensureHostedControlPlane creates or updates every hosted object. It returns
+// a nil StatefulSet while the Service has no address yet: k0s needs the
+// external address before its first start, because it is baked into the API
+// server certificate and the worker tokens.
+func (r *KairosControlPlaneReconciler) ensureHostedControlPlane(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) (*appsv1.StatefulSet, error) {
+	caCert, caKey, err := r.ensureHostedCA(ctx, log, kcp, cluster)
+	if err != nil {
+		return nil, err
+	}
+	svc, err := r.ensureHostedService(ctx, kcp, cluster)
+	if err != nil {
+		return nil, err
+	}
+	host := hostedServiceAddress(svc)
+	if host == "" {
+		log.V(4).Info("Waiting for the hosted control-plane Service address", "service", svc.Name)
+		return nil, nil
+	}
+
+	endpoint := clusterv1.APIEndpoint{Host: host, Port: hostedAPIPort}
+	if kcp.Spec.ControlPlaneEndpoint != endpoint {
+		// A bare spec write, like the finalizer add in Reconcile: it bumps the
+		// generation, which this reconcile has now observed.
+		kcp.Spec.ControlPlaneEndpoint = endpoint
+		if err := r.Update(ctx, kcp); err != nil {
+			return nil, fmt.Errorf("set spec.controlPlaneEndpoint: %w", err)
+		}
+		kcp.Status.ObservedGeneration = kcp.Generation
+		log.Info("Set hosted control-plane endpoint", "host", host, "port", hostedAPIPort)
+	}
+
+	if err := r.ensureWorkerTokenSecret(ctx, kcp, cluster); err != nil {
+		return nil, err
+	}
+	if err := r.ensureHostedRBAC(ctx, kcp, cluster); err != nil {
+		return nil, err
+	}
+	configHash, err := r.ensureHostedConfigMap(ctx, kcp, cluster, host, svc)
+	if err != nil {
+		return nil, err
+	}
+	sts, err := r.ensureHostedStatefulSet(ctx, kcp, cluster, svc.Name, configHash)
+	if err != nil {
+		return nil, err
+	}
+	server := "https://" + net.JoinHostPort(host, strconv.Itoa(hostedAPIPort))
+	if err := r.ensureHostedKubeconfig(ctx, log, kcp, cluster, server, caCert, caKey); err != nil {
+		return nil, err
+	}
+	return sts, nil
+}
+
+// ensureHostedCA returns the cluster CA from <cluster>-ca, generating it on
+// first use. The Secret is never rewritten: every certificate k0s issued is
+// signed by it.
+func (r *KairosControlPlaneReconciler) ensureHostedCA(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) ([]byte, []byte, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: hostedCASecretName(cluster.Name), Namespace: cluster.Namespace}
+	err := r.Get(ctx, key, secret)
+	if err == nil {
+		if len(secret.Data[corev1.TLSCertKey]) == 0 || len(secret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+			return nil, nil, fmt.Errorf("cluster CA secret %s has no %s/%s", key, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		}
+		return secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey], nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, nil, fmt.Errorf("get cluster CA secret %s: %w", key, err)
+	}
+
+	certPEM, keyPEM, err := generateHostedCA(cluster.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: cluster.Name},
+		},
+		Type: clusterv1.ClusterSecretType,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}
+	if err := controllerutil.SetControllerReference(kcp, secret, r.Scheme); err != nil {
+		return nil, nil, err
+	}
+	if err := r.Create(ctx, secret); err != nil {
+		return nil, nil, fmt.Errorf("create cluster CA secret %s: %w", key, err)
+	}
+	log.Info("Generated hosted control-plane cluster CA", "secret", key.String())
+	return certPEM, keyPEM, nil
+}
+
+// ensureHostedService exposes the API server, the k0s join API and
+// konnectivity.
+func (r *KairosControlPlaneReconciler) ensureHostedService(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) (*corev1.Service, error) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: hostedName(cluster.Name), Namespace: cluster.Namespace},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, svc, func() error {
+		if svc.Labels == nil {
+			svc.Labels = map[string]string{}
+		}
+		for k, v := range hostedLabels(kcp, cluster) {
+			svc.Labels[k] = v
+		}
+		for k, v := range kcp.Spec.Hosted.Service.Annotations {
+			if svc.Annotations == nil {
+				svc.Annotations = map[string]string{}
+			}
+			svc.Annotations[k] = v
+		}
+		svc.Spec.Type = kcp.Spec.Hosted.Service.Type
+		if svc.Spec.Type == "" {
+			svc.Spec.Type = corev1.ServiceTypeLoadBalancer
+		}
+		svc.Spec.Selector = hostedLabels(kcp, cluster)
+		svc.Spec.Ports = mergeServicePorts(svc.Spec.Ports, []corev1.ServicePort{
+			{Name: "api", Port: hostedAPIPort, TargetPort: intstr.FromInt32(hostedAPIPort), Protocol: corev1.ProtocolTCP},
+			{Name: "k0s-api", Port: hostedJoinAPIPort, TargetPort: intstr.FromInt32(hostedJoinAPIPort), Protocol: corev1.ProtocolTCP},
+			{Name: "konnectivity", Port: hostedKonnectivityPort, TargetPort: intstr.FromInt32(hostedKonnectivityPort), Protocol: corev1.ProtocolTCP},
+		})
+		return controllerutil.SetControllerReference(kcp, svc, r.Scheme)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ensure hosted control-plane service %s/%s: %w", svc.Namespace, svc.Name, err)
+	}
+	return svc, nil
+}
+
+// mergeServicePorts returns want with the node ports the API server already
+// allocated to existing ports of the same name, so an update does not ask
+// for new ones.
+func mergeServicePorts(existing, want []corev1.ServicePort) []corev1.ServicePort {
+	for i := range want {
+		for _, p := range existing {
+			if p.Name == want[i].Name {
+				want[i].NodePort = p.NodePort
+			}
+		}
+	}
+	return want
+}
+
+// hostedServiceAddress returns the address workers reach the Service on: the
+// first load-balancer ingress IP or hostname, or the cluster IP for a
+// ClusterIP Service. "" means the address is not known yet.
+func hostedServiceAddress(svc *corev1.Service) string {
+	if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		if svc.Spec.ClusterIP == corev1.ClusterIPNone {
+			return ""
+		}
+		return svc.Spec.ClusterIP
+	}
+	for _, ing := range svc.Status.LoadBalancer.Ingress {
+		if ing.IP != "" {
+			return ing.IP
+		}
+		if ing.Hostname != "" {
+			return ing.Hostname
+		}
+	}
+	return ""
+}
+
+// ensureHostedRBAC gives the pod's ServiceAccount get/patch on the worker-token
+// Secret and nothing else. The Secret is pre-created, so no create verb
+// (KD-46 minimization).
+func (r *KairosControlPlaneReconciler) ensureHostedRBAC(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) error {
+	name := hostedName(cluster.Name)
+	setMeta := func(obj metav1.Object) {
+		l := obj.GetLabels()
+		if l == nil {
+			l = map[string]string{}
+		}
+		for k, v := range hostedLabels(kcp, cluster) {
+			l[k] = v
+		}
+		obj.SetLabels(l)
+	}
+
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cluster.Namespace}}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, sa, func() error {
+		setMeta(sa)
+		return controllerutil.SetControllerReference(kcp, sa, r.Scheme)
+	}); err != nil {
+		return fmt.Errorf("ensure hosted control-plane serviceaccount: %w", err)
+	}
+
+	role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cluster.Namespace}}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, role, func() error {
+		setMeta(role)
+		role.Rules = []rbacv1.PolicyRule{{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: []string{bootstrapv1beta2.WorkerTokenSecretName(cluster.Name)},
+			Verbs:         []string{"get", "patch"},
+		}}
+		return controllerutil.SetControllerReference(kcp, role, r.Scheme)
+	}); err != nil {
+		return fmt.Errorf("ensure hosted control-plane role: %w", err)
+	}
+
+	binding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: cluster.Namespace}}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, binding, func() error {
+		setMeta(binding)
+		binding.RoleRef = rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: role.Name}
+		binding.Subjects = []rbacv1.Subject{{Kind: "ServiceAccount", Name: sa.Name, Namespace: sa.Namespace}}
+		return controllerutil.SetControllerReference(kcp, binding, r.Scheme)
+	}); err != nil {
+		return fmt.Errorf("ensure hosted control-plane rolebinding: %w", err)
+	}
+	return nil
+}
+
+// ensureHostedConfigMap writes k0s.yaml and the management kubeconfig, and
+// returns the hash of k0s.yaml for the pod template annotation.
+func (r *KairosControlPlaneReconciler) ensureHostedConfigMap(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, host string, svc *corev1.Service) (string, error) {
+	var cni *bootstrap.CNIConfig
+	if c := controlPlaneCNISpec(kcp); c != nil {
+		cni = &bootstrap.CNIConfig{Provider: c.Provider}
+	}
+	k0sConfig, err := bootstrap.RenderHostedK0sConfig(host, cni,
+		svc.Name,
+		svc.Name+"."+svc.Namespace,
+		svc.Name+"."+svc.Namespace+".svc",
+		svc.Spec.ClusterIP,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: hostedName(cluster.Name), Namespace: cluster.Namespace}}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		if cm.Labels == nil {
+			cm.Labels = map[string]string{}
+		}
+		for k, v := range hostedLabels(kcp, cluster) {
+			cm.Labels[k] = v
+		}
+		cm.Data = map[string]string{
+			"k0s.yaml":        k0sConfig,
+			"management.conf": hostedManagementKubeconfig,
+		}
+		return controllerutil.SetControllerReference(kcp, cm, r.Scheme)
+	}); err != nil {
+		return "", fmt.Errorf("ensure hosted control-plane configmap: %w", err)
+	}
+	sum := sha256.Sum256([]byte(k0sConfig))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ensureHostedStatefulSet runs the k0s controller. The selector and the
+// volume claim template are immutable and only set on create; the pod
+// template and replicas follow the spec.
+func (r *KairosControlPlaneReconciler) ensureHostedStatefulSet(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, serviceName, configHash string) (*appsv1.StatefulSet, error) {
+	sts := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: hostedName(cluster.Name), Namespace: cluster.Namespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, sts, func() error {
+		if sts.Labels == nil {
+			sts.Labels = map[string]string{}
+		}
+		for k, v := range hostedLabels(kcp, cluster) {
+			sts.Labels[k] = v
+		}
+		if sts.CreationTimestamp.IsZero() {
+			sts.Spec.Selector = &metav1.LabelSelector{MatchLabels: hostedLabels(kcp, cluster)}
+			sts.Spec.ServiceName = serviceName
+			sts.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{hostedDataVolumeClaim(kcp)}
+			// etcd lives on the claim; drop it with the control plane.
+			sts.Spec.PersistentVolumeClaimRetentionPolicy = &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+				WhenDeleted: appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+				WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+			}
+		}
+		sts.Spec.Replicas = ptr.To(int32(1))
+		sts.Spec.Template = hostedPodTemplate(kcp, cluster, configHash)
+		return controllerutil.SetControllerReference(kcp, sts, r.Scheme)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ensure hosted control-plane statefulset %s/%s: %w", sts.Namespace, sts.Name, err)
+	}
+	return sts, nil
+}
+
+// hostedDataVolumeClaim is the claim template of the k0s data directory.
+func hostedDataVolumeClaim(kcp *controlplanev1beta2.KairosControlPlane) corev1.PersistentVolumeClaim {
+	size := resource.MustParse(hostedDefaultVolumeSize)
+	if s := kcp.Spec.Hosted.Persistence.Size; s != nil {
+		size = *s
+	}
+	return corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: kcp.Spec.Hosted.Persistence.StorageClassName,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+			},
+		},
+	}
+}
+
+// hostedPodTemplate is the k0s controller pod: an init container installs the
+// cluster CA, the k0s container runs the controller (no worker, so no
+// kubelet in the pod), and the worker-token container publishes the worker
+// join token. The two containers share /run/k0s, where `k0s token create`
+// finds the running controller.
+func hostedPodTemplate(kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, configHash string) corev1.PodTemplateSpec {
+	image := controlplanev1beta2.HostedImage(&kcp.Spec)
+	mounts := []corev1.VolumeMount{
+		{Name: "data", MountPath: hostedDataDir},
+		{Name: "config", MountPath: hostedConfigDir, ReadOnly: true},
+		{Name: "run", MountPath: "/run/k0s"},
+	}
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      hostedLabels(kcp, cluster),
+			Annotations: map[string]string{hostedConfigHashAnnotation: configHash},
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: hostedName(cluster.Name),
+			EnableServiceLinks: ptr.To(false),
+			InitContainers: []corev1.Container{{
+				Name:    "install-ca",
+				Image:   image,
+				Command: []string{"sh", "-c", hostedInstallCAScript},
+				VolumeMounts: []corev1.VolumeMount{
+					{Name: "data", MountPath: hostedDataDir},
+					{Name: "ca", MountPath: hostedCADir, ReadOnly: true},
+				},
+			}},
+			Containers: []corev1.Container{
+				{
+					Name:  "k0s",
+					Image: image,
+					Command: []string{"k0s", "controller",
+						"--config=" + hostedConfigDir + "/k0s.yaml",
+						"--data-dir=" + hostedDataDir,
+					},
+					Ports: []corev1.ContainerPort{
+						{Name: "api", ContainerPort: hostedAPIPort, Protocol: corev1.ProtocolTCP},
+						{Name: "k0s-api", ContainerPort: hostedJoinAPIPort, Protocol: corev1.ProtocolTCP},
+						{Name: "konnectivity", ContainerPort: hostedKonnectivityPort, Protocol: corev1.ProtocolTCP},
+					},
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+							Path:   "/readyz",
+							Port:   intstr.FromInt32(hostedAPIPort),
+							Scheme: corev1.URISchemeHTTPS,
+						}},
+						PeriodSeconds: 10,
+					},
+					VolumeMounts: mounts,
+				},
+				{
+					Name:    "worker-token",
+					Image:   image,
+					Command: []string{"sh", "-c", hostedWorkerTokenScript},
+					Env: []corev1.EnvVar{
+						{Name: "SECRET_NAMESPACE", Value: cluster.Namespace},
+						{Name: "SECRET_NAME", Value: bootstrapv1beta2.WorkerTokenSecretName(cluster.Name)},
+					},
+					VolumeMounts: mounts,
+				},
+			},
+			Volumes: []corev1.Volume{
+				{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: hostedName(cluster.Name)},
+				}}},
+				{Name: "ca", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+					SecretName: hostedCASecretName(cluster.Name),
+				}}},
+				{Name: "run", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+}
+
+// ensureHostedKubeconfig writes <cluster>-kubeconfig with an admin client
+// certificate signed by the cluster CA, the controller-side counterpart of the
+// KD-3b node push. The Secret has the node-push shape (cluster Secret type,
+// cluster-name label, Cluster owner) so every reader treats it alike. An
+// existing kubeconfig is kept until the endpoint moves or its client
+// certificate is due for renewal.
+func (r *KairosControlPlaneReconciler) ensureHostedKubeconfig(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, server string, caCert, caKey []byte) error {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: fmt.Sprintf("%s-kubeconfig", cluster.Name), Namespace: cluster.Namespace}
+	err := r.Get(ctx, key, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("get kubeconfig secret %s: %w", key, err)
+	}
+	exists := err == nil
+	moved := !exists || kubeconfigServer(secret.Data["value"]) != server
+	if !moved && !hostedAdminClientRenewal(secret.Data["value"], time.Now()) {
+		return nil
+	}
+
+	kubeconfig, err := hostedAdminKubeconfig(cluster.Name, server, caCert, caKey)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels:    map[string]string{clusterv1.ClusterNameLabel: cluster.Name},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Cluster",
+					Name:       cluster.Name,
+					UID:        cluster.UID,
+					Controller: ptr.To(true),
+				}},
+			},
+			Type: clusterv1.ClusterSecretType,
+			Data: map[string][]byte{"value": kubeconfig},
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			return fmt.Errorf("create kubeconfig secret %s: %w", key, err)
+		}
+		log.Info("Wrote hosted control-plane kubeconfig", "secret", key.String(), "server", server)
+		return nil
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data["value"] = kubeconfig
+	if err := r.Update(ctx, secret); err != nil {
+		return fmt.Errorf("update kubeconfig secret %s: %w", key, err)
+	}
+	if moved {
+		log.Info("Rewrote hosted control-plane kubeconfig for the new endpoint", "secret", key.String(), "server", server)
+	} else {
+		log.Info("Renewed hosted control-plane kubeconfig client certificate", "secret", key.String())
+	}
+	return nil
+}
+
+// updateHostedStatus mirrors the StatefulSet into the replica counts. The
+// control plane is initialized once the pod first passes its API readiness
+// probe and stays so; status.ready follows the current readiness.
+func updateHostedStatus(kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, sts *appsv1.StatefulSet) {
+	var st appsv1.StatefulSetStatus
+	if sts != nil {
+		st = sts.Status
+	}
+	kcp.Status.Replicas = st.Replicas
+	kcp.Status.ReadyReplicas = st.ReadyReplicas
+	kcp.Status.UpdatedReplicas = st.UpdatedReplicas
+	kcp.Status.AvailableReplicas = st.AvailableReplicas
+	kcp.Status.UnavailableReplicas = max(1-st.AvailableReplicas, 0)
+	kcp.Status.Selector = labels.SelectorFromSet(hostedLabels(kcp, cluster)).String()
+	kcp.Status.Ready = st.ReadyReplicas > 0
+	if kcp.Status.Ready {
+		kcp.Status.Initialized = true
+	}
+	initialized := kcp.Status.Initialized
+	kcp.Status.Initialization.ControlPlaneInitialized = &initialized
+}
+
+// setHostedConditions sets Ready, Available and KubeconfigReady for a hosted
+// control plane. The kubeconfig is written as soon as the Service has an
+// address, so KubeconfigReady only waits on the endpoint.
+func setHostedConditions(kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, sts *appsv1.StatefulSet) {
+	if sts == nil {
+		msg := fmt.Sprintf("Waiting for Service %s/%s to get an address", cluster.Namespace, hostedName(cluster.Name))
+		conditions.MarkFalse(kcp, clusterv1.ReadyCondition, controlplanev1beta2.WaitingForHostedControlPlaneEndpointReason, clusterv1.ConditionSeverityInfo, "%s", msg)
+		conditions.MarkFalse(kcp, controlplanev1beta2.AvailableCondition, controlplanev1beta2.WaitingForHostedControlPlaneEndpointReason, clusterv1.ConditionSeverityInfo, "%s", msg)
+		conditions.MarkFalse(kcp, controlplanev1beta2.KubeconfigReadyCondition, controlplanev1beta2.WaitingForHostedControlPlaneEndpointReason, clusterv1.ConditionSeverityInfo, "%s", msg)
+		return
+	}
+
+	kcp.Status.LastNodePushObserved = nil
+	conditions.Set(kcp, &clusterv1.Condition{
+		Type:   controlplanev1beta2.KubeconfigReadyCondition,
+		Status: corev1.ConditionTrue,
+		Reason: controlplanev1beta2.KubeconfigReadyReason,
+	})
+
+	msg := fmt.Sprintf("Waiting for the k0s controller pod of StatefulSet %s/%s to be ready", sts.Namespace, sts.Name)
+	switch {
+	case kcp.Status.Ready:
+		conditions.MarkTrue(kcp, clusterv1.ReadyCondition)
+		conditions.MarkTrue(kcp, controlplanev1beta2.AvailableCondition)
+	case kcp.Status.Initialized:
+		conditions.MarkFalse(kcp, clusterv1.ReadyCondition, controlplanev1beta2.WaitingForHostedControlPlaneReason, clusterv1.ConditionSeverityWarning, "%s", msg)
+		conditions.MarkTrue(kcp, controlplanev1beta2.AvailableCondition)
+	default:
+		conditions.MarkFalse(kcp, clusterv1.ReadyCondition, controlplanev1beta2.WaitingForHostedControlPlaneReason, clusterv1.ConditionSeverityInfo, "%s", msg)
+		conditions.MarkFalse(kcp, controlplanev1beta2.AvailableCondition, controlplanev1beta2.WaitingForHostedControlPlaneReason, clusterv1.ConditionSeverityInfo, "%s", msg)
+	}
+}
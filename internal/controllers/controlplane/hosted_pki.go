@@ -0,0 +1,203 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Lifetimes of the hosted control plane's cluster CA and of the admin client
+// certificate in the kubeconfig Secret. They match the kubeadm defaults.
+const (
+	hostedCAValidity          = 10 * 365 * 24 * time.Hour
+	hostedAdminClientValidity = 365 * 24 * time.Hour
+
+	// hostedAdminClientRenewBefore is how long before its expiry the admin
+	// client certificate is reissued. It is wider than the
+	// CertificatesExpiringSoon window, so a working renewal never raises it.
+	hostedAdminClientRenewBefore = 90 * 24 * time.Hour
+)
+
+// generateHostedCA returns a new self-signed cluster CA as PEM certificate and
+// PKCS#1 key, the layout CAPI's <cluster>-ca Secret and k0s's pki/ca.crt and
+// pki/ca.key use. Stdlib only (root rule § "No new external dependency").
+func generateHostedCA(clusterName string) ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate CA key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "kubernetes", OrganizationalUnit: []string{clusterName}},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(hostedCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sign CA certificate: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		nil
+}
+
+// hostedAdminKubeconfig returns a kubeconfig for server with a system:masters
+// client certificate signed by the cluster CA. The certificate's expiry is
+// the kubeconfig's lifetime; the controller issues a new one when the server
+// changes or hostedAdminClientRenewal says it is due.
+func hostedAdminKubeconfig(clusterName, server string, caCertPEM, caKeyPEM []byte) ([]byte, error) {
+	caCert, caKey, err := parseHostedCA(caCertPEM, caKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generate admin client key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "kubernetes-admin", Organization: []string{"system:masters"}},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(hostedAdminClientValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("sign admin client certificate: %w", err)
+	}
+
+	user := clusterName + "-admin"
+	contextName := user + "@" + clusterName
+	config := clientcmdapi.NewConfig()
+	config.Clusters[clusterName] = &clientcmdapi.Cluster{
+		Server:                   server,
+		CertificateAuthorityData: caCertPEM,
+	}
+	config.AuthInfos[user] = &clientcmdapi.AuthInfo{
+		ClientCertificateData: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		ClientKeyData:         pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	}
+	config.Contexts[contextName] = &clientcmdapi.Context{Cluster: clusterName, AuthInfo: user}
+	config.CurrentContext = contextName
+	out, err := clientcmd.Write(*config)
+	if err != nil {
+		return nil, fmt.Errorf("serialize kubeconfig: %w", err)
+	}
+	return out, nil
+}
+
+// parseHostedCA decodes the <cluster>-ca Secret's certificate and key.
+func parseHostedCA(certPEM, keyPEM []byte) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, errors.New("cluster CA certificate is not PEM")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse cluster CA certificate: %w", err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, errors.New("cluster CA key is not PEM")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse cluster CA key: %w", err)
+	}
+	return cert, key, nil
+}
+
+// kubeconfigServer returns the server URL of a kubeconfig's current context,
+// or "" when it cannot be determined.
+func kubeconfigServer(kubeconfig []byte) string {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return ""
+	}
+	kctx := config.Contexts[config.CurrentContext]
+	if kctx == nil || config.Clusters[kctx.Cluster] == nil {
+		return ""
+	}
+	return config.Clusters[kctx.Cluster].Server
+}
+
+// kubeconfigClientCertificate returns the client certificate of a
+// kubeconfig's current context, or nil when it authenticates some other way.
+func kubeconfigClientCertificate(kubeconfig []byte) (*x509.Certificate, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("parse kubeconfig: %w", err)
+	}
+	kctx := config.Contexts[config.CurrentContext]
+	if kctx == nil || config.AuthInfos[kctx.AuthInfo] == nil {
+		return nil, nil
+	}
+	block, _ := pem.Decode(config.AuthInfos[kctx.AuthInfo].ClientCertificateData)
+	if block == nil {
+		return nil, nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse client certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// hostedAdminClientRenewal reports whether the admin client certificate in
+// kubeconfig is due for reissue at now: it expires within
+// hostedAdminClientRenewBefore, or cannot be read at all.
+func hostedAdminClientRenewal(kubeconfig []byte, now time.Time) bool {
+	cert, err := kubeconfigClientCertificate(kubeconfig)
+	if err != nil || cert == nil {
+		return true
+	}
+	return !cert.NotAfter.After(now.Add(hostedAdminClientRenewBefore))
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
+	if err != nil {
+		return nil, fmt.Errorf("generate certificate serial: %w", err)
+	}
+	return serial, nil
+}
@@ -0,0 +1,395 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+func hostedTestScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := newKCPTestScheme(t)
+	g := NewWithT(t)
+	g.Expect(appsv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(rbacv1.AddToScheme(scheme)).To(Succeed())
+	return scheme
+}
+
+// hostedFixture is a one-replica hosted KCP and its Cluster.
+func hostedFixture() (*controlplanev1beta2.KairosControlPlane, *clusterv1.Cluster) {
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "default", UID: "cluster-uid"},
+		Spec: clusterv1.ClusterSpec{
+			ControlPlaneRef: &corev1.ObjectReference{
+				APIVersion: controlplanev1beta2.GroupVersion.String(),
+				Kind:       "KairosControlPlane",
+				Name:       "hosted-kcp",
+				Namespace:  "default",
+			},
+		},
+	}
+	kcp := &controlplanev1beta2.KairosControlPlane{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "hosted-kcp",
+			Namespace:  "default",
+			Generation: 1,
+			Labels:     map[string]string{clusterv1.ClusterNameLabel: "hosted"},
+			Finalizers: []string{controlplanev1beta2.KairosControlPlaneFinalizer},
+		},
+		Spec: controlplanev1beta2.KairosControlPlaneSpec{
+			Replicas:     ptr.To(int32(1)),
+			Version:      "v1.30.2+k0s.0",
+			Distribution: "k0s",
+			Hosted:       &controlplanev1beta2.HostedControlPlane{},
+		},
+	}
+	return kcp, cluster
+}
+
+func reconcileHostedKCP(t *testing.T, r *KairosControlPlaneReconciler) {
+	t.Helper()
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "hosted-kcp", Namespace: "default"}})
+	NewWithT(t).Expect(err).NotTo(HaveOccurred())
+}
+
+// TestReconcileHosted_WaitsForServiceAddress: before the LoadBalancer has an
+// address only the CA and the Service exist; k0s is not started, because the
+// address is baked into its certificates.
+func TestReconcileHosted_WaitsForServiceAddress(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	scheme := hostedTestScheme(t)
+	kcp, cluster := hostedFixture()
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(kcp, cluster).
+		WithStatusSubresource(&controlplanev1beta2.KairosControlPlane{}).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+
+	reconcileHostedKCP(t, r)
+
+	ca := &corev1.Secret{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: "hosted-ca", Namespace: "default"}, ca)).To(Succeed())
+	g.Expect(ca.Type).To(Equal(clusterv1.ClusterSecretType))
+	g.Expect(ca.Data).To(HaveKey(corev1.TLSCertKey))
+	g.Expect(ca.Data).To(HaveKey(corev1.TLSPrivateKeyKey))
+
+	svc := &corev1.Service{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: "hosted-k0s-controller", Namespace: "default"}, svc)).To(Succeed())
+	g.Expect(svc.Spec.Type).To(Equal(corev1.ServiceTypeLoadBalancer))
+	g.Expect(svc.Spec.Ports).To(HaveLen(3))
+
+	sts := &appsv1.StatefulSet{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: "hosted-k0s-controller", Namespace: "default"}, sts)).NotTo(Succeed())
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: "hosted-kubeconfig", Namespace: "default"}, &corev1.Secret{})).NotTo(Succeed())
+
+	got := &controlplanev1beta2.KairosControlPlane{}
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(kcp), got)).To(Succeed())
+	g.Expect(got.Spec.ControlPlaneEndpoint.IsZero()).To(BeTrue())
+	g.Expect(got.Status.Ready).To(BeFalse())
+	g.Expect(conditions.GetReason(got, controlplanev1beta2.KubeconfigReadyCondition)).To(Equal(controlplanev1beta2.WaitingForHostedControlPlaneEndpointReason))
+	g.Expect(conditions.GetReason(got, clusterv1.ReadyCondition)).To(Equal(controlplanev1beta2.WaitingForHostedControlPlaneEndpointReason))
+}
+
+// TestReconcileHosted_Lifecycle drives a hosted control plane from the
+// LoadBalancer address to a ready pod, with the test standing in for the
+// StatefulSet controller.
+func TestReconcileHosted_Lifecycle(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	scheme := hostedTestScheme(t)
+	kcp, cluster := hostedFixture()
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(kcp, cluster).
+		WithStatusSubresource(&controlplanev1beta2.KairosControlPlane{}, &appsv1.StatefulSet{}).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+	name := types.NamespacedName{Name: "hosted-k0s-controller", Namespace: "default"}
+
+	reconcileHostedKCP(t, r)
+
+	svc := &corev1.Service{}
+	g.Expect(c.Get(ctx, name, svc)).To(Succeed())
+	svc.Spec.ClusterIP = "10.96.0.20"
+	g.Expect(c.Update(ctx, svc)).To(Succeed())
+	svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "192.0.2.10"}}
+	g.Expect(c.Status().Update(ctx, svc)).To(Succeed())
+
+	reconcileHostedKCP(t, r)
+
+	got := &controlplanev1beta2.KairosControlPlane{}
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(kcp), got)).To(Succeed())
+	g.Expect(got.Spec.ControlPlaneEndpoint).To(Equal(clusterv1.APIEndpoint{Host: "192.0.2.10", Port: 6443}))
+
+	// The k0s controller StatefulSet runs the version's image with the
+	// rendered config.
+	sts := &appsv1.StatefulSet{}
+	g.Expect(c.Get(ctx, name, sts)).To(Succeed())
+	g.Expect(sts.Spec.Replicas).To(Equal(ptr.To(int32(1))))
+	g.Expect(sts.Spec.VolumeClaimTemplates).To(HaveLen(1))
+	g.Expect(sts.Spec.Template.Spec.Containers).To(HaveLen(2))
+	g.Expect(sts.Spec.Template.Spec.Containers[0].Image).To(Equal("quay.io/k0sproject/k0s:v1.30.2-k0s.0"))
+	g.Expect(sts.Spec.Template.Annotations).To(HaveKey(hostedConfigHashAnnotation))
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(c.Get(ctx, name, cm)).To(Succeed())
+	g.Expect(cm.Data["k0s.yaml"]).To(ContainSubstring("externalAddress: 192.0.2.10"))
+	g.Expect(cm.Data["k0s.yaml"]).To(ContainSubstring("10.96.0.20"))
+
+	// The worker-token Secret is created empty, for the pod to publish into.
+	workerToken := &corev1.Secret{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: "hosted-worker-token", Namespace: "default"}, workerToken)).To(Succeed())
+	g.Expect(workerToken.Data).To(BeEmpty())
+	g.Expect(workerToken.Labels).To(HaveKeyWithValue(controlPlaneJoinTokenSecretTypeLabel, bootstrapv1beta2.WorkerTokenSecretTypeValue))
+	g.Expect(workerToken.Labels).To(HaveKeyWithValue(clusterv1.ClusterNameLabel, "hosted"))
+
+	role := &rbacv1.Role{}
+	g.Expect(c.Get(ctx, name, role)).To(Succeed())
+	g.Expect(role.Rules).To(HaveLen(1))
+	g.Expect(role.Rules[0].ResourceNames).To(Equal([]string{"hosted-worker-token"}))
+	g.Expect(role.Rules[0].Verbs).To(Equal([]string{"get", "patch"}))
+
+	// The kubeconfig points at the endpoint and its client certificate is
+	// signed by the cluster CA.
+	kubeconfigSecret := &corev1.Secret{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: "hosted-kubeconfig", Namespace: "default"}, kubeconfigSecret)).To(Succeed())
+	g.Expect(kubeconfigSecret.Type).To(Equal(clusterv1.ClusterSecretType))
+	g.Expect(kubeconfigSecret.OwnerReferences).To(HaveLen(1))
+	g.Expect(kubeconfigSecret.OwnerReferences[0].Kind).To(Equal("Cluster"))
+	ca := &corev1.Secret{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: "hosted-ca", Namespace: "default"}, ca)).To(Succeed())
+	assertKubeconfigSignedBy(g, kubeconfigSecret.Data["value"], "https://192.0.2.10:6443", ca.Data[corev1.TLSCertKey])
+
+	g.Expect(got.Status.Ready).To(BeFalse())
+	g.Expect(got.Status.Initialized).To(BeFalse())
+	g.Expect(conditions.IsTrue(got, controlplanev1beta2.KubeconfigReadyCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(got, clusterv1.ReadyCondition)).To(Equal(controlplanev1beta2.WaitingForHostedControlPlaneReason))
+
+	// The pod passes its readiness probe.
+	sts.Status = appsv1.StatefulSetStatus{Replicas: 1, ReadyReplicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	g.Expect(c.Status().Update(ctx, sts)).To(Succeed())
+
+	reconcileHostedKCP(t, r)
+
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(kcp), got)).To(Succeed())
+	g.Expect(got.Status.Ready).To(BeTrue())
+	g.Expect(got.Status.Initialized).To(BeTrue())
+	g.Expect(got.Status.Initialization.ControlPlaneInitialized).To(Equal(ptr.To(true)))
+	g.Expect(got.Status.ReadyReplicas).To(Equal(int32(1)))
+	g.Expect(got.Status.UnavailableReplicas).To(Equal(int32(0)))
+	g.Expect(conditions.IsTrue(got, clusterv1.ReadyCondition)).To(BeTrue())
+	g.Expect(conditions.IsTrue(got, controlplanev1beta2.AvailableCondition)).To(BeTrue())
+
+	// The kubeconfig client certificate is the tracked certificate expiry.
+	g.Expect(got.Status.EarliestCertificateExpiry).NotTo(BeNil())
+	g.Expect(got.Status.EarliestCertificateExpiry.Name).To(Equal(kubeconfigCertificateName))
+	g.Expect(conditions.IsFalse(got, controlplanev1beta2.CertificatesExpiringSoonCondition)).To(BeTrue())
+
+	// Losing the pod keeps the control plane initialized but not ready.
+	sts.Status = appsv1.StatefulSetStatus{Replicas: 1}
+	g.Expect(c.Status().Update(ctx, sts)).To(Succeed())
+
+	reconcileHostedKCP(t, r)
+
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(kcp), got)).To(Succeed())
+	g.Expect(got.Status.Ready).To(BeFalse())
+	g.Expect(got.Status.Initialized).To(BeTrue())
+	g.Expect(conditions.GetSeverity(got, clusterv1.ReadyCondition)).To(Equal(ptr.To(clusterv1.ConditionSeverityWarning)))
+	g.Expect(conditions.IsTrue(got, controlplanev1beta2.AvailableCondition)).To(BeTrue())
+}
+
+// TestReconcileHosted_KubeconfigFollowsEndpoint: a kubeconfig for an old
+// address is reissued when the Service address moves.
+func TestReconcileHosted_KubeconfigFollowsEndpoint(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	scheme := hostedTestScheme(t)
+	kcp, cluster := hostedFixture()
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "hosted-k0s-controller", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+			Ingress: []corev1.LoadBalancerIngress{{Hostname: "cp.example.com"}},
+		}},
+	}
+	stale := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "hosted-kubeconfig", Namespace: "default"},
+		Data:       map[string][]byte{"value": []byte("apiVersion: v1\nkind: Config\n")},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(kcp, cluster, svc, stale).
+		WithStatusSubresource(&controlplanev1beta2.KairosControlPlane{}).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+
+	reconcileHostedKCP(t, r)
+
+	got := &corev1.Secret{}
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(stale), got)).To(Succeed())
+	g.Expect(kubeconfigServer(got.Data["value"])).To(Equal("https://cp.example.com:6443"))
+}
+
+// TestReconcileHosted_RenewsKubeconfigCertificate: a kubeconfig for the
+// current address is reissued once its client certificate is within
+// hostedAdminClientRenewBefore of expiry, and kept before that.
+func TestReconcileHosted_RenewsKubeconfigCertificate(t *testing.T) {
+	const server = "https://cp.example.com:6443"
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		renewed   bool
+	}{
+		{name: "fresh certificate is kept", expiresIn: hostedAdminClientRenewBefore + 24*time.Hour},
+		{name: "expiring certificate is reissued", expiresIn: 30 * 24 * time.Hour, renewed: true},
+		{name: "expired certificate is reissued", expiresIn: -time.Hour, renewed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+			scheme := hostedTestScheme(t)
+			kcp, cluster := hostedFixture()
+			svc := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "hosted-k0s-controller", Namespace: "default"},
+				Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+				Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{Hostname: "cp.example.com"}},
+				}},
+			}
+			caCert, caKey, err := generateHostedCA(cluster.Name)
+			g.Expect(err).NotTo(HaveOccurred())
+			ca := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "hosted-ca", Namespace: "default"},
+				Data:       map[string][]byte{corev1.TLSCertKey: caCert, corev1.TLSPrivateKeyKey: caKey},
+			}
+			kubeconfig := hostedAdminKubeconfigExpiringIn(t, server, caCert, caKey, tt.expiresIn)
+			existing := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "hosted-kubeconfig", Namespace: "default"},
+				Data:       map[string][]byte{"value": kubeconfig},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(kcp, cluster, svc, ca, existing).
+				WithStatusSubresource(&controlplanev1beta2.KairosControlPlane{}).Build()
+			r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+
+			reconcileHostedKCP(t, r)
+
+			got := &corev1.Secret{}
+			g.Expect(c.Get(ctx, client.ObjectKeyFromObject(existing), got)).To(Succeed())
+			if !tt.renewed {
+				g.Expect(got.Data["value"]).To(Equal(kubeconfig))
+				return
+			}
+			g.Expect(got.Data["value"]).NotTo(Equal(kubeconfig))
+			assertKubeconfigSignedBy(g, got.Data["value"], server, caCert)
+			cert, err := kubeconfigClientCertificate(got.Data["value"])
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(cert.NotAfter).To(BeTemporally("~", time.Now().Add(hostedAdminClientValidity), time.Minute))
+		})
+	}
+}
+
+// hostedAdminKubeconfigExpiringIn returns an admin kubeconfig for server
+// whose client certificate, re-signed by the cluster CA, expires in
+// expiresIn.
+func hostedAdminKubeconfigExpiringIn(t *testing.T, server string, caCertPEM, caKeyPEM []byte, expiresIn time.Duration) []byte {
+	t.Helper()
+	g := NewWithT(t)
+	kubeconfig, err := hostedAdminKubeconfig("hosted", server, caCertPEM, caKeyPEM)
+	g.Expect(err).NotTo(HaveOccurred())
+	caCert, caKey, err := parseHostedCA(caCertPEM, caKeyPEM)
+	g.Expect(err).NotTo(HaveOccurred())
+	cert, err := kubeconfigClientCertificate(kubeconfig)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	tmpl := *cert
+	tmpl.NotBefore = time.Now().Add(-hostedAdminClientValidity)
+	tmpl.NotAfter = time.Now().Add(expiresIn)
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, caCert, cert.PublicKey, caKey)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	config, err := clientcmd.Load(kubeconfig)
+	g.Expect(err).NotTo(HaveOccurred())
+	auth := config.AuthInfos[config.Contexts[config.CurrentContext].AuthInfo]
+	auth.ClientCertificateData = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	out, err := clientcmd.Write(*config)
+	g.Expect(err).NotTo(HaveOccurred())
+	return out
+}
+
+func TestHostedServiceAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		svc  corev1.Service
+		want string
+	}{
+		{"load balancer without ingress", corev1.Service{Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, ClusterIP: "10.0.0.1"}}, ""},
+		{"load balancer IP", corev1.Service{
+			Spec:   corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+			Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "192.0.2.1", Hostname: "lb.example.com"}}}},
+		}, "192.0.2.1"},
+		{"load balancer hostname", corev1.Service{
+			Spec:   corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+			Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{Hostname: "lb.example.com"}}}},
+		}, "lb.example.com"},
+		{"cluster IP", corev1.Service{Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ClusterIP: "10.0.0.1"}}, "10.0.0.1"},
+		{"cluster IP not allocated", corev1.Service{Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			NewWithT(t).Expect(hostedServiceAddress(&tt.svc)).To(Equal(tt.want))
+		})
+	}
+}
+
+// assertKubeconfigSignedBy checks the kubeconfig's server and that its client
+// certificate chains to caPEM.
+func assertKubeconfigSignedBy(g *WithT, kubeconfig []byte, server string, caPEM []byte) {
+	config, err := clientcmd.Load(kubeconfig)
+	g.Expect(err).NotTo(HaveOccurred())
+	kctx := config.Contexts[config.CurrentContext]
+	g.Expect(kctx).NotTo(BeNil())
+	g.Expect(config.Clusters[kctx.Cluster].Server).To(Equal(server))
+	g.Expect(config.Clusters[kctx.Cluster].CertificateAuthorityData).To(Equal(caPEM))
+
+	block, _ := pem.Decode(config.AuthInfos[kctx.AuthInfo].ClientCertificateData)
+	g.Expect(block).NotTo(BeNil())
+	cert, err := x509.ParseCertificate(block.Bytes)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cert.Subject.Organization).To(ContainElement("system:masters"))
+
+	roots := x509.NewCertPool()
+	g.Expect(roots.AppendCertsFromPEM(caPEM)).To(BeTrue())
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	g.Expect(err).NotTo(HaveOccurred())
+}
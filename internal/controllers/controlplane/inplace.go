@@ -0,0 +1,542 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+	"github.com/kairos-io/cluster-api-provider-kairos/internal/bootstrap"
+)
+
+// In-place rollout (spec.rolloutStrategy.type=InPlace). Instead of replacing an
+// outdated control-plane machine, the controller asks the kairos-operator in
+// the workload cluster to upgrade the node's Kairos image through its A/B
+// partitions. Nodes go one at a time; the next node starts only once the
+// previous one runs spec.version again and canRemoveMember agrees that taking
+// it down for the reboot keeps etcd quorum.
+//
+// The machine being upgraded carries inPlaceUpgradeAnnotation (value: target
+// image) for the whole upgrade, so a controller restart resumes the same node
+// instead of starting a second one.
+//
+// Before the upgrade, a NodeOp records spec.version in
+// bootstrap.InPlaceUpgradeVersionFile on the node. The cloud-config rewrites
+// the version gate's env file with the provisioning-time release on every
+// boot, so without the record the gate would refuse to start the distribution
+// from the upgraded image.
+const (
+	inPlaceUpgradeAnnotation = "controlplane.cluster.x-k8s.io/in-place-upgrade"
+
+	// inPlaceVersionAnnotation carries the release a version-record NodeOp
+	// writes, so a spec.version change mid-upgrade replaces it.
+	inPlaceVersionAnnotation = "controlplane.cluster.x-k8s.io/in-place-upgrade-version"
+
+	// nodeOpHostMountPath is where a NodeOp container sees the host root.
+	nodeOpHostMountPath = "/host"
+
+	// inPlaceUpgradeRequeueAfter paces polling of a running upgrade; an A/B
+	// upgrade plus reboot takes minutes.
+	inPlaceUpgradeRequeueAfter = 30 * time.Second
+
+	// NodeOpUpgrade status.phase values written by the kairos-operator.
+	nodeOpPhaseCompleted = "Completed"
+	nodeOpPhaseFailed    = "Failed"
+)
+
+// nodeOpUpgradeGVK is the kairos-operator upgrade CRD. It is handled as
+// unstructured so the operator's Go module is not a dependency.
+var nodeOpUpgradeGVK = schema.GroupVersionKind{Group: "operator.kairos.io", Version: "v1alpha1", Kind: "NodeOpUpgrade"}
+
+// nodeOpGVK is the kairos-operator generic node operation CRD, used to write
+// the version record.
+var nodeOpGVK = schema.GroupVersionKind{Group: "operator.kairos.io", Version: "v1alpha1", Kind: "NodeOp"}
+
+// isInPlaceRollout reports whether the KCP uses the InPlace rollout strategy.
+func isInPlaceRollout(kcp *controlplanev1beta2.KairosControlPlane) bool {
+	s := kcp.Spec.RolloutStrategy
+	return s != nil && s.Type == controlplanev1beta2.InPlaceStrategyType && s.InPlace != nil && s.InPlace.Image != ""
+}
+
+// needsInPlaceUpgrade reports whether the InPlace strategy handles this
+// machine: its spec hash is current but its Kubernetes version is not. A spec
+// hash mismatch cannot be delivered by an image upgrade and is left to the
+// replacement path.
+func (r *KairosControlPlaneReconciler) needsInPlaceUpgrade(machine *clusterv1.Machine, kcp *controlplanev1beta2.KairosControlPlane, specHash string) bool {
+	return isInPlaceRollout(kcp) &&
+		machine.DeletionTimestamp.IsZero() &&
+		machineMatchesSpecHash(machine, specHash) &&
+		!r.machineMatchesVersion(machine, kcp.Spec.Version)
+}
+
+// inPlaceUpgradeNamespace returns the workload-cluster namespace of the
+// NodeOp and NodeOpUpgrade objects.
+func inPlaceUpgradeNamespace(kcp *controlplanev1beta2.KairosControlPlane) string {
+	if s := kcp.Spec.RolloutStrategy; s != nil && s.InPlace != nil && s.InPlace.Namespace != "" {
+		return s.InPlace.Namespace
+	}
+	return controlplanev1beta2.DefaultInPlaceUpgradeNamespace
+}
+
+// nodeOpUpgradeName is the NodeOpUpgrade name for a machine. Machine names are
+// unique per namespace and fit the workload cluster's name limits.
+func nodeOpUpgradeName(machine *clusterv1.Machine) string {
+	return "kairos-capi-" + machine.Name
+}
+
+// versionRecordName is the name of the machine's version-record NodeOp.
+func versionRecordName(machine *clusterv1.Machine) string {
+	return "kairos-capi-" + machine.Name + "-version"
+}
+
+// reconcileInPlaceRollout drives one step of an InPlace rollout. It returns
+// done=true when no machine needs an in-place upgrade, so reconcileMachines can
+// carry on with scaling; otherwise the returned result requeues.
+func (r *KairosControlPlaneReconciler) reconcileInPlaceRollout(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, machines []*clusterv1.Machine, specHash string) (ctrl.Result, bool, error) {
+	image := kcp.Spec.RolloutStrategy.InPlace.Image
+
+	var pending []*clusterv1.Machine
+	var target *clusterv1.Machine
+	for _, m := range machines {
+		if !r.needsInPlaceUpgrade(m, kcp, specHash) {
+			continue
+		}
+		pending = append(pending, m)
+		if _, ok := m.Annotations[inPlaceUpgradeAnnotation]; ok && target == nil {
+			target = m
+		}
+	}
+	pruneInPlaceUpgrades(kcp, machines, image)
+	if err := r.releaseStaleInPlaceClaims(ctx, kcp, machines, specHash); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	if len(pending) == 0 {
+		if len(kcp.Status.InPlaceUpgrades) > 0 {
+			conditions.MarkTrue(kcp, controlplanev1beta2.InPlaceUpgradeCondition)
+		}
+		return ctrl.Result{}, true, nil
+	}
+	for _, m := range pending {
+		if m != target {
+			setInPlaceUpgrade(kcp, m, image, controlplanev1beta2.InPlaceUpgradePending, "Waiting for its turn")
+		}
+	}
+
+	if target == nil {
+		var ok bool
+		var err error
+		target, ok, err = r.startInPlaceUpgrade(ctx, log, kcp, cluster, machines, pending[0], image)
+		if err != nil || !ok {
+			return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, false, err
+		}
+	}
+	return r.progressInPlaceUpgrade(ctx, log, kcp, cluster, target, image)
+}
+
+// startInPlaceUpgrade gates and claims the next machine. Every control-plane
+// machine must be up (NodeRef set, Running), EtcdHealthy must be True on an HA
+// control plane, and canRemoveMember must agree that taking the target down for
+// its reboot keeps etcd quorum — the same fail-closed guard that protects
+// rollout and scale-down deletes.
+func (r *KairosControlPlaneReconciler) startInPlaceUpgrade(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, machines []*clusterv1.Machine, next *clusterv1.Machine, image string) (*clusterv1.Machine, bool, error) {
+	wait := func(reason, msg string) (*clusterv1.Machine, bool, error) {
+		setInPlaceUpgrade(kcp, next, image, controlplanev1beta2.InPlaceUpgradePending, msg)
+		conditions.MarkFalse(kcp, controlplanev1beta2.InPlaceUpgradeCondition, reason, clusterv1.ConditionSeverityInfo, "%s: %s", next.Name, msg)
+		log.Info("Holding back in-place upgrade", "machine", next.Name, "reason", msg)
+		return nil, false, nil
+	}
+
+	for _, m := range machines {
+		if m.Status.NodeRef == nil || m.Status.Phase != string(clusterv1.MachinePhaseRunning) || !m.DeletionTimestamp.IsZero() {
+			return wait(controlplanev1beta2.InPlaceUpgradeInProgressReason,
+				fmt.Sprintf("waiting for machine %s to be running before upgrading the next node", m.Name))
+		}
+	}
+	if desired := ptr.Deref(kcp.Spec.Replicas, 1); desired > 1 && !conditions.IsTrue(kcp, controlplanev1beta2.EtcdHealthyCondition) {
+		return wait(controlplanev1beta2.WaitingForEtcdQuorumReason, "waiting for every etcd member to report healthy")
+	}
+	if ok, reason, err := r.canRemoveMember(ctx, kcp, cluster, next); err != nil {
+		return nil, false, fmt.Errorf("failed to evaluate etcd quorum safety: %w", err)
+	} else if !ok {
+		return wait(controlplanev1beta2.WaitingForEtcdQuorumReason, reason)
+	}
+
+	helper, err := patch.NewHelper(next, r.Client)
+	if err != nil {
+		return nil, false, err
+	}
+	if next.Annotations == nil {
+		next.Annotations = map[string]string{}
+	}
+	next.Annotations[inPlaceUpgradeAnnotation] = image
+	if err := helper.Patch(ctx, next); err != nil {
+		return nil, false, fmt.Errorf("failed to claim machine %s for in-place upgrade: %w", next.Name, err)
+	}
+	log.Info("Starting in-place upgrade", "machine", next.Name, "image", image)
+	return next, true, nil
+}
+
+// progressInPlaceUpgrade records spec.version on the claimed machine's node,
+// then ensures its NodeOpUpgrade exists with the current image and maps its
+// phase onto the machine's status entry. On success it records spec.version on
+// the Machine and its KairosConfig, releases the claim and deletes both
+// operator objects.
+func (r *KairosControlPlaneReconciler) progressInPlaceUpgrade(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, target *clusterv1.Machine, image string) (ctrl.Result, bool, error) {
+	requeue := ctrl.Result{RequeueAfter: inPlaceUpgradeRequeueAfter}
+	if target.Status.NodeRef == nil {
+		setInPlaceUpgrade(kcp, target, image, controlplanev1beta2.InPlaceUpgradeUpgrading, "Waiting for the node to register")
+		return requeue, false, nil
+	}
+
+	factory := r.WorkloadClientFactory
+	if factory == nil {
+		factory = r.defaultWorkloadClient
+	}
+	wc, err := factory(ctx, cluster)
+	if err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("in-place upgrade: build workload client: %w", err)
+	}
+
+	record, err := r.ensureVersionRecord(ctx, wc, kcp, target, image)
+	if err != nil {
+		return ctrl.Result{}, false, err
+	}
+	if record == nil {
+		setInPlaceUpgrade(kcp, target, image, controlplanev1beta2.InPlaceUpgradeUpgrading, "Restarting with the new version")
+		return requeue, false, nil
+	}
+	recordPhase, _, _ := unstructured.NestedString(record.Object, "status", "phase")
+	recordMessage, _, _ := unstructured.NestedString(record.Object, "status", "message")
+	switch recordPhase {
+	case nodeOpPhaseCompleted:
+	case nodeOpPhaseFailed:
+		message := fmt.Sprintf("recording release %s on the node failed", kcp.Spec.Version)
+		if recordMessage != "" {
+			message += ": " + recordMessage
+		}
+		setInPlaceUpgrade(kcp, target, image, controlplanev1beta2.InPlaceUpgradeFailed, message)
+		conditions.MarkFalse(kcp, controlplanev1beta2.InPlaceUpgradeCondition,
+			controlplanev1beta2.InPlaceUpgradeFailedReason, clusterv1.ConditionSeverityWarning,
+			"In-place upgrade of %s failed: %s", target.Name, message)
+		return requeue, false, nil
+	default:
+		setInPlaceUpgrade(kcp, target, image, controlplanev1beta2.InPlaceUpgradeUpgrading, "Recording the target release on the node")
+		conditions.MarkFalse(kcp, controlplanev1beta2.InPlaceUpgradeCondition,
+			controlplanev1beta2.InPlaceUpgradeInProgressReason, clusterv1.ConditionSeverityInfo,
+			"Upgrading %s to %s", target.Name, image)
+		return requeue, false, nil
+	}
+
+	op, err := r.ensureNodeOpUpgrade(ctx, wc, kcp, target, image)
+	if err != nil {
+		return ctrl.Result{}, false, err
+	}
+	if op == nil {
+		// The image changed mid-upgrade; the stale NodeOpUpgrade was deleted
+		// and is recreated on the next pass.
+		setInPlaceUpgrade(kcp, target, image, controlplanev1beta2.InPlaceUpgradeUpgrading, "Restarting with the new image")
+		return requeue, false, nil
+	}
+
+	phase, _, _ := unstructured.NestedString(op.Object, "status", "phase")
+	message, _, _ := unstructured.NestedString(op.Object, "status", "message")
+	switch phase {
+	case nodeOpPhaseFailed:
+		if message == "" {
+			message = "NodeOpUpgrade failed"
+		}
+		setInPlaceUpgrade(kcp, target, image, controlplanev1beta2.InPlaceUpgradeFailed, message)
+		conditions.MarkFalse(kcp, controlplanev1beta2.InPlaceUpgradeCondition,
+			controlplanev1beta2.InPlaceUpgradeFailedReason, clusterv1.ConditionSeverityWarning,
+			"In-place upgrade of %s failed: %s", target.Name, message)
+		return requeue, false, nil
+	case nodeOpPhaseCompleted:
+		if !nodeRunsKubernetesVersion(target, kcp.Spec.Version) {
+			setInPlaceUpgrade(kcp, target, image, controlplanev1beta2.InPlaceUpgradeUpgrading, "Waiting for the node to report the new kubelet version")
+			return requeue, false, nil
+		}
+	default:
+		setInPlaceUpgrade(kcp, target, image, controlplanev1beta2.InPlaceUpgradeUpgrading, "NodeOpUpgrade is running")
+		conditions.MarkFalse(kcp, controlplanev1beta2.InPlaceUpgradeCondition,
+			controlplanev1beta2.InPlaceUpgradeInProgressReason, clusterv1.ConditionSeverityInfo,
+			"Upgrading %s to %s", target.Name, image)
+		return requeue, false, nil
+	}
+
+	if err := r.finishInPlaceUpgrade(ctx, kcp, target); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	for _, obj := range []*unstructured.Unstructured{op, record} {
+		if err := wc.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, false, fmt.Errorf("in-place upgrade: delete %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	setInPlaceUpgrade(kcp, target, image, controlplanev1beta2.InPlaceUpgradeSucceeded, "")
+	log.Info("In-place upgrade finished", "machine", target.Name, "version", kcp.Spec.Version)
+	// Requeue promptly so the next node's gate is evaluated against fresh
+	// etcd status.
+	return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, false, nil
+}
+
+// ensureNodeOpUpgrade returns the machine's NodeOpUpgrade, creating it when
+// absent. When the existing object targets another image it is deleted and nil
+// is returned so the caller requeues.
+func (r *KairosControlPlaneReconciler) ensureNodeOpUpgrade(ctx context.Context, wc client.Client, kcp *controlplanev1beta2.KairosControlPlane, target *clusterv1.Machine, image string) (*unstructured.Unstructured, error) {
+	key := types.NamespacedName{Namespace: inPlaceUpgradeNamespace(kcp), Name: nodeOpUpgradeName(target)}
+	op := &unstructured.Unstructured{}
+	op.SetGroupVersionKind(nodeOpUpgradeGVK)
+	err := wc.Get(ctx, key, op)
+	switch {
+	case err == nil:
+		if have, _, _ := unstructured.NestedString(op.Object, "spec", "image"); have != image {
+			if err := wc.Delete(ctx, op); err != nil && !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("in-place upgrade: delete stale NodeOpUpgrade %s: %w", key, err)
+			}
+			return nil, nil
+		}
+		return op, nil
+	case !apierrors.IsNotFound(err):
+		return nil, fmt.Errorf("in-place upgrade: get NodeOpUpgrade %s: %w", key, err)
+	}
+
+	op = newNodeOpUpgrade(key, target.Status.NodeRef.Name, image)
+	if err := wc.Create(ctx, op); err != nil {
+		return nil, fmt.Errorf("in-place upgrade: create NodeOpUpgrade %s (is the kairos-operator installed in the workload cluster?): %w", key, err)
+	}
+	return op, nil
+}
+
+// newNodeOpUpgrade builds a NodeOpUpgrade that upgrades the active partition
+// of exactly one node. stopOnFailure keeps the operator from retrying on its
+// own; the controller owns the retry decision.
+func newNodeOpUpgrade(key types.NamespacedName, nodeName, image string) *unstructured.Unstructured {
+	op := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"image": image,
+			"nodeSelector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{
+					"kubernetes.io/hostname": nodeName,
+				},
+			},
+			"concurrency":     int64(1),
+			"stopOnFailure":   true,
+			"upgradeActive":   true,
+			"upgradeRecovery": false,
+		},
+	}}
+	op.SetGroupVersionKind(nodeOpUpgradeGVK)
+	op.SetNamespace(key.Namespace)
+	op.SetName(key.Name)
+	op.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "cluster-api-provider-kairos"})
+	return op
+}
+
+// ensureVersionRecord returns the machine's version-record NodeOp, creating it
+// when absent. It runs in the target image, which the upgrade pulls anyway.
+// When the existing object records another release or runs another image it
+// is deleted and nil is returned so the caller requeues.
+func (r *KairosControlPlaneReconciler) ensureVersionRecord(ctx context.Context, wc client.Client, kcp *controlplanev1beta2.KairosControlPlane, target *clusterv1.Machine, image string) (*unstructured.Unstructured, error) {
+	key := types.NamespacedName{Namespace: inPlaceUpgradeNamespace(kcp), Name: versionRecordName(target)}
+	op := &unstructured.Unstructured{}
+	op.SetGroupVersionKind(nodeOpGVK)
+	err := wc.Get(ctx, key, op)
+	switch {
+	case err == nil:
+		have, _, _ := unstructured.NestedString(op.Object, "spec", "image")
+		if have != image || op.GetAnnotations()[inPlaceVersionAnnotation] != kcp.Spec.Version {
+			if err := wc.Delete(ctx, op); err != nil && !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("in-place upgrade: delete stale NodeOp %s: %w", key, err)
+			}
+			return nil, nil
+		}
+		return op, nil
+	case !apierrors.IsNotFound(err):
+		return nil, fmt.Errorf("in-place upgrade: get NodeOp %s: %w", key, err)
+	}
+
+	op = newVersionRecordNodeOp(key, target.Status.NodeRef.Name, image, kcp.Spec.Version)
+	if err := wc.Create(ctx, op); err != nil {
+		return nil, fmt.Errorf("in-place upgrade: create NodeOp %s (is the kairos-operator installed in the workload cluster?): %w", key, err)
+	}
+	return op, nil
+}
+
+// newVersionRecordNodeOp builds a NodeOp that writes version to
+// bootstrap.InPlaceUpgradeVersionFile on one node. The path and version are
+// passed as arguments, never spliced into the shell command.
+func newVersionRecordNodeOp(key types.NamespacedName, nodeName, image, version string) *unstructured.Unstructured {
+	op := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"image": image,
+			"command": []interface{}{
+				"/bin/sh", "-c", `mkdir -p "$(dirname "$1")" && printf '%s\n' "$2" > "$1"`,
+				"kairos-capi-version-record", nodeOpHostMountPath + bootstrap.InPlaceUpgradeVersionFile, version,
+			},
+			"hostMountPath": nodeOpHostMountPath,
+			"nodeSelector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{
+					"kubernetes.io/hostname": nodeName,
+				},
+			},
+			"concurrency":     int64(1),
+			"stopOnFailure":   true,
+			"rebootOnSuccess": false,
+		},
+	}}
+	op.SetGroupVersionKind(nodeOpGVK)
+	op.SetNamespace(key.Namespace)
+	op.SetName(key.Name)
+	op.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "cluster-api-provider-kairos"})
+	op.SetAnnotations(map[string]string{inPlaceVersionAnnotation: version})
+	return op
+}
+
+// finishInPlaceUpgrade records spec.version on the Machine (so it no longer
+// counts as outdated) and on its KairosConfig (so KubernetesVersionMatched
+// compares against the new release), then releases the claim.
+func (r *KairosControlPlaneReconciler) finishInPlaceUpgrade(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, target *clusterv1.Machine) error {
+	if ref := target.Spec.Bootstrap.ConfigRef; ref != nil && ref.Kind == "KairosConfig" {
+		kc := &bootstrapv1beta2.KairosConfig{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: target.Namespace, Name: ref.Name}, kc); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return fmt.Errorf("in-place upgrade: get KairosConfig %s: %w", ref.Name, err)
+			}
+		} else if kc.Spec.KubernetesVersion != kcp.Spec.Version {
+			base := kc.DeepCopy()
+			kc.Spec.KubernetesVersion = kcp.Spec.Version
+			if err := r.Patch(ctx, kc, client.MergeFrom(base)); err != nil {
+				return fmt.Errorf("in-place upgrade: record version on KairosConfig %s: %w", kc.Name, err)
+			}
+		}
+	}
+
+	helper, err := patch.NewHelper(target, r.Client)
+	if err != nil {
+		return err
+	}
+	target.Spec.Version = &kcp.Spec.Version
+	delete(target.Annotations, inPlaceUpgradeAnnotation)
+	if err := helper.Patch(ctx, target); err != nil {
+		return fmt.Errorf("in-place upgrade: record version on machine %s: %w", target.Name, err)
+	}
+	return nil
+}
+
+// nodeRunsKubernetesVersion reports whether the Machine's Node reports a kubelet
+// with the major.minor.patch of want. The distribution suffix is ignored: k0s
+// release v1.34.1+k0s.1 runs kubelet v1.34.1+k0s.
+func nodeRunsKubernetesVersion(machine *clusterv1.Machine, want string) bool {
+	if machine.Status.NodeInfo == nil {
+		return false
+	}
+	w, err := version.ParseGeneric(want)
+	if err != nil {
+		return false
+	}
+	h, err := version.ParseGeneric(machine.Status.NodeInfo.KubeletVersion)
+	if err != nil {
+		return false
+	}
+	return w.Major() == h.Major() && w.Minor() == h.Minor() && w.Patch() == h.Patch()
+}
+
+// releaseStaleInPlaceClaims removes the claim from machines that no longer need
+// an in-place upgrade (spec.version was reverted, or the spec hash changed and
+// the machine is now up for replacement), so a later rollout re-runs the quorum
+// gate before touching them.
+func (r *KairosControlPlaneReconciler) releaseStaleInPlaceClaims(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, machines []*clusterv1.Machine, specHash string) error {
+	for _, m := range machines {
+		if _, ok := m.Annotations[inPlaceUpgradeAnnotation]; !ok || r.needsInPlaceUpgrade(m, kcp, specHash) || !m.DeletionTimestamp.IsZero() {
+			continue
+		}
+		helper, err := patch.NewHelper(m, r.Client)
+		if err != nil {
+			return err
+		}
+		delete(m.Annotations, inPlaceUpgradeAnnotation)
+		if err := helper.Patch(ctx, m); err != nil {
+			return fmt.Errorf("in-place upgrade: release claim on machine %s: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// setInPlaceUpgrade upserts the machine's status entry, bumping
+// LastTransitionTime only when the phase changes.
+func setInPlaceUpgrade(kcp *controlplanev1beta2.KairosControlPlane, m *clusterv1.Machine, image string, phase controlplanev1beta2.InPlaceUpgradePhase, message string) {
+	entry := controlplanev1beta2.MachineInPlaceUpgrade{
+		MachineName: m.Name,
+		Image:       image,
+		Phase:       phase,
+		Message:     message,
+	}
+	if m.Status.NodeRef != nil {
+		entry.NodeName = m.Status.NodeRef.Name
+	}
+	for i := range kcp.Status.InPlaceUpgrades {
+		existing := &kcp.Status.InPlaceUpgrades[i]
+		if existing.MachineName != m.Name {
+			continue
+		}
+		entry.LastTransitionTime = existing.LastTransitionTime
+		if existing.Phase != phase || entry.LastTransitionTime == nil {
+			now := metav1.Now()
+			entry.LastTransitionTime = &now
+		}
+		*existing = entry
+		return
+	}
+	now := metav1.Now()
+	entry.LastTransitionTime = &now
+	kcp.Status.InPlaceUpgrades = append(kcp.Status.InPlaceUpgrades, entry)
+}
+
+// pruneInPlaceUpgrades drops status entries for machines that no longer exist
+// and for a previous rollout to another image.
+func pruneInPlaceUpgrades(kcp *controlplanev1beta2.KairosControlPlane, machines []*clusterv1.Machine, image string) {
+	exists := make(map[string]bool, len(machines))
+	for _, m := range machines {
+		exists[m.Name] = true
+	}
+	kept := kcp.Status.InPlaceUpgrades[:0]
+	for _, e := range kcp.Status.InPlaceUpgrades {
+		if exists[e.MachineName] && e.Image == image {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	kcp.Status.InPlaceUpgrades = kept
+}
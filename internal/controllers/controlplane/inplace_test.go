@@ -0,0 +1,417 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+	"github.com/kairos-io/cluster-api-provider-kairos/internal/bootstrap"
+)
+
+const (
+	inPlaceOldVersion = "v1.33.5+k0s.0"
+	inPlaceNewVersion = "v1.34.1+k0s.1"
+	inPlaceImage      = "quay.io/kairos/ubuntu:24.04-standard-amd64-generic-v3.5.0-k0s-v1.34.1"
+)
+
+func inPlaceKCP() *controlplanev1beta2.KairosControlPlane {
+	kcp := k0sKCP()
+	kcp.Spec.Version = inPlaceNewVersion
+	kcp.Spec.RolloutStrategy = &controlplanev1beta2.RolloutStrategy{
+		Type:    controlplanev1beta2.InPlaceStrategyType,
+		InPlace: &controlplanev1beta2.InPlaceUpgrade{Image: inPlaceImage},
+	}
+	conditions.MarkTrue(kcp, controlplanev1beta2.EtcdHealthyCondition)
+	return kcp
+}
+
+// inPlaceMachines builds three Running control-plane machines on the old
+// version, oldest first, each backed by a same-named Node and KairosConfig.
+func inPlaceMachines() []*clusterv1.Machine {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var out []*clusterv1.Machine
+	for i, name := range []string{"cp-0", "cp-1", "cp-2"} {
+		out = append(out, &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "default",
+				CreationTimestamp: metav1.NewTime(base.Add(time.Duration(i) * time.Minute)),
+				Annotations:       map[string]string{specHashAnnotation: "h"},
+			},
+			Spec: clusterv1.MachineSpec{
+				Version:   ptr.To(inPlaceOldVersion),
+				Bootstrap: clusterv1.Bootstrap{ConfigRef: &corev1.ObjectReference{Kind: "KairosConfig", Name: name}},
+			},
+			Status: clusterv1.MachineStatus{
+				NodeRef:  &corev1.ObjectReference{Name: name},
+				Phase:    string(clusterv1.MachinePhaseRunning),
+				NodeInfo: &corev1.NodeSystemInfo{KubeletVersion: "v1.33.5+k0s"},
+			},
+		})
+	}
+	return out
+}
+
+type inPlaceEnv struct {
+	r        *KairosControlPlaneReconciler
+	mgmt     client.Client
+	wc       client.Client
+	machines []*clusterv1.Machine
+}
+
+func newInPlaceEnv(g *WithT) *inPlaceEnv {
+	scheme := haTestScheme(g)
+	machines := inPlaceMachines()
+	objs := []client.Object{etcdStatusSecretForMembers("cp-0", "cp-1", "cp-2")}
+	for i, m := range machines {
+		role := bootstrapv1beta2.ControlPlaneRoleJoin
+		if i == 0 {
+			role = bootstrapv1beta2.ControlPlaneRoleInit
+		}
+		objs = append(objs, m, &bootstrapv1beta2.KairosConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: m.Name, Namespace: "default"},
+			Spec:       bootstrapv1beta2.KairosConfigSpec{KubernetesVersion: inPlaceOldVersion, ControlPlaneRole: role},
+		})
+	}
+	mgmt := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	wc := fake.NewClientBuilder().WithScheme(scheme).Build()
+	return &inPlaceEnv{
+		r:        &KairosControlPlaneReconciler{Client: mgmt, Scheme: scheme, WorkloadClientFactory: staticWorkloadClient(wc)},
+		mgmt:     mgmt,
+		wc:       wc,
+		machines: machines,
+	}
+}
+
+func (e *inPlaceEnv) reconcile(g *WithT, kcp *controlplanev1beta2.KairosControlPlane) bool {
+	g.THelper()
+	_, done, err := e.r.reconcileInPlaceRollout(context.Background(), log.Log, kcp, testCluster(), e.machines, "h")
+	g.Expect(err).NotTo(HaveOccurred())
+	return done
+}
+
+func (e *inPlaceEnv) nodeOp(g *WithT, machine string) (*unstructured.Unstructured, error) {
+	g.THelper()
+	op := &unstructured.Unstructured{}
+	op.SetGroupVersionKind(nodeOpUpgradeGVK)
+	err := e.wc.Get(context.Background(), types.NamespacedName{Namespace: controlplanev1beta2.DefaultInPlaceUpgradeNamespace, Name: "kairos-capi-" + machine}, op)
+	return op, err
+}
+
+func (e *inPlaceEnv) versionRecord(g *WithT, machine string) (*unstructured.Unstructured, error) {
+	g.THelper()
+	op := &unstructured.Unstructured{}
+	op.SetGroupVersionKind(nodeOpGVK)
+	err := e.wc.Get(context.Background(), types.NamespacedName{Namespace: controlplanev1beta2.DefaultInPlaceUpgradeNamespace, Name: "kairos-capi-" + machine + "-version"}, op)
+	return op, err
+}
+
+func (e *inPlaceEnv) setVersionRecordPhase(g *WithT, machine, phase string) {
+	g.THelper()
+	op, err := e.versionRecord(g, machine)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(unstructured.SetNestedField(op.Object, phase, "status", "phase")).To(Succeed())
+	g.Expect(e.wc.Update(context.Background(), op)).To(Succeed())
+}
+
+// startUpgrade claims the next machine, completes its version record and
+// reconciles again so its NodeOpUpgrade is created.
+func (e *inPlaceEnv) startUpgrade(g *WithT, kcp *controlplanev1beta2.KairosControlPlane, machine string) {
+	g.THelper()
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	e.setVersionRecordPhase(g, machine, nodeOpPhaseCompleted)
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+}
+
+func (e *inPlaceEnv) setNodeOpPhase(g *WithT, machine, phase string) {
+	g.THelper()
+	op, err := e.nodeOp(g, machine)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(unstructured.SetNestedField(op.Object, phase, "status", "phase")).To(Succeed())
+	g.Expect(e.wc.Update(context.Background(), op)).To(Succeed())
+}
+
+func inPlaceEntry(kcp *controlplanev1beta2.KairosControlPlane, machine string) controlplanev1beta2.MachineInPlaceUpgrade {
+	for _, e := range kcp.Status.InPlaceUpgrades {
+		if e.MachineName == machine {
+			return e
+		}
+	}
+	return controlplanev1beta2.MachineInPlaceUpgrade{}
+}
+
+func TestNeedsInPlaceUpgrade(t *testing.T) {
+	r := &KairosControlPlaneReconciler{}
+	rolling := inPlaceKCP()
+	rolling.Spec.RolloutStrategy = nil
+	mk := func(version, hash string, deleting bool) *clusterv1.Machine {
+		m := &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{specHashAnnotation: hash}},
+			Spec:       clusterv1.MachineSpec{Version: ptr.To(version)},
+		}
+		if deleting {
+			m.DeletionTimestamp = ptr.To(metav1.Now())
+		}
+		return m
+	}
+	for _, tc := range []struct {
+		name    string
+		kcp     *controlplanev1beta2.KairosControlPlane
+		machine *clusterv1.Machine
+		want    bool
+	}{
+		{"version drift", inPlaceKCP(), mk(inPlaceOldVersion, "h", false), true},
+		{"up to date", inPlaceKCP(), mk(inPlaceNewVersion, "h", false), false},
+		{"spec hash drift is replaced", inPlaceKCP(), mk(inPlaceOldVersion, "other", false), false},
+		{"deleting", inPlaceKCP(), mk(inPlaceOldVersion, "h", true), false},
+		{"rolling update strategy", rolling, mk(inPlaceOldVersion, "h", false), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(r.needsInPlaceUpgrade(tc.machine, tc.kcp, "h")).To(Equal(tc.want))
+		})
+	}
+}
+
+// TestInPlaceRollout_OneNodeAtATime walks a three-node rollout: the oldest node
+// is claimed first, the next waits until it finishes, and a finished node gets
+// spec.version recorded on its Machine and KairosConfig.
+func TestInPlaceRollout_OneNodeAtATime(t *testing.T) {
+	g := NewWithT(t)
+	e := newInPlaceEnv(g)
+	kcp := inPlaceKCP()
+
+	// The target release is recorded on the node before the upgrade starts.
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	_, err := e.versionRecord(g, "cp-0")
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = e.nodeOp(g, "cp-0")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "upgrade waits for the version record")
+	g.Expect(inPlaceEntry(kcp, "cp-0").Message).To(Equal("Recording the target release on the node"))
+
+	e.setVersionRecordPhase(g, "cp-0", nodeOpPhaseCompleted)
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	op, err := e.nodeOp(g, "cp-0")
+	g.Expect(err).NotTo(HaveOccurred())
+	image, _, _ := unstructured.NestedString(op.Object, "spec", "image")
+	g.Expect(image).To(Equal(inPlaceImage))
+	node, _, _ := unstructured.NestedString(op.Object, "spec", "nodeSelector", "matchLabels", "kubernetes.io/hostname")
+	g.Expect(node).To(Equal("cp-0"))
+	g.Expect(e.machines[0].Annotations).To(HaveKeyWithValue(inPlaceUpgradeAnnotation, inPlaceImage))
+	g.Expect(inPlaceEntry(kcp, "cp-0").Phase).To(Equal(controlplanev1beta2.InPlaceUpgradeUpgrading))
+	g.Expect(inPlaceEntry(kcp, "cp-1").Phase).To(Equal(controlplanev1beta2.InPlaceUpgradePending))
+
+	// While cp-0 is running its upgrade no other node is started.
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	_, err = e.nodeOp(g, "cp-1")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+	// The operator reports success, but the kubelet still runs the old
+	// version: keep waiting.
+	e.setNodeOpPhase(g, "cp-0", nodeOpPhaseCompleted)
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	g.Expect(inPlaceEntry(kcp, "cp-0").Phase).To(Equal(controlplanev1beta2.InPlaceUpgradeUpgrading))
+
+	e.machines[0].Status.NodeInfo.KubeletVersion = "v1.34.1+k0s"
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	g.Expect(inPlaceEntry(kcp, "cp-0").Phase).To(Equal(controlplanev1beta2.InPlaceUpgradeSucceeded))
+	_, err = e.nodeOp(g, "cp-0")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "finished NodeOpUpgrade is cleaned up")
+	_, err = e.versionRecord(g, "cp-0")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "finished version record is cleaned up")
+
+	got := &clusterv1.Machine{}
+	g.Expect(e.mgmt.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "cp-0"}, got)).To(Succeed())
+	g.Expect(*got.Spec.Version).To(Equal(inPlaceNewVersion))
+	g.Expect(got.Annotations).NotTo(HaveKey(inPlaceUpgradeAnnotation))
+	kc := &bootstrapv1beta2.KairosConfig{}
+	g.Expect(e.mgmt.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "cp-0"}, kc)).To(Succeed())
+	g.Expect(kc.Spec.KubernetesVersion).To(Equal(inPlaceNewVersion))
+
+	// Next pass claims cp-1.
+	e.startUpgrade(g, kcp, "cp-1")
+	_, err = e.nodeOp(g, "cp-1")
+	g.Expect(err).NotTo(HaveOccurred())
+}
+
+// TestInPlaceRollout_VersionRecord: the record NodeOp writes spec.version to
+// the file the version gate reads, and a failed record stops the rollout
+// before the node is upgraded.
+func TestInPlaceRollout_VersionRecord(t *testing.T) {
+	g := NewWithT(t)
+	e := newInPlaceEnv(g)
+	kcp := inPlaceKCP()
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+
+	op, err := e.versionRecord(g, "cp-0")
+	g.Expect(err).NotTo(HaveOccurred())
+	image, _, _ := unstructured.NestedString(op.Object, "spec", "image")
+	g.Expect(image).To(Equal(inPlaceImage))
+	command, _, _ := unstructured.NestedStringSlice(op.Object, "spec", "command")
+	g.Expect(command).To(HaveLen(6))
+	g.Expect(command[4:]).To(Equal([]string{"/host" + bootstrap.InPlaceUpgradeVersionFile, inPlaceNewVersion}))
+	reboot, _, _ := unstructured.NestedBool(op.Object, "spec", "rebootOnSuccess")
+	g.Expect(reboot).To(BeFalse())
+	g.Expect(op.GetAnnotations()).To(HaveKeyWithValue(inPlaceVersionAnnotation, inPlaceNewVersion))
+
+	e.setVersionRecordPhase(g, "cp-0", nodeOpPhaseFailed)
+	for i := 0; i < 2; i++ {
+		g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	}
+	g.Expect(inPlaceEntry(kcp, "cp-0").Phase).To(Equal(controlplanev1beta2.InPlaceUpgradeFailed))
+	g.Expect(conditions.GetReason(kcp, controlplanev1beta2.InPlaceUpgradeCondition)).To(Equal(controlplanev1beta2.InPlaceUpgradeFailedReason))
+	_, err = e.nodeOp(g, "cp-0")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "a node whose release was not recorded is not upgraded")
+
+	// A spec.version change replaces the stale record.
+	kcp.Spec.Version = "v1.34.2+k0s.0"
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	_, err = e.versionRecord(g, "cp-0")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	op, err = e.versionRecord(g, "cp-0")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(op.GetAnnotations()).To(HaveKeyWithValue(inPlaceVersionAnnotation, "v1.34.2+k0s.0"))
+}
+
+// TestInPlaceRollout_Namespace: the operator objects go to
+// spec.rolloutStrategy.inPlace.namespace.
+func TestInPlaceRollout_Namespace(t *testing.T) {
+	g := NewWithT(t)
+	e := newInPlaceEnv(g)
+	kcp := inPlaceKCP()
+	kcp.Spec.RolloutStrategy.InPlace.Namespace = "kairos-system"
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(nodeOpGVK.GroupVersion().WithKind("NodeOpList"))
+	g.Expect(e.wc.List(context.Background(), list)).To(Succeed())
+	g.Expect(list.Items).To(HaveLen(1))
+	g.Expect(list.Items[0].GetNamespace()).To(Equal("kairos-system"))
+}
+
+// TestInPlaceRollout_QuorumGate: the next node is not started while etcd is
+// degraded or another control-plane machine is down.
+func TestInPlaceRollout_QuorumGate(t *testing.T) {
+	t.Run("etcd not healthy", func(t *testing.T) {
+		g := NewWithT(t)
+		e := newInPlaceEnv(g)
+		kcp := inPlaceKCP()
+		conditions.MarkFalse(kcp, controlplanev1beta2.EtcdHealthyCondition, controlplanev1beta2.EtcdQuorumDegradedReason, clusterv1.ConditionSeverityInfo, "2/3")
+		g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+		_, err := e.nodeOp(g, "cp-0")
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		g.Expect(conditions.GetReason(kcp, controlplanev1beta2.InPlaceUpgradeCondition)).To(Equal(controlplanev1beta2.WaitingForEtcdQuorumReason))
+		g.Expect(inPlaceEntry(kcp, "cp-0").Phase).To(Equal(controlplanev1beta2.InPlaceUpgradePending))
+	})
+	t.Run("peer machine not running", func(t *testing.T) {
+		g := NewWithT(t)
+		e := newInPlaceEnv(g)
+		e.machines[2].Status.Phase = string(clusterv1.MachinePhaseProvisioning)
+		kcp := inPlaceKCP()
+		g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+		_, err := e.nodeOp(g, "cp-0")
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+	t.Run("target has no etcd report", func(t *testing.T) {
+		g := NewWithT(t)
+		e := newInPlaceEnv(g)
+		g.Expect(e.mgmt.Delete(context.Background(), etcdStatusSecretForMembers())).To(Succeed())
+		g.Expect(e.mgmt.Create(context.Background(), etcdStatusSecretForMembers("cp-1", "cp-2"))).To(Succeed())
+		kcp := inPlaceKCP()
+		g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+		_, err := e.nodeOp(g, "cp-0")
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "canRemoveMember fails closed")
+	})
+}
+
+// TestInPlaceRollout_FailureStopsRollout: a failed NodeOpUpgrade is surfaced
+// and the next node is never started.
+func TestInPlaceRollout_FailureStopsRollout(t *testing.T) {
+	g := NewWithT(t)
+	e := newInPlaceEnv(g)
+	kcp := inPlaceKCP()
+	e.startUpgrade(g, kcp, "cp-0")
+	e.setNodeOpPhase(g, "cp-0", nodeOpPhaseFailed)
+
+	for i := 0; i < 2; i++ {
+		g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	}
+	g.Expect(inPlaceEntry(kcp, "cp-0").Phase).To(Equal(controlplanev1beta2.InPlaceUpgradeFailed))
+	c := conditions.Get(kcp, controlplanev1beta2.InPlaceUpgradeCondition)
+	g.Expect(c).NotTo(BeNil())
+	g.Expect(c.Reason).To(Equal(controlplanev1beta2.InPlaceUpgradeFailedReason))
+	g.Expect(c.Severity).To(Equal(clusterv1.ConditionSeverityWarning))
+	_, err := e.nodeOp(g, "cp-1")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
+
+// TestInPlaceRollout_ImageChangeRestarts: changing the image mid-upgrade
+// replaces the NodeOpUpgrade and resets the status entries of the old rollout.
+func TestInPlaceRollout_ImageChangeRestarts(t *testing.T) {
+	g := NewWithT(t)
+	e := newInPlaceEnv(g)
+	kcp := inPlaceKCP()
+	e.startUpgrade(g, kcp, "cp-0")
+
+	// The version record runs in the target image, so it is replaced first.
+	kcp.Spec.RolloutStrategy.InPlace.Image = inPlaceImage + "-fix"
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	_, err := e.versionRecord(g, "cp-0")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "stale version record is deleted")
+	for _, entry := range kcp.Status.InPlaceUpgrades {
+		g.Expect(entry.Image).To(Equal(inPlaceImage + "-fix"))
+	}
+	e.startUpgrade(g, kcp, "cp-0")
+	_, err = e.nodeOp(g, "cp-0")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "stale NodeOpUpgrade is deleted")
+
+	g.Expect(e.reconcile(g, kcp)).To(BeFalse())
+	op, err := e.nodeOp(g, "cp-0")
+	g.Expect(err).NotTo(HaveOccurred())
+	image, _, _ := unstructured.NestedString(op.Object, "spec", "image")
+	g.Expect(image).To(Equal(inPlaceImage + "-fix"))
+}
+
+// TestInPlaceRollout_DoneWhenUpToDate: nothing to upgrade hands control back to
+// reconcileMachines for scaling.
+func TestInPlaceRollout_DoneWhenUpToDate(t *testing.T) {
+	g := NewWithT(t)
+	e := newInPlaceEnv(g)
+	for _, m := range e.machines {
+		m.Spec.Version = ptr.To(inPlaceNewVersion)
+	}
+	kcp := inPlaceKCP()
+	g.Expect(e.reconcile(g, kcp)).To(BeTrue())
+	g.Expect(kcp.Status.InPlaceUpgrades).To(BeEmpty())
+}
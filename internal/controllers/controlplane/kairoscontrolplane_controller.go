@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -69,6 +70,13 @@ type KairosControlPlaneReconciler struct {
 
 const controlPlaneLBServiceSuffix = "control-plane-lb"
 
+// rke2SupervisorPort is the rke2 server's registration (supervisor) port,
+// exposed on the CAPK control-plane LoadBalancer for rke2 clusters.
+const (
+	rke2SupervisorPort     = 9345
+	rke2SupervisorPortName = "rke2-supervisor"
+)
+
 // joinerGateRequeueAfter is the backstop requeue interval while waiting for the
 // HA init machine to become joinable (NodeRef + KubeconfigReady, plus the k0s
 // join-token Secret) before creating the next join machine (ADR 0005 Phase 3,
@@ -265,6 +273,12 @@ func (r *KairosControlPlaneReconciler) Reconcile(ctx context.Context, req ctrl.R
 		return ctrl.Result{}, nil
 	}
 
+	// A hosted control plane runs as pods in this cluster; none of the
+	// machine, load-balancer and node-push paths below apply.
+	if kcp.Spec.Hosted != nil {
+		return r.reconcileHosted(ctx, log, kcp, cluster)
+	}
+
 	// Reconcile control plane machines. machinesResult carries a requeue when
 	// the HA joiner-sequencing gate is holding back the next join machine
 	// (ADR 0005 Phase 3) — it is applied at the end of Reconcile so status is
@@ -374,6 +388,19 @@ func (r *KairosControlPlaneReconciler) Reconcile(ctx context.Context, req ctrl.R
 	// warning, and etcd health.
 	r.setHAConditions(ctx, kcp, cluster, endpointReady)
 
+	// Etcd backups: the newest uploaded snapshot and EtcdBackupReadyCondition,
+	// from the reports the nodes write into the workload cluster.
+	r.setEtcdBackupStatus(ctx, log, kcp, cluster)
+
+	// Worker join token: stamp or rotate it and surface
+	// WorkerTokenReadyCondition.
+	workerTokenRequeue := r.reconcileWorkerToken(ctx, log, kcp, cluster)
+
+	// Certificate expiry: status.earliestCertificateExpiry,
+	// CertificatesExpiringSoonCondition and the per-machine expiry that
+	// spec.rolloutBefore rolls on.
+	certExpiryRequeue := r.setCertificateExpiry(ctx, log, kcp, cluster)
+
 	// Failure fields were cleared above immediately after reconcileMachines
 	// returned nil (KD-14, maintainer-confirmed decision #3). The previous
 	// `if ReadyReplicas > 0` gate at this location is intentionally removed.
@@ -410,6 +437,22 @@ func (r *KairosControlPlaneReconciler) Reconcile(ctx context.Context, req ctrl.R
 		}
 	}
 
+	// The backup reports live in an unwatched workload-cluster Secret; poll
+	// them unless a sooner requeue is already scheduled.
+	if kcp.Spec.EtcdBackup != nil && !machinesResult.Requeue && machinesResult.RequeueAfter == 0 {
+		machinesResult.RequeueAfter = etcdBackupStatusRequeueAfter
+	}
+	// The next worker-token rotation, unless something sooner is scheduled.
+	if workerTokenRequeue > 0 && !machinesResult.Requeue &&
+		(machinesResult.RequeueAfter == 0 || workerTokenRequeue < machinesResult.RequeueAfter) {
+		machinesResult.RequeueAfter = workerTokenRequeue
+	}
+	// The next certificate expiry read, unless something sooner is scheduled.
+	if certExpiryRequeue > 0 && !machinesResult.Requeue &&
+		(machinesResult.RequeueAfter == 0 || certExpiryRequeue < machinesResult.RequeueAfter) {
+		machinesResult.RequeueAfter = certExpiryRequeue
+	}
+
 	// machinesResult carries the joiner-sequencing-gate requeue (if any). All
 	// other paths above leave it zero-valued, so this is a no-op outside the HA
 	// gate case.
@@ -485,6 +528,13 @@ func (r *KairosControlPlaneReconciler) reconcileMachines(ctx context.Context, lo
 
 	log.Info("Reconciling control plane machines", "desired", desiredReplicas, "current", currentReplicas)
 
+	// Etcd restore (spec.etcdRestore): while the old members are deleted and
+	// the new init machine restores the snapshot, nothing below runs. The
+	// quorum guard and etcd-leave handshake are bypassed on purpose.
+	if result, done, err := r.reconcileEtcdRestore(ctx, log, kcp, cluster, machines, desiredReplicas); err != nil || !done {
+		return result, err
+	}
+
 	// HA (ADR 0005 §E.3): before any scale/rollout math, progress the etcd-leave
 	// pre-terminate handshake for every owned control-plane Machine that is
 	// terminating and still carries our hook. This single sweep covers the
@@ -508,20 +558,48 @@ func (r *KairosControlPlaneReconciler) reconcileMachines(ctx context.Context, lo
 	}
 
 	// HA: ensure the per-cluster join-token Secret exists before any joiner is
-	// created (ADR 0005 Phase 3). For k3s the controller generates the shared
-	// server token up front; for k0s the Secret is created empty and the init
-	// node fills it over the node-push channel. Single-node clusters skip this.
-	if desiredReplicas > 1 {
-		if err := r.ensureJoinTokenSecret(ctx, log, kcp, cluster); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to ensure join-token secret: %w", err)
-		}
-		// HA: ensure the per-cluster etcd-status Secret exists (Cluster-owned,
-		// empty) so every control-plane node can PATCH its own member health over
-		// the node-push channel (ADR 0005 §E.1). Consumed by the joiner gate,
-		// EtcdHealthyCondition, and the quorum-safe-replacement guard.
-		if err := r.ensureEtcdStatusSecret(ctx, log, cluster); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to ensure etcd-status secret: %w", err)
-		}
+	// created (ADR 0005 Phase 3). For k3s and rke2 the controller generates the
+	// shared server token up front; for k0s the Secret is created empty and the init
+	// node fills it over the node-push channel. One-replica control planes get
+	// it too: their init node is a single-member etcd cluster that a later
+	// replicas bump grows without a rebuild.
+	if err := r.ensureJoinTokenSecret(ctx, log, kcp, cluster); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to ensure join-token secret: %w", err)
+	}
+	// k0s and k3s: ensure the per-cluster worker-token Secret exists so the k0s
+	// init node can push the first worker token into it and workers without a
+	// token of their own can wait on it.
+	if managesWorkerToken(kcp) {
+		if err := r.ensureWorkerTokenSecret(ctx, kcp, cluster); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to ensure worker-token secret: %w", err)
+		}
+	}
+	// HA: ensure the per-cluster etcd-status Secret exists (Cluster-owned,
+	// empty) so every control-plane node can PATCH its own member health over
+	// the node-push channel (ADR 0005 §E.1). Consumed by the joiner gate,
+	// EtcdHealthyCondition, and the quorum-safe-replacement guard.
+	if err := r.ensureEtcdStatusSecret(ctx, log, cluster); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to ensure etcd-status secret: %w", err)
+	}
+
+	// The live etcd members decide the role of the next machine and which
+	// machine joiners are gated on.
+	members, err := r.etcdMembers(ctx, machines)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to resolve etcd members: %w", err)
+	}
+	// A machine created with the single role runs a datastore that cannot take
+	// joiners; it is converted to the etcd-backed init node before the control
+	// plane grows past it.
+	if result, done, err := r.reconcileSingleRoleMigration(ctx, log, kcp, cluster, machines, members, desiredReplicas); err != nil || !done {
+		return result, err
+	}
+
+	// MachineHealthCheck remediation: delete at most one unhealthy machine,
+	// quorum permitting; the scale-up below creates its replacement once the
+	// etcd-leave sweep above has let it go.
+	if result, err := r.reconcileUnhealthyMachines(ctx, log, kcp, cluster, machines, desiredReplicas); err != nil || !result.IsZero() {
+		return result, err
 	}
 
 	maxSurge := int32(1)
@@ -529,10 +607,35 @@ func (r *KairosControlPlaneReconciler) reconcileMachines(ctx context.Context, lo
 		maxSurge = *kcp.Spec.RolloutStrategy.RollingUpdate.MaxSurge
 	}
 
+	// A machine is outdated when its Kubernetes version or its spec hash (the
+	// KairosConfigTemplate contents and the infrastructure template reference)
+	// no longer matches the KCP. Both roll through the same path below.
+	specHash, err := r.controlPlaneSpecHash(ctx, kcp)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.adoptSpecHash(ctx, log, machines, specHash); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// InPlace rollout: version-only drift is upgraded through the Kairos A/B
+	// partitions one node at a time, and scaling waits until that is done.
+	// Anything else outdated still goes through replacement below.
+	if isInPlaceRollout(kcp) {
+		result, done, err := r.reconcileInPlaceRollout(ctx, log, kcp, cluster, machines, specHash)
+		if err != nil || !done {
+			return result, err
+		}
+	} else {
+		kcp.Status.InPlaceUpgrades = nil
+		conditions.Delete(kcp, controlplanev1beta2.InPlaceUpgradeCondition)
+	}
+
 	outdatedMachines := make([]*clusterv1.Machine, 0)
 	updatedReadyReplicas := int32(0)
+	seed := etcdSeed(members)
 	for _, machine := range machines {
-		if r.machineMatchesVersion(machine, kcp.Spec.Version) {
+		if r.machineUpToDate(machine, kcp, specHash, seed) {
 			if machine.Status.NodeRef != nil {
 				updatedReadyReplicas++
 			}
@@ -544,8 +647,11 @@ func (r *KairosControlPlaneReconciler) reconcileMachines(ctx context.Context, lo
 	// Rolling update behavior when machines are outdated
 	if len(outdatedMachines) > 0 {
 		if currentReplicas < desiredReplicas+maxSurge {
-			role := r.controlPlaneRoleForNewMachine(desiredReplicas, machines)
-			if err := r.createControlPlaneMachine(ctx, log, kcp, cluster, r.nextMachineIndex(machines, kcp.Name), role); err != nil {
+			role := r.controlPlaneRoleForNewMachine(members)
+			if held, err := r.holdBackJoiner(ctx, log, kcp, cluster, members, role); err != nil || held {
+				return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, err
+			}
+			if err := r.createControlPlaneMachine(ctx, log, kcp, cluster, r.nextMachineIndex(machines, kcp.Name), role, failureDomainForNewMachine(cluster, machines)); err != nil {
 				return ctrl.Result{}, fmt.Errorf("failed to create control plane machine during rollout: %w", err)
 			}
 			return ctrl.Result{}, nil
@@ -553,7 +659,7 @@ func (r *KairosControlPlaneReconciler) reconcileMachines(ctx context.Context, lo
 
 		// If we are above desired replicas and have enough updated/ready replicas, delete one outdated machine
 		if currentReplicas > desiredReplicas && updatedReadyReplicas >= desiredReplicas {
-			target := outdatedMachines[0]
+			target := selectMachineForDeletion(cluster, machines, outdatedMachines)
 			// ADR 0005 §E.2: refuse a quorum-breaking rollout delete. The guard
 			// fails closed and is bypassed only under whole-cluster teardown.
 			if ok, reason, err := r.canRemoveMember(ctx, kcp, cluster, target); err != nil {
@@ -562,10 +668,8 @@ func (r *KairosControlPlaneReconciler) reconcileMachines(ctx context.Context, lo
 				log.Info("Holding back outdated-machine rollout — etcd quorum would break", "machine", target.Name, "reason", reason)
 				return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, nil
 			}
-			// k3s embedded etcd has no supported member-remove (KD-5d); warn that
-			// the member will linger. For k0s the sweep above drives a clean
-			// `k0s etcd leave` while CAPI is paused at the pre-terminate hook.
-			r.warnIfK3sEtcdLimitation(kcp, target)
+			// The sweep above drives the clean etcd-leave handshake while CAPI is
+			// paused at the pre-terminate hook.
 			log.Info("Deleting outdated control plane machine", "machine", target.Name)
 			if err := r.Delete(ctx, target); err != nil {
 				return ctrl.Result{}, fmt.Errorf("failed to delete outdated control plane machine: %w", err)
@@ -576,24 +680,12 @@ func (r *KairosControlPlaneReconciler) reconcileMachines(ctx context.Context, lo
 
 	// Create machines if needed
 	if currentReplicas < desiredReplicas {
-		role := r.controlPlaneRoleForNewMachine(desiredReplicas, machines)
-
-		// HA joiner-sequencing gate (ADR 0005 Phase 3, OQ-A): a join machine is
-		// not created until the init machine is joinable — NodeRef set,
-		// KubeconfigReady, and (k0s) the controller-join token Secret populated.
-		// Creating a joiner before the init endpoint exists would fail the join.
-		if role == bootstrapv1beta2.ControlPlaneRoleJoin {
-			joinable, reason, err := r.initMachineJoinable(ctx, kcp, cluster, machines)
-			if err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to evaluate init machine joinability: %w", err)
-			}
-			if !joinable {
-				log.Info("Holding back join machine until init machine is joinable", "reason", reason)
-				return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, nil
-			}
+		role := r.controlPlaneRoleForNewMachine(members)
+		if held, err := r.holdBackJoiner(ctx, log, kcp, cluster, members, role); err != nil || held {
+			return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, err
 		}
 
-		if err := r.createControlPlaneMachine(ctx, log, kcp, cluster, r.nextMachineIndex(machines, kcp.Name), role); err != nil {
+		if err := r.createControlPlaneMachine(ctx, log, kcp, cluster, r.nextMachineIndex(machines, kcp.Name), role, failureDomainForNewMachine(cluster, machines)); err != nil {
 			return ctrl.Result{}, fmt.Errorf("failed to create control plane machine: %w", err)
 		}
 		// Only create one per reconcile to avoid over-scaling
@@ -602,7 +694,7 @@ func (r *KairosControlPlaneReconciler) reconcileMachines(ctx context.Context, lo
 
 	// Delete machines if needed (scale down)
 	if currentReplicas > desiredReplicas {
-		target := r.selectMachineForDeletion(machines, outdatedMachines)
+		target := selectMachineForDeletion(cluster, machines, outdatedMachines)
 		if target != nil {
 			// ADR 0005 §E.2: refuse a quorum-breaking scale-down. The guard fails
 			// closed and is bypassed only under whole-cluster teardown.
@@ -612,10 +704,8 @@ func (r *KairosControlPlaneReconciler) reconcileMachines(ctx context.Context, lo
 				log.Info("Holding back control-plane scale-down — etcd quorum would break", "machine", target.Name, "reason", reason)
 				return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, nil
 			}
-			// k3s embedded etcd has no supported member-remove (KD-5d); warn that
-			// the member will linger. For k0s the sweep above drives a clean
-			// `k0s etcd leave` while CAPI is paused at the pre-terminate hook.
-			r.warnIfK3sEtcdLimitation(kcp, target)
+			// The sweep above drives the clean etcd-leave handshake while CAPI is
+			// paused at the pre-terminate hook.
 			log.Info("Scaling down control plane machine", "machine", target.Name)
 			if err := r.Delete(ctx, target); err != nil {
 				return ctrl.Result{}, fmt.Errorf("failed to delete control plane machine: %w", err)
@@ -628,35 +718,71 @@ func (r *KairosControlPlaneReconciler) reconcileMachines(ctx context.Context, lo
 
 // controlPlaneRoleForNewMachine decides the ControlPlaneRole for the next
 // control-plane machine to be created (ADR 0005 Phase 3, scope §1):
-//   - replicas == 1 → single (no etcd cluster).
-//   - replicas > 1 and no machine exists yet → init (the oldest CP machine).
-//   - replicas > 1 and at least one machine exists → join.
+//   - no live etcd member yet → init (the first member, at any replica count).
+//   - at least one live etcd member → join.
 //
-// The decision resolves against the EXISTING sorted machine set, not the name
-// index, so a deleted-and-recreated machine-0 cannot accidentally yield two
-// init nodes.
-func (r *KairosControlPlaneReconciler) controlPlaneRoleForNewMachine(desiredReplicas int32, existing []*clusterv1.Machine) bootstrapv1beta2.ControlPlaneRole {
-	if desiredReplicas <= 1 {
-		return bootstrapv1beta2.ControlPlaneRoleSingle
-	}
-	if len(existing) == 0 {
+// A one-replica control plane is therefore a single-member etcd cluster, and
+// scaling it to 3 only adds joiners. The single role is never assigned to new
+// machines; it survives on machines created before this rule.
+//
+// The decision resolves against the EXISTING member set, not the name index,
+// so a deleted-and-recreated machine-0 cannot accidentally yield two init
+// nodes.
+func (r *KairosControlPlaneReconciler) controlPlaneRoleForNewMachine(members []*clusterv1.Machine) bootstrapv1beta2.ControlPlaneRole {
+	if len(members) == 0 {
 		return bootstrapv1beta2.ControlPlaneRoleInit
 	}
 	return bootstrapv1beta2.ControlPlaneRoleJoin
 }
 
-// initMachineJoinable reports whether the HA init machine (the oldest CP
-// machine) is ready to accept joiners. The gate is (ADR 0005 Phase 3, OQ-A):
+// holdBackJoiner applies the HA joiner-sequencing gate (ADR 0005 Phase 3,
+// OQ-A): a join machine is not created until the oldest etcd member is
+// joinable — NodeRef set, KubeconfigReady, and (k0s) the controller-join token
+// Secret populated. Creating a joiner before the init endpoint exists would
+// fail the join. held=true means the caller requeues without creating.
+func (r *KairosControlPlaneReconciler) holdBackJoiner(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, members []*clusterv1.Machine, role bootstrapv1beta2.ControlPlaneRole) (bool, error) {
+	if role != bootstrapv1beta2.ControlPlaneRoleJoin {
+		return false, nil
+	}
+	joinable, reason, err := r.initMachineJoinable(ctx, kcp, cluster, members)
+	if err != nil {
+		return true, fmt.Errorf("failed to evaluate init machine joinability: %w", err)
+	}
+	if !joinable {
+		log.Info("Holding back join machine until init machine is joinable", "reason", reason)
+		return true, nil
+	}
+	return false, nil
+}
+
+// singleRoleMachines returns the live machines that are not etcd members.
+func singleRoleMachines(machines, members []*clusterv1.Machine) []*clusterv1.Machine {
+	isMember := make(map[string]bool, len(members))
+	for _, m := range members {
+		isMember[m.Name] = true
+	}
+	var single []*clusterv1.Machine
+	for _, m := range machines {
+		if m.DeletionTimestamp.IsZero() && !isMember[m.Name] {
+			single = append(single, m)
+		}
+	}
+	return single
+}
+
+// initMachineJoinable reports whether the HA init machine (the oldest etcd
+// member; after a rollout that may be a former joiner) is ready to accept
+// joiners. The gate is (ADR 0005 Phase 3, OQ-A):
 //   - the init machine has Status.NodeRef set (it registered as a Node), AND
 //   - KubeconfigReadyCondition is True on the KCP (the node pushed its
 //     kubeconfig — KD-3b), AND
 //   - for k0s only, the join-token Secret has a non-empty token (the init node
-//     minted `k0s token create` and pushed it back). For k3s the token is
-//     controller-generated up front, so this clause is skipped, AND
+//     minted `k0s token create` and pushed it back). For k3s and rke2 the
+//     token is controller-generated up front, so this clause is skipped, AND
 //   - the init node has reported a healthy voting etcd member into the
 //     etcd-status Secret (ADR 0005 §E.1) — strict for k0s (authoritative
-//     `k0s etcd member-list`), advisory for k3s (block only on an explicit
-//     unhealthy report; a missing report never regresses k3s bring-up).
+//     `k0s etcd member-list`), advisory for k3s and rke2 (block only on an
+//     explicit unhealthy report; a missing report never regresses bring-up).
 //
 // reason is a short human-readable explanation when not joinable (for
 // logging/conditions).
@@ -702,9 +828,10 @@ func (r *KairosControlPlaneReconciler) initMachineJoinable(ctx context.Context,
 			return false, "init node has not yet reported a healthy voting etcd member", nil
 		}
 	} else {
-		// k3s is health-only best-effort (KD-5d): only block if the init HAS
-		// reported and explicitly says unhealthy. A missing report falls through
-		// so k3s bring-up is never regressed by the reporter's best-effort nature.
+		// k3s and rke2 are health-only best-effort (KD-5d): only block if the
+		// init HAS reported and explicitly says unhealthy. A missing report falls
+		// through so bring-up is never regressed by the reporter's best-effort
+		// nature.
 		if reported && (!initMember.Healthy || !initMember.Voting) {
 			return false, "init node reported an unhealthy etcd member", nil
 		}
@@ -712,7 +839,7 @@ func (r *KairosControlPlaneReconciler) initMachineJoinable(ctx context.Context,
 	return true, "", nil
 }
 
-func (r *KairosControlPlaneReconciler) createControlPlaneMachine(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, index int32, role bootstrapv1beta2.ControlPlaneRole) error {
+func (r *KairosControlPlaneReconciler) createControlPlaneMachine(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, index int32, role bootstrapv1beta2.ControlPlaneRole, failureDomain *string) error {
 	machineName := fmt.Sprintf("%s-%d", kcp.Name, index)
 
 	// Create KairosConfig
@@ -755,6 +882,12 @@ func (r *KairosControlPlaneReconciler) createControlPlaneMachine(ctx context.Con
 		kairosConfig.Spec.KubernetesVersion = kcp.Spec.Version
 	}
 
+	specHash, err := r.controlPlaneSpecHash(ctx, kcp)
+	if err != nil {
+		return err
+	}
+	kairosConfig.Annotations = map[string]string{specHashAnnotation: specHash}
+
 	// HA wiring (ADR 0005 Phase 3). The role decides single/init/join; SingleNode
 	// is kept in sync for back-compat with templates that still branch on it
 	// (KD-39 retires it in v1beta3). The bootstrap renderer reads ControlPlaneRole
@@ -783,13 +916,18 @@ func (r *KairosControlPlaneReconciler) createControlPlaneMachine(ctx context.Con
 				clusterv1.ClusterNameLabel:         cluster.Name,
 				clusterv1.MachineControlPlaneLabel: "",
 			},
+			Annotations: map[string]string{
+				specHashAnnotation:   specHash,
+				singleNodeAnnotation: strconv.FormatBool(kairosConfig.Spec.SingleNode),
+			},
 			OwnerReferences: []metav1.OwnerReference{
 				*metav1.NewControllerRef(kcp, controlplanev1beta2.GroupVersion.WithKind("KairosControlPlane")),
 			},
 		},
 		Spec: clusterv1.MachineSpec{
-			ClusterName: cluster.Name,
-			Version:     &kcp.Spec.Version,
+			ClusterName:   cluster.Name,
+			Version:       &kcp.Spec.Version,
+			FailureDomain: failureDomain,
 			Bootstrap: clusterv1.Bootstrap{
 				ConfigRef: &corev1.ObjectReference{
 					APIVersion: bootstrapv1beta2.GroupVersion.String(),
@@ -807,12 +945,12 @@ func (r *KairosControlPlaneReconciler) createControlPlaneMachine(ctx context.Con
 		},
 	}
 
-	// HA (ADR 0005 §E.3): stamp the etcd-leave pre-terminate hook on k0s HA
+	// HA (ADR 0005 §E.3): stamp the etcd-leave pre-terminate hook on HA
 	// control-plane Machines so CAPI pauses termination after drain (node still
-	// up) until the controller has driven a clean `k0s etcd leave`. Only k0s
-	// init/join are hooked — single-node has no etcd cluster and k3s has no
-	// supported member-remove (KD-5d). The empty annotation value is the CAPI
-	// convention for a hook awaiting external completion.
+	// up) until the controller has driven a clean etcd member removal. Only
+	// init/join are hooked — single-node has no etcd cluster. The empty
+	// annotation value is the CAPI convention for a hook awaiting external
+	// completion.
 	if shouldStampEtcdLeaveHook(kcp, role) {
 		if machine.Annotations == nil {
 			machine.Annotations = map[string]string{}
@@ -820,7 +958,16 @@ func (r *KairosControlPlaneReconciler) createControlPlaneMachine(ctx context.Con
 		machine.Annotations[etcdLeaveHookAnnotation()] = ""
 	}
 
-	return r.Create(ctx, machine)
+	// A Machine created while a remediation is in progress replaces the
+	// remediated one; link them so a repeat failure counts as a retry.
+	remediating := stampRemediationFor(kcp, machine)
+	if err := r.Create(ctx, machine); err != nil {
+		return err
+	}
+	if remediating {
+		return r.clearRemediationInProgress(ctx, kcp)
+	}
+	return nil
 }
 
 func (r *KairosControlPlaneReconciler) createInfrastructureMachine(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, machineName string) (client.Object, error) {
@@ -932,19 +1079,9 @@ func (r *KairosControlPlaneReconciler) nextMachineIndex(machines []*clusterv1.Ma
 	return maxIndex + 1
 }
 
-func (r *KairosControlPlaneReconciler) selectMachineForDeletion(machines []*clusterv1.Machine, outdatedMachines []*clusterv1.Machine) *clusterv1.Machine {
-	if len(outdatedMachines) > 0 {
-		return outdatedMachines[0]
-	}
-	if len(machines) == 0 {
-		return nil
-	}
-	// Delete the newest machine for scale down to reduce churn on older nodes
-	return machines[len(machines)-1]
-}
-
 // setHAConditions surfaces the two HA-specific conditions (ADR 0005 Phase 3) on
-// a multi-replica control plane. They are no-ops for single-node clusters.
+// a multi-replica control plane. A single-replica control plane carries none of
+// them, including after a scale-down from HA.
 //
 //   - ControlPlaneJoinedCondition: True once readyReplicas == desiredReplicas;
 //     False(Info, "n/N joined") while scaling up.
@@ -959,6 +1096,8 @@ func (r *KairosControlPlaneReconciler) setHAConditions(ctx context.Context, kcp
 		desiredReplicas = *kcp.Spec.Replicas
 	}
 	if desiredReplicas <= 1 {
+		conditions.Delete(kcp, controlplanev1beta2.ControlPlaneJoinedCondition)
+		conditions.Delete(kcp, controlplanev1beta2.EtcdHealthyCondition)
 		return // single-node: no HA conditions.
 	}
 
@@ -1016,6 +1155,16 @@ func (r *KairosControlPlaneReconciler) updateStatus(ctx context.Context, log log
 
 	kcp.Status.Replicas = int32(len(machines))
 
+	specHash, err := r.controlPlaneSpecHash(ctx, kcp)
+	if err != nil {
+		return err
+	}
+	members, err := r.etcdMembers(ctx, machines)
+	if err != nil {
+		return err
+	}
+	seed := etcdSeed(members)
+
 	readyReplicas := int32(0)
 	updatedReplicas := int32(0)
 	availableReplicas := int32(0)
@@ -1025,8 +1174,8 @@ func (r *KairosControlPlaneReconciler) updateStatus(ctx context.Context, log log
 			readyReplicas++
 		}
 
-		// Check if machine is updated (matches desired version)
-		if machine.Spec.Version != nil && *machine.Spec.Version == kcp.Spec.Version {
+		// Check if machine is updated (matches desired version and spec hash)
+		if r.machineUpToDate(machine, kcp, specHash, seed) {
 			updatedReplicas++
 		}
 
@@ -1070,6 +1219,10 @@ func (r *KairosControlPlaneReconciler) updateStatus(ctx context.Context, log log
 	})
 	kcp.Status.Selector = selector.String()
 
+	// Per-domain spread of the control plane, mirroring what
+	// reconcileMachines balances against.
+	kcp.Status.FailureDomains = failureDomainStatus(cluster, machines)
+
 	// Log status field updates for debugging
 	log.Info("Updated control plane status fields",
 		"readyReplicas", readyReplicas,
@@ -1347,6 +1500,17 @@ func (r *KairosControlPlaneReconciler) ensureControlPlaneLBService(ctx context.C
 				TargetPort: intstr.FromInt(6443),
 			},
 		}
+		// rke2 joiners and agents register through the supervisor port, so
+		// the load balancer carries it next to the API server.
+		// getControlPlaneLBEndpoint reads the first port, which stays 6443.
+		if distributionOf(kcp) == "rke2" {
+			service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+				Name:       rke2SupervisorPortName,
+				Protocol:   corev1.ProtocolTCP,
+				Port:       rke2SupervisorPort,
+				TargetPort: intstr.FromInt(rke2SupervisorPort),
+			})
+		}
 
 		return controllerutil.SetControllerReference(kcp, service, r.Scheme)
 	})
@@ -1385,16 +1549,24 @@ func (r *KairosControlPlaneReconciler) ensureControlPlaneLBEndpoints(ctx context
 
 	subsets := []corev1.EndpointSubset{}
 	if len(addresses) > 0 {
+		ports := []corev1.EndpointPort{
+			{
+				Name:     "k8s-api",
+				Port:     6443,
+				Protocol: corev1.ProtocolTCP,
+			},
+		}
+		if distributionOf(kcp) == "rke2" {
+			ports = append(ports, corev1.EndpointPort{
+				Name:     rke2SupervisorPortName,
+				Port:     rke2SupervisorPort,
+				Protocol: corev1.ProtocolTCP,
+			})
+		}
 		subsets = []corev1.EndpointSubset{
 			{
 				Addresses: addresses,
-				Ports: []corev1.EndpointPort{
-					{
-						Name:     "k8s-api",
-						Port:     6443,
-						Protocol: corev1.ProtocolTCP,
-					},
-				},
+				Ports:     ports,
 			},
 		}
 	}
@@ -1709,6 +1881,10 @@ const kcpDeleteRequeueAfter = 10 * time.Second
 func (r *KairosControlPlaneReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&controlplanev1beta2.KairosControlPlane{}).
+		// Hosted control planes: the StatefulSet's readiness and the
+		// Service's load-balancer address drive their status.
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&corev1.Service{}).
 		Watches(
 			&clusterv1.Machine{},
 			handler.EnqueueRequestsFromMapFunc(r.machineToKairosControlPlane),
@@ -1717,6 +1893,10 @@ func (r *KairosControlPlaneReconciler) SetupWithManager(mgr ctrl.Manager) error
 			&clusterv1.Cluster{},
 			handler.EnqueueRequestsFromMapFunc(r.clusterToKairosControlPlane),
 		).
+		Watches(
+			&bootstrapv1beta2.KairosConfigTemplate{},
+			handler.EnqueueRequestsFromMapFunc(r.kairosConfigTemplateToKairosControlPlane),
+		).
 		Watches(
 			&corev1.Secret{},
 			handler.EnqueueRequestsFromMapFunc(r.secretToKairosControlPlane),
@@ -1726,13 +1906,17 @@ func (r *KairosControlPlaneReconciler) SetupWithManager(mgr ctrl.Manager) error
 			// including unrelated workload-cluster Secrets and any
 			// future tenant that happens to suffix with -kubeconfig.
 			// The KD-3b push payload always stamps both fields, so a
-			// node-pushed kubeconfig Secret reliably matches.
+			// node-pushed kubeconfig Secret reliably matches. The
+			// worker-token Secret is matched by its secret-type label, so
+			// a published token is stamped without waiting for the
+			// rotation requeue.
 			builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
 				secret, ok := obj.(*corev1.Secret)
 				if !ok {
 					return false
 				}
-				if secret.Type != clusterv1.ClusterSecretType {
+				if secret.Type != clusterv1.ClusterSecretType &&
+					secret.Labels[controlPlaneJoinTokenSecretTypeLabel] != bootstrapv1beta2.WorkerTokenSecretTypeValue {
 					return false
 				}
 				return secret.Labels[clusterv1.ClusterNameLabel] != ""
@@ -28,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/conditions"
@@ -124,6 +125,7 @@ func TestCreateControlPlaneMachine_SingleNode(t *testing.T) {
 		cluster,
 		0,
 		bootstrapv1beta2.ControlPlaneRoleSingle,
+		nil,
 	)
 
 	g.Expect(err).NotTo(HaveOccurred())
@@ -138,6 +140,14 @@ func TestCreateControlPlaneMachine_SingleNode(t *testing.T) {
 	g.Expect(err).NotTo(HaveOccurred())
 	g.Expect(kairosConfig.Spec.SingleNode).To(BeTrue())
 	g.Expect(kairosConfig.Spec.Role).To(Equal("control-plane"))
+
+	// Both objects carry the spec hash the rollout path compares against.
+	specHash, err := reconciler.controlPlaneSpecHash(context.Background(), kcp)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(kairosConfig.Annotations).To(HaveKeyWithValue(specHashAnnotation, specHash))
+	machine := &clusterv1.Machine{}
+	g.Expect(client.Get(context.Background(), types.NamespacedName{Name: "test-kcp-0", Namespace: "default"}, machine)).To(Succeed())
+	g.Expect(machine.Annotations).To(HaveKeyWithValue(specHashAnnotation, specHash))
 	g.Expect(kairosConfig.Spec.ControlPlaneRole).To(Equal(bootstrapv1beta2.ControlPlaneRoleSingle))
 	g.Expect(kairosConfig.Spec.Distribution).To(Equal("k3s"))
 }
@@ -225,6 +235,7 @@ func TestCreateControlPlaneMachine_MultiNode(t *testing.T) {
 		cluster,
 		0,
 		bootstrapv1beta2.ControlPlaneRoleInit,
+		nil,
 	)
 
 	g.Expect(err).NotTo(HaveOccurred())
@@ -301,6 +312,42 @@ func TestGetNodeIP_KubevirtVMIFallback(t *testing.T) {
 	g.Expect(ip).To(Equal("192.168.100.10"))
 }
 
+// TestEnsureControlPlaneLBService_RKE2SupervisorPort asserts rke2 control
+// planes expose the supervisor port on the CAPK LoadBalancer after the API
+// server port, and the other distributions expose the API server only.
+func TestEnsureControlPlaneLBService_RKE2SupervisorPort(t *testing.T) {
+	for _, tc := range []struct {
+		distribution string
+		want         []int32
+	}{
+		{"k0s", []int32{6443}},
+		{"k3s", []int32{6443}},
+		{"rke2", []int32{6443, 9345}},
+	} {
+		t.Run(tc.distribution, func(t *testing.T) {
+			g := NewWithT(t)
+			scheme := newKCPTestScheme(t)
+			kcp := &controlplanev1beta2.KairosControlPlane{
+				ObjectMeta: metav1.ObjectMeta{Name: "kcp", Namespace: "default", UID: "kcp-uid"},
+				Spec:       controlplanev1beta2.KairosControlPlaneSpec{Distribution: tc.distribution},
+			}
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default"}}
+			reconciler := &KairosControlPlaneReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(kcp).Build(),
+				Scheme: scheme,
+			}
+
+			service, err := reconciler.ensureControlPlaneLBService(context.Background(), log.Log, kcp, cluster)
+			g.Expect(err).NotTo(HaveOccurred())
+			var ports []int32
+			for _, p := range service.Spec.Ports {
+				ports = append(ports, p.Port)
+			}
+			g.Expect(ports).To(Equal(tc.want))
+		})
+	}
+}
+
 // newKCPTestScheme registers the schemes the KCP Reconcile flow depends on
 // for these unit tests.
 func newKCPTestScheme(t *testing.T) *runtime.Scheme {
@@ -686,3 +733,178 @@ func TestSecretToKairosControlPlane_UsesClusterNameLabel(t *testing.T) {
 	got = r.secretToKairosControlPlane(context.Background(), unlabelled)
 	g.Expect(got).To(BeEmpty())
 }
+
+// scaleFixture is a k3s control plane with the given replica count and, unless
+// role is empty, one existing joinable machine (kcp-0) whose KairosConfig
+// carries role.
+func scaleFixture(g *WithT, replicas int32, role bootstrapv1beta2.ControlPlaneRole) (*KairosControlPlaneReconciler, client.Client, *controlplanev1beta2.KairosControlPlane, *record.FakeRecorder) {
+	scheme := haTestScheme(g)
+	kcp := &controlplanev1beta2.KairosControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "kcp", Namespace: "default"},
+		Spec: controlplanev1beta2.KairosControlPlaneSpec{
+			Replicas:     ptr.To(replicas),
+			Version:      "v1.30.0+k3s1",
+			Distribution: "k3s",
+			MachineTemplate: controlplanev1beta2.KairosControlPlaneMachineTemplate{
+				InfrastructureRef: corev1.ObjectReference{
+					APIVersion: "infrastructure.cluster.x-k8s.io/v1beta1",
+					Kind:       "DockerMachineTemplate",
+					Name:       "test-template",
+					Namespace:  "default",
+				},
+			},
+		},
+	}
+	conditions.MarkTrue(kcp, controlplanev1beta2.KubeconfigReadyCondition)
+
+	infraTemplate := &unstructured.Unstructured{}
+	infraTemplate.SetGroupVersionKind(schema.GroupVersionKind{Group: "infrastructure.cluster.x-k8s.io", Version: "v1beta1", Kind: "DockerMachineTemplate"})
+	infraTemplate.SetName("test-template")
+	infraTemplate.SetNamespace("default")
+	infraTemplate.Object["spec"] = map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{}}}
+
+	objs := []client.Object{kcp, infraTemplate}
+	if role != "" {
+		objs = append(objs, scaleFixtureMachine(kcp, role)...)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	rec := record.NewFakeRecorder(8)
+	return &KairosControlPlaneReconciler{Client: c, Scheme: scheme, Recorder: rec}, c, kcp, rec
+}
+
+func scaleFixtureMachine(kcp *controlplanev1beta2.KairosControlPlane, role bootstrapv1beta2.ControlPlaneRole) []client.Object {
+	m := ownedCPMachine("kcp-0", "kcp-0")
+	m.Spec.Version = ptr.To(kcp.Spec.Version)
+	m.Spec.Bootstrap.ConfigRef = &corev1.ObjectReference{Kind: "KairosConfig", Name: m.Name}
+	m.Status.Phase = string(clusterv1.MachinePhaseRunning)
+	kc := &bootstrapv1beta2.KairosConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: m.Name, Namespace: "default"},
+		Spec:       bootstrapv1beta2.KairosConfigSpec{ControlPlaneRole: role},
+	}
+	return []client.Object{m, kc}
+}
+
+// TestReconcileMachines_FirstMachineIsInit: a one-replica control plane starts
+// as a single-member etcd cluster, with the join-token and etcd-status Secrets
+// it needs to take joiners later.
+func TestReconcileMachines_FirstMachineIsInit(t *testing.T) {
+	g := NewWithT(t)
+	r, c, kcp, _ := scaleFixture(g, 1, "")
+
+	_, err := r.reconcileMachines(context.Background(), log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+
+	kc := &bootstrapv1beta2.KairosConfig{}
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "kcp-0"}, kc)).To(Succeed())
+	g.Expect(kc.Spec.ControlPlaneRole).To(Equal(bootstrapv1beta2.ControlPlaneRoleInit))
+	g.Expect(kc.Spec.SingleNode).To(BeTrue())
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: joinTokenSecretName(testClusterName)}, &corev1.Secret{})).To(Succeed())
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: etcdStatusSecretName(testClusterName)}, &corev1.Secret{})).To(Succeed())
+}
+
+// TestReconcileMachines_ScaleOutFromOne: raising replicas from 1 to 3 adds a
+// joiner to the existing member once it is joinable, and holds it back before.
+func TestReconcileMachines_ScaleOutFromOne(t *testing.T) {
+	g := NewWithT(t)
+	r, c, kcp, _ := scaleFixture(g, 3, bootstrapv1beta2.ControlPlaneRoleInit)
+
+	conditions.MarkFalse(kcp, controlplanev1beta2.KubeconfigReadyCondition, "Waiting", clusterv1.ConditionSeverityInfo, "")
+	res, err := r.reconcileMachines(context.Background(), log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(joinerGateRequeueAfter))
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "kcp-1"}, &clusterv1.Machine{})).NotTo(Succeed())
+
+	conditions.MarkTrue(kcp, controlplanev1beta2.KubeconfigReadyCondition)
+	_, err = r.reconcileMachines(context.Background(), log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+	kc := &bootstrapv1beta2.KairosConfig{}
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "kcp-1"}, kc)).To(Succeed())
+	g.Expect(kc.Spec.ControlPlaneRole).To(Equal(bootstrapv1beta2.ControlPlaneRoleJoin))
+	g.Expect(kc.Spec.SingleNode).To(BeFalse())
+	g.Expect(kc.Spec.K3sTokenSecretRef).NotTo(BeNil())
+}
+
+// TestReconcileMachines_K0sSingleRoleHoldsScaleOut: a k0s --single machine
+// keeps its data in kine, which cannot become etcd, so the scale-out is held
+// with a Warning condition instead of standing up a second etcd cluster.
+func TestReconcileMachines_K0sSingleRoleHoldsScaleOut(t *testing.T) {
+	g := NewWithT(t)
+	r, c, kcp, _ := scaleFixture(g, 3, bootstrapv1beta2.ControlPlaneRoleSingle)
+	kcp.Spec.Distribution = "k0s"
+
+	res, err := r.reconcileMachines(context.Background(), log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.IsZero()).To(BeTrue())
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "kcp-1"}, &clusterv1.Machine{})).NotTo(Succeed())
+	cond := conditions.Get(kcp, controlplanev1beta2.SingleRoleMigrationCondition)
+	g.Expect(cond).NotTo(BeNil())
+	g.Expect(cond.Reason).To(Equal(controlplanev1beta2.SingleRoleMigrationUnsupportedReason))
+	g.Expect(cond.Severity).To(Equal(clusterv1.ConditionSeverityWarning))
+	g.Expect(cond.Message).To(ContainSubstring("kcp-0"))
+}
+
+// TestReconcileMachines_ScaleDownToOneKeepsSurvivor: on k0s the member left
+// after a 3 → 1 scale-down was created without SingleNode. It is the etcd seed
+// and holds the cluster's data, so it is kept rather than replaced.
+func TestReconcileMachines_ScaleDownToOneKeepsSurvivor(t *testing.T) {
+	g := NewWithT(t)
+	r, c, kcp, _ := scaleFixture(g, 1, bootstrapv1beta2.ControlPlaneRoleJoin)
+	kcp.Spec.Distribution = "k0s"
+	survivor := &clusterv1.Machine{}
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "kcp-0"}, survivor)).To(Succeed())
+	survivor.Annotations = map[string]string{singleNodeAnnotation: "false"}
+	g.Expect(c.Update(context.Background(), survivor)).To(Succeed())
+	g.Expect(c.Create(context.Background(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: joinTokenSecretName(testClusterName), Namespace: "default"},
+		Data:       map[string][]byte{joinTokenSecretDataKey: []byte("token")},
+	})).To(Succeed())
+	g.Expect(c.Create(context.Background(), etcdStatusSecretForMembers("kcp-0"))).To(Succeed())
+
+	_, err := r.reconcileMachines(context.Background(), log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "kcp-1"}, &clusterv1.Machine{})).NotTo(Succeed())
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "kcp-0"}, survivor)).To(Succeed())
+	g.Expect(survivor.DeletionTimestamp.IsZero()).To(BeTrue())
+}
+
+// TestReconcileMachines_K0sScaleOutKeepsOriginalMember: a k0s control plane
+// scaled from 1 to 3 only adds joiners. The original member was created with
+// SingleNode but is the etcd seed, so it is never rolled out, even once every
+// joiner is up and removing it would keep quorum.
+func TestReconcileMachines_K0sScaleOutKeepsOriginalMember(t *testing.T) {
+	g := NewWithT(t)
+	r, c, kcp, _ := scaleFixture(g, 3, bootstrapv1beta2.ControlPlaneRoleInit)
+	kcp.Spec.Distribution = "k0s"
+	ctx := context.Background()
+	original := &clusterv1.Machine{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kcp-0"}, original)).To(Succeed())
+	original.Annotations = map[string]string{singleNodeAnnotation: "true"}
+	g.Expect(c.Update(ctx, original)).To(Succeed())
+	g.Expect(c.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: joinTokenSecretName(testClusterName), Namespace: "default"},
+		Data:       map[string][]byte{joinTokenSecretDataKey: []byte("token")},
+	})).To(Succeed())
+	g.Expect(c.Create(ctx, etcdStatusSecretForMembers("kcp-0", "kcp-1", "kcp-2", "kcp-3"))).To(Succeed())
+
+	for i := 0; i < 5; i++ {
+		_, err := r.reconcileMachines(ctx, log.Log, kcp, testCluster())
+		g.Expect(err).NotTo(HaveOccurred())
+		// Every machine comes up and reports a healthy voting member.
+		machines := &clusterv1.MachineList{}
+		g.Expect(c.List(ctx, machines)).To(Succeed())
+		for j := range machines.Items {
+			m := &machines.Items[j]
+			m.Status.NodeRef = &corev1.ObjectReference{Name: m.Name}
+			m.Status.Phase = string(clusterv1.MachinePhaseRunning)
+			g.Expect(c.Update(ctx, m)).To(Succeed())
+		}
+		g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kcp-0"}, original)).To(Succeed())
+		g.Expect(original.DeletionTimestamp.IsZero()).To(BeTrue(), "reconcile %d deleted the original member", i)
+	}
+	for _, name := range []string{"kcp-1", "kcp-2"} {
+		kc := &bootstrapv1beta2.KairosConfig{}
+		g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, kc)).To(Succeed())
+		g.Expect(kc.Spec.ControlPlaneRole).To(Equal(bootstrapv1beta2.ControlPlaneRoleJoin))
+	}
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kcp-3"}, &clusterv1.Machine{})).NotTo(Succeed(), "no surge machine")
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+// defaultMinHealthyPeriod is RemediationStrategy.MinHealthyPeriod when unset.
+const defaultMinHealthyPeriod = time.Hour
+
+// reconcileUnhealthyMachines remediates control-plane Machines that a
+// MachineHealthCheck marked unhealthy (OwnerRemediated=False), the way
+// KubeadmControlPlane does: the controller owning the Machine, not the MHC,
+// deletes it and creates the replacement.
+//
+// At most one Machine is remediated at a time, and only when:
+//   - the control plane is HA: deleting the only member of a single-node
+//     control plane would destroy the cluster;
+//   - no other control-plane Machine is being deleted and none is missing, so
+//     the previous remediation, rollout or scale-up has finished;
+//   - spec.remediationStrategy allows it: a replacement that turns unhealthy
+//     within minHealthyPeriod of the remediation that created it is a retry,
+//     bounded by maxRetry and spaced by retryPeriod;
+//   - removing the Machine keeps etcd quorum (canRemoveMember, which counts
+//     the healthy voting members with etcdVotingHealthyCount).
+//
+// The Machine keeps its etcd-leave hook, so the sweep in reconcileMachines
+// removes its member from etcd before CAPI releases the infrastructure. The
+// normal scale-up path then creates the replacement, which inherits the
+// RemediationInProgressAnnotation as RemediationForAnnotation.
+//
+// A non-zero result means the rest of reconcileMachines must wait: a Machine
+// was just deleted, or a retry waits out retryPeriod. Refusals are reported
+// on the Machine's OwnerRemediated condition and return a zero result.
+func (r *KairosControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, machines []*clusterv1.Machine, desiredReplicas int32) (ctrl.Result, error) {
+	kcp.Status.LastRemediation = lastRemediation(kcp, machines)
+
+	deleting := false
+	for _, m := range machines {
+		if !m.DeletionTimestamp.IsZero() {
+			deleting = true
+		}
+	}
+
+	// A remediation whose replacement is no longer needed (e.g. spec.replicas
+	// was lowered meanwhile) must not hold the annotation forever.
+	if _, ok := kcp.Annotations[controlplanev1beta2.RemediationInProgressAnnotation]; ok {
+		if deleting || int32(len(machines)) < desiredReplicas {
+			return ctrl.Result{}, nil
+		}
+		if err := r.clearRemediationInProgress(ctx, kcp); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	var unhealthy []*clusterv1.Machine
+	for _, m := range machines {
+		if m.DeletionTimestamp.IsZero() && conditions.IsFalse(m, clusterv1.MachineOwnerRemediatedCondition) {
+			unhealthy = append(unhealthy, m)
+		}
+	}
+	if len(unhealthy) == 0 {
+		return ctrl.Result{}, nil
+	}
+	// Machines that never registered a Node go first, then the oldest.
+	sort.SliceStable(unhealthy, func(i, j int) bool {
+		if (unhealthy[i].Status.NodeRef == nil) != (unhealthy[j].Status.NodeRef == nil) {
+			return unhealthy[i].Status.NodeRef == nil
+		}
+		return unhealthy[i].CreationTimestamp.Before(&unhealthy[j].CreationTimestamp)
+	})
+	target := unhealthy[0]
+
+	if desiredReplicas <= 1 {
+		return ctrl.Result{}, r.refuseRemediation(ctx, kcp, target, clusterv1.RemediationFailedReason,
+			"a single-node control plane cannot be remediated without losing the cluster; replace the machine manually")
+	}
+	if deleting || int32(len(machines)) < desiredReplicas {
+		return ctrl.Result{}, r.refuseRemediation(ctx, kcp, target, clusterv1.WaitingForRemediationReason,
+			"waiting for the other control plane machines to be created or deleted before remediating")
+	}
+
+	maxRetry, retryPeriod, minHealthyPeriod := remediationStrategyOf(kcp)
+	now := time.Now()
+	retryCount := int32(0)
+	if prev, ok := remediationFor(target); ok && now.Before(prev.Timestamp.Add(minHealthyPeriod)) {
+		retryCount = prev.RetryCount + 1
+		if maxRetry != nil && retryCount > *maxRetry {
+			return ctrl.Result{}, r.refuseRemediation(ctx, kcp, target, clusterv1.RemediationFailedReason,
+				fmt.Sprintf("machine replaced %s and turned unhealthy within %s; maxRetry %d reached, remediation stopped",
+					prev.Machine, minHealthyPeriod, *maxRetry))
+		}
+		if wait := prev.Timestamp.Add(retryPeriod).Sub(now); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, r.refuseRemediation(ctx, kcp, target, clusterv1.WaitingForRemediationReason,
+				fmt.Sprintf("waiting %s (retryPeriod) before remediating the replacement of %s again", wait.Round(time.Second), prev.Machine))
+		}
+	}
+
+	if ok, reason, err := r.canRemoveMember(ctx, kcp, cluster, target); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to evaluate etcd quorum safety for remediation: %w", err)
+	} else if !ok {
+		log.Info("Holding back remediation — etcd quorum would break", "machine", target.Name, "reason", reason)
+		return ctrl.Result{}, r.refuseRemediation(ctx, kcp, target, clusterv1.WaitingForRemediationReason,
+			"cannot remediate without breaking etcd quorum: "+reason)
+	}
+
+	// Record the remediation before deleting, so the replacement is linked to
+	// it even if this reconcile is interrupted right after the delete.
+	data, err := json.Marshal(controlplanev1beta2.LastRemediationStatus{
+		Machine:    target.Name,
+		Timestamp:  metav1.NewTime(now.UTC().Truncate(time.Second)),
+		RetryCount: retryCount,
+	})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.patchKCPAnnotations(ctx, kcp, func(a map[string]string) {
+		a[controlplanev1beta2.RemediationInProgressAnnotation] = string(data)
+	}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to record remediation of machine %s: %w", target.Name, err)
+	}
+
+	if err := r.markOwnerRemediated(ctx, target, clusterv1.RemediationInProgressReason, ""); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.Info("Remediating unhealthy control plane machine", "machine", target.Name, "retryCount", retryCount)
+	if err := r.Delete(ctx, target); err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, fmt.Errorf("failed to delete unhealthy control plane machine %s: %w", target.Name, err)
+	}
+	if r.Recorder != nil {
+		r.Recorder.Eventf(kcp, corev1.EventTypeNormal, "MachineRemediation",
+			"Deleting unhealthy control-plane Machine %s for replacement (retry %d)", target.Name, retryCount)
+	}
+	return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, nil
+}
+
+// refuseRemediation reports on the Machine's OwnerRemediated condition why it
+// is not remediated yet, emitting a Warning event the first time a Machine is
+// given up on.
+func (r *KairosControlPlaneReconciler) refuseRemediation(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, m *clusterv1.Machine, reason, message string) error {
+	if r.Recorder != nil && reason == clusterv1.RemediationFailedReason &&
+		conditions.GetReason(m, clusterv1.MachineOwnerRemediatedCondition) != reason {
+		r.Recorder.Eventf(kcp, corev1.EventTypeWarning, "MachineRemediationFailed",
+			"Control-plane Machine %s is unhealthy and will not be remediated: %s", m.Name, message)
+	}
+	return r.markOwnerRemediated(ctx, m, reason, message)
+}
+
+// markOwnerRemediated sets the Machine's OwnerRemediated condition to False
+// with the given reason, patching only when it changes.
+func (r *KairosControlPlaneReconciler) markOwnerRemediated(ctx context.Context, m *clusterv1.Machine, reason, message string) error {
+	if conditions.GetReason(m, clusterv1.MachineOwnerRemediatedCondition) == reason &&
+		conditions.GetMessage(m, clusterv1.MachineOwnerRemediatedCondition) == message {
+		return nil
+	}
+	helper, err := patch.NewHelper(m, r.Client)
+	if err != nil {
+		return err
+	}
+	conditions.MarkFalse(m, clusterv1.MachineOwnerRemediatedCondition, reason, clusterv1.ConditionSeverityWarning, "%s", message)
+	if err := helper.Patch(ctx, m); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to update remediation status of machine %s: %w", m.Name, err)
+	}
+	return nil
+}
+
+// stampRemediationFor links a new control-plane Machine to the remediation in
+// progress, if any. The KCP annotation is cleared once the Machine exists.
+func stampRemediationFor(kcp *controlplanev1beta2.KairosControlPlane, m *clusterv1.Machine) bool {
+	v, ok := kcp.Annotations[controlplanev1beta2.RemediationInProgressAnnotation]
+	if !ok {
+		return false
+	}
+	if m.Annotations == nil {
+		m.Annotations = map[string]string{}
+	}
+	m.Annotations[controlplanev1beta2.RemediationForAnnotation] = v
+	return true
+}
+
+// clearRemediationInProgress drops RemediationInProgressAnnotation from the
+// KCP.
+func (r *KairosControlPlaneReconciler) clearRemediationInProgress(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane) error {
+	if err := r.patchKCPAnnotations(ctx, kcp, func(a map[string]string) {
+		delete(a, controlplanev1beta2.RemediationInProgressAnnotation)
+	}); err != nil {
+		return fmt.Errorf("failed to clear remediation-in-progress annotation: %w", err)
+	}
+	return nil
+}
+
+// patchKCPAnnotations writes an annotation change straight away, outside the
+// end-of-reconcile status update. The status computed so far in this
+// reconcile survives the server response.
+func (r *KairosControlPlaneReconciler) patchKCPAnnotations(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, mutate func(map[string]string)) error {
+	status := kcp.Status.DeepCopy()
+	orig := kcp.DeepCopy()
+	if kcp.Annotations == nil {
+		kcp.Annotations = map[string]string{}
+	}
+	mutate(kcp.Annotations)
+	if err := r.Patch(ctx, kcp, client.MergeFrom(orig)); err != nil {
+		return err
+	}
+	kcp.Status = *status
+	return nil
+}
+
+// remediationStrategyOf returns spec.remediationStrategy with its defaults
+// applied. maxRetry is nil for unlimited retries.
+func remediationStrategyOf(kcp *controlplanev1beta2.KairosControlPlane) (*int32, time.Duration, time.Duration) {
+	s := kcp.Spec.RemediationStrategy
+	if s == nil {
+		return nil, 0, defaultMinHealthyPeriod
+	}
+	minHealthy := defaultMinHealthyPeriod
+	if s.MinHealthyPeriod != nil {
+		minHealthy = s.MinHealthyPeriod.Duration
+	}
+	return s.MaxRetry, s.RetryPeriod.Duration, minHealthy
+}
+
+// remediationFor parses the RemediationForAnnotation of a replacement Machine.
+func remediationFor(m *clusterv1.Machine) (controlplanev1beta2.LastRemediationStatus, bool) {
+	return parseRemediation(m.Annotations[controlplanev1beta2.RemediationForAnnotation])
+}
+
+func parseRemediation(v string) (controlplanev1beta2.LastRemediationStatus, bool) {
+	var data controlplanev1beta2.LastRemediationStatus
+	if v == "" || json.Unmarshal([]byte(v), &data) != nil || data.Machine == "" {
+		return data, false
+	}
+	return data, true
+}
+
+// lastRemediation returns the newest remediation recorded on the KCP or on
+// any current Machine, or nil when there is none.
+func lastRemediation(kcp *controlplanev1beta2.KairosControlPlane, machines []*clusterv1.Machine) *controlplanev1beta2.LastRemediationStatus {
+	var last *controlplanev1beta2.LastRemediationStatus
+	consider := func(data controlplanev1beta2.LastRemediationStatus, ok bool) {
+		if ok && (last == nil || last.Timestamp.Before(&data.Timestamp)) {
+			last = &data
+		}
+	}
+	consider(parseRemediation(kcp.Annotations[controlplanev1beta2.RemediationInProgressAnnotation]))
+	for _, m := range machines {
+		consider(remediationFor(m))
+	}
+	return last
+}
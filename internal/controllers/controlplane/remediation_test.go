@@ -0,0 +1,256 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+// remediationFixture is a 3-member control plane whose first machine (cp-0)
+// was marked unhealthy by a MachineHealthCheck.
+type remediationFixture struct {
+	kcp      *controlplanev1beta2.KairosControlPlane
+	machines []*clusterv1.Machine
+	c        client.Client
+	r        *KairosControlPlaneReconciler
+	rec      *record.FakeRecorder
+}
+
+func newRemediationFixture(g *WithT, etcdHealthy []string, mutate func(*controlplanev1beta2.KairosControlPlane, []*clusterv1.Machine)) *remediationFixture {
+	scheme := haTestScheme(g)
+	kcp := k0sKCP()
+	var machines []*clusterv1.Machine
+	objs := []client.Object{kcp, etcdStatusSecretForMembers(etcdHealthy...)}
+	for i, n := range []string{"cp-0", "cp-1", "cp-2"} {
+		m := ownedCPMachine(n, n)
+		m.CreationTimestamp = metav1.NewTime(time.Now().Add(time.Duration(i-10) * time.Minute))
+		m.Status.Phase = string(clusterv1.MachinePhaseRunning)
+		m.Annotations = map[string]string{etcdLeaveHookAnnotation(): ""}
+		machines = append(machines, m)
+	}
+	// Second precision, as a real API server stores it; the patch helper
+	// would otherwise see the condition as changed by someone else.
+	conditions.Set(machines[0], &clusterv1.Condition{
+		Type:               clusterv1.MachineOwnerRemediatedCondition,
+		Status:             corev1.ConditionFalse,
+		Severity:           clusterv1.ConditionSeverityWarning,
+		Reason:             clusterv1.WaitingForRemediationReason,
+		LastTransitionTime: metav1.NewTime(time.Now().Truncate(time.Second)),
+	})
+	if mutate != nil {
+		mutate(kcp, machines)
+	}
+	for _, m := range machines {
+		objs = append(objs, m)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+		WithStatusSubresource(&clusterv1.Machine{}).Build()
+	rec := record.NewFakeRecorder(8)
+	return &remediationFixture{
+		kcp: kcp, machines: machines, c: c, rec: rec,
+		r: &KairosControlPlaneReconciler{Client: c, Scheme: scheme, Recorder: rec},
+	}
+}
+
+func (f *remediationFixture) reconcile() (time.Duration, error) {
+	res, err := f.r.reconcileUnhealthyMachines(context.Background(), log.Log, f.kcp, testCluster(), f.machines, *f.kcp.Spec.Replicas)
+	return res.RequeueAfter, err
+}
+
+func (f *remediationFixture) machine(g *WithT, name string) *clusterv1.Machine {
+	m := &clusterv1.Machine{}
+	g.Expect(f.c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, m)).To(Succeed())
+	return m
+}
+
+func remediationAnnotation(g *WithT, machine string, at time.Time, retries int32) string {
+	b, err := json.Marshal(controlplanev1beta2.LastRemediationStatus{Machine: machine, Timestamp: metav1.NewTime(at), RetryCount: retries})
+	g.Expect(err).NotTo(HaveOccurred())
+	return string(b)
+}
+
+// TestReconcileUnhealthyMachines_Remediates: with quorum to spare the unhealthy
+// machine is deleted with its etcd-leave hook kept, and the remediation is
+// recorded on the KCP for the replacement to inherit.
+func TestReconcileUnhealthyMachines_Remediates(t *testing.T) {
+	g := NewWithT(t)
+	f := newRemediationFixture(g, []string{"cp-0", "cp-1", "cp-2"}, nil)
+	f.machines[0].Finalizers = []string{clusterv1.MachineFinalizer}
+	g.Expect(f.c.Update(context.Background(), f.machines[0])).To(Succeed())
+
+	requeue, err := f.reconcile()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(requeue).To(BeNumerically(">", 0))
+
+	got := f.machine(g, "cp-0")
+	g.Expect(got.DeletionTimestamp.IsZero()).To(BeFalse())
+	g.Expect(hasEtcdLeaveHook(got)).To(BeTrue(), "the member must still leave etcd through the hook")
+	g.Expect(conditions.GetReason(got, clusterv1.MachineOwnerRemediatedCondition)).To(Equal(clusterv1.RemediationInProgressReason))
+
+	kcp := &controlplanev1beta2.KairosControlPlane{}
+	g.Expect(f.c.Get(context.Background(), client.ObjectKeyFromObject(f.kcp), kcp)).To(Succeed())
+	data, ok := parseRemediation(kcp.Annotations[controlplanev1beta2.RemediationInProgressAnnotation])
+	g.Expect(ok).To(BeTrue())
+	g.Expect(data.Machine).To(Equal("cp-0"))
+	g.Expect(data.RetryCount).To(BeZero())
+	g.Expect(f.rec.Events).To(Receive(ContainSubstring("MachineRemediation")))
+}
+
+// TestReconcileUnhealthyMachines_Refusals: every refusal leaves the machine in
+// place and explains itself on its OwnerRemediated condition.
+func TestReconcileUnhealthyMachines_Refusals(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		etcdHealthy []string
+		mutate      func(*controlplanev1beta2.KairosControlPlane, []*clusterv1.Machine)
+		wantReason  string
+		wantMessage string
+		wantRequeue bool
+	}{
+		{
+			name:        "quorum would break",
+			etcdHealthy: []string{"cp-0", "cp-1"},
+			wantReason:  clusterv1.WaitingForRemediationReason,
+			wantMessage: "etcd quorum",
+		},
+		{
+			name:        "single node",
+			etcdHealthy: []string{"cp-0"},
+			mutate: func(kcp *controlplanev1beta2.KairosControlPlane, _ []*clusterv1.Machine) {
+				kcp.Spec.Replicas = ptr.To(int32(1))
+			},
+			wantReason:  clusterv1.RemediationFailedReason,
+			wantMessage: "single-node",
+		},
+		{
+			name:        "another machine is being deleted",
+			etcdHealthy: []string{"cp-0", "cp-1", "cp-2"},
+			mutate: func(_ *controlplanev1beta2.KairosControlPlane, ms []*clusterv1.Machine) {
+				ms[2].DeletionTimestamp = ptr.To(metav1.Now())
+				ms[2].Finalizers = []string{clusterv1.MachineFinalizer}
+			},
+			wantReason:  clusterv1.WaitingForRemediationReason,
+			wantMessage: "waiting for the other control plane machines",
+		},
+		{
+			name:        "maxRetry reached",
+			etcdHealthy: []string{"cp-0", "cp-1", "cp-2"},
+			mutate: func(kcp *controlplanev1beta2.KairosControlPlane, ms []*clusterv1.Machine) {
+				kcp.Spec.RemediationStrategy = &controlplanev1beta2.RemediationStrategy{MaxRetry: ptr.To(int32(1))}
+				ms[0].Annotations[controlplanev1beta2.RemediationForAnnotation] = remediationAnnotation(NewWithT(t), "cp-old", time.Now().Add(-10*time.Minute), 1)
+			},
+			wantReason:  clusterv1.RemediationFailedReason,
+			wantMessage: "maxRetry 1 reached",
+		},
+		{
+			name:        "within retryPeriod",
+			etcdHealthy: []string{"cp-0", "cp-1", "cp-2"},
+			mutate: func(kcp *controlplanev1beta2.KairosControlPlane, ms []*clusterv1.Machine) {
+				kcp.Spec.RemediationStrategy = &controlplanev1beta2.RemediationStrategy{RetryPeriod: metav1.Duration{Duration: 30 * time.Minute}}
+				ms[0].Annotations[controlplanev1beta2.RemediationForAnnotation] = remediationAnnotation(NewWithT(t), "cp-old", time.Now().Add(-10*time.Minute), 0)
+			},
+			wantReason:  clusterv1.WaitingForRemediationReason,
+			wantMessage: "retryPeriod",
+			wantRequeue: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			f := newRemediationFixture(g, tc.etcdHealthy, tc.mutate)
+
+			requeue, err := f.reconcile()
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(requeue > 0).To(Equal(tc.wantRequeue))
+
+			got := f.machine(g, "cp-0")
+			g.Expect(got.DeletionTimestamp.IsZero()).To(BeTrue(), "machine must not be deleted")
+			g.Expect(conditions.GetReason(got, clusterv1.MachineOwnerRemediatedCondition)).To(Equal(tc.wantReason))
+			g.Expect(conditions.GetMessage(got, clusterv1.MachineOwnerRemediatedCondition)).To(ContainSubstring(tc.wantMessage))
+			g.Expect(f.kcp.Annotations).NotTo(HaveKey(controlplanev1beta2.RemediationInProgressAnnotation))
+		})
+	}
+}
+
+// TestReconcileUnhealthyMachines_HealthyPeriodResetsRetries: a replacement
+// that stayed healthy for minHealthyPeriod is remediated as a new failure.
+func TestReconcileUnhealthyMachines_HealthyPeriodResetsRetries(t *testing.T) {
+	g := NewWithT(t)
+	f := newRemediationFixture(g, []string{"cp-0", "cp-1", "cp-2"}, func(kcp *controlplanev1beta2.KairosControlPlane, ms []*clusterv1.Machine) {
+		kcp.Spec.RemediationStrategy = &controlplanev1beta2.RemediationStrategy{MaxRetry: ptr.To(int32(1))}
+		ms[0].Annotations[controlplanev1beta2.RemediationForAnnotation] = remediationAnnotation(g, "cp-old", time.Now().Add(-2*time.Hour), 1)
+	})
+
+	_, err := f.reconcile()
+	g.Expect(err).NotTo(HaveOccurred())
+	data, ok := parseRemediation(f.kcp.Annotations[controlplanev1beta2.RemediationInProgressAnnotation])
+	g.Expect(ok).To(BeTrue())
+	g.Expect(data.Machine).To(Equal("cp-0"))
+	g.Expect(data.RetryCount).To(BeZero())
+	g.Expect(f.kcp.Status.LastRemediation).NotTo(BeNil())
+	g.Expect(f.kcp.Status.LastRemediation.Machine).To(Equal("cp-old"))
+}
+
+// TestReconcileUnhealthyMachines_ClearsStaleInProgress: an in-progress record
+// with every machine present and none deleting needs no replacement.
+func TestReconcileUnhealthyMachines_ClearsStaleInProgress(t *testing.T) {
+	g := NewWithT(t)
+	f := newRemediationFixture(g, []string{"cp-0", "cp-1", "cp-2"}, func(kcp *controlplanev1beta2.KairosControlPlane, ms []*clusterv1.Machine) {
+		kcp.Annotations = map[string]string{
+			controlplanev1beta2.RemediationInProgressAnnotation: remediationAnnotation(g, "cp-gone", time.Now().Add(-time.Minute), 0),
+		}
+		conditions.Delete(ms[0], clusterv1.MachineOwnerRemediatedCondition)
+	})
+
+	requeue, err := f.reconcile()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(requeue).To(BeZero())
+	kcp := &controlplanev1beta2.KairosControlPlane{}
+	g.Expect(f.c.Get(context.Background(), client.ObjectKeyFromObject(f.kcp), kcp)).To(Succeed())
+	g.Expect(kcp.Annotations).NotTo(HaveKey(controlplanev1beta2.RemediationInProgressAnnotation))
+}
+
+// TestStampRemediationFor: the in-progress record moves onto the new machine
+// verbatim, and nothing is stamped without one.
+func TestStampRemediationFor(t *testing.T) {
+	g := NewWithT(t)
+	kcp := k0sKCP()
+	m := machineAt("cp-3")
+	g.Expect(stampRemediationFor(kcp, m)).To(BeFalse())
+	g.Expect(m.Annotations).NotTo(HaveKey(controlplanev1beta2.RemediationForAnnotation))
+
+	v := remediationAnnotation(g, "cp-0", time.Now(), 2)
+	kcp.Annotations = map[string]string{controlplanev1beta2.RemediationInProgressAnnotation: v}
+	g.Expect(stampRemediationFor(kcp, m)).To(BeTrue())
+	g.Expect(m.Annotations).To(HaveKeyWithValue(controlplanev1beta2.RemediationForAnnotation, v))
+}
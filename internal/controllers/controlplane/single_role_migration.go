@@ -0,0 +1,372 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+// Single-role migration. Machines created before one-replica control planes
+// became single-member etcd clusters carry controlPlaneRole single and run the
+// distribution's single-node datastore, which takes no joiners. Before a
+// scale-out, such a machine is turned into the etcd-backed init node in place,
+// keeping its data:
+//
+//   - A NodeOp publishes the node's server token into a workload-cluster
+//     Secret, and on k3s restarts the server with cluster-init, which converts
+//     the SQLite datastore to embedded etcd. rke2 always runs etcd and needs no
+//     restart.
+//   - Once the Node carries the distribution's etcd node-name annotation, the
+//     token is adopted into the join-token Secret, the Machine gets the
+//     etcd-leave hook, and its KairosConfig is switched to the init role.
+//
+// k0s --single keeps its data in kine, which k0s cannot convert to etcd, so a
+// k0s single-role machine holds the scale-out with a condition instead.
+//
+// The migrated machine was provisioned without the etcd status reporter, so
+// it is outdated from then on and replaced by a regular member once the
+// joiners are up.
+const (
+	// singleRoleMigrationAnnotation tracks the migration on the Machine, so a
+	// controller restart resumes it instead of starting over.
+	singleRoleMigrationAnnotation = "controlplane.cluster.x-k8s.io/single-role-migration"
+
+	singleRoleMigrationStarted   = "started"
+	singleRoleMigrationCompleted = "completed"
+
+	// singleRoleMigrationSecretName is the kube-system Secret the NodeOp
+	// writes the server token into. It is deleted once adopted.
+	singleRoleMigrationSecretName = "kairos-capi-single-role-migration"
+
+	// singleRoleMigrationImage runs the NodeOp; the work itself happens in a
+	// chroot of the host.
+	singleRoleMigrationImage = "busybox:1.36"
+)
+
+// singleRoleMigrationScript runs on the host. $1 is the distribution and $2
+// the Secret to publish the server token in. The k3s restart is deferred so
+// the NodeOp reports completion before the API server goes away.
+const singleRoleMigrationScript = `set -eu
+export PATH=/usr/local/bin:/usr/bin:/bin:/usr/local/sbin:/usr/sbin:/sbin:/var/lib/rancher/rke2/bin
+case "$1" in
+k3s)
+  data=/var/lib/rancher/k3s/server
+  export KUBECONFIG=/etc/rancher/k3s/k3s.yaml
+  kubectl() { k3s kubectl "$@"; }
+  ;;
+rke2)
+  data=/var/lib/rancher/rke2/server
+  export KUBECONFIG=/etc/rancher/rke2/rke2.yaml
+  ;;
+*)
+  echo "unsupported distribution: $1" >&2
+  exit 1
+  ;;
+esac
+test -s "$data/token"
+kubectl -n kube-system delete secret "$2" --ignore-not-found
+kubectl -n kube-system create secret generic "$2" --from-file=token="$data/token"
+if [ "$1" = k3s ] && [ ! -d "$data/db/etcd" ]; then
+  mkdir -p /etc/rancher/k3s/config.yaml.d
+  printf 'cluster-init: true\n' > /etc/rancher/k3s/config.yaml.d/90-kairos-cluster-init.yaml
+  systemd-run --on-active=30 --unit=kairos-capi-cluster-init systemctl restart k3s
+fi
+`
+
+// etcdNodeNameAnnotations are the Node annotations the embedded etcd
+// controller sets on a server once its etcd member runs.
+var etcdNodeNameAnnotations = map[string]string{
+	"k3s":  "etcd.k3s.cattle.io/node-name",
+	"rke2": "etcd.rke2.cattle.io/node-name",
+}
+
+// singleRoleMigrationName is the name of a machine's migration NodeOp.
+func singleRoleMigrationName(machine *clusterv1.Machine) string {
+	return "kairos-capi-" + machine.Name + "-migrate"
+}
+
+// singleRoleMigrated reports whether the machine was migrated from the single
+// role.
+func singleRoleMigrated(machine *clusterv1.Machine) bool {
+	return machine.Annotations[singleRoleMigrationAnnotation] == singleRoleMigrationCompleted
+}
+
+// reconcileSingleRoleMigration drives one step of the migration. It returns
+// done=true when no single-role machine stands in the way of spec.replicas,
+// so reconcileMachines can carry on with scaling; otherwise the returned
+// result requeues. A one-replica control plane leaves its single-role machine
+// alone unless a migration is already under way.
+func (r *KairosControlPlaneReconciler) reconcileSingleRoleMigration(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, machines, members []*clusterv1.Machine, desiredReplicas int32) (ctrl.Result, bool, error) {
+	single := singleRoleMachines(machines, members)
+	if len(single) == 0 {
+		if conditions.Has(kcp, controlplanev1beta2.SingleRoleMigrationCondition) {
+			conditions.MarkTrue(kcp, controlplanev1beta2.SingleRoleMigrationCondition)
+		}
+		return ctrl.Result{}, true, nil
+	}
+	target := single[0]
+	if desiredReplicas <= 1 && target.Annotations[singleRoleMigrationAnnotation] == "" {
+		conditions.Delete(kcp, controlplanev1beta2.SingleRoleMigrationCondition)
+		return ctrl.Result{}, true, nil
+	}
+
+	distribution := distributionOf(kcp)
+	if _, ok := etcdNodeNameAnnotations[distribution]; !ok {
+		log.Info("Holding back control-plane scale-out — the single-node datastore cannot be converted to etcd", "machine", target.Name)
+		conditions.MarkFalse(kcp, controlplanev1beta2.SingleRoleMigrationCondition,
+			controlplanev1beta2.SingleRoleMigrationUnsupportedReason, clusterv1.ConditionSeverityWarning,
+			"Machine %s runs %s with the single-node datastore, which cannot be converted to etcd; the control plane stays at one machine",
+			target.Name, distribution)
+		return ctrl.Result{}, false, nil
+	}
+
+	requeue := ctrl.Result{RequeueAfter: inPlaceUpgradeRequeueAfter}
+	if len(machines) > 1 || target.Status.NodeRef == nil || target.Status.Phase != string(clusterv1.MachinePhaseRunning) {
+		conditions.MarkFalse(kcp, controlplanev1beta2.SingleRoleMigrationCondition,
+			controlplanev1beta2.SingleRoleMigrationInProgressReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for %s to be the only running control-plane machine", target.Name)
+		return requeue, false, nil
+	}
+
+	switch target.Annotations[singleRoleMigrationAnnotation] {
+	case singleRoleMigrationCompleted:
+		// The token was adopted and the workload objects removed; only the
+		// role switch is left.
+		if err := r.switchToInitRole(ctx, kcp, cluster, target); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, false, nil
+	case singleRoleMigrationStarted:
+	default:
+		if err := r.setSingleRoleMigration(ctx, target, singleRoleMigrationStarted, false); err != nil {
+			return ctrl.Result{}, false, err
+		}
+		log.Info("Migrating single-role control-plane machine to etcd", "machine", target.Name)
+	}
+
+	factory := r.WorkloadClientFactory
+	if factory == nil {
+		factory = r.defaultWorkloadClient
+	}
+	wc, err := factory(ctx, cluster)
+	if err != nil {
+		return ctrl.Result{}, false, fmt.Errorf("single-role migration: build workload client: %w", err)
+	}
+
+	op, err := r.ensureSingleRoleMigrationNodeOp(ctx, wc, kcp, target)
+	if err != nil {
+		return ctrl.Result{}, false, err
+	}
+	phase, _, _ := unstructured.NestedString(op.Object, "status", "phase")
+	message, _, _ := unstructured.NestedString(op.Object, "status", "message")
+	switch phase {
+	case nodeOpPhaseCompleted:
+	case nodeOpPhaseFailed:
+		if message == "" {
+			message = "NodeOp failed"
+		}
+		conditions.MarkFalse(kcp, controlplanev1beta2.SingleRoleMigrationCondition,
+			controlplanev1beta2.SingleRoleMigrationFailedReason, clusterv1.ConditionSeverityWarning,
+			"Migration of %s failed: %s; delete NodeOp %s/%s to retry", target.Name, message, op.GetNamespace(), op.GetName())
+		return requeue, false, nil
+	default:
+		conditions.MarkFalse(kcp, controlplanev1beta2.SingleRoleMigrationCondition,
+			controlplanev1beta2.SingleRoleMigrationInProgressReason, clusterv1.ConditionSeverityInfo,
+			"Exporting the server token of %s", target.Name)
+		return requeue, false, nil
+	}
+
+	node := &corev1.Node{}
+	if err := wc.Get(ctx, types.NamespacedName{Name: target.Status.NodeRef.Name}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return requeue, false, nil
+		}
+		return ctrl.Result{}, false, fmt.Errorf("single-role migration: get node %s: %w", target.Status.NodeRef.Name, err)
+	}
+	if _, ok := node.Annotations[etcdNodeNameAnnotations[distribution]]; !ok {
+		conditions.MarkFalse(kcp, controlplanev1beta2.SingleRoleMigrationCondition,
+			controlplanev1beta2.SingleRoleMigrationInProgressReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for %s to restart on embedded etcd", target.Name)
+		return requeue, false, nil
+	}
+
+	tokenSecret := &corev1.Secret{}
+	tokenKey := types.NamespacedName{Namespace: metav1.NamespaceSystem, Name: singleRoleMigrationSecretName}
+	if err := wc.Get(ctx, tokenKey, tokenSecret); err != nil {
+		if apierrors.IsNotFound(err) {
+			conditions.MarkFalse(kcp, controlplanev1beta2.SingleRoleMigrationCondition,
+				controlplanev1beta2.SingleRoleMigrationFailedReason, clusterv1.ConditionSeverityWarning,
+				"Migration of %s did not publish the server token in Secret %s; delete NodeOp %s/%s to retry",
+				target.Name, tokenKey, op.GetNamespace(), op.GetName())
+			return requeue, false, nil
+		}
+		return ctrl.Result{}, false, fmt.Errorf("single-role migration: get secret %s: %w", tokenKey, err)
+	}
+	token := strings.TrimSpace(string(tokenSecret.Data["token"]))
+	if token == "" || strings.ContainsAny(token, "\r\n") {
+		conditions.MarkFalse(kcp, controlplanev1beta2.SingleRoleMigrationCondition,
+			controlplanev1beta2.SingleRoleMigrationFailedReason, clusterv1.ConditionSeverityWarning,
+			"Migration of %s published an unusable server token in Secret %s; delete NodeOp %s/%s to retry",
+			target.Name, tokenKey, op.GetNamespace(), op.GetName())
+		return requeue, false, nil
+	}
+	if err := r.adoptJoinToken(ctx, cluster, token); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	if err := r.setSingleRoleMigration(ctx, target, singleRoleMigrationCompleted, shouldStampEtcdLeaveHook(kcp, bootstrapv1beta2.ControlPlaneRoleInit)); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	for _, obj := range []client.Object{op, tokenSecret} {
+		if err := wc.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, false, fmt.Errorf("single-role migration: delete %s: %w", obj.GetName(), err)
+		}
+	}
+	if err := r.switchToInitRole(ctx, kcp, cluster, target); err != nil {
+		return ctrl.Result{}, false, err
+	}
+	log.Info("Migrated single-role control-plane machine to etcd", "machine", target.Name)
+	// Requeue promptly: the machine is an etcd member now and joiners are
+	// gated on it.
+	return ctrl.Result{RequeueAfter: joinerGateRequeueAfter}, false, nil
+}
+
+// ensureSingleRoleMigrationNodeOp returns the machine's migration NodeOp,
+// creating it when absent.
+func (r *KairosControlPlaneReconciler) ensureSingleRoleMigrationNodeOp(ctx context.Context, wc client.Client, kcp *controlplanev1beta2.KairosControlPlane, target *clusterv1.Machine) (*unstructured.Unstructured, error) {
+	key := types.NamespacedName{Namespace: inPlaceUpgradeNamespace(kcp), Name: singleRoleMigrationName(target)}
+	op := &unstructured.Unstructured{}
+	op.SetGroupVersionKind(nodeOpGVK)
+	err := wc.Get(ctx, key, op)
+	switch {
+	case err == nil:
+		return op, nil
+	case !apierrors.IsNotFound(err):
+		return nil, fmt.Errorf("single-role migration: get NodeOp %s: %w", key, err)
+	}
+
+	op = newSingleRoleMigrationNodeOp(key, target.Status.NodeRef.Name, distributionOf(kcp))
+	if err := wc.Create(ctx, op); err != nil {
+		return nil, fmt.Errorf("single-role migration: create NodeOp %s (is the kairos-operator installed in the workload cluster?): %w", key, err)
+	}
+	return op, nil
+}
+
+// newSingleRoleMigrationNodeOp builds a NodeOp that runs
+// singleRoleMigrationScript on one node. The distribution and Secret name are
+// passed as arguments, never spliced into the script.
+func newSingleRoleMigrationNodeOp(key types.NamespacedName, nodeName, distribution string) *unstructured.Unstructured {
+	op := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"image": singleRoleMigrationImage,
+			"command": []interface{}{
+				"chroot", nodeOpHostMountPath, "/bin/sh", "-c", singleRoleMigrationScript,
+				"kairos-capi-single-role-migration", distribution, singleRoleMigrationSecretName,
+			},
+			"hostMountPath": nodeOpHostMountPath,
+			"nodeSelector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{
+					"kubernetes.io/hostname": nodeName,
+				},
+			},
+			"concurrency":     int64(1),
+			"stopOnFailure":   true,
+			"rebootOnSuccess": false,
+		},
+	}}
+	op.SetGroupVersionKind(nodeOpGVK)
+	op.SetNamespace(key.Namespace)
+	op.SetName(key.Name)
+	op.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "cluster-api-provider-kairos"})
+	return op
+}
+
+// adoptJoinToken stores the migrated node's server token in the join-token
+// Secret, replacing the one generated up front, so joiners authenticate
+// against the running datastore. The token is never logged.
+func (r *KairosControlPlaneReconciler) adoptJoinToken(ctx context.Context, cluster *clusterv1.Cluster, token string) error {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: joinTokenSecretName(cluster.Name), Namespace: cluster.Namespace}
+	if err := r.Get(ctx, key, secret); err != nil {
+		return fmt.Errorf("single-role migration: get join-token secret %s: %w", key, err)
+	}
+	if string(secret.Data[joinTokenSecretDataKey]) == token {
+		return nil
+	}
+	base := secret.DeepCopy()
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[joinTokenSecretDataKey] = []byte(token)
+	if err := r.Patch(ctx, secret, client.MergeFrom(base)); err != nil {
+		return fmt.Errorf("single-role migration: store join token in secret %s: %w", key, err)
+	}
+	return nil
+}
+
+// setSingleRoleMigration records the migration state on the Machine and, with
+// hook set, stamps the etcd-leave pre-terminate hook its new role needs.
+func (r *KairosControlPlaneReconciler) setSingleRoleMigration(ctx context.Context, m *clusterv1.Machine, state string, hook bool) error {
+	base := m.DeepCopy()
+	if m.Annotations == nil {
+		m.Annotations = map[string]string{}
+	}
+	m.Annotations[singleRoleMigrationAnnotation] = state
+	if hook {
+		m.Annotations[etcdLeaveHookAnnotation()] = ""
+	}
+	if err := r.Patch(ctx, m, client.MergeFrom(base)); err != nil {
+		return fmt.Errorf("single-role migration: annotate machine %s: %w", m.Name, err)
+	}
+	return nil
+}
+
+// switchToInitRole rewrites the machine's KairosConfig with the init role and
+// the HA wiring of a freshly created init machine. The node is not
+// re-bootstrapped; this makes the controller treat it as the etcd member it
+// now is.
+func (r *KairosControlPlaneReconciler) switchToInitRole(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, m *clusterv1.Machine) error {
+	ref := m.Spec.Bootstrap.ConfigRef
+	if ref == nil {
+		return nil
+	}
+	kc := &bootstrapv1beta2.KairosConfig{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: m.Namespace, Name: ref.Name}, kc); err != nil {
+		return fmt.Errorf("single-role migration: get KairosConfig %s: %w", ref.Name, err)
+	}
+	base := kc.DeepCopy()
+	r.applyControlPlaneHASpec(&kc.Spec, kcp, cluster, bootstrapv1beta2.ControlPlaneRoleInit)
+	if err := r.Patch(ctx, kc, client.MergeFrom(base)); err != nil {
+		return fmt.Errorf("single-role migration: switch KairosConfig %s to the init role: %w", kc.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+// singleRoleMigrationFixture is scaleFixture with a single-role kcp-0 and a
+// fake workload cluster holding its Node.
+func singleRoleMigrationFixture(g *WithT, replicas int32) (*KairosControlPlaneReconciler, client.Client, client.Client, *controlplanev1beta2.KairosControlPlane) {
+	r, c, kcp, _ := scaleFixture(g, replicas, bootstrapv1beta2.ControlPlaneRoleSingle)
+	kc := &bootstrapv1beta2.KairosConfig{}
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "kcp-0"}, kc)).To(Succeed())
+	kc.Spec.Distribution = "k3s"
+	g.Expect(c.Update(context.Background(), kc)).To(Succeed())
+	wc := fake.NewClientBuilder().WithScheme(r.Scheme).WithObjects(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "kcp-0"}}).Build()
+	r.WorkloadClientFactory = staticWorkloadClient(wc)
+	return r, c, wc, kcp
+}
+
+func migrationNodeOp(g *WithT, wc client.Client) *unstructured.Unstructured {
+	g.THelper()
+	op := &unstructured.Unstructured{}
+	op.SetGroupVersionKind(nodeOpGVK)
+	g.Expect(wc.Get(context.Background(), types.NamespacedName{
+		Namespace: controlplanev1beta2.DefaultInPlaceUpgradeNamespace, Name: "kairos-capi-kcp-0-migrate",
+	}, op)).To(Succeed())
+	return op
+}
+
+// TestReconcileMachines_MigratesSingleRoleMachine walks a k3s single-role
+// machine through the migration: the NodeOp exports the token and restarts
+// k3s on etcd, the controller adopts the token and switches the machine to
+// the init role, and only then are joiners created.
+func TestReconcileMachines_MigratesSingleRoleMachine(t *testing.T) {
+	g := NewWithT(t)
+	r, c, wc, kcp := singleRoleMigrationFixture(g, 3)
+	ctx := context.Background()
+
+	_, err := r.reconcileMachines(ctx, log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+	op := migrationNodeOp(g, wc)
+	command, _, _ := unstructured.NestedStringSlice(op.Object, "spec", "command")
+	g.Expect(command).To(HaveExactElements("chroot", nodeOpHostMountPath, "/bin/sh", "-c", singleRoleMigrationScript,
+		"kairos-capi-single-role-migration", "k3s", singleRoleMigrationSecretName))
+	machine := &clusterv1.Machine{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kcp-0"}, machine)).To(Succeed())
+	g.Expect(machine.Annotations).To(HaveKeyWithValue(singleRoleMigrationAnnotation, singleRoleMigrationStarted))
+	g.Expect(conditions.GetReason(kcp, controlplanev1beta2.SingleRoleMigrationCondition)).To(Equal(controlplanev1beta2.SingleRoleMigrationInProgressReason))
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kcp-1"}, &clusterv1.Machine{})).NotTo(Succeed())
+
+	// The NodeOp finished, but k3s has not come back on etcd yet.
+	g.Expect(unstructured.SetNestedField(op.Object, nodeOpPhaseCompleted, "status", "phase")).To(Succeed())
+	g.Expect(wc.Update(ctx, op)).To(Succeed())
+	g.Expect(wc.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceSystem, Name: singleRoleMigrationSecretName},
+		Data:       map[string][]byte{"token": []byte("K10abc::server:def\n")},
+	})).To(Succeed())
+	_, err = r.reconcileMachines(ctx, log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(conditions.Get(kcp, controlplanev1beta2.SingleRoleMigrationCondition).Message).To(ContainSubstring("embedded etcd"))
+	kc := &bootstrapv1beta2.KairosConfig{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kcp-0"}, kc)).To(Succeed())
+	g.Expect(kc.Spec.ControlPlaneRole).To(Equal(bootstrapv1beta2.ControlPlaneRoleSingle))
+
+	node := &corev1.Node{}
+	g.Expect(wc.Get(ctx, types.NamespacedName{Name: "kcp-0"}, node)).To(Succeed())
+	node.Annotations = map[string]string{"etcd.k3s.cattle.io/node-name": "kcp-0-1a2b3c4d"}
+	g.Expect(wc.Update(ctx, node)).To(Succeed())
+	_, err = r.reconcileMachines(ctx, log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+
+	token := &corev1.Secret{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: joinTokenSecretName(testClusterName)}, token)).To(Succeed())
+	g.Expect(string(token.Data[joinTokenSecretDataKey])).To(Equal("K10abc::server:def"))
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kcp-0"}, kc)).To(Succeed())
+	g.Expect(kc.Spec.ControlPlaneRole).To(Equal(bootstrapv1beta2.ControlPlaneRoleInit))
+	g.Expect(kc.Spec.K3sTokenSecretRef).NotTo(BeNil())
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kcp-0"}, machine)).To(Succeed())
+	g.Expect(machine.Annotations).To(HaveKeyWithValue(singleRoleMigrationAnnotation, singleRoleMigrationCompleted))
+	g.Expect(hasEtcdLeaveHook(machine)).To(BeTrue())
+	g.Expect(wc.Get(ctx, client.ObjectKeyFromObject(op), op.DeepCopy())).NotTo(Succeed(), "NodeOp deleted")
+	g.Expect(wc.Get(ctx, types.NamespacedName{Namespace: metav1.NamespaceSystem, Name: singleRoleMigrationSecretName}, &corev1.Secret{})).NotTo(Succeed(), "token Secret deleted")
+
+	// The machine is an etcd member now: the next pass marks the migration
+	// done and adds a joiner.
+	_, err = r.reconcileMachines(ctx, log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(conditions.IsTrue(kcp, controlplanev1beta2.SingleRoleMigrationCondition)).To(BeTrue())
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kcp-1"}, kc)).To(Succeed())
+	g.Expect(kc.Spec.ControlPlaneRole).To(Equal(bootstrapv1beta2.ControlPlaneRoleJoin))
+}
+
+// TestReconcileMachines_SingleRoleMigrationFailed: a failed NodeOp is
+// surfaced as a Warning condition and nothing else moves.
+func TestReconcileMachines_SingleRoleMigrationFailed(t *testing.T) {
+	g := NewWithT(t)
+	r, c, wc, kcp := singleRoleMigrationFixture(g, 3)
+	ctx := context.Background()
+
+	_, err := r.reconcileMachines(ctx, log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+	op := migrationNodeOp(g, wc)
+	g.Expect(unstructured.SetNestedField(op.Object, nodeOpPhaseFailed, "status", "phase")).To(Succeed())
+	g.Expect(wc.Update(ctx, op)).To(Succeed())
+
+	_, err = r.reconcileMachines(ctx, log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+	cond := conditions.Get(kcp, controlplanev1beta2.SingleRoleMigrationCondition)
+	g.Expect(cond.Reason).To(Equal(controlplanev1beta2.SingleRoleMigrationFailedReason))
+	g.Expect(cond.Severity).To(Equal(clusterv1.ConditionSeverityWarning))
+	kc := &bootstrapv1beta2.KairosConfig{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kcp-0"}, kc)).To(Succeed())
+	g.Expect(kc.Spec.ControlPlaneRole).To(Equal(bootstrapv1beta2.ControlPlaneRoleSingle))
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "kcp-1"}, &clusterv1.Machine{})).NotTo(Succeed())
+}
+
+// TestReconcileMachines_SingleRoleAtOneReplica: a single-role machine is left
+// alone while the control plane stays at one replica.
+func TestReconcileMachines_SingleRoleAtOneReplica(t *testing.T) {
+	g := NewWithT(t)
+	r, _, wc, kcp := singleRoleMigrationFixture(g, 1)
+
+	_, err := r.reconcileMachines(context.Background(), log.Log, kcp, testCluster())
+	g.Expect(err).NotTo(HaveOccurred())
+	ops := &unstructured.UnstructuredList{}
+	ops.SetGroupVersionKind(nodeOpGVK.GroupVersion().WithKind("NodeOpList"))
+	g.Expect(wc.List(context.Background(), ops)).To(Succeed())
+	g.Expect(ops.Items).To(BeEmpty())
+	g.Expect(conditions.Has(kcp, controlplanev1beta2.SingleRoleMigrationCondition)).To(BeFalse())
+}
+
+// TestCanRemoveMember_MigratedMachineWithoutReport: a migrated machine runs no
+// etcd status reporter. Its missing report does not block its replacement,
+// but the remaining reporters must still hold quorum.
+func TestCanRemoveMember_MigratedMachineWithoutReport(t *testing.T) {
+	migrated := ownedCPMachine("kcp-0", "kcp-0")
+	migrated.Status.Phase = string(clusterv1.MachinePhaseRunning)
+	migrated.Annotations = map[string]string{singleRoleMigrationAnnotation: singleRoleMigrationCompleted}
+	kcp := &controlplanev1beta2.KairosControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "kcp", Namespace: "default"},
+		Spec:       controlplanev1beta2.KairosControlPlaneSpec{Replicas: ptr.To(int32(3)), Distribution: "k3s"},
+	}
+	for _, tc := range []struct {
+		name      string
+		reporters []string
+		want      bool
+	}{
+		{"joiners hold quorum", []string{"kcp-1", "kcp-2", "kcp-3"}, true},
+		{"joiners below quorum", []string{"kcp-1"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			objs := []client.Object{migrated.DeepCopy(), etcdStatusSecretForMembers(tc.reporters...)}
+			for _, name := range tc.reporters {
+				m := ownedCPMachine(name, name)
+				m.Status.Phase = string(clusterv1.MachinePhaseRunning)
+				objs = append(objs, m)
+			}
+			r := &KairosControlPlaneReconciler{Client: fake.NewClientBuilder().WithScheme(haTestScheme(g)).WithObjects(objs...).Build()}
+			ok, _, err := r.canRemoveMember(context.Background(), kcp, testCluster(), migrated)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ok).To(Equal(tc.want))
+		})
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+// specHashAnnotation is stamped on every Machine and KairosConfig the controller
+// creates. Its value is the controlPlaneSpecHash of the KCP at creation time; a
+// Machine whose hash differs from the current one is outdated and replaced
+// through the same quorum-guarded rolling update as a version change.
+const specHashAnnotation = "controlplane.cluster.x-k8s.io/kairos-spec-hash"
+
+// singleNodeAnnotation records on every Machine the controller creates whether
+// its KairosConfig has SingleNode set, i.e. was made for a one-replica control
+// plane. On k0s the flag decides whether the controller also runs workloads
+// without taints (--enable-worker --no-taints), so a k0s Machine whose value no
+// longer matches spec.replicas is outdated. The etcd seed — the oldest member,
+// which holds the data joiners sync from — is exempt: a 1 → 3 scale-out keeps
+// the former lone node as a schedulable member, and a 3 → 1 scale-down keeps
+// its survivor as it is.
+const singleNodeAnnotation = "controlplane.cluster.x-k8s.io/kairos-single-node"
+
+// controlPlaneSpecInputs is everything outside spec.version that shapes a new
+// control-plane machine. The KairosConfigTemplate is hashed by content, so
+// editing the template in place rolls the control plane just like pointing the
+// KCP at a new one. Infrastructure templates are immutable by CAPI convention
+// and are hashed by reference only. The etcd backup block is rendered into the
+// bootstrap data, so it is hashed too; it is omitted when unset so enabling
+// the feature is the only thing that changes existing hashes. The CNI
+// selection follows the same rule; the webhook freezes it once the control
+// plane is initialized, so it only ever differs before the first machine.
+type controlPlaneSpecInputs struct {
+	KairosConfigTemplate controlplanev1beta2.KairosConfigTemplateReference `json:"kairosConfigTemplate"`
+	KairosConfigSpec     *bootstrapv1beta2.KairosConfigSpec                `json:"kairosConfigSpec,omitempty"`
+	InfrastructureRef    infrastructureRefInputs                           `json:"infrastructureRef"`
+	EtcdBackup           *controlplanev1beta2.EtcdBackup                   `json:"etcdBackup,omitempty"`
+	CNI                  *bootstrapv1beta2.ControlPlaneCNI                 `json:"cni,omitempty"`
+}
+
+type infrastructureRefInputs struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+}
+
+// controlPlaneSpecHash returns the hex SHA-256 of the KCP's machine-shaping
+// inputs. It reads the referenced KairosConfigTemplate, so a missing template
+// is an error here exactly as it is in createControlPlaneMachine.
+func (r *KairosControlPlaneReconciler) controlPlaneSpecHash(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane) (string, error) {
+	infraRef := kcp.Spec.MachineTemplate.InfrastructureRef
+	in := controlPlaneSpecInputs{
+		KairosConfigTemplate: kcp.Spec.KairosConfigTemplate,
+		InfrastructureRef: infrastructureRefInputs{
+			APIVersion: infraRef.APIVersion,
+			Kind:       infraRef.Kind,
+			Namespace:  infraRef.Namespace,
+			Name:       infraRef.Name,
+		},
+		EtcdBackup: kcp.Spec.EtcdBackup,
+		CNI:        controlPlaneCNISpec(kcp),
+	}
+	if kcp.Spec.KairosConfigTemplate.Name != "" {
+		template := &bootstrapv1beta2.KairosConfigTemplate{}
+		key := types.NamespacedName{Namespace: kcp.Namespace, Name: kcp.Spec.KairosConfigTemplate.Name}
+		if err := r.Get(ctx, key, template); err != nil {
+			return "", fmt.Errorf("failed to get KairosConfigTemplate: %w", err)
+		}
+		in.KairosConfigSpec = &template.Spec.Template.Spec
+	}
+	raw, err := json.Marshal(in)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode control-plane spec: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// machineMatchesSpecHash reports whether the Machine was created from the
+// current spec. A Machine without the annotation predates spec hashing and is
+// treated as current; adoptSpecHash stamps it so later changes do roll it.
+func machineMatchesSpecHash(machine *clusterv1.Machine, hash string) bool {
+	have, ok := machine.Annotations[specHashAnnotation]
+	return !ok || have == hash
+}
+
+// machineMatchesSingleNode reports whether a k0s Machine was created for the
+// current replica count. Other distributions render SingleNode identically on
+// etcd members and always match, as does the etcd seed. A Machine without the
+// annotation predates it and is treated as current.
+func machineMatchesSingleNode(machine *clusterv1.Machine, kcp *controlplanev1beta2.KairosControlPlane, seed string) bool {
+	if distributionOf(kcp) != "k0s" || machine.Name == seed {
+		return true
+	}
+	have, ok := machine.Annotations[singleNodeAnnotation]
+	return !ok || have == strconv.FormatBool(ptr.Deref(kcp.Spec.Replicas, 1) <= 1)
+}
+
+// machineUpToDate is the single outdated test shared by reconcileMachines and
+// updateStatus: the Kubernetes version and the spec hash must both match, the
+// machine must have been created for the current replica count (seed names
+// the etcd seed, see etcdSeed), it must not have been migrated from the single
+// role, and its certificates must not expire within spec.rolloutBefore.
+func (r *KairosControlPlaneReconciler) machineUpToDate(machine *clusterv1.Machine, kcp *controlplanev1beta2.KairosControlPlane, hash, seed string) bool {
+	return r.machineMatchesVersion(machine, kcp.Spec.Version) && machineMatchesSpecHash(machine, hash) &&
+		machineMatchesSingleNode(machine, kcp, seed) && !singleRoleMigrated(machine) &&
+		!certificatesExpiring(machine, kcp, time.Now())
+}
+
+// etcdSeed returns the name of the oldest of the live etcd members, or "" when
+// there is none.
+func etcdSeed(members []*clusterv1.Machine) string {
+	var seed *clusterv1.Machine
+	for _, m := range members {
+		if seed == nil || m.CreationTimestamp.Before(&seed.CreationTimestamp) {
+			seed = m
+		}
+	}
+	if seed == nil {
+		return ""
+	}
+	return seed.Name
+}
+
+// adoptSpecHash stamps the current hash on Machines created before spec
+// hashing existed, so upgrading the controller does not roll the whole control
+// plane but the next template change does. Deleting Machines are skipped.
+func (r *KairosControlPlaneReconciler) adoptSpecHash(ctx context.Context, log logr.Logger, machines []*clusterv1.Machine, hash string) error {
+	for _, m := range machines {
+		if !m.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if _, ok := m.Annotations[specHashAnnotation]; ok {
+			continue
+		}
+		base := m.DeepCopy()
+		if m.Annotations == nil {
+			m.Annotations = map[string]string{}
+		}
+		m.Annotations[specHashAnnotation] = hash
+		if err := r.Patch(ctx, m, client.MergeFrom(base)); err != nil {
+			return fmt.Errorf("failed to stamp spec hash on machine %s: %w", m.Name, err)
+		}
+		log.Info("Adopted control plane machine into spec-hash rollouts", "machine", m.Name)
+	}
+	return nil
+}
+
+// kairosConfigTemplateToKairosControlPlane maps a KairosConfigTemplate to every
+// KairosControlPlane in its namespace that references it, so an in-place
+// template edit triggers a rollout without waiting for a resync.
+func (r *KairosControlPlaneReconciler) kairosConfigTemplateToKairosControlPlane(ctx context.Context, o client.Object) []reconcile.Request {
+	template, ok := o.(*bootstrapv1beta2.KairosConfigTemplate)
+	if !ok {
+		return nil
+	}
+	kcps := &controlplanev1beta2.KairosControlPlaneList{}
+	if err := r.List(ctx, kcps, client.InNamespace(template.Namespace)); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range kcps.Items {
+		if kcps.Items[i].Spec.KairosConfigTemplate.Name != template.Name {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: template.Namespace, Name: kcps.Items[i].Name},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+func specHashKCP() *controlplanev1beta2.KairosControlPlane {
+	return &controlplanev1beta2.KairosControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "kcp", Namespace: "default"},
+		Spec: controlplanev1beta2.KairosControlPlaneSpec{
+			Version: "v1.34.1+k0s.1",
+			MachineTemplate: controlplanev1beta2.KairosControlPlaneMachineTemplate{
+				InfrastructureRef: corev1.ObjectReference{
+					APIVersion: "infrastructure.cluster.x-k8s.io/v1beta1",
+					Kind:       "VSphereMachineTemplate",
+					Name:       "cp-v1",
+					Namespace:  "default",
+				},
+			},
+			KairosConfigTemplate: controlplanev1beta2.KairosConfigTemplateReference{Name: "cp-config"},
+		},
+	}
+}
+
+func specHashTemplate(name string, dns ...string) *bootstrapv1beta2.KairosConfigTemplate {
+	return &bootstrapv1beta2.KairosConfigTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: bootstrapv1beta2.KairosConfigTemplateSpec{
+			Template: bootstrapv1beta2.KairosConfigTemplateResource{
+				Spec: bootstrapv1beta2.KairosConfigSpec{Role: "control-plane", DNSServers: dns},
+			},
+		},
+	}
+}
+
+// TestControlPlaneSpecHash: every input the request names (template ref,
+// template contents, infrastructure ref) changes the hash; the version and
+// replica count do not, since they roll or scale through their own paths.
+func TestControlPlaneSpecHash(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(specHashTemplate("cp-config", "1.1.1.1"), specHashTemplate("cp-config-v2", "1.1.1.1")).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+	ctx := context.Background()
+
+	base, err := r.controlPlaneSpecHash(ctx, specHashKCP())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(base).To(HaveLen(64))
+
+	again, err := r.controlPlaneSpecHash(ctx, specHashKCP())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(again).To(Equal(base), "hash must be deterministic")
+
+	for _, tc := range []struct {
+		name    string
+		mutate  func(kcp *controlplanev1beta2.KairosControlPlane)
+		changes bool
+	}{
+		{"version", func(kcp *controlplanev1beta2.KairosControlPlane) { kcp.Spec.Version = "v1.35.0+k0s.0" }, false},
+		{"replicas", func(kcp *controlplanev1beta2.KairosControlPlane) { kcp.Spec.Replicas = ptr.To(int32(3)) }, false},
+		{"template ref", func(kcp *controlplanev1beta2.KairosControlPlane) { kcp.Spec.KairosConfigTemplate.Name = "cp-config-v2" }, true},
+		{"infrastructure ref", func(kcp *controlplanev1beta2.KairosControlPlane) {
+			kcp.Spec.MachineTemplate.InfrastructureRef.Name = "cp-v2"
+		}, true},
+		{"explicit default CNI", func(kcp *controlplanev1beta2.KairosControlPlane) {
+			kcp.Spec.CNI = &controlplanev1beta2.CNI{Provider: controlplanev1beta2.CNIProviderDefault}
+		}, false},
+		{"CNI", func(kcp *controlplanev1beta2.KairosControlPlane) {
+			kcp.Spec.CNI = &controlplanev1beta2.CNI{Provider: controlplanev1beta2.CNIProviderCilium}
+		}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			kcp := specHashKCP()
+			tc.mutate(kcp)
+			got, err := r.controlPlaneSpecHash(ctx, kcp)
+			g.Expect(err).NotTo(HaveOccurred())
+			if tc.changes {
+				g.Expect(got).NotTo(Equal(base))
+			} else {
+				g.Expect(got).To(Equal(base))
+			}
+		})
+	}
+
+	// Editing the referenced template in place must roll the control plane.
+	tmpl := &bootstrapv1beta2.KairosConfigTemplate{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cp-config"}, tmpl)).To(Succeed())
+	tmpl.Spec.Template.Spec.DNSServers = []string{"9.9.9.9"}
+	g.Expect(c.Update(ctx, tmpl)).To(Succeed())
+	edited, err := r.controlPlaneSpecHash(ctx, specHashKCP())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(edited).NotTo(Equal(base))
+}
+
+func TestControlPlaneSpecHash_MissingTemplate(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	r := &KairosControlPlaneReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+	_, err := r.controlPlaneSpecHash(context.Background(), specHashKCP())
+	g.Expect(err).To(MatchError(ContainSubstring("KairosConfigTemplate")))
+}
+
+func TestMachineUpToDate(t *testing.T) {
+	kcp := specHashKCP()
+	kcp.Spec.RolloutBefore = &controlplanev1beta2.RolloutBefore{CertificatesExpiryDays: ptr.To(int32(30))}
+	expiresIn := func(d time.Duration) string { return time.Now().Add(d).UTC().Format(time.RFC3339) }
+	mk := func(version string, annotations map[string]string) *clusterv1.Machine {
+		return &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			Spec:       clusterv1.MachineSpec{Version: ptr.To(version)},
+		}
+	}
+	seed := mk(kcp.Spec.Version, map[string]string{specHashAnnotation: "h1", singleNodeAnnotation: "false"})
+	seed.Name = "cp-0"
+	r := &KairosControlPlaneReconciler{}
+	for _, tc := range []struct {
+		name    string
+		machine *clusterv1.Machine
+		want    bool
+	}{
+		{"version and hash match", mk(kcp.Spec.Version, map[string]string{specHashAnnotation: "h1"}), true},
+		{"hash differs", mk(kcp.Spec.Version, map[string]string{specHashAnnotation: "h0"}), false},
+		{"version differs", mk("v1.33.0+k0s.0", map[string]string{specHashAnnotation: "h1"}), false},
+		{"pre-hash machine is current", mk(kcp.Spec.Version, nil), true},
+		{"certificates expire after the rollout window", mk(kcp.Spec.Version, map[string]string{
+			specHashAnnotation: "h1", clusterv1.MachineCertificatesExpiryDateAnnotation: expiresIn(60 * 24 * time.Hour),
+		}), true},
+		{"certificates expire within the rollout window", mk(kcp.Spec.Version, map[string]string{
+			specHashAnnotation: "h1", clusterv1.MachineCertificatesExpiryDateAnnotation: expiresIn(10 * 24 * time.Hour),
+		}), false},
+		{"created for one replica", mk(kcp.Spec.Version, map[string]string{specHashAnnotation: "h1", singleNodeAnnotation: "true"}), true},
+		{"created for an HA control plane", mk(kcp.Spec.Version, map[string]string{specHashAnnotation: "h1", singleNodeAnnotation: "false"}), false},
+		{"etcd seed created for an HA control plane", seed, true},
+		{"migrated from the single role", mk(kcp.Spec.Version, map[string]string{specHashAnnotation: "h1", singleRoleMigrationAnnotation: singleRoleMigrationCompleted}), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(r.machineUpToDate(tc.machine, kcp, "h1", "cp-0")).To(Equal(tc.want))
+		})
+	}
+
+	// SingleNode only changes k0s nodes; other distributions are not rolled.
+	g := NewWithT(t)
+	k3s := specHashKCP()
+	k3s.Spec.Distribution = "k3s"
+	g.Expect(r.machineUpToDate(mk(k3s.Spec.Version, map[string]string{specHashAnnotation: "h1", singleNodeAnnotation: "false"}), k3s, "h1", "cp-0")).To(BeTrue())
+}
+
+// TestAdoptSpecHash: machines that predate spec hashing are stamped once with
+// the current hash; stamped and deleting machines are left alone.
+func TestAdoptSpecHash(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	legacy := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "default"}}
+	stamped := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{
+		Name: "stamped", Namespace: "default", Annotations: map[string]string{specHashAnnotation: "old"},
+	}}
+	deleting := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{
+		Name: "deleting", Namespace: "default", Finalizers: []string{"test"}, DeletionTimestamp: ptr.To(metav1.Now()),
+	}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(legacy, stamped, deleting).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+
+	g.Expect(r.adoptSpecHash(context.Background(), log.Log, []*clusterv1.Machine{legacy, stamped, deleting}, "new")).To(Succeed())
+
+	for name, want := range map[string]string{"legacy": "new", "stamped": "old", "deleting": ""} {
+		m := &clusterv1.Machine{}
+		g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, m)).To(Succeed())
+		g.Expect(m.Annotations[specHashAnnotation]).To(Equal(want), name)
+	}
+}
+
+func TestKairosConfigTemplateToKairosControlPlane(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	match := specHashKCP()
+	other := specHashKCP()
+	other.Name = "other"
+	other.Spec.KairosConfigTemplate.Name = "unrelated"
+	elsewhere := specHashKCP()
+	elsewhere.Namespace = "elsewhere"
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(match, other, elsewhere).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme}
+
+	reqs := r.kairosConfigTemplateToKairosControlPlane(context.Background(), specHashTemplate("cp-config"))
+	g.Expect(reqs).To(HaveLen(1))
+	g.Expect(reqs[0].NamespacedName).To(Equal(types.NamespacedName{Namespace: "default", Name: "kcp"}))
+}
@@ -761,6 +761,8 @@ func remoteKubeconfigPath(distribution string) string {
 		return "/var/lib/k0s/pki/admin.conf"
 	case "k3s":
 		return "/etc/rancher/k3s/k3s.yaml"
+	case "rke2":
+		return "/etc/rancher/rke2/rke2.yaml"
 	}
 	return ""
 }
@@ -691,3 +691,19 @@ func TestSSHFallbackWorker_PoolBoundedAndDeduplicates(t *testing.T) {
 		}
 	}
 }
+
+// TestRemoteKubeconfigPath pins the on-node admin kubeconfig each distribution
+// writes; an unknown distribution maps to "" (SSHFallbackMisconfigured).
+func TestRemoteKubeconfigPath(t *testing.T) {
+	for distribution, want := range map[string]string{
+		"":      "/var/lib/k0s/pki/admin.conf",
+		"k0s":   "/var/lib/k0s/pki/admin.conf",
+		"k3s":   "/etc/rancher/k3s/k3s.yaml",
+		"rke2":  "/etc/rancher/rke2/rke2.yaml",
+		"other": "",
+	} {
+		if got := remoteKubeconfigPath(distribution); got != want {
+			t.Errorf("remoteKubeconfigPath(%q) = %q, want %q", distribution, got, want)
+		}
+	}
+}
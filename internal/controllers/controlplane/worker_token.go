@@ -0,0 +1,416 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+const (
+	// nodeMintedWorkerTokenTTL is the --expiry the k0s init node and the
+	// hosted control-plane pod pass to `k0s token create --role=worker`. Their
+	// tokens carry no expiry annotation, so the controller assumes this one.
+	nodeMintedWorkerTokenTTL = 48 * time.Hour
+
+	// workerTokenPushGrace is how long after the kubeconfig was first observed
+	// the controller waits for the k0s init node to push the first worker
+	// token before minting one itself (e.g. for a control plane bootstrapped
+	// before the push block existed).
+	workerTokenPushGrace = 5 * time.Minute
+
+	// workerTokenRetryAfter is the requeue interval after a failed rotation.
+	workerTokenRetryAfter = time.Minute
+
+	// bootstrapTokenNamespace holds the workload cluster's bootstrap token
+	// Secrets, which the API server's bootstrap token authenticator reads.
+	bootstrapTokenNamespace = "kube-system"
+
+	// k3sBootstrapTokenGroup is the extra group `k3s token create` gives its
+	// bootstrap tokens.
+	k3sBootstrapTokenGroup = "system:bootstrappers:k3s:default-node-token"
+)
+
+// managesWorkerToken reports whether the control plane mints the worker join
+// token: k0s and k3s do, rke2 workers bring their own.
+func managesWorkerToken(kcp *controlplanev1beta2.KairosControlPlane) bool {
+	switch distributionOf(kcp) {
+	case "k0s", "k3s":
+		return true
+	}
+	return false
+}
+
+// ensureWorkerTokenSecret creates the worker join-token Secret that workers
+// without a token of their own resolve. Like the k0s HA join-token Secret it
+// is owner-ref'd to the KairosControlPlane and marked with the secret-type
+// label (KD-15). It is created empty: the k0s init node (or the hosted
+// control-plane pod) publishes the first token into it, and
+// reconcileWorkerToken fills and rotates it.
+func (r *KairosControlPlaneReconciler) ensureWorkerTokenSecret(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      bootstrapv1beta2.WorkerTokenSecretName(cluster.Name),
+			Namespace: cluster.Namespace,
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		if secret.Labels == nil {
+			secret.Labels = map[string]string{}
+		}
+		secret.Labels[clusterv1.ClusterNameLabel] = cluster.Name
+		secret.Labels[controlPlaneJoinTokenSecretTypeLabel] = bootstrapv1beta2.WorkerTokenSecretTypeValue
+		return controllerutil.SetControllerReference(kcp, secret, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("ensure worker-token secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return nil
+}
+
+// reconcileWorkerToken keeps a valid token in the worker-token Secret and
+// surfaces WorkerTokenReadyCondition. It returns how long until the next
+// rotation is due (0: nothing scheduled). Best-effort like the etcd backup
+// status: failures only show in the condition and are retried.
+//
+//   - A token published by a node carries no issued-at/expires-at
+//     annotations; it is stamped as issued now, expiring after
+//     nodeMintedWorkerTokenTTL.
+//   - An empty Secret is filled by the controller once the control plane is
+//     initialized: at once on k3s, after workerTokenPushGrace on k0s, whose
+//     init node (or hosted pod) normally publishes the first token.
+//   - A rotation is due one interval after issue, or one interval before
+//     expiry if that is sooner. The new token is a bootstrap token in the
+//     workload cluster valid for two intervals, so the one it replaces
+//     keeps working until its own expiry.
+//
+// The token value is NEVER logged.
+func (r *KairosControlPlaneReconciler) reconcileWorkerToken(ctx context.Context, log logr.Logger, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster) time.Duration {
+	if !managesWorkerToken(kcp) {
+		conditions.Delete(kcp, controlplanev1beta2.WorkerTokenReadyCondition)
+		return 0
+	}
+
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: bootstrapv1beta2.WorkerTokenSecretName(cluster.Name), Namespace: cluster.Namespace}
+	if err := r.Get(ctx, key, secret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.V(4).Info("Cannot read worker-token secret", "secret", key.String(), "error", err)
+			return 0
+		}
+		conditions.MarkFalse(kcp, controlplanev1beta2.WorkerTokenReadyCondition,
+			controlplanev1beta2.WaitingForWorkerTokenReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for the worker-token Secret to be created")
+		return 0
+	}
+
+	now := time.Now()
+	interval := controlplanev1beta2.WorkerTokenRotationInterval(&kcp.Spec)
+	var expiresAt time.Time
+	if len(secret.Data[joinTokenSecretDataKey]) == 0 {
+		if wait := workerTokenMintWait(kcp, now); wait != 0 {
+			msg := "Waiting for the control plane to initialize"
+			if kcp.Status.Initialized {
+				msg = "Waiting for the init node to publish the worker token"
+			}
+			conditions.MarkFalse(kcp, controlplanev1beta2.WorkerTokenReadyCondition,
+				controlplanev1beta2.WaitingForWorkerTokenReason, clusterv1.ConditionSeverityInfo, "%s", msg)
+			if wait < 0 {
+				return 0
+			}
+			return wait
+		}
+	} else {
+		var issuedAt time.Time
+		var stamped bool
+		issuedAt, expiresAt, stamped = workerTokenTimes(secret)
+		if !stamped {
+			issuedAt, expiresAt = now, now.Add(nodeMintedWorkerTokenTTL)
+			setWorkerTokenTimes(secret, issuedAt, expiresAt)
+			if err := r.Update(ctx, secret); err != nil {
+				log.V(4).Info("Cannot stamp worker-token secret", "secret", key.String(), "error", err)
+				return workerTokenRetryAfter
+			}
+		}
+		if due := workerTokenRotationDue(issuedAt, expiresAt, interval); now.Before(due) {
+			conditions.MarkTrue(kcp, controlplanev1beta2.WorkerTokenReadyCondition)
+			return due.Sub(now)
+		}
+	}
+
+	token, newExpiry, err := r.mintWorkerToken(ctx, kcp, cluster, now, 2*interval)
+	if err != nil {
+		msg := fmt.Sprintf("Cannot mint a worker token in the workload cluster: %v", err)
+		if now.Before(expiresAt) {
+			msg += fmt.Sprintf("; the current token expires at %s", expiresAt.UTC().Format(time.RFC3339))
+		}
+		conditions.MarkFalse(kcp, controlplanev1beta2.WorkerTokenReadyCondition,
+			controlplanev1beta2.WorkerTokenRotationFailedReason, clusterv1.ConditionSeverityWarning, "%s", msg)
+		return workerTokenRetryAfter
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[joinTokenSecretDataKey] = []byte(token)
+	setWorkerTokenTimes(secret, now, newExpiry)
+	if err := r.Update(ctx, secret); err != nil {
+		conditions.MarkFalse(kcp, controlplanev1beta2.WorkerTokenReadyCondition,
+			controlplanev1beta2.WorkerTokenRotationFailedReason, clusterv1.ConditionSeverityWarning,
+			"Cannot store the new worker token: %v", err)
+		return workerTokenRetryAfter
+	}
+	log.Info("Minted worker join token", "secret", key.String(), "expiresAt", newExpiry.UTC().Format(time.RFC3339))
+	conditions.MarkTrue(kcp, controlplanev1beta2.WorkerTokenReadyCondition)
+	return interval
+}
+
+// workerTokenMintWait returns how long the controller must still wait before
+// minting the first worker token into an empty Secret: 0 when it may mint now,
+// -1 while the control plane is not initialized (no workload cluster to mint
+// in; the kubeconfig Secret watch wakes us), otherwise the rest of the k0s
+// init node's push grace period.
+func workerTokenMintWait(kcp *controlplanev1beta2.KairosControlPlane, now time.Time) time.Duration {
+	if !kcp.Status.Initialized {
+		return -1
+	}
+	if distributionOf(kcp) != "k0s" {
+		return 0
+	}
+	since := now
+	if c := conditions.Get(kcp, controlplanev1beta2.KubeconfigReadyCondition); c != nil && c.Status == corev1.ConditionTrue {
+		since = c.LastTransitionTime.Time
+	}
+	if wait := since.Add(workerTokenPushGrace).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// workerTokenRotationDue returns when a token issued at issuedAt and expiring
+// at expiresAt must be replaced: one interval after issue, or one interval
+// before expiry if that is sooner.
+func workerTokenRotationDue(issuedAt, expiresAt time.Time, interval time.Duration) time.Time {
+	due := issuedAt.Add(interval)
+	if byExpiry := expiresAt.Add(-interval); byExpiry.Before(due) {
+		return byExpiry
+	}
+	return due
+}
+
+// workerTokenTimes reads the issued-at and expires-at annotations. ok is false
+// when either is missing or unparseable.
+func workerTokenTimes(secret *corev1.Secret) (issuedAt, expiresAt time.Time, ok bool) {
+	issuedAt, err := time.Parse(time.RFC3339, secret.Annotations[bootstrapv1beta2.WorkerTokenIssuedAtAnnotation])
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	expiresAt, err = time.Parse(time.RFC3339, secret.Annotations[bootstrapv1beta2.WorkerTokenExpiresAtAnnotation])
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return issuedAt, expiresAt, true
+}
+
+// setWorkerTokenTimes writes the issued-at and expires-at annotations.
+func setWorkerTokenTimes(secret *corev1.Secret, issuedAt, expiresAt time.Time) {
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[bootstrapv1beta2.WorkerTokenIssuedAtAnnotation] = issuedAt.UTC().Format(time.RFC3339)
+	secret.Annotations[bootstrapv1beta2.WorkerTokenExpiresAtAnnotation] = expiresAt.UTC().Format(time.RFC3339)
+}
+
+// mintWorkerToken creates a bootstrap token valid for ttl in the workload
+// cluster and returns it in the distribution's join-token format, with its
+// expiry. Expired tokens minted earlier are deleted on the way.
+func (r *KairosControlPlaneReconciler) mintWorkerToken(ctx context.Context, kcp *controlplanev1beta2.KairosControlPlane, cluster *clusterv1.Cluster, now time.Time, ttl time.Duration) (string, time.Time, error) {
+	server, caData, err := r.workloadAPIServer(ctx, cluster)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	factory := r.WorkloadClientFactory
+	if factory == nil {
+		factory = r.defaultWorkloadClient
+	}
+	wc, err := factory(ctx, cluster)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	id, err := randomBootstrapTokenString(6)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	secretPart, err := randomBootstrapTokenString(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := now.Add(ttl).UTC().Truncate(time.Second)
+	distribution := distributionOf(kcp)
+	bt := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "bootstrap-token-" + id,
+			Namespace: bootstrapTokenNamespace,
+			Labels:    map[string]string{controlPlaneJoinTokenSecretTypeLabel: bootstrapv1beta2.WorkerTokenSecretTypeValue},
+		},
+		Type: corev1.SecretTypeBootstrapToken,
+		Data: map[string][]byte{
+			"token-id":                       []byte(id),
+			"token-secret":                   []byte(secretPart),
+			"expiration":                     []byte(expiresAt.Format(time.RFC3339)),
+			"usage-bootstrap-authentication": []byte("true"),
+			"usage-bootstrap-signing":        []byte("true"),
+			"description":                    []byte(fmt.Sprintf("Worker join token for cluster %s, minted by the KairosControlPlane controller", cluster.Name)),
+		},
+	}
+	if distribution == "k3s" {
+		bt.Data["auth-extra-groups"] = []byte(k3sBootstrapTokenGroup)
+	}
+	if err := wc.Create(ctx, bt); err != nil {
+		return "", time.Time{}, fmt.Errorf("create bootstrap token secret: %w", err)
+	}
+	pruneExpiredWorkerBootstrapTokens(ctx, wc, now)
+
+	bootstrapToken := id + "." + secretPart
+	if distribution == "k3s" {
+		return k3sJoinToken(caData, bootstrapToken), expiresAt, nil
+	}
+	token, err := k0sWorkerJoinToken(server, caData, bootstrapToken)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// workloadAPIServer returns the API server URL and CA of the workload cluster
+// from the current context of its <cluster>-kubeconfig Secret.
+func (r *KairosControlPlaneReconciler) workloadAPIServer(ctx context.Context, cluster *clusterv1.Cluster) (string, []byte, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: fmt.Sprintf("%s-kubeconfig", cluster.Name)}
+	if err := r.Get(ctx, key, secret); err != nil {
+		return "", nil, fmt.Errorf("get workload kubeconfig secret %s: %w", key, err)
+	}
+	config, err := clientcmd.Load(secret.Data["value"])
+	if err != nil {
+		return "", nil, fmt.Errorf("parse workload kubeconfig %s: %w", key, err)
+	}
+	kctx := config.Contexts[config.CurrentContext]
+	if kctx == nil {
+		return "", nil, fmt.Errorf("workload kubeconfig %s has no current context", key)
+	}
+	c := config.Clusters[kctx.Cluster]
+	if c == nil || c.Server == "" || len(c.CertificateAuthorityData) == 0 {
+		return "", nil, fmt.Errorf("workload kubeconfig %s has no server and embedded CA for its current context", key)
+	}
+	return c.Server, c.CertificateAuthorityData, nil
+}
+
+// pruneExpiredWorkerBootstrapTokens deletes the bootstrap tokens this
+// controller minted that have expired; not every distribution runs the
+// token cleaner. Best-effort: failures are left for the next rotation.
+func pruneExpiredWorkerBootstrapTokens(ctx context.Context, wc client.Client, now time.Time) {
+	list := &corev1.SecretList{}
+	if err := wc.List(ctx, list, client.InNamespace(bootstrapTokenNamespace),
+		client.MatchingLabels{controlPlaneJoinTokenSecretTypeLabel: bootstrapv1beta2.WorkerTokenSecretTypeValue}); err != nil {
+		return
+	}
+	for i := range list.Items {
+		s := &list.Items[i]
+		exp, err := time.Parse(time.RFC3339, string(s.Data["expiration"]))
+		if err != nil || !exp.Before(now) {
+			continue
+		}
+		_ = wc.Delete(ctx, s)
+	}
+}
+
+// bootstrapTokenAlphabet is the character set of bootstrap token IDs and
+// secrets ([a-z0-9]).
+const bootstrapTokenAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// randomBootstrapTokenString returns n characters of bootstrapTokenAlphabet
+// from crypto/rand. Bytes past the largest multiple of the alphabet size are
+// rejected so every character is equally likely.
+func randomBootstrapTokenString(n int) (string, error) {
+	const limit = 256 - 256%len(bootstrapTokenAlphabet)
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("generate bootstrap token: %w", err)
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(out) < n {
+				out = append(out, bootstrapTokenAlphabet[int(b)%len(bootstrapTokenAlphabet)])
+			}
+		}
+	}
+	return string(out), nil
+}
+
+// k3sJoinToken returns a k3s "secure" join token for a bootstrap token: the
+// K10 prefix, the SHA-256 of the server CA the agent pins, and the token.
+func k3sJoinToken(caData []byte, bootstrapToken string) string {
+	sum := sha256.Sum256(caData)
+	return "K10" + hex.EncodeToString(sum[:]) + "::" + bootstrapToken
+}
+
+// k0sWorkerJoinToken returns a k0s worker join token for a bootstrap token in
+// the format `k0s token create --role=worker` prints: a kubelet-bootstrap
+// kubeconfig for the API server, gzipped and base64-encoded.
+func k0sWorkerJoinToken(server string, caData []byte, bootstrapToken string) (string, error) {
+	config := clientcmdapi.NewConfig()
+	config.Clusters["k0s"] = &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: caData}
+	config.AuthInfos["kubelet-bootstrap"] = &clientcmdapi.AuthInfo{Token: bootstrapToken}
+	config.Contexts["k0s"] = &clientcmdapi.Context{Cluster: "k0s", AuthInfo: "kubelet-bootstrap"}
+	config.CurrentContext = "k0s"
+	kubeconfig, err := clientcmd.Write(*config)
+	if err != nil {
+		return "", fmt.Errorf("serialize k0s join token: %w", err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(kubeconfig); err != nil {
+		return "", fmt.Errorf("compress k0s join token: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("compress k0s join token: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+const workerTokenTestServer = "https://10.0.0.10:6443"
+
+// workerTokenFixture returns an initialized KCP of the given distribution, the
+// worker-token Secret holding token (no annotations), and a workload
+// kubeconfig Secret together with its CA.
+func workerTokenFixture(t *testing.T, distribution, token string) (*controlplanev1beta2.KairosControlPlane, *corev1.Secret, *corev1.Secret, []byte) {
+	t.Helper()
+	kcp := k0sKCP()
+	kcp.Spec.Distribution = distribution
+	kcp.Status.Initialized = true
+	conditions.MarkTrue(kcp, controlplanev1beta2.KubeconfigReadyCondition)
+
+	wt := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      bootstrapv1beta2.WorkerTokenSecretName(testClusterName),
+			Namespace: "default",
+			Labels: map[string]string{
+				clusterv1.ClusterNameLabel:           testClusterName,
+				controlPlaneJoinTokenSecretTypeLabel: bootstrapv1beta2.WorkerTokenSecretTypeValue,
+			},
+		},
+	}
+	if token != "" {
+		wt.Data = map[string][]byte{joinTokenSecretDataKey: []byte(token)}
+	}
+
+	caCert, caKey, err := generateHostedCA(testClusterName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeconfig, err := hostedAdminKubeconfig(testClusterName, workerTokenTestServer, caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kc := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: testClusterName + "-kubeconfig", Namespace: "default"},
+		Data:       map[string][]byte{"value": kubeconfig},
+	}
+	return kcp, wt, kc, caCert
+}
+
+func getWorkerTokenSecret(g *WithT, c client.Client) *corev1.Secret {
+	g.THelper()
+	s := &corev1.Secret{}
+	g.Expect(c.Get(context.Background(), types.NamespacedName{Name: bootstrapv1beta2.WorkerTokenSecretName(testClusterName), Namespace: "default"}, s)).To(Succeed())
+	return s
+}
+
+// workloadBootstrapToken returns the single bootstrap token Secret in the
+// workload client as "<id>.<secret>".
+func workloadBootstrapToken(g *WithT, wc client.Client) (string, *corev1.Secret) {
+	g.THelper()
+	list := &corev1.SecretList{}
+	g.Expect(wc.List(context.Background(), list, client.InNamespace(bootstrapTokenNamespace))).To(Succeed())
+	g.Expect(list.Items).To(HaveLen(1))
+	s := &list.Items[0]
+	g.Expect(s.Type).To(Equal(corev1.SecretTypeBootstrapToken))
+	g.Expect(s.Name).To(Equal("bootstrap-token-" + string(s.Data["token-id"])))
+	g.Expect(string(s.Data["usage-bootstrap-authentication"])).To(Equal("true"))
+	return string(s.Data["token-id"]) + "." + string(s.Data["token-secret"]), s
+}
+
+func TestWorkerTokenRotationDue(t *testing.T) {
+	issued := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name     string
+		expires  time.Duration
+		interval time.Duration
+		want     time.Duration
+	}{
+		{"controller token: one interval after issue", 48 * time.Hour, 24 * time.Hour, 24 * time.Hour},
+		{"short interval on a node token", 48 * time.Hour, time.Hour, time.Hour},
+		{"interval close to the expiry", 48 * time.Hour, 36 * time.Hour, 12 * time.Hour},
+		{"interval past the expiry", 48 * time.Hour, 72 * time.Hour, -24 * time.Hour},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(workerTokenRotationDue(issued, issued.Add(tc.expires), tc.interval)).To(Equal(issued.Add(tc.want)))
+		})
+	}
+}
+
+func TestRandomBootstrapTokenString(t *testing.T) {
+	g := NewWithT(t)
+	a, err := randomBootstrapTokenString(16)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(a).To(MatchRegexp(`^[a-z0-9]{16}$`))
+	b, err := randomBootstrapTokenString(16)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(a).NotTo(Equal(b))
+}
+
+// TestReconcileWorkerToken_StampsNodePublishedToken: a token the k0s init node
+// pushed is stamped as issued now with the node's 48h expiry, and kept until
+// its rotation is due.
+func TestReconcileWorkerToken_StampsNodePublishedToken(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	kcp, wt, kc, _ := workerTokenFixture(t, "k0s", "node-token")
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(wt, kc).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme, WorkloadClientFactory: func(context.Context, *clusterv1.Cluster) (client.Client, error) {
+		return nil, errors.New("must not be called")
+	}}
+
+	requeue := r.reconcileWorkerToken(context.Background(), log.Log, kcp, testCluster())
+
+	g.Expect(requeue).To(BeNumerically("~", 24*time.Hour, time.Minute))
+	g.Expect(conditions.IsTrue(kcp, controlplanev1beta2.WorkerTokenReadyCondition)).To(BeTrue())
+	got := getWorkerTokenSecret(g, c)
+	g.Expect(string(got.Data[joinTokenSecretDataKey])).To(Equal("node-token"))
+	issuedAt, expiresAt, ok := workerTokenTimes(got)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(expiresAt.Sub(issuedAt)).To(Equal(nodeMintedWorkerTokenTTL))
+	g.Expect(issuedAt).To(BeTemporally("~", time.Now(), time.Minute))
+}
+
+// TestReconcileWorkerToken_K3sMintsOnceInitialized: an empty k3s Secret is
+// filled with a K10 token for a new workload bootstrap token.
+func TestReconcileWorkerToken_K3sMintsOnceInitialized(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	kcp, wt, kc, caCert := workerTokenFixture(t, "k3s", "")
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(wt, kc).Build()
+	wc := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme, WorkloadClientFactory: staticWorkloadClient(wc)}
+
+	requeue := r.reconcileWorkerToken(context.Background(), log.Log, kcp, testCluster())
+
+	g.Expect(requeue).To(Equal(controlplanev1beta2.DefaultWorkerTokenRotationInterval))
+	g.Expect(conditions.IsTrue(kcp, controlplanev1beta2.WorkerTokenReadyCondition)).To(BeTrue())
+	bootstrapToken, bt := workloadBootstrapToken(g, wc)
+	g.Expect(string(bt.Data["auth-extra-groups"])).To(Equal(k3sBootstrapTokenGroup))
+	sum := sha256.Sum256(caCert)
+	got := getWorkerTokenSecret(g, c)
+	g.Expect(string(got.Data[joinTokenSecretDataKey])).To(Equal("K10" + hex.EncodeToString(sum[:]) + "::" + bootstrapToken))
+	issuedAt, expiresAt, ok := workerTokenTimes(got)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(expiresAt.Sub(issuedAt)).To(BeNumerically("~", 2*controlplanev1beta2.DefaultWorkerTokenRotationInterval, time.Second))
+	g.Expect(string(bt.Data["expiration"])).To(Equal(got.Annotations[bootstrapv1beta2.WorkerTokenExpiresAtAnnotation]))
+}
+
+// TestReconcileWorkerToken_WaitsForInitialization: nothing is minted before
+// the workload cluster exists.
+func TestReconcileWorkerToken_WaitsForInitialization(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	kcp, wt, kc, _ := workerTokenFixture(t, "k3s", "")
+	kcp.Status.Initialized = false
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(wt, kc).Build()
+	wc := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme, WorkloadClientFactory: staticWorkloadClient(wc)}
+
+	g.Expect(r.reconcileWorkerToken(context.Background(), log.Log, kcp, testCluster())).To(BeZero())
+
+	g.Expect(conditions.GetReason(kcp, controlplanev1beta2.WorkerTokenReadyCondition)).To(Equal(controlplanev1beta2.WaitingForWorkerTokenReason))
+	g.Expect(getWorkerTokenSecret(g, c).Data).To(BeEmpty())
+}
+
+// TestReconcileWorkerToken_K0sFallsBackAfterPushGrace: an empty k0s Secret is
+// left to the init node for workerTokenPushGrace after the kubeconfig
+// appeared; past it the controller mints a k0s-format token itself.
+func TestReconcileWorkerToken_K0sFallsBackAfterPushGrace(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	kcp, wt, kc, caCert := workerTokenFixture(t, "k0s", "")
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(wt, kc).Build()
+	wc := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme, WorkloadClientFactory: staticWorkloadClient(wc)}
+
+	requeue := r.reconcileWorkerToken(context.Background(), log.Log, kcp, testCluster())
+	g.Expect(requeue).To(BeNumerically(">", 0))
+	g.Expect(requeue).To(BeNumerically("<=", workerTokenPushGrace))
+	g.Expect(conditions.GetReason(kcp, controlplanev1beta2.WorkerTokenReadyCondition)).To(Equal(controlplanev1beta2.WaitingForWorkerTokenReason))
+	g.Expect(getWorkerTokenSecret(g, c).Data).To(BeEmpty())
+
+	for i := range kcp.Status.Conditions {
+		if kcp.Status.Conditions[i].Type == controlplanev1beta2.KubeconfigReadyCondition {
+			kcp.Status.Conditions[i].LastTransitionTime = metav1.NewTime(time.Now().Add(-workerTokenPushGrace - time.Minute))
+		}
+	}
+	r.reconcileWorkerToken(context.Background(), log.Log, kcp, testCluster())
+
+	g.Expect(conditions.IsTrue(kcp, controlplanev1beta2.WorkerTokenReadyCondition)).To(BeTrue())
+	bootstrapToken, bt := workloadBootstrapToken(g, wc)
+	g.Expect(bt.Data).NotTo(HaveKey("auth-extra-groups"))
+
+	raw, err := base64.StdEncoding.DecodeString(string(getWorkerTokenSecret(g, c).Data[joinTokenSecretDataKey]))
+	g.Expect(err).NotTo(HaveOccurred())
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	g.Expect(err).NotTo(HaveOccurred())
+	kubeconfig, err := io.ReadAll(zr)
+	g.Expect(err).NotTo(HaveOccurred())
+	config, err := clientcmd.Load(kubeconfig)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.CurrentContext).To(Equal("k0s"))
+	g.Expect(config.Clusters["k0s"].Server).To(Equal(workerTokenTestServer))
+	g.Expect(config.Clusters["k0s"].CertificateAuthorityData).To(Equal(caCert))
+	g.Expect(config.AuthInfos["kubelet-bootstrap"].Token).To(Equal(bootstrapToken))
+}
+
+// TestReconcileWorkerToken_RotatesDueToken: a token past its rotation time is
+// replaced, and the expired bootstrap tokens minted earlier are deleted.
+func TestReconcileWorkerToken_RotatesDueToken(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	kcp, wt, kc, _ := workerTokenFixture(t, "k3s", "old-token")
+	kcp.Spec.WorkerToken = &controlplanev1beta2.WorkerToken{RotationInterval: &metav1.Duration{Duration: 6 * time.Hour}}
+	now := time.Now()
+	setWorkerTokenTimes(wt, now.Add(-7*time.Hour), now.Add(5*time.Hour))
+	expired := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "bootstrap-token-expird",
+			Namespace: bootstrapTokenNamespace,
+			Labels:    map[string]string{controlPlaneJoinTokenSecretTypeLabel: bootstrapv1beta2.WorkerTokenSecretTypeValue},
+		},
+		Type: corev1.SecretTypeBootstrapToken,
+		Data: map[string][]byte{"expiration": []byte(now.Add(-time.Hour).UTC().Format(time.RFC3339))},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(wt, kc).Build()
+	wc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(expired).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme, WorkloadClientFactory: staticWorkloadClient(wc)}
+
+	requeue := r.reconcileWorkerToken(context.Background(), log.Log, kcp, testCluster())
+
+	g.Expect(requeue).To(Equal(6 * time.Hour))
+	g.Expect(conditions.IsTrue(kcp, controlplanev1beta2.WorkerTokenReadyCondition)).To(BeTrue())
+	bootstrapToken, _ := workloadBootstrapToken(g, wc)
+	got := getWorkerTokenSecret(g, c)
+	g.Expect(strings.HasSuffix(string(got.Data[joinTokenSecretDataKey]), "::"+bootstrapToken)).To(BeTrue())
+	issuedAt, expiresAt, ok := workerTokenTimes(got)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(issuedAt).To(BeTemporally("~", now, time.Minute))
+	g.Expect(expiresAt.Sub(issuedAt)).To(BeNumerically("~", 12*time.Hour, time.Second))
+}
+
+// TestReconcileWorkerToken_RotationFailureKeepsToken: an unreachable workload
+// cluster leaves the due token in place and raises a warning.
+func TestReconcileWorkerToken_RotationFailureKeepsToken(t *testing.T) {
+	g := NewWithT(t)
+	scheme := haTestScheme(g)
+	kcp, wt, kc, _ := workerTokenFixture(t, "k0s", "old-token")
+	now := time.Now()
+	setWorkerTokenTimes(wt, now.Add(-30*time.Hour), now.Add(18*time.Hour))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(wt, kc).Build()
+	r := &KairosControlPlaneReconciler{Client: c, Scheme: scheme, WorkloadClientFactory: func(context.Context, *clusterv1.Cluster) (client.Client, error) {
+		return nil, errors.New("unreachable")
+	}}
+
+	g.Expect(r.reconcileWorkerToken(context.Background(), log.Log, kcp, testCluster())).To(Equal(workerTokenRetryAfter))
+
+	cond := conditions.Get(kcp, controlplanev1beta2.WorkerTokenReadyCondition)
+	g.Expect(cond).NotTo(BeNil())
+	g.Expect(cond.Reason).To(Equal(controlplanev1beta2.WorkerTokenRotationFailedReason))
+	g.Expect(cond.Severity).To(Equal(clusterv1.ConditionSeverityWarning))
+	g.Expect(cond.Message).To(ContainSubstring("the current token expires at"))
+	g.Expect(string(getWorkerTokenSecret(g, c).Data[joinTokenSecretDataKey])).To(Equal("old-token"))
+}
+
+// TestReconcileWorkerToken_RKE2Unmanaged: rke2 workers bring their own token.
+func TestReconcileWorkerToken_RKE2Unmanaged(t *testing.T) {
+	g := NewWithT(t)
+	kcp := k0sKCP()
+	kcp.Spec.Distribution = "rke2"
+	conditions.MarkTrue(kcp, controlplanev1beta2.WorkerTokenReadyCondition)
+
+	r := &KairosControlPlaneReconciler{}
+	g.Expect(r.reconcileWorkerToken(context.Background(), log.Log, kcp, testCluster())).To(BeZero())
+	g.Expect(conditions.Get(kcp, controlplanev1beta2.WorkerTokenReadyCondition)).To(BeNil())
+}
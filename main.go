@@ -19,9 +19,12 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -134,10 +137,33 @@ func main() {
 			"original", mgmtAPIServer, "override", override)
 		mgmtAPIServer = override
 	}
+	// Nodes verify the management apiserver with this CA (curl --cacert);
+	// the node push never skips TLS verification. By default it is the CA the
+	// manager itself trusts. KAIROS_MANAGEMENT_CA_SECRET ("<namespace>/<name>",
+	// key "ca.crt") overrides it when the URL nodes dial presents a different
+	// chain, e.g. an override URL behind a TLS-terminating proxy. When
+	// WATCH_NAMESPACE is set the Secret must live in the watched namespace.
+	mgmtCABundle, err := bootstrap.ManagementCABundleFromRESTConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to load management CA bundle")
+		os.Exit(1)
+	}
+	var mgmtCASecretRef *types.NamespacedName
+	if ref := os.Getenv("KAIROS_MANAGEMENT_CA_SECRET"); ref != "" {
+		ns, name, ok := strings.Cut(ref, "/")
+		if !ok || ns == "" || name == "" {
+			setupLog.Error(fmt.Errorf("expected <namespace>/<name>, got %q", ref), "invalid KAIROS_MANAGEMENT_CA_SECRET")
+			os.Exit(1)
+		}
+		mgmtCASecretRef = &types.NamespacedName{Namespace: ns, Name: name}
+		setupLog.Info("Using management CA bundle from Secret", "secret", mgmtCASecretRef.String())
+	}
 	mgmtResolver := bootstrap.NewKubeVirtTokenResolver(
 		mgr.GetClient(),
 		mgr.GetScheme(),
 		mgmtAPIServer,
+		mgmtCABundle,
+		mgmtCASecretRef,
 	)
 	if err = (&bootstrap.KairosConfigReconciler{
 		Client:               mgr.GetClient(),
@@ -0,0 +1,149 @@
+/*
+Copyright 2024 The Kairos CAPI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+implied. See the License for the specific language governing
+permissions and limitations under the License.
+*/
+
+package envtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bootstrapv1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/bootstrap/v1beta2"
+	controlplanev1beta2 "github.com/kairos-io/cluster-api-provider-kairos/api/controlplane/v1beta2"
+)
+
+// TestHostedControlPlane runs a hosted (spec.hosted) KairosControlPlane with
+// a ClusterIP Service, whose address the API server allocates at once.
+// envtest has no StatefulSet controller, so the test plays it: once the
+// StatefulSet exists it reports the pod ready, and the KCP must go
+// initialized and ready with its endpoint, kubeconfig and worker-token Secret
+// in place — without ever writing Cluster.Spec.ControlPlaneEndpoint (KD-12).
+func TestHostedControlPlane(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping envtest in short mode")
+	}
+	g := NewWithT(t)
+	ctx, c, _, _, teardown := startKCPEnvtest(t)
+	defer teardown()
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "hosted-ns"}}
+	g.Expect(c.Create(ctx, ns)).To(Succeed())
+
+	clusterName := "hosted-cluster"
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: ns.Name},
+		Spec: clusterv1.ClusterSpec{
+			ControlPlaneRef: &corev1.ObjectReference{
+				APIVersion: controlplanev1beta2.GroupVersion.String(),
+				Kind:       "KairosControlPlane",
+				Name:       clusterName + "-kcp",
+				Namespace:  ns.Name,
+			},
+		},
+	}
+	g.Expect(c.Create(ctx, cluster)).To(Succeed())
+
+	kcp := &controlplanev1beta2.KairosControlPlane{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-kcp",
+			Namespace: ns.Name,
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: clusterName},
+		},
+		Spec: controlplanev1beta2.KairosControlPlaneSpec{
+			Replicas:     ptr.To(int32(1)),
+			Version:      "v1.30.2+k0s.0",
+			Distribution: "k0s",
+			Hosted: &controlplanev1beta2.HostedControlPlane{
+				Service: controlplanev1beta2.HostedControlPlaneService{Type: corev1.ServiceTypeClusterIP},
+			},
+		},
+	}
+	g.Expect(c.Create(ctx, kcp)).To(Succeed())
+
+	stsKey := types.NamespacedName{Name: clusterName + "-k0s-controller", Namespace: ns.Name}
+	stopFakeStatefulSetController := startFakeStatefulSetController(ctx, c, stsKey)
+	defer stopFakeStatefulSetController()
+
+	svc := &corev1.Service{}
+	g.Eventually(func() error { return c.Get(ctx, stsKey, svc) }, 30*time.Second).Should(Succeed())
+
+	g.Eventually(func(g Gomega) {
+		got := &controlplanev1beta2.KairosControlPlane{}
+		g.Expect(c.Get(ctx, client.ObjectKeyFromObject(kcp), got)).To(Succeed())
+		g.Expect(got.Spec.ControlPlaneEndpoint).To(Equal(clusterv1.APIEndpoint{Host: svc.Spec.ClusterIP, Port: 6443}))
+		g.Expect(got.Status.Ready).To(BeTrue())
+		g.Expect(got.Status.Initialized).To(BeTrue())
+		g.Expect(conditions.IsTrue(got, clusterv1.ReadyCondition)).To(BeTrue())
+		g.Expect(conditions.IsTrue(got, controlplanev1beta2.KubeconfigReadyCondition)).To(BeTrue())
+	}, 60*time.Second, time.Second).Should(Succeed())
+
+	kubeconfig := &corev1.Secret{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: clusterName + "-kubeconfig", Namespace: ns.Name}, kubeconfig)).To(Succeed())
+	g.Expect(kubeconfig.Data["value"]).To(ContainSubstring("https://" + svc.Spec.ClusterIP + ":6443"))
+
+	workerToken := &corev1.Secret{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Name: bootstrapv1beta2.WorkerTokenSecretName(clusterName), Namespace: ns.Name}, workerToken)).To(Succeed())
+	g.Expect(workerToken.Data).To(BeEmpty())
+
+	g.Consistently(func() string {
+		got := &clusterv1.Cluster{}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(cluster), got); err != nil {
+			return "get-error: " + err.Error()
+		}
+		return got.Spec.ControlPlaneEndpoint.Host
+	}, 3*time.Second, 500*time.Millisecond).Should(BeEmpty())
+}
+
+// startFakeStatefulSetController reports the StatefulSet's single pod ready
+// once it exists, standing in for kube-controller-manager and the kubelet.
+func startFakeStatefulSetController(ctx context.Context, c client.Client, key types.NamespacedName) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			sts := &appsv1.StatefulSet{}
+			if err := c.Get(ctx, key, sts); err != nil || sts.Status.ReadyReplicas == 1 {
+				continue
+			}
+			sts.Status = appsv1.StatefulSetStatus{
+				ObservedGeneration: sts.Generation,
+				Replicas:           1,
+				ReadyReplicas:      1,
+				CurrentReplicas:    1,
+				UpdatedReplicas:    1,
+				AvailableReplicas:  1,
+			}
+			_ = c.Status().Update(ctx, sts)
+		}
+	}()
+	return cancel
+}
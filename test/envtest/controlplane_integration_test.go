@@ -23,7 +23,9 @@ import (
 	"time"
 
 	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -78,6 +80,8 @@ func TestControlPlaneIntegration(t *testing.T) {
 	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
 	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
 	g.Expect(controlplanev1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(appsv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(rbacv1.AddToScheme(scheme)).To(Succeed())
 
 	// Create manager
 	mgr, err := manager.New(cfg, manager.Options{
@@ -247,6 +251,8 @@ func startKCPEnvtest(t *testing.T) (context.Context, client.Client, *rest.Config
 	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
 	g.Expect(bootstrapv1beta2.AddToScheme(scheme)).To(Succeed())
 	g.Expect(controlplanev1beta2.AddToScheme(scheme)).To(Succeed())
+	g.Expect(appsv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(rbacv1.AddToScheme(scheme)).To(Succeed())
 
 	mgr, err := manager.New(cfg, manager.Options{Scheme: scheme, Logger: log.Log})
 	g.Expect(err).NotTo(HaveOccurred())